@@ -42,6 +42,7 @@ func New(cfg config.Config) (*App, error) {
 	}
 
 	h := handler.New(r, cfg.JWTSecret)
+	h.SetArtifactDir(cfg.ArtifactDir)
 	router := httpserver.NewRouter(h, cfg.JWTSecret)
 
 	s := &http.Server{
@@ -49,6 +49,12 @@ type RuntimeTarget struct {
 	Protocol string `json:"protocol"`
 }
 
+// RuntimeAuth is the relay credential of the tunnel a runtime belongs to.
+type RuntimeAuth struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
 type RuntimeApplyRoleRequest struct {
 	ReservationID string          `json:"reservationId"`
 	ResourceKey   string          `json:"resourceKey"`
@@ -56,6 +62,10 @@ type RuntimeApplyRoleRequest struct {
 	Protocol      string          `json:"protocol"`
 	Strategy      string          `json:"strategy"`
 	Targets       []RuntimeTarget `json:"targets"`
+	Auth          *RuntimeAuth    `json:"auth,omitempty"`
+	// TransportOptions carries the tunnel's transport settings so the peer's
+	// listeners and dialers match ours.
+	TransportOptions json.RawMessage `json:"transportOptions,omitempty"`
 }
 
 type RuntimeApplyRoleResponse struct {
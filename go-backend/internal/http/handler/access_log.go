@@ -0,0 +1,244 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-backend/internal/http/response"
+	"go-backend/internal/store/model"
+	"go-backend/internal/store/repo"
+)
+
+// Entry nodes report one record per closed connection of a forward with
+// accessLog enabled. The agent registers a recorder under this name when it
+// starts flow reporting.
+const (
+	accessLogRecorderName     = "panel_access"
+	accessLogRecord           = "recorder.service.handler"
+	accessLogRetentionConfig  = "access_log_retention_days"
+	accessLogDefaultRetention = 7
+	accessLogMaxPageSize      = 200
+	// Agents send at most 200 records per batch; the limits leave headroom
+	// for that while keeping a misbehaving node from flooding the panel.
+	accessLogMaxBatch    = 1000
+	accessLogMaxBodySize = 8 << 20
+)
+
+// accessLogItem is the subset of the agent's handler record the panel keeps.
+type accessLogItem struct {
+	Service     string        `json:"service"`
+	Network     string        `json:"network"`
+	ClientIP    string        `json:"clientIP"`
+	RemoteAddr  string        `json:"remote"`
+	Host        string        `json:"host"`
+	InputBytes  int64         `json:"inputBytes"`
+	OutputBytes int64         `json:"outputBytes"`
+	Err         string        `json:"err"`
+	Duration    time.Duration `json:"duration"`
+	Time        time.Time     `json:"time"`
+}
+
+// parseAccessLogInput reads the accessLog switch; it accepts a boolean or
+// 0/1.
+func parseAccessLogInput(req map[string]interface{}) (enabled int, present bool, err error) {
+	if v, ok := req["accessLog"].(bool); ok {
+		if v {
+			return 1, true, nil
+		}
+		return 0, true, nil
+	}
+	return parseConnLimitInput(req, "accessLog", 1, "连接日志开关")
+}
+
+// applyAccessLog attaches the panel recorder to every service of a forward
+// that has access logging enabled.
+func applyAccessLog(services []map[string]interface{}, forward *forwardRecord) {
+	if forward == nil || forward.AccessLog != 1 {
+		return
+	}
+	for _, service := range services {
+		service["recorders"] = []map[string]interface{}{
+			{"name": accessLogRecorderName, "record": accessLogRecord},
+		}
+	}
+}
+
+func accessLogRequirement(forward *forwardRecord) nodeCapabilityRequirement {
+	req := nodeCapabilityRequirement{}
+	if forward != nil && forward.AccessLog == 1 {
+		req.Features = []string{"accessLog"}
+	}
+	return req
+}
+
+// buildAccessLogs maps agent records to rows. Records of services that are
+// not panel forwards are dropped.
+func buildAccessLogs(nodeID int64, items []accessLogItem, now time.Time) []model.AccessLog {
+	rows := make([]model.AccessLog, 0, len(items))
+	for _, item := range items {
+		forwardID, userID, _, ok := parseFlowServiceIDs(item.Service)
+		if !ok {
+			continue
+		}
+		clientIP := strings.TrimSpace(item.ClientIP)
+		if clientIP == "" {
+			clientIP = hostOnly(item.RemoteAddr)
+		}
+		at := item.Time.UnixMilli()
+		if item.Time.IsZero() {
+			at = now.UnixMilli()
+		}
+		rows = append(rows, model.AccessLog{
+			ForwardID:  forwardID,
+			UserID:     userID,
+			NodeID:     nodeID,
+			Network:    truncateString(item.Network, 16),
+			ClientIP:   truncateString(clientIP, 64),
+			Target:     truncateString(item.Host, 255),
+			InBytes:    item.InputBytes,
+			OutBytes:   item.OutputBytes,
+			DurationMs: item.Duration.Milliseconds(),
+			Error:      truncateString(item.Err, 255),
+			Time:       at,
+		})
+	}
+	return rows
+}
+
+func hostOnly(addr string) string {
+	addr = strings.TrimSpace(addr)
+	if i := strings.LastIndex(addr, ":"); i > 0 {
+		return strings.Trim(addr[:i], "[]")
+	}
+	return addr
+}
+
+func truncateString(s string, max int) string {
+	s = strings.TrimSpace(s)
+	if len(s) <= max {
+		return s
+	}
+	return s[:max]
+}
+
+// flowAccess ingests access log batches. Like flow uploads it always answers
+// "ok" so agents do not retry batches the panel cannot use.
+func (h *Handler) flowAccess(w http.ResponseWriter, r *http.Request) {
+	secret := r.URL.Query().Get("secret")
+	node, _ := h.repo.GetNodeBySecret(secret)
+	if node != nil {
+		raw, err := readAndDecryptFlowBody(http.MaxBytesReader(w, r.Body, accessLogMaxBodySize), secret)
+		if err == nil && strings.TrimSpace(raw) != "" {
+			var items []accessLogItem
+			if json.Unmarshal([]byte(raw), &items) == nil {
+				if len(items) > accessLogMaxBatch {
+					items = items[:accessLogMaxBatch]
+				}
+				_ = h.repo.InsertAccessLogs(buildAccessLogs(node.ID, items, time.Now()))
+			}
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	_, _ = w.Write([]byte("ok"))
+}
+
+// forwardAccessLogs pages through access logs. Admins may filter by forward
+// and user; other users only see logs of their own forwards.
+func (h *Handler) forwardAccessLogs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		response.WriteJSON(w, response.ErrDefault("请求失败"))
+		return
+	}
+	var req map[string]interface{}
+	if err := decodeJSON(r.Body, &req); err != nil {
+		response.WriteJSON(w, response.ErrDefault("请求参数错误"))
+		return
+	}
+
+	query := repo.AccessLogQuery{
+		ForwardID: asInt64(req["forwardId"], 0),
+		UserID:    asInt64(req["userId"], 0),
+		ClientIP:  strings.TrimSpace(asString(req["clientIp"])),
+		StartMs:   asInt64(req["start"], 0),
+		EndMs:     asInt64(req["end"], 0),
+	}
+	if query.ForwardID > 0 {
+		if _, _, _, err := h.resolveForwardAccess(r, query.ForwardID); err != nil {
+			if errors.Is(err, errForwardNotFound) {
+				response.WriteJSON(w, response.ErrDefault(err.Error()))
+				return
+			}
+			response.WriteJSON(w, response.Err(-2, err.Error()))
+			return
+		}
+	}
+	userID, roleID, err := userRoleFromRequest(r)
+	if err != nil {
+		response.WriteJSON(w, response.Err(-2, err.Error()))
+		return
+	}
+	if roleID != 0 {
+		query.UserID = userID
+	}
+
+	page := asInt(req["page"], 1)
+	if page < 1 {
+		page = 1
+	}
+	size := asInt(req["size"], 50)
+	if size < 1 || size > accessLogMaxPageSize {
+		size = accessLogMaxPageSize
+	}
+	query.Offset = (page - 1) * size
+	query.Limit = size
+
+	rows, total, err := h.repo.ListAccessLogs(query)
+	if err != nil {
+		response.WriteJSON(w, response.Err(-2, err.Error()))
+		return
+	}
+	list := make([]map[string]interface{}, 0, len(rows))
+	for _, row := range rows {
+		list = append(list, map[string]interface{}{
+			"id":         row.ID,
+			"forwardId":  row.ForwardID,
+			"userId":     row.UserID,
+			"nodeId":     row.NodeID,
+			"network":    row.Network,
+			"clientIp":   row.ClientIP,
+			"target":     row.Target,
+			"inBytes":    row.InBytes,
+			"outBytes":   row.OutBytes,
+			"durationMs": row.DurationMs,
+			"error":      row.Error,
+			"time":       row.Time,
+		})
+	}
+	response.WriteJSON(w, response.OK(map[string]interface{}{
+		"total": total,
+		"list":  list,
+	}))
+}
+
+// accessLogRetention reads the retention in days from the config table.
+func (h *Handler) accessLogRetention() time.Duration {
+	days := accessLogDefaultRetention
+	if cfg, err := h.repo.GetConfigByName(accessLogRetentionConfig); err == nil && cfg != nil {
+		if v, err := strconv.Atoi(strings.TrimSpace(cfg.Value)); err == nil && v > 0 {
+			days = v
+		}
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+func (h *Handler) runAccessLogRetentionJob(now time.Time) {
+	if h == nil || h.repo == nil {
+		return
+	}
+	_ = h.repo.PurgeOldAccessLogs(now.Add(-h.accessLogRetention()).UnixMilli())
+}
@@ -0,0 +1,106 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"go-backend/internal/store/repo"
+)
+
+func TestBuildAccessLogsMapsAgentRecords(t *testing.T) {
+	var items []accessLogItem
+	raw := `[
+		{"service":"12_3_7_tcp","network":"tcp","remote":"203.0.113.9:51234","host":"10.0.0.5:443","inputBytes":120,"outputBytes":4096,"duration":1500000000,"time":"2026-10-18T08:00:00Z"},
+		{"service":"12_3_7_udp","network":"udp","clientIP":"198.51.100.4","host":"10.0.0.5:53","err":"dial timeout","duration":0},
+		{"service":"web_api","network":"tcp","host":"10.0.0.5:80"}
+	]`
+	if err := json.Unmarshal([]byte(raw), &items); err != nil {
+		t.Fatalf("decode records: %v", err)
+	}
+
+	now := time.Date(2026, 10, 18, 9, 0, 0, 0, time.UTC)
+	rows := buildAccessLogs(5, items, now)
+	if len(rows) != 2 {
+		t.Fatalf("expected records of non-forward services to be dropped, got %d rows", len(rows))
+	}
+	first := rows[0]
+	if first.ForwardID != 12 || first.UserID != 3 || first.NodeID != 5 {
+		t.Fatalf("unexpected ids: %+v", first)
+	}
+	if first.ClientIP != "203.0.113.9" || first.Target != "10.0.0.5:443" || first.DurationMs != 1500 {
+		t.Fatalf("unexpected connection fields: %+v", first)
+	}
+	if first.InBytes != 120 || first.OutBytes != 4096 || first.Time != time.Date(2026, 10, 18, 8, 0, 0, 0, time.UTC).UnixMilli() {
+		t.Fatalf("unexpected traffic fields: %+v", first)
+	}
+	if rows[1].ClientIP != "198.51.100.4" || rows[1].Error != "dial timeout" || rows[1].Time != now.UnixMilli() {
+		t.Fatalf("unexpected udp record: %+v", rows[1])
+	}
+}
+
+func TestApplyAccessLogAttachesRecorder(t *testing.T) {
+	services := []map[string]interface{}{{"name": "1_1_0_tcp"}, {"name": "1_1_0_udp"}}
+	applyAccessLog(services, &forwardRecord{})
+	if _, ok := services[0]["recorders"]; ok {
+		t.Fatalf("expected no recorder when access logging is off")
+	}
+
+	applyAccessLog(services, &forwardRecord{AccessLog: 1})
+	for _, service := range services {
+		recorders, _ := service["recorders"].([]map[string]interface{})
+		if len(recorders) != 1 || recorders[0]["name"] != accessLogRecorderName || recorders[0]["record"] != accessLogRecord {
+			t.Fatalf("unexpected recorders: %+v", service["recorders"])
+		}
+	}
+	if req := accessLogRequirement(&forwardRecord{AccessLog: 1}); len(req.Features) != 1 || req.Features[0] != "accessLog" {
+		t.Fatalf("expected the accessLog feature to be required, got %+v", req)
+	}
+}
+
+func TestParseAccessLogInput(t *testing.T) {
+	if v, present, err := parseAccessLogInput(map[string]interface{}{"accessLog": true}); err != nil || !present || v != 1 {
+		t.Fatalf("expected true to enable, got %d %v %v", v, present, err)
+	}
+	if _, present, _ := parseAccessLogInput(map[string]interface{}{}); present {
+		t.Fatalf("expected a missing field not to be present")
+	}
+	if _, _, err := parseAccessLogInput(map[string]interface{}{"accessLog": 2}); err == nil {
+		t.Fatalf("expected 2 to be rejected")
+	}
+}
+
+func TestFlowAccessCapsBatches(t *testing.T) {
+	r, err := repo.Open(filepath.Join(t.TempDir(), "access.db"))
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	t.Cleanup(func() { _ = r.Close() })
+	h := New(r, "secret")
+	insertOfflineNode(t, r, 1, "entry")
+
+	post := func(body string) {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		h.flowAccess(rec, httptest.NewRequest(http.MethodPost, "/flow/access?secret=entry-secret", strings.NewReader(body)))
+		if rec.Body.String() != "ok" {
+			t.Fatalf("expected ok, got %q", rec.Body.String())
+		}
+	}
+	record := `{"service":"12_3_7_tcp","network":"tcp","host":"10.0.0.5:443"}`
+
+	post("[" + strings.TrimSuffix(strings.Repeat(record+",", accessLogMaxBatch+50), ",") + "]")
+	if got := mustQueryInt(t, r, `SELECT COUNT(*) FROM access_log`); got != accessLogMaxBatch {
+		t.Fatalf("expected the batch to be capped at %d, got %d", accessLogMaxBatch, got)
+	}
+
+	// A body over the size limit is dropped without being read to the end.
+	post("[" + record + "," + strings.Repeat(" ", accessLogMaxBodySize) + "]")
+	if got := mustQueryInt(t, r, `SELECT COUNT(*) FROM access_log`); got != accessLogMaxBatch {
+		t.Fatalf("expected an oversized body to be dropped, got %d rows", got)
+	}
+}
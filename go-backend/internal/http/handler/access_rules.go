@@ -0,0 +1,253 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+)
+
+const accessRulesMaxEntries = 1000
+
+// accessRules restricts which clients may connect to a forward's entry
+// listeners. Tunnel rules apply to every forward on the tunnel in addition to
+// the forward's own. A client must match an allow entry when any is set and
+// must not match a deny entry.
+type accessRules struct {
+	Allow          []string `json:"allow,omitempty"`
+	Deny           []string `json:"deny,omitempty"`
+	AllowCountries []string `json:"allowCountries,omitempty"`
+	DenyCountries  []string `json:"denyCountries,omitempty"`
+	// GeoIPFile is the MaxMind DB path on the node; empty uses the agent's
+	// GeoLite2-Country.mmdb in its working directory.
+	GeoIPFile string `json:"geoipFile,omitempty"`
+}
+
+func (r *accessRules) empty() bool {
+	return r == nil || len(r.Allow)+len(r.Deny)+len(r.AllowCountries)+len(r.DenyCountries) == 0
+}
+
+// parseAccessRulesInput validates the accessRules request field and returns
+// its normalized JSON, or "" when no rule is set. present is false when the
+// field was not sent at all.
+func parseAccessRulesInput(req map[string]interface{}) (value string, present bool, err error) {
+	raw, ok := req["accessRules"]
+	if !ok {
+		return "", false, nil
+	}
+	if raw == nil {
+		return "", true, nil
+	}
+
+	var rules accessRules
+	switch v := raw.(type) {
+	case string:
+		if strings.TrimSpace(v) == "" {
+			return "", true, nil
+		}
+		if err := json.Unmarshal([]byte(v), &rules); err != nil {
+			return "", true, errors.New("访问规则格式错误")
+		}
+	case map[string]interface{}:
+		b, _ := json.Marshal(v)
+		if err := json.Unmarshal(b, &rules); err != nil {
+			return "", true, errors.New("访问规则格式错误")
+		}
+	default:
+		return "", true, errors.New("访问规则格式错误")
+	}
+
+	normalized, err := normalizeAccessRules(rules)
+	if err != nil || normalized == nil {
+		return "", true, err
+	}
+	b, _ := json.Marshal(normalized)
+	return string(b), true, nil
+}
+
+func normalizeAccessRules(rules accessRules) (*accessRules, error) {
+	var err error
+	if rules.Allow, err = normalizeAccessCIDRs(rules.Allow); err != nil {
+		return nil, err
+	}
+	if rules.Deny, err = normalizeAccessCIDRs(rules.Deny); err != nil {
+		return nil, err
+	}
+	if rules.AllowCountries, err = normalizeAccessCountries(rules.AllowCountries); err != nil {
+		return nil, err
+	}
+	if rules.DenyCountries, err = normalizeAccessCountries(rules.DenyCountries); err != nil {
+		return nil, err
+	}
+	if len(rules.Allow)+len(rules.Deny)+len(rules.AllowCountries)+len(rules.DenyCountries) > accessRulesMaxEntries {
+		return nil, fmt.Errorf("访问规则条目不能超过 %d 条", accessRulesMaxEntries)
+	}
+	rules.GeoIPFile = strings.TrimSpace(rules.GeoIPFile)
+	if strings.ContainsAny(rules.GeoIPFile, "\r\n") {
+		return nil, errors.New("GeoIP 数据库路径格式错误")
+	}
+	if len(rules.AllowCountries)+len(rules.DenyCountries) == 0 {
+		rules.GeoIPFile = ""
+	}
+	if rules.empty() {
+		return nil, nil
+	}
+	return &rules, nil
+}
+
+// normalizeAccessCIDRs accepts single addresses and CIDR blocks and returns
+// them in canonical form without duplicates.
+func normalizeAccessCIDRs(items []string) ([]string, error) {
+	out := make([]string, 0, len(items))
+	seen := make(map[string]struct{}, len(items))
+	for _, item := range items {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		var canonical string
+		if ip := net.ParseIP(item); ip != nil {
+			canonical = ip.String()
+		} else if _, ipNet, err := net.ParseCIDR(item); err == nil {
+			canonical = ipNet.String()
+		} else {
+			return nil, fmt.Errorf("无效的 IP 或 CIDR: %s", item)
+		}
+		if _, ok := seen[canonical]; ok {
+			continue
+		}
+		seen[canonical] = struct{}{}
+		out = append(out, canonical)
+	}
+	if len(out) == 0 {
+		return nil, nil
+	}
+	return out, nil
+}
+
+func normalizeAccessCountries(items []string) ([]string, error) {
+	out := make([]string, 0, len(items))
+	seen := make(map[string]struct{}, len(items))
+	for _, item := range items {
+		code := strings.ToUpper(strings.TrimSpace(item))
+		if code == "" {
+			continue
+		}
+		if len(code) != 2 || code[0] < 'A' || code[0] > 'Z' || code[1] < 'A' || code[1] > 'Z' {
+			return nil, fmt.Errorf("无效的国家代码: %s", strings.TrimSpace(item))
+		}
+		if _, ok := seen[code]; ok {
+			continue
+		}
+		seen[code] = struct{}{}
+		out = append(out, code)
+	}
+	if len(out) == 0 {
+		return nil, nil
+	}
+	return out, nil
+}
+
+// decodeAccessRules parses stored rules; invalid or empty values admit
+// everyone.
+func decodeAccessRules(raw string) *accessRules {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return nil
+	}
+	var rules accessRules
+	if err := json.Unmarshal([]byte(raw), &rules); err != nil {
+		return nil
+	}
+	normalized, err := normalizeAccessRules(rules)
+	if err != nil {
+		return nil
+	}
+	return normalized
+}
+
+// buildAccessAdmissions renders rules as agent admission configs named after
+// prefix: a whitelist for the allow entries and a blacklist for the deny
+// entries.
+func buildAccessAdmissions(prefix string, rules *accessRules) []map[string]interface{} {
+	if rules.empty() {
+		return nil
+	}
+	admissions := make([]map[string]interface{}, 0, 2)
+	build := func(name string, whitelist bool, cidrs, countries []string) {
+		if len(cidrs)+len(countries) == 0 {
+			return
+		}
+		adm := map[string]interface{}{
+			"name":      name,
+			"whitelist": whitelist,
+		}
+		if len(cidrs) > 0 {
+			adm["matchers"] = cidrs
+		}
+		if len(countries) > 0 {
+			geoIP := map[string]interface{}{"countries": countries}
+			if rules.GeoIPFile != "" {
+				geoIP["file"] = rules.GeoIPFile
+			}
+			adm["geoip"] = geoIP
+		}
+		admissions = append(admissions, adm)
+	}
+	build(prefix+"_allow", true, rules.Allow, rules.AllowCountries)
+	build(prefix+"_deny", false, rules.Deny, rules.DenyCountries)
+	return admissions
+}
+
+// forwardAdmissions returns the admission configs guarding a forward's
+// services: the tunnel's rules followed by the forward's own.
+func (h *Handler) forwardAdmissions(forward *forwardRecord) []map[string]interface{} {
+	admissions := buildAccessAdmissions(fmt.Sprintf("adm_tunnel_%d", forward.TunnelID), decodeAccessRules(h.repo.GetTunnelAccessRules(forward.TunnelID)))
+	return append(admissions, buildAccessAdmissions(fmt.Sprintf("adm_forward_%d", forward.ID), decodeAccessRules(forward.AccessRules))...)
+}
+
+// ensureAdmissionsOnNode pushes the admissions before the services that use
+// them. Unlike limiters a failure is fatal: the agent refuses every client of
+// a service naming an admission it does not know.
+func (h *Handler) ensureAdmissionsOnNode(node *nodeRecord, admissions []map[string]interface{}) error {
+	for _, adm := range admissions {
+		if _, err := h.sendNodeCommand(node.ID, "UpdateAdmissions", adm, false, false); err != nil {
+			return fmt.Errorf("节点 %s 下发访问规则失败: %w", node.Name, err)
+		}
+	}
+	return nil
+}
+
+func applyAdmissions(services []map[string]interface{}, admissions []map[string]interface{}) {
+	if len(admissions) == 0 {
+		return
+	}
+	names := make([]string, 0, len(admissions))
+	for _, adm := range admissions {
+		names = append(names, adm["name"].(string))
+	}
+	for _, service := range services {
+		service["admissions"] = names
+	}
+}
+
+// admissionRequirement also demands the agent's default GeoIP database when a
+// country rule relies on it; without one the agent could not tell countries
+// apart, so an allow list would refuse every client and a deny list would let
+// all of them in. A rule naming its own database file is checked by the agent
+// when the admission is pushed.
+func admissionRequirement(admissions []map[string]interface{}) nodeCapabilityRequirement {
+	req := nodeCapabilityRequirement{}
+	if len(admissions) == 0 {
+		return req
+	}
+	req.Features = []string{"admission"}
+	for _, adm := range admissions {
+		if geoIP, ok := adm["geoip"].(map[string]interface{}); ok && geoIP["file"] == nil {
+			req.Features = append(req.Features, "geoip")
+			break
+		}
+	}
+	return req
+}
@@ -0,0 +1,99 @@
+package handler
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"go-backend/internal/store/repo"
+)
+
+func TestParseAccessRulesInputNormalizesAndValidates(t *testing.T) {
+	value, present, err := parseAccessRulesInput(map[string]interface{}{
+		"accessRules": map[string]interface{}{
+			"allow":          []interface{}{" 10.1.2.3/8 ", "10.0.0.0/8", "2001:db8::1"},
+			"denyCountries":  []interface{}{"cn", "CN"},
+			"allowCountries": []interface{}{},
+		},
+	})
+	if err != nil || !present {
+		t.Fatalf("expected valid rules, got present=%v err=%v", present, err)
+	}
+	rules := decodeAccessRules(value)
+	if rules == nil || !reflect.DeepEqual(rules.Allow, []string{"10.0.0.0/8", "2001:db8::1"}) || !reflect.DeepEqual(rules.DenyCountries, []string{"CN"}) {
+		t.Fatalf("unexpected normalized rules: %+v", rules)
+	}
+
+	if value, present, err = parseAccessRulesInput(map[string]interface{}{"accessRules": map[string]interface{}{"allow": []interface{}{" "}}}); err != nil || !present || value != "" {
+		t.Fatalf("expected empty rules to clear, got %q present=%v err=%v", value, present, err)
+	}
+	if _, present, _ = parseAccessRulesInput(map[string]interface{}{}); present {
+		t.Fatalf("expected missing field to be reported as absent")
+	}
+
+	for _, rules := range []map[string]interface{}{
+		{"deny": []interface{}{"example.com"}},
+		{"allow": []interface{}{"10.0.0.0/33"}},
+		{"allowCountries": []interface{}{"CHN"}},
+		{"denyCountries": []interface{}{"1A"}},
+	} {
+		if _, _, err := parseAccessRulesInput(map[string]interface{}{"accessRules": rules}); err == nil {
+			t.Fatalf("expected %+v to be rejected", rules)
+		}
+	}
+}
+
+func TestForwardAdmissionsStackTunnelAndForwardRules(t *testing.T) {
+	r, err := repo.Open(filepath.Join(t.TempDir(), "access-rules.db"))
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	t.Cleanup(func() { _ = r.Close() })
+	h := New(r, "secret")
+
+	if err := r.DB().Exec(`INSERT INTO tunnel(id, name, type, protocol, flow, created_time, updated_time, status, access_rules) VALUES (3, 't', 1, 'tls', 1, 0, 0, 1, ?)`, `{"deny":["192.0.2.0/24"]}`).Error; err != nil {
+		t.Fatalf("insert tunnel: %v", err)
+	}
+	forward := &forwardRecord{ID: 7, TunnelID: 3, RemoteAddr: "10.0.0.1:80", AccessRules: `{"allow":["198.51.100.0/24"],"allowCountries":["DE"],"geoipFile":"/opt/geo.mmdb"}`}
+
+	admissions := h.forwardAdmissions(forward)
+	if len(admissions) != 2 {
+		t.Fatalf("expected tunnel deny and forward allow admissions, got %+v", admissions)
+	}
+	deny, allow := admissions[0], admissions[1]
+	if deny["name"] != "adm_tunnel_3_deny" || deny["whitelist"] != false || deny["geoip"] != nil {
+		t.Fatalf("unexpected tunnel admission: %+v", deny)
+	}
+	geoIP, _ := allow["geoip"].(map[string]interface{})
+	if allow["name"] != "adm_forward_7_allow" || allow["whitelist"] != true || geoIP["file"] != "/opt/geo.mmdb" || !reflect.DeepEqual(geoIP["countries"], []string{"DE"}) {
+		t.Fatalf("unexpected forward admission: %+v", allow)
+	}
+
+	node := &nodeRecord{TCPListenAddr: "[::]", UDPListenAddr: "[::]"}
+	services := buildForwardServiceConfigs("7_1_0", forward, nil, node, 10000, nil, false)
+	applyAdmissions(services, admissions)
+	for _, service := range services {
+		if !reflect.DeepEqual(service["admissions"], []string{"adm_tunnel_3_deny", "adm_forward_7_allow"}) {
+			t.Fatalf("unexpected admissions on %v: %v", service["name"], service["admissions"])
+		}
+	}
+
+	legacy := &nodeRecord{Name: "old-agent", Capabilities: `{"features":{"connLimiter":true}}`}
+	if err := validateNodeCapabilities(legacy, admissionRequirement(admissions)); err == nil {
+		t.Fatalf("expected agent without admission support to be rejected")
+	}
+
+	noGeoIP := &nodeRecord{Name: "no-geoip", Capabilities: `{"features":{"admission":true}}`}
+	if err := validateNodeCapabilities(noGeoIP, admissionRequirement(admissions)); err != nil {
+		t.Fatalf("expected a rule with its own database to skip the default GeoIP check, got %v", err)
+	}
+	countryRules := buildAccessAdmissions("adm_forward_8", &accessRules{DenyCountries: []string{"CN"}})
+	if err := validateNodeCapabilities(noGeoIP, admissionRequirement(countryRules)); err == nil || !strings.Contains(err.Error(), "geoip") {
+		t.Fatalf("expected an agent without a GeoIP database to be rejected, got %v", err)
+	}
+	cidrRules := buildAccessAdmissions("adm_forward_8", &accessRules{Deny: []string{"192.0.2.0/24"}})
+	if err := validateNodeCapabilities(noGeoIP, admissionRequirement(cidrRules)); err != nil {
+		t.Fatalf("expected CIDR rules to need no GeoIP database, got %v", err)
+	}
+}
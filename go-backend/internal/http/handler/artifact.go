@@ -0,0 +1,407 @@
+package handler
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"go-backend/internal/http/response"
+)
+
+const (
+	artifactRoutePrefix   = "/artifacts/"
+	artifactInstallScript = "install.sh"
+	artifactMaxUpload     = 200 << 20
+	// artifactTransferTimeout overrides the server's 30s read/write timeouts
+	// for binary uploads and downloads over slow links.
+	artifactTransferTimeout = 10 * time.Minute
+)
+
+var (
+	artifactVersionPattern = regexp.MustCompile(`^[0-9A-Za-z][0-9A-Za-z._-]{0,63}$`)
+	artifactArchPattern    = regexp.MustCompile(`^[a-z0-9_]{1,16}$`)
+	artifactFilePattern    = regexp.MustCompile(`^(gost-[a-z0-9_]{1,16}|install\.sh)(\.sha256|\.sig)?$`)
+)
+
+type artifactFile struct {
+	Name   string `json:"name"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+	Signed bool   `json:"signed"`
+}
+
+type artifactVersion struct {
+	Version    string         `json:"version"`
+	Channel    string         `json:"channel"`
+	UploadedAt int64          `json:"uploadedAt"`
+	Install    bool           `json:"install"`
+	Files      []artifactFile `json:"files"`
+}
+
+// SetArtifactDir sets the directory holding panel-hosted agent artifacts,
+// laid out as <dir>/<version>/{gost-<arch>,install.sh}. Empty disables it.
+func (h *Handler) SetArtifactDir(dir string) {
+	if h == nil {
+		return
+	}
+	h.artifactDir = strings.TrimSpace(dir)
+}
+
+func (h *Handler) artifactPath(version, name string) (string, error) {
+	if h == nil || h.artifactDir == "" {
+		return "", errors.New("未配置制品目录")
+	}
+	if !artifactVersionPattern.MatchString(version) || strings.Contains(version, "..") {
+		return "", errors.New("版本号格式错误")
+	}
+	if name != "" && !artifactFilePattern.MatchString(name) {
+		return "", errors.New("文件名格式错误")
+	}
+	return filepath.Join(h.artifactDir, version, name), nil
+}
+
+func (h *Handler) hasLocalArtifact(version, name string) bool {
+	path, err := h.artifactPath(version, name)
+	if err != nil {
+		return false
+	}
+	info, err := os.Stat(path)
+	return err == nil && !info.IsDir()
+}
+
+// hasLocalAgentBinaryFor reports whether the arch build of version is stored
+// locally.
+func (h *Handler) hasLocalAgentBinaryFor(version, arch string) bool {
+	arch = strings.TrimSpace(arch)
+	return arch != "" && h.hasLocalArtifact(version, "gost-"+arch)
+}
+
+// hasLocalAgentBinary reports whether at least one architecture of version is
+// stored locally.
+func (h *Handler) hasLocalAgentBinary(version string) bool {
+	dir, err := h.artifactPath(version, "")
+	if err != nil {
+		return false
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return false
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if strings.HasPrefix(name, "gost-") && !strings.Contains(name, ".") {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *Handler) listLocalArtifacts() ([]artifactVersion, error) {
+	if h == nil || h.artifactDir == "" {
+		return []artifactVersion{}, nil
+	}
+	entries, err := os.ReadDir(h.artifactDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []artifactVersion{}, nil
+		}
+		return nil, err
+	}
+	items := make([]artifactVersion, 0, len(entries))
+	for _, entry := range entries {
+		if !entry.IsDir() || !artifactVersionPattern.MatchString(entry.Name()) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		item := artifactVersion{
+			Version:    entry.Name(),
+			Channel:    releaseChannelFromTag(entry.Name()),
+			UploadedAt: info.ModTime().UnixMilli(),
+			Files:      make([]artifactFile, 0),
+		}
+		files, _ := os.ReadDir(filepath.Join(h.artifactDir, entry.Name()))
+		for _, f := range files {
+			name := f.Name()
+			if f.IsDir() || !artifactFilePattern.MatchString(name) || strings.HasSuffix(name, ".sha256") || strings.HasSuffix(name, ".sig") {
+				continue
+			}
+			fi, err := f.Info()
+			if err != nil {
+				continue
+			}
+			file := artifactFile{Name: name, Size: fi.Size()}
+			if sum, err := os.ReadFile(filepath.Join(h.artifactDir, entry.Name(), name+".sha256")); err == nil {
+				file.SHA256 = strings.TrimSpace(strings.Fields(string(sum) + " ")[0])
+			}
+			file.Signed = h.hasLocalArtifact(entry.Name(), name+".sig")
+			if name == artifactInstallScript {
+				item.Install = true
+			}
+			item.Files = append(item.Files, file)
+		}
+		items = append(items, item)
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].UploadedAt > items[j].UploadedAt })
+	return items, nil
+}
+
+// latestLocalArtifactVersion returns the most recently uploaded local version
+// of channel; requireInstall limits it to versions with an install script.
+func (h *Handler) latestLocalArtifactVersion(channel string, requireInstall bool) string {
+	items, err := h.listLocalArtifacts()
+	if err != nil {
+		return ""
+	}
+	for _, item := range items {
+		if item.Channel != normalizeReleaseChannel(channel) {
+			continue
+		}
+		if requireInstall && !item.Install {
+			continue
+		}
+		if !h.hasLocalAgentBinary(item.Version) {
+			continue
+		}
+		return item.Version
+	}
+	return ""
+}
+
+// resolveReleaseVersion asks GitHub for the latest release and falls back to
+// the newest locally uploaded artifact when GitHub is unreachable.
+func (h *Handler) resolveReleaseVersion(channel string, requireInstall bool) (string, error) {
+	version, err := resolveLatestReleaseByChannel(channel)
+	if err == nil {
+		return version, nil
+	}
+	if local := h.latestLocalArtifactVersion(channel, requireInstall); local != "" {
+		return local, nil
+	}
+	return "", err
+}
+
+// artifactBaseURL is the panel URL agents download version artifacts from,
+// or "" when the panel address is not configured.
+func (h *Handler) artifactBaseURL(version string) string {
+	panelAddr, err := h.repo.GetViteConfigValue("ip")
+	if err != nil || strings.TrimSpace(panelAddr) == "" {
+		return ""
+	}
+	return panelArtifactBaseURL(panelAddr, version)
+}
+
+// panelArtifactBaseURL keeps the scheme of a panel address configured as a
+// URL, so a panel behind TLS serves artifacts over https; a bare host:port
+// is plain http.
+func panelArtifactBaseURL(panelAddr, version string) string {
+	scheme := "http://"
+	addr := strings.TrimSpace(panelAddr)
+	lower := strings.ToLower(addr)
+	for _, prefix := range []string{"https://", "http://"} {
+		if strings.HasPrefix(lower, prefix) {
+			scheme, addr = prefix, addr[len(prefix):]
+			break
+		}
+	}
+	addr = strings.TrimRight(addr, "/")
+	return scheme + processServerAddress(addr) + artifactRoutePrefix + version
+}
+
+func (h *Handler) nodeArtifactUpload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		response.WriteJSON(w, response.ErrDefault("请求失败"))
+		return
+	}
+	extendArtifactDeadlines(w)
+	r.Body = http.MaxBytesReader(w, r.Body, artifactMaxUpload)
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		response.WriteJSON(w, response.ErrDefault("请求参数错误"))
+		return
+	}
+	defer func() {
+		if r.MultipartForm != nil {
+			_ = r.MultipartForm.RemoveAll()
+		}
+	}()
+
+	version := strings.TrimSpace(r.FormValue("version"))
+	kind := strings.TrimSpace(r.FormValue("kind"))
+	name := artifactInstallScript
+	if kind != "install" {
+		arch := strings.TrimSpace(r.FormValue("arch"))
+		if !artifactArchPattern.MatchString(arch) {
+			response.WriteJSON(w, response.ErrDefault("架构格式错误"))
+			return
+		}
+		name = "gost-" + arch
+	}
+	path, err := h.artifactPath(version, name)
+	if err != nil {
+		response.WriteJSON(w, response.ErrDefault(err.Error()))
+		return
+	}
+
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		response.WriteJSON(w, response.ErrDefault("请选择要上传的文件"))
+		return
+	}
+	defer file.Close()
+
+	// Agents refuse binaries whose signature does not verify, so an unsigned
+	// binary could never be installed by an upgrade.
+	sigFile, _, sigErr := r.FormFile("signature")
+	if sigErr == nil {
+		defer sigFile.Close()
+	} else if name != artifactInstallScript {
+		response.WriteJSON(w, response.ErrDefault("请同时上传二进制的签名文件(.sig)"))
+		return
+	}
+
+	sum, size, err := writeArtifactFile(path, file)
+	if err != nil {
+		response.WriteJSON(w, response.Err(-2, err.Error()))
+		return
+	}
+	if err := os.WriteFile(path+".sha256", []byte(fmt.Sprintf("%s  %s\n", sum, name)), 0o644); err != nil {
+		response.WriteJSON(w, response.Err(-2, err.Error()))
+		return
+	}
+
+	signed := false
+	if sigErr == nil {
+		if _, _, err := writeArtifactFile(path+".sig", io.LimitReader(sigFile, 4096)); err != nil {
+			response.WriteJSON(w, response.Err(-2, err.Error()))
+			return
+		}
+		signed = true
+	} else {
+		_ = os.Remove(path + ".sig")
+	}
+
+	response.WriteJSON(w, response.OK(artifactFile{Name: name, Size: size, SHA256: sum, Signed: signed}))
+}
+
+func writeArtifactFile(path string, src io.Reader) (string, int64, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return "", 0, fmt.Errorf("创建制品目录失败: %v", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return "", 0, fmt.Errorf("创建临时文件失败: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	hasher := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, hasher), src)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", 0, fmt.Errorf("写入制品失败: %v", err)
+	}
+	if size == 0 {
+		return "", 0, errors.New("上传的文件为空")
+	}
+	if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+		return "", 0, err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return "", 0, fmt.Errorf("保存制品失败: %v", err)
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), size, nil
+}
+
+func (h *Handler) nodeArtifactList(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		response.WriteJSON(w, response.ErrDefault("请求失败"))
+		return
+	}
+	items, err := h.listLocalArtifacts()
+	if err != nil {
+		response.WriteJSON(w, response.Err(-2, err.Error()))
+		return
+	}
+	response.WriteJSON(w, response.OK(items))
+}
+
+func (h *Handler) nodeArtifactDelete(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		response.WriteJSON(w, response.ErrDefault("请求失败"))
+		return
+	}
+	var req struct {
+		Version string `json:"version"`
+		Name    string `json:"name"`
+	}
+	if err := decodeJSON(r.Body, &req); err != nil {
+		response.WriteJSON(w, response.ErrDefault("请求参数错误"))
+		return
+	}
+	name := strings.TrimSpace(req.Name)
+	path, err := h.artifactPath(strings.TrimSpace(req.Version), name)
+	if err != nil {
+		response.WriteJSON(w, response.ErrDefault(err.Error()))
+		return
+	}
+	if name == "" {
+		err = os.RemoveAll(path)
+	} else {
+		for _, suffix := range []string{"", ".sha256", ".sig"} {
+			if rmErr := os.Remove(path + suffix); rmErr != nil && !os.IsNotExist(rmErr) {
+				err = rmErr
+			}
+		}
+	}
+	if err != nil {
+		response.WriteJSON(w, response.Err(-2, err.Error()))
+		return
+	}
+	response.WriteJSON(w, response.OK(nil))
+}
+
+// serveArtifact serves /artifacts/<version>/<file> without authentication so
+// agents and install scripts can download from the panel directly.
+func (h *Handler) serveArtifact(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, artifactRoutePrefix), "/")
+	if len(parts) != 2 || parts[1] == "" {
+		http.NotFound(w, r)
+		return
+	}
+	path, err := h.artifactPath(parts[0], parts[1])
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	info, err := os.Stat(path)
+	if err != nil || info.IsDir() {
+		http.NotFound(w, r)
+		return
+	}
+	extendArtifactDeadlines(w)
+	w.Header().Set("Content-Type", "application/octet-stream")
+	http.ServeFile(w, r, path)
+}
+
+func extendArtifactDeadlines(w http.ResponseWriter) {
+	rc := http.NewResponseController(w)
+	deadline := time.Now().Add(artifactTransferTimeout)
+	_ = rc.SetReadDeadline(deadline)
+	_ = rc.SetWriteDeadline(deadline)
+}
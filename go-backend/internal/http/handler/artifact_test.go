@@ -0,0 +1,121 @@
+package handler
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"go-backend/internal/http/response"
+	"go-backend/internal/store/repo"
+)
+
+func TestNodeArtifactUploadServeAndUpgradePayload(t *testing.T) {
+	r, err := repo.Open(filepath.Join(t.TempDir(), "artifact.db"))
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	t.Cleanup(func() { _ = r.Close() })
+	h := New(r, "secret")
+	h.SetArtifactDir(filepath.Join(t.TempDir(), "artifacts"))
+	if err := r.UpsertConfig("ip", "panel.example.com:6366", time.Now().UnixMilli()); err != nil {
+		t.Fatalf("set panel ip: %v", err)
+	}
+
+	binary := []byte("agent-binary-content")
+	upload := func(signature []byte) response.R {
+		var body bytes.Buffer
+		mw := multipart.NewWriter(&body)
+		_ = mw.WriteField("version", "2.2.0")
+		_ = mw.WriteField("kind", "binary")
+		_ = mw.WriteField("arch", "amd64")
+		fw, _ := mw.CreateFormFile("file", "gost-amd64")
+		_, _ = fw.Write(binary)
+		if signature != nil {
+			fw, _ = mw.CreateFormFile("signature", "gost-amd64.sig")
+			_, _ = fw.Write(signature)
+		}
+		_ = mw.Close()
+
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/node/artifact/upload", &body)
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+		res := httptest.NewRecorder()
+		h.nodeArtifactUpload(res, req)
+
+		var payload response.R
+		if err := json.NewDecoder(res.Body).Decode(&payload); err != nil {
+			t.Fatalf("decode response: %v", err)
+		}
+		return payload
+	}
+
+	if payload := upload(nil); payload.Code == 0 || h.hasLocalArtifact("2.2.0", "gost-amd64") {
+		t.Fatalf("expected an unsigned binary to be rejected, got %d %s", payload.Code, payload.Msg)
+	}
+	if payload := upload([]byte("signature")); payload.Code != 0 {
+		t.Fatalf("expected upload to succeed, got %d %s", payload.Code, payload.Msg)
+	}
+
+	sum := sha256.Sum256(binary)
+	res := httptest.NewRecorder()
+	h.serveArtifact(res, httptest.NewRequest(http.MethodGet, "/artifacts/2.2.0/gost-amd64.sha256", nil))
+	if res.Code != http.StatusOK || !strings.HasPrefix(res.Body.String(), hex.EncodeToString(sum[:])) {
+		t.Fatalf("unexpected checksum response: %d %q", res.Code, res.Body.String())
+	}
+
+	res = httptest.NewRecorder()
+	h.serveArtifact(res, httptest.NewRequest(http.MethodGet, "/artifacts/2.2.0/gost-amd64", nil))
+	if res.Code != http.StatusOK || !bytes.Equal(res.Body.Bytes(), binary) {
+		t.Fatalf("unexpected binary response: %d", res.Code)
+	}
+
+	res = httptest.NewRecorder()
+	h.serveArtifact(res, httptest.NewRequest(http.MethodGet, "/artifacts/../gost.db", nil))
+	if res.Code != http.StatusNotFound {
+		t.Fatalf("expected traversal to be rejected, got %d", res.Code)
+	}
+
+	insertOfflineNode(t, r, 1, "amd64-node")
+	insertOfflineNode(t, r, 2, "arm64-node")
+	insertOfflineNode(t, r, 3, "legacy-node")
+	setArch := func(id int64, arch string) {
+		if err := r.UpdateNodeCapabilities(id, `{"arch":"`+arch+`"}`); err != nil {
+			t.Fatalf("set capabilities: %v", err)
+		}
+	}
+	setArch(1, "amd64")
+	setArch(2, "arm64")
+	if err := r.DB().Exec("UPDATE node SET capabilities = NULL WHERE id = 3").Error; err != nil {
+		t.Fatalf("clear capabilities: %v", err)
+	}
+
+	upgrade := h.agentUpgradePayload("2.2.0", 1)
+	if got := upgrade["downloadUrl"]; got != "http://panel.example.com:6366/artifacts/2.2.0/gost-{ARCH}" {
+		t.Fatalf("expected panel download url, got %v", got)
+	}
+	if got := h.agentUpgradePayload("2.2.0", 2)["downloadUrl"].(string); strings.Contains(got, "panel.example.com") {
+		t.Fatalf("expected GitHub download url for an architecture without a local build, got %s", got)
+	}
+	if got := h.agentUpgradePayload("2.2.0", 3)["downloadUrl"].(string); strings.Contains(got, "panel.example.com") {
+		t.Fatalf("expected GitHub download url for a node without a manifest, got %s", got)
+	}
+	if got := h.agentUpgradePayload("2.1.0", 1)["downloadUrl"].(string); strings.Contains(got, "panel.example.com") {
+		t.Fatalf("expected GitHub download url for missing local artifact, got %s", got)
+	}
+	if err := r.UpsertConfig("ip", "https://panel.example.com/", time.Now().UnixMilli()); err != nil {
+		t.Fatalf("set panel ip: %v", err)
+	}
+	if got := h.agentUpgradePayload("2.2.0", 1)["downloadUrl"]; got != "https://panel.example.com/artifacts/2.2.0/gost-{ARCH}" {
+		t.Fatalf("expected https panel download url, got %v", got)
+	}
+	if got := h.latestLocalArtifactVersion(releaseChannelStable, false); got != "2.2.0" {
+		t.Fatalf("expected local fallback version 2.2.0, got %q", got)
+	}
+}
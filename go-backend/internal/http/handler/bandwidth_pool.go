@@ -0,0 +1,132 @@
+package handler
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	bandwidthPoolMaxRate  = 100000 // Mbps
+	bandwidthPoolMaxBurst = 10240  // MB
+)
+
+// bandwidthPool is a user's bandwidth plan. It is enforced per node by one
+// shared token bucket spanning every TCP and UDP service of the user, on top
+// of the tunnel speed limits.
+type bandwidthPool struct {
+	Up    int // Mbps, client to target
+	Down  int // Mbps, target to client
+	Burst int // MB; 0 bursts up to one second of traffic
+}
+
+func (p bandwidthPool) enabled() bool {
+	return p.Up > 0 || p.Down > 0
+}
+
+func userBandwidthLimiterName(userID int64) string {
+	return fmt.Sprintf("pool_user_%d", userID)
+}
+
+// parseBandwidthPoolInput parses bandwidthUp, bandwidthDown and
+// bandwidthBurst. Fields that were not sent keep the current values.
+func parseBandwidthPoolInput(req map[string]interface{}, current bandwidthPool) (pool bandwidthPool, present bool, err error) {
+	pool = current
+	up, upSet, err := parseConnLimitInput(req, "bandwidthUp", bandwidthPoolMaxRate, "上行带宽")
+	if err != nil {
+		return current, true, err
+	}
+	down, downSet, err := parseConnLimitInput(req, "bandwidthDown", bandwidthPoolMaxRate, "下行带宽")
+	if err != nil {
+		return current, true, err
+	}
+	burst, burstSet, err := parseConnLimitInput(req, "bandwidthBurst", bandwidthPoolMaxBurst, "突发流量")
+	if err != nil {
+		return current, true, err
+	}
+	if upSet {
+		pool.Up = up
+	}
+	if downSet {
+		pool.Down = down
+	}
+	if burstSet {
+		pool.Burst = burst
+	}
+	return pool, upSet || downSet || burstSet, nil
+}
+
+func (h *Handler) userBandwidthPool(userID int64) bandwidthPool {
+	up, down, burst := h.repo.GetUserBandwidth(userID)
+	return bandwidthPool{Up: up, Down: down, Burst: burst}
+}
+
+// bandwidthPoolLimiterConfig renders the pool as a traffic limiter declaring
+// the "@user_<id>" shared bucket. Rates are in bytes so Mbps convert
+// exactly.
+func bandwidthPoolLimiterConfig(userID int64, pool bandwidthPool) map[string]interface{} {
+	line := fmt.Sprintf("@user_%d %dB %dB", userID, pool.Up*125000, pool.Down*125000)
+	if pool.Burst > 0 {
+		line += fmt.Sprintf(" %dMB", pool.Burst)
+	}
+	return map[string]interface{}{
+		"name":   userBandwidthLimiterName(userID),
+		"limits": []string{line},
+	}
+}
+
+// ensureBandwidthPoolOnNode upserts the user's pool limiter. Failures are
+// ignored like the speed limiter's: a missing limiter leaves traffic
+// unlimited rather than blocked.
+func (h *Handler) ensureBandwidthPoolOnNode(nodeID, userID int64, pool bandwidthPool) {
+	if !pool.enabled() {
+		return
+	}
+	payload := map[string]interface{}{
+		"limiter": userBandwidthLimiterName(userID),
+		"data":    bandwidthPoolLimiterConfig(userID, pool),
+	}
+	_, _ = h.sendNodeCommand(nodeID, "UpdateLimiters", payload, false, false)
+}
+
+// applyBandwidthPool stacks the pool limiter after the tunnel speed limiter.
+func applyBandwidthPool(services []map[string]interface{}, userID int64, pool bandwidthPool) {
+	if !pool.enabled() {
+		return
+	}
+	for _, service := range services {
+		appendServiceLimiter(service, userBandwidthLimiterName(userID))
+	}
+}
+
+// appendServiceLimiter stacks a traffic limiter on the service; the agent
+// applies every limiter of a comma separated list.
+func appendServiceLimiter(service map[string]interface{}, name string) {
+	if existing, _ := service["limiter"].(string); strings.TrimSpace(existing) != "" {
+		service["limiter"] = existing + "," + name
+	} else {
+		service["limiter"] = name
+	}
+}
+
+// bandwidthPoolRequirement demands agent support only when a pool is set:
+// older agents cannot resolve stacked limiter names and would drop the speed
+// limit as well.
+func bandwidthPoolRequirement(pool bandwidthPool) nodeCapabilityRequirement {
+	req := nodeCapabilityRequirement{}
+	if pool.enabled() {
+		req.Features = []string{"sharedBucket"}
+	}
+	return req
+}
+
+// syncUserBandwidthPool redeploys the user's active forwards so every entry
+// node picks up the new pool and the services reference it.
+func (h *Handler) syncUserBandwidthPool(userID int64) {
+	forwards, err := h.repo.ListActiveForwardsByUser(userID)
+	if err != nil {
+		return
+	}
+	for i := range forwards {
+		_ = h.syncForwardServices(&forwards[i], "UpdateService", true)
+	}
+}
@@ -0,0 +1,58 @@
+package handler
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseBandwidthPoolInput(t *testing.T) {
+	pool, present, err := parseBandwidthPoolInput(map[string]interface{}{"bandwidthDown": float64(200), "bandwidthBurst": "64"}, bandwidthPool{Up: 50})
+	if err != nil || !present || pool != (bandwidthPool{Up: 50, Down: 200, Burst: 64}) {
+		t.Fatalf("expected partial update to keep upload rate, got %+v present=%v err=%v", pool, present, err)
+	}
+	if _, present, _ = parseBandwidthPoolInput(map[string]interface{}{}, bandwidthPool{}); present {
+		t.Fatalf("expected missing fields to be reported as absent")
+	}
+	for _, req := range []map[string]interface{}{
+		{"bandwidthUp": float64(-1)},
+		{"bandwidthDown": float64(bandwidthPoolMaxRate + 1)},
+		{"bandwidthBurst": "lots"},
+	} {
+		if _, _, err := parseBandwidthPoolInput(req, bandwidthPool{}); err == nil {
+			t.Fatalf("expected %+v to be rejected", req)
+		}
+	}
+}
+
+func TestBandwidthPoolStacksOnSpeedLimiter(t *testing.T) {
+	pool := bandwidthPool{Up: 8, Down: 80, Burst: 4}
+	cfg := bandwidthPoolLimiterConfig(2, pool)
+	if cfg["name"] != "pool_user_2" || !reflect.DeepEqual(cfg["limits"], []string{"@user_2 1000000B 10000000B 4MB"}) {
+		t.Fatalf("unexpected pool limiter config: %+v", cfg)
+	}
+
+	forward := &forwardRecord{ID: 7, UserID: 2, TunnelID: 3, RemoteAddr: "10.0.0.1:80"}
+	node := &nodeRecord{TCPListenAddr: "[::]", UDPListenAddr: "[::]"}
+	limiterID := int64(5)
+	services := buildForwardServiceConfigs("7_2_1", forward, nil, node, 10000, &limiterID, false)
+	applyBandwidthPool(services, forward.UserID, pool)
+	for _, service := range services {
+		if service["limiter"] != "5,pool_user_2" {
+			t.Fatalf("expected tcp and udp to share the pool, got %v on %v", service["limiter"], service["name"])
+		}
+	}
+
+	services = buildForwardServiceConfigs("7_2_1", forward, nil, node, 10000, nil, false)
+	applyBandwidthPool(services, forward.UserID, bandwidthPool{Burst: 4})
+	if _, ok := services[0]["limiter"]; ok {
+		t.Fatalf("expected no limiter without pool rates")
+	}
+
+	legacy := &nodeRecord{Name: "old-agent", Capabilities: `{"features":{"proxyProtocol":true}}`}
+	if err := validateNodeCapabilities(legacy, bandwidthPoolRequirement(pool)); err == nil {
+		t.Fatalf("expected agent without shared bucket support to be rejected")
+	}
+	if err := validateNodeCapabilities(legacy, bandwidthPoolRequirement(bandwidthPool{})); err != nil {
+		t.Fatalf("expected user without pool to be accepted, got %v", err)
+	}
+}
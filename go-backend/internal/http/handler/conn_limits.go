@@ -0,0 +1,286 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-backend/internal/http/response"
+)
+
+const (
+	connLimitMaxConns = 1000000
+	connLimitMaxRate  = 100000
+)
+
+// connLimiterSpec is one conn ("CLimiters") or rate ("RLimiters") limiter
+// pushed to an entry node. Limits use the "$" key, so they are shared by
+// every client of the services referencing the limiter.
+type connLimiterSpec struct {
+	Kind  string
+	Name  string
+	Limit int
+}
+
+// nodeLimiterReport mirrors the agent's LimiterHitStats.
+type nodeLimiterReport struct {
+	Name     string `json:"name"`
+	Kind     string `json:"kind"`
+	Rejected uint64 `json:"rejected"`
+}
+
+func forwardConnLimiterName(forwardID int64) string {
+	return fmt.Sprintf("conn_forward_%d", forwardID)
+}
+
+func forwardRateLimiterName(forwardID int64) string {
+	return fmt.Sprintf("rate_forward_%d", forwardID)
+}
+
+func userTunnelConnLimiterName(userTunnelID int64) string {
+	return fmt.Sprintf("conn_usertunnel_%d", userTunnelID)
+}
+
+func userTunnelRateLimiterName(userTunnelID int64) string {
+	return fmt.Sprintf("rate_usertunnel_%d", userTunnelID)
+}
+
+// parseConnLimitInput reads a non-negative integer limit; 0 disables it.
+// present is false when the field was not sent at all.
+func parseConnLimitInput(req map[string]interface{}, key string, max int, label string) (value int, present bool, err error) {
+	raw, ok := req[key]
+	if !ok {
+		return 0, false, nil
+	}
+	invalid := fmt.Errorf("%s需为 0-%d 之间的整数", label, max)
+	var v float64
+	switch t := raw.(type) {
+	case nil:
+		return 0, true, nil
+	case float64:
+		v = t
+	case int:
+		v = float64(t)
+	case int64:
+		v = float64(t)
+	case string:
+		s := strings.TrimSpace(t)
+		if s == "" {
+			return 0, true, nil
+		}
+		n, convErr := strconv.Atoi(s)
+		if convErr != nil {
+			return 0, true, invalid
+		}
+		v = float64(n)
+	default:
+		return 0, true, invalid
+	}
+	if v != math.Trunc(v) || v < 0 || v > float64(max) {
+		return 0, true, invalid
+	}
+	return int(v), true, nil
+}
+
+// parseConnLimitsInput parses maxConns and connRate. Fields that were not
+// sent keep the current values.
+func parseConnLimitsInput(req map[string]interface{}, currentMaxConns, currentConnRate int) (maxConns, connRate int, present bool, err error) {
+	maxConns, maxSet, err := parseConnLimitInput(req, "maxConns", connLimitMaxConns, "最大连接数")
+	if err != nil {
+		return 0, 0, true, err
+	}
+	connRate, rateSet, err := parseConnLimitInput(req, "connRate", connLimitMaxRate, "新建连接速率")
+	if err != nil {
+		return 0, 0, true, err
+	}
+	if !maxSet {
+		maxConns = currentMaxConns
+	}
+	if !rateSet {
+		connRate = currentConnRate
+	}
+	return maxConns, connRate, maxSet || rateSet, nil
+}
+
+// forwardConnLimiters lists the limiters guarding a forward's services: its
+// own caps plus the caps of the user's tunnel permission.
+func (h *Handler) forwardConnLimiters(forward *forwardRecord, userTunnelID int64) []connLimiterSpec {
+	specs := make([]connLimiterSpec, 0, 4)
+	if forward.MaxConns > 0 {
+		specs = append(specs, connLimiterSpec{Kind: "CLimiters", Name: forwardConnLimiterName(forward.ID), Limit: forward.MaxConns})
+	}
+	if forward.ConnRate > 0 {
+		specs = append(specs, connLimiterSpec{Kind: "RLimiters", Name: forwardRateLimiterName(forward.ID), Limit: forward.ConnRate})
+	}
+	return append(specs, h.userTunnelConnLimiters(userTunnelID)...)
+}
+
+// userTunnelConnLimiters lists the caps of a user's tunnel permission alone.
+func (h *Handler) userTunnelConnLimiters(userTunnelID int64) []connLimiterSpec {
+	var specs []connLimiterSpec
+	if userTunnelID <= 0 {
+		return specs
+	}
+	maxConns, connRate := h.repo.GetUserTunnelConnLimits(userTunnelID)
+	if maxConns > 0 {
+		specs = append(specs, connLimiterSpec{Kind: "CLimiters", Name: userTunnelConnLimiterName(userTunnelID), Limit: maxConns})
+	}
+	if connRate > 0 {
+		specs = append(specs, connLimiterSpec{Kind: "RLimiters", Name: userTunnelRateLimiterName(userTunnelID), Limit: connRate})
+	}
+	return specs
+}
+
+// ensureConnLimitersOnNode pushes the limiters before the services that use
+// them. Like ensureLimiterOnNode, failures are ignored: a service naming a
+// missing limiter simply runs unlimited. Limiters whose limit was cleared are
+// left to cleanOrphanedConnLimiters, since other services may still name them
+// until they are resynced.
+func (h *Handler) ensureConnLimitersOnNode(nodeID int64, specs []connLimiterSpec) {
+	for _, spec := range specs {
+		payload := map[string]interface{}{
+			"name":   spec.Name,
+			"limits": []string{fmt.Sprintf("$ %d", spec.Limit)},
+		}
+		_, _ = h.sendNodeCommand(nodeID, "Update"+spec.Kind, payload, false, false)
+	}
+}
+
+// applyConnLimiters references the limiters from every service. The agent
+// accepts a comma separated list and admits a connection only if all allow it.
+func applyConnLimiters(services []map[string]interface{}, specs []connLimiterSpec) {
+	var conns, rates []string
+	for _, spec := range specs {
+		if spec.Kind == "RLimiters" {
+			rates = append(rates, spec.Name)
+		} else {
+			conns = append(conns, spec.Name)
+		}
+	}
+	for _, service := range services {
+		if len(conns) > 0 {
+			service["climiter"] = strings.Join(conns, ",")
+		}
+		if len(rates) > 0 {
+			service["rlimiter"] = strings.Join(rates, ",")
+		}
+	}
+}
+
+// connLimiterRequirement demands agent support only when limits are in use,
+// so nodes on older agents keep serving unlimited forwards.
+func connLimiterRequirement(specs []connLimiterSpec) nodeCapabilityRequirement {
+	req := nodeCapabilityRequirement{}
+	if len(specs) > 0 {
+		req.Features = []string{"connLimiter"}
+	}
+	return req
+}
+
+// nodeLimiterHits returns the rejection counters from the node's latest
+// telemetry for the given limiter names. ok is false when no fresh report
+// exists.
+func (h *Handler) nodeLimiterHits(nodeID int64, names map[string]struct{}, now time.Time) ([]nodeLimiterReport, bool) {
+	h.metricsMu.Lock()
+	defer h.metricsMu.Unlock()
+	acc := h.nodeMetrics[nodeID]
+	if acc == nil || acc.lastReport == nil || now.UnixMilli()-acc.lastAt > healthReportTTL.Milliseconds() {
+		return nil, false
+	}
+	items := make([]nodeLimiterReport, 0)
+	for _, item := range acc.lastReport.Limiters {
+		if _, ok := names[item.Name]; ok {
+			items = append(items, item)
+		}
+	}
+	return items, true
+}
+
+func (h *Handler) forwardLimits(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		response.WriteJSON(w, response.ErrDefault("请求失败"))
+		return
+	}
+	id := asInt64FromBodyKey(r, w, "forwardId")
+	if id <= 0 {
+		return
+	}
+	forward, _, _, err := h.resolveForwardAccess(r, id)
+	if err != nil {
+		if errors.Is(err, errForwardNotFound) {
+			response.WriteJSON(w, response.ErrDefault("转发不存在"))
+			return
+		}
+		response.WriteJSON(w, response.Err(-2, err.Error()))
+		return
+	}
+	ports, err := h.listForwardPorts(forward.ID)
+	if err != nil {
+		response.WriteJSON(w, response.Err(-2, err.Error()))
+		return
+	}
+	userTunnelID, _, _, err := h.resolveUserTunnelAndLimiter(forward.UserID, forward.TunnelID)
+	if err != nil {
+		response.WriteJSON(w, response.Err(-2, err.Error()))
+		return
+	}
+
+	specs := h.forwardConnLimiters(forward, userTunnelID)
+	names := make(map[string]struct{}, len(specs))
+	limiters := make([]map[string]interface{}, 0, len(specs))
+	for _, spec := range specs {
+		names[spec.Name] = struct{}{}
+		scope := "forward"
+		if strings.Contains(spec.Name, "_usertunnel_") {
+			scope = "userTunnel"
+		}
+		limiters = append(limiters, map[string]interface{}{
+			"name":  spec.Name,
+			"kind":  strings.ToLower(strings.TrimSuffix(spec.Kind, "Limiters")),
+			"scope": scope,
+			"limit": spec.Limit,
+		})
+	}
+
+	now := time.Now()
+	hits := make([]map[string]interface{}, 0)
+	offline := make([]int64, 0)
+	seen := make(map[int64]struct{}, len(ports))
+	for _, fp := range ports {
+		if _, ok := seen[fp.NodeID]; ok {
+			continue
+		}
+		seen[fp.NodeID] = struct{}{}
+		node, err := h.getNodeRecord(fp.NodeID)
+		if err != nil {
+			continue
+		}
+		items, ok := h.nodeLimiterHits(fp.NodeID, names, now)
+		if !ok {
+			offline = append(offline, fp.NodeID)
+			continue
+		}
+		for _, item := range items {
+			hits = append(hits, map[string]interface{}{
+				"nodeId":   fp.NodeID,
+				"nodeName": node.Name,
+				"name":     item.Name,
+				"kind":     item.Kind,
+				"rejected": item.Rejected,
+			})
+		}
+	}
+
+	response.WriteJSON(w, response.OK(map[string]interface{}{
+		"forwardId":    forward.ID,
+		"maxConns":     forward.MaxConns,
+		"connRate":     forward.ConnRate,
+		"limiters":     limiters,
+		"hits":         hits,
+		"offlineNodes": offline,
+	}))
+}
@@ -0,0 +1,105 @@
+package handler
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go-backend/internal/store/model"
+	"go-backend/internal/store/repo"
+)
+
+func TestParseConnLimitsInput(t *testing.T) {
+	maxConns, connRate, present, err := parseConnLimitsInput(map[string]interface{}{"maxConns": float64(200)}, 10, 5)
+	if err != nil || !present || maxConns != 200 || connRate != 5 {
+		t.Fatalf("expected maxConns update to keep connRate, got %d/%d present=%v err=%v", maxConns, connRate, present, err)
+	}
+	maxConns, connRate, present, err = parseConnLimitsInput(map[string]interface{}{"connRate": "30", "maxConns": nil}, 10, 5)
+	if err != nil || !present || maxConns != 0 || connRate != 30 {
+		t.Fatalf("expected null to clear and string to parse, got %d/%d present=%v err=%v", maxConns, connRate, present, err)
+	}
+	if _, _, present, _ = parseConnLimitsInput(map[string]interface{}{}, 10, 5); present {
+		t.Fatalf("expected missing fields to be reported as absent")
+	}
+
+	for _, req := range []map[string]interface{}{
+		{"maxConns": float64(-1)},
+		{"maxConns": 1.5},
+		{"connRate": float64(connLimitMaxRate + 1)},
+		{"connRate": "fast"},
+		{"maxConns": true},
+	} {
+		if _, _, _, err := parseConnLimitsInput(req, 0, 0); err == nil {
+			t.Fatalf("expected %+v to be rejected", req)
+		}
+	}
+}
+
+func TestForwardConnLimitersStackForwardAndUserTunnelCaps(t *testing.T) {
+	r, err := repo.Open(filepath.Join(t.TempDir(), "conn-limits.db"))
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	t.Cleanup(func() { _ = r.Close() })
+	h := New(r, "secret")
+
+	ut := model.UserTunnel{UserID: 2, TunnelID: 3, Num: 10, FlowResetTime: 1, ExpTime: time.Now().Add(time.Hour).UnixMilli(), Status: 1, MaxConns: 500}
+	if err := r.DB().Create(&ut).Error; err != nil {
+		t.Fatalf("insert user_tunnel: %v", err)
+	}
+
+	forward := &forwardRecord{ID: 7, UserID: 2, TunnelID: 3, RemoteAddr: "10.0.0.1:80", MaxConns: 50, ConnRate: 20}
+	specs := h.forwardConnLimiters(forward, ut.ID)
+	if len(specs) != 3 {
+		t.Fatalf("expected forward conn/rate and user tunnel conn limiters, got %+v", specs)
+	}
+
+	node := &nodeRecord{TCPListenAddr: "[::]", UDPListenAddr: "[::]"}
+	services := buildForwardServiceConfigs("7_2_1", forward, nil, node, 10000, nil, false)
+	applyConnLimiters(services, specs)
+	wantConns := forwardConnLimiterName(7) + "," + userTunnelConnLimiterName(ut.ID)
+	for _, service := range services {
+		if service["climiter"] != wantConns || service["rlimiter"] != forwardRateLimiterName(7) {
+			t.Fatalf("unexpected limiter refs on %v: climiter=%v rlimiter=%v", service["name"], service["climiter"], service["rlimiter"])
+		}
+	}
+
+	forward.MaxConns, forward.ConnRate = 0, 0
+	if err := r.UpdateUserTunnelConnLimits(ut.ID, 0, 0); err != nil {
+		t.Fatalf("clear user tunnel limits: %v", err)
+	}
+	services = buildForwardServiceConfigs("7_2_1", forward, nil, node, 10000, nil, false)
+	applyConnLimiters(services, h.forwardConnLimiters(forward, ut.ID))
+	if _, ok := services[0]["climiter"]; ok {
+		t.Fatalf("expected no limiter refs once limits are cleared")
+	}
+
+	manifest := &nodeRecord{Name: "old-agent", Capabilities: `{"listeners":["tcp"],"features":{"tun":true}}`}
+	if err := validateNodeCapabilities(manifest, connLimiterRequirement(specs)); err == nil {
+		t.Fatalf("expected agent without connLimiter feature to be rejected")
+	}
+	if err := validateNodeCapabilities(manifest, connLimiterRequirement(nil)); err != nil {
+		t.Fatalf("expected unlimited forward to be accepted, got %v", err)
+	}
+}
+
+func TestNodeLimiterHitsReadsTelemetry(t *testing.T) {
+	r, err := repo.Open(filepath.Join(t.TempDir(), "limiter-hits.db"))
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	t.Cleanup(func() { _ = r.Close() })
+	h := New(r, "secret")
+
+	now := time.Now()
+	h.recordNodeInfo(4, []byte(`{"limiters":[{"name":"conn_forward_7","kind":"conn","rejected":12},{"name":"conn_forward_8","kind":"conn","rejected":3}]}`), now)
+
+	names := map[string]struct{}{forwardConnLimiterName(7): {}, forwardRateLimiterName(7): {}}
+	items, ok := h.nodeLimiterHits(4, names, now)
+	if !ok || len(items) != 1 || items[0].Name != "conn_forward_7" || items[0].Rejected != 12 {
+		t.Fatalf("unexpected limiter hits %+v ok=%v", items, ok)
+	}
+	if _, ok := h.nodeLimiterHits(4, names, now.Add(2*healthReportTTL)); ok {
+		t.Fatalf("expected stale telemetry to be reported as offline")
+	}
+}
@@ -28,6 +28,8 @@ type diagnosisTarget struct {
 	Address string
 	IP      string
 	Port    int
+	// DNS is the resolver policy for a hostname target, if any.
+	DNS *dnsPolicy
 }
 
 func (h *Handler) resolveForwardAccess(r *http.Request, forwardID int64) (*forwardRecord, int64, int, error) {
@@ -124,6 +126,10 @@ func (h *Handler) resolveUserTunnelAndLimiter(userID, tunnelID int64) (int64, *i
 	if info == nil {
 		return 0, nil, nil, nil
 	}
+	if info.LimiterID != nil && info.Speed != nil {
+		speed := h.limiterSpeedAt(*info.LimiterID, *info.Speed, time.Now())
+		info.Speed = &speed
+	}
 	return info.UserTunnelID, info.LimiterID, info.Speed, nil
 }
 
@@ -139,6 +145,13 @@ func (h *Handler) syncForwardServices(forward *forwardRecord, method string, all
 	if h == nil || forward == nil {
 		return errors.New("invalid forward sync context")
 	}
+	if forward.MuxHost != "" {
+		if err := h.syncMuxForward(forward, forward.Status == 1); err != nil {
+			return err
+		}
+		h.applyForwardSchedule(forward, time.Now())
+		return nil
+	}
 
 	tunnel, err := h.getTunnelRecord(forward.TunnelID)
 	if err != nil {
@@ -161,17 +174,51 @@ func (h *Handler) syncForwardServices(forward *forwardRecord, method string, all
 	if err != nil {
 		return err
 	}
+	connLimiters := h.forwardConnLimiters(forward, userTunnelID)
+	admissions := h.forwardAdmissions(forward)
+	pool := h.userBandwidthPool(forward.UserID)
+	speedCaps := h.forwardSpeedCaps(forward, userTunnelID)
+	dns := h.forwardDNSPolicy(forward)
+	resolver, hosts := buildDNSConfigs(forward.ID, dns)
+	requirement := mergeNodeCapabilityRequirements(
+		connLimiterRequirement(connLimiters),
+		admissionRequirement(admissions),
+		proxyProtocolRequirement(forward),
+		bandwidthPoolRequirement(pool),
+		speedCapRequirement(speedCaps),
+		accessLogRequirement(forward),
+		dnsPolicyRequirement(dns),
+	)
 
 	for _, fp := range ports {
-		if limiterID != nil && speed != nil {
-			h.ensureLimiterOnNode(fp.NodeID, *limiterID, *speed)
-		}
-
 		node, err := h.getNodeRecord(fp.NodeID)
 		if err != nil {
 			return err
 		}
+		if err := validateNodeCapabilities(node, requirement); err != nil {
+			return err
+		}
+		if err := h.ensureAdmissionsOnNode(node, admissions); err != nil {
+			return err
+		}
+		if err := h.ensureDNSConfigsOnNode(node, resolver, hosts); err != nil {
+			return err
+		}
+
+		if limiterID != nil && speed != nil {
+			h.ensureLimiterOnNode(fp.NodeID, *limiterID, *speed)
+		}
+		h.ensureConnLimitersOnNode(fp.NodeID, connLimiters)
+		h.ensureBandwidthPoolOnNode(fp.NodeID, forward.UserID, pool)
+		h.ensureSpeedCapsOnNode(fp.NodeID, speedCaps)
+
 		services := buildForwardServiceConfigs(serviceBase, forward, tunnel, node, fp.Port, limiterID, tunnelTLSProtocol)
+		applyConnLimiters(services, connLimiters)
+		applyAdmissions(services, admissions)
+		applyBandwidthPool(services, forward.UserID, pool)
+		applySpeedCaps(services, speedCaps)
+		applyAccessLog(services, forward)
+		applyDNSConfigs(services, resolver, hosts)
 		_, err = h.sendNodeCommand(node.ID, method, services, true, false)
 		if err != nil && allowFallbackAdd && method == "UpdateService" {
 			_, err = h.sendNodeCommand(node.ID, "AddService", services, true, false)
@@ -180,6 +227,7 @@ func (h *Handler) syncForwardServices(forward *forwardRecord, method string, all
 			return fmt.Errorf("节点 %s 下发失败: %w", node.Name, err)
 		}
 	}
+	h.applyForwardSchedule(forward, time.Now())
 	return nil
 }
 
@@ -187,6 +235,9 @@ func (h *Handler) controlForwardServices(forward *forwardRecord, commandType str
 	if h == nil || forward == nil {
 		return errors.New("invalid forward control context")
 	}
+	if forward.MuxHost != "" {
+		return h.syncMuxForward(forward, strings.EqualFold(strings.TrimSpace(commandType), "ResumeService"))
+	}
 	ports, err := h.listForwardPorts(forward.ID)
 	if err != nil {
 		return err
@@ -225,6 +276,9 @@ func (h *Handler) controlForwardServices(forward *forwardRecord, commandType str
 			if shouldTryLegacySingleService(commandType) || strings.EqualFold(strings.TrimSpace(commandType), "DeleteService") {
 				variants = append(variants, base)
 			}
+			for offset := 1; offset < forwardPortCount(forward); offset++ {
+				variants = append(variants, forwardRangeServiceName(base, "tcp", fp.Port+offset), forwardRangeServiceName(base, "udp", fp.Port+offset))
+			}
 
 			candidateHandled := false
 			for _, name := range variants {
@@ -338,11 +392,11 @@ func (h *Handler) sendRemoteNodeCommand(node *nodeRecord, commandType string, da
 	return result, nil
 }
 
-func (h *Handler) diagnoseForwardRuntime(forward *forwardRecord) (map[string]interface{}, error) {
+func (h *Handler) diagnoseForwardRuntime(forward *forwardRecord, udp *udpProbeOptions) (map[string]interface{}, error) {
 	if forward == nil {
 		return nil, errForwardNotFound
 	}
-	targets, err := resolveDiagnosisTargets(forward.RemoteAddr)
+	targets, err := resolveDiagnosisTargets(forwardDiagnosisAddr(forward), h.forwardDNSPolicy(forward))
 	if err != nil {
 		return nil, err
 	}
@@ -371,7 +425,7 @@ func (h *Handler) diagnoseForwardRuntime(forward *forwardRecord) (map[string]int
 		for _, inNode := range inNodes {
 			for _, target := range targets {
 				description := fmt.Sprintf("入口(%s)->目标(%s)", inNode.NodeName, target.Address)
-				h.appendPathDiagnosis(&results, nodeCache, inNode.NodeID, target.IP, target.Port, description, map[string]interface{}{
+				h.appendTargetDiagnosis(&results, nodeCache, inNode.NodeID, target, description, map[string]interface{}{
 					"fromChainType": 1,
 				})
 			}
@@ -426,7 +480,7 @@ func (h *Handler) diagnoseForwardRuntime(forward *forwardRecord) (map[string]int
 		for _, outNode := range outNodes {
 			for _, target := range targets {
 				description := fmt.Sprintf("出口(%s)->目标(%s)", outNode.NodeName, target.Address)
-				h.appendPathDiagnosis(&results, nodeCache, outNode.NodeID, target.IP, target.Port, description, map[string]interface{}{
+				h.appendTargetDiagnosis(&results, nodeCache, outNode.NodeID, target, description, map[string]interface{}{
 					"fromChainType": 3,
 				})
 			}
@@ -435,7 +489,28 @@ func (h *Handler) diagnoseForwardRuntime(forward *forwardRecord) (map[string]int
 		for _, inNode := range inNodes {
 			for _, target := range targets {
 				description := fmt.Sprintf("入口(%s)->目标(%s)", inNode.NodeName, target.Address)
-				h.appendPathDiagnosis(&results, nodeCache, inNode.NodeID, target.IP, target.Port, description, map[string]interface{}{
+				h.appendTargetDiagnosis(&results, nodeCache, inNode.NodeID, target, description, map[string]interface{}{
+					"fromChainType": 1,
+				})
+			}
+		}
+	}
+
+	// The end-to-end UDP probe leaves the entry node the way forwarded
+	// datagrams do: through the tunnel's chain, or directly for port
+	// forwarding.
+	if udp != nil {
+		chain := ""
+		if tunnel.Type == 2 {
+			chain = fmt.Sprintf("chains_%d", forward.TunnelID)
+		}
+		for _, inNode := range inNodes {
+			for _, target := range targets {
+				description := fmt.Sprintf("入口(%s)->目标(%s) UDP", inNode.NodeName, target.Address)
+				if chain != "" {
+					description = fmt.Sprintf("入口(%s)->隧道->目标(%s) UDP", inNode.NodeName, target.Address)
+				}
+				h.appendUDPDiagnosis(&results, nodeCache, inNode.NodeID, target, chain, udp, description, map[string]interface{}{
 					"fromChainType": 1,
 				})
 			}
@@ -450,7 +525,7 @@ func (h *Handler) diagnoseForwardRuntime(forward *forwardRecord) (map[string]int
 	return payload, nil
 }
 
-func (h *Handler) diagnoseTunnelRuntime(tunnelID int64) (map[string]interface{}, error) {
+func (h *Handler) diagnoseTunnelRuntime(tunnelID int64, udp *udpProbeOptions) (map[string]interface{}, error) {
 	tunnel, err := h.getTunnelRecord(tunnelID)
 	if err != nil {
 		return nil, err
@@ -547,12 +622,34 @@ func (h *Handler) diagnoseTunnelRuntime(tunnelID int64) (map[string]interface{},
 		}
 	}
 
+	if udp != nil {
+		for _, inNode := range inNodes {
+			if tunnel.Type == 2 {
+				description := fmt.Sprintf("入口(%s)->隧道->外网 UDP", inNode.NodeName)
+				h.appendUDPDiagnosis(&results, nodeCache, inNode.NodeID, udpProbeTunnelTarget, fmt.Sprintf("chains_%d", tunnelID), udp, description, map[string]interface{}{
+					"fromChainType": 1,
+				})
+				continue
+			}
+			description := fmt.Sprintf("入口(%s)->外网 UDP", inNode.NodeName)
+			h.appendUDPDiagnosis(&results, nodeCache, inNode.NodeID, udpProbeTunnelTarget, "", udp, description, map[string]interface{}{
+				"fromChainType": 1,
+			})
+		}
+	}
+
 	payload := map[string]interface{}{
 		"tunnelName": tunnelName,
 		"tunnelType": map[bool]string{true: "端口转发", false: "隧道转发"}[tunnel.Type == 1],
 		"timestamp":  time.Now().UnixMilli(),
 		"results":    results,
 	}
+	if tunnel.Type == 2 {
+		hops, estimated := summarizeTunnelHopLatency(results)
+		payload["chainMode"] = defaultString(h.repo.GetTunnelChainMode(tunnelID), "relay")
+		payload["hops"] = hops
+		payload["estimatedLatency"] = estimated
+	}
 	return payload, nil
 }
 
@@ -585,7 +682,10 @@ func splitChainNodeGroups(rows []chainNodeRecord) ([]chainNodeRecord, [][]chainN
 	return inNodes, chainHops, outNodes
 }
 
-func resolveDiagnosisTargets(remoteAddr string) ([]diagnosisTarget, error) {
+// resolveDiagnosisTargets parses the targets of a forward. Hostnames with a
+// static entry in policy are diagnosed at that address; the others carry the
+// policy so the probing node resolves them like the forward's services.
+func resolveDiagnosisTargets(remoteAddr string, policy *dnsPolicy) ([]diagnosisTarget, error) {
 	rawTargets := splitRemoteTargets(remoteAddr)
 	if len(rawTargets) == 0 {
 		return nil, errors.New("目标地址不能为空")
@@ -597,7 +697,15 @@ func resolveDiagnosisTargets(remoteAddr string) ([]diagnosisTarget, error) {
 		if err != nil {
 			continue
 		}
-		targets = append(targets, diagnosisTarget{Address: raw, IP: ip, Port: port})
+		target := diagnosisTarget{Address: raw, IP: ip, Port: port}
+		if net.ParseIP(ip) == nil {
+			if static := policy.lookupHost(ip); static != "" {
+				target.IP = static
+			} else {
+				target.DNS = policy
+			}
+		}
+		targets = append(targets, target)
 	}
 	if len(targets) == 0 {
 		return nil, errors.New("目标地址格式错误")
@@ -647,6 +755,14 @@ func (h *Handler) appendFailedDiagnosis(results *[]map[string]interface{}, nodeC
 }
 
 func (h *Handler) appendPathDiagnosis(results *[]map[string]interface{}, nodeCache map[int64]*nodeRecord, fromNodeID int64, targetIP string, targetPort int, description string, metadata map[string]interface{}) {
+	h.appendProbeDiagnosis(results, nodeCache, fromNodeID, targetIP, targetPort, nil, description, metadata)
+}
+
+func (h *Handler) appendTargetDiagnosis(results *[]map[string]interface{}, nodeCache map[int64]*nodeRecord, fromNodeID int64, target diagnosisTarget, description string, metadata map[string]interface{}) {
+	h.appendProbeDiagnosis(results, nodeCache, fromNodeID, target.IP, target.Port, target.DNS, description, metadata)
+}
+
+func (h *Handler) appendProbeDiagnosis(results *[]map[string]interface{}, nodeCache map[int64]*nodeRecord, fromNodeID int64, targetIP string, targetPort int, dns *dnsPolicy, description string, metadata map[string]interface{}) {
 	item := newDiagnosisResultItem(fromNodeID, targetIP, targetPort, description, metadata)
 
 	fromNode, err := h.cachedNode(nodeCache, fromNodeID)
@@ -665,7 +781,7 @@ func (h *Handler) appendPathDiagnosis(results *[]map[string]interface{}, nodeCac
 	if fromNode.IsRemote == 1 {
 		pingData, pingErr = h.tcpPingViaRemoteNode(fromNode, targetIP, targetPort)
 	} else {
-		pingData, pingErr = h.tcpPingViaNode(fromNodeID, targetIP, targetPort)
+		pingData, pingErr = h.tcpPingViaNode(fromNodeID, targetIP, targetPort, dns)
 	}
 	if pingErr != nil {
 		item["success"] = false
@@ -761,13 +877,15 @@ func (h *Handler) listChainNodesForTunnel(tunnelID int64) ([]chainNodeRecord, er
 	return h.repo.ListChainNodesForTunnel(tunnelID)
 }
 
-func (h *Handler) tcpPingViaNode(nodeID int64, ip string, port int) (map[string]interface{}, error) {
-	res, err := h.sendNodeCommand(nodeID, "TcpPing", map[string]interface{}{
+func (h *Handler) tcpPingViaNode(nodeID int64, ip string, port int, dns *dnsPolicy) (map[string]interface{}, error) {
+	payload := map[string]interface{}{
 		"ip":      ip,
 		"port":    port,
 		"count":   4,
 		"timeout": 5000,
-	}, false, false)
+	}
+	dnsPingOptions(payload, dns)
+	res, err := h.sendNodeCommand(nodeID, "TcpPing", payload, false, false)
 	if err != nil {
 		return nil, err
 	}
@@ -886,65 +1004,94 @@ func isNotFoundError(err error) bool {
 
 func buildForwardServiceConfigs(baseName string, forward *forwardRecord, tunnel *tunnelRecord, node *nodeRecord, port int, limiterID *int64, tunnelTLSProtocol bool) []map[string]interface{} {
 	protocols := []string{"tcp", "udp"}
-	services := make([]map[string]interface{}, 0, 2)
+	count := forwardPortCount(forward)
+	services := make([]map[string]interface{}, 0, 2*count)
 	targets := splitRemoteTargets(forward.RemoteAddr)
 	strategy := strings.TrimSpace(forward.Strategy)
 	if strategy == "" {
 		strategy = "fifo"
 	}
+	healthCheck := decodeHealthCheck(forward.HealthCheck)
+	targetOptions := decodeForwardTargetOptions(forward.TargetOptions)
 
-	for _, protocol := range protocols {
-		listenerAddr := node.TCPListenAddr
-		if protocol == "udp" {
-			listenerAddr = node.UDPListenAddr
-		}
-		service := map[string]interface{}{
-			"name": fmt.Sprintf("%s_%s", baseName, protocol),
-			"addr": fmt.Sprintf("%s:%d", listenerAddr, port),
-			"handler": map[string]interface{}{
-				"type": protocol,
-			},
-			"listener": map[string]interface{}{
-				"type": protocol,
-			},
-			"forwarder": map[string]interface{}{
-				"nodes": buildForwarderNodes(targets),
-				"selector": map[string]interface{}{
-					"strategy":    strategy,
-					"maxFails":    1,
-					"failTimeout": "600s",
+	for offset := 0; offset < count; offset++ {
+		for _, protocol := range protocols {
+			listenerAddr := node.TCPListenAddr
+			if protocol == "udp" {
+				listenerAddr = node.UDPListenAddr
+			}
+			name := fmt.Sprintf("%s_%s", baseName, protocol)
+			if offset > 0 {
+				name = forwardRangeServiceName(baseName, protocol, port+offset)
+			}
+			nodes := buildForwarderNodes(targets, healthCheck, targetOptions)
+			for _, n := range nodes {
+				n["addr"] = shiftTargetPort(n["addr"].(string), offset)
+			}
+			service := map[string]interface{}{
+				"name": name,
+				"addr": fmt.Sprintf("%s:%d", listenerAddr, port+offset),
+				"handler": map[string]interface{}{
+					"type": protocol,
+				},
+				"listener": map[string]interface{}{
+					"type": protocol,
+				},
+				"forwarder": map[string]interface{}{
+					"nodes": nodes,
+					"selector": map[string]interface{}{
+						"strategy":    strategy,
+						"maxFails":    1,
+						"failTimeout": fmt.Sprintf("%ds", int64(healthCheckFailTimeout(healthCheck, 600*time.Second).Seconds())),
+					},
 				},
-			},
-		}
-		if protocol == "udp" {
-			listenerMetadata := map[string]interface{}{"keepAlive": true}
-			if tunnelTLSProtocol {
-				listenerMetadata["ttl"] = "10s"
 			}
-			service["listener"].(map[string]interface{})["metadata"] = listenerMetadata
-		}
-		if tunnel != nil && tunnel.Type == 2 {
-			service["handler"].(map[string]interface{})["chain"] = fmt.Sprintf("chains_%d", forward.TunnelID)
-		}
-		if tunnel != nil && tunnel.Type == 1 && strings.TrimSpace(node.InterfaceName) != "" {
-			service["metadata"] = map[string]interface{}{"interface": node.InterfaceName}
-		}
-		if limiterID != nil && *limiterID > 0 {
-			service["limiter"] = strconv.FormatInt(*limiterID, 10)
+			if protocol == "udp" {
+				listenerMetadata := map[string]interface{}{"keepAlive": true}
+				if tunnelTLSProtocol {
+					listenerMetadata["ttl"] = "10s"
+				}
+				service["listener"].(map[string]interface{})["metadata"] = listenerMetadata
+			}
+			if tunnel != nil && tunnel.Type == 2 {
+				service["handler"].(map[string]interface{})["chain"] = fmt.Sprintf("chains_%d", forward.TunnelID)
+			}
+			if tunnel != nil && tunnel.Type == 1 && strings.TrimSpace(node.InterfaceName) != "" {
+				service["metadata"] = map[string]interface{}{"interface": node.InterfaceName}
+			}
+			if limiterID != nil && *limiterID > 0 {
+				service["limiter"] = strconv.FormatInt(*limiterID, 10)
+			}
+			if protocol == "tcp" {
+				applyProxyProtocol(service, forward)
+			}
+			services = append(services, service)
 		}
-		services = append(services, service)
 	}
 
 	return services
 }
 
-func buildForwarderNodes(targets []string) []map[string]interface{} {
+func buildForwarderNodes(targets []string, healthCheck *healthCheckConfig, targetOptions map[string]forwardTargetOption) []map[string]interface{} {
 	nodes := make([]map[string]interface{}, 0, len(targets))
 	for i, addr := range targets {
-		nodes = append(nodes, map[string]interface{}{
+		node := map[string]interface{}{
 			"name": fmt.Sprintf("node_%d", i+1),
 			"addr": addr,
-		})
+		}
+		md := healthCheckMetadata(healthCheck)
+		if option, ok := targetOptions[addr]; ok {
+			if md == nil {
+				md = map[string]interface{}{}
+			}
+			for k, v := range forwardTargetMetadata(option) {
+				md[k] = v
+			}
+		}
+		if len(md) > 0 {
+			node["metadata"] = md
+		}
+		nodes = append(nodes, node)
 	}
 	return nodes
 }
@@ -1008,6 +1155,13 @@ func (h *Handler) sendLimiterConfig(limiterID int64, speedMbps int, tunnelID int
 		return err
 	}
 
+	// A new speed restarts balancing from an even split across entry nodes.
+	h.quota.forget(limiterID)
+	nodes = uniqueNodeIDs(nodes)
+	if len(nodes) > 1 {
+		payload = quotaLimiterConfig(limiterID, float64(speedMbps)/float64(len(nodes)))
+	}
+
 	for _, nodeID := range nodes {
 		_, _ = h.sendNodeCommand(nodeID, "AddLimiters", payload, false, false)
 	}
@@ -1015,6 +1169,7 @@ func (h *Handler) sendLimiterConfig(limiterID int64, speedMbps int, tunnelID int
 }
 
 func (h *Handler) sendDeleteLimiterConfig(limiterID int64, tunnelID int64) error {
+	h.quota.forget(limiterID)
 	payload := map[string]interface{}{
 		"limiter": strconv.FormatInt(limiterID, 10),
 	}
@@ -1037,5 +1192,8 @@ func (h *Handler) ensureLimiterOnNode(nodeID int64, limiterID int64, speed int)
 		"name":   strconv.FormatInt(limiterID, 10),
 		"limits": []string{limitStr},
 	}
+	if share, ok := h.limiterNodeShare(limiterID, nodeID, speed); ok {
+		payload = quotaLimiterConfig(limiterID, share)
+	}
 	_, _ = h.sendNodeCommand(nodeID, "AddLimiters", payload, false, false)
 }
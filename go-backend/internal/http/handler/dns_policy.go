@@ -0,0 +1,345 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+const (
+	dnsPolicyMaxServers = 8
+	dnsPolicyMaxHosts   = 1000
+	dnsPolicyMaxTTL     = 86400
+	dnsServerTimeout    = "5s"
+)
+
+// dnsPolicy controls how entry nodes resolve hostname targets. Without one
+// the agent falls back to the system resolver. A forward's policy is merged
+// over its tunnel's: its own servers, preference and TTL win when set, and
+// its hosts entries are checked before the tunnel's.
+type dnsPolicy struct {
+	// Servers are nameserver URLs: udp://, tcp://, tls:// (DoT) or https://
+	// (DoH). A bare address means plain DNS over UDP.
+	Servers []string `json:"servers,omitempty"`
+	// Prefer is "ipv4" or "ipv6"; empty keeps the resolver's default.
+	Prefer string `json:"prefer,omitempty"`
+	// TTL overrides the cache time of answers in seconds; 0 keeps the TTL of
+	// each record.
+	TTL   int            `json:"ttl,omitempty"`
+	Hosts []dnsHostEntry `json:"hosts,omitempty"`
+}
+
+type dnsHostEntry struct {
+	Host string `json:"host"`
+	IP   string `json:"ip"`
+}
+
+func (p *dnsPolicy) empty() bool {
+	return p == nil || len(p.Servers)+len(p.Hosts) == 0 && p.Prefer == "" && p.TTL == 0
+}
+
+// parseDNSPolicyInput validates the dnsPolicy request field and returns its
+// normalized JSON, or "" when nothing is set. present is false when the field
+// was not sent at all.
+func parseDNSPolicyInput(req map[string]interface{}) (value string, present bool, err error) {
+	raw, ok := req["dnsPolicy"]
+	if !ok {
+		return "", false, nil
+	}
+	if raw == nil {
+		return "", true, nil
+	}
+
+	var policy dnsPolicy
+	switch v := raw.(type) {
+	case string:
+		if strings.TrimSpace(v) == "" {
+			return "", true, nil
+		}
+		if err := json.Unmarshal([]byte(v), &policy); err != nil {
+			return "", true, errors.New("解析策略格式错误")
+		}
+	case map[string]interface{}:
+		b, _ := json.Marshal(v)
+		if err := json.Unmarshal(b, &policy); err != nil {
+			return "", true, errors.New("解析策略格式错误")
+		}
+	default:
+		return "", true, errors.New("解析策略格式错误")
+	}
+
+	normalized, err := normalizeDNSPolicy(policy)
+	if err != nil || normalized == nil {
+		return "", true, err
+	}
+	b, _ := json.Marshal(normalized)
+	return string(b), true, nil
+}
+
+func normalizeDNSPolicy(policy dnsPolicy) (*dnsPolicy, error) {
+	servers := make([]string, 0, len(policy.Servers))
+	seen := make(map[string]struct{}, len(policy.Servers))
+	for _, raw := range policy.Servers {
+		if strings.TrimSpace(raw) == "" {
+			continue
+		}
+		server, err := normalizeDNSServer(raw)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := seen[server]; ok {
+			continue
+		}
+		seen[server] = struct{}{}
+		servers = append(servers, server)
+	}
+	if len(servers) > dnsPolicyMaxServers {
+		return nil, fmt.Errorf("DNS 服务器不能超过 %d 个", dnsPolicyMaxServers)
+	}
+	policy.Servers = nil
+	if len(servers) > 0 {
+		policy.Servers = servers
+	}
+
+	policy.Prefer = strings.ToLower(strings.TrimSpace(policy.Prefer))
+	if policy.Prefer != "" && policy.Prefer != "ipv4" && policy.Prefer != "ipv6" {
+		return nil, errors.New("解析优先级只能是 ipv4 或 ipv6")
+	}
+	if policy.TTL < 0 || policy.TTL > dnsPolicyMaxTTL {
+		return nil, fmt.Errorf("解析缓存时间必须在 0-%d 秒之间", dnsPolicyMaxTTL)
+	}
+
+	hosts := make([]dnsHostEntry, 0, len(policy.Hosts))
+	seenHosts := make(map[dnsHostEntry]struct{}, len(policy.Hosts))
+	for _, entry := range policy.Hosts {
+		host := strings.TrimSuffix(strings.ToLower(strings.TrimSpace(entry.Host)), ".")
+		if host == "" && strings.TrimSpace(entry.IP) == "" {
+			continue
+		}
+		if !isValidMuxHostname(host) {
+			return nil, fmt.Errorf("无效的主机名: %s", strings.TrimSpace(entry.Host))
+		}
+		ip := net.ParseIP(strings.TrimSpace(entry.IP))
+		if ip == nil {
+			return nil, fmt.Errorf("主机 %s 的 IP 地址无效", host)
+		}
+		normalized := dnsHostEntry{Host: host, IP: ip.String()}
+		if _, ok := seenHosts[normalized]; ok {
+			continue
+		}
+		seenHosts[normalized] = struct{}{}
+		hosts = append(hosts, normalized)
+	}
+	if len(hosts) > dnsPolicyMaxHosts {
+		return nil, fmt.Errorf("静态解析条目不能超过 %d 条", dnsPolicyMaxHosts)
+	}
+	policy.Hosts = nil
+	if len(hosts) > 0 {
+		policy.Hosts = hosts
+	}
+
+	if policy.empty() {
+		return nil, nil
+	}
+	return &policy, nil
+}
+
+// normalizeDNSServer returns the nameserver URL the agent expects, filling in
+// the default port of the scheme and the standard DoH path.
+func normalizeDNSServer(raw string) (string, error) {
+	raw = strings.TrimSpace(raw)
+	invalid := fmt.Errorf("无效的 DNS 服务器: %s", raw)
+	if !strings.Contains(raw, "://") {
+		if ip := net.ParseIP(raw); ip != nil {
+			raw = net.JoinHostPort(ip.String(), "53")
+		}
+		raw = "udp://" + raw
+	}
+	u, err := url.Parse(raw)
+	if err != nil || u.Hostname() == "" || u.User != nil {
+		return "", invalid
+	}
+	scheme := strings.ToLower(u.Scheme)
+	defaultPort := "53"
+	switch scheme {
+	case "udp", "tcp":
+	case "tls":
+		defaultPort = "853"
+	case "https":
+		path := u.Path
+		if path == "" || path == "/" {
+			path = "/dns-query"
+		}
+		return "https://" + u.Host + path, nil
+	default:
+		return "", invalid
+	}
+	port := u.Port()
+	if port == "" {
+		port = defaultPort
+	}
+	if n, err := strconv.Atoi(port); err != nil || n <= 0 || n > 65535 {
+		return "", invalid
+	}
+	return scheme + "://" + net.JoinHostPort(u.Hostname(), port), nil
+}
+
+// decodeDNSPolicy parses a stored policy; invalid or empty values leave
+// resolution to the agent's system resolver.
+func decodeDNSPolicy(raw string) *dnsPolicy {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return nil
+	}
+	var policy dnsPolicy
+	if err := json.Unmarshal([]byte(raw), &policy); err != nil {
+		return nil
+	}
+	normalized, err := normalizeDNSPolicy(policy)
+	if err != nil {
+		return nil
+	}
+	return normalized
+}
+
+func mergeDNSPolicy(tunnel, forward *dnsPolicy) *dnsPolicy {
+	if forward.empty() {
+		return tunnel
+	}
+	if tunnel.empty() {
+		return forward
+	}
+	merged := *tunnel
+	if len(forward.Servers) > 0 {
+		merged.Servers = forward.Servers
+	}
+	if forward.Prefer != "" {
+		merged.Prefer = forward.Prefer
+	}
+	if forward.TTL > 0 {
+		merged.TTL = forward.TTL
+	}
+	merged.Hosts = append(append([]dnsHostEntry{}, forward.Hosts...), tunnel.Hosts...)
+	return &merged
+}
+
+// forwardDNSPolicy returns the policy in effect for a forward's targets.
+func (h *Handler) forwardDNSPolicy(forward *forwardRecord) *dnsPolicy {
+	return mergeDNSPolicy(decodeDNSPolicy(h.repo.GetTunnelDNSPolicy(forward.TunnelID)), decodeDNSPolicy(forward.DNSPolicy))
+}
+
+// buildDNSConfigs renders a policy as the agent resolver and hosts configs a
+// forward's services refer to by name. Either is nil when the policy does not
+// need it.
+func buildDNSConfigs(forwardID int64, policy *dnsPolicy) (resolver, hosts map[string]interface{}) {
+	if policy.empty() {
+		return nil, nil
+	}
+	if len(policy.Servers) > 0 {
+		nameservers := make([]map[string]interface{}, 0, len(policy.Servers))
+		for _, server := range policy.Servers {
+			ns := map[string]interface{}{
+				"addr":    server,
+				"timeout": dnsServerTimeout,
+			}
+			if policy.Prefer != "" {
+				ns["prefer"] = policy.Prefer
+			}
+			if policy.TTL > 0 {
+				ns["ttl"] = fmt.Sprintf("%ds", policy.TTL)
+			}
+			nameservers = append(nameservers, ns)
+		}
+		resolver = map[string]interface{}{
+			"name":        fmt.Sprintf("dns_forward_%d", forwardID),
+			"nameservers": nameservers,
+		}
+	}
+	if len(policy.Hosts) > 0 {
+		hosts = map[string]interface{}{
+			"name":     fmt.Sprintf("hosts_forward_%d", forwardID),
+			"mappings": dnsHostMappings(policy.Hosts),
+		}
+	}
+	return resolver, hosts
+}
+
+func dnsHostMappings(entries []dnsHostEntry) []map[string]interface{} {
+	mappings := make([]map[string]interface{}, 0, len(entries))
+	for _, entry := range entries {
+		mappings = append(mappings, map[string]interface{}{"hostname": entry.Host, "ip": entry.IP})
+	}
+	return mappings
+}
+
+// ensureDNSConfigsOnNode pushes the resolver and hosts before the services
+// that name them. A failure is fatal so a forward never runs on a resolver
+// other than the one configured.
+func (h *Handler) ensureDNSConfigsOnNode(node *nodeRecord, resolver, hosts map[string]interface{}) error {
+	if resolver != nil {
+		if _, err := h.sendNodeCommand(node.ID, "UpdateResolvers", resolver, false, false); err != nil {
+			return fmt.Errorf("节点 %s 下发解析器失败: %w", node.Name, err)
+		}
+	}
+	if hosts != nil {
+		if _, err := h.sendNodeCommand(node.ID, "UpdateHosts", hosts, false, false); err != nil {
+			return fmt.Errorf("节点 %s 下发静态解析失败: %w", node.Name, err)
+		}
+	}
+	return nil
+}
+
+func applyDNSConfigs(services []map[string]interface{}, resolver, hosts map[string]interface{}) {
+	for _, service := range services {
+		if resolver != nil {
+			service["resolver"] = resolver["name"]
+		}
+		if hosts != nil {
+			service["hosts"] = hosts["name"]
+		}
+	}
+}
+
+func dnsPolicyRequirement(policy *dnsPolicy) nodeCapabilityRequirement {
+	req := nodeCapabilityRequirement{}
+	if policy != nil && len(policy.Servers)+len(policy.Hosts) > 0 {
+		req.Features = []string{"dnsPolicy"}
+	}
+	return req
+}
+
+// lookupHost returns the static address of host, as the agent's hosts
+// mapper would.
+func (p *dnsPolicy) lookupHost(host string) string {
+	if p == nil {
+		return ""
+	}
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	for _, entry := range p.Hosts {
+		if entry.Host == host {
+			return entry.IP
+		}
+	}
+	return ""
+}
+
+// dnsPingOptions adds the policy to a TcpPing payload so the node resolves a
+// diagnosed hostname the way the forward's services do.
+func dnsPingOptions(payload map[string]interface{}, policy *dnsPolicy) {
+	if policy.empty() {
+		return
+	}
+	if len(policy.Servers) > 0 {
+		payload["nameservers"] = policy.Servers
+		if policy.Prefer != "" {
+			payload["prefer"] = policy.Prefer
+		}
+	}
+	if len(policy.Hosts) > 0 {
+		payload["hosts"] = dnsHostMappings(policy.Hosts)
+	}
+}
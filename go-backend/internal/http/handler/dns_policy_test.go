@@ -0,0 +1,134 @@
+package handler
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestNormalizeDNSServer(t *testing.T) {
+	cases := map[string]string{
+		"1.1.1.1":                        "udp://1.1.1.1:53",
+		"8.8.8.8:5353":                   "udp://8.8.8.8:5353",
+		"tcp://9.9.9.9":                  "tcp://9.9.9.9:53",
+		"TLS://dns.google":               "tls://dns.google:853",
+		"https://1.1.1.1":                "https://1.1.1.1/dns-query",
+		"https://dns.google/resolve":     "https://dns.google/resolve",
+		"2606:4700:4700::1111":           "udp://[2606:4700:4700::1111]:53",
+		"udp://[2606:4700:4700::1111]":   "udp://[2606:4700:4700::1111]:53",
+		"tls://[2001:4860:4860::8888]:8": "tls://[2001:4860:4860::8888]:8",
+	}
+	for raw, want := range cases {
+		got, err := normalizeDNSServer(raw)
+		if err != nil || got != want {
+			t.Fatalf("normalize %q: got %q err=%v, want %q", raw, got, err, want)
+		}
+	}
+	for _, raw := range []string{"quic://1.1.1.1", "udp://1.1.1.1:0", "udp://user@1.1.1.1", "://"} {
+		if _, err := normalizeDNSServer(raw); err == nil {
+			t.Fatalf("expected %q to be rejected", raw)
+		}
+	}
+}
+
+func TestParseDNSPolicyInput(t *testing.T) {
+	value, present, err := parseDNSPolicyInput(map[string]interface{}{
+		"dnsPolicy": map[string]interface{}{
+			"servers": []interface{}{"1.1.1.1", "udp://1.1.1.1:53", "https://dns.google"},
+			"prefer":  "IPv6",
+			"ttl":     60,
+			"hosts":   []interface{}{map[string]interface{}{"host": "DB.internal.", "ip": "10.0.0.8"}},
+		},
+	})
+	if err != nil || !present {
+		t.Fatalf("unexpected parse result: present=%v err=%v", present, err)
+	}
+	var policy dnsPolicy
+	if err := json.Unmarshal([]byte(value), &policy); err != nil {
+		t.Fatalf("stored policy is not JSON: %v", err)
+	}
+	want := dnsPolicy{
+		Servers: []string{"udp://1.1.1.1:53", "https://dns.google/dns-query"},
+		Prefer:  "ipv6",
+		TTL:     60,
+		Hosts:   []dnsHostEntry{{Host: "db.internal", IP: "10.0.0.8"}},
+	}
+	if !reflect.DeepEqual(policy, want) {
+		t.Fatalf("unexpected policy %+v", policy)
+	}
+
+	if value, present, err := parseDNSPolicyInput(map[string]interface{}{"dnsPolicy": map[string]interface{}{}}); err != nil || !present || value != "" {
+		t.Fatalf("expected an empty policy to clear the setting, got %q %v %v", value, present, err)
+	}
+	for _, bad := range []map[string]interface{}{
+		{"prefer": "ipv5"},
+		{"ttl": -1},
+		{"hosts": []interface{}{map[string]interface{}{"host": "db.internal", "ip": "not-an-ip"}}},
+	} {
+		if _, _, err := parseDNSPolicyInput(map[string]interface{}{"dnsPolicy": bad}); err == nil {
+			t.Fatalf("expected %v to be rejected", bad)
+		}
+	}
+}
+
+func TestMergeDNSPolicyPrefersForwardSettings(t *testing.T) {
+	tunnel := &dnsPolicy{Servers: []string{"udp://1.1.1.1:53"}, TTL: 300, Hosts: []dnsHostEntry{{Host: "db.internal", IP: "10.0.0.1"}}}
+	forward := &dnsPolicy{Prefer: "ipv4", Hosts: []dnsHostEntry{{Host: "db.internal", IP: "10.0.0.2"}}}
+	merged := mergeDNSPolicy(tunnel, forward)
+	if !reflect.DeepEqual(merged.Servers, tunnel.Servers) || merged.TTL != 300 || merged.Prefer != "ipv4" {
+		t.Fatalf("unexpected merged policy %+v", merged)
+	}
+	if got := merged.lookupHost("DB.internal"); got != "10.0.0.2" {
+		t.Fatalf("expected the forward's host entry to win, got %q", got)
+	}
+	if mergeDNSPolicy(nil, nil) != nil {
+		t.Fatalf("expected no policy without any settings")
+	}
+}
+
+func TestBuildDNSConfigsAndApply(t *testing.T) {
+	policy := &dnsPolicy{Servers: []string{"tls://1.1.1.1:853"}, Prefer: "ipv4", TTL: 30, Hosts: []dnsHostEntry{{Host: "db.internal", IP: "10.0.0.8"}}}
+	resolver, hosts := buildDNSConfigs(7, policy)
+	if resolver["name"] != "dns_forward_7" || hosts["name"] != "hosts_forward_7" {
+		t.Fatalf("unexpected config names: %v %v", resolver["name"], hosts["name"])
+	}
+	ns := resolver["nameservers"].([]map[string]interface{})[0]
+	if ns["addr"] != "tls://1.1.1.1:853" || ns["prefer"] != "ipv4" || ns["ttl"] != "30s" {
+		t.Fatalf("unexpected nameserver %+v", ns)
+	}
+
+	services := []map[string]interface{}{{"name": "7_1_0_tcp"}, {"name": "7_1_0_udp"}}
+	applyDNSConfigs(services, resolver, hosts)
+	for _, service := range services {
+		if service["resolver"] != "dns_forward_7" || service["hosts"] != "hosts_forward_7" {
+			t.Fatalf("service not wired to the policy: %+v", service)
+		}
+	}
+
+	if resolver, hosts := buildDNSConfigs(7, nil); resolver != nil || hosts != nil {
+		t.Fatalf("expected no configs without a policy")
+	}
+}
+
+func TestResolveDiagnosisTargetsUsesPolicy(t *testing.T) {
+	policy := &dnsPolicy{Servers: []string{"udp://1.1.1.1:53"}, Hosts: []dnsHostEntry{{Host: "db.internal", IP: "10.0.0.8"}}}
+	targets, err := resolveDiagnosisTargets("db.internal:5432,example.com:443,10.0.0.9:80", policy)
+	if err != nil || len(targets) != 3 {
+		t.Fatalf("unexpected targets %+v err=%v", targets, err)
+	}
+	if targets[0].IP != "10.0.0.8" || targets[0].DNS != nil {
+		t.Fatalf("expected the static entry to be used, got %+v", targets[0])
+	}
+	if targets[1].IP != "example.com" || targets[1].DNS != policy {
+		t.Fatalf("expected the hostname to carry the policy, got %+v", targets[1])
+	}
+	if targets[2].DNS != nil {
+		t.Fatalf("expected an IP target to skip resolution, got %+v", targets[2])
+	}
+
+	payload := map[string]interface{}{}
+	dnsPingOptions(payload, targets[1].DNS)
+	if !reflect.DeepEqual(payload["nameservers"], policy.Servers) || payload["hosts"] == nil {
+		t.Fatalf("unexpected ping payload %+v", payload)
+	}
+}
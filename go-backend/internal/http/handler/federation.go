@@ -76,6 +76,17 @@ type federationRuntimeApplyRoleRequest struct {
 	Protocol      string                    `json:"protocol"`
 	Strategy      string                    `json:"strategy"`
 	Targets       []federationRuntimeTarget `json:"targets"`
+	Auth          *federationRuntimeAuth    `json:"auth,omitempty"`
+	// TransportOptions is the peer tunnel's transport configuration, applied to
+	// our listener and to the dialers of the next hops.
+	TransportOptions json.RawMessage `json:"transportOptions,omitempty"`
+}
+
+// federationRuntimeAuth is the relay credential of the peer's tunnel. It is
+// required on our relay service and presented to the peer's next hops.
+type federationRuntimeAuth struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
 }
 
 type federationRuntimeReleaseRoleRequest struct {
@@ -955,8 +966,20 @@ func (h *Handler) federationRuntimeApplyRole(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	protocol := defaultString(req.Protocol, runtime.Protocol)
+	protocol, err := normalizeTunnelProtocol(defaultString(req.Protocol, runtime.Protocol))
+	if err != nil {
+		response.WriteJSON(w, response.ErrDefault("Invalid protocol"))
+		return
+	}
 	strategy := defaultString(req.Strategy, "round")
+	transport := decodeTunnelTransportOptions(string(req.TransportOptions))
+	var relayAuth map[string]interface{}
+	if req.Auth != nil && strings.TrimSpace(req.Auth.Username) != "" && req.Auth.Password != "" {
+		relayAuth = map[string]interface{}{
+			"username": strings.TrimSpace(req.Auth.Username),
+			"password": req.Auth.Password,
+		}
+	}
 	chainName := fmt.Sprintf("fed_chain_%d", runtime.ID)
 	serviceName := fmt.Sprintf("fed_svc_%d", runtime.ID)
 
@@ -972,20 +995,25 @@ func (h *Handler) federationRuntimeApplyRole(w http.ResponseWriter, r *http.Requ
 				response.WriteJSON(w, response.ErrDefault("Invalid target"))
 				return
 			}
-			targetProtocol := defaultString(target.Protocol, protocol)
+			targetProtocol, err := normalizeTunnelProtocol(defaultString(target.Protocol, protocol))
+			if err != nil {
+				response.WriteJSON(w, response.ErrDefault("Invalid protocol"))
+				return
+			}
 			connector := map[string]interface{}{
 				"type": "relay",
 			}
 			if isTLSTunnelProtocol(targetProtocol) {
 				connector["metadata"] = map[string]interface{}{"nodelay": true}
 			}
+			if relayAuth != nil {
+				connector["auth"] = relayAuth
+			}
 			nodeItems = append(nodeItems, map[string]interface{}{
 				"name":      fmt.Sprintf("node_%d", i+1),
 				"addr":      processServerAddress(fmt.Sprintf("%s:%d", host, target.Port)),
 				"connector": connector,
-				"dialer": map[string]interface{}{
-					"type": targetProtocol,
-				},
+				"dialer":    buildTunnelDialerConfig(targetProtocol, transport),
 			})
 		}
 
@@ -1019,13 +1047,14 @@ func (h *Handler) federationRuntimeApplyRole(w http.ResponseWriter, r *http.Requ
 		"handler": map[string]interface{}{
 			"type": "relay",
 		},
-		"listener": map[string]interface{}{
-			"type": protocol,
-		},
+		"listener": buildTunnelListenerConfig(protocol, transport),
 	}
 	if isTLSTunnelProtocol(protocol) {
 		service["handler"].(map[string]interface{})["metadata"] = map[string]interface{}{"nodelay": true}
 	}
+	if relayAuth != nil {
+		service["handler"].(map[string]interface{})["auth"] = relayAuth
+	}
 	if req.Role == "middle" {
 		service["handler"].(map[string]interface{})["chain"] = chainName
 	}
@@ -1216,7 +1245,7 @@ func (h *Handler) federationRuntimeCommand(w http.ResponseWriter, r *http.Reques
 
 func isFederationRuntimeCommandAllowed(commandType string) bool {
 	switch strings.ToLower(strings.TrimSpace(commandType)) {
-	case "addservice", "updateservice", "deleteservice", "pauseservice", "resumeservice", "addchains", "deletechains", "addlimiters", "deletelimiters", "tcpping", "reload":
+	case "addservice", "updateservice", "deleteservice", "pauseservice", "resumeservice", "addchains", "deletechains", "addlimiters", "updatelimiters", "deletelimiters", "updateclimiters", "deleteclimiters", "updaterlimiters", "deleterlimiters", "updateadmissions", "deleteadmissions", "tcpping", "reload":
 		return true
 	default:
 		return false
@@ -1280,15 +1309,11 @@ func (h *Handler) pickPeerSharePort(share *repo.PeerShare, requestedPort int) (i
 		return 0, fmt.Errorf("No available port")
 	}
 
-	used := make(map[int]struct{})
-
-	nodePorts, err := h.repo.ListUsedPortsOnNode(share.NodeID)
+	// Port-range forwards hold every port of their range, not just the first.
+	used, err := h.repo.GetUsedPortsOnNodeAsMap(share.NodeID)
 	if err != nil {
 		return 0, err
 	}
-	for _, p := range nodePorts {
-		used[p] = struct{}{}
-	}
 
 	ports, err := h.repo.ListActivePeerShareRuntimePorts(share.ID, share.NodeID)
 	if err != nil {
@@ -1296,7 +1321,7 @@ func (h *Handler) pickPeerSharePort(share *repo.PeerShare, requestedPort int) (i
 	}
 	for _, p := range ports {
 		if p > 0 {
-			used[p] = struct{}{}
+			used[p] = true
 		}
 	}
 
@@ -1304,14 +1329,14 @@ func (h *Handler) pickPeerSharePort(share *repo.PeerShare, requestedPort int) (i
 		if requestedPort < share.PortRangeStart || requestedPort > share.PortRangeEnd {
 			return 0, fmt.Errorf("Port out of range")
 		}
-		if _, ok := used[requestedPort]; ok {
+		if used[requestedPort] {
 			return 0, fmt.Errorf("No available port")
 		}
 		return requestedPort, nil
 	}
 
 	for p := share.PortRangeStart; p <= share.PortRangeEnd; p++ {
-		if _, ok := used[p]; ok {
+		if used[p] {
 			continue
 		}
 		return p, nil
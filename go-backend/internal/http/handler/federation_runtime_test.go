@@ -56,6 +56,34 @@ func TestPickPeerSharePortUsesRuntimeReservations(t *testing.T) {
 	}
 }
 
+func TestPickPeerSharePortSkipsForwardPortRanges(t *testing.T) {
+	r, err := repo.Open(filepath.Join(t.TempDir(), "panel.db"))
+	if err != nil {
+		t.Fatalf("open repo: %v", err)
+	}
+	defer r.Close()
+
+	h := &Handler{repo: r}
+	if err := r.DB().Exec(`INSERT INTO forward(id, user_id, user_name, name, tunnel_id, remote_addr, strategy, created_time, updated_time, status, port_count) VALUES (1, 1, 'u', 'range', 1, '10.0.0.1:5000', 'fifo', 0, 0, 1, 3)`).Error; err != nil {
+		t.Fatalf("insert forward: %v", err)
+	}
+	if err := r.DB().Exec(`INSERT INTO forward_port(forward_id, node_id, port) VALUES(?, ?, ?)`, 1, 1, 4000).Error; err != nil {
+		t.Fatalf("insert forward_port: %v", err)
+	}
+
+	share := &repo.PeerShare{ID: 78, NodeID: 1, PortRangeStart: 4000, PortRangeEnd: 4005}
+	port, err := h.pickPeerSharePort(share, 0)
+	if err != nil {
+		t.Fatalf("pick auto port: %v", err)
+	}
+	if port != 4003 {
+		t.Fatalf("expected the port after the forward's range, got %d", port)
+	}
+	if _, err := h.pickPeerSharePort(share, 4002); err == nil {
+		t.Fatalf("expected a port inside the forward's range to be refused")
+	}
+}
+
 func TestApplyTunnelRuntimeSkipsRemoteChainAndOutNodes(t *testing.T) {
 	r, err := repo.Open(filepath.Join(t.TempDir(), "rt-skip.db"))
 	if err != nil {
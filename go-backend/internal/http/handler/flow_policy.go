@@ -21,9 +21,14 @@ type userTunnelPolicy struct {
 }
 
 type gostConfigSnapshot struct {
-	Services []namedConfigItem `json:"services"`
-	Chains   []namedConfigItem `json:"chains"`
-	Limiters []namedConfigItem `json:"limiters"`
+	Services   []namedConfigItem `json:"services"`
+	Chains     []namedConfigItem `json:"chains"`
+	Limiters   []namedConfigItem `json:"limiters"`
+	CLimiters  []namedConfigItem `json:"climiters"`
+	RLimiters  []namedConfigItem `json:"rlimiters"`
+	Admissions []namedConfigItem `json:"admissions"`
+	Resolvers  []namedConfigItem `json:"resolvers"`
+	Hosts      []namedConfigItem `json:"hosts"`
 }
 
 type namedConfigItem struct {
@@ -268,6 +273,10 @@ func (h *Handler) cleanNodeConfigs(nodeID int64, rawConfig string) {
 	h.cleanOrphanedServices(nodeID, snapshot.Services)
 	h.cleanOrphanedChains(nodeID, snapshot.Chains)
 	h.cleanOrphanedLimiters(nodeID, snapshot.Limiters)
+	h.cleanOrphanedConnLimiters(nodeID, "CLimiters", snapshot.CLimiters)
+	h.cleanOrphanedConnLimiters(nodeID, "RLimiters", snapshot.RLimiters)
+	h.cleanOrphanedAdmissions(nodeID, snapshot.Admissions)
+	h.cleanOrphanedDNSConfigs(nodeID, snapshot.Resolvers, snapshot.Hosts)
 }
 
 func (h *Handler) cleanOrphanedServices(nodeID int64, services []namedConfigItem) {
@@ -285,6 +294,21 @@ func (h *Handler) cleanOrphanedServices(nodeID int64, services []namedConfigItem
 				continue
 			}
 		}
+		if len(parts) == 5 && (parts[3] == "tcp" || parts[3] == "udp") {
+			forwardID, err1 := strconv.ParseInt(parts[0], 10, 64)
+			port, err2 := strconv.Atoi(parts[4])
+			if err1 == nil && err2 == nil && !h.forwardListensOn(forwardID, nodeID, port) {
+				_, _ = h.sendNodeCommand(nodeID, "DeleteService", map[string]interface{}{"services": []string{name}}, false, true)
+			}
+			continue
+		}
+		if len(parts) == 3 && parts[0] == "mux" {
+			port, err := strconv.Atoi(parts[1])
+			if err == nil && !h.muxPortInUse(nodeID, port) {
+				_, _ = h.sendNodeCommand(nodeID, "DeleteService", map[string]interface{}{"services": []string{name}}, false, true)
+			}
+			continue
+		}
 		suffix := parts[len(parts)-1]
 
 		switch suffix {
@@ -330,13 +354,149 @@ func (h *Handler) cleanOrphanedChains(nodeID int64, chains []namedConfigItem) {
 func (h *Handler) cleanOrphanedLimiters(nodeID int64, limiters []namedConfigItem) {
 	for _, item := range limiters {
 		name := strings.TrimSpace(item.Name)
-		if name == "" || h.speedLimiterExists(name) {
+		if name == "" || h.trafficLimiterInUse(name) {
 			continue
 		}
 		_, _ = h.sendNodeCommand(nodeID, "DeleteLimiters", map[string]interface{}{"limiter": name}, false, true)
 	}
 }
 
+// trafficLimiterInUse reports whether the panel still deploys a traffic
+// limiter: a speed limit by its numeric ID, the pool of a user who still has
+// a bandwidth plan, or the per-IP and per-connection caps still set on a
+// forward or user tunnel.
+func (h *Handler) trafficLimiterInUse(name string) bool {
+	if userID, ok := configNameID(name, "pool_user_"); ok {
+		return h.userBandwidthPool(userID).enabled()
+	}
+	if forwardID, ok := configNameID(name, "cap_forward_"); ok {
+		forward, err := h.getForwardRecord(forwardID)
+		return err == nil && (forward.IPSpeed > 0 || forward.ConnSpeed > 0)
+	}
+	if userTunnelID, ok := configNameID(name, "cap_usertunnel_"); ok {
+		ipSpeed, connSpeed := h.repo.GetUserTunnelSpeedCaps(userTunnelID)
+		return ipSpeed > 0 || connSpeed > 0
+	}
+	return h.speedLimiterExists(name)
+}
+
+// cleanOrphanedConnLimiters removes the conn ("CLimiters") or rate
+// ("RLimiters") limiters of forwards and user tunnels whose limit was cleared
+// or that no longer exist. Limiters the panel did not name are left alone.
+func (h *Handler) cleanOrphanedConnLimiters(nodeID int64, kind string, limiters []namedConfigItem) {
+	for _, item := range limiters {
+		name := strings.TrimSpace(item.Name)
+		inUse, owned := h.connLimiterInUse(kind, name)
+		if !owned || inUse {
+			continue
+		}
+		_, _ = h.sendNodeCommand(nodeID, "Delete"+kind, map[string]interface{}{"limiter": name}, false, true)
+	}
+}
+
+func (h *Handler) connLimiterInUse(kind, name string) (inUse, owned bool) {
+	forwardPrefix, userTunnelPrefix := "conn_forward_", "conn_usertunnel_"
+	if kind == "RLimiters" {
+		forwardPrefix, userTunnelPrefix = "rate_forward_", "rate_usertunnel_"
+	}
+	if forwardID, ok := configNameID(name, forwardPrefix); ok {
+		forward, err := h.getForwardRecord(forwardID)
+		if err != nil {
+			return false, true
+		}
+		if kind == "RLimiters" {
+			return forward.ConnRate > 0, true
+		}
+		return forward.MaxConns > 0, true
+	}
+	if userTunnelID, ok := configNameID(name, userTunnelPrefix); ok {
+		maxConns, connRate := h.repo.GetUserTunnelConnLimits(userTunnelID)
+		if kind == "RLimiters" {
+			return connRate > 0, true
+		}
+		return maxConns > 0, true
+	}
+	return false, false
+}
+
+// cleanOrphanedAdmissions removes the access rule admissions of tunnels and
+// forwards whose rules no longer produce them.
+func (h *Handler) cleanOrphanedAdmissions(nodeID int64, admissions []namedConfigItem) {
+	for _, item := range admissions {
+		name := strings.TrimSpace(item.Name)
+		prefix := strings.TrimSuffix(strings.TrimSuffix(name, "_allow"), "_deny")
+		if prefix == name {
+			continue
+		}
+		var rules *accessRules
+		if tunnelID, ok := configNameID(prefix, "adm_tunnel_"); ok {
+			rules = decodeAccessRules(h.repo.GetTunnelAccessRules(tunnelID))
+		} else if forwardID, ok := configNameID(prefix, "adm_forward_"); ok {
+			if forward, err := h.getForwardRecord(forwardID); err == nil {
+				rules = decodeAccessRules(forward.AccessRules)
+			}
+		} else {
+			continue
+		}
+		if admissionNamed(buildAccessAdmissions(prefix, rules), name) {
+			continue
+		}
+		_, _ = h.sendNodeCommand(nodeID, "DeleteAdmissions", map[string]interface{}{"admission": name}, false, true)
+	}
+}
+
+func admissionNamed(admissions []map[string]interface{}, name string) bool {
+	for _, adm := range admissions {
+		if adm["name"] == name {
+			return true
+		}
+	}
+	return false
+}
+
+// cleanOrphanedDNSConfigs removes the resolvers and host mappings of forwards
+// whose DNS policy no longer uses them.
+func (h *Handler) cleanOrphanedDNSConfigs(nodeID int64, resolvers, hosts []namedConfigItem) {
+	policyConfigs := func(forwardID int64) (resolver, hosts map[string]interface{}) {
+		forward, err := h.getForwardRecord(forwardID)
+		if err != nil {
+			return nil, nil
+		}
+		return buildDNSConfigs(forward.ID, h.forwardDNSPolicy(forward))
+	}
+	for _, item := range resolvers {
+		name := strings.TrimSpace(item.Name)
+		forwardID, ok := configNameID(name, "dns_forward_")
+		if !ok {
+			continue
+		}
+		if resolver, _ := policyConfigs(forwardID); resolver != nil {
+			continue
+		}
+		_, _ = h.sendNodeCommand(nodeID, "DeleteResolvers", map[string]interface{}{"resolver": name}, false, true)
+	}
+	for _, item := range hosts {
+		name := strings.TrimSpace(item.Name)
+		forwardID, ok := configNameID(name, "hosts_forward_")
+		if !ok {
+			continue
+		}
+		if _, mapping := policyConfigs(forwardID); mapping != nil {
+			continue
+		}
+		_, _ = h.sendNodeCommand(nodeID, "DeleteHosts", map[string]interface{}{"hosts": name}, false, true)
+	}
+}
+
+// configNameID parses the ID of an agent config named prefix<id>.
+func configNameID(name, prefix string) (int64, bool) {
+	if !strings.HasPrefix(name, prefix) {
+		return 0, false
+	}
+	id, err := strconv.ParseInt(strings.TrimPrefix(name, prefix), 10, 64)
+	return id, err == nil && id > 0
+}
+
 func (h *Handler) tunnelExists(tunnelID int64) bool {
 	ok, _ := h.repo.TunnelExists(tunnelID)
 	return ok
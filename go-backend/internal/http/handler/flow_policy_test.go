@@ -0,0 +1,140 @@
+package handler
+
+import (
+	"path/filepath"
+	"testing"
+
+	"go-backend/internal/store/repo"
+)
+
+func TestCleanNodeConfigsKeepsBandwidthPoolLimiters(t *testing.T) {
+	r, err := repo.Open(filepath.Join(t.TempDir(), "sweep.db"))
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	t.Cleanup(func() { _ = r.Close() })
+	h := New(r, "secret")
+
+	for _, stmt := range []string{
+		`INSERT INTO user(id, user, pwd, role_id, exp_time, flow, in_flow, out_flow, flow_reset_time, num, created_time, updated_time, status, bandwidth_up, bandwidth_down) VALUES (2, 'pooled', 'x', 1, 0, 0, 0, 0, 0, 1, 0, 0, 1, 50, 100)`,
+		`INSERT INTO user(id, user, pwd, role_id, exp_time, flow, in_flow, out_flow, flow_reset_time, num, created_time, updated_time, status) VALUES (3, 'unpooled', 'x', 1, 0, 0, 0, 0, 0, 1, 0, 0, 1)`,
+	} {
+		if err := r.DB().Exec(stmt).Error; err != nil {
+			t.Fatalf("seed: %v", err)
+		}
+	}
+	insertOfflineNode(t, r, 1, "entry")
+	agent := connectFakeNodeAgent(t, h, 1, "entry-secret")
+
+	h.cleanNodeConfigs(1, `{"limiters":[{"name":"pool_user_2"},{"name":"pool_user_3"},{"name":"pool_user_9"}]}`)
+
+	deleted := map[string]bool{}
+	for _, cmd := range agent.sent("DeleteLimiters") {
+		deleted[asString(cmd.Data["limiter"])] = true
+	}
+	if deleted["pool_user_2"] {
+		t.Fatalf("expected the pool of a user with a bandwidth plan to be kept")
+	}
+	if !deleted["pool_user_3"] || !deleted["pool_user_9"] {
+		t.Fatalf("expected pools of users without a plan to be removed, got %v", deleted)
+	}
+}
+
+func TestCleanNodeConfigsKeepsSpeedCapLimiters(t *testing.T) {
+	r, err := repo.Open(filepath.Join(t.TempDir(), "sweep.db"))
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	t.Cleanup(func() { _ = r.Close() })
+	h := New(r, "secret")
+
+	for _, stmt := range []string{
+		`INSERT INTO tunnel(id, name, traffic_ratio, type, protocol, flow, created_time, updated_time, status, inx) VALUES (1, 't', 1.0, 1, 'tls', 0, 0, 0, 1, 0)`,
+		`INSERT INTO user_tunnel(id, user_id, tunnel_id, speed_id, num, flow, in_flow, out_flow, flow_reset_time, exp_time, status, ip_speed) VALUES (10, 2, 1, NULL, 1, 0, 0, 0, 0, 0, 1, 20)`,
+		`INSERT INTO user_tunnel(id, user_id, tunnel_id, speed_id, num, flow, in_flow, out_flow, flow_reset_time, exp_time, status) VALUES (11, 3, 1, NULL, 1, 0, 0, 0, 0, 0, 1)`,
+		`INSERT INTO forward(id, user_id, user_name, name, tunnel_id, remote_addr, strategy, created_time, updated_time, status, conn_speed) VALUES (20, 2, 'u', 'capped', 1, '1.1.1.1:443', 'fifo', 0, 0, 1, 5)`,
+		`INSERT INTO forward(id, user_id, user_name, name, tunnel_id, remote_addr, strategy, created_time, updated_time, status) VALUES (21, 2, 'u', 'uncapped', 1, '1.1.1.1:443', 'fifo', 0, 0, 1)`,
+	} {
+		if err := r.DB().Exec(stmt).Error; err != nil {
+			t.Fatalf("seed: %v", err)
+		}
+	}
+	insertOfflineNode(t, r, 1, "entry")
+	agent := connectFakeNodeAgent(t, h, 1, "entry-secret")
+
+	h.cleanNodeConfigs(1, `{"limiters":[{"name":"cap_forward_20"},{"name":"cap_forward_21"},{"name":"cap_forward_22"},{"name":"cap_usertunnel_10"},{"name":"cap_usertunnel_11"}]}`)
+
+	deleted := map[string]bool{}
+	for _, cmd := range agent.sent("DeleteLimiters") {
+		deleted[asString(cmd.Data["limiter"])] = true
+	}
+	if deleted["cap_forward_20"] || deleted["cap_usertunnel_10"] {
+		t.Fatalf("expected caps still configured to be kept, got %v", deleted)
+	}
+	for _, name := range []string{"cap_forward_21", "cap_forward_22", "cap_usertunnel_11"} {
+		if !deleted[name] {
+			t.Fatalf("expected %s to be removed, got %v", name, deleted)
+		}
+	}
+}
+
+func TestCleanNodeConfigsRemovesStaleForwardPolicies(t *testing.T) {
+	r, err := repo.Open(filepath.Join(t.TempDir(), "sweep.db"))
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	t.Cleanup(func() { _ = r.Close() })
+	h := New(r, "secret")
+
+	for _, stmt := range []string{
+		`INSERT INTO tunnel(id, name, traffic_ratio, type, protocol, flow, created_time, updated_time, status, inx, access_rules) VALUES (1, 't', 1.0, 1, 'tls', 0, 0, 0, 1, 0, '{"deny":["192.0.2.0/24"]}')`,
+		`INSERT INTO user_tunnel(id, user_id, tunnel_id, speed_id, num, flow, in_flow, out_flow, flow_reset_time, exp_time, status, conn_rate) VALUES (10, 2, 1, NULL, 1, 0, 0, 0, 0, 0, 1, 50)`,
+		`INSERT INTO forward(id, user_id, user_name, name, tunnel_id, remote_addr, strategy, created_time, updated_time, status, max_conns, access_rules, dns_policy) VALUES (20, 2, 'u', 'limited', 1, 'example.com:443', 'fifo', 0, 0, 1, 100, '{"allow":["198.51.100.0/24"]}', '{"servers":["1.1.1.1"]}')`,
+		`INSERT INTO forward(id, user_id, user_name, name, tunnel_id, remote_addr, strategy, created_time, updated_time, status) VALUES (21, 2, 'u', 'plain', 1, 'example.com:443', 'fifo', 0, 0, 1)`,
+	} {
+		if err := r.DB().Exec(stmt).Error; err != nil {
+			t.Fatalf("seed: %v", err)
+		}
+	}
+	insertOfflineNode(t, r, 1, "entry")
+	agent := connectFakeNodeAgent(t, h, 1, "entry-secret")
+
+	h.cleanNodeConfigs(1, `{
+		"climiters":[{"name":"conn_forward_20"},{"name":"conn_forward_21"},{"name":"conn_usertunnel_10"},{"name":"manual"}],
+		"rlimiters":[{"name":"rate_forward_20"},{"name":"rate_usertunnel_10"},{"name":"rate_usertunnel_11"}],
+		"admissions":[{"name":"adm_tunnel_1_deny"},{"name":"adm_tunnel_1_allow"},{"name":"adm_forward_20_allow"},{"name":"adm_forward_20_deny"},{"name":"adm_forward_22_allow"}],
+		"resolvers":[{"name":"dns_forward_20"},{"name":"dns_forward_21"}],
+		"hosts":[{"name":"hosts_forward_20"}]
+	}`)
+
+	deleted := func(cmdType, key string) map[string]bool {
+		names := map[string]bool{}
+		for _, cmd := range agent.sent(cmdType) {
+			names[asString(cmd.Data[key])] = true
+		}
+		return names
+	}
+	cases := []struct {
+		cmdType, key string
+		kept, gone   []string
+	}{
+		{"DeleteCLimiters", "limiter", []string{"conn_forward_20", "manual"}, []string{"conn_forward_21", "conn_usertunnel_10"}},
+		{"DeleteRLimiters", "limiter", []string{"rate_usertunnel_10"}, []string{"rate_forward_20", "rate_usertunnel_11"}},
+		{"DeleteAdmissions", "admission", []string{"adm_tunnel_1_deny", "adm_forward_20_allow"}, []string{"adm_tunnel_1_allow", "adm_forward_20_deny", "adm_forward_22_allow"}},
+		{"DeleteResolvers", "resolver", []string{"dns_forward_20"}, []string{"dns_forward_21"}},
+		{"DeleteHosts", "hosts", nil, []string{"hosts_forward_20"}},
+	}
+	for _, tc := range cases {
+		names := deleted(tc.cmdType, tc.key)
+		for _, name := range tc.kept {
+			if names[name] {
+				t.Fatalf("expected %s to be kept, got %s %v", name, tc.cmdType, names)
+			}
+		}
+		for _, name := range tc.gone {
+			if !names[name] {
+				t.Fatalf("expected %s to be removed, got %s %v", name, tc.cmdType, names)
+			}
+		}
+	}
+}
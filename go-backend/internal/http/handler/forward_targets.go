@@ -0,0 +1,158 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const forwardTargetMaxWeight = 100
+
+// selectorStrategyAliases maps every strategy name the agent's selector
+// understands to the canonical name stored on forwards and hop groups.
+var selectorStrategyAliases = map[string]string{
+	"fifo":          "fifo",
+	"ha":            "fifo",
+	"round":         "round",
+	"rr":            "round",
+	"random":        "rand",
+	"rand":          "rand",
+	"hash":          "hash",
+	"latency":       "latency",
+	"least-latency": "latency",
+}
+
+// forwardTargetOption carries the per-target selector labels. Weight is read
+// by the random strategy, Backup by the backup filter on every strategy.
+type forwardTargetOption struct {
+	Addr   string `json:"addr"`
+	Weight int    `json:"weight,omitempty"`
+	Backup bool   `json:"backup,omitempty"`
+}
+
+func normalizeForwardStrategy(strategy string) (string, error) {
+	return normalizeSelectorStrategy(strategy, "fifo")
+}
+
+func normalizeSelectorStrategy(strategy, fallback string) (string, error) {
+	strategy = strings.ToLower(strings.TrimSpace(strategy))
+	if strategy == "" {
+		return fallback, nil
+	}
+	canonical, ok := selectorStrategyAliases[strategy]
+	if !ok {
+		return "", errors.New("负载策略仅支持: fifo, round, rand, hash, latency")
+	}
+	return canonical, nil
+}
+
+// parseForwardTargetsInput reads the optional targets list. When present it
+// replaces remoteAddr and returns the options JSON ("" when every target uses
+// the defaults).
+func parseForwardTargetsInput(req map[string]interface{}) (remoteAddr string, options string, present bool, err error) {
+	raw, ok := req["targets"]
+	if !ok || raw == nil {
+		return "", "", false, nil
+	}
+	list, ok := raw.([]interface{})
+	if !ok {
+		return "", "", true, errors.New("目标列表格式错误")
+	}
+
+	addrs := make([]string, 0, len(list))
+	items := make([]forwardTargetOption, 0, len(list))
+	seen := make(map[string]struct{}, len(list))
+	primary := 0
+	for _, entry := range list {
+		m, ok := entry.(map[string]interface{})
+		if !ok {
+			return "", "", true, errors.New("目标列表格式错误")
+		}
+		addr := strings.TrimSpace(asString(m["addr"]))
+		if addr == "" {
+			return "", "", true, errors.New("目标地址不能为空")
+		}
+		if _, _, err := parseTargetAddress(addr); err != nil {
+			return "", "", true, fmt.Errorf("目标地址格式错误: %s", addr)
+		}
+		key := processServerAddress(addr)
+		if _, dup := seen[key]; dup {
+			return "", "", true, fmt.Errorf("目标地址重复: %s", addr)
+		}
+		seen[key] = struct{}{}
+
+		weight := asInt(m["weight"], 0)
+		if weight < 0 || weight > forwardTargetMaxWeight {
+			return "", "", true, fmt.Errorf("目标权重范围为 1-%d", forwardTargetMaxWeight)
+		}
+		if weight == 1 {
+			weight = 0
+		}
+		backup := asBool(m["backup"], false)
+		if !backup {
+			primary++
+		}
+
+		addrs = append(addrs, addr)
+		if weight > 0 || backup {
+			items = append(items, forwardTargetOption{Addr: key, Weight: weight, Backup: backup})
+		}
+	}
+	if len(addrs) == 0 {
+		return "", "", true, errors.New("目标地址不能为空")
+	}
+	if primary == 0 {
+		return "", "", true, errors.New("至少需要一个非备用目标")
+	}
+
+	if len(items) > 0 {
+		b, _ := json.Marshal(items)
+		options = string(b)
+	}
+	return strings.Join(addrs, ","), options, true, nil
+}
+
+// validateForwardTargetWeights rejects weights under a strategy that would
+// ignore them: only the random strategy reads them.
+func validateForwardTargetWeights(strategy, options string) error {
+	if strategy == "rand" {
+		return nil
+	}
+	for _, option := range decodeForwardTargetOptions(options) {
+		if option.Weight > 0 {
+			return errors.New("目标权重仅在随机(rand)负载策略下生效")
+		}
+	}
+	return nil
+}
+
+// decodeForwardTargetOptions indexes the stored options by normalized address.
+// Options for addresses no longer in remoteAddr are simply never looked up.
+func decodeForwardTargetOptions(raw string) map[string]forwardTargetOption {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return nil
+	}
+	var items []forwardTargetOption
+	if err := json.Unmarshal([]byte(raw), &items); err != nil {
+		return nil
+	}
+	out := make(map[string]forwardTargetOption, len(items))
+	for _, item := range items {
+		out[processServerAddress(item.Addr)] = item
+	}
+	return out
+}
+
+func forwardTargetMetadata(option forwardTargetOption) map[string]interface{} {
+	md := map[string]interface{}{}
+	if option.Weight > 0 {
+		md["weight"] = strconv.Itoa(option.Weight)
+	}
+	if option.Backup {
+		md["backup"] = true
+	}
+	return md
+}
@@ -0,0 +1,68 @@
+package handler
+
+import "testing"
+
+func TestParseForwardTargetsInput(t *testing.T) {
+	remoteAddr, options, present, err := parseForwardTargetsInput(map[string]interface{}{
+		"targets": []interface{}{
+			map[string]interface{}{"addr": "10.0.0.1:80", "weight": float64(3)},
+			map[string]interface{}{"addr": "10.0.0.2:80"},
+			map[string]interface{}{"addr": "10.0.0.3:80", "backup": true},
+		},
+	})
+	if err != nil || !present {
+		t.Fatalf("expected targets to parse, got present=%v err=%v", present, err)
+	}
+	if remoteAddr != "10.0.0.1:80,10.0.0.2:80,10.0.0.3:80" {
+		t.Fatalf("unexpected remoteAddr %q", remoteAddr)
+	}
+
+	nodes := buildForwarderNodes(splitRemoteTargets(remoteAddr), nil, decodeForwardTargetOptions(options))
+	if md, _ := nodes[0]["metadata"].(map[string]interface{}); md["weight"] != "3" {
+		t.Fatalf("expected weight label on first target, got %+v", nodes[0]["metadata"])
+	}
+	if _, ok := nodes[1]["metadata"]; ok {
+		t.Fatalf("expected default target without metadata, got %+v", nodes[1]["metadata"])
+	}
+	if md, _ := nodes[2]["metadata"].(map[string]interface{}); md["backup"] != true {
+		t.Fatalf("expected backup label on third target, got %+v", nodes[2]["metadata"])
+	}
+
+	for name, targets := range map[string][]interface{}{
+		"all backup": {map[string]interface{}{"addr": "10.0.0.1:80", "backup": true}},
+		"duplicate":  {map[string]interface{}{"addr": "10.0.0.1:80"}, map[string]interface{}{"addr": "10.0.0.1:80"}},
+		"weight":     {map[string]interface{}{"addr": "10.0.0.1:80", "weight": float64(101)}},
+	} {
+		if _, _, _, err := parseForwardTargetsInput(map[string]interface{}{"targets": targets}); err == nil {
+			t.Fatalf("expected %s targets to be rejected", name)
+		}
+	}
+}
+
+func TestNormalizeForwardStrategy(t *testing.T) {
+	cases := map[string]string{"": "fifo", "rr": "round", "Random": "rand", "least-latency": "latency"}
+	for in, want := range cases {
+		got, err := normalizeForwardStrategy(in)
+		if err != nil || got != want {
+			t.Fatalf("normalizeForwardStrategy(%q) = %q, %v; want %q", in, got, err, want)
+		}
+	}
+	if _, err := normalizeForwardStrategy("weighted"); err == nil {
+		t.Fatalf("expected unknown strategy to be rejected")
+	}
+}
+
+func TestValidateForwardTargetWeights(t *testing.T) {
+	weighted := `[{"addr":"10.0.0.1:80","weight":5}]`
+	if err := validateForwardTargetWeights("rand", weighted); err != nil {
+		t.Fatalf("expected weights with rand, got %v", err)
+	}
+	for _, strategy := range []string{"fifo", "round", "hash", "latency"} {
+		if err := validateForwardTargetWeights(strategy, weighted); err == nil {
+			t.Fatalf("expected weights with %s to be rejected", strategy)
+		}
+	}
+	if err := validateForwardTargetWeights("round", `[{"addr":"10.0.0.1:80","backup":true}]`); err != nil {
+		t.Fatalf("expected backup targets with any strategy, got %v", err)
+	}
+}
@@ -31,12 +31,33 @@ type Handler struct {
 	captchaTokens map[string]int64
 
 	jobsMu      sync.Mutex
+	jobsCtx     context.Context
 	jobsCancel  context.CancelFunc
 	jobsStarted bool
 	jobsWG      sync.WaitGroup
 
 	upgradeMu              sync.Mutex
 	pendingUpgradeRedeploy map[int64]struct{}
+
+	metricsMu   sync.Mutex
+	nodeMetrics map[int64]*nodeMetricAccumulator
+
+	maintenanceMu sync.Mutex
+	nodeDrains    map[int64]*nodeDrainState
+
+	campaignMu      sync.Mutex
+	campaignRunners map[int64]struct{}
+
+	quota *quotaBalancer
+
+	scheduleMu        sync.Mutex
+	scheduledForwards map[int64]bool
+	scheduledSpeeds   map[int64]int
+
+	throughputMu    sync.Mutex
+	throughputTests map[int64]struct{}
+
+	artifactDir string
 }
 
 type loginRequest struct {
@@ -79,8 +100,17 @@ func New(repo *repo.Repository, jwtSecret string) *Handler {
 		wsServer:               ws.NewServer(repo, jwtSecret),
 		captchaTokens:          make(map[string]int64),
 		pendingUpgradeRedeploy: make(map[int64]struct{}),
+		nodeMetrics:            make(map[int64]*nodeMetricAccumulator),
+		nodeDrains:             make(map[int64]*nodeDrainState),
+		campaignRunners:        make(map[int64]struct{}),
+		quota:                  newQuotaBalancer(),
+		scheduledForwards:      make(map[int64]bool),
+		scheduledSpeeds:        make(map[int64]int),
+		throughputTests:        make(map[int64]struct{}),
 	}
 	h.wsServer.SetNodeOnlineHook(h.onNodeOnline)
+	h.wsServer.SetNodeOfflineHook(h.onNodeOffline)
+	h.wsServer.SetNodeInfoHook(h.onNodeInfo)
 	return h
 }
 
@@ -121,13 +151,25 @@ func (h *Handler) Register(mux *http.ServeMux) {
 	mux.HandleFunc("/api/v1/node/upgrade", h.nodeUpgrade)
 	mux.HandleFunc("/api/v1/node/batch-upgrade", h.nodeBatchUpgrade)
 	mux.HandleFunc("/api/v1/node/rollback", h.nodeRollback)
+	mux.HandleFunc("/api/v1/node/upgrade-campaign/create", h.upgradeCampaignCreate)
+	mux.HandleFunc("/api/v1/node/upgrade-campaign/list", h.upgradeCampaignList)
+	mux.HandleFunc("/api/v1/node/upgrade-campaign/get", h.upgradeCampaignGet)
+	mux.HandleFunc("/api/v1/node/upgrade-campaign/cancel", h.upgradeCampaignCancel)
+	mux.HandleFunc("/api/v1/node/artifact/upload", h.nodeArtifactUpload)
+	mux.HandleFunc("/api/v1/node/artifact/list", h.nodeArtifactList)
+	mux.HandleFunc("/api/v1/node/artifact/delete", h.nodeArtifactDelete)
 	mux.HandleFunc("/api/v1/node/releases", h.listReleases)
+	mux.HandleFunc("/api/v1/node/metrics", h.nodeMetricsHistory)
+	mux.HandleFunc("/api/v1/node/maintenance", h.nodeMaintenance)
+	mux.HandleFunc("/api/v1/node/maintenance/status", h.nodeMaintenanceStatus)
 	mux.HandleFunc("/api/v1/tunnel/list", h.tunnelList)
 	mux.HandleFunc("/api/v1/tunnel/create", h.tunnelCreate)
 	mux.HandleFunc("/api/v1/tunnel/get", h.tunnelGet)
 	mux.HandleFunc("/api/v1/tunnel/update", h.tunnelUpdate)
 	mux.HandleFunc("/api/v1/tunnel/delete", h.tunnelDelete)
 	mux.HandleFunc("/api/v1/tunnel/diagnose", h.tunnelDiagnose)
+	mux.HandleFunc("/api/v1/tunnel/throughput-test", h.tunnelThroughputTest)
+	mux.HandleFunc("/api/v1/tunnel/health", h.tunnelHealth)
 	mux.HandleFunc("/api/v1/tunnel/update-order", h.tunnelUpdateOrder)
 	mux.HandleFunc("/api/v1/tunnel/batch-delete", h.tunnelBatchDelete)
 	mux.HandleFunc("/api/v1/tunnel/batch-redeploy", h.tunnelBatchRedeploy)
@@ -143,7 +185,10 @@ func (h *Handler) Register(mux *http.ServeMux) {
 	mux.HandleFunc("/api/v1/forward/pause", h.forwardPause)
 	mux.HandleFunc("/api/v1/forward/resume", h.forwardResume)
 	mux.HandleFunc("/api/v1/forward/diagnose", h.forwardDiagnose)
+	mux.HandleFunc("/api/v1/forward/health", h.forwardHealth)
+	mux.HandleFunc("/api/v1/forward/limits", h.forwardLimits)
 	mux.HandleFunc("/api/v1/forward/update-order", h.forwardUpdateOrder)
+	mux.HandleFunc("/api/v1/forward/access-log", h.forwardAccessLogs)
 	mux.HandleFunc("/api/v1/forward/batch-delete", h.forwardBatchDelete)
 	mux.HandleFunc("/api/v1/forward/batch-pause", h.forwardBatchPause)
 	mux.HandleFunc("/api/v1/forward/batch-resume", h.forwardBatchResume)
@@ -190,6 +235,8 @@ func (h *Handler) Register(mux *http.ServeMux) {
 	mux.HandleFunc("/flow/test", h.flowTest)
 	mux.HandleFunc("/flow/config", h.flowConfig)
 	mux.HandleFunc("/flow/upload", h.flowUpload)
+	mux.HandleFunc("/flow/access", h.flowAccess)
+	mux.HandleFunc(artifactRoutePrefix, h.serveArtifact)
 	mux.HandleFunc("/error", h.errorPage)
 }
 
@@ -574,6 +621,10 @@ func (h *Handler) userTunnelList(w http.ResponseWriter, r *http.Request) {
 			"tunnelFlow":     t.TunnelFlow,
 			"speedId":        nil,
 			"speedLimitName": nil,
+			"maxConns":       t.MaxConns,
+			"connRate":       t.ConnRate,
+			"ipSpeed":        t.IPSpeed,
+			"connSpeed":      t.ConnSpeed,
 		}
 		if t.SpeedID.Valid {
 			item["speedId"] = t.SpeedID.Int64
@@ -704,7 +755,8 @@ func (h *Handler) flowConfig(w http.ResponseWriter, r *http.Request) {
 
 func (h *Handler) flowUpload(w http.ResponseWriter, r *http.Request) {
 	secret := r.URL.Query().Get("secret")
-	if ok, _ := h.repo.NodeExistsBySecret(secret); !ok {
+	node, _ := h.repo.GetNodeBySecret(secret)
+	if node == nil {
 		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
 		_, _ = w.Write([]byte("ok"))
 		return
@@ -716,6 +768,7 @@ func (h *Handler) flowUpload(w http.ResponseWriter, r *http.Request) {
 		if json.Unmarshal([]byte(raw), &items) == nil {
 			for _, item := range items {
 				h.processFlowItem(item)
+				h.recordQuotaUsage(node.ID, item)
 			}
 		}
 	}
@@ -848,6 +901,10 @@ func (h *Handler) userPackage(w http.ResponseWriter, r *http.Request) {
 			"speedId":        nil,
 			"speedLimitName": nil,
 			"speed":          nil,
+			"maxConns":       t.MaxConns,
+			"connRate":       t.ConnRate,
+			"ipSpeed":        t.IPSpeed,
+			"connSpeed":      t.ConnSpeed,
 		}
 		if t.SpeedID.Valid {
 			item["speedId"] = t.SpeedID.Int64
@@ -0,0 +1,358 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-backend/internal/http/response"
+)
+
+const (
+	healthCheckDefaultInterval = 10
+	healthCheckDefaultTimeout  = 3
+	healthCheckDefaultFails    = 2
+	healthCheckDefaultPasses   = 1
+	healthCheckMaxInterval     = 3600
+	healthCheckMaxThreshold    = 10
+	healthReportTTL            = 30 * time.Second
+)
+
+// healthCheckConfig is the active probe stored on forwards (per target) and
+// tunnels (per hop node). It is pushed to agents as node metadata and drives
+// the selector's health filter there.
+type healthCheckConfig struct {
+	Type     string `json:"type"`
+	Interval int    `json:"interval,omitempty"` // seconds
+	Timeout  int    `json:"timeout,omitempty"`  // seconds
+	Fails    int    `json:"fails,omitempty"`
+	Passes   int    `json:"passes,omitempty"`
+	Path     string `json:"path,omitempty"`
+	Status   int    `json:"status,omitempty"`
+	Send     string `json:"send,omitempty"`
+	Expect   string `json:"expect,omitempty"`
+}
+
+// nodeHealthReport mirrors the agent's health.Status.
+type nodeHealthReport struct {
+	Owner     string `json:"owner"`
+	Node      string `json:"node"`
+	Addr      string `json:"addr"`
+	Type      string `json:"type"`
+	Up        bool   `json:"up"`
+	Checked   bool   `json:"checked"`
+	Latency   int64  `json:"latency"`
+	Error     string `json:"error,omitempty"`
+	CheckedAt int64  `json:"checked_at"`
+	Since     int64  `json:"since"`
+}
+
+var (
+	forwardHealthCheckTypes = []string{"tcp", "udp", "http"}
+	// Tunnel hops are relay listeners, so only a TCP connect makes sense.
+	tunnelHealthCheckTypes = []string{"tcp"}
+)
+
+// parseHealthCheckInput validates the healthCheck request field and returns
+// its normalized JSON, or "" when the check is disabled. present is false
+// when the field was not sent at all.
+func parseHealthCheckInput(req map[string]interface{}, allowed []string) (value string, present bool, err error) {
+	raw, ok := req["healthCheck"]
+	if !ok {
+		return "", false, nil
+	}
+	if raw == nil {
+		return "", true, nil
+	}
+
+	var cfg healthCheckConfig
+	switch v := raw.(type) {
+	case string:
+		if strings.TrimSpace(v) == "" {
+			return "", true, nil
+		}
+		if err := json.Unmarshal([]byte(v), &cfg); err != nil {
+			return "", true, errors.New("健康检查配置格式错误")
+		}
+	case map[string]interface{}:
+		b, _ := json.Marshal(v)
+		if err := json.Unmarshal(b, &cfg); err != nil {
+			return "", true, errors.New("健康检查配置格式错误")
+		}
+	default:
+		return "", true, errors.New("健康检查配置格式错误")
+	}
+
+	normalized, err := normalizeHealthCheck(cfg, allowed)
+	if err != nil || normalized == nil {
+		return "", true, err
+	}
+	b, _ := json.Marshal(normalized)
+	return string(b), true, nil
+}
+
+func normalizeHealthCheck(cfg healthCheckConfig, allowed []string) (*healthCheckConfig, error) {
+	cfg.Type = strings.ToLower(strings.TrimSpace(cfg.Type))
+	if cfg.Type == "" || cfg.Type == "none" {
+		return nil, nil
+	}
+	valid := false
+	for _, t := range allowed {
+		if cfg.Type == t {
+			valid = true
+			break
+		}
+	}
+	if !valid {
+		return nil, fmt.Errorf("健康检查类型仅支持: %s", strings.Join(allowed, ", "))
+	}
+
+	if cfg.Interval <= 0 {
+		cfg.Interval = healthCheckDefaultInterval
+	}
+	if cfg.Interval > healthCheckMaxInterval {
+		return nil, fmt.Errorf("健康检查间隔不能超过 %d 秒", healthCheckMaxInterval)
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = healthCheckDefaultTimeout
+	}
+	if cfg.Timeout > cfg.Interval {
+		cfg.Timeout = cfg.Interval
+	}
+	if cfg.Fails <= 0 {
+		cfg.Fails = healthCheckDefaultFails
+	}
+	if cfg.Passes <= 0 {
+		cfg.Passes = healthCheckDefaultPasses
+	}
+	if cfg.Fails > healthCheckMaxThreshold || cfg.Passes > healthCheckMaxThreshold {
+		return nil, fmt.Errorf("健康检查阈值不能超过 %d", healthCheckMaxThreshold)
+	}
+
+	if cfg.Type != "http" {
+		cfg.Path = ""
+		cfg.Status = 0
+	} else {
+		cfg.Path = strings.TrimSpace(cfg.Path)
+		if cfg.Path != "" && !strings.HasPrefix(cfg.Path, "/") {
+			return nil, errors.New("健康检查路径必须以 / 开头")
+		}
+		if cfg.Status != 0 && (cfg.Status < 100 || cfg.Status > 599) {
+			return nil, errors.New("健康检查状态码无效")
+		}
+	}
+	if cfg.Type != "udp" {
+		cfg.Send = ""
+		cfg.Expect = ""
+	}
+	return &cfg, nil
+}
+
+// decodeHealthCheck parses a stored health check; invalid or empty values
+// disable probing.
+func decodeHealthCheck(raw string) *healthCheckConfig {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return nil
+	}
+	var cfg healthCheckConfig
+	if err := json.Unmarshal([]byte(raw), &cfg); err != nil {
+		return nil
+	}
+	normalized, err := normalizeHealthCheck(cfg, append(append([]string{}, forwardHealthCheckTypes...), tunnelHealthCheckTypes...))
+	if err != nil {
+		return nil
+	}
+	return normalized
+}
+
+// healthCheckMetadata renders the agent node metadata. Numbers are sent as
+// strings because the agent's metadata helpers do not read JSON floats.
+func healthCheckMetadata(cfg *healthCheckConfig) map[string]interface{} {
+	if cfg == nil {
+		return nil
+	}
+	md := map[string]interface{}{
+		"healthCheck":    cfg.Type,
+		"healthInterval": fmt.Sprintf("%ds", cfg.Interval),
+		"healthTimeout":  fmt.Sprintf("%ds", cfg.Timeout),
+		"healthFails":    strconv.Itoa(cfg.Fails),
+		"healthPasses":   strconv.Itoa(cfg.Passes),
+	}
+	if cfg.Path != "" {
+		md["healthPath"] = cfg.Path
+	}
+	if cfg.Status > 0 {
+		md["healthStatus"] = strconv.Itoa(cfg.Status)
+	}
+	if cfg.Send != "" {
+		md["healthSend"] = cfg.Send
+	}
+	if cfg.Expect != "" {
+		md["healthExpect"] = cfg.Expect
+	}
+	return md
+}
+
+// healthCheckFailTimeout shortens the passive fail timeout when active probes
+// are configured, so a target that recovers is retried once the probe sees it.
+func healthCheckFailTimeout(cfg *healthCheckConfig, fallback time.Duration) time.Duration {
+	if cfg == nil {
+		return fallback
+	}
+	return time.Duration(cfg.Interval*cfg.Fails) * time.Second
+}
+
+// nodeHealthStatuses returns the probes from the node's latest telemetry whose
+// owner matches. ok is false when no fresh report exists.
+func (h *Handler) nodeHealthStatuses(nodeID int64, match func(owner string) bool, now time.Time) ([]nodeHealthReport, bool) {
+	h.metricsMu.Lock()
+	defer h.metricsMu.Unlock()
+	acc := h.nodeMetrics[nodeID]
+	if acc == nil || acc.lastReport == nil || now.UnixMilli()-acc.lastAt > healthReportTTL.Milliseconds() {
+		return nil, false
+	}
+	items := make([]nodeHealthReport, 0)
+	for _, item := range acc.lastReport.Health {
+		if match(item.Owner) {
+			items = append(items, item)
+		}
+	}
+	return items, true
+}
+
+func healthReportPayload(nodeID int64, nodeName string, item nodeHealthReport) map[string]interface{} {
+	return map[string]interface{}{
+		"nodeId":    nodeID,
+		"nodeName":  nodeName,
+		"owner":     item.Owner,
+		"target":    item.Addr,
+		"type":      item.Type,
+		"up":        item.Up,
+		"checked":   item.Checked,
+		"latency":   item.Latency,
+		"error":     item.Error,
+		"checkedAt": item.CheckedAt,
+		"since":     item.Since,
+	}
+}
+
+func (h *Handler) forwardHealth(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		response.WriteJSON(w, response.ErrDefault("请求失败"))
+		return
+	}
+	id := asInt64FromBodyKey(r, w, "forwardId")
+	if id <= 0 {
+		return
+	}
+	forward, _, _, err := h.resolveForwardAccess(r, id)
+	if err != nil {
+		if errors.Is(err, errForwardNotFound) {
+			response.WriteJSON(w, response.ErrDefault("转发不存在"))
+			return
+		}
+		response.WriteJSON(w, response.Err(-2, err.Error()))
+		return
+	}
+	ports, err := h.listForwardPorts(forward.ID)
+	if err != nil {
+		response.WriteJSON(w, response.Err(-2, err.Error()))
+		return
+	}
+
+	prefix := fmt.Sprintf("%d_%d_", forward.ID, forward.UserID)
+	match := func(owner string) bool { return strings.HasPrefix(owner, prefix) }
+	now := time.Now()
+	items := make([]map[string]interface{}, 0)
+	offline := make([]int64, 0)
+	for _, fp := range ports {
+		node, err := h.getNodeRecord(fp.NodeID)
+		if err != nil {
+			continue
+		}
+		statuses, ok := h.nodeHealthStatuses(fp.NodeID, match, now)
+		if !ok {
+			offline = append(offline, fp.NodeID)
+			continue
+		}
+		for _, item := range statuses {
+			payload := healthReportPayload(fp.NodeID, node.Name, item)
+			payload["protocol"] = strings.TrimPrefix(item.Owner[strings.LastIndex(item.Owner, "_"):], "_")
+			items = append(items, payload)
+		}
+	}
+
+	var healthCheck interface{}
+	if cfg := decodeHealthCheck(forward.HealthCheck); cfg != nil {
+		healthCheck = cfg
+	}
+	response.WriteJSON(w, response.OK(map[string]interface{}{
+		"forwardId":    forward.ID,
+		"healthCheck":  healthCheck,
+		"targets":      items,
+		"offlineNodes": offline,
+	}))
+}
+
+func (h *Handler) tunnelHealth(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		response.WriteJSON(w, response.ErrDefault("请求失败"))
+		return
+	}
+	id := asInt64FromBodyKey(r, w, "tunnelId")
+	if id <= 0 {
+		return
+	}
+	state, err := h.reconstructTunnelState(id)
+	if err != nil {
+		response.WriteJSON(w, response.ErrDefault(err.Error()))
+		return
+	}
+
+	owner := fmt.Sprintf("hop_%d", id)
+	match := func(o string) bool { return o == owner }
+	now := time.Now()
+	sources := make([]tunnelRuntimeNode, 0, len(state.InNodes))
+	sources = append(sources, state.InNodes...)
+	for _, group := range state.ChainHops {
+		sources = append(sources, group...)
+	}
+
+	items := make([]map[string]interface{}, 0)
+	offline := make([]int64, 0)
+	seen := make(map[int64]struct{}, len(sources))
+	for _, src := range sources {
+		if _, ok := seen[src.NodeID]; ok {
+			continue
+		}
+		seen[src.NodeID] = struct{}{}
+		node := state.Nodes[src.NodeID]
+		if node == nil {
+			continue
+		}
+		statuses, ok := h.nodeHealthStatuses(src.NodeID, match, now)
+		if !ok {
+			offline = append(offline, src.NodeID)
+			continue
+		}
+		for _, item := range statuses {
+			items = append(items, healthReportPayload(src.NodeID, node.Name, item))
+		}
+	}
+
+	var healthCheck interface{}
+	if cfg := state.HealthCheck; cfg != nil {
+		healthCheck = cfg
+	}
+	response.WriteJSON(w, response.OK(map[string]interface{}{
+		"tunnelId":     id,
+		"healthCheck":  healthCheck,
+		"hops":         items,
+		"offlineNodes": offline,
+	}))
+}
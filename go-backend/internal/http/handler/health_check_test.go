@@ -0,0 +1,68 @@
+package handler
+
+import (
+	"testing"
+)
+
+func TestParseHealthCheckInputNormalizesAndValidates(t *testing.T) {
+	value, present, err := parseHealthCheckInput(map[string]interface{}{
+		"healthCheck": map[string]interface{}{"type": "HTTP", "path": "/healthz", "send": "ping"},
+	}, forwardHealthCheckTypes)
+	if err != nil || !present {
+		t.Fatalf("expected valid http check, got present=%v err=%v", present, err)
+	}
+	cfg := decodeHealthCheck(value)
+	if cfg == nil || cfg.Type != "http" || cfg.Interval != healthCheckDefaultInterval || cfg.Fails != healthCheckDefaultFails || cfg.Send != "" {
+		t.Fatalf("unexpected normalized check: %+v", cfg)
+	}
+
+	if _, _, err := parseHealthCheckInput(map[string]interface{}{
+		"healthCheck": map[string]interface{}{"type": "udp"},
+	}, tunnelHealthCheckTypes); err == nil {
+		t.Fatalf("expected udp check to be rejected for tunnels")
+	}
+
+	value, present, err = parseHealthCheckInput(map[string]interface{}{"healthCheck": nil}, forwardHealthCheckTypes)
+	if err != nil || !present || value != "" {
+		t.Fatalf("expected explicit null to disable check, got %q present=%v err=%v", value, present, err)
+	}
+	if _, present, _ := parseHealthCheckInput(map[string]interface{}{}, forwardHealthCheckTypes); present {
+		t.Fatalf("expected missing field to be reported as absent")
+	}
+}
+
+func TestBuildForwardServiceConfigsAttachesHealthCheck(t *testing.T) {
+	forward := &forwardRecord{
+		ID:          7,
+		RemoteAddr:  "10.0.0.1:80,10.0.0.2:80",
+		Strategy:    "round",
+		HealthCheck: `{"type":"tcp","interval":5,"fails":3}`,
+	}
+	node := &nodeRecord{TCPListenAddr: "[::]", UDPListenAddr: "[::]"}
+
+	services := buildForwardServiceConfigs("7_1_0", forward, nil, node, 10000, nil, false)
+	if len(services) != 2 {
+		t.Fatalf("expected tcp and udp services, got %d", len(services))
+	}
+	forwarder := services[0]["forwarder"].(map[string]interface{})
+	if got := forwarder["selector"].(map[string]interface{})["failTimeout"]; got != "15s" {
+		t.Fatalf("expected failTimeout 15s, got %v", got)
+	}
+	nodes := forwarder["nodes"].([]map[string]interface{})
+	for _, n := range nodes {
+		md, ok := n["metadata"].(map[string]interface{})
+		if !ok || md["healthCheck"] != "tcp" || md["healthInterval"] != "5s" || md["healthFails"] != "3" {
+			t.Fatalf("unexpected node metadata: %+v", n["metadata"])
+		}
+	}
+
+	forward.HealthCheck = ""
+	services = buildForwardServiceConfigs("7_1_0", forward, nil, node, 10000, nil, false)
+	forwarder = services[0]["forwarder"].(map[string]interface{})
+	if got := forwarder["selector"].(map[string]interface{})["failTimeout"]; got != "600s" {
+		t.Fatalf("expected default failTimeout, got %v", got)
+	}
+	if _, ok := forwarder["nodes"].([]map[string]interface{})[0]["metadata"]; ok {
+		t.Fatalf("expected no metadata without health check")
+	}
+}
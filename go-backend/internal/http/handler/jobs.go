@@ -16,13 +16,30 @@ func (h *Handler) StartBackgroundJobs() {
 		return
 	}
 	ctx, cancel := context.WithCancel(context.Background())
+	h.jobsCtx = ctx
 	h.jobsCancel = cancel
 	h.jobsStarted = true
-	h.jobsWG.Add(2)
+	h.jobsWG.Add(5)
 	h.jobsMu.Unlock()
 
 	go h.runHourlyStatsLoop(ctx)
 	go h.runDailyMaintenanceLoop(ctx)
+	go h.runQuotaRebalanceLoop(ctx)
+	go h.runScheduleLoop(ctx)
+	go h.runRelaySecretBackfillLoop(ctx)
+
+	h.resumeUpgradeCampaigns()
+}
+
+// backgroundContext is cancelled when background jobs stop; long-running
+// workers started outside StartBackgroundJobs use it to exit on shutdown.
+func (h *Handler) backgroundContext() context.Context {
+	h.jobsMu.Lock()
+	defer h.jobsMu.Unlock()
+	if h.jobsCtx != nil {
+		return h.jobsCtx
+	}
+	return context.Background()
 }
 
 func (h *Handler) StopBackgroundJobs() {
@@ -36,6 +53,7 @@ func (h *Handler) StopBackgroundJobs() {
 		return
 	}
 	cancel := h.jobsCancel
+	h.jobsCtx = nil
 	h.jobsCancel = nil
 	h.jobsStarted = false
 	h.jobsMu.Unlock()
@@ -59,7 +77,10 @@ func (h *Handler) runHourlyStatsLoop(ctx context.Context) {
 			}
 			return
 		case <-timer.C:
-			h.runStatisticsFlowJob(time.Now())
+			now := time.Now()
+			h.runStatisticsFlowJob(now)
+			h.runNodeMetricsRetentionJob(now)
+			h.runAccessLogRetentionJob(now)
 		}
 	}
 }
@@ -57,6 +57,11 @@ func (h *Handler) userCreate(w http.ResponseWriter, r *http.Request) {
 	num := asInt(req["num"], 10)
 	expTime := asInt64(req["expTime"], time.Now().Add(365*24*time.Hour).UnixMilli())
 	flowResetTime := asInt64(req["flowResetTime"], 1)
+	pool, _, err := parseBandwidthPoolInput(req, bandwidthPool{})
+	if err != nil {
+		response.WriteJSON(w, response.ErrDefault(err.Error()))
+		return
+	}
 	roleID := 1
 	now := time.Now().UnixMilli()
 
@@ -65,6 +70,12 @@ func (h *Handler) userCreate(w http.ResponseWriter, r *http.Request) {
 		response.WriteJSON(w, response.Err(-2, err.Error()))
 		return
 	}
+	if pool.enabled() {
+		if err := h.repo.UpdateUserBandwidth(userID, pool.Up, pool.Down, pool.Burst); err != nil {
+			response.WriteJSON(w, response.Err(-2, err.Error()))
+			return
+		}
+	}
 
 	groupIDs := asInt64Slice(req["groupIds"])
 	if len(groupIDs) > 0 {
@@ -128,6 +139,12 @@ func (h *Handler) userUpdate(w http.ResponseWriter, r *http.Request) {
 	expTime := asInt64(req["expTime"], time.Now().Add(365*24*time.Hour).UnixMilli())
 	flowResetTime := asInt64(req["flowResetTime"], 1)
 	status := asInt(req["status"], 1)
+	currentPool := h.userBandwidthPool(id)
+	pool, poolSet, err := parseBandwidthPoolInput(req, currentPool)
+	if err != nil {
+		response.WriteJSON(w, response.ErrDefault(err.Error()))
+		return
+	}
 	now := time.Now().UnixMilli()
 
 	pwd := asString(req["pwd"])
@@ -145,6 +162,14 @@ func (h *Handler) userUpdate(w http.ResponseWriter, r *http.Request) {
 
 	h.repo.PropagateUserFlowToTunnels(id, flow, num, expTime, flowResetTime)
 
+	if poolSet && pool != currentPool {
+		if err := h.repo.UpdateUserBandwidth(id, pool.Up, pool.Down, pool.Burst); err != nil {
+			response.WriteJSON(w, response.Err(-2, err.Error()))
+			return
+		}
+		h.syncUserBandwidthPool(id)
+	}
+
 	if groupIDsRaw, ok := req["groupIds"]; ok {
 		newGroupIDs := asInt64Slice(groupIDsRaw)
 		if affected, replaceErr := h.repo.ReplaceUserGroupsByUserID(id, newGroupIDs, now); replaceErr == nil {
@@ -370,7 +395,7 @@ func (h *Handler) nodeInstall(w http.ResponseWriter, r *http.Request) {
 	}
 
 	channel := normalizeReleaseChannel(req.Channel)
-	version, err := resolveLatestReleaseByChannel(channel)
+	version, err := h.resolveReleaseVersion(channel, true)
 	if err != nil {
 		response.WriteJSON(w, response.Err(-2, fmt.Sprintf("获取最新%s失败: %v", releaseChannelLabel(channel), err)))
 		return
@@ -391,6 +416,10 @@ func (h *Handler) nodeInstall(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	cmd := fmt.Sprintf("curl -L https://gcode.hostcentral.cc/https://github.com/Sagit-chu/flvx/releases/download/%s/install.sh -o ./install.sh && chmod +x ./install.sh && VERSION=%s ./install.sh -a %s -s %s", version, version, processServerAddress(panelAddr), secret)
+	if h.hasLocalArtifact(version, artifactInstallScript) && h.hasLocalAgentBinary(version) {
+		base := panelArtifactBaseURL(panelAddr, version)
+		cmd = fmt.Sprintf("curl -L %s/install.sh -o ./install.sh && chmod +x ./install.sh && DOWNLOAD_BASE=%s VERSION=%s ./install.sh -a %s -s %s", base, base, version, processServerAddress(panelAddr), secret)
+	}
 	response.WriteJSON(w, response.OK(cmd))
 }
 
@@ -474,6 +503,40 @@ func (h *Handler) tunnelCreate(w http.ResponseWriter, r *http.Request) {
 	trafficRatio := asFloat(req["trafficRatio"], 1.0)
 	inIP := asString(req["inIp"])
 	ipPreference := asString(req["ipPreference"])
+	healthCheck, _, err := parseHealthCheckInput(req, tunnelHealthCheckTypes)
+	if err != nil {
+		response.WriteJSON(w, response.ErrDefault(err.Error()))
+		return
+	}
+	chainMode, _, err := parseTunnelChainMode(req)
+	if err != nil {
+		response.WriteJSON(w, response.ErrDefault(err.Error()))
+		return
+	}
+	transportOptions, _, err := parseTunnelTransportInput(req)
+	if err != nil {
+		response.WriteJSON(w, response.ErrDefault(err.Error()))
+		return
+	}
+	accessRules, _, err := parseAccessRulesInput(req)
+	if err != nil {
+		response.WriteJSON(w, response.ErrDefault(err.Error()))
+		return
+	}
+	dnsPolicy, _, err := parseDNSPolicyInput(req)
+	if err != nil {
+		response.WriteJSON(w, response.ErrDefault(err.Error()))
+		return
+	}
+	if err := normalizeTunnelHopGroups(req); err != nil {
+		response.WriteJSON(w, response.ErrDefault(err.Error()))
+		return
+	}
+	relaySecret, err := generateTunnelRelaySecret()
+	if err != nil {
+		response.WriteJSON(w, response.Err(-2, err.Error()))
+		return
+	}
 	now := time.Now().UnixMilli()
 	inx := h.repo.NextIndex("tunnel")
 	localDomain := h.federationLocalDomain()
@@ -491,6 +554,14 @@ func (h *Handler) tunnelCreate(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	runtimeState.IPPreference = ipPreference
+	runtimeState.HealthCheck = decodeHealthCheck(healthCheck)
+	runtimeState.ChainMode = chainMode
+	runtimeState.RelaySecret = relaySecret
+	runtimeState.Transport = decodeTunnelTransportOptions(transportOptions)
+	if err := validateTunnelChainMode(runtimeState); err != nil {
+		response.WriteJSON(w, response.ErrDefault(err.Error()))
+		return
+	}
 	if strings.TrimSpace(inIP) == "" {
 		inIP = buildTunnelInIP(runtimeState.InNodes, runtimeState.Nodes, ipPreference)
 	}
@@ -559,6 +630,12 @@ func (h *Handler) tunnelCreate(w http.ResponseWriter, r *http.Request) {
 		InIP:         tunnelInIP,
 		Inx:          inx,
 		IPPreference: ipPreference,
+		HealthCheck:  sql.NullString{String: healthCheck, Valid: healthCheck != ""},
+		ChainMode:    chainMode,
+		RelaySecret:  relaySecret,
+		Transport:    sql.NullString{String: transportOptions, Valid: transportOptions != ""},
+		AccessRules:  sql.NullString{String: accessRules, Valid: accessRules != ""},
+		DNSPolicy:    sql.NullString{String: dnsPolicy, Valid: dnsPolicy != ""},
 	}
 	if err := tx.Create(&tunnel).Error; err != nil {
 		response.WriteJSON(w, response.Err(-2, err.Error()))
@@ -666,12 +743,57 @@ func (h *Handler) tunnelUpdate(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	h.cleanupTunnelRuntime(id)
-	h.cleanupFederationRuntime(id)
-
 	now := time.Now().UnixMilli()
 	typeVal := asInt(req["type"], 1)
 	ipPreference := asString(req["ipPreference"])
+	healthCheck, healthCheckSet, err := parseHealthCheckInput(req, tunnelHealthCheckTypes)
+	if err != nil {
+		response.WriteJSON(w, response.ErrDefault(err.Error()))
+		return
+	}
+	if !healthCheckSet {
+		healthCheck = h.repo.GetTunnelHealthCheck(id)
+	}
+	chainMode, chainModeSet, err := parseTunnelChainMode(req)
+	if err != nil {
+		response.WriteJSON(w, response.ErrDefault(err.Error()))
+		return
+	}
+	if !chainModeSet {
+		chainMode = h.repo.GetTunnelChainMode(id)
+	}
+	transportOptions, transportSet, err := parseTunnelTransportInput(req)
+	if err != nil {
+		response.WriteJSON(w, response.ErrDefault(err.Error()))
+		return
+	}
+	if !transportSet {
+		transportOptions = h.repo.GetTunnelTransportOptions(id)
+	}
+	accessRules, accessRulesSet, err := parseAccessRulesInput(req)
+	if err != nil {
+		response.WriteJSON(w, response.ErrDefault(err.Error()))
+		return
+	}
+	dnsPolicy, dnsPolicySet, err := parseDNSPolicyInput(req)
+	if err != nil {
+		response.WriteJSON(w, response.ErrDefault(err.Error()))
+		return
+	}
+	if err := normalizeTunnelHopGroups(req); err != nil {
+		response.WriteJSON(w, response.ErrDefault(err.Error()))
+		return
+	}
+	// Every update rebuilds this tunnel's services and chains, so it is the
+	// natural point to rotate the relay credential.
+	relaySecret, err := generateTunnelRelaySecret()
+	if err != nil {
+		response.WriteJSON(w, response.Err(-2, err.Error()))
+		return
+	}
+
+	h.cleanupTunnelRuntime(id)
+	h.cleanupFederationRuntime(id)
 	localDomain := h.federationLocalDomain()
 
 	tx := h.repo.BeginTx()
@@ -688,6 +810,14 @@ func (h *Handler) tunnelUpdate(w http.ResponseWriter, r *http.Request) {
 	}
 	runtimeState.TunnelID = id
 	runtimeState.IPPreference = ipPreference
+	runtimeState.HealthCheck = decodeHealthCheck(healthCheck)
+	runtimeState.ChainMode = chainMode
+	runtimeState.RelaySecret = relaySecret
+	runtimeState.Transport = decodeTunnelTransportOptions(transportOptions)
+	if err := validateTunnelChainMode(runtimeState); err != nil {
+		response.WriteJSON(w, response.ErrDefault(err.Error()))
+		return
+	}
 
 	inIp := buildTunnelInIP(runtimeState.InNodes, runtimeState.Nodes, ipPreference)
 
@@ -735,6 +865,40 @@ func (h *Handler) tunnelUpdate(w http.ResponseWriter, r *http.Request) {
 		response.WriteJSON(w, response.Err(-2, err.Error()))
 		return
 	}
+	if healthCheckSet {
+		if err := h.repo.UpdateTunnelHealthCheck(id, healthCheck); err != nil {
+			response.WriteJSON(w, response.Err(-2, err.Error()))
+			return
+		}
+	}
+	if chainModeSet {
+		if err := h.repo.UpdateTunnelChainMode(id, chainMode); err != nil {
+			response.WriteJSON(w, response.Err(-2, err.Error()))
+			return
+		}
+	}
+	if transportSet {
+		if err := h.repo.UpdateTunnelTransportOptions(id, transportOptions); err != nil {
+			response.WriteJSON(w, response.Err(-2, err.Error()))
+			return
+		}
+	}
+	if accessRulesSet {
+		if err := h.repo.UpdateTunnelAccessRules(id, accessRules); err != nil {
+			response.WriteJSON(w, response.Err(-2, err.Error()))
+			return
+		}
+	}
+	if dnsPolicySet {
+		if err := h.repo.UpdateTunnelDNSPolicy(id, dnsPolicy); err != nil {
+			response.WriteJSON(w, response.Err(-2, err.Error()))
+			return
+		}
+	}
+	if err := h.repo.UpdateTunnelRelaySecret(id, runtimeState.RelaySecret); err != nil {
+		response.WriteJSON(w, response.Err(-2, err.Error()))
+		return
+	}
 
 	if typeVal == 2 {
 		createdChains, createdServices, applyErr := h.applyTunnelRuntime(runtimeState)
@@ -783,11 +947,22 @@ func (h *Handler) tunnelDiagnose(w http.ResponseWriter, r *http.Request) {
 		response.WriteJSON(w, response.ErrDefault("请求失败"))
 		return
 	}
-	id := asInt64FromBodyKey(r, w, "tunnelId")
+	var req map[string]interface{}
+	if err := decodeJSON(r.Body, &req); err != nil {
+		response.WriteJSON(w, response.ErrDefault("请求参数错误"))
+		return
+	}
+	id := asInt64(req["tunnelId"], 0)
 	if id <= 0 {
+		response.WriteJSON(w, response.ErrDefault("参数错误"))
+		return
+	}
+	udp, err := parseUDPProbeInput(req)
+	if err != nil {
+		response.WriteJSON(w, response.ErrDefault(err.Error()))
 		return
 	}
-	result, err := h.diagnoseTunnelRuntime(id)
+	result, err := h.diagnoseTunnelRuntime(id, udp)
 	if err != nil {
 		if strings.Contains(err.Error(), "不存在") || strings.Contains(err.Error(), "不完整") {
 			response.WriteJSON(w, response.ErrDefault(err.Error()))
@@ -856,6 +1031,10 @@ func (h *Handler) reconstructTunnelState(tunnelID int64) (*tunnelCreateState, er
 		TunnelID:     tunnelID,
 		Type:         tunnel.Type,
 		IPPreference: ipPreference,
+		HealthCheck:  decodeHealthCheck(h.repo.GetTunnelHealthCheck(tunnelID)),
+		ChainMode:    h.repo.GetTunnelChainMode(tunnelID),
+		RelaySecret:  h.repo.GetTunnelRelaySecret(tunnelID),
+		Transport:    decodeTunnelTransportOptions(h.repo.GetTunnelTransportOptions(tunnelID)),
 		InNodes:      make([]tunnelRuntimeNode, 0),
 		ChainHops:    make([][]tunnelRuntimeNode, 0),
 		OutNodes:     make([]tunnelRuntimeNode, 0),
@@ -931,6 +1110,9 @@ func (h *Handler) redeployTunnelAndForwards(tunnelID int64) error {
 		if err != nil {
 			return err
 		}
+		if err := h.ensureTunnelRelaySecret(state); err != nil {
+			return err
+		}
 		federationBindings, federationReleaseRefs, fedErr := h.applyFederationRuntime(state, h.federationLocalDomain())
 		if fedErr != nil {
 			return fedErr
@@ -1004,8 +1186,12 @@ func (h *Handler) userTunnelBatchAssign(w http.ResponseWriter, r *http.Request)
 	var req struct {
 		UserID  int64 `json:"userId"`
 		Tunnels []struct {
-			TunnelID int64  `json:"tunnelId"`
-			SpeedID  *int64 `json:"speedId"`
+			TunnelID  int64  `json:"tunnelId"`
+			SpeedID   *int64 `json:"speedId"`
+			MaxConns  *int   `json:"maxConns"`
+			ConnRate  *int   `json:"connRate"`
+			IPSpeed   *int   `json:"ipSpeed"`
+			ConnSpeed *int   `json:"connSpeed"`
 		} `json:"tunnels"`
 	}
 	if err := decodeJSON(r.Body, &req); err != nil || req.UserID <= 0 {
@@ -1017,6 +1203,18 @@ func (h *Handler) userTunnelBatchAssign(w http.ResponseWriter, r *http.Request)
 		if t.SpeedID != nil {
 			m["speedId"] = *t.SpeedID
 		}
+		if t.MaxConns != nil {
+			m["maxConns"] = *t.MaxConns
+		}
+		if t.ConnRate != nil {
+			m["connRate"] = *t.ConnRate
+		}
+		if t.IPSpeed != nil {
+			m["ipSpeed"] = *t.IPSpeed
+		}
+		if t.ConnSpeed != nil {
+			m["connSpeed"] = *t.ConnSpeed
+		}
 		if err := h.upsertUserTunnel(m); err != nil {
 			response.WriteJSON(w, response.Err(-2, err.Error()))
 			return
@@ -1048,6 +1246,18 @@ func (h *Handler) userTunnelUpdate(w http.ResponseWriter, r *http.Request) {
 		response.WriteJSON(w, response.ErrDefault("权限ID不能为空"))
 		return
 	}
+	currentMaxConns, currentConnRate := h.repo.GetUserTunnelConnLimits(id)
+	maxConns, connRate, connLimitsSet, err := parseConnLimitsInput(req, currentMaxConns, currentConnRate)
+	if err != nil {
+		response.WriteJSON(w, response.ErrDefault(err.Error()))
+		return
+	}
+	currentIPSpeed, currentConnSpeed := h.repo.GetUserTunnelSpeedCaps(id)
+	ipSpeed, connSpeed, speedCapsSet, err := parseSpeedCapsInput(req, currentIPSpeed, currentConnSpeed)
+	if err != nil {
+		response.WriteJSON(w, response.ErrDefault(err.Error()))
+		return
+	}
 	if err := h.repo.UpdateUserTunnel(id,
 		asInt64(req["flow"], 0),
 		asInt(req["num"], 0),
@@ -1059,6 +1269,18 @@ func (h *Handler) userTunnelUpdate(w http.ResponseWriter, r *http.Request) {
 		response.WriteJSON(w, response.Err(-2, err.Error()))
 		return
 	}
+	if connLimitsSet {
+		if err := h.repo.UpdateUserTunnelConnLimits(id, maxConns, connRate); err != nil {
+			response.WriteJSON(w, response.Err(-2, err.Error()))
+			return
+		}
+	}
+	if speedCapsSet {
+		if err := h.repo.UpdateUserTunnelSpeedCaps(id, ipSpeed, connSpeed); err != nil {
+			response.WriteJSON(w, response.Err(-2, err.Error()))
+			return
+		}
+	}
 
 	userID, tunnelID, utErr := h.repo.GetUserTunnelUserAndTunnel(id)
 	if utErr == nil {
@@ -1099,17 +1321,95 @@ func (h *Handler) forwardCreate(w http.ResponseWriter, r *http.Request) {
 	}
 	name := asString(req["name"])
 	remoteAddr := asString(req["remoteAddr"])
+	targetsAddr, targetOptions, _, err := parseForwardTargetsInput(req)
+	if err != nil {
+		response.WriteJSON(w, response.ErrDefault(err.Error()))
+		return
+	}
+	if targetsAddr != "" {
+		remoteAddr = targetsAddr
+	}
 	if name == "" || remoteAddr == "" {
 		response.WriteJSON(w, response.ErrDefault("转发名称和目标地址不能为空"))
 		return
 	}
+	strategy, err := normalizeForwardStrategy(asString(req["strategy"]))
+	if err != nil {
+		response.WriteJSON(w, response.ErrDefault(err.Error()))
+		return
+	}
+	if err := validateForwardTargetWeights(strategy, targetOptions); err != nil {
+		response.WriteJSON(w, response.ErrDefault(err.Error()))
+		return
+	}
+	healthCheck, _, err := parseHealthCheckInput(req, forwardHealthCheckTypes)
+	if err != nil {
+		response.WriteJSON(w, response.ErrDefault(err.Error()))
+		return
+	}
+	maxConns, connRate, _, err := parseConnLimitsInput(req, 0, 0)
+	if err != nil {
+		response.WriteJSON(w, response.ErrDefault(err.Error()))
+		return
+	}
+	accessRules, _, err := parseAccessRulesInput(req)
+	if err != nil {
+		response.WriteJSON(w, response.ErrDefault(err.Error()))
+		return
+	}
+	proxyAccept, proxySend, _, err := parseProxyProtocolInput(req, 0, 0)
+	if err != nil {
+		response.WriteJSON(w, response.ErrDefault(err.Error()))
+		return
+	}
+	ipSpeed, connSpeed, _, err := parseSpeedCapsInput(req, 0, 0)
+	if err != nil {
+		response.WriteJSON(w, response.ErrDefault(err.Error()))
+		return
+	}
+	schedule, _, err := parseForwardScheduleInput(req)
+	if err != nil {
+		response.WriteJSON(w, response.ErrDefault(err.Error()))
+		return
+	}
+	accessLog, _, err := parseAccessLogInput(req)
+	if err != nil {
+		response.WriteJSON(w, response.ErrDefault(err.Error()))
+		return
+	}
+	muxHost, _, err := parseMuxHostInput(req)
+	if err != nil {
+		response.WriteJSON(w, response.ErrDefault(err.Error()))
+		return
+	}
+	portCount, _, err := parsePortCountInput(req)
+	if err != nil {
+		response.WriteJSON(w, response.ErrDefault(err.Error()))
+		return
+	}
+	dnsPolicy, _, err := parseDNSPolicyInput(req)
+	if err != nil {
+		response.WriteJSON(w, response.ErrDefault(err.Error()))
+		return
+	}
+	if muxHost != "" && portCount > 1 {
+		response.WriteJSON(w, response.ErrDefault("域名复用转发不支持端口段"))
+		return
+	}
 	port := asInt(req["inPort"], 0)
+	if port <= 0 && muxHost != "" {
+		port = h.pickMuxPort(userID, tunnelID)
+	}
 	if port <= 0 {
-		port = h.pickTunnelPort(tunnelID)
+		port = h.pickTunnelPortRange(tunnelID, portCount)
 	}
 	if port <= 0 {
 		port = 10000
 	}
+	if err := validateForwardPortRange(port, portCount, remoteAddr); err != nil {
+		response.WriteJSON(w, response.ErrDefault(err.Error()))
+		return
+	}
 	entryNodes, _ := h.tunnelEntryNodeIDs(tunnelID)
 	for _, nodeID := range entryNodes {
 		node, nodeErr := h.getNodeRecord(nodeID)
@@ -1120,6 +1420,22 @@ func (h *Handler) forwardCreate(w http.ResponseWriter, r *http.Request) {
 			response.WriteJSON(w, response.ErrDefault(err.Error()))
 			return
 		}
+		if err := h.validatePortRangeOnNode(node, 0, port, portCount); err != nil {
+			response.WriteJSON(w, response.ErrDefault(err.Error()))
+			return
+		}
+		if err := h.validateMuxPort(0, userID, tunnelID, nodeID, port, muxHost); err != nil {
+			response.WriteJSON(w, response.ErrDefault(err.Error()))
+			return
+		}
+		if err := validateNodeCapabilities(node, forwardEntryRequirement()); err != nil {
+			response.WriteJSON(w, response.ErrDefault(err.Error()))
+			return
+		}
+		if err := validateNodePlacement(node); err != nil {
+			response.WriteJSON(w, response.ErrDefault(err.Error()))
+			return
+		}
 	}
 	now := time.Now().UnixMilli()
 	inx := h.repo.NextIndex("forward")
@@ -1127,17 +1443,97 @@ func (h *Handler) forwardCreate(w http.ResponseWriter, r *http.Request) {
 	if userName == "" {
 		userName = "user"
 	}
-	forwardID, err := h.repo.CreateForwardTx(userID, userName, name, tunnelID, remoteAddr, defaultString(asString(req["strategy"]), "fifo"), now, inx, entryNodes, port)
+	forwardID, err := h.repo.CreateForwardTx(userID, userName, name, tunnelID, remoteAddr, strategy, now, inx, entryNodes, port)
 	if err != nil {
 		response.WriteJSON(w, response.Err(-2, err.Error()))
 		return
 	}
+	if healthCheck != "" {
+		if err := h.repo.UpdateForwardHealthCheck(forwardID, healthCheck); err != nil {
+			_ = h.deleteForwardByID(forwardID)
+			response.WriteJSON(w, response.Err(-2, err.Error()))
+			return
+		}
+	}
+	if targetOptions != "" {
+		if err := h.repo.UpdateForwardTargetOptions(forwardID, targetOptions); err != nil {
+			_ = h.deleteForwardByID(forwardID)
+			response.WriteJSON(w, response.Err(-2, err.Error()))
+			return
+		}
+	}
+	if maxConns > 0 || connRate > 0 {
+		if err := h.repo.UpdateForwardConnLimits(forwardID, maxConns, connRate); err != nil {
+			_ = h.deleteForwardByID(forwardID)
+			response.WriteJSON(w, response.Err(-2, err.Error()))
+			return
+		}
+	}
+	if accessRules != "" {
+		if err := h.repo.UpdateForwardAccessRules(forwardID, accessRules); err != nil {
+			_ = h.deleteForwardByID(forwardID)
+			response.WriteJSON(w, response.Err(-2, err.Error()))
+			return
+		}
+	}
+	if proxyAccept > 0 || proxySend > 0 {
+		if err := h.repo.UpdateForwardProxyProtocol(forwardID, proxyAccept, proxySend); err != nil {
+			_ = h.deleteForwardByID(forwardID)
+			response.WriteJSON(w, response.Err(-2, err.Error()))
+			return
+		}
+	}
+	if ipSpeed > 0 || connSpeed > 0 {
+		if err := h.repo.UpdateForwardSpeedCaps(forwardID, ipSpeed, connSpeed); err != nil {
+			_ = h.deleteForwardByID(forwardID)
+			response.WriteJSON(w, response.Err(-2, err.Error()))
+			return
+		}
+	}
+	if schedule != "" {
+		if err := h.repo.UpdateForwardSchedule(forwardID, schedule); err != nil {
+			_ = h.deleteForwardByID(forwardID)
+			response.WriteJSON(w, response.Err(-2, err.Error()))
+			return
+		}
+	}
+	if accessLog == 1 {
+		if err := h.repo.UpdateForwardAccessLog(forwardID, accessLog); err != nil {
+			_ = h.deleteForwardByID(forwardID)
+			response.WriteJSON(w, response.Err(-2, err.Error()))
+			return
+		}
+	}
+	if muxHost != "" {
+		if err := h.repo.UpdateForwardMuxHost(forwardID, muxHost); err != nil {
+			_ = h.deleteForwardByID(forwardID)
+			response.WriteJSON(w, response.Err(-2, err.Error()))
+			return
+		}
+	}
+	if portCount > 1 {
+		if err := h.repo.UpdateForwardPortCount(forwardID, portCount); err != nil {
+			_ = h.deleteForwardByID(forwardID)
+			response.WriteJSON(w, response.Err(-2, err.Error()))
+			return
+		}
+	}
+	if dnsPolicy != "" {
+		if err := h.repo.UpdateForwardDNSPolicy(forwardID, dnsPolicy); err != nil {
+			_ = h.deleteForwardByID(forwardID)
+			response.WriteJSON(w, response.Err(-2, err.Error()))
+			return
+		}
+	}
 	createdForward, err := h.getForwardRecord(forwardID)
 	if err != nil {
 		response.WriteJSON(w, response.Err(-2, err.Error()))
 		return
 	}
 	if err := h.syncForwardServices(createdForward, "AddService", false); err != nil {
+		if createdForward.MuxHost != "" {
+			_ = h.syncMuxForward(createdForward, false)
+		}
 		_ = h.deleteForwardByID(forwardID)
 		response.WriteJSON(w, response.ErrDefault(err.Error()))
 		return
@@ -1195,6 +1591,14 @@ func (h *Handler) forwardUpdate(w http.ResponseWriter, r *http.Request) {
 		name = forward.Name
 	}
 	remoteAddr := strings.TrimSpace(asString(req["remoteAddr"]))
+	targetsAddr, targetOptions, targetsSet, err := parseForwardTargetsInput(req)
+	if err != nil {
+		response.WriteJSON(w, response.ErrDefault(err.Error()))
+		return
+	}
+	if targetsSet {
+		remoteAddr = targetsAddr
+	}
 	if remoteAddr == "" {
 		remoteAddr = forward.RemoteAddr
 	}
@@ -1202,6 +1606,78 @@ func (h *Handler) forwardUpdate(w http.ResponseWriter, r *http.Request) {
 	if strategy == "" {
 		strategy = forward.Strategy
 	}
+	if strategy, err = normalizeForwardStrategy(strategy); err != nil {
+		response.WriteJSON(w, response.ErrDefault(err.Error()))
+		return
+	}
+	effectiveOptions := forward.TargetOptions
+	if targetsSet {
+		effectiveOptions = targetOptions
+	}
+	if err := validateForwardTargetWeights(strategy, effectiveOptions); err != nil {
+		response.WriteJSON(w, response.ErrDefault(err.Error()))
+		return
+	}
+	healthCheck, healthCheckSet, err := parseHealthCheckInput(req, forwardHealthCheckTypes)
+	if err != nil {
+		response.WriteJSON(w, response.ErrDefault(err.Error()))
+		return
+	}
+	maxConns, connRate, connLimitsSet, err := parseConnLimitsInput(req, forward.MaxConns, forward.ConnRate)
+	if err != nil {
+		response.WriteJSON(w, response.ErrDefault(err.Error()))
+		return
+	}
+	accessRules, accessRulesSet, err := parseAccessRulesInput(req)
+	if err != nil {
+		response.WriteJSON(w, response.ErrDefault(err.Error()))
+		return
+	}
+	proxyAccept, proxySend, proxyProtocolSet, err := parseProxyProtocolInput(req, forward.ProxyAccept, forward.ProxySend)
+	if err != nil {
+		response.WriteJSON(w, response.ErrDefault(err.Error()))
+		return
+	}
+	ipSpeed, connSpeed, speedCapsSet, err := parseSpeedCapsInput(req, forward.IPSpeed, forward.ConnSpeed)
+	if err != nil {
+		response.WriteJSON(w, response.ErrDefault(err.Error()))
+		return
+	}
+	schedule, scheduleSet, err := parseForwardScheduleInput(req)
+	if err != nil {
+		response.WriteJSON(w, response.ErrDefault(err.Error()))
+		return
+	}
+	accessLog, accessLogSet, err := parseAccessLogInput(req)
+	if err != nil {
+		response.WriteJSON(w, response.ErrDefault(err.Error()))
+		return
+	}
+	muxHost, muxHostSet, err := parseMuxHostInput(req)
+	if err != nil {
+		response.WriteJSON(w, response.ErrDefault(err.Error()))
+		return
+	}
+	if !muxHostSet {
+		muxHost = forward.MuxHost
+	}
+	portCount, portCountSet, err := parsePortCountInput(req)
+	if err != nil {
+		response.WriteJSON(w, response.ErrDefault(err.Error()))
+		return
+	}
+	if !portCountSet {
+		portCount = forwardPortCount(forward)
+	}
+	dnsPolicy, dnsPolicySet, err := parseDNSPolicyInput(req)
+	if err != nil {
+		response.WriteJSON(w, response.ErrDefault(err.Error()))
+		return
+	}
+	if muxHost != "" && portCount > 1 {
+		response.WriteJSON(w, response.ErrDefault("域名复用转发不支持端口段"))
+		return
+	}
 
 	port := asInt(req["inPort"], 0)
 	if port <= 0 {
@@ -1210,9 +1686,13 @@ func (h *Handler) forwardUpdate(w http.ResponseWriter, r *http.Request) {
 			port = int(minPort.Int64)
 		}
 		if port <= 0 {
-			port = h.pickTunnelPort(tunnelID)
+			port = h.pickTunnelPortRange(tunnelID, portCount)
 		}
 	}
+	if err := validateForwardPortRange(port, portCount, remoteAddr); err != nil {
+		response.WriteJSON(w, response.ErrDefault(err.Error()))
+		return
+	}
 	fwdEntryNodes, _ := h.tunnelEntryNodeIDs(tunnelID)
 	for _, nodeID := range fwdEntryNodes {
 		node, nodeErr := h.getNodeRecord(nodeID)
@@ -1223,12 +1703,103 @@ func (h *Handler) forwardUpdate(w http.ResponseWriter, r *http.Request) {
 			response.WriteJSON(w, response.ErrDefault(err.Error()))
 			return
 		}
+		if err := h.validatePortRangeOnNode(node, id, port, portCount); err != nil {
+			response.WriteJSON(w, response.ErrDefault(err.Error()))
+			return
+		}
+		if err := h.validateMuxPort(id, forward.UserID, tunnelID, nodeID, port, muxHost); err != nil {
+			response.WriteJSON(w, response.ErrDefault(err.Error()))
+			return
+		}
+		if tunnelID != forward.TunnelID {
+			if err := validateNodePlacement(node); err != nil {
+				response.WriteJSON(w, response.ErrDefault(err.Error()))
+				return
+			}
+		}
 	}
 	now := time.Now().UnixMilli()
 	if err := h.repo.UpdateForward(id, name, tunnelID, remoteAddr, strategy, now); err != nil {
 		response.WriteJSON(w, response.Err(-2, err.Error()))
 		return
 	}
+	if healthCheckSet {
+		if err := h.repo.UpdateForwardHealthCheck(id, healthCheck); err != nil {
+			h.rollbackForwardMutation(forward, oldPorts)
+			response.WriteJSON(w, response.Err(-2, err.Error()))
+			return
+		}
+	}
+	if targetsSet {
+		if err := h.repo.UpdateForwardTargetOptions(id, targetOptions); err != nil {
+			h.rollbackForwardMutation(forward, oldPorts)
+			response.WriteJSON(w, response.Err(-2, err.Error()))
+			return
+		}
+	}
+	if connLimitsSet {
+		if err := h.repo.UpdateForwardConnLimits(id, maxConns, connRate); err != nil {
+			h.rollbackForwardMutation(forward, oldPorts)
+			response.WriteJSON(w, response.Err(-2, err.Error()))
+			return
+		}
+	}
+	if accessRulesSet {
+		if err := h.repo.UpdateForwardAccessRules(id, accessRules); err != nil {
+			h.rollbackForwardMutation(forward, oldPorts)
+			response.WriteJSON(w, response.Err(-2, err.Error()))
+			return
+		}
+	}
+	if proxyProtocolSet {
+		if err := h.repo.UpdateForwardProxyProtocol(id, proxyAccept, proxySend); err != nil {
+			h.rollbackForwardMutation(forward, oldPorts)
+			response.WriteJSON(w, response.Err(-2, err.Error()))
+			return
+		}
+	}
+	if speedCapsSet {
+		if err := h.repo.UpdateForwardSpeedCaps(id, ipSpeed, connSpeed); err != nil {
+			h.rollbackForwardMutation(forward, oldPorts)
+			response.WriteJSON(w, response.Err(-2, err.Error()))
+			return
+		}
+	}
+	if scheduleSet {
+		if err := h.repo.UpdateForwardSchedule(id, schedule); err != nil {
+			h.rollbackForwardMutation(forward, oldPorts)
+			response.WriteJSON(w, response.Err(-2, err.Error()))
+			return
+		}
+	}
+	if accessLogSet {
+		if err := h.repo.UpdateForwardAccessLog(id, accessLog); err != nil {
+			h.rollbackForwardMutation(forward, oldPorts)
+			response.WriteJSON(w, response.Err(-2, err.Error()))
+			return
+		}
+	}
+	if muxHostSet {
+		if err := h.repo.UpdateForwardMuxHost(id, muxHost); err != nil {
+			h.rollbackForwardMutation(forward, oldPorts)
+			response.WriteJSON(w, response.Err(-2, err.Error()))
+			return
+		}
+	}
+	if portCountSet {
+		if err := h.repo.UpdateForwardPortCount(id, portCount); err != nil {
+			h.rollbackForwardMutation(forward, oldPorts)
+			response.WriteJSON(w, response.Err(-2, err.Error()))
+			return
+		}
+	}
+	if dnsPolicySet {
+		if err := h.repo.UpdateForwardDNSPolicy(id, dnsPolicy); err != nil {
+			h.rollbackForwardMutation(forward, oldPorts)
+			response.WriteJSON(w, response.Err(-2, err.Error()))
+			return
+		}
+	}
 	if err := h.replaceForwardPorts(id, tunnelID, port); err != nil {
 		h.rollbackForwardMutation(forward, oldPorts)
 		response.WriteJSON(w, response.Err(-2, err.Error()))
@@ -1240,7 +1811,16 @@ func (h *Handler) forwardUpdate(w http.ResponseWriter, r *http.Request) {
 		response.WriteJSON(w, response.Err(-2, err.Error()))
 		return
 	}
+	if forward.MuxHost != "" || updatedForward.MuxHost != "" {
+		h.releaseMuxListeners(forward, oldPorts, updatedForward)
+	}
+	h.releaseForwardPortRange(forward, oldPorts, updatedForward)
 	if err := h.syncForwardServices(updatedForward, "UpdateService", true); err != nil {
+		if updatedForward.MuxHost != "" {
+			if newPorts, listErr := h.listForwardPorts(id); listErr == nil {
+				h.releaseMuxListeners(updatedForward, newPorts, forward)
+			}
+		}
 		h.rollbackForwardMutation(forward, oldPorts)
 		response.WriteJSON(w, response.ErrDefault(err.Error()))
 		return
@@ -1322,8 +1902,23 @@ func (h *Handler) forwardResume(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *Handler) forwardDiagnose(w http.ResponseWriter, r *http.Request) {
-	id := asInt64FromBodyKey(r, w, "forwardId")
+	if r.Method != http.MethodPost {
+		response.WriteJSON(w, response.ErrDefault("请求失败"))
+		return
+	}
+	var req map[string]interface{}
+	if err := decodeJSON(r.Body, &req); err != nil {
+		response.WriteJSON(w, response.ErrDefault("请求参数错误"))
+		return
+	}
+	id := asInt64(req["forwardId"], 0)
 	if id <= 0 {
+		response.WriteJSON(w, response.ErrDefault("参数错误"))
+		return
+	}
+	udp, err := parseUDPProbeInput(req)
+	if err != nil {
+		response.WriteJSON(w, response.ErrDefault(err.Error()))
 		return
 	}
 	forward, _, _, err := h.resolveForwardAccess(r, id)
@@ -1335,7 +1930,7 @@ func (h *Handler) forwardDiagnose(w http.ResponseWriter, r *http.Request) {
 		response.WriteJSON(w, response.Err(-2, err.Error()))
 		return
 	}
-	payload, err := h.diagnoseForwardRuntime(forward)
+	payload, err := h.diagnoseForwardRuntime(forward, udp)
 	if err != nil {
 		if strings.Contains(err.Error(), "不存在") || strings.Contains(err.Error(), "不能为空") || strings.Contains(err.Error(), "错误") {
 			response.WriteJSON(w, response.ErrDefault(err.Error()))
@@ -1541,7 +2136,7 @@ func (h *Handler) forwardBatchChangeTunnel(w http.ResponseWriter, r *http.Reques
 			p = int(port.Int64)
 		}
 		if p <= 0 {
-			p = h.pickTunnelPort(req.TargetTunnelID)
+			p = h.pickTunnelPortRange(req.TargetTunnelID, forwardPortCount(forward))
 		}
 		bctEntryNodes, _ := h.tunnelEntryNodeIDs(req.TargetTunnelID)
 		portRangeOk := true
@@ -1550,7 +2145,7 @@ func (h *Handler) forwardBatchChangeTunnel(w http.ResponseWriter, r *http.Reques
 			if ndErr != nil {
 				continue
 			}
-			if validateRemoteNodePort(nd, p) != nil {
+			if validateRemoteNodePort(nd, p) != nil || validateNodePlacement(nd) != nil || h.validatePortRangeOnNode(nd, id, p, forwardPortCount(forward)) != nil {
 				portRangeOk = false
 				break
 			}
@@ -1601,6 +2196,11 @@ func (h *Handler) speedLimitCreate(w http.ResponseWriter, r *http.Request) {
 		response.WriteJSON(w, response.ErrDefault("隧道不存在"))
 		return
 	}
+	profiles, _, err := parseSpeedProfilesInput(req)
+	if err != nil {
+		response.WriteJSON(w, response.ErrDefault(err.Error()))
+		return
+	}
 	now := time.Now().UnixMilli()
 	speed := asInt(req["speed"], 100)
 	id, err := h.repo.CreateSpeedLimit(name, speed, tunnelID, tunnelName, now, asInt(req["status"], 1))
@@ -1608,7 +2208,13 @@ func (h *Handler) speedLimitCreate(w http.ResponseWriter, r *http.Request) {
 		response.WriteJSON(w, response.Err(-2, err.Error()))
 		return
 	}
-	_ = h.sendLimiterConfig(id, speed, tunnelID)
+	if profiles != "" {
+		if err := h.repo.UpdateSpeedLimitProfiles(id, profiles); err != nil {
+			response.WriteJSON(w, response.Err(-2, err.Error()))
+			return
+		}
+	}
+	_ = h.sendLimiterConfig(id, speedProfilesAt(profiles, speed, time.Now()), tunnelID)
 	response.WriteJSON(w, response.OKEmpty())
 }
 
@@ -1629,12 +2235,26 @@ func (h *Handler) speedLimitUpdate(w http.ResponseWriter, r *http.Request) {
 		response.WriteJSON(w, response.ErrDefault("隧道不存在"))
 		return
 	}
+	profiles, profilesSet, err := parseSpeedProfilesInput(req)
+	if err != nil {
+		response.WriteJSON(w, response.ErrDefault(err.Error()))
+		return
+	}
 	speed := asInt(req["speed"], 100)
 	if err := h.repo.UpdateSpeedLimit(id, asString(req["name"]), speed, tunnelID, tunnelName, asInt(req["status"], 1), time.Now().UnixMilli()); err != nil {
 		response.WriteJSON(w, response.Err(-2, err.Error()))
 		return
 	}
-	_ = h.sendLimiterConfig(id, speed, tunnelID)
+	if profilesSet {
+		if err := h.repo.UpdateSpeedLimitProfiles(id, profiles); err != nil {
+			response.WriteJSON(w, response.Err(-2, err.Error()))
+			return
+		}
+	} else {
+		profiles = h.repo.GetSpeedLimitProfiles(id)
+	}
+	h.forgetScheduledSpeed(id)
+	_ = h.sendLimiterConfig(id, speedProfilesAt(profiles, speed, time.Now()), tunnelID)
 	response.WriteJSON(w, response.OKEmpty())
 }
 
@@ -1898,6 +2518,10 @@ type tunnelCreateState struct {
 	TunnelID     int64
 	Type         int
 	IPPreference string // "" = auto, "v4" = prefer IPv4, "v6" = prefer IPv6
+	HealthCheck  *healthCheckConfig
+	ChainMode    string
+	RelaySecret  string
+	Transport    *tunnelTransportOptions
 	InNodes      []tunnelRuntimeNode
 	ChainHops    [][]tunnelRuntimeNode
 	OutNodes     []tunnelRuntimeNode
@@ -1921,9 +2545,13 @@ func (h *Handler) prepareTunnelCreateState(tx *gorm.DB, req map[string]interface
 			continue
 		}
 		nodeIDs = append(nodeIDs, nodeID)
+		protocol, err := normalizeTunnelProtocol(asString(item["protocol"]))
+		if err != nil {
+			return nil, err
+		}
 		state.InNodes = append(state.InNodes, tunnelRuntimeNode{
 			NodeID:    nodeID,
-			Protocol:  defaultString(asString(item["protocol"]), "tls"),
+			Protocol:  protocol,
 			Strategy:  defaultString(asString(item["strategy"]), "round"),
 			ChainType: 1,
 		})
@@ -1945,6 +2573,10 @@ func (h *Handler) prepareTunnelCreateState(tx *gorm.DB, req map[string]interface
 				continue
 			}
 			nodeIDs = append(nodeIDs, nodeID)
+			protocol, err := normalizeTunnelProtocol(asString(item["protocol"]))
+			if err != nil {
+				return nil, err
+			}
 			port := asInt(item["port"], 0)
 			if port <= 0 {
 				isRemote, remoteErr := h.repo.IsRemoteNodeTx(tx, nodeID)
@@ -1961,7 +2593,7 @@ func (h *Handler) prepareTunnelCreateState(tx *gorm.DB, req map[string]interface
 			}
 			state.OutNodes = append(state.OutNodes, tunnelRuntimeNode{
 				NodeID:    nodeID,
-				Protocol:  defaultString(asString(item["protocol"]), "tls"),
+				Protocol:  protocol,
 				Strategy:  defaultString(asString(item["strategy"]), "round"),
 				ChainType: 3,
 				Port:      port,
@@ -1979,6 +2611,10 @@ func (h *Handler) prepareTunnelCreateState(tx *gorm.DB, req map[string]interface
 					continue
 				}
 				nodeIDs = append(nodeIDs, nodeID)
+				protocol, err := normalizeTunnelProtocol(asString(item["protocol"]))
+				if err != nil {
+					return nil, err
+				}
 				port := asInt(item["port"], 0)
 				if port <= 0 {
 					isRemote, remoteErr := h.repo.IsRemoteNodeTx(tx, nodeID)
@@ -1995,7 +2631,7 @@ func (h *Handler) prepareTunnelCreateState(tx *gorm.DB, req map[string]interface
 				}
 				hop = append(hop, tunnelRuntimeNode{
 					NodeID:    nodeID,
-					Protocol:  defaultString(asString(item["protocol"]), "tls"),
+					Protocol:  protocol,
 					Strategy:  defaultString(asString(item["strategy"]), "round"),
 					Inx:       hopIdx + 1,
 					ChainType: 2,
@@ -2043,6 +2679,9 @@ func (h *Handler) prepareTunnelCreateState(tx *gorm.DB, req map[string]interface
 			}
 		}
 	}
+	if err := validateTunnelCapabilities(state); err != nil {
+		return nil, err
+	}
 
 	return state, nil
 }
@@ -2194,13 +2833,15 @@ func (h *Handler) applyFederationRuntime(state *tunnelCreateState, localDomain s
 		outNode = state.OutNodes[outIdx]
 
 		applyReq := client.RuntimeApplyRoleRequest{
-			ReservationID: reserveRes.ReservationID,
-			ResourceKey:   resourceKey,
-			Role:          "exit",
-			Protocol:      defaultString(outNode.Protocol, "tls"),
-			Strategy:      defaultString(outNode.Strategy, "round"),
-		}
-		applyRes, err := fc.ApplyRole(remoteURL, remoteToken, localDomain, applyReq)
+			ReservationID:    reserveRes.ReservationID,
+			ResourceKey:      resourceKey,
+			Role:             "exit",
+			Protocol:         defaultString(outNode.Protocol, "tls"),
+			Strategy:         defaultString(outNode.Strategy, "round"),
+			Auth:             state.federationRelayAuth(),
+			TransportOptions: state.federationTransportOptions(),
+		}
+		applyRes, err := applyFederationRole(fc, remoteURL, remoteToken, localDomain, applyReq)
 		if err != nil {
 			h.releaseFederationRuntimeRefs(releaseRefs)
 			return nil, nil, fmt.Errorf("远程节点 %s 运行时下发失败: %w", nodeDisplayName(node), err)
@@ -2293,14 +2934,16 @@ func (h *Handler) applyFederationRuntime(state *tunnelCreateState, localDomain s
 			}
 
 			applyReq := client.RuntimeApplyRoleRequest{
-				ReservationID: reserveRes.ReservationID,
-				ResourceKey:   resourceKey,
-				Role:          "middle",
-				Protocol:      defaultString(chainNode.Protocol, "tls"),
-				Strategy:      defaultString(chainNode.Strategy, "round"),
-				Targets:       applyTargets,
+				ReservationID:    reserveRes.ReservationID,
+				ResourceKey:      resourceKey,
+				Role:             "middle",
+				Protocol:         defaultString(chainNode.Protocol, "tls"),
+				Strategy:         defaultString(chainNode.Strategy, "round"),
+				Targets:          applyTargets,
+				Auth:             state.federationRelayAuth(),
+				TransportOptions: state.federationTransportOptions(),
 			}
-			applyRes, err := fc.ApplyRole(remoteURL, remoteToken, localDomain, applyReq)
+			applyRes, err := applyFederationRole(fc, remoteURL, remoteToken, localDomain, applyReq)
 			if err != nil {
 				h.releaseFederationRuntimeRefs(releaseRefs)
 				return nil, nil, fmt.Errorf("远程节点 %s 运行时下发失败: %w", nodeDisplayName(node), err)
@@ -2401,11 +3044,7 @@ func (h *Handler) applyTunnelRuntime(state *tunnelCreateState) ([]int64, []int64
 
 	for _, inNode := range state.InNodes {
 		node := state.Nodes[inNode.NodeID]
-		targets := state.OutNodes
-		if len(state.ChainHops) > 0 {
-			targets = state.ChainHops[0]
-		}
-		chainData, err := buildTunnelChainConfig(state.TunnelID, inNode.NodeID, targets, state.Nodes, state.IPPreference)
+		chainData, err := buildTunnelEntryChainConfig(state, inNode.NodeID)
 		if err != nil {
 			return createdChains, createdServices, err
 		}
@@ -2427,16 +3066,18 @@ func (h *Handler) applyTunnelRuntime(state *tunnelCreateState) ([]int64, []int64
 			if node := state.Nodes[chainNode.NodeID]; node != nil && node.IsRemote == 1 {
 				continue
 			}
-			chainData, err := buildTunnelChainConfig(state.TunnelID, chainNode.NodeID, nextTargets, state.Nodes, state.IPPreference)
-			if err != nil {
-				return createdChains, createdServices, err
-			}
-			if _, err := h.sendNodeCommand(chainNode.NodeID, "AddChains", chainData, true, false); err != nil {
-				return createdChains, createdServices, fmt.Errorf("转发链节点 %s 下发转发链失败: %w", nodeDisplayName(state.Nodes[chainNode.NodeID]), err)
+			if state.hopNodesRunChains() {
+				chainData, err := buildTunnelChainConfig(state, chainNode.NodeID, activeTunnelTargets(nextTargets, state.Nodes))
+				if err != nil {
+					return createdChains, createdServices, err
+				}
+				if _, err := h.sendNodeCommand(chainNode.NodeID, "AddChains", chainData, true, false); err != nil {
+					return createdChains, createdServices, fmt.Errorf("转发链节点 %s 下发转发链失败: %w", nodeDisplayName(state.Nodes[chainNode.NodeID]), err)
+				}
+				createdChains = append(createdChains, chainNode.NodeID)
 			}
-			createdChains = append(createdChains, chainNode.NodeID)
 
-			serviceData := buildTunnelChainServiceConfig(state.TunnelID, chainNode, state.Nodes[chainNode.NodeID])
+			serviceData := buildTunnelChainServiceConfig(state, chainNode, state.hopNodesRunChains())
 			if _, err := h.sendNodeCommand(chainNode.NodeID, "AddService", serviceData, true, false); err != nil {
 				return createdChains, createdServices, fmt.Errorf("转发链节点 %s 下发服务失败: %w", nodeDisplayName(state.Nodes[chainNode.NodeID]), err)
 			}
@@ -2448,7 +3089,7 @@ func (h *Handler) applyTunnelRuntime(state *tunnelCreateState) ([]int64, []int64
 		if node := state.Nodes[outNode.NodeID]; node != nil && node.IsRemote == 1 {
 			continue
 		}
-		serviceData := buildTunnelChainServiceConfig(state.TunnelID, outNode, state.Nodes[outNode.NodeID])
+		serviceData := buildTunnelChainServiceConfig(state, outNode, false)
 		if _, err := h.sendNodeCommand(outNode.NodeID, "AddService", serviceData, true, false); err != nil {
 			return createdChains, createdServices, fmt.Errorf("出口节点 %s 下发服务失败: %w", nodeDisplayName(state.Nodes[outNode.NodeID]), err)
 		}
@@ -2502,69 +3143,35 @@ func shouldDeferTunnelRuntimeApplyError(err error) bool {
 	return false
 }
 
-func buildTunnelChainConfig(tunnelID int64, fromNodeID int64, targets []tunnelRuntimeNode, nodes map[int64]*nodeRecord, ipPreference string) (map[string]interface{}, error) {
-	fromNode := nodes[fromNodeID]
+// buildTunnelChainConfig builds the single-hop chains_<id> a node uses to
+// dial targets of the tunnel described by state.
+func buildTunnelChainConfig(state *tunnelCreateState, fromNodeID int64, targets []tunnelRuntimeNode) (map[string]interface{}, error) {
+	fromNode := state.Nodes[fromNodeID]
 	if fromNode == nil {
 		return nil, errors.New("节点不存在")
 	}
-	if len(targets) == 0 {
-		return nil, errors.New("转发链目标不能为空")
-	}
-	nodeItems := make([]map[string]interface{}, 0, len(targets))
-	for idx, target := range targets {
-		targetNode := nodes[target.NodeID]
-		if targetNode == nil {
-			return nil, errors.New("节点不存在")
-		}
-		host, err := selectTunnelDialHost(fromNode, targetNode, ipPreference)
-		if err != nil {
-			return nil, err
-		}
-		port := target.Port
-		if port <= 0 {
-			return nil, errors.New("节点端口不能为空")
-		}
-		protocol := defaultString(target.Protocol, "tls")
-		connector := map[string]interface{}{
-			"type": "relay",
-		}
-		if isTLSTunnelProtocol(protocol) {
-			connector["metadata"] = map[string]interface{}{"nodelay": true}
-		}
-		nodeItems = append(nodeItems, map[string]interface{}{
-			"name":      fmt.Sprintf("node_%d", idx+1),
-			"addr":      processServerAddress(fmt.Sprintf("%s:%d", host, port)),
-			"connector": connector,
-			"dialer": map[string]interface{}{
-				"type": protocol,
-			},
-		})
-	}
-
-	strategy := defaultString(strings.TrimSpace(targets[0].Strategy), "round")
-	hop := map[string]interface{}{
-		"name": fmt.Sprintf("hop_%d", tunnelID),
-		"selector": map[string]interface{}{
-			"strategy":    strategy,
-			"maxFails":    1,
-			"failTimeout": int64(600000000000),
-		},
-		"nodes": nodeItems,
+	hop, err := buildTunnelHop(state, fmt.Sprintf("hop_%d", state.TunnelID), []*nodeRecord{fromNode}, targets, true)
+	if err != nil {
+		return nil, err
 	}
 	if strings.TrimSpace(fromNode.InterfaceName) != "" {
 		hop["interface"] = fromNode.InterfaceName
 	}
 
 	return map[string]interface{}{
-		"name": fmt.Sprintf("chains_%d", tunnelID),
+		"name": fmt.Sprintf("chains_%d", state.TunnelID),
 		"hops": []map[string]interface{}{hop},
 	}, nil
 }
 
-func buildTunnelChainServiceConfig(tunnelID int64, chainNode tunnelRuntimeNode, node *nodeRecord) []map[string]interface{} {
+// buildTunnelChainServiceConfig builds the <id>_tls relay a hop or exit node
+// of the tunnel runs; withChain makes a hop node forward through chains_<id>.
+func buildTunnelChainServiceConfig(state *tunnelCreateState, chainNode tunnelRuntimeNode, withChain bool) []map[string]interface{} {
+	node := state.Nodes[chainNode.NodeID]
 	if node == nil {
 		return nil
 	}
+	tunnelID := state.TunnelID
 	protocol := defaultString(chainNode.Protocol, "tls")
 	handlerCfg := map[string]interface{}{
 		"type": "relay",
@@ -2572,15 +3179,16 @@ func buildTunnelChainServiceConfig(tunnelID int64, chainNode tunnelRuntimeNode,
 	if isTLSTunnelProtocol(protocol) {
 		handlerCfg["metadata"] = map[string]interface{}{"nodelay": true}
 	}
+	if relayAuth := state.relayAuth(); relayAuth != nil {
+		handlerCfg["auth"] = relayAuth
+	}
 	service := map[string]interface{}{
-		"name":    fmt.Sprintf("%d_tls", tunnelID),
-		"addr":    fmt.Sprintf("%s:%d", node.TCPListenAddr, chainNode.Port),
-		"handler": handlerCfg,
-		"listener": map[string]interface{}{
-			"type": protocol,
-		},
-	}
-	if chainNode.ChainType == 2 {
+		"name":     fmt.Sprintf("%d_tls", tunnelID),
+		"addr":     fmt.Sprintf("%s:%d", node.TCPListenAddr, chainNode.Port),
+		"handler":  handlerCfg,
+		"listener": buildTunnelListenerConfig(protocol, state.Transport),
+	}
+	if chainNode.ChainType == 2 && withChain {
 		service["handler"].(map[string]interface{})["chain"] = fmt.Sprintf("chains_%d", tunnelID)
 	}
 	if chainNode.ChainType == 3 && strings.TrimSpace(node.InterfaceName) != "" {
@@ -2790,7 +3398,12 @@ func (h *Handler) replaceTunnelChainsTx(tx *gorm.DB, tunnelID int64, req map[str
 }
 
 func (h *Handler) deleteNodeByID(id int64) error {
-	return h.repo.DeleteNodeCascade(id)
+	if err := h.repo.DeleteNodeCascade(id); err != nil {
+		return err
+	}
+	h.forgetNodeMetrics(id)
+	h.stopNodeDrain(id)
+	return nil
 }
 
 func (h *Handler) deleteTunnelByID(id int64) error {
@@ -2823,6 +3436,15 @@ func (h *Handler) tunnelEntryNodeIDs(tunnelID int64) ([]int64, error) {
 }
 
 func (h *Handler) pickTunnelPort(tunnelID int64) int {
+	return h.pickTunnelPortRange(tunnelID, 1)
+}
+
+// pickTunnelPortRange picks the first port of count consecutive ports that are
+// free on every entry node of the tunnel.
+func (h *Handler) pickTunnelPortRange(tunnelID int64, count int) int {
+	if count < 1 {
+		count = 1
+	}
 	entryNodes, err := h.tunnelEntryNodeIDs(tunnelID)
 	if err != nil || len(entryNodes) == 0 {
 		return 10000
@@ -2850,9 +3472,13 @@ func (h *Handler) pickTunnelPort(tunnelID int64) int {
 			continue
 		}
 
+		allowed := make(map[int]bool, len(nodePorts))
+		for _, p := range nodePorts {
+			allowed[p] = true
+		}
 		var available []int
 		for _, p := range nodePorts {
-			if !used[p] {
+			if portSpanFree(p, count, allowed, used) {
 				available = append(available, p)
 			}
 		}
@@ -2965,6 +3591,17 @@ func (h *Handler) rollbackForwardMutation(oldForward *forwardRecord, oldPorts []
 		oldForward.TunnelID, oldForward.RemoteAddr, oldForward.Strategy, oldForward.Status,
 		time.Now().UnixMilli(),
 	)
+	_ = h.repo.UpdateForwardHealthCheck(oldForward.ID, oldForward.HealthCheck)
+	_ = h.repo.UpdateForwardTargetOptions(oldForward.ID, oldForward.TargetOptions)
+	_ = h.repo.UpdateForwardConnLimits(oldForward.ID, oldForward.MaxConns, oldForward.ConnRate)
+	_ = h.repo.UpdateForwardAccessRules(oldForward.ID, oldForward.AccessRules)
+	_ = h.repo.UpdateForwardProxyProtocol(oldForward.ID, oldForward.ProxyAccept, oldForward.ProxySend)
+	_ = h.repo.UpdateForwardSpeedCaps(oldForward.ID, oldForward.IPSpeed, oldForward.ConnSpeed)
+	_ = h.repo.UpdateForwardSchedule(oldForward.ID, oldForward.Schedule)
+	_ = h.repo.UpdateForwardAccessLog(oldForward.ID, oldForward.AccessLog)
+	_ = h.repo.UpdateForwardMuxHost(oldForward.ID, oldForward.MuxHost)
+	_ = h.repo.UpdateForwardPortCount(oldForward.ID, forwardPortCount(oldForward))
+	_ = h.repo.UpdateForwardDNSPolicy(oldForward.ID, oldForward.DNSPolicy)
 
 	if err := h.replaceForwardPortsWithRecords(oldForward.ID, oldPorts); err != nil {
 		return
@@ -2983,6 +3620,20 @@ func (h *Handler) upsertUserTunnel(req map[string]interface{}) error {
 	existingID, currentFlow, currentNum, currentExpTime, currentFlowReset, currentSpeedID, currentStatus, err :=
 		h.repo.GetExistingUserTunnel(userID, tunnelID)
 
+	var currentMaxConns, currentConnRate, currentIPSpeed, currentConnSpeed int
+	if err == nil {
+		currentMaxConns, currentConnRate = h.repo.GetUserTunnelConnLimits(existingID)
+		currentIPSpeed, currentConnSpeed = h.repo.GetUserTunnelSpeedCaps(existingID)
+	}
+	maxConns, connRate, connLimitsSet, parseErr := parseConnLimitsInput(req, currentMaxConns, currentConnRate)
+	if parseErr != nil {
+		return parseErr
+	}
+	ipSpeed, connSpeed, speedCapsSet, parseErr := parseSpeedCapsInput(req, currentIPSpeed, currentConnSpeed)
+	if parseErr != nil {
+		return parseErr
+	}
+
 	speedID := asAnyToInt64Ptr(req["speedId"])
 	reqFlow := asInt64(req["flow"], -1)
 	reqNum := asInt(req["num"], -1)
@@ -3024,7 +3675,27 @@ func (h *Handler) upsertUserTunnel(req map[string]interface{}) error {
 			reqStatus = 1
 		}
 
-		return h.repo.InsertUserTunnel(userID, tunnelID, nullableInt(speedID), reqNum, reqFlow, reqFlowReset, reqExpTime, reqStatus)
+		if err := h.repo.InsertUserTunnel(userID, tunnelID, nullableInt(speedID), reqNum, reqFlow, reqFlowReset, reqExpTime, reqStatus); err != nil {
+			return err
+		}
+		hasConnLimits := connLimitsSet && (maxConns > 0 || connRate > 0)
+		hasSpeedCaps := speedCapsSet && (ipSpeed > 0 || connSpeed > 0)
+		if !hasConnLimits && !hasSpeedCaps {
+			return nil
+		}
+		insertedID, _, _, err := h.resolveUserTunnelAndLimiter(userID, tunnelID)
+		if err != nil {
+			return err
+		}
+		if hasConnLimits {
+			if err := h.repo.UpdateUserTunnelConnLimits(insertedID, maxConns, connRate); err != nil {
+				return err
+			}
+		}
+		if hasSpeedCaps {
+			return h.repo.UpdateUserTunnelSpeedCaps(insertedID, ipSpeed, connSpeed)
+		}
+		return nil
 	}
 	if err != nil {
 		return err
@@ -3063,6 +3734,12 @@ func (h *Handler) upsertUserTunnel(req map[string]interface{}) error {
 	}
 
 	err = h.repo.UpdateUserTunnelFields(existingID, newSpeedID, newFlow, newNum, newExpTime, newFlowReset, newStatus)
+	if err == nil && connLimitsSet {
+		err = h.repo.UpdateUserTunnelConnLimits(existingID, maxConns, connRate)
+	}
+	if err == nil && speedCapsSet {
+		err = h.repo.UpdateUserTunnelSpeedCaps(existingID, ipSpeed, connSpeed)
+	}
 
 	if err == nil {
 		h.syncUserTunnelForwards(userID, tunnelID)
@@ -0,0 +1,343 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// A host-routed forward does not get a listener of its own. All host-routed
+// forwards of a user tunnel that use the same entry port share one TCP service
+// per node, which carries the user tunnel's speed limit, pool and caps; the
+// agent sniffs the TLS SNI or HTTP Host of each connection and picks the
+// targets of the matching forward. Each route is a named forwarder node, and
+// the agent reports the traffic of a connection under the name of the route it
+// took, so flow accounting stays per forward.
+const muxSniffingTimeout = "5s"
+
+// parseMuxHostInput reads muxHost. "*.example.com" and ".example.com" match
+// every subdomain of example.com; an empty value turns routing off.
+func parseMuxHostInput(req map[string]interface{}) (host string, present bool, err error) {
+	raw, ok := req["muxHost"]
+	if !ok || raw == nil {
+		return "", false, nil
+	}
+	host, err = normalizeMuxHost(asString(raw))
+	return host, true, err
+}
+
+func normalizeMuxHost(raw string) (string, error) {
+	host := strings.TrimSuffix(strings.ToLower(strings.TrimSpace(raw)), ".")
+	if host == "" {
+		return "", nil
+	}
+	wildcard := false
+	if strings.HasPrefix(host, "*.") {
+		host, wildcard = host[2:], true
+	} else if strings.HasPrefix(host, ".") {
+		host, wildcard = host[1:], true
+	}
+	if !isValidMuxHostname(host) {
+		return "", errors.New("复用域名格式错误")
+	}
+	if wildcard {
+		return "." + host, nil
+	}
+	return host, nil
+}
+
+func isValidMuxHostname(host string) bool {
+	if host == "" || len(host) > 253 {
+		return false
+	}
+	for _, label := range strings.Split(host, ".") {
+		if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for _, c := range label {
+			if (c < 'a' || c > 'z') && (c < '0' || c > '9') && c != '-' {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func muxServiceName(port int) string {
+	return fmt.Sprintf("mux_%d_tcp", port)
+}
+
+// muxRequirement is demanded of every entry node of a host-routed forward.
+func muxRequirement() nodeCapabilityRequirement {
+	return nodeCapabilityRequirement{Features: []string{"sniRouting"}}
+}
+
+// muxUnsupportedOptions rejects listener options that belong to the shared
+// service and so cannot apply to a single route.
+func muxUnsupportedOptions(forward *forwardRecord) error {
+	if forward.MaxConns > 0 || forward.ConnRate > 0 || strings.TrimSpace(forward.AccessRules) != "" ||
+		forward.ProxyAccept > 0 || forward.ProxySend > 0 || forward.IPSpeed > 0 || forward.ConnSpeed > 0 ||
+		forward.AccessLog == 1 || forwardPortCount(forward) > 1 || strings.TrimSpace(forward.DNSPolicy) != "" {
+		return errors.New("域名复用转发不支持端口段、连接限制、访问控制、PROXY 协议、单IP/单连接限速、连接日志与解析策略")
+	}
+	// The selector of the shared service is fifo for every route.
+	if strategy, err := normalizeForwardStrategy(forward.Strategy); err != nil || strategy != "fifo" {
+		return errors.New("域名复用转发的目标固定按顺序故障转移，不支持其他负载策略")
+	}
+	for _, option := range decodeForwardTargetOptions(forward.TargetOptions) {
+		if option.Weight > 0 {
+			return errors.New("域名复用转发不支持目标权重")
+		}
+	}
+	return nil
+}
+
+// pickMuxPort reuses the port the user already shares among host-routed
+// forwards of the tunnel, so new routes join the existing listener by default.
+func (h *Handler) pickMuxPort(userID, tunnelID int64) int {
+	ports, err := h.repo.ListMuxPortsByUserTunnel(userID, tunnelID)
+	if err == nil && len(ports) > 0 {
+		return ports[0]
+	}
+	return h.pickTunnelPort(tunnelID)
+}
+
+// validateMuxPort checks that a forward may listen on port of a node: a port
+// is either dedicated to one forward or shared by host-routed forwards of a
+// single user tunnel with distinct hosts. Keeping a shared port to one user
+// tunnel lets the service carry that user tunnel's limiters.
+func (h *Handler) validateMuxPort(forwardID, userID, tunnelID, nodeID int64, port int, host string) error {
+	others, err := h.repo.ListForwardsOnNodePort(nodeID, port)
+	if err != nil {
+		return err
+	}
+	for _, other := range others {
+		if other.ID == forwardID {
+			continue
+		}
+		if host == "" {
+			if other.MuxHost != "" {
+				return fmt.Errorf("端口 %d 已用于域名复用", port)
+			}
+			continue
+		}
+		if other.MuxHost == "" {
+			return fmt.Errorf("端口 %d 已被其他转发独占", port)
+		}
+		if other.TunnelID != tunnelID {
+			return fmt.Errorf("端口 %d 已被其他隧道的域名复用转发占用", port)
+		}
+		if other.UserID != userID {
+			return fmt.Errorf("端口 %d 已被其他用户的域名复用转发占用", port)
+		}
+		if muxHostsOverlap(other.MuxHost, host) {
+			if other.MuxHost == host {
+				return fmt.Errorf("域名 %s 已在端口 %d 上使用", displayMuxHost(host), port)
+			}
+			return fmt.Errorf("域名 %s 与端口 %d 上的 %s 重叠", displayMuxHost(host), port, displayMuxHost(other.MuxHost))
+		}
+	}
+	return nil
+}
+
+// muxHostsOverlap reports whether some host name would match both routes.
+// The agent picks the first matching route, so overlapping routes on one port
+// would make the choice depend on their order.
+func muxHostsOverlap(a, b string) bool {
+	return muxHostMatches(strings.TrimPrefix(a, "."), b) || muxHostMatches(strings.TrimPrefix(b, "."), a)
+}
+
+// muxHostMatches mirrors the agent: ".example.com" matches example.com and
+// its subdomains.
+func muxHostMatches(host, route string) bool {
+	if host == route {
+		return true
+	}
+	return strings.HasPrefix(route, ".") && (host == route[1:] || strings.HasSuffix(host, route))
+}
+
+// muxPortInUse reports whether a shared port of a node still has a running
+// route.
+func (h *Handler) muxPortInUse(nodeID int64, port int) bool {
+	forwards, err := h.repo.ListForwardsOnNodePort(nodeID, port)
+	if err != nil {
+		return true
+	}
+	for _, f := range forwards {
+		if f.MuxHost != "" && f.Status == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+func displayMuxHost(host string) string {
+	if strings.HasPrefix(host, ".") {
+		return "*" + host
+	}
+	return host
+}
+
+// syncMuxForward rebuilds the shared services on every entry port of a
+// host-routed forward, with the forward's route present only when active.
+func (h *Handler) syncMuxForward(forward *forwardRecord, active bool) error {
+	if active {
+		if err := muxUnsupportedOptions(forward); err != nil {
+			return err
+		}
+	}
+	ports, err := h.listForwardPorts(forward.ID)
+	if err != nil {
+		return err
+	}
+	if len(ports) == 0 {
+		return errors.New("转发入口端口不存在")
+	}
+	for _, fp := range ports {
+		if err := h.syncMuxService(fp.NodeID, fp.Port, forward, active); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// syncMuxService installs the routing table of one shared port. forward
+// overrides its stored copy, which may be stale or about to be removed.
+func (h *Handler) syncMuxService(nodeID int64, port int, forward *forwardRecord, active bool) error {
+	node, err := h.getNodeRecord(nodeID)
+	if err != nil {
+		return err
+	}
+	stored, err := h.repo.ListForwardsOnNodePort(nodeID, port)
+	if err != nil {
+		return err
+	}
+	routes := make([]forwardRecord, 0, len(stored)+1)
+	for _, f := range stored {
+		if f.ID == forward.ID || f.MuxHost == "" || f.Status != 1 {
+			continue
+		}
+		routes = append(routes, f)
+	}
+	if active && forward.MuxHost != "" {
+		routes = append(routes, *forward)
+	}
+
+	name := muxServiceName(port)
+	if len(routes) == 0 {
+		_, err := h.sendNodeCommand(node.ID, "DeleteService", map[string]interface{}{"services": []string{name}}, false, true)
+		return err
+	}
+
+	// validateMuxPort keeps a shared port to one user tunnel, so the limits
+	// of the first route bind every route.
+	owner := &routes[0]
+	tunnel, err := h.getTunnelRecord(owner.TunnelID)
+	if err != nil {
+		return err
+	}
+	userTunnelID, limiterID, speed, err := h.resolveUserTunnelAndLimiter(owner.UserID, owner.TunnelID)
+	if err != nil {
+		return err
+	}
+	connLimiters := h.userTunnelConnLimiters(userTunnelID)
+	pool := h.userBandwidthPool(owner.UserID)
+	speedCaps := h.userTunnelSpeedCaps(userTunnelID)
+	requirement := mergeNodeCapabilityRequirements(
+		muxRequirement(),
+		connLimiterRequirement(connLimiters),
+		bandwidthPoolRequirement(pool),
+		speedCapRequirement(speedCaps),
+	)
+	if err := validateNodeCapabilities(node, requirement); err != nil {
+		return err
+	}
+
+	nodes := make([]map[string]interface{}, 0, len(routes))
+	for i := range routes {
+		route := &routes[i]
+		nodes = append(nodes, buildMuxRouteNodes(buildForwardServiceBase(route.ID, route.UserID, userTunnelID), route)...)
+	}
+
+	service := map[string]interface{}{
+		"name": name,
+		"addr": fmt.Sprintf("%s:%d", node.TCPListenAddr, port),
+		"handler": map[string]interface{}{
+			"type": "tcp",
+			"metadata": map[string]interface{}{
+				"sniffing":         true,
+				"sniffing.timeout": muxSniffingTimeout,
+				"routeTraffic":     true,
+			},
+		},
+		"listener": map[string]interface{}{
+			"type": "tcp",
+		},
+		"forwarder": map[string]interface{}{
+			"nodes": nodes,
+			// The selector is shared by every route, so the targets of a
+			// route always fail over in order.
+			"selector": map[string]interface{}{
+				"strategy":    "fifo",
+				"maxFails":    1,
+				"failTimeout": "600s",
+			},
+		},
+	}
+	if tunnel != nil && tunnel.Type == 2 {
+		service["handler"].(map[string]interface{})["chain"] = fmt.Sprintf("chains_%d", tunnel.ID)
+	}
+	if tunnel != nil && tunnel.Type == 1 && strings.TrimSpace(node.InterfaceName) != "" {
+		service["metadata"] = map[string]interface{}{"interface": node.InterfaceName}
+	}
+	if limiterID != nil && speed != nil {
+		h.ensureLimiterOnNode(node.ID, *limiterID, *speed)
+	}
+	if limiterID != nil && *limiterID > 0 {
+		service["limiter"] = strconv.FormatInt(*limiterID, 10)
+	}
+	h.ensureConnLimitersOnNode(node.ID, connLimiters)
+	h.ensureBandwidthPoolOnNode(node.ID, owner.UserID, pool)
+	h.ensureSpeedCapsOnNode(node.ID, speedCaps)
+
+	services := []map[string]interface{}{service}
+	applyConnLimiters(services, connLimiters)
+	applyBandwidthPool(services, owner.UserID, pool)
+	applySpeedCaps(services, speedCaps)
+	_, err = h.sendNodeCommand(node.ID, "UpdateService", services, true, false)
+	if err != nil {
+		_, err = h.sendNodeCommand(node.ID, "AddService", services, true, false)
+	}
+	if err != nil {
+		return fmt.Errorf("节点 %s 下发失败: %w", node.Name, err)
+	}
+	return nil
+}
+
+// buildMuxRouteNodes renders the targets of one route. The node names start
+// with the forward's service base so the agent's per-route traffic reports
+// parse like those of a dedicated service.
+func buildMuxRouteNodes(serviceBase string, forward *forwardRecord) []map[string]interface{} {
+	nodes := buildForwarderNodes(splitRemoteTargets(forward.RemoteAddr), decodeHealthCheck(forward.HealthCheck), decodeForwardTargetOptions(forward.TargetOptions))
+	for i, node := range nodes {
+		node["name"] = fmt.Sprintf("%s_tcp_%d", serviceBase, i+1)
+		node["filter"] = map[string]interface{}{"host": forward.MuxHost}
+	}
+	return nodes
+}
+
+// releaseMuxListeners detaches a forward from the listeners it used before an
+// update switched it between a dedicated port and a shared one, or moved it to
+// another shared port.
+func (h *Handler) releaseMuxListeners(oldForward *forwardRecord, oldPorts []forwardPortRecord, updated *forwardRecord) {
+	if oldForward.MuxHost == "" {
+		if updated.MuxHost != "" {
+			_ = h.controlForwardServices(oldForward, "DeleteService", true)
+		}
+		return
+	}
+	for _, fp := range oldPorts {
+		_ = h.syncMuxService(fp.NodeID, fp.Port, oldForward, false)
+	}
+}
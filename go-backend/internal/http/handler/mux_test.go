@@ -0,0 +1,190 @@
+package handler
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go-backend/internal/store/repo"
+)
+
+func TestNormalizeMuxHost(t *testing.T) {
+	cases := map[string]string{
+		"":                 "",
+		"API.Example.com.": "api.example.com",
+		"*.example.com":    ".example.com",
+		".example.com":     ".example.com",
+	}
+	for raw, want := range cases {
+		got, err := normalizeMuxHost(raw)
+		if err != nil || got != want {
+			t.Fatalf("normalize %q: got %q err=%v, want %q", raw, got, err, want)
+		}
+	}
+	for _, raw := range []string{"exa mple.com", "-bad.com", "a..b", "*.", "example.com:443"} {
+		if _, err := normalizeMuxHost(raw); err == nil {
+			t.Fatalf("expected %q to be rejected", raw)
+		}
+	}
+}
+
+func TestBuildMuxRouteNodesNamesRoutesForFlowAccounting(t *testing.T) {
+	forward := &forwardRecord{ID: 12, UserID: 3, RemoteAddr: "10.0.0.5:443,10.0.0.6:443", MuxHost: ".example.com"}
+	nodes := buildMuxRouteNodes("12_3_7", forward)
+	if len(nodes) != 2 {
+		t.Fatalf("expected a node per target, got %+v", nodes)
+	}
+	for i, node := range nodes {
+		name, _ := node["name"].(string)
+		forwardID, userID, userTunnelID, ok := parseFlowServiceIDs(name)
+		if !ok || forwardID != 12 || userID != 3 || userTunnelID != 7 {
+			t.Fatalf("node %d name %q does not parse as the forward's flow name", i, name)
+		}
+		filter, _ := node["filter"].(map[string]interface{})
+		if filter["host"] != ".example.com" {
+			t.Fatalf("unexpected filter on node %d: %+v", i, node["filter"])
+		}
+	}
+}
+
+func TestMuxUnsupportedOptionsRejectsSelectorSettings(t *testing.T) {
+	if err := muxUnsupportedOptions(&forwardRecord{Strategy: "fifo", TargetOptions: `[{"addr":"10.0.0.2:443","backup":true}]`}); err != nil {
+		t.Fatalf("expected fifo with a backup target to be allowed, got %v", err)
+	}
+	for _, forward := range []*forwardRecord{
+		{Strategy: "round"},
+		{Strategy: "fifo", TargetOptions: `[{"addr":"10.0.0.1:443","weight":5}]`},
+	} {
+		if err := muxUnsupportedOptions(forward); err == nil {
+			t.Fatalf("expected %+v to be rejected", forward)
+		}
+	}
+}
+
+func TestMuxHostsOverlap(t *testing.T) {
+	for _, c := range []struct {
+		a, b string
+		want bool
+	}{
+		{"a.example.com", "a.example.com", true},
+		{"a.example.com", "b.example.com", false},
+		{"a.example.com", ".example.com", true},
+		{"example.com", ".example.com", true},
+		{"badexample.com", ".example.com", false},
+		{".example.com", ".a.example.com", true},
+		{".a.example.com", ".b.example.com", false},
+	} {
+		if got := muxHostsOverlap(c.a, c.b); got != c.want {
+			t.Fatalf("muxHostsOverlap(%q, %q) = %v, want %v", c.a, c.b, got, c.want)
+		}
+		if got := muxHostsOverlap(c.b, c.a); got != c.want {
+			t.Fatalf("muxHostsOverlap(%q, %q) = %v, want %v", c.b, c.a, got, c.want)
+		}
+	}
+}
+
+func TestValidateMuxPortSharesOnlyAmongHostRoutes(t *testing.T) {
+	r, err := repo.Open(filepath.Join(t.TempDir(), "mux.db"))
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	t.Cleanup(func() { _ = r.Close() })
+	h := New(r, "secret")
+
+	db := r.DB()
+	for _, stmt := range []string{
+		`INSERT INTO forward(id, user_id, user_name, name, tunnel_id, remote_addr, strategy, created_time, updated_time, status, mux_host) VALUES (1, 1, 'u', 'a', 3, '10.0.0.1:443', 'fifo', 0, 0, 1, 'a.example.com')`,
+		`INSERT INTO forward(id, user_id, user_name, name, tunnel_id, remote_addr, strategy, created_time, updated_time, status) VALUES (2, 1, 'u', 'b', 3, '10.0.0.2:80', 'fifo', 0, 0, 1)`,
+		`INSERT INTO forward_port(forward_id, node_id, port) VALUES (1, 9, 443), (2, 9, 8080)`,
+	} {
+		if err := db.Exec(stmt).Error; err != nil {
+			t.Fatalf("seed: %v", err)
+		}
+	}
+
+	if err := h.validateMuxPort(0, 1, 3, 9, 443, "b.example.com"); err != nil {
+		t.Fatalf("expected a new host to join the shared port, got %v", err)
+	}
+	if err := h.validateMuxPort(1, 1, 3, 9, 443, "a.example.com"); err != nil {
+		t.Fatalf("expected a route to keep its own host, got %v", err)
+	}
+	if err := h.validateMuxPort(0, 1, 3, 9, 443, "a.example.com"); err == nil {
+		t.Fatalf("expected a duplicate host to be rejected")
+	}
+	for _, host := range []string{".example.com", ".a.example.com"} {
+		if err := h.validateMuxPort(0, 1, 3, 9, 443, host); err == nil {
+			t.Fatalf("expected %s to be rejected as overlapping a.example.com", host)
+		}
+	}
+	if err := h.validateMuxPort(0, 1, 3, 9, 443, ".b.example.com"); err != nil {
+		t.Fatalf("expected a disjoint wildcard to join the shared port, got %v", err)
+	}
+	if err := h.validateMuxPort(0, 1, 4, 9, 443, "c.example.com"); err == nil {
+		t.Fatalf("expected a route of another tunnel to be rejected")
+	}
+	if err := h.validateMuxPort(0, 2, 3, 9, 443, "c.example.com"); err == nil {
+		t.Fatalf("expected a route of another user to be rejected")
+	}
+	if err := h.validateMuxPort(0, 1, 3, 9, 443, ""); err == nil {
+		t.Fatalf("expected a dedicated forward to be kept off a shared port")
+	}
+	if err := h.validateMuxPort(0, 1, 3, 9, 8080, "c.example.com"); err == nil {
+		t.Fatalf("expected a route to be kept off a dedicated port")
+	}
+	if ports, err := r.ListMuxPortsByUserTunnel(1, 3); err != nil || len(ports) != 1 || ports[0] != 443 {
+		t.Fatalf("expected the tunnel's shared port, got %v %v", ports, err)
+	}
+}
+
+func TestSyncMuxServiceAppliesUserTunnelLimits(t *testing.T) {
+	r, err := repo.Open(filepath.Join(t.TempDir(), "mux.db"))
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	t.Cleanup(func() { _ = r.Close() })
+	h := New(r, "secret")
+
+	for _, stmt := range []string{
+		`INSERT INTO tunnel(id, name, traffic_ratio, type, protocol, flow, created_time, updated_time, status, inx) VALUES (3, 't', 1.0, 1, 'tls', 0, 0, 0, 1, 0)`,
+		`INSERT INTO speed_limit(id, name, speed, tunnel_id, tunnel_name, created_time, status) VALUES (7, '10M', 10, 3, 't', 0, 1)`,
+		`INSERT INTO user_tunnel(id, user_id, tunnel_id, speed_id, num, flow, in_flow, out_flow, flow_reset_time, exp_time, status, max_conns, ip_speed) VALUES (5, 1, 3, 7, 1, 0, 0, 0, 0, 0, 1, 100, 20)`,
+		`INSERT INTO forward(id, user_id, user_name, name, tunnel_id, remote_addr, strategy, created_time, updated_time, status, mux_host) VALUES (1, 1, 'u', 'a', 3, '10.0.0.1:443', 'fifo', 0, 0, 1, 'a.example.com')`,
+		`INSERT INTO forward_port(forward_id, node_id, port) VALUES (1, 9, 443)`,
+	} {
+		if err := r.DB().Exec(stmt).Error; err != nil {
+			t.Fatalf("seed: %v", err)
+		}
+	}
+	insertOfflineNode(t, r, 9, "entry", "sniRouting", "connLimiter", "sharedBucket")
+	agent := connectFakeNodeAgent(t, h, 9, "entry-secret")
+
+	forward, err := h.getForwardRecord(1)
+	if err != nil {
+		t.Fatalf("load forward: %v", err)
+	}
+	if err := h.syncMuxService(9, 443, forward, true); err != nil {
+		t.Fatalf("sync mux service: %v", err)
+	}
+
+	updates := agent.sent("UpdateService")
+	if len(updates) != 1 {
+		t.Fatalf("expected one service update, got %+v", updates)
+	}
+	if len(updates[0].Items) != 1 {
+		t.Fatalf("unexpected update payload %+v", updates[0])
+	}
+	service := updates[0].Items[0].(map[string]interface{})
+	if service["name"] != "mux_443_tcp" {
+		t.Fatalf("unexpected service %+v", service)
+	}
+	limiters := strings.Split(asString(service["limiter"]), ",")
+	if limiters[0] != "7" || len(limiters) != 2 || limiters[1] != "cap_usertunnel_5" {
+		t.Fatalf("expected the user tunnel speed limit and caps on the shared service, got %v", service["limiter"])
+	}
+	if service["climiter"] != "conn_usertunnel_5" {
+		t.Fatalf("expected the user tunnel conn limit on the shared service, got %v", service["climiter"])
+	}
+	if len(agent.sent("UpdateCLimiters")) != 1 {
+		t.Fatalf("expected the conn limiter to be pushed before the service")
+	}
+}
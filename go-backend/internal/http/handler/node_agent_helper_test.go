@@ -0,0 +1,143 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"go-backend/internal/security"
+	"go-backend/internal/store/repo"
+)
+
+// fakeNodeCommand holds a command's payload in Data, or in Items when the
+// payload is a list such as the services of UpdateService.
+type fakeNodeCommand struct {
+	Type  string
+	Data  map[string]interface{}
+	Items []interface{}
+}
+
+// fakeNodeAgent connects to the node websocket the way an agent does, records
+// every command and answers it with success.
+type fakeNodeAgent struct {
+	mu       sync.Mutex
+	commands []fakeNodeCommand
+
+	writeMu sync.Mutex
+	conn    *websocket.Conn
+}
+
+func connectFakeNodeAgent(t *testing.T, h *Handler, nodeID int64, secret string) *fakeNodeAgent {
+	t.Helper()
+	server := httptest.NewServer(h.WebSocketHandler())
+	t.Cleanup(server.Close)
+
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/?type=1&secret=" + secret
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("dial node websocket: %v", err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+
+	crypto, err := security.NewAESCrypto(secret)
+	if err != nil {
+		t.Fatalf("node crypto: %v", err)
+	}
+	agent := &fakeNodeAgent{conn: conn}
+	go func() {
+		for {
+			_, payload, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			var wrap struct {
+				Encrypted bool   `json:"encrypted"`
+				Data      string `json:"data"`
+			}
+			if json.Unmarshal(payload, &wrap) == nil && wrap.Encrypted {
+				if payload, err = crypto.Decrypt(wrap.Data); err != nil {
+					continue
+				}
+			}
+			var cmd struct {
+				Type      string      `json:"type"`
+				Data      interface{} `json:"data"`
+				RequestID string      `json:"requestId"`
+			}
+			if json.Unmarshal(payload, &cmd) != nil || cmd.Type == "" {
+				continue
+			}
+			agent.mu.Lock()
+			recorded := fakeNodeCommand{Type: cmd.Type}
+			recorded.Data, _ = cmd.Data.(map[string]interface{})
+			recorded.Items, _ = cmd.Data.([]interface{})
+			agent.commands = append(agent.commands, recorded)
+			agent.mu.Unlock()
+			_ = agent.write(map[string]interface{}{
+				"type":      cmd.Type + "Response",
+				"success":   true,
+				"message":   "OK",
+				"requestId": cmd.RequestID,
+			})
+		}
+	}()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for mustQueryInt(t, h.repo, `SELECT status FROM node WHERE id = ?`, nodeID) != 1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("node %d did not come online", nodeID)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return agent
+}
+
+func (a *fakeNodeAgent) write(msg interface{}) error {
+	a.writeMu.Lock()
+	defer a.writeMu.Unlock()
+	return a.conn.WriteJSON(msg)
+}
+
+// hello sends the Hello message an agent opens its session with.
+func (a *fakeNodeAgent) hello(t *testing.T, data map[string]interface{}) {
+	t.Helper()
+	if err := a.write(map[string]interface{}{"type": "Hello", "data": data}); err != nil {
+		t.Fatalf("send hello: %v", err)
+	}
+}
+
+// sent returns the recorded commands of the given type.
+func (a *fakeNodeAgent) sent(cmdType string) []fakeNodeCommand {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	var out []fakeNodeCommand
+	for _, cmd := range a.commands {
+		if cmd.Type == cmdType {
+			out = append(out, cmd)
+		}
+	}
+	return out
+}
+
+// insertOfflineNode seeds a local node whose secret is "<name>-secret" and
+// whose manifest advertises features.
+func insertOfflineNode(t *testing.T, r *repo.Repository, id int64, name string, features ...string) {
+	t.Helper()
+	flags := make(map[string]bool, len(features))
+	for _, f := range features {
+		flags[f] = true
+	}
+	caps, _ := json.Marshal(map[string]interface{}{"features": flags})
+	now := time.Now().UnixMilli()
+	if err := r.DB().Exec(`
+		INSERT INTO node(id, name, secret, server_ip, server_ip_v4, server_ip_v6, port, interface_name, version, http, tls, socks, created_time, updated_time, status, tcp_listen_addr, udp_listen_addr, inx, capabilities)
+		VALUES(?, ?, ?, '10.0.1.1', '', '', '30000-30010', '', 'v1', 1, 1, 1, ?, ?, 0, '[::]', '[::]', 0, ?)
+	`, id, name, name+"-secret", now, now, string(caps)).Error; err != nil {
+		t.Fatalf("insert node: %v", err)
+	}
+}
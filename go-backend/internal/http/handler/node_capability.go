@@ -0,0 +1,214 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+type nodeCapabilityManifest struct {
+	OS         string          `json:"os"`
+	Arch       string          `json:"arch"`
+	Listeners  []string        `json:"listeners"`
+	Dialers    []string        `json:"dialers"`
+	Handlers   []string        `json:"handlers"`
+	Connectors []string        `json:"connectors"`
+	Features   map[string]bool `json:"features"`
+}
+
+type nodeCapabilityRequirement struct {
+	Listeners  []string
+	Dialers    []string
+	Handlers   []string
+	Connectors []string
+	Features   []string
+}
+
+func parseNodeCapabilities(raw string) *nodeCapabilityManifest {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return nil
+	}
+	var manifest nodeCapabilityManifest
+	if err := json.Unmarshal([]byte(raw), &manifest); err != nil {
+		return nil
+	}
+	return &manifest
+}
+
+func containsFold(items []string, name string) bool {
+	for _, item := range items {
+		if strings.EqualFold(strings.TrimSpace(item), name) {
+			return true
+		}
+	}
+	return false
+}
+
+func (req *nodeCapabilityRequirement) addListener(name string) {
+	if name != "" && !containsFold(req.Listeners, name) {
+		req.Listeners = append(req.Listeners, name)
+	}
+}
+
+func (req *nodeCapabilityRequirement) addDialer(name string) {
+	if name != "" && !containsFold(req.Dialers, name) {
+		req.Dialers = append(req.Dialers, name)
+	}
+}
+
+func (req *nodeCapabilityRequirement) addHandler(name string) {
+	if name != "" && !containsFold(req.Handlers, name) {
+		req.Handlers = append(req.Handlers, name)
+	}
+}
+
+func (req *nodeCapabilityRequirement) addConnector(name string) {
+	if name != "" && !containsFold(req.Connectors, name) {
+		req.Connectors = append(req.Connectors, name)
+	}
+}
+
+func (req *nodeCapabilityRequirement) addFeature(name string) {
+	if name != "" && !containsFold(req.Features, name) {
+		req.Features = append(req.Features, name)
+	}
+}
+
+// mergeNodeCapabilityRequirements combines the requirements of the options
+// one service uses, so a node is checked once and reports everything it
+// lacks in one error.
+func mergeNodeCapabilityRequirements(reqs ...nodeCapabilityRequirement) nodeCapabilityRequirement {
+	var out nodeCapabilityRequirement
+	for _, req := range reqs {
+		for _, name := range req.Listeners {
+			out.addListener(name)
+		}
+		for _, name := range req.Dialers {
+			out.addDialer(name)
+		}
+		for _, name := range req.Handlers {
+			out.addHandler(name)
+		}
+		for _, name := range req.Connectors {
+			out.addConnector(name)
+		}
+		for _, name := range req.Features {
+			out.addFeature(name)
+		}
+	}
+	return out
+}
+
+// validateNodeCapabilities only checks nodes that reported a manifest; legacy
+// agents and federated remote nodes are accepted as before.
+func validateNodeCapabilities(node *nodeRecord, req nodeCapabilityRequirement) error {
+	if node == nil || node.IsRemote == 1 {
+		return nil
+	}
+	manifest := parseNodeCapabilities(node.Capabilities)
+	if manifest == nil {
+		return nil
+	}
+	missing := make([]string, 0)
+	for _, name := range req.Listeners {
+		if !containsFold(manifest.Listeners, name) {
+			missing = append(missing, "listener:"+name)
+		}
+	}
+	for _, name := range req.Dialers {
+		if !containsFold(manifest.Dialers, name) {
+			missing = append(missing, "dialer:"+name)
+		}
+	}
+	for _, name := range req.Handlers {
+		if !containsFold(manifest.Handlers, name) {
+			missing = append(missing, "handler:"+name)
+		}
+	}
+	for _, name := range req.Connectors {
+		if !containsFold(manifest.Connectors, name) {
+			missing = append(missing, "connector:"+name)
+		}
+	}
+	for _, name := range req.Features {
+		if !manifest.Features[name] {
+			missing = append(missing, "feature:"+name)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("节点 %s 不支持所需能力: %s", node.Name, strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+func forwardEntryRequirement() nodeCapabilityRequirement {
+	req := nodeCapabilityRequirement{}
+	for _, protocol := range []string{"tcp", "udp"} {
+		req.addListener(protocol)
+		req.addHandler(protocol)
+	}
+	return req
+}
+
+// tunnelNodeRequirements derives per-node requirements from the hop layout:
+// every non-entry node listens on its own protocol with a relay handler. In
+// relay mode every node dials the protocol of the next group with a relay
+// connector; in multihop mode the entry node dials every later group itself
+// and hop nodes only relay plain connections.
+func tunnelNodeRequirements(state *tunnelCreateState) map[int64]nodeCapabilityRequirement {
+	out := make(map[int64]nodeCapabilityRequirement)
+	if state == nil {
+		return out
+	}
+	groups := make([][]tunnelRuntimeNode, 0, len(state.ChainHops)+2)
+	groups = append(groups, state.InNodes)
+	if state.Type == 2 {
+		groups = append(groups, tunnelHopGroups(state)...)
+	}
+
+	for i, group := range groups {
+		var dialed [][]tunnelRuntimeNode
+		switch {
+		case i+1 >= len(groups):
+		case i == 0 && !state.hopNodesRunChains():
+			dialed = groups[1:]
+		case i == 0 || state.hopNodesRunChains():
+			dialed = groups[i+1 : i+2]
+		}
+		for _, node := range group {
+			req := out[node.NodeID]
+			if i == 0 {
+				req = mergeNodeCapabilityRequirements(req, forwardEntryRequirement())
+			} else {
+				req.addListener(defaultString(node.Protocol, "tls"))
+				req.addHandler("relay")
+			}
+			for _, next := range dialed {
+				for _, target := range next {
+					req.addDialer(defaultString(target.Protocol, "tls"))
+				}
+				req.addConnector("relay")
+			}
+			out[node.NodeID] = req
+		}
+	}
+	return out
+}
+
+func validateTunnelCapabilities(state *tunnelCreateState) error {
+	if state == nil {
+		return nil
+	}
+	requirements := tunnelNodeRequirements(state)
+	for _, nodeID := range state.NodeIDList {
+		req, ok := requirements[nodeID]
+		if !ok {
+			continue
+		}
+		if err := validateNodeCapabilities(state.Nodes[nodeID], req); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package handler
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"go-backend/internal/store/repo"
+)
+
+func TestHelloWithoutManifestClearsStoredCapabilities(t *testing.T) {
+	r, err := repo.Open(filepath.Join(t.TempDir(), "capability.db"))
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	t.Cleanup(func() { _ = r.Close() })
+	h := New(r, "secret")
+	insertOfflineNode(t, r, 1, "legacy", "sniRouting")
+
+	// An agent rolled back to a build without manifests still says hello.
+	agent := connectFakeNodeAgent(t, h, 1, "legacy-secret")
+	agent.hello(t, map[string]interface{}{"schemaVersion": 1, "commands": []string{"UpdateService"}})
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		node, err := h.getNodeRecord(1)
+		if err != nil {
+			t.Fatalf("load node: %v", err)
+		}
+		if node.Capabilities == "" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the stale manifest to be cleared, got %s", node.Capabilities)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestMergedRequirementReportsEveryMissingCapability(t *testing.T) {
+	req := mergeNodeCapabilityRequirements(
+		muxRequirement(),
+		nodeCapabilityRequirement{Features: []string{"sniRouting", "geoip"}},
+		forwardEntryRequirement(),
+	)
+	if len(req.Features) != 2 || len(req.Listeners) != 2 || len(req.Handlers) != 2 {
+		t.Fatalf("expected duplicates to be merged, got %+v", req)
+	}
+	node := &nodeRecord{ID: 1, Name: "n1", Capabilities: `{"listeners":["tcp","udp"],"handlers":["tcp","udp"],"features":{}}`}
+	err := validateNodeCapabilities(node, req)
+	if err == nil || !strings.Contains(err.Error(), "feature:sniRouting, feature:geoip") {
+		t.Fatalf("expected both missing features in one error, got %v", err)
+	}
+}
+
+func TestOnlineHookWaitsForHello(t *testing.T) {
+	r, err := repo.Open(filepath.Join(t.TempDir(), "online-hook.db"))
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	t.Cleanup(func() { _ = r.Close() })
+	h := New(r, "secret")
+	insertOfflineNode(t, r, 1, "edge")
+
+	// The hook redeploys the node, so it must see the commands of the Hello.
+	supported := make(chan bool, 1)
+	h.wsServer.SetNodeOnlineHook(func(nodeID int64) {
+		supported <- h.wsServer.NodeSupportsCommand(nodeID, "UdpProbe")
+	})
+	agent := connectFakeNodeAgent(t, h, 1, "edge-secret")
+	select {
+	case <-supported:
+		t.Fatalf("expected the online hook to wait for the hello")
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	agent.hello(t, map[string]interface{}{"schemaVersion": 1, "commands": []string{"UpdateService"}})
+	select {
+	case ok := <-supported:
+		if ok {
+			t.Fatalf("expected the hook to see the capabilities of the hello")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("online hook did not run after the hello")
+	}
+}
@@ -0,0 +1,355 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-backend/internal/http/response"
+)
+
+const (
+	nodeDrainDefaultTimeout = 5 * time.Minute
+	nodeDrainMaxTimeout     = 2 * time.Hour
+	nodeDrainPollInterval   = 5 * time.Second
+	nodeDrainReportTTL      = 30 * time.Second
+
+	nodeDrainStatusDraining  = "draining"
+	nodeDrainStatusDrained   = "drained"
+	nodeDrainStatusTimeout   = "timeout"
+	nodeDrainStatusCancelled = "cancelled"
+)
+
+type nodeDrainState struct {
+	NodeID      int64  `json:"nodeId"`
+	Status      string `json:"status"`
+	StartedAt   int64  `json:"startedAt"`
+	Deadline    int64  `json:"deadline"`
+	FinishedAt  int64  `json:"finishedAt,omitempty"`
+	Connections int64  `json:"connections"`
+
+	stop chan struct{}
+}
+
+func (h *Handler) nodeMaintenance(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		response.WriteJSON(w, response.ErrDefault("请求失败"))
+		return
+	}
+
+	var req struct {
+		ID           int64 `json:"id"`
+		Enabled      bool  `json:"enabled"`
+		Drain        bool  `json:"drain"`
+		DrainTimeout int64 `json:"drainTimeout"`
+	}
+	if err := decodeJSON(r.Body, &req); err != nil {
+		response.WriteJSON(w, response.ErrDefault("请求参数错误"))
+		return
+	}
+	if req.ID <= 0 {
+		response.WriteJSON(w, response.ErrDefault("节点ID无效"))
+		return
+	}
+	node, err := h.getNodeRecord(req.ID)
+	if err != nil {
+		response.WriteJSON(w, response.Err(-2, err.Error()))
+		return
+	}
+
+	maintenance := 0
+	if req.Enabled {
+		maintenance = 1
+	}
+	if !req.Enabled || !req.Drain {
+		h.stopNodeDrain(req.ID)
+	}
+	if err := h.repo.UpdateNodeMaintenance(req.ID, maintenance); err != nil {
+		response.WriteJSON(w, response.Err(-2, err.Error()))
+		return
+	}
+
+	tunnelIDs, failed := h.refreshNodeTunnelChains(req.ID)
+
+	payload := map[string]interface{}{
+		"id":            req.ID,
+		"name":          node.Name,
+		"maintenance":   maintenance,
+		"tunnelCount":   len(tunnelIDs),
+		"failedTunnels": failed,
+	}
+	if req.Enabled && req.Drain {
+		payload["drain"] = h.startNodeDrain(req.ID, normalizeNodeDrainTimeout(req.DrainTimeout))
+	}
+	response.WriteJSON(w, response.OK(payload))
+}
+
+func (h *Handler) nodeMaintenanceStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		response.WriteJSON(w, response.ErrDefault("请求失败"))
+		return
+	}
+
+	var req struct {
+		ID int64 `json:"id"`
+	}
+	if err := decodeJSON(r.Body, &req); err != nil {
+		response.WriteJSON(w, response.ErrDefault("请求参数错误"))
+		return
+	}
+	if req.ID <= 0 {
+		response.WriteJSON(w, response.ErrDefault("节点ID无效"))
+		return
+	}
+	node, err := h.getNodeRecord(req.ID)
+	if err != nil {
+		response.WriteJSON(w, response.Err(-2, err.Error()))
+		return
+	}
+
+	payload := map[string]interface{}{
+		"id":          req.ID,
+		"maintenance": node.Maintenance,
+	}
+	if conns, ok := h.nodeActiveConnections(req.ID, time.Now(), false); ok {
+		payload["connections"] = conns
+	}
+	if drain := h.nodeDrainSnapshot(req.ID); drain != nil {
+		payload["drain"] = drain
+	}
+	response.WriteJSON(w, response.OK(payload))
+}
+
+// refreshNodeTunnelChains re-pushes chains_<id> for every active tunnel the
+// node participates in so hop selection picks up its maintenance flag.
+func (h *Handler) refreshNodeTunnelChains(nodeID int64) ([]int64, []map[string]interface{}) {
+	failed := make([]map[string]interface{}, 0)
+	tunnelIDs, err := h.repo.ListActiveTunnelIDsByNode(nodeID)
+	if err != nil {
+		failed = append(failed, map[string]interface{}{"tunnelId": 0, "message": err.Error()})
+		return nil, failed
+	}
+	for _, tunnelID := range tunnelIDs {
+		if err := h.refreshTunnelChains(tunnelID); err != nil {
+			failed = append(failed, map[string]interface{}{"tunnelId": tunnelID, "message": err.Error()})
+		}
+	}
+	return tunnelIDs, failed
+}
+
+// refreshTunnelChains only updates the chains on entry and hop nodes; the
+// relay services stay up so established connections are not cut.
+func (h *Handler) refreshTunnelChains(tunnelID int64) error {
+	state, err := h.reconstructTunnelState(tunnelID)
+	if err != nil {
+		return err
+	}
+	if state.Type != 2 {
+		return nil
+	}
+
+	for _, inNode := range state.InNodes {
+		chainData, err := buildTunnelEntryChainConfig(state, inNode.NodeID)
+		if err != nil {
+			return err
+		}
+		if _, err := h.sendNodeCommand(inNode.NodeID, "UpdateChains", chainData, false, false); err != nil {
+			if node := state.Nodes[inNode.NodeID]; node != nil && node.IsRemote == 1 && shouldDeferTunnelRuntimeApplyError(err) {
+				continue
+			}
+			return fmt.Errorf("入口节点 %s 更新转发链失败: %w", nodeDisplayName(state.Nodes[inNode.NodeID]), err)
+		}
+	}
+
+	if !state.hopNodesRunChains() {
+		return nil
+	}
+	for i, hop := range state.ChainHops {
+		nextTargets := state.OutNodes
+		if i+1 < len(state.ChainHops) {
+			nextTargets = state.ChainHops[i+1]
+		}
+		for _, chainNode := range hop {
+			if node := state.Nodes[chainNode.NodeID]; node != nil && node.IsRemote == 1 {
+				continue
+			}
+			chainData, err := buildTunnelChainConfig(state, chainNode.NodeID, activeTunnelTargets(nextTargets, state.Nodes))
+			if err != nil {
+				return err
+			}
+			if _, err := h.sendNodeCommand(chainNode.NodeID, "UpdateChains", chainData, false, false); err != nil {
+				return fmt.Errorf("转发链节点 %s 更新转发链失败: %w", nodeDisplayName(state.Nodes[chainNode.NodeID]), err)
+			}
+		}
+	}
+	return nil
+}
+
+// activeTunnelTargets drops nodes in maintenance from a hop group. When every
+// node of the group is in maintenance the group is kept as-is so the tunnel
+// stays routable.
+func activeTunnelTargets(targets []tunnelRuntimeNode, nodes map[int64]*nodeRecord) []tunnelRuntimeNode {
+	active := make([]tunnelRuntimeNode, 0, len(targets))
+	for _, target := range targets {
+		if node := nodes[target.NodeID]; node != nil && node.Maintenance == 1 {
+			continue
+		}
+		active = append(active, target)
+	}
+	if len(active) == 0 {
+		return targets
+	}
+	return active
+}
+
+func validateNodePlacement(node *nodeRecord) error {
+	if node != nil && node.Maintenance == 1 {
+		return fmt.Errorf("节点 %s 处于维护模式，暂不接受新的转发", nodeDisplayName(node))
+	}
+	return nil
+}
+
+func normalizeNodeDrainTimeout(seconds int64) time.Duration {
+	if seconds <= 0 {
+		return nodeDrainDefaultTimeout
+	}
+	timeout := time.Duration(seconds) * time.Second
+	if timeout > nodeDrainMaxTimeout {
+		return nodeDrainMaxTimeout
+	}
+	return timeout
+}
+
+// nodeActiveConnections sums the current connections of the services in the
+// node's latest telemetry report, only of the tunnel relay services when
+// relayOnly is set. ok is false when no fresh report exists.
+func (h *Handler) nodeActiveConnections(nodeID int64, now time.Time, relayOnly bool) (int64, bool) {
+	h.metricsMu.Lock()
+	defer h.metricsMu.Unlock()
+	acc := h.nodeMetrics[nodeID]
+	if acc == nil || acc.lastReport == nil || now.UnixMilli()-acc.lastAt > nodeDrainReportTTL.Milliseconds() {
+		return 0, false
+	}
+	var total int64
+	for _, svc := range acc.lastReport.Services {
+		if relayOnly && !isTunnelRelayService(svc.Name) {
+			continue
+		}
+		total += int64(svc.CurrentConns)
+	}
+	return total, true
+}
+
+// isTunnelRelayService matches the <tunnelID>_tls service a hop or exit node
+// runs for a tunnel.
+func isTunnelRelayService(name string) bool {
+	id, ok := strings.CutSuffix(name, "_tls")
+	if !ok || id == "" {
+		return false
+	}
+	_, err := strconv.ParseInt(id, 10, 64)
+	return err == nil
+}
+
+// startNodeDrain waits for the tunnel traffic relayed by the node to finish.
+// Maintenance only takes the node out of hop selection, so the drain covers
+// hop and exit traffic: entry services keep accepting because clients dial
+// them directly, and their connections are not counted.
+func (h *Handler) startNodeDrain(nodeID int64, timeout time.Duration) nodeDrainState {
+	now := time.Now()
+	state := &nodeDrainState{
+		NodeID:    nodeID,
+		Status:    nodeDrainStatusDraining,
+		StartedAt: now.UnixMilli(),
+		Deadline:  now.Add(timeout).UnixMilli(),
+		stop:      make(chan struct{}),
+	}
+	if conns, ok := h.nodeActiveConnections(nodeID, now, true); ok {
+		state.Connections = conns
+	}
+
+	h.maintenanceMu.Lock()
+	if prev := h.nodeDrains[nodeID]; prev != nil && prev.Status == nodeDrainStatusDraining {
+		close(prev.stop)
+		prev.Status = nodeDrainStatusCancelled
+		prev.FinishedAt = now.UnixMilli()
+	}
+	h.nodeDrains[nodeID] = state
+	snapshot := *state
+	h.maintenanceMu.Unlock()
+
+	go h.runNodeDrain(state)
+	return snapshot
+}
+
+func (h *Handler) runNodeDrain(state *nodeDrainState) {
+	ticker := time.NewTicker(nodeDrainPollInterval)
+	defer ticker.Stop()
+
+	for {
+		if h.checkNodeDrain(state, time.Now()) {
+			return
+		}
+		select {
+		case <-state.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// checkNodeDrain updates the drain state and reports whether it is finished.
+// Only a fresh report without relay connections counts as drained: a node
+// without fresh telemetry may still carry traffic, so it waits for the
+// deadline. At the deadline the drain stops waiting with status timeout. The
+// node stays in maintenance and Connections keeps the last count reported,
+// leaving it to the operator to proceed and cut what is left.
+func (h *Handler) checkNodeDrain(state *nodeDrainState, now time.Time) bool {
+	conns, ok := h.nodeActiveConnections(state.NodeID, now, true)
+
+	h.maintenanceMu.Lock()
+	defer h.maintenanceMu.Unlock()
+	if state.Status != nodeDrainStatusDraining {
+		return true
+	}
+	if ok {
+		state.Connections = conns
+	}
+	switch {
+	case ok && conns == 0:
+		state.Status = nodeDrainStatusDrained
+	case now.UnixMilli() >= state.Deadline:
+		state.Status = nodeDrainStatusTimeout
+	default:
+		return false
+	}
+	state.FinishedAt = now.UnixMilli()
+	return true
+}
+
+func (h *Handler) stopNodeDrain(nodeID int64) {
+	h.maintenanceMu.Lock()
+	defer h.maintenanceMu.Unlock()
+	state := h.nodeDrains[nodeID]
+	if state == nil {
+		return
+	}
+	if state.Status == nodeDrainStatusDraining {
+		close(state.stop)
+	}
+	delete(h.nodeDrains, nodeID)
+}
+
+func (h *Handler) nodeDrainSnapshot(nodeID int64) *nodeDrainState {
+	h.maintenanceMu.Lock()
+	defer h.maintenanceMu.Unlock()
+	state := h.nodeDrains[nodeID]
+	if state == nil {
+		return nil
+	}
+	snapshot := *state
+	snapshot.stop = nil
+	return &snapshot
+}
@@ -0,0 +1,79 @@
+package handler
+
+import (
+	"testing"
+	"time"
+)
+
+func TestActiveTunnelTargetsSkipsMaintenanceNodes(t *testing.T) {
+	nodes := map[int64]*nodeRecord{
+		1: {ID: 1, Name: "a"},
+		2: {ID: 2, Name: "b", Maintenance: 1},
+		3: {ID: 3, Name: "c", Maintenance: 1},
+	}
+
+	got := activeTunnelTargets([]tunnelRuntimeNode{{NodeID: 1}, {NodeID: 2}}, nodes)
+	if len(got) != 1 || got[0].NodeID != 1 {
+		t.Fatalf("expected only node 1 to remain, got %+v", got)
+	}
+
+	all := []tunnelRuntimeNode{{NodeID: 2}, {NodeID: 3}}
+	got = activeTunnelTargets(all, nodes)
+	if len(got) != 2 {
+		t.Fatalf("expected group to be kept when every node is in maintenance, got %+v", got)
+	}
+}
+
+func TestCheckNodeDrain(t *testing.T) {
+	h := &Handler{
+		nodeMetrics: make(map[int64]*nodeMetricAccumulator),
+		nodeDrains:  make(map[int64]*nodeDrainState),
+	}
+	now := time.Date(2026, 5, 1, 10, 0, 0, 0, time.UTC)
+	report := &nodeInfoReport{Services: []nodeServiceReport{
+		{Name: "1_tls", CurrentConns: 4},
+		{Name: "3_2_5_tcp", CurrentConns: 7},
+		{Name: "mux_443_tcp", CurrentConns: 2},
+	}}
+	h.nodeMetrics[9] = &nodeMetricAccumulator{lastAt: now.UnixMilli(), lastReport: report}
+
+	state := &nodeDrainState{NodeID: 9, Status: nodeDrainStatusDraining, Deadline: now.Add(time.Minute).UnixMilli()}
+	if h.checkNodeDrain(state, now) {
+		t.Fatalf("expected drain to continue while connections are active")
+	}
+	if state.Connections != 4 {
+		t.Fatalf("expected 4 active relay connections, got %d", state.Connections)
+	}
+	if conns, _ := h.nodeActiveConnections(9, now, false); conns != 13 {
+		t.Fatalf("expected 13 active connections, got %d", conns)
+	}
+
+	// Entry services keep accepting during maintenance and do not hold up the
+	// drain.
+	report.Services[0].CurrentConns = 0
+	if !h.checkNodeDrain(state, now) || state.Status != nodeDrainStatusDrained {
+		t.Fatalf("expected an entry-only node to drain, got %q", state.Status)
+	}
+	report.Services[0].CurrentConns = 4
+	state = &nodeDrainState{NodeID: 9, Status: nodeDrainStatusDraining, Deadline: now.Add(time.Minute).UnixMilli()}
+
+	// A node without fresh telemetry may still relay traffic: the drain keeps
+	// the last count and waits for the deadline.
+	h.checkNodeDrain(state, now)
+	if h.checkNodeDrain(state, now.Add(59*time.Second)) || state.Connections != 4 {
+		t.Fatalf("expected stale telemetry to keep the drain waiting, got %q with %d", state.Status, state.Connections)
+	}
+	if !h.checkNodeDrain(state, now.Add(2*time.Minute)) || state.Status != nodeDrainStatusTimeout || state.Connections != 4 {
+		t.Fatalf("expected stale telemetry to time out, got %q with %d", state.Status, state.Connections)
+	}
+
+	h.nodeMetrics[9].lastAt = now.Add(2 * time.Minute).UnixMilli()
+	state = &nodeDrainState{NodeID: 9, Status: nodeDrainStatusDraining, Deadline: now.Add(time.Minute).UnixMilli()}
+	if !h.checkNodeDrain(state, now.Add(2*time.Minute)) || state.Status != nodeDrainStatusTimeout {
+		t.Fatalf("expected drain to time out, got %q", state.Status)
+	}
+
+	if got := normalizeNodeDrainTimeout(0); got != nodeDrainDefaultTimeout {
+		t.Fatalf("expected default drain timeout, got %v", got)
+	}
+}
@@ -0,0 +1,418 @@
+package handler
+
+import (
+	"database/sql"
+	"encoding/json"
+	"math"
+	"net/http"
+	"sort"
+	"time"
+
+	"go-backend/internal/http/response"
+	"go-backend/internal/store/model"
+)
+
+const (
+	nodeMetricBucket     = time.Minute
+	nodeMetricRetention  = 7 * 24 * time.Hour
+	nodeMetricMaxPoints  = 720
+	nodeMetricDefaultWin = 24 * time.Hour
+)
+
+type nodeInfoReport struct {
+	BytesReceived    uint64    `json:"bytes_received"`
+	BytesTransmitted uint64    `json:"bytes_transmitted"`
+	CPUUsage         float64   `json:"cpu_usage"`
+	MemoryUsage      float64   `json:"memory_usage"`
+	CPUCores         []float64 `json:"cpu_cores"`
+	Interfaces       []struct {
+		Name             string `json:"name"`
+		BytesReceived    uint64 `json:"bytes_received"`
+		BytesTransmitted uint64 `json:"bytes_transmitted"`
+	} `json:"interfaces"`
+	Load struct {
+		Load1  float64 `json:"load1"`
+		Load5  float64 `json:"load5"`
+		Load15 float64 `json:"load15"`
+	} `json:"load"`
+	Disk struct {
+		Path  string  `json:"path"`
+		Total uint64  `json:"total"`
+		Used  uint64  `json:"used"`
+		Usage float64 `json:"usage"`
+	} `json:"disk"`
+	Sockets struct {
+		TCP int `json:"tcp"`
+		UDP int `json:"udp"`
+	} `json:"sockets"`
+	Services []nodeServiceReport `json:"services"`
+	Health   []nodeHealthReport  `json:"health"`
+	Limiters []nodeLimiterReport `json:"limiters"`
+}
+
+type nodeServiceReport struct {
+	Name         string `json:"name"`
+	CurrentConns uint64 `json:"current_conns"`
+	TotalConns   uint64 `json:"total_conns"`
+	TotalErrs    uint64 `json:"total_errs"`
+}
+
+type nodeTrafficCounter struct {
+	rx uint64
+	tx uint64
+}
+
+// nodeMetricAccumulator folds the 2s agent reports into one row per bucket.
+type nodeMetricAccumulator struct {
+	bucket    int64
+	samples   int
+	cpu       float64
+	mem       float64
+	disk      float64
+	load1     float64
+	load5     float64
+	load15    float64
+	tcp       int64
+	udp       int64
+	conns     int64
+	rxBytes   uint64
+	txBytes   uint64
+	elapsedMs int64
+	ifaces    map[string]nodeTrafficCounter
+
+	lastAt     int64
+	lastTotal  nodeTrafficCounter
+	lastIfaces map[string]nodeTrafficCounter
+	lastReport *nodeInfoReport
+}
+
+func (h *Handler) onNodeInfo(nodeID int64, payload []byte) {
+	h.recordNodeInfo(nodeID, payload, time.Now())
+}
+
+func (h *Handler) recordNodeInfo(nodeID int64, payload []byte, now time.Time) {
+	if h == nil || h.repo == nil || nodeID <= 0 {
+		return
+	}
+	var report nodeInfoReport
+	if err := json.Unmarshal(payload, &report); err != nil {
+		return
+	}
+
+	nowMs := now.UnixMilli()
+	bucket := now.Truncate(nodeMetricBucket).UnixMilli()
+
+	h.metricsMu.Lock()
+	acc := h.nodeMetrics[nodeID]
+	if acc == nil {
+		acc = &nodeMetricAccumulator{}
+		h.nodeMetrics[nodeID] = acc
+	}
+	var flushed *model.NodeMetric
+	if acc.bucket != bucket {
+		if acc.samples > 0 {
+			flushed = acc.flush(nodeID)
+		}
+		acc.reset(bucket)
+	}
+	acc.add(&report, nowMs)
+	h.metricsMu.Unlock()
+
+	if flushed != nil {
+		_ = h.repo.InsertNodeMetric(flushed)
+	}
+}
+
+// onNodeOffline stores the partial bucket of a node that disconnected, so the
+// reports received before the disconnect are not lost. A reconnect starts a
+// new accumulator; the history query merges rows sharing a bucket.
+func (h *Handler) onNodeOffline(nodeID int64) {
+	h.metricsMu.Lock()
+	acc := h.nodeMetrics[nodeID]
+	delete(h.nodeMetrics, nodeID)
+	h.metricsMu.Unlock()
+
+	if acc != nil && acc.samples > 0 {
+		_ = h.repo.InsertNodeMetric(acc.flush(nodeID))
+	}
+}
+
+// forgetNodeMetrics drops the accumulator of a deleted node. Its partial
+// bucket is discarded along with the node's stored rows.
+func (h *Handler) forgetNodeMetrics(nodeID int64) {
+	h.metricsMu.Lock()
+	defer h.metricsMu.Unlock()
+	delete(h.nodeMetrics, nodeID)
+}
+
+func (a *nodeMetricAccumulator) reset(bucket int64) {
+	a.bucket = bucket
+	a.samples = 0
+	a.cpu, a.mem, a.disk = 0, 0, 0
+	a.load1, a.load5, a.load15 = 0, 0, 0
+	a.tcp, a.udp, a.conns = 0, 0, 0
+	a.rxBytes, a.txBytes, a.elapsedMs = 0, 0, 0
+	a.ifaces = make(map[string]nodeTrafficCounter)
+}
+
+func (a *nodeMetricAccumulator) add(report *nodeInfoReport, nowMs int64) {
+	a.samples++
+	a.cpu += report.CPUUsage
+	a.mem += report.MemoryUsage
+	a.disk += report.Disk.Usage
+	a.load1 += report.Load.Load1
+	a.load5 += report.Load.Load5
+	a.load15 += report.Load.Load15
+	a.tcp += int64(report.Sockets.TCP)
+	a.udp += int64(report.Sockets.UDP)
+	for _, svc := range report.Services {
+		a.conns += int64(svc.CurrentConns)
+	}
+
+	// Counters are cumulative; a decrease means the agent or host restarted.
+	// A delta spanning more than a bucket covers a gap in the reports, e.g. a
+	// reconnect, and would be credited to this bucket alone, so it only
+	// re-establishes the baseline.
+	if a.lastAt > 0 && nowMs > a.lastAt && nowMs-a.lastAt <= nodeMetricBucket.Milliseconds() &&
+		report.BytesReceived >= a.lastTotal.rx && report.BytesTransmitted >= a.lastTotal.tx {
+		a.rxBytes += report.BytesReceived - a.lastTotal.rx
+		a.txBytes += report.BytesTransmitted - a.lastTotal.tx
+		a.elapsedMs += nowMs - a.lastAt
+		for _, iface := range report.Interfaces {
+			last, ok := a.lastIfaces[iface.Name]
+			if !ok || iface.BytesReceived < last.rx || iface.BytesTransmitted < last.tx {
+				continue
+			}
+			cur := a.ifaces[iface.Name]
+			cur.rx += iface.BytesReceived - last.rx
+			cur.tx += iface.BytesTransmitted - last.tx
+			a.ifaces[iface.Name] = cur
+		}
+	}
+
+	a.lastAt = nowMs
+	a.lastTotal = nodeTrafficCounter{rx: report.BytesReceived, tx: report.BytesTransmitted}
+	a.lastIfaces = make(map[string]nodeTrafficCounter, len(report.Interfaces))
+	for _, iface := range report.Interfaces {
+		a.lastIfaces[iface.Name] = nodeTrafficCounter{rx: iface.BytesReceived, tx: iface.BytesTransmitted}
+	}
+	a.lastReport = report
+}
+
+func (a *nodeMetricAccumulator) flush(nodeID int64) *model.NodeMetric {
+	n := float64(a.samples)
+	metric := &model.NodeMetric{
+		NodeID:      nodeID,
+		Time:        a.bucket,
+		Samples:     a.samples,
+		CPUUsage:    roundMetric(a.cpu / n),
+		MemoryUsage: roundMetric(a.mem / n),
+		DiskUsage:   roundMetric(a.disk / n),
+		Load1:       roundMetric(a.load1 / n),
+		Load5:       roundMetric(a.load5 / n),
+		Load15:      roundMetric(a.load15 / n),
+		TCPSockets:  int(a.tcp / int64(a.samples)),
+		UDPSockets:  int(a.udp / int64(a.samples)),
+		Connections: a.conns / int64(a.samples),
+	}
+	if a.elapsedMs > 0 {
+		metric.RxBps = int64(a.rxBytes * 1000 / uint64(a.elapsedMs))
+		metric.TxBps = int64(a.txBytes * 1000 / uint64(a.elapsedMs))
+	}
+
+	detail := map[string]interface{}{}
+	if a.elapsedMs > 0 && len(a.ifaces) > 0 {
+		names := make([]string, 0, len(a.ifaces))
+		for name := range a.ifaces {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		ifaces := make([]map[string]interface{}, 0, len(names))
+		for _, name := range names {
+			c := a.ifaces[name]
+			ifaces = append(ifaces, map[string]interface{}{
+				"name":  name,
+				"rxBps": c.rx * 1000 / uint64(a.elapsedMs),
+				"txBps": c.tx * 1000 / uint64(a.elapsedMs),
+			})
+		}
+		detail["interfaces"] = ifaces
+	}
+	if a.lastReport != nil {
+		if len(a.lastReport.CPUCores) > 0 {
+			detail["cpuCores"] = a.lastReport.CPUCores
+		}
+		if a.lastReport.Disk.Total > 0 {
+			detail["disk"] = map[string]interface{}{
+				"path":  a.lastReport.Disk.Path,
+				"total": a.lastReport.Disk.Total,
+				"used":  a.lastReport.Disk.Used,
+			}
+		}
+		if len(a.lastReport.Services) > 0 {
+			services := make([]map[string]interface{}, 0, len(a.lastReport.Services))
+			for _, svc := range a.lastReport.Services {
+				services = append(services, map[string]interface{}{
+					"name":         svc.Name,
+					"currentConns": svc.CurrentConns,
+					"totalConns":   svc.TotalConns,
+					"totalErrs":    svc.TotalErrs,
+				})
+			}
+			detail["services"] = services
+		}
+	}
+	if len(detail) > 0 {
+		if raw, err := json.Marshal(detail); err == nil {
+			metric.Detail = sql.NullString{String: string(raw), Valid: true}
+		}
+	}
+	return metric
+}
+
+func roundMetric(v float64) float64 {
+	return math.Round(v*100) / 100
+}
+
+func (h *Handler) runNodeMetricsRetentionJob(now time.Time) {
+	if h == nil || h.repo == nil {
+		return
+	}
+	_ = h.repo.PurgeOldNodeMetrics(now.Add(-nodeMetricRetention).UnixMilli())
+}
+
+func (h *Handler) nodeMetricsHistory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		response.WriteJSON(w, response.ErrDefault("请求失败"))
+		return
+	}
+	var req map[string]interface{}
+	if err := decodeJSON(r.Body, &req); err != nil {
+		response.WriteJSON(w, response.ErrDefault("请求参数错误"))
+		return
+	}
+	nodeID := asInt64(req["nodeId"], 0)
+	if nodeID <= 0 {
+		response.WriteJSON(w, response.ErrDefault("节点ID不能为空"))
+		return
+	}
+	node, err := h.getNodeRecord(nodeID)
+	if err != nil || node == nil {
+		response.WriteJSON(w, response.ErrDefault("节点不存在"))
+		return
+	}
+
+	end := asInt64(req["end"], 0)
+	if end <= 0 {
+		end = time.Now().UnixMilli()
+	}
+	start := asInt64(req["start"], 0)
+	if start <= 0 || start >= end {
+		start = end - nodeMetricDefaultWin.Milliseconds()
+	}
+	interval := normalizeNodeMetricInterval(asInt64(req["interval"], 0), end-start)
+
+	rows, err := h.repo.ListNodeMetrics(nodeID, start, end)
+	if err != nil {
+		response.WriteJSON(w, response.Err(-2, err.Error()))
+		return
+	}
+
+	payload := map[string]interface{}{
+		"nodeId":   nodeID,
+		"start":    start,
+		"end":      end,
+		"interval": interval,
+		"points":   downsampleNodeMetrics(rows, interval*1000),
+	}
+	if len(rows) > 0 {
+		latest := rows[len(rows)-1]
+		if latest.Detail.Valid {
+			var detail map[string]interface{}
+			if json.Unmarshal([]byte(latest.Detail.String), &detail) == nil {
+				payload["latest"] = detail
+			}
+		}
+	}
+	response.WriteJSON(w, response.OK(payload))
+}
+
+// normalizeNodeMetricInterval returns the bucket size in seconds, widened so a
+// response never exceeds nodeMetricMaxPoints points.
+func normalizeNodeMetricInterval(requested int64, rangeMs int64) int64 {
+	minInterval := int64(nodeMetricBucket / time.Second)
+	interval := requested
+	if interval < minInterval {
+		interval = minInterval
+	}
+	if rangeMs > 0 {
+		needed := int64(math.Ceil(float64(rangeMs) / 1000 / nodeMetricMaxPoints))
+		if needed > interval {
+			interval = needed
+		}
+	}
+	if rem := interval % minInterval; rem != 0 {
+		interval += minInterval - rem
+	}
+	return interval
+}
+
+func downsampleNodeMetrics(rows []model.NodeMetric, intervalMs int64) []map[string]interface{} {
+	points := make([]map[string]interface{}, 0)
+	if intervalMs <= 0 {
+		intervalMs = nodeMetricBucket.Milliseconds()
+	}
+
+	var (
+		current int64 = -1
+		group   []model.NodeMetric
+	)
+	emit := func() {
+		if len(group) == 0 {
+			return
+		}
+		n := float64(len(group))
+		var cpu, mem, disk, l1, l5, l15 float64
+		var rx, tx, tcp, udp, conns int64
+		for _, m := range group {
+			cpu += m.CPUUsage
+			mem += m.MemoryUsage
+			disk += m.DiskUsage
+			l1 += m.Load1
+			l5 += m.Load5
+			l15 += m.Load15
+			rx += m.RxBps
+			tx += m.TxBps
+			tcp += int64(m.TCPSockets)
+			udp += int64(m.UDPSockets)
+			conns += m.Connections
+		}
+		count := int64(len(group))
+		points = append(points, map[string]interface{}{
+			"time":        current,
+			"cpuUsage":    roundMetric(cpu / n),
+			"memoryUsage": roundMetric(mem / n),
+			"diskUsage":   roundMetric(disk / n),
+			"load1":       roundMetric(l1 / n),
+			"load5":       roundMetric(l5 / n),
+			"load15":      roundMetric(l15 / n),
+			"rxBps":       rx / count,
+			"txBps":       tx / count,
+			"tcpSockets":  tcp / count,
+			"udpSockets":  udp / count,
+			"connections": conns / count,
+		})
+		group = group[:0]
+	}
+
+	for _, row := range rows {
+		bucket := row.Time - row.Time%intervalMs
+		if bucket != current {
+			emit()
+			current = bucket
+		}
+		group = append(group, row)
+	}
+	emit()
+	return points
+}
@@ -0,0 +1,165 @@
+package handler
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go-backend/internal/store/model"
+	"go-backend/internal/store/repo"
+)
+
+func TestRecordNodeInfoFlushesPerMinuteBucket(t *testing.T) {
+	r, err := repo.Open(filepath.Join(t.TempDir(), "node-metrics.db"))
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	t.Cleanup(func() { _ = r.Close() })
+
+	h := New(r, "secret")
+	base := time.Date(2026, 5, 1, 10, 0, 0, 0, time.UTC)
+	report := func(rx, tx uint64, cpu float64, conns int) []byte {
+		return []byte(fmt.Sprintf(`{"bytes_received":%d,"bytes_transmitted":%d,"cpu_usage":%v,"memory_usage":50,`+
+			`"interfaces":[{"name":"eth0","bytes_received":%d,"bytes_transmitted":%d}],`+
+			`"load":{"load1":1.5},"disk":{"path":"/","total":100,"used":40,"usage":40},"sockets":{"tcp":12,"udp":3},`+
+			`"services":[{"name":"1_2_3_tcp","current_conns":%d}]}`, rx, tx, cpu, rx, tx, conns))
+	}
+
+	h.recordNodeInfo(7, report(1000, 500, 10, 2), base.Add(10*time.Second))
+	h.recordNodeInfo(7, report(3000, 1500, 30, 4), base.Add(20*time.Second))
+	if got := mustQueryInt(t, r, `SELECT COUNT(1) FROM node_metric`); got != 0 {
+		t.Fatalf("expected no row before bucket rollover, got %d", got)
+	}
+
+	h.recordNodeInfo(7, report(4000, 2000, 50, 6), base.Add(70*time.Second))
+
+	rows, err := r.ListNodeMetrics(7, 0, base.Add(time.Hour).UnixMilli())
+	if err != nil {
+		t.Fatalf("list metrics: %v", err)
+	}
+	if len(rows) != 1 {
+		t.Fatalf("expected 1 flushed row, got %d", len(rows))
+	}
+	row := rows[0]
+	if row.Time != base.UnixMilli() || row.Samples != 2 {
+		t.Fatalf("unexpected bucket/sample count: %+v", row)
+	}
+	if row.CPUUsage != 20 || row.Connections != 3 || row.TCPSockets != 12 {
+		t.Fatalf("unexpected averages: %+v", row)
+	}
+	if row.RxBps != 200 || row.TxBps != 100 {
+		t.Fatalf("expected rx/tx 200/100 B/s, got %d/%d", row.RxBps, row.TxBps)
+	}
+	if !row.Detail.Valid {
+		t.Fatalf("expected detail json to be stored")
+	}
+}
+
+func TestDownsampleNodeMetrics(t *testing.T) {
+	rows := []model.NodeMetric{
+		{Time: 0, CPUUsage: 10, RxBps: 100},
+		{Time: 60_000, CPUUsage: 30, RxBps: 300},
+		{Time: 300_000, CPUUsage: 50, RxBps: 500},
+	}
+	points := downsampleNodeMetrics(rows, 300_000)
+	if len(points) != 2 {
+		t.Fatalf("expected 2 points, got %d", len(points))
+	}
+	if points[0]["cpuUsage"] != 20.0 || points[0]["rxBps"] != int64(200) {
+		t.Fatalf("unexpected first point: %v", points[0])
+	}
+
+	if got := normalizeNodeMetricInterval(0, int64((24 * time.Hour).Milliseconds())); got != 120 {
+		t.Fatalf("expected 24h window to widen to 120s buckets, got %d", got)
+	}
+	if got := normalizeNodeMetricInterval(90, 0); got != 120 {
+		t.Fatalf("expected interval rounded up to whole minutes, got %d", got)
+	}
+}
+
+func TestRecordNodeInfoSkipsDeltaAcrossReportGap(t *testing.T) {
+	r, err := repo.Open(filepath.Join(t.TempDir(), "node-metrics-gap.db"))
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	t.Cleanup(func() { _ = r.Close() })
+
+	h := New(r, "secret")
+	base := time.Date(2026, 5, 1, 10, 0, 0, 0, time.UTC)
+	report := func(rx uint64) []byte {
+		return []byte(fmt.Sprintf(`{"bytes_received":%d,"bytes_transmitted":%d}`, rx, rx))
+	}
+
+	// The agent was away for five minutes; the bytes it moved meanwhile must
+	// not be averaged into the bucket it came back in.
+	h.recordNodeInfo(7, report(1000), base.Add(50*time.Second))
+	h.recordNodeInfo(7, report(601000), base.Add(5*time.Minute+10*time.Second))
+	h.recordNodeInfo(7, report(603000), base.Add(5*time.Minute+20*time.Second))
+	h.recordNodeInfo(7, report(604000), base.Add(6*time.Minute+10*time.Second))
+
+	rows, err := r.ListNodeMetrics(7, base.Add(5*time.Minute).UnixMilli(), base.Add(time.Hour).UnixMilli())
+	if err != nil {
+		t.Fatalf("list metrics: %v", err)
+	}
+	if len(rows) != 1 || rows[0].Samples != 2 || rows[0].RxBps != 200 {
+		t.Fatalf("expected only the 10s delta inside the bucket, got %+v", rows)
+	}
+}
+
+func TestDeleteNodeDropsMetricAccumulator(t *testing.T) {
+	r, err := repo.Open(filepath.Join(t.TempDir(), "node-metrics-delete.db"))
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	t.Cleanup(func() { _ = r.Close() })
+
+	h := New(r, "secret")
+	insertOfflineNode(t, r, 7, "metrics-node")
+	h.recordNodeInfo(7, []byte(`{"bytes_received":1000}`), time.Now())
+	h.startNodeDrain(7, time.Minute)
+
+	if err := h.deleteNodeByID(7); err != nil {
+		t.Fatalf("delete node: %v", err)
+	}
+	h.metricsMu.Lock()
+	_, ok := h.nodeMetrics[7]
+	h.metricsMu.Unlock()
+	if ok {
+		t.Fatalf("expected the deleted node's accumulator to be dropped")
+	}
+	if h.nodeDrainSnapshot(7) != nil {
+		t.Fatalf("expected the deleted node's drain to be dropped")
+	}
+}
+
+func TestNodeDisconnectFlushesOpenBucket(t *testing.T) {
+	r, err := repo.Open(filepath.Join(t.TempDir(), "node-metrics-offline.db"))
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	t.Cleanup(func() { _ = r.Close() })
+	h := New(r, "secret")
+	insertOfflineNode(t, r, 7, "edge")
+
+	agent := connectFakeNodeAgent(t, h, 7, "edge-secret")
+	h.recordNodeInfo(7, []byte(`{"cpu_usage":30,"memory_usage":50}`), time.Now())
+	if got := mustQueryInt(t, r, `SELECT COUNT(1) FROM node_metric`); got != 0 {
+		t.Fatalf("expected no row before the node disconnects, got %d", got)
+	}
+
+	_ = agent.conn.Close()
+	deadline := time.Now().Add(2 * time.Second)
+	for mustQueryInt(t, r, `SELECT COUNT(1) FROM node_metric WHERE node_id = 7`) != 1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the open bucket to be stored when the node disconnects")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	h.metricsMu.Lock()
+	_, kept := h.nodeMetrics[7]
+	h.metricsMu.Unlock()
+	if kept {
+		t.Fatalf("expected the accumulator to be dropped with the session")
+	}
+}
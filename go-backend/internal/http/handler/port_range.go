@@ -0,0 +1,200 @@
+package handler
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// A forward may listen on a run of consecutive entry ports. The port stored in
+// forward_port is the first one, and each entry port maps to the port at the
+// same offset from the target's port, so 27015-27030 -> host:37015 forwards
+// 27016 to host:37016. Every port gets its own tcp and udp services named
+// after the forward, so their traffic is accounted under the one forward.
+const maxForwardPortCount = 1000
+
+func forwardPortCount(forward *forwardRecord) int {
+	if forward == nil || forward.PortCount < 1 {
+		return 1
+	}
+	return forward.PortCount
+}
+
+// parsePortCountInput reads portCount; 0 and 1 both mean a single port.
+func parsePortCountInput(req map[string]interface{}) (count int, present bool, err error) {
+	count, present, err = parseConnLimitInput(req, "portCount", maxForwardPortCount, "端口数量")
+	if err != nil {
+		return 0, true, err
+	}
+	if count < 1 {
+		count = 1
+	}
+	return count, present, nil
+}
+
+// validateForwardPortRange checks that the entry ports and every target's
+// shifted ports stay within 1-65535.
+func validateForwardPortRange(port, count int, remoteAddr string) error {
+	if count <= 1 {
+		return nil
+	}
+	if port+count-1 > 65535 {
+		return fmt.Errorf("端口段 %d-%d 超出有效范围", port, port+count-1)
+	}
+	for _, target := range splitRemoteTargets(remoteAddr) {
+		_, rawPort, err := net.SplitHostPort(target)
+		if err != nil {
+			return fmt.Errorf("目标地址 %s 格式错误", target)
+		}
+		targetPort, err := strconv.Atoi(rawPort)
+		if err != nil || targetPort+count-1 > 65535 {
+			return fmt.Errorf("目标地址 %s 的端口段超出有效范围", target)
+		}
+	}
+	return nil
+}
+
+func portSpanFree(start, count int, allowed, used map[int]bool) bool {
+	for p := start; p < start+count; p++ {
+		if !allowed[p] || used[p] {
+			return false
+		}
+	}
+	return true
+}
+
+// validatePortRangeOnNode rejects a range that overlaps ports taken by other
+// forwards or tunnel chains. Two single ports are left to the agent, as before
+// ranges existed, so host-routed forwards can still share one.
+func (h *Handler) validatePortRangeOnNode(node *nodeRecord, forwardID int64, port, count int) error {
+	if err := validateRemoteNodePort(node, port+count-1); err != nil {
+		return err
+	}
+	spans, err := h.repo.ListNodePortSpans(node.ID)
+	if err != nil {
+		return err
+	}
+	for _, span := range spans {
+		if forwardID > 0 && span.ForwardID == forwardID {
+			continue
+		}
+		if count == 1 && span.Count == 1 {
+			continue
+		}
+		if port < span.Port+span.Count && span.Port < port+count {
+			return fmt.Errorf("节点 %s 的端口 %s 与已占用的端口 %s 冲突", node.Name, formatPortSpan(port, count), formatPortSpan(span.Port, span.Count))
+		}
+	}
+	return nil
+}
+
+func formatPortSpan(port, count int) string {
+	if count <= 1 {
+		return strconv.Itoa(port)
+	}
+	return fmt.Sprintf("%d-%d", port, port+count-1)
+}
+
+// shiftTargetPort moves the port of a host:port target by offset.
+func shiftTargetPort(addr string, offset int) string {
+	if offset == 0 {
+		return addr
+	}
+	host, rawPort, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	port, err := strconv.Atoi(rawPort)
+	if err != nil {
+		return addr
+	}
+	return net.JoinHostPort(host, strconv.Itoa(port+offset))
+}
+
+// forwardRangeServiceName names the service of an entry port other than the
+// first one; the first keeps the plain "<base>_<protocol>" name.
+func forwardRangeServiceName(base, protocol string, port int) string {
+	return fmt.Sprintf("%s_%s_%d", base, protocol, port)
+}
+
+// forwardRangeServiceNames lists the extra services of a port range per node.
+func forwardRangeServiceNames(base string, ports []forwardPortRecord, count int) map[int64][]string {
+	names := make(map[int64][]string)
+	for _, fp := range ports {
+		for offset := 1; offset < count; offset++ {
+			for _, protocol := range []string{"tcp", "udp"} {
+				names[fp.NodeID] = append(names[fp.NodeID], forwardRangeServiceName(base, protocol, fp.Port+offset))
+			}
+		}
+	}
+	return names
+}
+
+// releaseForwardPortRange deletes the extra services an update left behind
+// when it moved or shrank a forward's port range.
+func (h *Handler) releaseForwardPortRange(oldForward *forwardRecord, oldPorts []forwardPortRecord, updated *forwardRecord) {
+	oldCount := forwardPortCount(oldForward)
+	if oldCount <= 1 {
+		return
+	}
+	oldUserTunnelID, _, _, err := h.resolveUserTunnelAndLimiter(oldForward.UserID, oldForward.TunnelID)
+	if err != nil {
+		return
+	}
+	keep := map[int64][]string{}
+	if newPorts, err := h.listForwardPorts(updated.ID); err == nil && updated.MuxHost == "" {
+		if userTunnelID, _, _, err := h.resolveUserTunnelAndLimiter(updated.UserID, updated.TunnelID); err == nil {
+			keep = forwardRangeServiceNames(buildForwardServiceBase(updated.ID, updated.UserID, userTunnelID), newPorts, forwardPortCount(updated))
+		}
+	}
+	for nodeID, names := range forwardRangeServiceNames(buildForwardServiceBase(oldForward.ID, oldForward.UserID, oldUserTunnelID), oldPorts, oldCount) {
+		kept := make(map[string]bool, len(keep[nodeID]))
+		for _, name := range keep[nodeID] {
+			kept[name] = true
+		}
+		stale := make([]string, 0, len(names))
+		for _, name := range names {
+			if !kept[name] {
+				stale = append(stale, name)
+			}
+		}
+		if len(stale) > 0 {
+			_, _ = h.sendNodeCommand(nodeID, "DeleteService", map[string]interface{}{"services": stale}, false, true)
+		}
+	}
+}
+
+// forwardDiagnosisAddr adds the far end of a port range to the targets, so a
+// diagnosis covers both the first and the last mapped port.
+func forwardDiagnosisAddr(forward *forwardRecord) string {
+	count := forwardPortCount(forward)
+	if count <= 1 {
+		return forward.RemoteAddr
+	}
+	targets := splitRemoteTargets(forward.RemoteAddr)
+	all := append([]string{}, targets...)
+	for _, target := range targets {
+		all = append(all, shiftTargetPort(target, count-1))
+	}
+	return strings.Join(all, ",")
+}
+
+// forwardListensOn reports whether a forward still owns a port of a node.
+func (h *Handler) forwardListensOn(forwardID, nodeID int64, port int) bool {
+	forward, err := h.getForwardRecord(forwardID)
+	if err != nil || forward == nil {
+		return true
+	}
+	ports, err := h.listForwardPorts(forwardID)
+	if err != nil {
+		return true
+	}
+	count := forwardPortCount(forward)
+	for _, fp := range ports {
+		if fp.NodeID == nodeID && port >= fp.Port && port < fp.Port+count {
+			return true
+		}
+	}
+	return false
+}
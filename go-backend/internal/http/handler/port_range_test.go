@@ -0,0 +1,111 @@
+package handler
+
+import (
+	"path/filepath"
+	"testing"
+
+	"go-backend/internal/store/repo"
+)
+
+func TestBuildForwardServiceConfigsMapsPortRange(t *testing.T) {
+	forward := &forwardRecord{ID: 5, TunnelID: 1, RemoteAddr: "10.0.0.5:37015", Strategy: "fifo", PortCount: 3}
+	node := &nodeRecord{ID: 2, TCPListenAddr: "[::]", UDPListenAddr: "[::]"}
+	services := buildForwardServiceConfigs("5_1_0", forward, nil, node, 27015, nil, false)
+	if len(services) != 6 {
+		t.Fatalf("expected tcp and udp services per port, got %d", len(services))
+	}
+
+	want := map[string][2]string{
+		"5_1_0_tcp":       {"[::]:27015", "10.0.0.5:37015"},
+		"5_1_0_udp":       {"[::]:27015", "10.0.0.5:37015"},
+		"5_1_0_tcp_27016": {"[::]:27016", "10.0.0.5:37016"},
+		"5_1_0_udp_27017": {"[::]:27017", "10.0.0.5:37017"},
+	}
+	for _, service := range services {
+		name, _ := service["name"].(string)
+		forwardID, _, _, ok := parseFlowServiceIDs(name)
+		if !ok || forwardID != 5 {
+			t.Fatalf("service %q does not account to the forward", name)
+		}
+		expected, ok := want[name]
+		if !ok {
+			continue
+		}
+		nodes := service["forwarder"].(map[string]interface{})["nodes"].([]map[string]interface{})
+		if service["addr"] != expected[0] || nodes[0]["addr"] != expected[1] {
+			t.Fatalf("service %q: got %v -> %v, want %v", name, service["addr"], nodes[0]["addr"], expected)
+		}
+		delete(want, name)
+	}
+	if len(want) != 0 {
+		t.Fatalf("missing services: %v", want)
+	}
+}
+
+func TestValidateForwardPortRangeBounds(t *testing.T) {
+	if err := validateForwardPortRange(65530, 6, "1.1.1.1:100"); err != nil {
+		t.Fatalf("expected range ending at 65535 to pass, got %v", err)
+	}
+	if err := validateForwardPortRange(65530, 7, "1.1.1.1:100"); err == nil {
+		t.Fatalf("expected entry range past 65535 to be rejected")
+	}
+	if err := validateForwardPortRange(1000, 10, "1.1.1.1:65530"); err == nil {
+		t.Fatalf("expected target range past 65535 to be rejected")
+	}
+}
+
+func TestForwardDiagnosisAddrCoversRangeEnd(t *testing.T) {
+	forward := &forwardRecord{RemoteAddr: "10.0.0.5:37015", PortCount: 16}
+	if got := forwardDiagnosisAddr(forward); got != "10.0.0.5:37015,10.0.0.5:37030" {
+		t.Fatalf("unexpected diagnosis targets %q", got)
+	}
+	forward.PortCount = 1
+	if got := forwardDiagnosisAddr(forward); got != "10.0.0.5:37015" {
+		t.Fatalf("unexpected single-port diagnosis targets %q", got)
+	}
+}
+
+func TestPortRangeConflictsOnNode(t *testing.T) {
+	r, err := repo.Open(filepath.Join(t.TempDir(), "range.db"))
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	t.Cleanup(func() { _ = r.Close() })
+	h := New(r, "secret")
+
+	db := r.DB()
+	for _, stmt := range []string{
+		`INSERT INTO forward(id, user_id, user_name, name, tunnel_id, remote_addr, strategy, created_time, updated_time, status, port_count) VALUES (1, 1, 'u', 'game', 3, '10.0.0.1:37015', 'fifo', 0, 0, 1, 16)`,
+		`INSERT INTO forward(id, user_id, user_name, name, tunnel_id, remote_addr, strategy, created_time, updated_time, status) VALUES (2, 1, 'u', 'web', 3, '10.0.0.2:80', 'fifo', 0, 0, 1)`,
+		`INSERT INTO forward_port(forward_id, node_id, port) VALUES (1, 9, 27015), (2, 9, 8080)`,
+	} {
+		if err := db.Exec(stmt).Error; err != nil {
+			t.Fatalf("seed: %v", err)
+		}
+	}
+	node := &nodeRecord{ID: 9, Name: "entry"}
+
+	used, err := r.GetUsedPortsOnNodeAsMap(9)
+	if err != nil {
+		t.Fatalf("used ports: %v", err)
+	}
+	if !used[27015] || !used[27030] || used[27031] || !used[8080] {
+		t.Fatalf("expected the whole range to be used, got %v", used)
+	}
+
+	if err := h.validatePortRangeOnNode(node, 0, 27020, 1); err == nil {
+		t.Fatalf("expected a port inside the range to be rejected")
+	}
+	if err := h.validatePortRangeOnNode(node, 0, 8075, 10); err == nil {
+		t.Fatalf("expected a range covering another forward's port to be rejected")
+	}
+	if err := h.validatePortRangeOnNode(node, 0, 27031, 5); err != nil {
+		t.Fatalf("expected an adjacent range to pass, got %v", err)
+	}
+	if err := h.validatePortRangeOnNode(node, 1, 27015, 20); err != nil {
+		t.Fatalf("expected a forward to grow over its own range, got %v", err)
+	}
+	if !h.forwardListensOn(1, 9, 27030) || h.forwardListensOn(1, 9, 27031) {
+		t.Fatalf("unexpected listener ownership for the range")
+	}
+}
@@ -0,0 +1,71 @@
+package handler
+
+import (
+	"errors"
+	"strconv"
+)
+
+// parseProxyProtocolVersion reads a PROXY protocol version; 0 disables it.
+// present is false when the field was not sent at all.
+func parseProxyProtocolVersion(req map[string]interface{}, key string) (version int, present bool, err error) {
+	version, present, err = parseConnLimitInput(req, key, 2, "PROXY 协议版本")
+	if err != nil {
+		return 0, true, errors.New("PROXY 协议版本仅支持 0（关闭）、1 或 2")
+	}
+	return version, present, nil
+}
+
+// parseProxyProtocolInput parses proxyAccept and proxySend. Fields that were
+// not sent keep the current values.
+func parseProxyProtocolInput(req map[string]interface{}, currentAccept, currentSend int) (accept, send int, present bool, err error) {
+	accept, acceptSet, err := parseProxyProtocolVersion(req, "proxyAccept")
+	if err != nil {
+		return 0, 0, true, err
+	}
+	send, sendSet, err := parseProxyProtocolVersion(req, "proxySend")
+	if err != nil {
+		return 0, 0, true, err
+	}
+	if !acceptSet {
+		accept = currentAccept
+	}
+	if !sendSet {
+		send = currentSend
+	}
+	return accept, send, acceptSet || sendSet, nil
+}
+
+// applyProxyProtocol configures the forward's TCP service: the listener
+// strips a PROXY header sent by an upstream load balancer, and the handler
+// writes one ahead of the payload once the target is dialed. Through a tunnel
+// chain that header is relayed as payload, so the backend behind the exit
+// node sees the real client address.
+func applyProxyProtocol(service map[string]interface{}, forward *forwardRecord) {
+	if forward.ProxyAccept > 0 {
+		md, _ := service["metadata"].(map[string]interface{})
+		if md == nil {
+			md = map[string]interface{}{}
+			service["metadata"] = md
+		}
+		md["proxyProtocol"] = strconv.Itoa(forward.ProxyAccept)
+	}
+	if forward.ProxySend > 0 {
+		handler := service["handler"].(map[string]interface{})
+		md, _ := handler["metadata"].(map[string]interface{})
+		if md == nil {
+			md = map[string]interface{}{}
+			handler["metadata"] = md
+		}
+		md["proxyProtocol"] = strconv.Itoa(forward.ProxySend)
+	}
+}
+
+// proxyProtocolRequirement demands agent support only when a header has to be
+// sent; accepting one relies on listener support every agent has.
+func proxyProtocolRequirement(forward *forwardRecord) nodeCapabilityRequirement {
+	req := nodeCapabilityRequirement{}
+	if forward.ProxySend > 0 {
+		req.Features = []string{"proxyProtocol"}
+	}
+	return req
+}
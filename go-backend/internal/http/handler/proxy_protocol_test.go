@@ -0,0 +1,68 @@
+package handler
+
+import "testing"
+
+func TestParseProxyProtocolInput(t *testing.T) {
+	accept, send, present, err := parseProxyProtocolInput(map[string]interface{}{"proxySend": float64(2)}, 1, 0)
+	if err != nil || !present || accept != 1 || send != 2 {
+		t.Fatalf("expected proxySend update to keep proxyAccept, got %d/%d present=%v err=%v", accept, send, present, err)
+	}
+	if _, _, present, _ = parseProxyProtocolInput(map[string]interface{}{}, 1, 1); present {
+		t.Fatalf("expected missing fields to be reported as absent")
+	}
+	for _, req := range []map[string]interface{}{
+		{"proxyAccept": float64(3)},
+		{"proxySend": "v1"},
+		{"proxySend": float64(-1)},
+	} {
+		if _, _, _, err := parseProxyProtocolInput(req, 0, 0); err == nil {
+			t.Fatalf("expected %+v to be rejected", req)
+		}
+	}
+}
+
+func TestBuildForwardServiceConfigsProxyProtocol(t *testing.T) {
+	forward := &forwardRecord{ID: 7, TunnelID: 3, RemoteAddr: "10.0.0.1:80", ProxyAccept: 1, ProxySend: 2}
+	node := &nodeRecord{TCPListenAddr: "[::]", UDPListenAddr: "[::]", InterfaceName: "eth0"}
+	tunnel := &tunnelRecord{ID: 3, Type: 1}
+
+	services := buildForwardServiceConfigs("7_1_0", forward, tunnel, node, 10000, nil, false)
+	tcp, udp := services[0], services[1]
+	md, _ := tcp["metadata"].(map[string]interface{})
+	if md["proxyProtocol"] != "1" || md["interface"] != "eth0" {
+		t.Fatalf("expected tcp listener to accept PROXY v1 next to interface, got %+v", md)
+	}
+	handlerMD, _ := tcp["handler"].(map[string]interface{})["metadata"].(map[string]interface{})
+	if handlerMD["proxyProtocol"] != "2" {
+		t.Fatalf("expected tcp handler to send PROXY v2, got %+v", handlerMD)
+	}
+	if udpMD, _ := udp["metadata"].(map[string]interface{}); udpMD["proxyProtocol"] != nil {
+		t.Fatalf("expected udp service without PROXY protocol, got %+v", udpMD)
+	}
+	if _, ok := udp["handler"].(map[string]interface{})["metadata"]; ok {
+		t.Fatalf("expected udp handler without PROXY protocol")
+	}
+
+	legacy := &nodeRecord{Name: "old-agent", Capabilities: `{"features":{"admission":true}}`}
+	if err := validateNodeCapabilities(legacy, proxyProtocolRequirement(forward)); err == nil {
+		t.Fatalf("expected agent without proxyProtocol support to be rejected")
+	}
+	forward.ProxySend = 0
+	if err := validateNodeCapabilities(legacy, proxyProtocolRequirement(forward)); err != nil {
+		t.Fatalf("expected accept-only forward to be allowed, got %v", err)
+	}
+}
+
+func TestApplyProxyProtocolKeepsHandlerMetadata(t *testing.T) {
+	service := map[string]interface{}{
+		"handler": map[string]interface{}{
+			"type":     "tcp",
+			"metadata": map[string]interface{}{"sniffing": true},
+		},
+	}
+	applyProxyProtocol(service, &forwardRecord{ProxySend: 1})
+	md := service["handler"].(map[string]interface{})["metadata"].(map[string]interface{})
+	if md["proxyProtocol"] != "1" || md["sniffing"] != true {
+		t.Fatalf("expected PROXY protocol next to the existing handler metadata, got %+v", md)
+	}
+}
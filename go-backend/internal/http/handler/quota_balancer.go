@@ -0,0 +1,384 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// A tunnel speed limit is installed on every entry node, so without
+// coordination a tunnel with three entry nodes would allow three times the
+// rate. The balancer treats the speed as a global budget and splits it among
+// the entry nodes by their recently reported usage.
+const (
+	quotaRebalanceInterval = 30 * time.Second
+	quotaUsageSmoothing    = 0.5  // weight of the latest interval in the usage average
+	quotaFloorRatio        = 0.2  // budget share split evenly so idle nodes can start at once
+	quotaHeadroom          = 1.25 // demand padding that lets a saturated node grow
+	quotaUpdateThreshold   = 0.05 // share change, relative to the budget, worth pushing
+)
+
+type quotaUsageKey struct {
+	userTunnelID int64
+	nodeID       int64
+}
+
+type quotaBytes struct {
+	in  int64
+	out int64
+}
+
+// quotaLimiter is the balancing state of one speed limiter.
+type quotaLimiter struct {
+	budget float64           // Mbps
+	usage  map[int64]float64 // smoothed usage per node, Mbps
+	shares map[int64]float64 // installed share per node, Mbps
+}
+
+type quotaBalancer struct {
+	mu       sync.Mutex
+	pending  map[quotaUsageKey]*quotaBytes
+	limiters map[int64]*quotaLimiter
+	lastTick time.Time
+}
+
+func newQuotaBalancer() *quotaBalancer {
+	return &quotaBalancer{
+		pending:  make(map[quotaUsageKey]*quotaBytes),
+		limiters: make(map[int64]*quotaLimiter),
+	}
+}
+
+// addBytes accumulates the traffic a node reported for a user tunnel.
+func (b *quotaBalancer) addBytes(userTunnelID, nodeID, in, out int64) {
+	if b == nil || userTunnelID <= 0 || nodeID <= 0 || (in <= 0 && out <= 0) {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	key := quotaUsageKey{userTunnelID: userTunnelID, nodeID: nodeID}
+	acc := b.pending[key]
+	if acc == nil {
+		acc = &quotaBytes{}
+		b.pending[key] = acc
+	}
+	acc.in += in
+	acc.out += out
+}
+
+// drain returns the rate of each user tunnel on each node since the previous
+// drain, in Mbps of the busier direction: the limiter caps both directions at
+// the same rate.
+func (b *quotaBalancer) drain(now time.Time) map[quotaUsageKey]float64 {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	elapsed := now.Sub(b.lastTick).Seconds()
+	if b.lastTick.IsZero() || elapsed <= 0 {
+		elapsed = quotaRebalanceInterval.Seconds()
+	}
+	b.lastTick = now
+
+	rates := make(map[quotaUsageKey]float64, len(b.pending))
+	for key, acc := range b.pending {
+		bytes := acc.in
+		if acc.out > bytes {
+			bytes = acc.out
+		}
+		rates[key] = float64(bytes) * 8 / 1e6 / elapsed
+	}
+	b.pending = make(map[quotaUsageKey]*quotaBytes)
+	return rates
+}
+
+func (b *quotaBalancer) limiterIDs() []int64 {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	ids := make([]int64, 0, len(b.limiters))
+	for id := range b.limiters {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// forget drops a limiter's state, e.g. after its speed changed or it no longer
+// spans several nodes.
+func (b *quotaBalancer) forget(limiterID int64) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.limiters, limiterID)
+}
+
+// share returns the installed share of a node, or false when the limiter has
+// not been balanced for this budget yet.
+func (b *quotaBalancer) share(limiterID, nodeID int64, budget float64) (float64, bool) {
+	if b == nil {
+		return 0, false
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	state := b.limiters[limiterID]
+	if state == nil || state.budget != budget {
+		return 0, false
+	}
+	v, ok := state.shares[nodeID]
+	return v, ok
+}
+
+type quotaNodeShare struct {
+	NodeID int64
+	Mbps   float64
+}
+
+// rebalance folds the latest usage sample into the smoothed usage and
+// reallocates the budget. It returns the shares to install, or nil when no
+// node moved by more than the update threshold. Every node is returned
+// together so the installed shares always add up to the budget, shrinking
+// shares first so the nodes stay within it while the update is in flight.
+func (b *quotaBalancer) rebalance(limiterID int64, budget float64, nodes []int64, sample map[int64]float64) []quotaNodeShare {
+	if b == nil || budget <= 0 || len(nodes) == 0 {
+		return nil
+	}
+	nodes = uniqueNodeIDs(nodes)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	state := b.limiters[limiterID]
+	if state == nil || state.budget != budget {
+		state = &quotaLimiter{budget: budget, usage: make(map[int64]float64), shares: make(map[int64]float64)}
+		b.limiters[limiterID] = state
+	}
+
+	usage := make(map[int64]float64, len(nodes))
+	for _, nodeID := range nodes {
+		prev, seen := state.usage[nodeID]
+		if !seen {
+			usage[nodeID] = sample[nodeID]
+			continue
+		}
+		usage[nodeID] = prev + quotaUsageSmoothing*(sample[nodeID]-prev)
+	}
+	state.usage = usage
+
+	next := allocateQuota(budget, nodes, usage)
+	changed := len(state.shares) != len(next)
+	for nodeID, v := range next {
+		prev, ok := state.shares[nodeID]
+		if !ok || abs64(v-prev) > budget*quotaUpdateThreshold {
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+
+	out := make([]quotaNodeShare, 0, len(next))
+	for _, nodeID := range nodes {
+		out = append(out, quotaNodeShare{NodeID: nodeID, Mbps: next[nodeID]})
+	}
+	prev := state.shares
+	sort.SliceStable(out, func(i, j int) bool {
+		return out[i].Mbps-prev[out[i].NodeID] < out[j].Mbps-prev[out[j].NodeID]
+	})
+	state.shares = next
+	return out
+}
+
+func uniqueNodeIDs(nodes []int64) []int64 {
+	out := make([]int64, 0, len(nodes))
+	seen := make(map[int64]struct{}, len(nodes))
+	for _, nodeID := range nodes {
+		if _, ok := seen[nodeID]; ok {
+			continue
+		}
+		seen[nodeID] = struct{}{}
+		out = append(out, nodeID)
+	}
+	return out
+}
+
+// allocateQuota splits budget among nodes. Each node keeps an even floor; the
+// rest is water-filled by padded demand so light nodes get what they use and
+// the busiest ones share the remainder equally. Whatever no node asked for is
+// split evenly, so the shares always sum to the budget. nodes must be unique.
+func allocateQuota(budget float64, nodes []int64, usage map[int64]float64) map[int64]float64 {
+	shares := make(map[int64]float64, len(nodes))
+	if len(nodes) == 0 || budget <= 0 {
+		return shares
+	}
+
+	floor := budget * quotaFloorRatio / float64(len(nodes))
+	want := make(map[int64]float64, len(nodes))
+	order := make([]int64, 0, len(nodes))
+	for _, nodeID := range nodes {
+		shares[nodeID] = floor
+		w := usage[nodeID]*quotaHeadroom - floor
+		if w < 0 {
+			w = 0
+		}
+		want[nodeID] = w
+		order = append(order, nodeID)
+	}
+	sort.SliceStable(order, func(i, j int) bool { return want[order[i]] < want[order[j]] })
+
+	remaining := budget - floor*float64(len(order))
+	for i, nodeID := range order {
+		give := remaining / float64(len(order)-i)
+		if want[nodeID] < give {
+			give = want[nodeID]
+		}
+		shares[nodeID] += give
+		remaining -= give
+	}
+	if remaining > 0 {
+		extra := remaining / float64(len(order))
+		for _, nodeID := range order {
+			shares[nodeID] += extra
+		}
+	}
+	return shares
+}
+
+func abs64(v float64) float64 {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+// quotaLimiterConfig renders a node share as the speed limiter config. Shares
+// are in bytes so the installed rates never add up above the budget.
+func quotaLimiterConfig(limiterID int64, mbps float64) map[string]interface{} {
+	rate := int64(mbps * 125000)
+	if rate < 1 {
+		rate = 1
+	}
+	return map[string]interface{}{
+		"name":   strconv.FormatInt(limiterID, 10),
+		"limits": []string{fmt.Sprintf("$ %dB %dB", rate, rate)},
+	}
+}
+
+// limiterNodeShare returns the rate a speed limiter gets on one node: the
+// balanced share when the tunnel has several entry nodes, falling back to an
+// even split until the first rebalance.
+func (h *Handler) limiterNodeShare(limiterID, nodeID int64, speed int) (float64, bool) {
+	tunnelID := h.repo.GetSpeedLimitTunnelID(limiterID)
+	if tunnelID <= 0 {
+		return 0, false
+	}
+	nodes, err := h.tunnelEntryNodeIDs(tunnelID)
+	nodes = uniqueNodeIDs(nodes)
+	if err != nil || len(nodes) < 2 {
+		return 0, false
+	}
+	if share, ok := h.quota.share(limiterID, nodeID, float64(speed)); ok {
+		return share, true
+	}
+	return float64(speed) / float64(len(nodes)), true
+}
+
+// recordQuotaUsage feeds a flow report into the balancer.
+func (h *Handler) recordQuotaUsage(nodeID int64, item flowItem) {
+	_, _, userTunnelID, ok := parseFlowServiceIDs(item.N)
+	if !ok || userTunnelID <= 0 {
+		return
+	}
+	h.quota.addBytes(userTunnelID, nodeID, item.D, item.U)
+}
+
+func (h *Handler) runQuotaRebalanceLoop(ctx context.Context) {
+	defer h.jobsWG.Done()
+
+	ticker := time.NewTicker(quotaRebalanceInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			h.runQuotaRebalanceJob(now)
+		}
+	}
+}
+
+// runQuotaRebalanceJob reallocates every speed limiter that spans several
+// entry nodes and pushes the shares that moved.
+func (h *Handler) runQuotaRebalanceJob(now time.Time) {
+	if h == nil || h.repo == nil || h.quota == nil {
+		return
+	}
+
+	samples := make(map[int64]map[int64]float64)
+	limiterOf := make(map[int64]int64)
+	for key, mbps := range h.quota.drain(now) {
+		limiterID, seen := limiterOf[key.userTunnelID]
+		if !seen {
+			if ut, err := h.repo.GetUserTunnelByID(key.userTunnelID); err == nil && ut != nil && ut.SpeedID.Valid {
+				limiterID = ut.SpeedID.Int64
+			}
+			limiterOf[key.userTunnelID] = limiterID
+		}
+		if limiterID <= 0 {
+			continue
+		}
+		if samples[limiterID] == nil {
+			samples[limiterID] = make(map[int64]float64)
+		}
+		samples[limiterID][key.nodeID] += mbps
+	}
+
+	ids := h.quota.limiterIDs()
+	for limiterID := range samples {
+		ids = append(ids, limiterID)
+	}
+	done := make(map[int64]bool, len(ids))
+	for _, limiterID := range ids {
+		if done[limiterID] {
+			continue
+		}
+		done[limiterID] = true
+
+		speed, tunnelID, ok := h.repo.GetSpeedLimitBudget(limiterID)
+		speed = h.limiterSpeedAt(limiterID, speed, now)
+		if !ok || speed <= 0 {
+			h.quota.forget(limiterID)
+			continue
+		}
+		nodes, err := h.tunnelEntryNodeIDs(tunnelID)
+		nodes = uniqueNodeIDs(nodes)
+		if err != nil || len(nodes) < 2 {
+			h.quota.forget(limiterID)
+			continue
+		}
+		shares := h.quota.rebalance(limiterID, float64(speed), nodes, samples[limiterID])
+		h.pushQuotaShares(limiterID, shares)
+	}
+}
+
+// pushQuotaShares installs the shares in order. Failures are ignored like
+// other limiter updates; the next sync installs the recorded share.
+func (h *Handler) pushQuotaShares(limiterID int64, shares []quotaNodeShare) {
+	for _, share := range shares {
+		payload := map[string]interface{}{
+			"limiter": strconv.FormatInt(limiterID, 10),
+			"data":    quotaLimiterConfig(limiterID, share.Mbps),
+		}
+		_, _ = h.sendNodeCommand(share.NodeID, "UpdateLimiters", payload, false, false)
+	}
+}
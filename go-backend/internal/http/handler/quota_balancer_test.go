@@ -0,0 +1,88 @@
+package handler
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+// simulateQuota drives the balancer against nodes offering a fixed load: each
+// round a node reports the traffic its installed share let through.
+func simulateQuota(t *testing.T, budget float64, load map[int64]float64, rounds int) map[int64]float64 {
+	t.Helper()
+
+	nodes := []int64{1, 2, 3}
+	b := newQuotaBalancer()
+	installed := make(map[int64]float64, len(nodes))
+	for _, nodeID := range nodes {
+		installed[nodeID] = budget / float64(len(nodes))
+	}
+
+	now := time.Unix(1700000000, 0)
+	b.drain(now)
+	for round := 0; round < rounds; round++ {
+		for _, nodeID := range nodes {
+			mbps := math.Min(load[nodeID], installed[nodeID])
+			bytes := int64(mbps * 1e6 / 8 * quotaRebalanceInterval.Seconds())
+			b.addBytes(10, nodeID, bytes, bytes/4)
+		}
+		now = now.Add(quotaRebalanceInterval)
+
+		sample := make(map[int64]float64)
+		for key, mbps := range b.drain(now) {
+			sample[key.nodeID] += mbps
+		}
+		for _, share := range b.rebalance(7, budget, nodes, sample) {
+			installed[share.NodeID] = share.Mbps
+		}
+
+		total := 0.0
+		for _, v := range installed {
+			total += v
+		}
+		if total > budget+1e-6 {
+			t.Fatalf("round %d: installed shares %v exceed budget %v", round, installed, budget)
+		}
+	}
+	return installed
+}
+
+func TestQuotaBalancerConvergesToDemand(t *testing.T) {
+	shares := simulateQuota(t, 100, map[int64]float64{1: 70, 2: 10, 3: 0}, 20)
+	if shares[1] < 70 {
+		t.Fatalf("expected the busy node to reach its load, got %v", shares)
+	}
+	if shares[2] < 10 || shares[2] > 20 {
+		t.Fatalf("expected the light node to keep about its usage, got %v", shares)
+	}
+	if floor := 100 * quotaFloorRatio / 3; math.Abs(shares[3]-floor) > 100*quotaUpdateThreshold {
+		t.Fatalf("expected the idle node to settle near the floor %v, got %v", floor, shares)
+	}
+}
+
+func TestQuotaBalancerSplitsContendedBudget(t *testing.T) {
+	shares := simulateQuota(t, 90, map[int64]float64{1: 200, 2: 200, 3: 5}, 20)
+	if math.Abs(shares[1]-shares[2]) > 1e-6 || shares[1] < 40 {
+		t.Fatalf("expected saturated nodes to share the budget evenly, got %v", shares)
+	}
+	if shares[3] < 5 {
+		t.Fatalf("expected the light node to keep its usage, got %v", shares)
+	}
+}
+
+func TestQuotaBalancerSkipsSmallChanges(t *testing.T) {
+	b := newQuotaBalancer()
+	nodes := []int64{1, 2}
+	if len(b.rebalance(3, 100, nodes, map[int64]float64{1: 40, 2: 40})) != 2 {
+		t.Fatalf("expected the first allocation to be installed on every node")
+	}
+	if shares := b.rebalance(3, 100, nodes, map[int64]float64{1: 41, 2: 39}); shares != nil {
+		t.Fatalf("expected a small usage drift not to be pushed, got %v", shares)
+	}
+	if share, ok := b.share(3, 1, 100); !ok || share != 50 {
+		t.Fatalf("expected the installed share to be recorded, got %v %v", share, ok)
+	}
+	if _, ok := b.share(3, 1, 200); ok {
+		t.Fatalf("expected a changed budget to invalidate the installed shares")
+	}
+}
@@ -0,0 +1,451 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const scheduleMaxWindows = 50
+
+// scheduleWindow is a weekly time window. End before start wraps past
+// midnight into the next day; equal start and end cover the whole day.
+type scheduleWindow struct {
+	// Days lists weekdays, 0 for Sunday; empty means every day.
+	Days  []int  `json:"days,omitempty"`
+	Start string `json:"start"` // HH:MM
+	End   string `json:"end"`   // HH:MM, 24:00 for midnight
+}
+
+// forwardSchedule keeps a forward running only inside its windows.
+type forwardSchedule struct {
+	// Timezone is an IANA name; empty uses the panel's local time.
+	Timezone string           `json:"timezone,omitempty"`
+	Windows  []scheduleWindow `json:"windows"`
+}
+
+type speedProfile struct {
+	scheduleWindow
+	Speed int `json:"speed"` // Mbps
+}
+
+// speedProfiles overrides a speed limit during time-of-day windows. The first
+// matching profile wins; outside every window the base speed applies.
+type speedProfiles struct {
+	Timezone string         `json:"timezone,omitempty"`
+	Profiles []speedProfile `json:"profiles"`
+}
+
+func parseClock(value string) (int, error) {
+	parts := strings.Split(strings.TrimSpace(value), ":")
+	if len(parts) != 2 {
+		return 0, fmt.Errorf("时间格式错误，应为 HH:MM: %s", value)
+	}
+	hour, err1 := strconv.Atoi(parts[0])
+	minute, err2 := strconv.Atoi(parts[1])
+	if err1 != nil || err2 != nil || hour < 0 || hour > 24 || minute < 0 || minute > 59 || (hour == 24 && minute != 0) {
+		return 0, fmt.Errorf("时间格式错误，应为 HH:MM: %s", value)
+	}
+	return hour*60 + minute, nil
+}
+
+func (w *scheduleWindow) normalize() error {
+	start, err := parseClock(w.Start)
+	if err != nil {
+		return err
+	}
+	end, err := parseClock(w.End)
+	if err != nil {
+		return err
+	}
+	w.Start = fmt.Sprintf("%02d:%02d", start/60, start%60)
+	w.End = fmt.Sprintf("%02d:%02d", end/60, end%60)
+
+	seen := make(map[int]struct{}, len(w.Days))
+	days := make([]int, 0, len(w.Days))
+	for _, day := range w.Days {
+		if day < 0 || day > 6 {
+			return errors.New("星期取值范围为 0（周日）到 6")
+		}
+		if _, ok := seen[day]; ok {
+			continue
+		}
+		seen[day] = struct{}{}
+		days = append(days, day)
+	}
+	sort.Ints(days)
+	if len(days) == 0 || len(days) == 7 {
+		days = nil
+	}
+	w.Days = days
+	return nil
+}
+
+func (w scheduleWindow) onDay(day int) bool {
+	if len(w.Days) == 0 {
+		return true
+	}
+	for _, d := range w.Days {
+		if d == day {
+			return true
+		}
+	}
+	return false
+}
+
+func (w scheduleWindow) contains(t time.Time) bool {
+	start, err1 := parseClock(w.Start)
+	end, err2 := parseClock(w.End)
+	if err1 != nil || err2 != nil {
+		return false
+	}
+	minute := t.Hour()*60 + t.Minute()
+	day := int(t.Weekday())
+	switch {
+	case start == end:
+		return w.onDay(day)
+	case start < end:
+		return w.onDay(day) && minute >= start && minute < end
+	default:
+		return (w.onDay(day) && minute >= start) || (w.onDay((day+6)%7) && minute < end)
+	}
+}
+
+func scheduleLocation(timezone string) (*time.Location, error) {
+	if timezone == "" {
+		return time.Local, nil
+	}
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		return nil, fmt.Errorf("无效的时区: %s", timezone)
+	}
+	return loc, nil
+}
+
+func scheduleTime(timezone string, now time.Time) time.Time {
+	if loc, err := scheduleLocation(timezone); err == nil {
+		return now.In(loc)
+	}
+	return now
+}
+
+func (s *forwardSchedule) activeAt(now time.Time) bool {
+	t := scheduleTime(s.Timezone, now)
+	for _, w := range s.Windows {
+		if w.contains(t) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *speedProfiles) speedAt(now time.Time, base int) int {
+	t := scheduleTime(p.Timezone, now)
+	for _, profile := range p.Profiles {
+		if profile.contains(t) {
+			return profile.Speed
+		}
+	}
+	return base
+}
+
+// decodeScheduleField unmarshals a JSON object sent as an object or a string.
+// It reports false when the field is empty.
+func decodeScheduleField(raw interface{}, out interface{}, label string) (bool, error) {
+	var data []byte
+	switch v := raw.(type) {
+	case nil:
+		return false, nil
+	case string:
+		if strings.TrimSpace(v) == "" {
+			return false, nil
+		}
+		data = []byte(v)
+	case map[string]interface{}:
+		data, _ = json.Marshal(v)
+	default:
+		return false, fmt.Errorf("%s格式错误", label)
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return false, fmt.Errorf("%s格式错误", label)
+	}
+	return true, nil
+}
+
+func normalizeForwardSchedule(s *forwardSchedule) error {
+	s.Timezone = strings.TrimSpace(s.Timezone)
+	if _, err := scheduleLocation(s.Timezone); err != nil {
+		return err
+	}
+	if len(s.Windows) > scheduleMaxWindows {
+		return fmt.Errorf("调度时段不能超过 %d 个", scheduleMaxWindows)
+	}
+	for i := range s.Windows {
+		if err := s.Windows[i].normalize(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func normalizeSpeedProfiles(p *speedProfiles) error {
+	p.Timezone = strings.TrimSpace(p.Timezone)
+	if _, err := scheduleLocation(p.Timezone); err != nil {
+		return err
+	}
+	if len(p.Profiles) > scheduleMaxWindows {
+		return fmt.Errorf("限速时段不能超过 %d 个", scheduleMaxWindows)
+	}
+	for i := range p.Profiles {
+		if err := p.Profiles[i].normalize(); err != nil {
+			return err
+		}
+		if p.Profiles[i].Speed <= 0 {
+			return errors.New("时段限速必须大于 0")
+		}
+	}
+	return nil
+}
+
+// parseForwardScheduleInput validates the schedule field and returns its
+// normalized JSON, or "" to run the forward at all times. present is false
+// when the field was not sent.
+func parseForwardScheduleInput(req map[string]interface{}) (value string, present bool, err error) {
+	raw, ok := req["schedule"]
+	if !ok {
+		return "", false, nil
+	}
+	var schedule forwardSchedule
+	set, err := decodeScheduleField(raw, &schedule, "调度计划")
+	if err != nil || !set {
+		return "", true, err
+	}
+	if err := normalizeForwardSchedule(&schedule); err != nil {
+		return "", true, err
+	}
+	if len(schedule.Windows) == 0 {
+		return "", true, nil
+	}
+	b, _ := json.Marshal(schedule)
+	return string(b), true, nil
+}
+
+// parseSpeedProfilesInput validates the profiles field of a speed limit and
+// returns its normalized JSON, or "" when no profile is set.
+func parseSpeedProfilesInput(req map[string]interface{}) (value string, present bool, err error) {
+	raw, ok := req["profiles"]
+	if !ok {
+		return "", false, nil
+	}
+	var profiles speedProfiles
+	set, err := decodeScheduleField(raw, &profiles, "限速时段")
+	if err != nil || !set {
+		return "", true, err
+	}
+	if err := normalizeSpeedProfiles(&profiles); err != nil {
+		return "", true, err
+	}
+	if len(profiles.Profiles) == 0 {
+		return "", true, nil
+	}
+	b, _ := json.Marshal(profiles)
+	return string(b), true, nil
+}
+
+// decodeForwardSchedule parses a stored schedule; invalid or empty values
+// leave the forward always running.
+func decodeForwardSchedule(raw string) *forwardSchedule {
+	var schedule forwardSchedule
+	if set, err := decodeScheduleField(raw, &schedule, ""); err != nil || !set {
+		return nil
+	}
+	if normalizeForwardSchedule(&schedule) != nil || len(schedule.Windows) == 0 {
+		return nil
+	}
+	return &schedule
+}
+
+// speedProfilesAt returns the speed in effect at now for stored profiles.
+func speedProfilesAt(raw string, base int, now time.Time) int {
+	var profiles speedProfiles
+	if set, err := decodeScheduleField(raw, &profiles, ""); err != nil || !set {
+		return base
+	}
+	if normalizeSpeedProfiles(&profiles) != nil {
+		return base
+	}
+	return profiles.speedAt(now, base)
+}
+
+func (h *Handler) limiterSpeedAt(limiterID int64, base int, now time.Time) int {
+	return speedProfilesAt(h.repo.GetSpeedLimitProfiles(limiterID), base, now)
+}
+
+// applyForwardSchedule pauses a freshly deployed forward that is outside its
+// windows and records the state for the scheduler.
+func (h *Handler) applyForwardSchedule(forward *forwardRecord, now time.Time) {
+	schedule := decodeForwardSchedule(forward.Schedule)
+	if schedule == nil || forward.Status != 1 {
+		h.scheduleMu.Lock()
+		delete(h.scheduledForwards, forward.ID)
+		h.scheduleMu.Unlock()
+		return
+	}
+	active := schedule.activeAt(now)
+	if !active && h.controlForwardServices(forward, "PauseService", false) != nil {
+		return
+	}
+	h.scheduleMu.Lock()
+	if h.scheduledForwards != nil {
+		h.scheduledForwards[forward.ID] = active
+	}
+	h.scheduleMu.Unlock()
+}
+
+// forgetScheduledSpeed makes the scheduler push the limiter on its next run.
+func (h *Handler) forgetScheduledSpeed(limiterID int64) {
+	h.scheduleMu.Lock()
+	delete(h.scheduledSpeeds, limiterID)
+	h.scheduleMu.Unlock()
+}
+
+func (h *Handler) runScheduleLoop(ctx context.Context) {
+	defer h.jobsWG.Done()
+
+	// The applied windows are not persisted: reconcile right away after a
+	// restart, then at every minute boundary.
+	h.runScheduleJob(time.Now())
+	for {
+		wait := durationUntilNextMinute(time.Now())
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			if !timer.Stop() {
+				<-timer.C
+			}
+			return
+		case <-timer.C:
+			h.runScheduleJob(time.Now())
+		}
+	}
+}
+
+func durationUntilNextMinute(now time.Time) time.Duration {
+	next := now.Truncate(time.Minute).Add(time.Minute)
+	return next.Sub(now)
+}
+
+// runScheduleJob pauses and resumes scheduled forwards and pushes profiled
+// speed limits whose state differs from what was last applied. Failed
+// commands are retried on the next run.
+func (h *Handler) runScheduleJob(now time.Time) {
+	if h == nil || h.repo == nil {
+		return
+	}
+	h.scheduleMu.Lock()
+	if h.scheduledForwards == nil {
+		h.scheduledForwards = make(map[int64]bool)
+	}
+	if h.scheduledSpeeds == nil {
+		h.scheduledSpeeds = make(map[int64]int)
+	}
+	h.scheduleMu.Unlock()
+
+	if forwards, err := h.repo.ListScheduledForwards(); err == nil {
+		seen := make(map[int64]struct{}, len(forwards))
+		for i := range forwards {
+			forward := &forwards[i]
+			schedule := decodeForwardSchedule(forward.Schedule)
+			if schedule == nil {
+				continue
+			}
+			seen[forward.ID] = struct{}{}
+			active := schedule.activeAt(now)
+
+			h.scheduleMu.Lock()
+			last, known := h.scheduledForwards[forward.ID]
+			h.scheduleMu.Unlock()
+			if known && last == active {
+				continue
+			}
+			command := "PauseService"
+			if active {
+				command = "ResumeService"
+			}
+			if err := h.controlForwardServices(forward, command, false); err != nil {
+				continue
+			}
+			h.scheduleMu.Lock()
+			h.scheduledForwards[forward.ID] = active
+			h.scheduleMu.Unlock()
+		}
+		h.scheduleMu.Lock()
+		for id := range h.scheduledForwards {
+			if _, ok := seen[id]; !ok {
+				delete(h.scheduledForwards, id)
+			}
+		}
+		h.scheduleMu.Unlock()
+	}
+
+	if limits, err := h.repo.ListProfiledSpeedLimits(); err == nil {
+		seen := make(map[int64]struct{}, len(limits))
+		for _, limit := range limits {
+			seen[limit.ID] = struct{}{}
+			speed := speedProfilesAt(limit.Profiles.String, limit.Speed, now)
+
+			h.scheduleMu.Lock()
+			last, known := h.scheduledSpeeds[limit.ID]
+			h.scheduleMu.Unlock()
+			if known && last == speed {
+				continue
+			}
+			if !h.pushLimiterSpeed(limit.ID, speed, limit.TunnelID) {
+				continue
+			}
+			h.scheduleMu.Lock()
+			h.scheduledSpeeds[limit.ID] = speed
+			h.scheduleMu.Unlock()
+		}
+		h.scheduleMu.Lock()
+		for id := range h.scheduledSpeeds {
+			if _, ok := seen[id]; !ok {
+				delete(h.scheduledSpeeds, id)
+			}
+		}
+		h.scheduleMu.Unlock()
+	}
+}
+
+// pushLimiterSpeed replaces a speed limiter on the tunnel's entry nodes,
+// split evenly when there are several, and reports whether every node
+// accepted it.
+func (h *Handler) pushLimiterSpeed(limiterID int64, speed int, tunnelID int64) bool {
+	nodes, err := h.tunnelEntryNodeIDs(tunnelID)
+	if err != nil {
+		return false
+	}
+	nodes = uniqueNodeIDs(nodes)
+	h.quota.forget(limiterID)
+
+	mbps := float64(speed)
+	if len(nodes) > 1 {
+		mbps /= float64(len(nodes))
+	}
+	payload := map[string]interface{}{
+		"limiter": strconv.FormatInt(limiterID, 10),
+		"data":    quotaLimiterConfig(limiterID, mbps),
+	}
+	ok := true
+	for _, nodeID := range nodes {
+		if _, err := h.sendNodeCommand(nodeID, "UpdateLimiters", payload, false, false); err != nil {
+			ok = false
+		}
+	}
+	return ok
+}
@@ -0,0 +1,99 @@
+package handler
+
+import (
+	"testing"
+	"time"
+)
+
+func TestScheduleWindowContains(t *testing.T) {
+	workday := scheduleWindow{Days: []int{1, 2, 3, 4, 5}, Start: "09:00", End: "18:00"}
+	overnight := scheduleWindow{Days: []int{5}, Start: "22:00", End: "06:00"}
+	allDay := scheduleWindow{Days: []int{0}, Start: "00:00", End: "00:00"}
+
+	at := func(day, hour, minute int) time.Time {
+		// 2026-10-18 is a Sunday.
+		return time.Date(2026, 10, 18+day, hour, minute, 0, 0, time.UTC)
+	}
+	cases := []struct {
+		window scheduleWindow
+		when   time.Time
+		want   bool
+	}{
+		{workday, at(1, 9, 0), true},
+		{workday, at(1, 17, 59), true},
+		{workday, at(1, 18, 0), false},
+		{workday, at(6, 12, 0), false},
+		{overnight, at(5, 23, 0), true},
+		{overnight, at(6, 5, 59), true},
+		{overnight, at(6, 6, 0), false},
+		{overnight, at(5, 5, 0), false},
+		{allDay, at(0, 23, 59), true},
+		{allDay, at(1, 0, 0), false},
+	}
+	for _, tc := range cases {
+		if got := tc.window.contains(tc.when); got != tc.want {
+			t.Fatalf("%+v at %s: got %v, want %v", tc.window, tc.when.Format("Mon 15:04"), got, tc.want)
+		}
+	}
+}
+
+func TestParseForwardScheduleInputNormalizesAndValidates(t *testing.T) {
+	value, present, err := parseForwardScheduleInput(map[string]interface{}{
+		"schedule": map[string]interface{}{
+			"timezone": "UTC",
+			"windows": []interface{}{
+				map[string]interface{}{"days": []interface{}{5, 1, 1}, "start": "9:00", "end": "24:00"},
+			},
+		},
+	})
+	if err != nil || !present {
+		t.Fatalf("expected valid schedule, got present=%v err=%v", present, err)
+	}
+	if value != `{"timezone":"UTC","windows":[{"days":[1,5],"start":"09:00","end":"24:00"}]}` {
+		t.Fatalf("unexpected normalized schedule: %s", value)
+	}
+	schedule := decodeForwardSchedule(value)
+	if schedule == nil || !schedule.activeAt(time.Date(2026, 10, 19, 23, 30, 0, 0, time.UTC)) {
+		t.Fatalf("expected the window to run until midnight, got %+v", schedule)
+	}
+
+	if value, present, err = parseForwardScheduleInput(map[string]interface{}{"schedule": ""}); err != nil || !present || value != "" {
+		t.Fatalf("expected empty schedule to clear, got %q present=%v err=%v", value, present, err)
+	}
+	for _, schedule := range []map[string]interface{}{
+		{"windows": []interface{}{map[string]interface{}{"start": "25:00", "end": "06:00"}}},
+		{"windows": []interface{}{map[string]interface{}{"days": []interface{}{7}, "start": "01:00", "end": "02:00"}}},
+		{"timezone": "Mars/Olympus", "windows": []interface{}{map[string]interface{}{"start": "01:00", "end": "02:00"}}},
+	} {
+		if _, _, err := parseForwardScheduleInput(map[string]interface{}{"schedule": schedule}); err == nil {
+			t.Fatalf("expected %+v to be rejected", schedule)
+		}
+	}
+}
+
+func TestSpeedProfilesAtPicksFirstMatchingProfile(t *testing.T) {
+	raw, _, err := parseSpeedProfilesInput(map[string]interface{}{
+		"profiles": `{"timezone":"UTC","profiles":[{"start":"22:00","end":"07:00","speed":500},{"days":[0,6],"start":"00:00","end":"00:00","speed":300}]}`,
+	})
+	if err != nil {
+		t.Fatalf("expected valid profiles, got %v", err)
+	}
+	cases := []struct {
+		when time.Time
+		want int
+	}{
+		{time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC), 100},
+		{time.Date(2026, 10, 19, 23, 0, 0, 0, time.UTC), 500},
+		{time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC), 300},
+		{time.Date(2026, 10, 18, 3, 0, 0, 0, time.UTC), 500},
+	}
+	for _, tc := range cases {
+		if got := speedProfilesAt(raw, 100, tc.when); got != tc.want {
+			t.Fatalf("at %s: got %d, want %d", tc.when.Format("Mon 15:04"), got, tc.want)
+		}
+	}
+
+	if _, _, err := parseSpeedProfilesInput(map[string]interface{}{"profiles": `{"profiles":[{"start":"01:00","end":"02:00","speed":0}]}`}); err == nil {
+		t.Fatalf("expected a profile without speed to be rejected")
+	}
+}
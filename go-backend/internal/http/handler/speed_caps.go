@@ -0,0 +1,115 @@
+package handler
+
+import "fmt"
+
+// speedCapSpec is a traffic limiter capping each client IP and each
+// connection of the services referencing it, so one heavy client cannot
+// take the whole forward. Caps only apply to TCP; UDP is limited at service
+// scope only.
+type speedCapSpec struct {
+	Name      string
+	IPSpeed   int // Mbps
+	ConnSpeed int // Mbps
+}
+
+func forwardSpeedCapName(forwardID int64) string {
+	return fmt.Sprintf("cap_forward_%d", forwardID)
+}
+
+func userTunnelSpeedCapName(userTunnelID int64) string {
+	return fmt.Sprintf("cap_usertunnel_%d", userTunnelID)
+}
+
+// parseSpeedCapsInput parses ipSpeed and connSpeed. Fields that were not
+// sent keep the current values.
+func parseSpeedCapsInput(req map[string]interface{}, currentIPSpeed, currentConnSpeed int) (ipSpeed, connSpeed int, present bool, err error) {
+	ipSpeed, ipSet, err := parseConnLimitInput(req, "ipSpeed", bandwidthPoolMaxRate, "单 IP 限速")
+	if err != nil {
+		return 0, 0, true, err
+	}
+	connSpeed, connSet, err := parseConnLimitInput(req, "connSpeed", bandwidthPoolMaxRate, "单连接限速")
+	if err != nil {
+		return 0, 0, true, err
+	}
+	if !ipSet {
+		ipSpeed = currentIPSpeed
+	}
+	if !connSet {
+		connSpeed = currentConnSpeed
+	}
+	return ipSpeed, connSpeed, ipSet || connSet, nil
+}
+
+// forwardSpeedCaps lists the caps of the forward and of the user's tunnel
+// permission.
+func (h *Handler) forwardSpeedCaps(forward *forwardRecord, userTunnelID int64) []speedCapSpec {
+	var specs []speedCapSpec
+	if forward.IPSpeed > 0 || forward.ConnSpeed > 0 {
+		specs = append(specs, speedCapSpec{Name: forwardSpeedCapName(forward.ID), IPSpeed: forward.IPSpeed, ConnSpeed: forward.ConnSpeed})
+	}
+	return append(specs, h.userTunnelSpeedCaps(userTunnelID)...)
+}
+
+// userTunnelSpeedCaps lists the caps of a user's tunnel permission alone.
+func (h *Handler) userTunnelSpeedCaps(userTunnelID int64) []speedCapSpec {
+	if userTunnelID <= 0 {
+		return nil
+	}
+	if ipSpeed, connSpeed := h.repo.GetUserTunnelSpeedCaps(userTunnelID); ipSpeed > 0 || connSpeed > 0 {
+		return []speedCapSpec{{Name: userTunnelSpeedCapName(userTunnelID), IPSpeed: ipSpeed, ConnSpeed: connSpeed}}
+	}
+	return nil
+}
+
+// speedCapLimits renders a cap with the traffic limiter's per-connection
+// ("$$") key and catch-all CIDRs, which give every client IP its own bucket.
+// The agent drops an IP's bucket after it opens no connection for a while, so
+// public forwards do not accumulate one per client ever seen.
+func speedCapLimits(spec speedCapSpec) []string {
+	var limits []string
+	if spec.ConnSpeed > 0 {
+		rate := spec.ConnSpeed * 125000
+		limits = append(limits, fmt.Sprintf("$$ %dB %dB", rate, rate))
+	}
+	if spec.IPSpeed > 0 {
+		rate := spec.IPSpeed * 125000
+		limits = append(limits,
+			fmt.Sprintf("0.0.0.0/0 %dB %dB", rate, rate),
+			fmt.Sprintf("::/0 %dB %dB", rate, rate),
+		)
+	}
+	return limits
+}
+
+// ensureSpeedCapsOnNode upserts the cap limiters; like other traffic limiters
+// a failure leaves traffic uncapped rather than blocked.
+func (h *Handler) ensureSpeedCapsOnNode(nodeID int64, specs []speedCapSpec) {
+	for _, spec := range specs {
+		payload := map[string]interface{}{
+			"limiter": spec.Name,
+			"data": map[string]interface{}{
+				"name":   spec.Name,
+				"limits": speedCapLimits(spec),
+			},
+		}
+		_, _ = h.sendNodeCommand(nodeID, "UpdateLimiters", payload, false, false)
+	}
+}
+
+func applySpeedCaps(services []map[string]interface{}, specs []speedCapSpec) {
+	for _, service := range services {
+		for _, spec := range specs {
+			appendServiceLimiter(service, spec.Name)
+		}
+	}
+}
+
+// speedCapRequirement demands stacked limiter support only when caps are in
+// use.
+func speedCapRequirement(specs []speedCapSpec) nodeCapabilityRequirement {
+	req := nodeCapabilityRequirement{}
+	if len(specs) > 0 {
+		req.Features = []string{"sharedBucket"}
+	}
+	return req
+}
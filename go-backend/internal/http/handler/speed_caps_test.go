@@ -0,0 +1,68 @@
+package handler
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"go-backend/internal/store/model"
+	"go-backend/internal/store/repo"
+)
+
+func TestParseSpeedCapsInput(t *testing.T) {
+	ipSpeed, connSpeed, present, err := parseSpeedCapsInput(map[string]interface{}{"connSpeed": "20"}, 50, 0)
+	if err != nil || !present || ipSpeed != 50 || connSpeed != 20 {
+		t.Fatalf("expected connSpeed update to keep ipSpeed, got %d/%d present=%v err=%v", ipSpeed, connSpeed, present, err)
+	}
+	for _, req := range []map[string]interface{}{
+		{"ipSpeed": float64(-5)},
+		{"connSpeed": 0.5},
+	} {
+		if _, _, _, err := parseSpeedCapsInput(req, 0, 0); err == nil {
+			t.Fatalf("expected %+v to be rejected", req)
+		}
+	}
+}
+
+func TestForwardSpeedCapsStackAfterSpeedLimiter(t *testing.T) {
+	r, err := repo.Open(filepath.Join(t.TempDir(), "speed-caps.db"))
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	t.Cleanup(func() { _ = r.Close() })
+	h := New(r, "secret")
+
+	ut := model.UserTunnel{UserID: 2, TunnelID: 3, Num: 10, FlowResetTime: 1, ExpTime: time.Now().Add(time.Hour).UnixMilli(), Status: 1, ConnSpeed: 10}
+	if err := r.DB().Create(&ut).Error; err != nil {
+		t.Fatalf("insert user_tunnel: %v", err)
+	}
+
+	forward := &forwardRecord{ID: 7, UserID: 2, TunnelID: 3, RemoteAddr: "10.0.0.1:80", IPSpeed: 8}
+	specs := h.forwardSpeedCaps(forward, ut.ID)
+	if len(specs) != 2 {
+		t.Fatalf("expected forward and user tunnel caps, got %+v", specs)
+	}
+	if got := speedCapLimits(specs[0]); !reflect.DeepEqual(got, []string{"0.0.0.0/0 1000000B 1000000B", "::/0 1000000B 1000000B"}) {
+		t.Fatalf("unexpected per-IP limits: %v", got)
+	}
+	if got := speedCapLimits(specs[1]); !reflect.DeepEqual(got, []string{"$$ 1250000B 1250000B"}) {
+		t.Fatalf("unexpected per-connection limits: %v", got)
+	}
+
+	node := &nodeRecord{TCPListenAddr: "[::]", UDPListenAddr: "[::]"}
+	limiterID := int64(5)
+	services := buildForwardServiceConfigs("7_2_1", forward, nil, node, 10000, &limiterID, false)
+	applySpeedCaps(services, specs)
+	want := "5," + forwardSpeedCapName(7) + "," + userTunnelSpeedCapName(ut.ID)
+	for _, service := range services {
+		if service["limiter"] != want {
+			t.Fatalf("unexpected limiter on %v: %v", service["name"], service["limiter"])
+		}
+	}
+
+	legacy := &nodeRecord{Name: "old-agent", Capabilities: `{"features":{"connLimiter":true}}`}
+	if err := validateNodeCapabilities(legacy, speedCapRequirement(specs)); err == nil {
+		t.Fatalf("expected agent without stacked limiter support to be rejected")
+	}
+}
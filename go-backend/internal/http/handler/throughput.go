@@ -0,0 +1,271 @@
+package handler
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-backend/internal/http/response"
+)
+
+const (
+	throughputDefaultDuration = 10
+	throughputMaxDuration     = 30
+	throughputDefaultMB       = 256
+	throughputMaxMB           = 1024
+	// throughputTokenTTL bounds how long an exit accepts a test after the
+	// panel registers it; the entry connects within seconds.
+	throughputTokenTTL = 60
+	// throughputSinkAttempts bounds the rounds spent agreeing on a sink port.
+	throughputSinkAttempts = 3
+)
+
+// throughputOptions bounds one throughput test. The agents clamp the same
+// limits again, so a tampered command cannot turn the sink into a traffic
+// sponge.
+type throughputOptions struct {
+	InNodeID  int64
+	Direction string
+	Duration  int
+	MaxMB     int
+}
+
+func parseThroughputInput(req map[string]interface{}) (throughputOptions, error) {
+	opts := throughputOptions{
+		InNodeID:  asInt64(req["inNodeId"], 0),
+		Direction: strings.ToLower(strings.TrimSpace(asString(req["direction"]))),
+		Duration:  asInt(req["duration"], throughputDefaultDuration),
+		MaxMB:     asInt(req["maxMb"], throughputDefaultMB),
+	}
+	if opts.Direction == "" {
+		opts.Direction = "upload"
+	}
+	if opts.Direction != "upload" && opts.Direction != "download" {
+		return opts, errors.New("测试方向只能是 upload 或 download")
+	}
+	if opts.Duration < 1 || opts.Duration > throughputMaxDuration {
+		return opts, fmt.Errorf("测试时长必须在 1-%d 秒之间", throughputMaxDuration)
+	}
+	if opts.MaxMB < 1 || opts.MaxMB > throughputMaxMB {
+		return opts, fmt.Errorf("测试数据量必须在 1-%d MB 之间", throughputMaxMB)
+	}
+	return opts, nil
+}
+
+func throughputRequirement() nodeCapabilityRequirement {
+	return nodeCapabilityRequirement{Features: []string{"throughputTest"}}
+}
+
+// negotiateThroughputSinkPort finds one loopback port the sinks of all exits
+// listen on, since the chain may pick any exit. start asks exit i to accept
+// the token on port, 0 letting the exit choose. When the port is taken on an
+// exit, that exit chooses one and the exits before it are asked again.
+func negotiateThroughputSinkPort(exits int, start func(i, port int) (int, error)) (int, error) {
+	port := 0
+	for attempt := 0; attempt < throughputSinkAttempts; attempt++ {
+		moved := false
+		for i := 0; i < exits; i++ {
+			got, err := start(i, port)
+			if err != nil && port != 0 {
+				got, err = start(i, 0)
+			}
+			if err != nil {
+				return 0, err
+			}
+			if got != port {
+				moved = moved || i > 0
+				port = got
+			}
+		}
+		if !moved {
+			return port, nil
+		}
+	}
+	return 0, errors.New("出口节点无法在同一端口启动测速接收端")
+}
+
+func generateThroughputToken() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+func (h *Handler) tunnelThroughputTest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		response.WriteJSON(w, response.ErrDefault("请求失败"))
+		return
+	}
+	var req map[string]interface{}
+	if err := decodeJSON(r.Body, &req); err != nil {
+		response.WriteJSON(w, response.ErrDefault("请求参数错误"))
+		return
+	}
+	id := asInt64(req["tunnelId"], 0)
+	if id <= 0 {
+		response.WriteJSON(w, response.ErrDefault("参数错误"))
+		return
+	}
+	opts, err := parseThroughputInput(req)
+	if err != nil {
+		response.WriteJSON(w, response.ErrDefault(err.Error()))
+		return
+	}
+	if !h.beginThroughputTest(id) {
+		response.WriteJSON(w, response.ErrDefault("该隧道正在进行吞吐测试"))
+		return
+	}
+	defer h.endThroughputTest(id)
+
+	result, err := h.runTunnelThroughputTest(id, opts)
+	if err != nil {
+		response.WriteJSON(w, response.Err(-2, err.Error()))
+		return
+	}
+	response.WriteJSON(w, response.OK(result))
+}
+
+// beginThroughputTest allows one test per tunnel at a time; concurrent tests
+// would share the link and report each other's traffic.
+func (h *Handler) beginThroughputTest(tunnelID int64) bool {
+	h.throughputMu.Lock()
+	defer h.throughputMu.Unlock()
+	if _, running := h.throughputTests[tunnelID]; running {
+		return false
+	}
+	h.throughputTests[tunnelID] = struct{}{}
+	return true
+}
+
+func (h *Handler) endThroughputTest(tunnelID int64) {
+	h.throughputMu.Lock()
+	delete(h.throughputTests, tunnelID)
+	h.throughputMu.Unlock()
+}
+
+// runTunnelThroughputTest registers a one-time token with a loopback sink on
+// every exit node, then has the entry node stream test data through the
+// tunnel chain to it. The entry pushes ThroughputProgress messages while the
+// test runs, which the websocket server relays to admins as
+// throughput_progress; the final result is returned here.
+func (h *Handler) runTunnelThroughputTest(tunnelID int64, opts throughputOptions) (map[string]interface{}, error) {
+	tunnel, err := h.getTunnelRecord(tunnelID)
+	if err != nil {
+		return nil, err
+	}
+	if tunnel.Type != 2 {
+		return nil, errors.New("仅隧道转发支持吞吐测试")
+	}
+	chainRows, err := h.listChainNodesForTunnel(tunnelID)
+	if err != nil {
+		return nil, err
+	}
+	inNodes, _, outNodes := splitChainNodeGroups(chainRows)
+	if len(inNodes) == 0 || len(outNodes) == 0 {
+		return nil, errors.New("隧道配置不完整")
+	}
+
+	entry := inNodes[0]
+	if opts.InNodeID > 0 {
+		found := false
+		for _, inNode := range inNodes {
+			if inNode.NodeID == opts.InNodeID {
+				entry, found = inNode, true
+				break
+			}
+		}
+		if !found {
+			return nil, errors.New("入口节点不属于该隧道")
+		}
+	}
+
+	nodeCache := map[int64]*nodeRecord{}
+	testNodes := append([]chainNodeRecord{entry}, outNodes...)
+	for _, row := range testNodes {
+		node, err := h.cachedNode(nodeCache, row.NodeID)
+		if err != nil {
+			return nil, err
+		}
+		if node.IsRemote == 1 {
+			return nil, fmt.Errorf("远程节点(%s)暂不支持吞吐测试", node.Name)
+		}
+		if err := validateNodeCapabilities(node, throughputRequirement()); err != nil {
+			return nil, err
+		}
+	}
+
+	token, err := generateThroughputToken()
+	if err != nil {
+		return nil, err
+	}
+	sinkPort, err := negotiateThroughputSinkPort(len(outNodes), func(i, port int) (int, error) {
+		outNode := outNodes[i]
+		res, err := h.sendNodeCommand(outNode.NodeID, "StartThroughputSink", map[string]interface{}{
+			"token": token,
+			"port":  port,
+			"ttl":   throughputTokenTTL,
+		}, false, false)
+		if err != nil {
+			return 0, fmt.Errorf("出口节点 %s 启动测速接收端失败: %w", outNode.NodeName, err)
+		}
+		got := asInt(res.Data["port"], 0)
+		if got <= 0 {
+			return 0, fmt.Errorf("出口节点 %s 未返回测速端口", outNode.NodeName)
+		}
+		return got, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	testID := fmt.Sprintf("%d-%d", tunnelID, time.Now().UnixMilli())
+	payload := map[string]interface{}{
+		"testId":    testID,
+		"chain":     fmt.Sprintf("chains_%d", tunnelID),
+		"target":    net.JoinHostPort("127.0.0.1", strconv.Itoa(sinkPort)),
+		"token":     token,
+		"direction": opts.Direction,
+		"duration":  opts.Duration,
+		"maxBytes":  int64(opts.MaxMB) << 20,
+	}
+	timeout := time.Duration(opts.Duration)*time.Second + 30*time.Second
+	res, err := h.wsServer.SendCommand(entry.NodeID, "ThroughputTest", payload, timeout)
+	if err == nil && res.Data == nil {
+		err = errors.New("节点未返回测试数据")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("吞吐测试失败: %w", err)
+	}
+
+	data := res.Data
+	success := asBool(data["success"], false)
+	message := strings.TrimSpace(asString(data["errorMessage"]))
+	if success {
+		message = fmt.Sprintf("%.2f Mbps", asFloat(data["mbps"], 0))
+	} else if message == "" {
+		message = "吞吐测试失败"
+	}
+	return map[string]interface{}{
+		"testId":      testID,
+		"tunnelId":    tunnelID,
+		"nodeId":      entry.NodeID,
+		"nodeName":    entry.NodeName,
+		"direction":   opts.Direction,
+		"success":     success,
+		"message":     message,
+		"bytes":       asInt64(data["bytes"], 0),
+		"elapsedTime": asFloat(data["elapsedTime"], 0),
+		"mbps":        asFloat(data["mbps"], 0),
+		"averageRtt":  asFloat(data["averageRtt"], 0),
+		"minRtt":      asFloat(data["minRtt"], 0),
+		"maxRtt":      asFloat(data["maxRtt"], 0),
+		"timestamp":   time.Now().UnixMilli(),
+	}, nil
+}
@@ -0,0 +1,128 @@
+package handler
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"go-backend/internal/store/repo"
+)
+
+func TestParseThroughputInput(t *testing.T) {
+	opts, err := parseThroughputInput(map[string]interface{}{})
+	if err != nil || opts.Direction != "upload" || opts.Duration != throughputDefaultDuration || opts.MaxMB != throughputDefaultMB {
+		t.Fatalf("unexpected defaults %+v %v", opts, err)
+	}
+	opts, err = parseThroughputInput(map[string]interface{}{"direction": "Download", "duration": 5, "maxMb": 64, "inNodeId": 3})
+	if err != nil || opts.Direction != "download" || opts.Duration != 5 || opts.MaxMB != 64 || opts.InNodeID != 3 {
+		t.Fatalf("unexpected options %+v %v", opts, err)
+	}
+	for _, bad := range []map[string]interface{}{
+		{"direction": "both"},
+		{"duration": 0},
+		{"duration": throughputMaxDuration + 1},
+		{"maxMb": throughputMaxMB + 1},
+	} {
+		if _, err := parseThroughputInput(bad); err == nil {
+			t.Fatalf("expected %v to be rejected", bad)
+		}
+	}
+}
+
+func TestThroughputTestRunsOncePerTunnel(t *testing.T) {
+	h := &Handler{throughputTests: make(map[int64]struct{})}
+	if !h.beginThroughputTest(5) {
+		t.Fatalf("expected the first test to start")
+	}
+	if h.beginThroughputTest(5) {
+		t.Fatalf("expected a concurrent test on the same tunnel to be refused")
+	}
+	if !h.beginThroughputTest(6) {
+		t.Fatalf("expected other tunnels to be unaffected")
+	}
+	h.endThroughputTest(5)
+	if !h.beginThroughputTest(5) {
+		t.Fatalf("expected a new test once the previous one finished")
+	}
+}
+
+func TestRunTunnelThroughputTestValidatesTunnel(t *testing.T) {
+	r, err := repo.Open(filepath.Join(t.TempDir(), "throughput.db"))
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	t.Cleanup(func() { _ = r.Close() })
+	h := New(r, "secret")
+	now := time.Now().UnixMilli()
+
+	db := r.DB()
+	for _, stmt := range []string{
+		`INSERT INTO tunnel(id, name, traffic_ratio, type, protocol, flow, created_time, updated_time, status, inx) VALUES (4, 'direct', 1.0, 1, 'tls', 0, 0, 0, 1, 0)`,
+		`INSERT INTO tunnel(id, name, traffic_ratio, type, protocol, flow, created_time, updated_time, status, inx) VALUES (5, 't', 1.0, 2, 'tls', 0, 0, 0, 1, 0)`,
+		`INSERT INTO chain_tunnel(tunnel_id, chain_type, node_id, port, strategy, inx, protocol) VALUES (4, 1, 1, 30000, 'round', 1, 'tls')`,
+		`INSERT INTO chain_tunnel(tunnel_id, chain_type, node_id, port, strategy, inx, protocol) VALUES (5, 1, 1, 30001, 'round', 1, 'tls'), (5, 3, 2, 30003, 'round', 1, 'tls')`,
+	} {
+		if err := db.Exec(stmt).Error; err != nil {
+			t.Fatalf("seed: %v", err)
+		}
+	}
+	for id, name := range map[int64]string{1: "entry", 2: "exit"} {
+		if err := db.Exec(`
+			INSERT INTO node(id, name, secret, server_ip, server_ip_v4, server_ip_v6, port, interface_name, version, http, tls, socks, created_time, updated_time, status, tcp_listen_addr, udp_listen_addr, inx, capabilities)
+			VALUES(?, ?, ?, ?, '', '', '30000-30010', '', 'v1', 1, 1, 1, ?, ?, 1, '[::]', '[::]', 0, ?)
+		`, id, name, name+"-secret", "10.0.1.1", now, now, `{"features":{"udpProbe":true}}`).Error; err != nil {
+			t.Fatalf("insert node: %v", err)
+		}
+	}
+
+	if _, err := h.runTunnelThroughputTest(4, throughputOptions{Direction: "upload", Duration: 5, MaxMB: 10}); err == nil || !strings.Contains(err.Error(), "仅隧道转发") {
+		t.Fatalf("expected a port forwarding tunnel to be rejected, got %v", err)
+	}
+	if _, err := h.runTunnelThroughputTest(5, throughputOptions{InNodeID: 2, Direction: "upload", Duration: 5, MaxMB: 10}); err == nil || !strings.Contains(err.Error(), "入口节点不属于该隧道") {
+		t.Fatalf("expected an exit node to be refused as the entry, got %v", err)
+	}
+	if _, err := h.runTunnelThroughputTest(5, throughputOptions{Direction: "upload", Duration: 5, MaxMB: 10}); err == nil || !strings.Contains(err.Error(), "feature:throughputTest") {
+		t.Fatalf("expected agents without throughput support to be reported, got %v", err)
+	}
+}
+
+func TestNegotiateThroughputSinkPortRetriesBusyPorts(t *testing.T) {
+	// Exit 0 picks 40000, which is taken on exit 1; exit 1 picks 40001 and
+	// exit 0 is asked again.
+	busy := map[int]map[int]bool{1: {40000: true}}
+	free := map[int]int{0: 40000, 1: 40001}
+	asked := map[int][]int{}
+	port, err := negotiateThroughputSinkPort(2, func(i, port int) (int, error) {
+		asked[i] = append(asked[i], port)
+		if port == 0 {
+			return free[i], nil
+		}
+		if busy[i][port] {
+			return 0, errors.New("address already in use")
+		}
+		return port, nil
+	})
+	if err != nil || port != 40001 {
+		t.Fatalf("expected both exits on 40001, got %d %v", port, err)
+	}
+	if len(asked[0]) != 2 || asked[0][1] != 40001 {
+		t.Fatalf("expected exit 0 to move to 40001, asked %v", asked[0])
+	}
+
+	// Exits that never agree give up after a bounded number of rounds.
+	next := 50000
+	if _, err := negotiateThroughputSinkPort(2, func(i, port int) (int, error) {
+		if port != 0 && i == 1 {
+			return 0, errors.New("address already in use")
+		}
+		if port == 0 {
+			next++
+			return next, nil
+		}
+		return port, nil
+	}); err == nil {
+		t.Fatalf("expected exits that never agree to fail")
+	}
+}
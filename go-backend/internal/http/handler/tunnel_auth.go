@@ -0,0 +1,145 @@
+package handler
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"go-backend/internal/http/client"
+)
+
+// Relay listeners on hop and exit nodes only accept the tunnel's own
+// credential, so a discovered port cannot be used as an open relay. The
+// credential is per tunnel: rotating one never touches the services of
+// another tunnel on the same node.
+
+const relaySecretBackfillInterval = time.Minute
+
+func tunnelRelayUsername(tunnelID int64) string {
+	return fmt.Sprintf("tunnel_%d", tunnelID)
+}
+
+func generateTunnelRelaySecret() (string, error) {
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// relayAuth returns the gost auth block for the tunnel, or nil for tunnels
+// deployed before credentials existed.
+func (s *tunnelCreateState) relayAuth() map[string]interface{} {
+	if s == nil || strings.TrimSpace(s.RelaySecret) == "" {
+		return nil
+	}
+	return map[string]interface{}{
+		"username": tunnelRelayUsername(s.TunnelID),
+		"password": s.RelaySecret,
+	}
+}
+
+func (s *tunnelCreateState) federationRelayAuth() *client.RuntimeAuth {
+	if s == nil || strings.TrimSpace(s.RelaySecret) == "" {
+		return nil
+	}
+	return &client.RuntimeAuth{
+		Username: tunnelRelayUsername(s.TunnelID),
+		Password: s.RelaySecret,
+	}
+}
+
+// ensureTunnelRelaySecret generates and stores a credential for a tunnel
+// that has none yet. Only call it when the whole runtime is about to be
+// pushed, otherwise services and chains would disagree.
+func (h *Handler) ensureTunnelRelaySecret(state *tunnelCreateState) error {
+	if state == nil || state.Type != 2 || strings.TrimSpace(state.RelaySecret) != "" {
+		return nil
+	}
+	secret, err := generateTunnelRelaySecret()
+	if err != nil {
+		return err
+	}
+	if err := h.repo.UpdateTunnelRelaySecret(state.TunnelID, secret); err != nil {
+		return err
+	}
+	state.RelaySecret = secret
+	return nil
+}
+
+// runRelaySecretBackfillLoop gives every tunnel deployed before relay
+// credentials existed a credential, until none is left.
+func (h *Handler) runRelaySecretBackfillLoop(ctx context.Context) {
+	defer h.jobsWG.Done()
+
+	ticker := time.NewTicker(relaySecretBackfillInterval)
+	defer ticker.Stop()
+	for h.backfillTunnelRelaySecrets() > 0 {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// backfillTunnelRelaySecrets redeploys the tunnels without a credential,
+// which generates one, and returns how many are left. A tunnel waits until
+// its local nodes are connected, so its relays and chains switch together.
+func (h *Handler) backfillTunnelRelaySecrets() int {
+	ids, err := h.repo.ListTunnelIDsWithoutRelaySecret()
+	if err != nil {
+		fmt.Printf("relay secret backfill: list tunnels failed: %v\n", err)
+		return 1
+	}
+	left := 0
+	for _, id := range ids {
+		state, err := h.reconstructTunnelState(id)
+		if err != nil || !h.tunnelNodesConnected(state) {
+			left++
+			continue
+		}
+		if err := h.redeployTunnelAndForwards(id); err != nil {
+			fmt.Printf("relay secret backfill: tunnel %d failed: %v\n", id, err)
+		}
+	}
+	return left
+}
+
+func (h *Handler) tunnelNodesConnected(state *tunnelCreateState) bool {
+	for id, node := range state.Nodes {
+		if node != nil && node.IsRemote == 1 {
+			continue
+		}
+		if !h.wsServer.NodeSupportsCommand(id, "UpdateService") {
+			return false
+		}
+	}
+	return true
+}
+
+// applyFederationRole sends the tunnel credential along with the role. Peers
+// from before relay auth reject the unknown field: an exit can still be
+// applied without it (our chains just send credentials it ignores), but a
+// middle hop could never reach our authenticated relays.
+func applyFederationRole(fc *client.FederationClient, url, token, localDomain string, req client.RuntimeApplyRoleRequest) (*client.RuntimeApplyRoleResponse, error) {
+	res, err := fc.ApplyRole(url, token, localDomain, req)
+	if err == nil || !strings.Contains(err.Error(), "Invalid JSON") {
+		return res, err
+	}
+	if len(req.TransportOptions) > 0 {
+		return nil, errors.New("远程面板版本过旧，不支持自定义传输配置，请先升级远程面板")
+	}
+	if req.Auth == nil {
+		return res, err
+	}
+	if req.Role == "middle" {
+		return nil, errors.New("远程面板版本过旧，不支持中继认证，请先升级远程面板")
+	}
+	req.Auth = nil
+	return fc.ApplyRole(url, token, localDomain, req)
+}
@@ -0,0 +1,108 @@
+package handler
+
+import (
+	"path/filepath"
+	"testing"
+
+	"go-backend/internal/store/repo"
+)
+
+func TestTunnelRelayAuthOnChainsAndServices(t *testing.T) {
+	state := multiHopTestState()
+	state.ChainMode = tunnelChainModeRelay
+	state.RelaySecret = "s3cret"
+
+	chain, err := buildTunnelEntryChainConfig(state, 1)
+	if err != nil {
+		t.Fatalf("build chain: %v", err)
+	}
+	node := chain["hops"].([]map[string]interface{})[0]["nodes"].([]map[string]interface{})[0]
+	auth, _ := node["connector"].(map[string]interface{})["auth"].(map[string]interface{})
+	if auth["username"] != "tunnel_9" || auth["password"] != "s3cret" {
+		t.Fatalf("expected connector auth for tunnel 9, got %+v", node["connector"])
+	}
+
+	for _, target := range []tunnelRuntimeNode{state.ChainHops[0][0], state.OutNodes[0]} {
+		service := buildTunnelChainServiceConfig(state, target, true)
+		handlerAuth, _ := service[0]["handler"].(map[string]interface{})["auth"].(map[string]interface{})
+		if handlerAuth["password"] != "s3cret" {
+			t.Fatalf("expected relay handler auth on node %d, got %+v", target.NodeID, service[0]["handler"])
+		}
+	}
+
+	state.RelaySecret = ""
+	if state.relayAuth() != nil || state.federationRelayAuth() != nil {
+		t.Fatalf("expected no auth for tunnels without a credential")
+	}
+	chain, _ = buildTunnelEntryChainConfig(state, 1)
+	node = chain["hops"].([]map[string]interface{})[0]["nodes"].([]map[string]interface{})[0]
+	if _, ok := node["connector"].(map[string]interface{})["auth"]; ok {
+		t.Fatalf("expected legacy tunnel chain without connector auth")
+	}
+}
+
+func TestGenerateTunnelRelaySecretIsUnique(t *testing.T) {
+	a, err := generateTunnelRelaySecret()
+	if err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+	b, _ := generateTunnelRelaySecret()
+	if len(a) != 48 || a == b {
+		t.Fatalf("expected distinct 48-char secrets, got %q and %q", a, b)
+	}
+}
+
+func TestBackfillTunnelRelaySecretsWaitsForConnectedNodes(t *testing.T) {
+	r, err := repo.Open(filepath.Join(t.TempDir(), "relay.db"))
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	t.Cleanup(func() { _ = r.Close() })
+	h := New(r, "secret")
+
+	insertOfflineNode(t, r, 1, "entry")
+	insertOfflineNode(t, r, 2, "exit")
+	for _, stmt := range []string{
+		`INSERT INTO tunnel(id, name, traffic_ratio, type, protocol, flow, created_time, updated_time, status, inx) VALUES (5, 't', 1.0, 2, 'tls', 0, 0, 0, 1, 0)`,
+		`INSERT INTO chain_tunnel(tunnel_id, chain_type, node_id, port, strategy, inx, protocol) VALUES (5, 1, 1, 30001, 'round', 1, 'tls'), (5, 3, 2, 30003, 'round', 1, 'tls')`,
+	} {
+		if err := r.DB().Exec(stmt).Error; err != nil {
+			t.Fatalf("seed: %v", err)
+		}
+	}
+
+	entry := connectFakeNodeAgent(t, h, 1, "entry-secret")
+	entry.hello(t, map[string]interface{}{"schemaVersion": 1, "commands": []string{"UpdateService", "AddChains", "UpdateChains", "DeleteChains", "AddService", "DeleteService"}})
+	waitNodeHello(t, h, 1)
+
+	// The exit relay is offline, so switching the tunnel now would leave the
+	// entry's chain sending credentials the relay does not know yet.
+	if left := h.backfillTunnelRelaySecrets(); left != 1 || r.GetTunnelRelaySecret(5) != "" {
+		t.Fatalf("expected the tunnel to wait for its exit node, left=%d", left)
+	}
+
+	exit := connectFakeNodeAgent(t, h, 2, "exit-secret")
+	exit.hello(t, map[string]interface{}{"schemaVersion": 1, "commands": []string{"UpdateService", "AddChains", "UpdateChains", "DeleteChains", "AddService", "DeleteService"}})
+	waitNodeHello(t, h, 2)
+
+	if left := h.backfillTunnelRelaySecrets(); left != 0 {
+		t.Fatalf("expected every tunnel to be backfilled, left=%d", left)
+	}
+	secret := r.GetTunnelRelaySecret(5)
+	if secret == "" {
+		t.Fatalf("expected a relay secret to be generated")
+	}
+	var relayAuth map[string]interface{}
+	for _, cmd := range append(exit.sent("AddService"), exit.sent("UpdateService")...) {
+		for _, item := range cmd.Items {
+			service, _ := item.(map[string]interface{})
+			handler, _ := service["handler"].(map[string]interface{})
+			if auth, ok := handler["auth"].(map[string]interface{}); ok {
+				relayAuth = auth
+			}
+		}
+	}
+	if relayAuth["password"] != secret {
+		t.Fatalf("expected the exit relay to be redeployed with the new secret, got %+v", relayAuth)
+	}
+}
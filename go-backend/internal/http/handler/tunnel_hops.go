@@ -0,0 +1,371 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Tunnel chain modes. In relay mode (the default) every node only knows its
+// next hop group and hop nodes run their own chains_<id>. In multihop mode
+// the entry node carries the whole path as one gost chain and hop nodes are
+// plain relays that connect wherever the entry tells them to.
+const (
+	tunnelChainModeRelay    = ""
+	tunnelChainModeMultiHop = "multihop"
+)
+
+// parseTunnelChainMode reads the optional chainMode field. present is false
+// when the field was not sent at all.
+func parseTunnelChainMode(req map[string]interface{}) (mode string, present bool, err error) {
+	raw, ok := req["chainMode"]
+	if !ok || raw == nil {
+		return tunnelChainModeRelay, false, nil
+	}
+	switch strings.ToLower(strings.TrimSpace(asString(raw))) {
+	case "", "relay":
+		return tunnelChainModeRelay, true, nil
+	case tunnelChainModeMultiHop:
+		return tunnelChainModeMultiHop, true, nil
+	default:
+		return "", true, errors.New("链路模式仅支持: relay, multihop")
+	}
+}
+
+// normalizeTunnelHopGroups rewrites chainNodes into the per-node layout the
+// rest of the tunnel code reads. Each group may be a plain node list or an
+// object {strategy, protocol, nodes}; either way every node of a group ends
+// up with the group's strategy, since one gost hop has a single selector.
+// The exit group gets the same treatment.
+func normalizeTunnelHopGroups(req map[string]interface{}) error {
+	if raw, ok := req["chainNodes"]; ok && raw != nil {
+		groups := asAnySlice(raw)
+		if groups == nil {
+			return errors.New("转发链配置格式错误")
+		}
+		normalized := make([]interface{}, 0, len(groups))
+		for idx, group := range groups {
+			var (
+				nodes    []map[string]interface{}
+				strategy string
+				protocol string
+			)
+			switch g := group.(type) {
+			case []interface{}:
+				nodes = asMapSlice(g)
+			case map[string]interface{}:
+				nodes = asMapSlice(g["nodes"])
+				strategy = asString(g["strategy"])
+				protocol = asString(g["protocol"])
+			default:
+				return fmt.Errorf("第%d跳配置格式错误", idx+1)
+			}
+			items, err := normalizeTunnelHopGroupNodes(nodes, strategy, protocol)
+			if err != nil {
+				return fmt.Errorf("第%d跳%s", idx+1, err.Error())
+			}
+			normalized = append(normalized, items)
+		}
+		req["chainNodes"] = normalized
+	}
+
+	if raw, ok := req["outNodeId"]; ok && raw != nil {
+		items, err := normalizeTunnelHopGroupNodes(asMapSlice(raw), "", "")
+		if err != nil {
+			return fmt.Errorf("出口%s", err.Error())
+		}
+		req["outNodeId"] = items
+	}
+	return nil
+}
+
+func normalizeTunnelHopGroupNodes(nodes []map[string]interface{}, strategy, protocol string) ([]interface{}, error) {
+	if strings.TrimSpace(strategy) == "" {
+		for _, node := range nodes {
+			if s := strings.TrimSpace(asString(node["strategy"])); s != "" {
+				strategy = s
+				break
+			}
+		}
+	}
+	strategy, err := normalizeSelectorStrategy(strategy, "round")
+	if err != nil {
+		return nil, err
+	}
+	// The agent only measures the latency of forward targets, so a hop group
+	// would never get past round robin.
+	if strategy == "latency" {
+		return nil, errors.New("节点组不支持 latency 负载策略")
+	}
+	protocol = strings.TrimSpace(protocol)
+
+	items := make([]interface{}, 0, len(nodes))
+	for _, node := range nodes {
+		node["strategy"] = strategy
+		if protocol != "" && strings.TrimSpace(asString(node["protocol"])) == "" {
+			node["protocol"] = protocol
+		}
+		items = append(items, node)
+	}
+	return items, nil
+}
+
+// validateTunnelChainMode checks that a multihop tunnel can be expressed as
+// one chain: there has to be at least one hop group, hop nodes must be local
+// (federated hops build their own chains) and every node of a group must be
+// reachable at the same address from all nodes of the previous group.
+func validateTunnelChainMode(state *tunnelCreateState) error {
+	if state == nil || state.ChainMode != tunnelChainModeMultiHop {
+		return nil
+	}
+	if state.Type != 2 {
+		return errors.New("多跳链模式仅适用于隧道转发")
+	}
+	if len(state.ChainHops) == 0 {
+		return errors.New("多跳链模式至少需要一个中间跳")
+	}
+	for i, hop := range state.ChainHops {
+		for _, chainNode := range hop {
+			if node := state.Nodes[chainNode.NodeID]; node != nil && node.IsRemote == 1 {
+				return fmt.Errorf("多跳链模式不支持远程节点作为第%d跳", i+1)
+			}
+		}
+	}
+	for _, inNode := range state.InNodes {
+		if _, err := buildTunnelMultiHopChainConfig(state, inNode.NodeID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// tunnelHopGroups returns the hop groups after the entry: the middle hops
+// followed by the exit group.
+func tunnelHopGroups(state *tunnelCreateState) [][]tunnelRuntimeNode {
+	groups := make([][]tunnelRuntimeNode, 0, len(state.ChainHops)+1)
+	groups = append(groups, state.ChainHops...)
+	return append(groups, state.OutNodes)
+}
+
+// hopNodesRunChains reports whether middle hop nodes carry their own chain.
+func (s *tunnelCreateState) hopNodesRunChains() bool {
+	return s.ChainMode != tunnelChainModeMultiHop
+}
+
+// buildTunnelEntryChainConfig builds chains_<id> for an entry node in the
+// tunnel's chain mode.
+func buildTunnelEntryChainConfig(state *tunnelCreateState, inNodeID int64) (map[string]interface{}, error) {
+	if state.ChainMode == tunnelChainModeMultiHop {
+		return buildTunnelMultiHopChainConfig(state, inNodeID)
+	}
+	return buildTunnelChainConfig(state, inNodeID, activeTunnelTargets(tunnelHopGroups(state)[0], state.Nodes))
+}
+
+// buildTunnelMultiHopChainConfig emits one gost hop per group. The first hop
+// keeps the hop_<id> name (and the active health check, which the entry can
+// actually reach); later hops are hop_<id>_<n> and are dialed by the relays of
+// the previous group.
+func buildTunnelMultiHopChainConfig(state *tunnelCreateState, fromNodeID int64) (map[string]interface{}, error) {
+	fromNode := state.Nodes[fromNodeID]
+	if fromNode == nil {
+		return nil, errors.New("节点不存在")
+	}
+
+	groups := tunnelHopGroups(state)
+	hops := make([]map[string]interface{}, 0, len(groups))
+	froms := []*nodeRecord{fromNode}
+	for i, group := range groups {
+		targets := activeTunnelTargets(group, state.Nodes)
+		name := fmt.Sprintf("hop_%d", state.TunnelID)
+		if i > 0 {
+			name = fmt.Sprintf("hop_%d_%d", state.TunnelID, i+1)
+		}
+		hop, err := buildTunnelHop(state, name, froms, targets, i == 0)
+		if err != nil {
+			return nil, err
+		}
+		if i == 0 && strings.TrimSpace(fromNode.InterfaceName) != "" {
+			hop["interface"] = fromNode.InterfaceName
+		}
+		hops = append(hops, hop)
+
+		froms = make([]*nodeRecord, 0, len(targets))
+		for _, target := range targets {
+			froms = append(froms, state.Nodes[target.NodeID])
+		}
+	}
+
+	return map[string]interface{}{
+		"name": fmt.Sprintf("chains_%d", state.TunnelID),
+		"hops": hops,
+	}, nil
+}
+
+// buildTunnelHop builds one hop whose targets are dialed from every node in
+// froms. All of them must resolve a target to the same address, because a
+// hop node carries a single address. Only a checked hop carries the tunnel's
+// health check.
+func buildTunnelHop(state *tunnelCreateState, name string, froms []*nodeRecord, targets []tunnelRuntimeNode, checked bool) (map[string]interface{}, error) {
+	if len(froms) == 0 || froms[0] == nil {
+		return nil, errors.New("节点不存在")
+	}
+	if len(targets) == 0 {
+		return nil, errors.New("转发链目标不能为空")
+	}
+	var healthCheck *healthCheckConfig
+	if checked {
+		healthCheck = state.HealthCheck
+	}
+	relayAuth := state.relayAuth()
+	nodeItems := make([]map[string]interface{}, 0, len(targets))
+	for idx, target := range targets {
+		targetNode := state.Nodes[target.NodeID]
+		if targetNode == nil {
+			return nil, errors.New("节点不存在")
+		}
+		host, err := selectTunnelDialHost(froms[0], targetNode, state.IPPreference)
+		if err != nil {
+			return nil, err
+		}
+		for _, from := range froms[1:] {
+			other, err := selectTunnelDialHost(from, targetNode, state.IPPreference)
+			if err != nil {
+				return nil, err
+			}
+			if other != host {
+				return nil, fmt.Errorf("多跳链模式下节点 %s 与 %s 到 %s 的连接地址不一致", nodeDisplayName(froms[0]), nodeDisplayName(from), nodeDisplayName(targetNode))
+			}
+		}
+		port := target.Port
+		if port <= 0 {
+			return nil, errors.New("节点端口不能为空")
+		}
+		protocol := defaultString(target.Protocol, "tls")
+		connector := map[string]interface{}{
+			"type": "relay",
+		}
+		if isTLSTunnelProtocol(protocol) {
+			connector["metadata"] = map[string]interface{}{"nodelay": true}
+		}
+		if relayAuth != nil {
+			connector["auth"] = relayAuth
+		}
+		nodeItem := map[string]interface{}{
+			"name":      fmt.Sprintf("node_%d", idx+1),
+			"addr":      processServerAddress(fmt.Sprintf("%s:%d", host, port)),
+			"connector": connector,
+			"dialer":    buildTunnelDialerConfig(protocol, state.Transport),
+		}
+		if md := healthCheckMetadata(healthCheck); md != nil {
+			nodeItem["metadata"] = md
+		}
+		nodeItems = append(nodeItems, nodeItem)
+	}
+
+	strategy := defaultString(strings.TrimSpace(targets[0].Strategy), "round")
+	return map[string]interface{}{
+		"name": name,
+		"selector": map[string]interface{}{
+			"strategy":    strategy,
+			"maxFails":    1,
+			"failTimeout": int64(healthCheckFailTimeout(healthCheck, 600*time.Second)),
+		},
+		"nodes": nodeItems,
+	}, nil
+}
+
+// summarizeTunnelHopLatency groups the node-to-node diagnosis results by
+// stage (entry -> hop 1 -> ... -> exit) and reports the best and average
+// latency of each stage. estimatedLatency sums the best of every stage, which
+// is what a connection pays when each selector picks its fastest node.
+func summarizeTunnelHopLatency(results []map[string]interface{}) ([]map[string]interface{}, float64) {
+	type stageKey struct {
+		fromType, fromInx, toType, toInx int
+	}
+	type stageAcc struct {
+		total, success int
+		best, sum      float64
+	}
+
+	accs := map[stageKey]*stageAcc{}
+	order := make([]stageKey, 0)
+	for _, item := range results {
+		toType := asInt(item["toChainType"], 0)
+		if toType == 0 {
+			continue
+		}
+		key := stageKey{
+			fromType: asInt(item["fromChainType"], 0),
+			fromInx:  asInt(item["fromInx"], 0),
+			toType:   toType,
+			toInx:    asInt(item["toInx"], 0),
+		}
+		acc := accs[key]
+		if acc == nil {
+			acc = &stageAcc{best: -1}
+			accs[key] = acc
+			order = append(order, key)
+		}
+		acc.total++
+		if !asBool(item["success"], false) {
+			continue
+		}
+		latency := asFloat(item["averageTime"], 0)
+		acc.success++
+		acc.sum += latency
+		if acc.best < 0 || latency < acc.best {
+			acc.best = latency
+		}
+	}
+
+	stageRank := func(chainType, inx int) int {
+		switch chainType {
+		case 1:
+			return 0
+		case 2:
+			return inx
+		default:
+			return 1 << 20
+		}
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return stageRank(order[i].toType, order[i].toInx) < stageRank(order[j].toType, order[j].toInx)
+	})
+
+	stageName := func(chainType, inx int) string {
+		switch chainType {
+		case 1:
+			return "入口"
+		case 2:
+			return fmt.Sprintf("第%d跳", inx)
+		default:
+			return "出口"
+		}
+	}
+
+	hops := make([]map[string]interface{}, 0, len(order))
+	estimated := 0.0
+	for _, key := range order {
+		acc := accs[key]
+		item := map[string]interface{}{
+			"description":   fmt.Sprintf("%s->%s", stageName(key.fromType, key.fromInx), stageName(key.toType, key.toInx)),
+			"fromChainType": key.fromType,
+			"fromInx":       key.fromInx,
+			"toChainType":   key.toType,
+			"toInx":         key.toInx,
+			"total":         acc.total,
+			"success":       acc.success,
+			"bestTime":      0.0,
+			"averageTime":   0.0,
+		}
+		if acc.success > 0 {
+			item["bestTime"] = acc.best
+			item["averageTime"] = acc.sum / float64(acc.success)
+			estimated += acc.best
+		}
+		hops = append(hops, item)
+	}
+	return hops, estimated
+}
@@ -0,0 +1,173 @@
+package handler
+
+import (
+	"strings"
+	"testing"
+)
+
+func multiHopTestState() *tunnelCreateState {
+	return &tunnelCreateState{
+		TunnelID:    9,
+		Type:        2,
+		ChainMode:   tunnelChainModeMultiHop,
+		HealthCheck: &healthCheckConfig{Type: "tcp", Interval: 5, Timeout: 2, Fails: 2, Passes: 1},
+		InNodes:     []tunnelRuntimeNode{{NodeID: 1, ChainType: 1}},
+		ChainHops: [][]tunnelRuntimeNode{
+			{{NodeID: 2, Protocol: "tls", Strategy: "fifo", ChainType: 2, Inx: 1, Port: 20001}},
+			{
+				{NodeID: 3, Protocol: "ws", Strategy: "latency", ChainType: 2, Inx: 2, Port: 20002},
+				{NodeID: 4, Protocol: "ws", Strategy: "latency", ChainType: 2, Inx: 2, Port: 20003},
+			},
+		},
+		OutNodes: []tunnelRuntimeNode{{NodeID: 5, Protocol: "tls", Strategy: "round", ChainType: 3, Port: 20004}},
+		Nodes: map[int64]*nodeRecord{
+			1: {ID: 1, Name: "in", ServerIPv4: "10.0.0.1"},
+			2: {ID: 2, Name: "hop1", ServerIPv4: "10.0.0.2"},
+			3: {ID: 3, Name: "hop2a", ServerIPv4: "10.0.0.3"},
+			4: {ID: 4, Name: "hop2b", ServerIPv4: "10.0.0.4"},
+			5: {ID: 5, Name: "out", ServerIPv4: "10.0.0.5"},
+		},
+	}
+}
+
+func TestBuildTunnelMultiHopChainConfig(t *testing.T) {
+	state := multiHopTestState()
+	if err := validateTunnelChainMode(state); err != nil {
+		t.Fatalf("expected multihop state to validate, got %v", err)
+	}
+
+	chain, err := buildTunnelEntryChainConfig(state, 1)
+	if err != nil {
+		t.Fatalf("build chain: %v", err)
+	}
+	hops := chain["hops"].([]map[string]interface{})
+	if len(hops) != 3 {
+		t.Fatalf("expected 3 hops (2 groups + exit), got %d", len(hops))
+	}
+	wantNames := []string{"hop_9", "hop_9_2", "hop_9_3"}
+	wantStrategies := []string{"fifo", "latency", "round"}
+	for i, hop := range hops {
+		if hop["name"] != wantNames[i] {
+			t.Fatalf("hop %d: expected name %s, got %v", i, wantNames[i], hop["name"])
+		}
+		if got := hop["selector"].(map[string]interface{})["strategy"]; got != wantStrategies[i] {
+			t.Fatalf("hop %d: expected strategy %s, got %v", i, wantStrategies[i], got)
+		}
+		_, hasHealth := hop["nodes"].([]map[string]interface{})[0]["metadata"]
+		if hasHealth != (i == 0) {
+			t.Fatalf("hop %d: expected health metadata only on the first hop", i)
+		}
+	}
+	second := hops[1]["nodes"].([]map[string]interface{})
+	if len(second) != 2 || second[1]["addr"] != "10.0.0.4:20003" {
+		t.Fatalf("unexpected second hop nodes: %+v", second)
+	}
+
+	service := buildTunnelChainServiceConfig(state, state.ChainHops[0][0], state.hopNodesRunChains())
+	if _, ok := service[0]["handler"].(map[string]interface{})["chain"]; ok {
+		t.Fatalf("expected multihop relay service to run without its own chain")
+	}
+
+	state.Nodes[3].IsRemote = 1
+	if err := validateTunnelChainMode(state); err == nil {
+		t.Fatalf("expected remote hop node to be rejected in multihop mode")
+	}
+}
+
+func TestNormalizeTunnelHopGroups(t *testing.T) {
+	req := map[string]interface{}{
+		"chainNodes": []interface{}{
+			map[string]interface{}{
+				"strategy": "rr",
+				"protocol": "ws",
+				"nodes": []interface{}{
+					map[string]interface{}{"nodeId": float64(2)},
+					map[string]interface{}{"nodeId": float64(3), "protocol": "tls", "strategy": "fifo"},
+				},
+			},
+			[]interface{}{map[string]interface{}{"nodeId": float64(4), "strategy": "hash"}},
+		},
+		"outNodeId": []interface{}{map[string]interface{}{"nodeId": float64(5)}},
+	}
+	if err := normalizeTunnelHopGroups(req); err != nil {
+		t.Fatalf("normalize: %v", err)
+	}
+	groups := asAnySlice(req["chainNodes"])
+	first := asMapSlice(groups[0])
+	if first[0]["strategy"] != "round" || first[1]["strategy"] != "round" || first[0]["protocol"] != "ws" || first[1]["protocol"] != "tls" {
+		t.Fatalf("unexpected first group: %+v", first)
+	}
+	if asMapSlice(groups[1])[0]["strategy"] != "hash" {
+		t.Fatalf("unexpected second group: %+v", groups[1])
+	}
+	if asMapSlice(req["outNodeId"])[0]["strategy"] != "round" {
+		t.Fatalf("expected exit group to default to round")
+	}
+
+	bad := map[string]interface{}{"chainNodes": []interface{}{map[string]interface{}{"strategy": "weighted", "nodes": []interface{}{}}}}
+	if err := normalizeTunnelHopGroups(bad); err == nil {
+		t.Fatalf("expected unknown hop strategy to be rejected")
+	}
+	latency := map[string]interface{}{"outNodeId": []interface{}{map[string]interface{}{"nodeId": float64(5), "strategy": "least-latency"}}}
+	if err := normalizeTunnelHopGroups(latency); err == nil {
+		t.Fatalf("expected the latency strategy to be rejected for a node group")
+	}
+}
+
+func TestSummarizeTunnelHopLatency(t *testing.T) {
+	results := []map[string]interface{}{
+		{"fromChainType": 2, "fromInx": 1, "toChainType": 3, "success": true, "averageTime": 30.0},
+		{"fromChainType": 1, "toChainType": 2, "toInx": 1, "success": true, "averageTime": 12.0},
+		{"fromChainType": 1, "toChainType": 2, "toInx": 1, "success": true, "averageTime": 8.0},
+		{"fromChainType": 1, "toChainType": 2, "toInx": 1, "success": false},
+		{"fromChainType": 3, "success": true, "averageTime": 50.0},
+	}
+	hops, estimated := summarizeTunnelHopLatency(results)
+	if len(hops) != 2 {
+		t.Fatalf("expected 2 stages, got %d", len(hops))
+	}
+	if hops[0]["description"] != "入口->第1跳" || hops[0]["bestTime"] != 8.0 || hops[0]["total"] != 3 || hops[0]["success"] != 2 {
+		t.Fatalf("unexpected first stage: %+v", hops[0])
+	}
+	if hops[1]["description"] != "第1跳->出口" {
+		t.Fatalf("unexpected second stage: %+v", hops[1])
+	}
+	if estimated != 38.0 {
+		t.Fatalf("expected estimated latency 38, got %v", estimated)
+	}
+}
+
+func TestTunnelNodeRequirementsFollowChainMode(t *testing.T) {
+	state := multiHopTestState()
+	reqs := tunnelNodeRequirements(state)
+	if got := reqs[1].Dialers; len(got) != 2 || got[0] != "tls" || got[1] != "ws" {
+		t.Fatalf("expected the multihop entry to dial every hop protocol, got %v", got)
+	}
+	if got := reqs[2]; len(got.Dialers) != 0 || len(got.Connectors) != 0 || got.Listeners[0] != "tls" {
+		t.Fatalf("expected a multihop hop to only relay, got %+v", got)
+	}
+	if got := reqs[3].Listeners; len(got) != 1 || got[0] != "ws" {
+		t.Fatalf("expected the second hop to listen on ws, got %v", got)
+	}
+
+	state.NodeIDList = []int64{1, 2, 3, 4, 5}
+	state.Nodes[1].Capabilities = `{"listeners":["tcp","udp"],"handlers":["tcp","udp"],"dialers":["tls"],"connectors":["relay"]}`
+	if err := validateTunnelCapabilities(state); err == nil || !strings.Contains(err.Error(), "dialer:ws") {
+		t.Fatalf("expected the entry to need the ws dialer of a later hop, got %v", err)
+	}
+
+	state.ChainMode = tunnelChainModeRelay
+	reqs = tunnelNodeRequirements(state)
+	if got := reqs[1].Dialers; len(got) != 1 || got[0] != "tls" {
+		t.Fatalf("expected the relay entry to dial only the first hop, got %v", got)
+	}
+	if got := reqs[2].Dialers; len(got) != 1 || got[0] != "ws" {
+		t.Fatalf("expected the first relay hop to dial the second hop, got %v", got)
+	}
+	if got := reqs[3].Dialers; len(got) != 1 || got[0] != "tls" {
+		t.Fatalf("expected the second relay hop to dial the exit, got %v", got)
+	}
+	if err := validateTunnelCapabilities(state); err != nil {
+		t.Fatalf("expected relay mode to validate, got %v", err)
+	}
+}
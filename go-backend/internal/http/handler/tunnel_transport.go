@@ -0,0 +1,309 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	tunnelMuxMaxKeepaliveInterval = 3600
+	tunnelMuxMaxStreamBuffer      = 16 * 1024 * 1024
+)
+
+// tunnelTransport describes which options a relay transport understands. The
+// keys of tunnelTransports are the agent's dialer/listener registry names, so
+// the same name is used for both ends of a hop.
+type tunnelTransport struct {
+	TLS  bool // TLS based: SNI, verification and certificates apply
+	Path bool // HTTP request path
+	Host bool // Host header / authority
+	Mux  bool // multiplexed streams over one connection
+}
+
+var tunnelTransports = map[string]tunnelTransport{
+	"tcp":   {},
+	"mtcp":  {Mux: true},
+	"tls":   {TLS: true},
+	"mtls":  {TLS: true, Mux: true},
+	"ws":    {Path: true, Host: true},
+	"wss":   {TLS: true, Path: true, Host: true},
+	"mws":   {Path: true, Host: true, Mux: true},
+	"mwss":  {TLS: true, Path: true, Host: true, Mux: true},
+	"grpc":  {TLS: true, Path: true, Host: true},
+	"h2":    {TLS: true, Path: true, Host: true},
+	"h3":    {TLS: true, Host: true},
+	"quic":  {TLS: true},
+	"kcp":   {},
+	"otls":  {Host: true},
+	"ohttp": {Path: true, Host: true},
+}
+
+// Older clients and the gost docs use these spellings for the same transports.
+var tunnelTransportAliases = map[string]string{
+	"http2":     "h2",
+	"http3":     "h3",
+	"obfs-tls":  "otls",
+	"obfs-http": "ohttp",
+}
+
+// tunnelTransportOptions is stored per tunnel and applied to every hop; each
+// hop only picks up the options its protocol supports.
+type tunnelTransportOptions struct {
+	Path     string            `json:"path,omitempty"`
+	Host     string            `json:"host,omitempty"`
+	SNI      string            `json:"sni,omitempty"`
+	Secure   bool              `json:"secure,omitempty"`
+	CertFile string            `json:"certFile,omitempty"`
+	KeyFile  string            `json:"keyFile,omitempty"`
+	CAFile   string            `json:"caFile,omitempty"`
+	Mux      *tunnelMuxOptions `json:"mux,omitempty"`
+}
+
+type tunnelMuxOptions struct {
+	Version           int  `json:"version,omitempty"`
+	KeepaliveInterval int  `json:"keepaliveInterval,omitempty"` // seconds
+	KeepaliveDisabled bool `json:"keepaliveDisabled,omitempty"`
+	MaxStreamBuffer   int  `json:"maxStreamBuffer,omitempty"` // bytes
+}
+
+func tunnelTransportNames() []string {
+	names := make([]string, 0, len(tunnelTransports))
+	for name := range tunnelTransports {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// normalizeTunnelProtocol maps a requested protocol to its catalog name. An
+// empty value keeps the historical tls default.
+func normalizeTunnelProtocol(raw string) (string, error) {
+	protocol := strings.ToLower(strings.TrimSpace(raw))
+	if protocol == "" {
+		return "tls", nil
+	}
+	if alias, ok := tunnelTransportAliases[protocol]; ok {
+		protocol = alias
+	}
+	if _, ok := tunnelTransports[protocol]; !ok {
+		return "", fmt.Errorf("不支持的隧道协议: %s，可选: %s", strings.TrimSpace(raw), strings.Join(tunnelTransportNames(), ", "))
+	}
+	return protocol, nil
+}
+
+// canonicalTunnelProtocol is the lenient variant used when rebuilding runtime
+// config from stored rows, which predate validation.
+func canonicalTunnelProtocol(raw string) string {
+	protocol, err := normalizeTunnelProtocol(raw)
+	if err != nil {
+		return strings.TrimSpace(raw)
+	}
+	return protocol
+}
+
+// parseTunnelTransportInput validates the transportOptions request field and
+// returns its normalized JSON, or "" when no option is set. present is false
+// when the field was not sent at all.
+func parseTunnelTransportInput(req map[string]interface{}) (value string, present bool, err error) {
+	raw, ok := req["transportOptions"]
+	if !ok {
+		return "", false, nil
+	}
+	if raw == nil {
+		return "", true, nil
+	}
+
+	var opts tunnelTransportOptions
+	switch v := raw.(type) {
+	case string:
+		if strings.TrimSpace(v) == "" {
+			return "", true, nil
+		}
+		if err := json.Unmarshal([]byte(v), &opts); err != nil {
+			return "", true, errors.New("传输配置格式错误")
+		}
+	case map[string]interface{}:
+		b, _ := json.Marshal(v)
+		if err := json.Unmarshal(b, &opts); err != nil {
+			return "", true, errors.New("传输配置格式错误")
+		}
+	default:
+		return "", true, errors.New("传输配置格式错误")
+	}
+
+	normalized, err := normalizeTunnelTransportOptions(opts)
+	if err != nil || normalized == nil {
+		return "", true, err
+	}
+	b, _ := json.Marshal(normalized)
+	return string(b), true, nil
+}
+
+func normalizeTunnelTransportOptions(opts tunnelTransportOptions) (*tunnelTransportOptions, error) {
+	opts.Path = strings.TrimSpace(opts.Path)
+	opts.Host = strings.TrimSpace(opts.Host)
+	opts.SNI = strings.TrimSpace(opts.SNI)
+	opts.CertFile = strings.TrimSpace(opts.CertFile)
+	opts.KeyFile = strings.TrimSpace(opts.KeyFile)
+	opts.CAFile = strings.TrimSpace(opts.CAFile)
+
+	if opts.Path != "" && !strings.HasPrefix(opts.Path, "/") {
+		return nil, errors.New("传输路径必须以 / 开头")
+	}
+	if strings.ContainsAny(opts.Path, " \t\r\n") {
+		return nil, errors.New("传输路径不能包含空白字符")
+	}
+	if strings.ContainsAny(opts.Host, " \t\r\n/") {
+		return nil, errors.New("传输 Host 格式错误")
+	}
+	if strings.ContainsAny(opts.SNI, " \t\r\n/:") {
+		return nil, errors.New("SNI 格式错误")
+	}
+	if (opts.CertFile == "") != (opts.KeyFile == "") {
+		return nil, errors.New("证书文件和私钥文件必须同时填写")
+	}
+
+	if opts.Mux != nil {
+		mux := *opts.Mux
+		if mux.Version != 0 && mux.Version != 1 && mux.Version != 2 {
+			return nil, errors.New("多路复用版本仅支持 1 或 2")
+		}
+		if mux.KeepaliveInterval < 0 || mux.KeepaliveInterval > tunnelMuxMaxKeepaliveInterval {
+			return nil, fmt.Errorf("多路复用心跳间隔需在 0-%d 秒之间", tunnelMuxMaxKeepaliveInterval)
+		}
+		if mux.MaxStreamBuffer < 0 || mux.MaxStreamBuffer > tunnelMuxMaxStreamBuffer {
+			return nil, fmt.Errorf("多路复用流缓冲区不能超过 %d 字节", tunnelMuxMaxStreamBuffer)
+		}
+		if mux == (tunnelMuxOptions{}) {
+			opts.Mux = nil
+		} else {
+			opts.Mux = &mux
+		}
+	}
+
+	if opts == (tunnelTransportOptions{}) {
+		return nil, nil
+	}
+	return &opts, nil
+}
+
+// decodeTunnelTransportOptions parses stored options; invalid or empty values
+// fall back to the transport defaults.
+func decodeTunnelTransportOptions(raw string) *tunnelTransportOptions {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return nil
+	}
+	var opts tunnelTransportOptions
+	if err := json.Unmarshal([]byte(raw), &opts); err != nil {
+		return nil
+	}
+	normalized, err := normalizeTunnelTransportOptions(opts)
+	if err != nil {
+		return nil
+	}
+	return normalized
+}
+
+// tunnelTransportMetadata holds the metadata shared by the dialer and the
+// listener of a hop. Numbers and durations are strings for the agent's
+// metadata helpers.
+func tunnelTransportMetadata(transport tunnelTransport, opts *tunnelTransportOptions, dialer bool) map[string]interface{} {
+	md := map[string]interface{}{}
+	if opts == nil {
+		return md
+	}
+	if transport.Path && opts.Path != "" {
+		md["path"] = opts.Path
+	}
+	if dialer && transport.Host && opts.Host != "" {
+		md["host"] = opts.Host
+	}
+	if transport.Mux && opts.Mux != nil {
+		if opts.Mux.Version > 0 {
+			md["mux.version"] = strconv.Itoa(opts.Mux.Version)
+		}
+		if opts.Mux.KeepaliveDisabled {
+			md["mux.keepaliveDisabled"] = true
+		} else if opts.Mux.KeepaliveInterval > 0 {
+			md["mux.keepaliveInterval"] = fmt.Sprintf("%ds", opts.Mux.KeepaliveInterval)
+		}
+		if opts.Mux.MaxStreamBuffer > 0 {
+			md["mux.maxStreamBuffer"] = strconv.Itoa(opts.Mux.MaxStreamBuffer)
+		}
+	}
+	return md
+}
+
+// buildTunnelDialerConfig renders the dialer of a chain node connecting to a
+// hop listening with protocol.
+func buildTunnelDialerConfig(protocol string, opts *tunnelTransportOptions) map[string]interface{} {
+	protocol = canonicalTunnelProtocol(defaultString(protocol, "tls"))
+	dialer := map[string]interface{}{
+		"type": protocol,
+	}
+	transport, ok := tunnelTransports[protocol]
+	if !ok {
+		return dialer
+	}
+	if md := tunnelTransportMetadata(transport, opts, true); len(md) > 0 {
+		dialer["metadata"] = md
+	}
+	if transport.TLS && opts != nil {
+		tlsCfg := map[string]interface{}{}
+		if opts.SNI != "" {
+			tlsCfg["serverName"] = opts.SNI
+		}
+		if opts.Secure {
+			tlsCfg["secure"] = true
+		}
+		if opts.CAFile != "" {
+			tlsCfg["caFile"] = opts.CAFile
+		}
+		if len(tlsCfg) > 0 {
+			dialer["tls"] = tlsCfg
+		}
+	}
+	return dialer
+}
+
+// buildTunnelListenerConfig renders the listener of a hop service so that it
+// accepts what buildTunnelDialerConfig dials.
+func buildTunnelListenerConfig(protocol string, opts *tunnelTransportOptions) map[string]interface{} {
+	protocol = canonicalTunnelProtocol(defaultString(protocol, "tls"))
+	listener := map[string]interface{}{
+		"type": protocol,
+	}
+	transport, ok := tunnelTransports[protocol]
+	if !ok {
+		return listener
+	}
+	if md := tunnelTransportMetadata(transport, opts, false); len(md) > 0 {
+		listener["metadata"] = md
+	}
+	if transport.TLS && opts != nil && opts.CertFile != "" {
+		// caFile stays dialer-only: on a listener it would demand client certs.
+		listener["tls"] = map[string]interface{}{
+			"certFile": opts.CertFile,
+			"keyFile":  opts.KeyFile,
+		}
+	}
+	return listener
+}
+
+// federationTransportOptions is sent to peers hosting our remote hops, or nil
+// when the tunnel uses transport defaults so older peers keep working.
+func (s *tunnelCreateState) federationTransportOptions() json.RawMessage {
+	if s == nil || s.Transport == nil {
+		return nil
+	}
+	b, err := json.Marshal(s.Transport)
+	if err != nil {
+		return nil
+	}
+	return b
+}
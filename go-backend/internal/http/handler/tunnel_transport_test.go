@@ -0,0 +1,155 @@
+package handler
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// Mirrors the parts of the agent's DialerConfig/ListenerConfig the panel fills.
+type transportTestEndpoint struct {
+	Type     string                 `json:"type"`
+	Metadata map[string]interface{} `json:"metadata"`
+	TLS      map[string]interface{} `json:"tls"`
+}
+
+func decodeTransportEndpoint(t *testing.T, v interface{}) transportTestEndpoint {
+	t.Helper()
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	var out transportTestEndpoint
+	if err := json.Unmarshal(b, &out); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	return out
+}
+
+func TestTunnelTransportsRoundTripThroughChainConfig(t *testing.T) {
+	opts := &tunnelTransportOptions{
+		Path:     "/relay",
+		Host:     "cdn.example.com",
+		SNI:      "edge.example.com",
+		Secure:   true,
+		CertFile: "/etc/gost/cert.pem",
+		KeyFile:  "/etc/gost/key.pem",
+		CAFile:   "/etc/gost/ca.pem",
+		Mux:      &tunnelMuxOptions{Version: 2, KeepaliveInterval: 15, MaxStreamBuffer: 1048576},
+	}
+	state := &tunnelCreateState{
+		TunnelID:  9,
+		Type:      2,
+		Transport: opts,
+		Nodes: map[int64]*nodeRecord{
+			1: {ID: 1, Name: "in", ServerIPv4: "10.0.0.1"},
+			5: {ID: 5, Name: "out", ServerIPv4: "10.0.0.5", TCPListenAddr: "[::]"},
+		},
+	}
+
+	for _, name := range tunnelTransportNames() {
+		transport := tunnelTransports[name]
+		target := tunnelRuntimeNode{NodeID: 5, Protocol: name, ChainType: 3, Port: 20004}
+
+		chain, err := buildTunnelChainConfig(state, 1, []tunnelRuntimeNode{target})
+		if err != nil {
+			t.Fatalf("%s: build chain: %v", name, err)
+		}
+		node := chain["hops"].([]map[string]interface{})[0]["nodes"].([]map[string]interface{})[0]
+		dialer := decodeTransportEndpoint(t, node["dialer"])
+		service := buildTunnelChainServiceConfig(state, target, false)
+		listener := decodeTransportEndpoint(t, service[0]["listener"])
+
+		if dialer.Type != name || listener.Type != name {
+			t.Fatalf("%s: expected matching dialer/listener types, got %q/%q", name, dialer.Type, listener.Type)
+		}
+		if got, want := dialer.Metadata["path"] != nil, transport.Path; got != want {
+			t.Fatalf("%s: dialer path present=%v, want %v", name, got, want)
+		}
+		if dialer.Metadata["path"] != listener.Metadata["path"] {
+			t.Fatalf("%s: dialer path %v does not match listener path %v", name, dialer.Metadata["path"], listener.Metadata["path"])
+		}
+		if got, want := dialer.Metadata["host"] != nil, transport.Host; got != want {
+			t.Fatalf("%s: dialer host present=%v, want %v", name, got, want)
+		}
+		if listener.Metadata["host"] != nil {
+			t.Fatalf("%s: host header must not be set on the listener", name)
+		}
+		for _, key := range []string{"mux.version", "mux.keepaliveInterval", "mux.maxStreamBuffer"} {
+			if got, want := dialer.Metadata[key] != nil, transport.Mux; got != want {
+				t.Fatalf("%s: dialer %s present=%v, want %v", name, key, got, want)
+			}
+			if dialer.Metadata[key] != listener.Metadata[key] {
+				t.Fatalf("%s: %s differs between dialer and listener", name, key)
+			}
+			if v, ok := dialer.Metadata[key]; ok {
+				if _, isString := v.(string); !isString {
+					t.Fatalf("%s: %s must be sent as a string, got %T", name, key, v)
+				}
+			}
+		}
+		if transport.TLS {
+			if dialer.TLS["serverName"] != "edge.example.com" || dialer.TLS["secure"] != true || dialer.TLS["caFile"] != "/etc/gost/ca.pem" {
+				t.Fatalf("%s: unexpected dialer tls %+v", name, dialer.TLS)
+			}
+			if listener.TLS["certFile"] != "/etc/gost/cert.pem" || listener.TLS["keyFile"] != "/etc/gost/key.pem" || listener.TLS["caFile"] != nil {
+				t.Fatalf("%s: unexpected listener tls %+v", name, listener.TLS)
+			}
+		} else if dialer.TLS != nil || listener.TLS != nil {
+			t.Fatalf("%s: plain transport must not carry tls settings", name)
+		}
+	}
+}
+
+func TestTunnelTransportDefaultsStayBare(t *testing.T) {
+	dialer := buildTunnelDialerConfig("", nil)
+	listener := buildTunnelListenerConfig("", nil)
+	if len(dialer) != 1 || dialer["type"] != "tls" || len(listener) != 1 || listener["type"] != "tls" {
+		t.Fatalf("expected bare tls dialer/listener, got %+v / %+v", dialer, listener)
+	}
+	if got := buildTunnelDialerConfig("legacy-proto", nil)["type"]; got != "legacy-proto" {
+		t.Fatalf("expected stored unknown protocol to pass through, got %v", got)
+	}
+}
+
+func TestNormalizeTunnelProtocol(t *testing.T) {
+	cases := map[string]string{"": "tls", " WSS ": "wss", "http2": "h2", "http3": "h3", "obfs-tls": "otls", "kcp": "kcp"}
+	for in, want := range cases {
+		got, err := normalizeTunnelProtocol(in)
+		if err != nil || got != want {
+			t.Fatalf("normalize %q: got %q, %v; want %q", in, got, err, want)
+		}
+	}
+	if _, err := normalizeTunnelProtocol("socks5"); err == nil || !strings.Contains(err.Error(), "不支持的隧道协议") {
+		t.Fatalf("expected unsupported protocol error, got %v", err)
+	}
+}
+
+func TestParseTunnelTransportInput(t *testing.T) {
+	value, present, err := parseTunnelTransportInput(map[string]interface{}{
+		"transportOptions": map[string]interface{}{"path": " /ws ", "mux": map[string]interface{}{"version": 1}},
+	})
+	if err != nil || !present || value != `{"path":"/ws","mux":{"version":1}}` {
+		t.Fatalf("unexpected parse result %q %v %v", value, present, err)
+	}
+
+	if value, present, err = parseTunnelTransportInput(map[string]interface{}{"transportOptions": map[string]interface{}{"mux": map[string]interface{}{}}}); err != nil || !present || value != "" {
+		t.Fatalf("expected empty options to clear, got %q %v %v", value, present, err)
+	}
+	if _, present, _ = parseTunnelTransportInput(map[string]interface{}{}); present {
+		t.Fatalf("expected missing field to be reported as absent")
+	}
+
+	invalid := []map[string]interface{}{
+		{"path": "ws"},
+		{"certFile": "/etc/gost/cert.pem"},
+		{"sni": "edge.example.com:443"},
+		{"mux": map[string]interface{}{"version": 3}},
+		{"mux": map[string]interface{}{"keepaliveInterval": 7200}},
+	}
+	for _, opts := range invalid {
+		if _, _, err := parseTunnelTransportInput(map[string]interface{}{"transportOptions": opts}); err == nil {
+			t.Fatalf("expected %+v to be rejected", opts)
+		}
+	}
+}
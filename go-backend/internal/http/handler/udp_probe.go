@@ -0,0 +1,169 @@
+package handler
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	udpProbeMaxCount   = 20
+	udpProbeMaxPayload = 1400
+	udpProbeMaxTimeout = 10000
+	// udpProbeInterval is the pause between two datagrams, in milliseconds.
+	udpProbeInterval = 200
+)
+
+// Tunnels have no target of their own, so their UDP probe asks a public DNS
+// server for the same host the TCP egress check connects to.
+var udpProbeTunnelTarget = diagnosisTarget{Address: "1.1.1.1:53", IP: "1.1.1.1", Port: 53}
+
+// udpProbeOptions asks a diagnosis to probe targets over UDP as well. TCP
+// probes say nothing about UDP forwards such as games, DNS or WireGuard.
+type udpProbeOptions struct {
+	// Payload is the hex datagram sent to the target; empty sends a DNS query
+	// to port 53 and a numbered marker datagram elsewhere.
+	Payload string
+	Count   int
+	// Timeout is how long each datagram waits for a reply, in milliseconds.
+	Timeout int
+}
+
+// parseUDPProbeInput reads the udp field of a diagnosis request: true probes
+// with the defaults, an object sets payload, count and timeout. It returns
+// nil when UDP probing is not requested.
+func parseUDPProbeInput(req map[string]interface{}) (*udpProbeOptions, error) {
+	switch v := req["udp"].(type) {
+	case nil:
+		return nil, nil
+	case bool:
+		if !v {
+			return nil, nil
+		}
+		return &udpProbeOptions{Count: 4, Timeout: 2000}, nil
+	case map[string]interface{}:
+		opts := &udpProbeOptions{
+			Count:   asInt(v["count"], 4),
+			Timeout: asInt(v["timeout"], 2000),
+		}
+		payload := strings.ToLower(strings.Join(strings.Fields(asString(v["payload"])), ""))
+		raw, err := hex.DecodeString(payload)
+		if err != nil {
+			return nil, errors.New("UDP 探测包必须是十六进制内容")
+		}
+		if len(raw) > udpProbeMaxPayload {
+			return nil, fmt.Errorf("UDP 探测包不能超过 %d 字节", udpProbeMaxPayload)
+		}
+		opts.Payload = payload
+		if opts.Count < 1 || opts.Count > udpProbeMaxCount {
+			return nil, fmt.Errorf("UDP 探测次数必须在 1-%d 之间", udpProbeMaxCount)
+		}
+		if opts.Timeout < 100 || opts.Timeout > udpProbeMaxTimeout {
+			return nil, fmt.Errorf("UDP 探测超时必须在 100-%d 毫秒之间", udpProbeMaxTimeout)
+		}
+		return opts, nil
+	default:
+		return nil, errors.New("UDP 探测参数格式错误")
+	}
+}
+
+// rpcTimeout is how long the panel waits for a probe: the agent resolves the
+// target and then spends up to timeout plus the interval on every datagram.
+func (o *udpProbeOptions) rpcTimeout() time.Duration {
+	perProbe := time.Duration(o.Timeout+udpProbeInterval) * time.Millisecond
+	return time.Duration(o.Timeout)*time.Millisecond + time.Duration(o.Count)*perProbe + 10*time.Second
+}
+
+func (o *udpProbeOptions) payloadFor(port int) string {
+	if o.Payload == "" && port == 53 {
+		return hex.EncodeToString(dnsProbeQuery("www.bing.com"))
+	}
+	return o.Payload
+}
+
+// dnsProbeQuery builds a recursive A query for host.
+func dnsProbeQuery(host string) []byte {
+	msg := []byte{0x46, 0x4c, 0x01, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}
+	for _, label := range strings.Split(host, ".") {
+		msg = append(msg, byte(len(label)))
+		msg = append(msg, label...)
+	}
+	return append(msg, 0x00, 0x00, 0x01, 0x00, 0x01)
+}
+
+func udpProbeRequirement() nodeCapabilityRequirement {
+	return nodeCapabilityRequirement{Features: []string{"udpProbe"}}
+}
+
+// appendUDPDiagnosis probes target over UDP from a node, directly or through
+// chain when it is set, and records loss and jitter next to the latency.
+func (h *Handler) appendUDPDiagnosis(results *[]map[string]interface{}, nodeCache map[int64]*nodeRecord, fromNodeID int64, target diagnosisTarget, chain string, opts *udpProbeOptions, description string, metadata map[string]interface{}) {
+	item := newDiagnosisResultItem(fromNodeID, target.IP, target.Port, description, metadata)
+	item["protocol"] = "udp"
+
+	fromNode, err := h.cachedNode(nodeCache, fromNodeID)
+	if err != nil {
+		item["success"] = false
+		item["message"] = err.Error()
+		*results = append(*results, item)
+		return
+	}
+	item["nodeName"] = fromNode.Name
+	if fromNode.IsRemote == 1 {
+		item["success"] = false
+		item["message"] = "远程节点暂不支持UDP诊断"
+		*results = append(*results, item)
+		return
+	}
+	if err := validateNodeCapabilities(fromNode, udpProbeRequirement()); err != nil {
+		item["success"] = false
+		item["message"] = err.Error()
+		*results = append(*results, item)
+		return
+	}
+
+	payload := map[string]interface{}{
+		"ip":       target.IP,
+		"port":     target.Port,
+		"count":    opts.Count,
+		"timeout":  opts.Timeout,
+		"interval": udpProbeInterval,
+		"payload":  opts.payloadFor(target.Port),
+	}
+	if chain != "" {
+		payload["chain"] = chain
+	}
+	dnsPingOptions(payload, target.DNS)
+	res, err := h.wsServer.SendCommand(fromNodeID, "UdpProbe", payload, opts.rpcTimeout())
+	if err == nil && res.Data == nil {
+		err = errors.New("节点未返回诊断数据")
+	}
+	if err != nil {
+		item["success"] = false
+		item["message"] = err.Error()
+		*results = append(*results, item)
+		return
+	}
+
+	data := res.Data
+	success := asBool(data["success"], false)
+	item["success"] = success
+	item["averageTime"] = asFloat(data["averageTime"], 0)
+	item["packetLoss"] = asFloat(data["packetLoss"], 100)
+	item["jitter"] = asFloat(data["jitter"], 0)
+	item["minTime"] = asFloat(data["minTime"], 0)
+	item["maxTime"] = asFloat(data["maxTime"], 0)
+	item["sent"] = asInt(data["sent"], 0)
+	item["received"] = asInt(data["received"], 0)
+
+	message := strings.TrimSpace(asString(data["errorMessage"]))
+	if success {
+		message = fmt.Sprintf("UDP响应 %d/%d", asInt(data["received"], 0), asInt(data["sent"], 0))
+	} else if message == "" {
+		message = "UDP探测失败"
+	}
+	item["message"] = message
+	*results = append(*results, item)
+}
@@ -0,0 +1,122 @@
+package handler
+
+import (
+	"encoding/hex"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"go-backend/internal/store/repo"
+)
+
+func TestParseUDPProbeInput(t *testing.T) {
+	if opts, err := parseUDPProbeInput(map[string]interface{}{}); err != nil || opts != nil {
+		t.Fatalf("expected no UDP probe by default, got %+v %v", opts, err)
+	}
+	opts, err := parseUDPProbeInput(map[string]interface{}{"udp": true})
+	if err != nil || opts == nil || opts.Count != 4 || opts.Timeout != 2000 || opts.Payload != "" {
+		t.Fatalf("unexpected defaults %+v %v", opts, err)
+	}
+	opts, err = parseUDPProbeInput(map[string]interface{}{"udp": map[string]interface{}{"payload": "FF FF FF FF 54", "count": 10, "timeout": 500}})
+	if err != nil || opts.Payload != "ffffffff54" || opts.Count != 10 || opts.Timeout != 500 {
+		t.Fatalf("unexpected options %+v %v", opts, err)
+	}
+	for _, bad := range []map[string]interface{}{
+		{"payload": "zz"},
+		{"payload": strings.Repeat("00", udpProbeMaxPayload+1)},
+		{"count": 0},
+		{"timeout": 50},
+	} {
+		if _, err := parseUDPProbeInput(map[string]interface{}{"udp": bad}); err == nil {
+			t.Fatalf("expected %v to be rejected", bad)
+		}
+	}
+
+	// The slowest probe the agent may run has to fit the RPC wait.
+	slowest := &udpProbeOptions{Count: udpProbeMaxCount, Timeout: udpProbeMaxTimeout}
+	if agent := time.Duration(udpProbeMaxTimeout+udpProbeMaxCount*(udpProbeMaxTimeout+udpProbeInterval)) * time.Millisecond; slowest.rpcTimeout() <= agent {
+		t.Fatalf("rpc timeout %v does not cover a %v probe", slowest.rpcTimeout(), agent)
+	}
+}
+
+func TestUDPProbePayloadDefaultsToDNSQueryOnPort53(t *testing.T) {
+	opts := &udpProbeOptions{}
+	raw, err := hex.DecodeString(opts.payloadFor(53))
+	if err != nil || len(raw) != 12+len("www.bing.com")+2+4 {
+		t.Fatalf("unexpected DNS query %x %v", raw, err)
+	}
+	if raw[5] != 1 || !strings.Contains(string(raw), "bing") {
+		t.Fatalf("expected one question for www.bing.com, got %x", raw)
+	}
+	if opts.payloadFor(51820) != "" {
+		t.Fatalf("expected an empty datagram for other ports")
+	}
+	opts.Payload = "00"
+	if opts.payloadFor(53) != "00" {
+		t.Fatalf("expected a custom payload to be kept")
+	}
+}
+
+func TestForwardDiagnosisAddsUDPProbesThroughTunnel(t *testing.T) {
+	r, err := repo.Open(filepath.Join(t.TempDir(), "udp.db"))
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	t.Cleanup(func() { _ = r.Close() })
+	h := New(r, "secret")
+	now := time.Now().UnixMilli()
+
+	db := r.DB()
+	for _, stmt := range []string{
+		`INSERT INTO tunnel(id, name, traffic_ratio, type, protocol, flow, created_time, updated_time, status, inx) VALUES (5, 't', 1.0, 2, 'tls', 0, 0, 0, 1, 0)`,
+		`INSERT INTO chain_tunnel(tunnel_id, chain_type, node_id, port, strategy, inx, protocol) VALUES (5, 1, 1, 30001, 'round', 1, 'tls'), (5, 3, 2, 30003, 'round', 1, 'tls')`,
+		`INSERT INTO forward(id, user_id, user_name, name, tunnel_id, remote_addr, strategy, created_time, updated_time, status) VALUES (9, 1, 'u', 'wg', 5, '10.0.0.5:51820', 'fifo', 0, 0, 1)`,
+	} {
+		if err := db.Exec(stmt).Error; err != nil {
+			t.Fatalf("seed: %v", err)
+		}
+	}
+	for id, name := range map[int64]string{1: "entry", 2: "exit"} {
+		if err := db.Exec(`
+			INSERT INTO node(id, name, secret, server_ip, server_ip_v4, server_ip_v6, port, interface_name, version, http, tls, socks, created_time, updated_time, status, tcp_listen_addr, udp_listen_addr, inx, capabilities)
+			VALUES(?, ?, ?, ?, '', '', '30000-30010', '', 'v1', 1, 1, 1, ?, ?, 1, '[::]', '[::]', 0, ?)
+		`, id, name, name+"-secret", "10.0.1.1", now, now, `{"features":{"connLimiter":true}}`).Error; err != nil {
+			t.Fatalf("insert node: %v", err)
+		}
+	}
+
+	forward, err := h.getForwardRecord(9)
+	if err != nil {
+		t.Fatalf("load forward: %v", err)
+	}
+	payload, err := h.diagnoseForwardRuntime(forward, &udpProbeOptions{Count: 4, Timeout: 2000})
+	if err != nil {
+		t.Fatalf("diagnose: %v", err)
+	}
+	var udp []map[string]interface{}
+	for _, item := range payload["results"].([]map[string]interface{}) {
+		if item["protocol"] == "udp" {
+			udp = append(udp, item)
+		}
+	}
+	if len(udp) != 1 {
+		t.Fatalf("expected one UDP probe from the entry node, got %+v", udp)
+	}
+	if udp[0]["description"] != "入口(entry)->隧道->目标(10.0.0.5:51820) UDP" || udp[0]["success"] != false {
+		t.Fatalf("unexpected UDP result %+v", udp[0])
+	}
+	if msg, _ := udp[0]["message"].(string); !strings.Contains(msg, "feature:udpProbe") {
+		t.Fatalf("expected an agent without UdpProbe to be reported, got %q", msg)
+	}
+
+	payload, err = h.diagnoseForwardRuntime(forward, nil)
+	if err != nil {
+		t.Fatalf("diagnose: %v", err)
+	}
+	for _, item := range payload["results"].([]map[string]interface{}) {
+		if item["protocol"] == "udp" {
+			t.Fatalf("expected no UDP probe unless requested")
+		}
+	}
+}
@@ -142,26 +142,16 @@ func (h *Handler) nodeUpgrade(w http.ResponseWriter, r *http.Request) {
 	version := strings.TrimSpace(req.Version)
 	if version == "" {
 		var err error
-		version, err = resolveLatestReleaseByChannel(channel)
+		version, err = h.resolveReleaseVersion(channel, false)
 		if err != nil {
 			response.WriteJSON(w, response.Err(-2, fmt.Sprintf("获取最新%s失败: %v", releaseChannelLabel(channel), err)))
 			return
 		}
 	}
 
-	downloadURL := fmt.Sprintf(
-		githubProxy+"/%s/%s/releases/download/%s/gost-{ARCH}",
-		githubHTMLBase, githubRepo, version,
-	)
-	checksumURL := fmt.Sprintf(
-		githubProxy+"/%s/%s/releases/download/%s/gost-{ARCH}.sha256",
-		githubHTMLBase, githubRepo, version,
-	)
+	payload := h.agentUpgradePayload(version, req.ID)
 
-	result, err := h.wsServer.SendCommand(req.ID, "UpgradeAgent", map[string]interface{}{
-		"downloadUrl": downloadURL,
-		"checksumUrl": checksumURL,
-	}, upgradeTimeout)
+	result, err := h.wsServer.SendCommand(req.ID, "UpgradeAgent", payload, upgradeTimeout)
 	if err != nil {
 		response.WriteJSON(w, response.Err(-2, fmt.Sprintf("升级失败: %v", err)))
 		return
@@ -174,6 +164,39 @@ func (h *Handler) nodeUpgrade(w http.ResponseWriter, r *http.Request) {
 	}))
 }
 
+// agentUpgradePayload builds the UpgradeAgent command data. The agent swaps
+// {ARCH} for its own architecture and refuses binaries whose detached
+// ed25519 signature (.sig) does not verify against its embedded key.
+// Binaries uploaded to the panel's artifact cache take precedence over GitHub,
+// but only when the build for the node's reported architecture is among them;
+// a node without a manifest always downloads from GitHub.
+func (h *Handler) agentUpgradePayload(version string, nodeID int64) map[string]interface{} {
+	base := fmt.Sprintf(githubProxy+"/%s/%s/releases/download/%s/gost-{ARCH}", githubHTMLBase, githubRepo, version)
+	if h.hasLocalAgentBinaryFor(version, h.nodeArch(nodeID)) {
+		if local := h.artifactBaseURL(version); local != "" {
+			base = local + "/gost-{ARCH}"
+		}
+	}
+	return map[string]interface{}{
+		"downloadUrl":  base,
+		"checksumUrl":  base + ".sha256",
+		"signatureUrl": base + ".sig",
+	}
+}
+
+// nodeArch is the architecture from a node's capability manifest, or "" when
+// the agent has not reported one.
+func (h *Handler) nodeArch(nodeID int64) string {
+	node, err := h.getNodeRecord(nodeID)
+	if err != nil {
+		return ""
+	}
+	if manifest := parseNodeCapabilities(node.Capabilities); manifest != nil {
+		return manifest.Arch
+	}
+	return ""
+}
+
 func resolveLatestRelease() (string, error) {
 	return resolveLatestReleaseByChannel(releaseChannelStable)
 }
@@ -206,22 +229,13 @@ func (h *Handler) nodeBatchUpgrade(w http.ResponseWriter, r *http.Request) {
 	version := strings.TrimSpace(req.Version)
 	if version == "" {
 		var err error
-		version, err = resolveLatestReleaseByChannel(channel)
+		version, err = h.resolveReleaseVersion(channel, false)
 		if err != nil {
 			response.WriteJSON(w, response.Err(-2, fmt.Sprintf("获取最新%s失败: %v", releaseChannelLabel(channel), err)))
 			return
 		}
 	}
 
-	downloadURL := fmt.Sprintf(
-		githubProxy+"/%s/%s/releases/download/%s/gost-{ARCH}",
-		githubHTMLBase, githubRepo, version,
-	)
-	checksumURL := fmt.Sprintf(
-		githubProxy+"/%s/%s/releases/download/%s/gost-{ARCH}.sha256",
-		githubHTMLBase, githubRepo, version,
-	)
-
 	type upgradeResult struct {
 		ID      int64  `json:"id"`
 		Success bool   `json:"success"`
@@ -239,10 +253,8 @@ func (h *Handler) nodeBatchUpgrade(w http.ResponseWriter, r *http.Request) {
 			sem <- struct{}{}
 			defer func() { <-sem }()
 
-			result, err := h.wsServer.SendCommand(nodeID, "UpgradeAgent", map[string]interface{}{
-				"downloadUrl": downloadURL,
-				"checksumUrl": checksumURL,
-			}, upgradeTimeout)
+			payload := h.agentUpgradePayload(version, nodeID)
+			result, err := h.wsServer.SendCommand(nodeID, "UpgradeAgent", payload, upgradeTimeout)
 			if err != nil {
 				results[index] = upgradeResult{ID: nodeID, Success: false, Message: err.Error()}
 				return
@@ -275,8 +287,9 @@ func (h *Handler) listReleases(w http.ResponseWriter, r *http.Request) {
 
 	channel := normalizeReleaseChannel(req.Channel)
 
+	local, _ := h.listLocalArtifacts()
 	releases, err := fetchGitHubReleases(50)
-	if err != nil {
+	if err != nil && len(local) == 0 {
 		response.WriteJSON(w, response.Err(-2, fmt.Sprintf("获取版本列表失败: %v", err)))
 		return
 	}
@@ -287,9 +300,23 @@ func (h *Handler) listReleases(w http.ResponseWriter, r *http.Request) {
 		PublishedAt string `json:"publishedAt"`
 		Prerelease  bool   `json:"prerelease"`
 		Channel     string `json:"channel"`
+		Local       bool   `json:"local"`
+	}
+
+	localVersions := make(map[string]struct{}, len(local))
+	for _, item := range local {
+		if h.hasLocalAgentBinary(item.Version) {
+			localVersions[item.Version] = struct{}{}
+		}
+	}
+
+	isLocal := func(version string) bool {
+		_, ok := localVersions[version]
+		return ok
 	}
 
-	items := make([]releaseItem, 0, len(releases))
+	items := make([]releaseItem, 0, len(releases)+len(localVersions))
+	seen := make(map[string]struct{}, len(releases))
 	for _, r := range releases {
 		if r.Draft {
 			continue
@@ -308,6 +335,21 @@ func (h *Handler) listReleases(w http.ResponseWriter, r *http.Request) {
 			PublishedAt: r.PublishedAt,
 			Prerelease:  itemChannel == releaseChannelDev,
 			Channel:     itemChannel,
+			Local:       isLocal(tag),
+		})
+		seen[tag] = struct{}{}
+	}
+	for _, item := range local {
+		if _, ok := seen[item.Version]; ok || !isLocal(item.Version) || item.Channel != channel {
+			continue
+		}
+		items = append(items, releaseItem{
+			Version:     item.Version,
+			Name:        item.Version,
+			PublishedAt: time.UnixMilli(item.UploadedAt).UTC().Format(time.RFC3339),
+			Prerelease:  item.Channel == releaseChannelDev,
+			Channel:     item.Channel,
+			Local:       true,
 		})
 	}
 
@@ -369,19 +411,21 @@ func (h *Handler) onNodeOnline(nodeID int64) {
 	if !h.consumeNodePendingUpgradeRedeploy(nodeID) {
 		return
 	}
-	h.redeployNodeRuntimeAfterUpgrade(nodeID)
+	_ = h.redeployNodeRuntimeAfterUpgrade(nodeID)
 }
 
-func (h *Handler) redeployNodeRuntimeAfterUpgrade(nodeID int64) {
+// redeployNodeRuntimeAfterUpgrade re-applies tunnels and forwards of a node and
+// reports an error when any of them failed, so upgrade campaigns can gate on it.
+func (h *Handler) redeployNodeRuntimeAfterUpgrade(nodeID int64) error {
 	tunnelIDs, err := h.repo.ListActiveTunnelIDsByNode(nodeID)
 	if err != nil {
 		fmt.Printf("post-upgrade redeploy: list tunnels for node %d failed: %v\n", nodeID, err)
-		return
+		return err
 	}
 	forwardIDs, err := h.repo.ListActiveForwardIDsByNode(nodeID)
 	if err != nil {
 		fmt.Printf("post-upgrade redeploy: list forwards for node %d failed: %v\n", nodeID, err)
-		return
+		return err
 	}
 
 	tunnelFailed := make(map[int64]struct{})
@@ -392,6 +436,7 @@ func (h *Handler) redeployNodeRuntimeAfterUpgrade(nodeID int64) {
 		}
 	}
 
+	forwardFailed := 0
 	for _, forwardID := range forwardIDs {
 		forward, getErr := h.getForwardRecord(forwardID)
 		if getErr != nil || forward == nil {
@@ -401,7 +446,13 @@ func (h *Handler) redeployNodeRuntimeAfterUpgrade(nodeID int64) {
 			continue
 		}
 		if err := h.syncForwardServices(forward, "UpdateService", true); err != nil {
+			forwardFailed++
 			fmt.Printf("post-upgrade redeploy: forward %d failed on node %d: %v\n", forwardID, nodeID, err)
 		}
 	}
+
+	if len(tunnelFailed) > 0 || forwardFailed > 0 {
+		return fmt.Errorf("重新下发失败: %d 个隧道, %d 个转发", len(tunnelFailed), forwardFailed)
+	}
+	return nil
 }
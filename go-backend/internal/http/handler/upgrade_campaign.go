@@ -0,0 +1,461 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"go-backend/internal/http/response"
+	"go-backend/internal/store/model"
+)
+
+const (
+	campaignPollInterval        = 5 * time.Second
+	campaignDefaultCanary       = 10
+	campaignDefaultHealthWindow = 300
+
+	campaignStatusRunning   = "running"
+	campaignStatusCompleted = "completed"
+	campaignStatusFailed    = "failed"
+	campaignStatusCancelled = "cancelled"
+
+	campaignNodePending        = "pending"
+	campaignNodeUpgrading      = "upgrading"
+	campaignNodeHealthy        = "healthy"
+	campaignNodeFailed         = "failed"
+	campaignNodeDispatchFailed = "dispatch_failed"
+	campaignNodeRolledBack     = "rolled_back"
+)
+
+func (h *Handler) upgradeCampaignCreate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		response.WriteJSON(w, response.ErrDefault("请求失败"))
+		return
+	}
+
+	var req struct {
+		IDs           []int64 `json:"ids"`
+		Version       string  `json:"version"`
+		Channel       string  `json:"channel"`
+		CanaryPercent int     `json:"canaryPercent"`
+		WaveSize      int     `json:"waveSize"`
+		HealthTimeout int64   `json:"healthTimeout"`
+	}
+	if err := decodeJSON(r.Body, &req); err != nil {
+		response.WriteJSON(w, response.ErrDefault("请求参数错误"))
+		return
+	}
+	nodeIDs := uniquePositiveIDs(req.IDs)
+	if len(nodeIDs) == 0 {
+		response.WriteJSON(w, response.ErrDefault("ids不能为空"))
+		return
+	}
+
+	channel := normalizeReleaseChannel(req.Channel)
+	version := strings.TrimSpace(req.Version)
+	if version == "" {
+		var err error
+		version, err = h.resolveReleaseVersion(channel, false)
+		if err != nil {
+			response.WriteJSON(w, response.Err(-2, fmt.Sprintf("获取最新%s失败: %v", releaseChannelLabel(channel), err)))
+			return
+		}
+	}
+
+	canary := req.CanaryPercent
+	if canary <= 0 {
+		canary = campaignDefaultCanary
+	}
+	if canary > 100 {
+		canary = 100
+	}
+	waveSize := req.WaveSize
+	if waveSize <= 0 {
+		waveSize = batchWorkers
+	}
+	healthTimeout := req.HealthTimeout
+	if healthTimeout <= 0 {
+		healthTimeout = campaignDefaultHealthWindow
+	}
+
+	waves := planUpgradeWaves(nodeIDs, canary, waveSize)
+	nodes := make([]model.UpgradeCampaignNode, 0, len(nodeIDs))
+	for wave, ids := range waves {
+		for _, nodeID := range ids {
+			node, err := h.repo.GetNodeByID(nodeID)
+			if err != nil || node == nil {
+				response.WriteJSON(w, response.ErrDefault(fmt.Sprintf("节点 %d 不存在", nodeID)))
+				return
+			}
+			if node.IsRemote == 1 {
+				response.WriteJSON(w, response.ErrDefault(fmt.Sprintf("远程节点 %s 不支持升级", node.Name)))
+				return
+			}
+			nodes = append(nodes, model.UpgradeCampaignNode{
+				NodeID:      nodeID,
+				Wave:        wave,
+				Status:      campaignNodePending,
+				FromVersion: strings.TrimSpace(node.Version.String),
+			})
+		}
+	}
+
+	now := time.Now().UnixMilli()
+	campaign := &model.UpgradeCampaign{
+		Version:       version,
+		Channel:       channel,
+		Status:        campaignStatusRunning,
+		CanaryPercent: canary,
+		WaveSize:      waveSize,
+		HealthTimeout: healthTimeout,
+		TotalWaves:    len(waves),
+		CreatedTime:   now,
+		UpdatedTime:   now,
+	}
+	if err := h.repo.CreateUpgradeCampaign(campaign, nodes); err != nil {
+		response.WriteJSON(w, response.Err(-2, err.Error()))
+		return
+	}
+
+	h.startUpgradeCampaign(campaign.ID)
+	response.WriteJSON(w, response.OK(campaign))
+}
+
+func (h *Handler) upgradeCampaignList(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		response.WriteJSON(w, response.ErrDefault("请求失败"))
+		return
+	}
+	items, err := h.repo.ListUpgradeCampaigns(20)
+	if err != nil {
+		response.WriteJSON(w, response.Err(-2, err.Error()))
+		return
+	}
+	response.WriteJSON(w, response.OK(items))
+}
+
+func (h *Handler) upgradeCampaignGet(w http.ResponseWriter, r *http.Request) {
+	id := idFromBody(r, w)
+	if id <= 0 {
+		return
+	}
+	campaign, err := h.repo.GetUpgradeCampaign(id)
+	if err != nil {
+		response.WriteJSON(w, response.ErrDefault("升级任务不存在"))
+		return
+	}
+	nodes, err := h.repo.ListUpgradeCampaignNodes(id)
+	if err != nil {
+		response.WriteJSON(w, response.Err(-2, err.Error()))
+		return
+	}
+	response.WriteJSON(w, response.OK(map[string]interface{}{
+		"campaign": campaign,
+		"nodes":    nodes,
+	}))
+}
+
+func (h *Handler) upgradeCampaignCancel(w http.ResponseWriter, r *http.Request) {
+	id := idFromBody(r, w)
+	if id <= 0 {
+		return
+	}
+	campaign, err := h.repo.GetUpgradeCampaign(id)
+	if err != nil {
+		response.WriteJSON(w, response.ErrDefault("升级任务不存在"))
+		return
+	}
+	if campaign.Status != campaignStatusRunning {
+		response.WriteJSON(w, response.ErrDefault("升级任务已结束"))
+		return
+	}
+	if err := h.repo.UpdateUpgradeCampaign(id, map[string]interface{}{
+		"status":  campaignStatusCancelled,
+		"message": "已手动取消",
+	}); err != nil {
+		response.WriteJSON(w, response.Err(-2, err.Error()))
+		return
+	}
+	response.WriteJSON(w, response.OK(nil))
+}
+
+// planUpgradeWaves puts canaryPercent of the nodes (at least one) into wave 0
+// and splits the rest into waves of waveSize.
+func planUpgradeWaves(nodeIDs []int64, canaryPercent, waveSize int) [][]int64 {
+	if len(nodeIDs) == 0 {
+		return nil
+	}
+	canary := (len(nodeIDs)*canaryPercent + 99) / 100
+	if canary < 1 {
+		canary = 1
+	}
+	if canary > len(nodeIDs) {
+		canary = len(nodeIDs)
+	}
+	if waveSize <= 0 {
+		waveSize = batchWorkers
+	}
+
+	waves := [][]int64{append([]int64(nil), nodeIDs[:canary]...)}
+	for start := canary; start < len(nodeIDs); start += waveSize {
+		end := start + waveSize
+		if end > len(nodeIDs) {
+			end = len(nodeIDs)
+		}
+		waves = append(waves, append([]int64(nil), nodeIDs[start:end]...))
+	}
+	return waves
+}
+
+func uniquePositiveIDs(ids []int64) []int64 {
+	seen := make(map[int64]struct{}, len(ids))
+	out := make([]int64, 0, len(ids))
+	for _, id := range ids {
+		if id <= 0 {
+			continue
+		}
+		if _, ok := seen[id]; ok {
+			continue
+		}
+		seen[id] = struct{}{}
+		out = append(out, id)
+	}
+	return out
+}
+
+// resumeUpgradeCampaigns restarts the runners of campaigns that were still
+// running when the panel stopped.
+func (h *Handler) resumeUpgradeCampaigns() {
+	ids, err := h.repo.ListUpgradeCampaignIDsByStatus(campaignStatusRunning)
+	if err != nil {
+		fmt.Printf("upgrade campaign: list running campaigns failed: %v\n", err)
+		return
+	}
+	for _, id := range ids {
+		// Every agent reconnected to the restarted panel, so a node that was
+		// inside its health window starts the window over on its new session.
+		rows, _ := h.repo.ListUpgradeCampaignNodes(id)
+		for _, row := range rows {
+			if row.Status == campaignNodeUpgrading && row.ReconnectedTime > 0 {
+				_ = h.repo.UpdateUpgradeCampaignNode(row.ID, map[string]interface{}{"reconnected_time": 0})
+			}
+		}
+		h.startUpgradeCampaign(id)
+	}
+}
+
+func (h *Handler) startUpgradeCampaign(id int64) {
+	h.campaignMu.Lock()
+	if _, ok := h.campaignRunners[id]; ok {
+		h.campaignMu.Unlock()
+		return
+	}
+	h.campaignRunners[id] = struct{}{}
+	h.campaignMu.Unlock()
+
+	go h.runUpgradeCampaign(h.backgroundContext(), id)
+}
+
+func (h *Handler) runUpgradeCampaign(ctx context.Context, id int64) {
+	defer func() {
+		h.campaignMu.Lock()
+		delete(h.campaignRunners, id)
+		h.campaignMu.Unlock()
+	}()
+
+	ticker := time.NewTicker(campaignPollInterval)
+	defer ticker.Stop()
+	for {
+		if h.advanceUpgradeCampaign(id, time.Now()) {
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// advanceUpgradeCampaign performs one step of the current wave and reports
+// whether the campaign has finished. All progress lives in the database so a
+// restarted panel picks up exactly where it left off.
+func (h *Handler) advanceUpgradeCampaign(id int64, now time.Time) bool {
+	campaign, err := h.repo.GetUpgradeCampaign(id)
+	if err != nil || campaign == nil || campaign.Status != campaignStatusRunning {
+		return true
+	}
+	if campaign.CurrentWave >= campaign.TotalWaves {
+		_ = h.repo.UpdateUpgradeCampaign(id, map[string]interface{}{"status": campaignStatusCompleted})
+		return true
+	}
+
+	rows, err := h.repo.ListUpgradeCampaignNodes(id)
+	if err != nil {
+		return false
+	}
+	wave := make([]model.UpgradeCampaignNode, 0)
+	for _, row := range rows {
+		if row.Wave == campaign.CurrentWave {
+			wave = append(wave, row)
+		}
+	}
+
+	h.dispatchCampaignWave(campaign, wave, now)
+
+	allHealthy := true
+	failed := make([]string, 0)
+	for i := range wave {
+		row := &wave[i]
+		if row.Status == campaignNodeUpgrading {
+			h.checkCampaignNodeHealth(campaign, row, now)
+		}
+		switch row.Status {
+		case campaignNodeHealthy:
+		case campaignNodeFailed, campaignNodeDispatchFailed:
+			allHealthy = false
+			failed = append(failed, fmt.Sprintf("节点 %d: %s", row.NodeID, row.Message))
+		default:
+			allHealthy = false
+		}
+	}
+
+	if len(failed) > 0 {
+		h.rollbackCampaignWave(wave)
+		_ = h.repo.UpdateUpgradeCampaign(id, map[string]interface{}{
+			"status":  campaignStatusFailed,
+			"message": fmt.Sprintf("第 %d 批升级失败，已回退: %s", campaign.CurrentWave+1, strings.Join(failed, "; ")),
+		})
+		return true
+	}
+	if !allHealthy {
+		return false
+	}
+
+	next := campaign.CurrentWave + 1
+	fields := map[string]interface{}{"current_wave": next}
+	if next >= campaign.TotalWaves {
+		fields["status"] = campaignStatusCompleted
+	}
+	_ = h.repo.UpdateUpgradeCampaign(id, fields)
+	return next >= campaign.TotalWaves
+}
+
+func (h *Handler) dispatchCampaignWave(campaign *model.UpgradeCampaign, wave []model.UpgradeCampaignNode, now time.Time) {
+	sem := make(chan struct{}, batchWorkers)
+	var wg sync.WaitGroup
+	for i := range wave {
+		if wave[i].Status != campaignNodePending {
+			continue
+		}
+		wg.Add(1)
+		go func(row *model.UpgradeCampaignNode) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			row.StartedTime = now.UnixMilli()
+			row.ReconnectedTime = 0
+			row.Status = campaignNodeUpgrading
+			row.Message = ""
+			payload := h.agentUpgradePayload(campaign.Version, row.NodeID)
+			_, err := h.wsServer.SendCommand(row.NodeID, "UpgradeAgent", payload, upgradeTimeout)
+			fields := map[string]interface{}{"status": row.Status, "started_time": row.StartedTime, "reconnected_time": 0, "message": ""}
+			if err == nil {
+				h.markNodePendingUpgradeRedeploy(row.NodeID)
+			} else {
+				row.Status = campaignNodeDispatchFailed
+				row.Message = err.Error()
+				row.FinishedTime = time.Now().UnixMilli()
+				fields["status"] = row.Status
+				fields["message"] = row.Message
+				fields["finished_time"] = row.FinishedTime
+			}
+			_ = h.repo.UpdateUpgradeCampaignNode(row.ID, fields)
+		}(&wave[i])
+	}
+	wg.Wait()
+}
+
+// checkCampaignNodeHealth marks an upgrading node healthy once it reconnected
+// with the target version and kept that session for the whole health window.
+// A node that does not reconnect within the window after the upgrade, or that
+// drops or reconnects again inside the window, fails. Services are re-applied
+// by the node online hook and do not gate the wave.
+func (h *Handler) checkCampaignNodeHealth(campaign *model.UpgradeCampaign, row *model.UpgradeCampaignNode, now time.Time) {
+	window := campaign.HealthTimeout * 1000
+	node, err := h.repo.GetNodeByID(row.NodeID)
+	if err != nil || node == nil {
+		row.Status = campaignNodeFailed
+		row.Message = "节点不存在"
+		h.finishCampaignNode(row, now)
+		return
+	}
+
+	helloAt, online := h.wsServer.NodeHelloTime(row.NodeID)
+	version := node.Version.String
+	if caps, ok := h.wsServer.NodeCapabilities(row.NodeID); ok && caps.Version != "" {
+		version = caps.Version
+	}
+	upgraded := online && helloAt.UnixMilli() >= row.StartedTime && agentVersionMatches(version, campaign.Version)
+
+	switch {
+	case row.ReconnectedTime == 0 && upgraded:
+		row.ReconnectedTime = helloAt.UnixMilli()
+		_ = h.repo.UpdateUpgradeCampaignNode(row.ID, map[string]interface{}{"reconnected_time": row.ReconnectedTime})
+		return
+	case row.ReconnectedTime == 0 && now.UnixMilli()-row.StartedTime > window:
+		row.Status = campaignNodeFailed
+		row.Message = "升级后未在健康窗口内以目标版本重连"
+	case row.ReconnectedTime == 0:
+		return
+	case !upgraded || helloAt.UnixMilli() != row.ReconnectedTime:
+		row.Status = campaignNodeFailed
+		row.Message = "健康窗口内节点断开或重连"
+	case now.UnixMilli()-row.ReconnectedTime >= window:
+		row.Status = campaignNodeHealthy
+	default:
+		return
+	}
+	h.finishCampaignNode(row, now)
+}
+
+func (h *Handler) finishCampaignNode(row *model.UpgradeCampaignNode, now time.Time) {
+	row.FinishedTime = now.UnixMilli()
+	_ = h.repo.UpdateUpgradeCampaignNode(row.ID, map[string]interface{}{
+		"status":        row.Status,
+		"message":       row.Message,
+		"finished_time": row.FinishedTime,
+	})
+}
+
+// rollbackCampaignWave reverts every node of the wave that accepted the
+// upgrade; nodes that never received it are left alone.
+func (h *Handler) rollbackCampaignWave(wave []model.UpgradeCampaignNode) {
+	for i := range wave {
+		row := &wave[i]
+		if row.Status == campaignNodePending || row.Status == campaignNodeDispatchFailed {
+			continue
+		}
+		msg := row.Message
+		if _, err := h.wsServer.SendCommand(row.NodeID, "RollbackAgent", map[string]interface{}{}, 30*time.Second); err != nil {
+			msg = strings.TrimSpace(msg + " 回退失败: " + err.Error())
+		} else {
+			h.markNodePendingUpgradeRedeploy(row.NodeID)
+		}
+		_ = h.repo.UpdateUpgradeCampaignNode(row.ID, map[string]interface{}{
+			"status":  campaignNodeRolledBack,
+			"message": msg,
+		})
+	}
+}
+
+func agentVersionMatches(current, target string) bool {
+	normalize := func(v string) string {
+		return strings.TrimPrefix(strings.ToLower(strings.TrimSpace(v)), "v")
+	}
+	return normalize(current) != "" && normalize(current) == normalize(target)
+}
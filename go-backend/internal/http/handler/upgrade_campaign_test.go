@@ -0,0 +1,150 @@
+package handler
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"go-backend/internal/store/model"
+	"go-backend/internal/store/repo"
+)
+
+func TestPlanUpgradeWaves(t *testing.T) {
+	waves := planUpgradeWaves([]int64{1, 2, 3, 4, 5, 6, 7}, 10, 3)
+	want := [][]int64{{1}, {2, 3, 4}, {5, 6, 7}}
+	if !reflect.DeepEqual(waves, want) {
+		t.Fatalf("expected %v, got %v", want, waves)
+	}
+
+	waves = planUpgradeWaves([]int64{1, 2}, 100, 5)
+	if len(waves) != 1 || len(waves[0]) != 2 {
+		t.Fatalf("expected a single canary wave with every node, got %v", waves)
+	}
+}
+
+func TestAdvanceUpgradeCampaignGatesOnHealth(t *testing.T) {
+	r, err := repo.Open(filepath.Join(t.TempDir(), "campaign.db"))
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	t.Cleanup(func() { _ = r.Close() })
+	h := New(r, "secret")
+
+	now := time.Now()
+	insertOfflineNode(t, r, 1, "canary")
+	insertOfflineNode(t, r, 2, "rest")
+
+	campaign := &model.UpgradeCampaign{Version: "v2.1.0", Channel: "stable", Status: campaignStatusRunning, HealthTimeout: 300, TotalWaves: 2, CreatedTime: now.UnixMilli(), UpdatedTime: now.UnixMilli()}
+	nodes := []model.UpgradeCampaignNode{
+		{NodeID: 1, Wave: 0, Status: campaignNodeUpgrading, StartedTime: now.Add(-time.Minute).UnixMilli()},
+		{NodeID: 2, Wave: 1, Status: campaignNodePending},
+	}
+	if err := r.CreateUpgradeCampaign(campaign, nodes); err != nil {
+		t.Fatalf("create campaign: %v", err)
+	}
+
+	// The node is not back yet: the wave waits.
+	if h.advanceUpgradeCampaign(campaign.ID, now) {
+		t.Fatalf("expected campaign to wait for the canary")
+	}
+
+	agent := connectFakeNodeAgent(t, h, 1, "canary-secret")
+	agent.hello(t, map[string]interface{}{"schemaVersion": 1, "version": "2.1.0", "commands": []string{"RollbackAgent"}})
+	helloAt := waitNodeHello(t, h, 1)
+
+	// The reconnect opens the health window, the wave waits for it to pass.
+	if h.advanceUpgradeCampaign(campaign.ID, now) {
+		t.Fatalf("expected campaign to continue after canary reconnect")
+	}
+	rows, _ := r.ListUpgradeCampaignNodes(campaign.ID)
+	if rows[0].Status != campaignNodeUpgrading || rows[0].ReconnectedTime != helloAt.UnixMilli() {
+		t.Fatalf("expected the reconnect to be recorded, got %+v", rows[0])
+	}
+	h.advanceUpgradeCampaign(campaign.ID, helloAt.Add(299*time.Second))
+	if mustQueryInt(t, r, `SELECT current_wave FROM upgrade_campaign WHERE id = ?`, campaign.ID) != 0 {
+		t.Fatalf("expected the wave to wait for the whole health window")
+	}
+
+	// The canary stayed connected for the window: wave 0 passes.
+	if h.advanceUpgradeCampaign(campaign.ID, helloAt.Add(300*time.Second)) {
+		t.Fatalf("expected campaign to continue after canary wave")
+	}
+	got, _ := r.GetUpgradeCampaign(campaign.ID)
+	if got.CurrentWave != 1 || got.Status != campaignStatusRunning {
+		t.Fatalf("expected campaign to move to wave 1, got wave=%d status=%s", got.CurrentWave, got.Status)
+	}
+
+	// The second node is not connected, so dispatch fails and the campaign halts.
+	if !h.advanceUpgradeCampaign(campaign.ID, now) {
+		t.Fatalf("expected campaign to stop after failed wave")
+	}
+	got, _ = r.GetUpgradeCampaign(campaign.ID)
+	if got.Status != campaignStatusFailed {
+		t.Fatalf("expected campaign to fail, got %s", got.Status)
+	}
+	rows, _ = r.ListUpgradeCampaignNodes(campaign.ID)
+	if rows[0].Status != campaignNodeHealthy || rows[1].Status != campaignNodeDispatchFailed {
+		t.Fatalf("unexpected node states: %s, %s", rows[0].Status, rows[1].Status)
+	}
+}
+
+func TestCampaignNodeFailsWhenItReconnectsInsideTheWindow(t *testing.T) {
+	r, err := repo.Open(filepath.Join(t.TempDir(), "campaign.db"))
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	t.Cleanup(func() { _ = r.Close() })
+	h := New(r, "secret")
+
+	now := time.Now()
+	insertOfflineNode(t, r, 1, "canary")
+	campaign := &model.UpgradeCampaign{Version: "v2.1.0", HealthTimeout: 300}
+	row := &model.UpgradeCampaignNode{NodeID: 1, Status: campaignNodeUpgrading, StartedTime: now.Add(-time.Minute).UnixMilli()}
+
+	agent := connectFakeNodeAgent(t, h, 1, "canary-secret")
+	agent.hello(t, map[string]interface{}{"schemaVersion": 1, "version": "2.1.0"})
+	first := waitNodeHello(t, h, 1)
+	h.checkCampaignNodeHealth(campaign, row, now)
+	if row.ReconnectedTime != first.UnixMilli() {
+		t.Fatalf("expected the reconnect to be recorded, got %+v", row)
+	}
+
+	time.Sleep(5 * time.Millisecond)
+	agent = connectFakeNodeAgent(t, h, 1, "canary-secret")
+	agent.hello(t, map[string]interface{}{"schemaVersion": 1, "version": "2.1.0"})
+	for waitNodeHello(t, h, 1).Equal(first) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	h.checkCampaignNodeHealth(campaign, row, now.Add(time.Minute))
+	if row.Status != campaignNodeFailed {
+		t.Fatalf("expected a flapping node to fail, got %+v", row)
+	}
+
+	// A node that never comes back with the target version fails at the end
+	// of the window.
+	row = &model.UpgradeCampaignNode{NodeID: 1, Status: campaignNodeUpgrading, StartedTime: now.Add(time.Minute).UnixMilli()}
+	h.checkCampaignNodeHealth(campaign, row, now.Add(2*time.Minute))
+	if row.Status != campaignNodeUpgrading {
+		t.Fatalf("expected the node to be waited for, got %+v", row)
+	}
+	h.checkCampaignNodeHealth(campaign, row, now.Add(7*time.Minute))
+	if row.Status != campaignNodeFailed {
+		t.Fatalf("expected a node that never reconnected to fail, got %+v", row)
+	}
+}
+
+// waitNodeHello waits until the node's current session has sent its Hello.
+func waitNodeHello(t *testing.T, h *Handler, nodeID int64) time.Time {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if at, ok := h.wsServer.NodeHelloTime(nodeID); ok {
+			return at
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("node %d did not send its hello", nodeID)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
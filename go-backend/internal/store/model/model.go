@@ -23,25 +23,44 @@ type User struct {
 	CreatedTime   int64         `gorm:"column:created_time;not null"`
 	UpdatedTime   sql.NullInt64 `gorm:"column:updated_time"`
 	Status        int           `gorm:"not null"`
+	// Bandwidth pool shared by all of the user's services on a node: upload
+	// and download in Mbps, burst in MB; 0 leaves the direction unlimited.
+	BandwidthUp    int `gorm:"column:bandwidth_up;not null;default:0"`
+	BandwidthDown  int `gorm:"column:bandwidth_down;not null;default:0"`
+	BandwidthBurst int `gorm:"column:bandwidth_burst;not null;default:0"`
 }
 
 func (User) TableName() string { return "user" }
 
 // Forward maps to the "forward" table.
 type Forward struct {
-	ID          int64  `gorm:"primaryKey;autoIncrement"`
-	UserID      int64  `gorm:"column:user_id;not null"`
-	UserName    string `gorm:"column:user_name;type:varchar(100);not null"`
-	Name        string `gorm:"type:varchar(100);not null"`
-	TunnelID    int64  `gorm:"column:tunnel_id;not null"`
-	RemoteAddr  string `gorm:"column:remote_addr;type:text;not null"`
-	Strategy    string `gorm:"type:varchar(100);not null;default:'fifo'"`
-	InFlow      int64  `gorm:"column:in_flow;not null;default:0"`
-	OutFlow     int64  `gorm:"column:out_flow;not null;default:0"`
-	CreatedTime int64  `gorm:"column:created_time;not null"`
-	UpdatedTime int64  `gorm:"column:updated_time;not null"`
-	Status      int    `gorm:"not null"`
-	Inx         int    `gorm:"not null;default:0"`
+	ID            int64          `gorm:"primaryKey;autoIncrement"`
+	UserID        int64          `gorm:"column:user_id;not null"`
+	UserName      string         `gorm:"column:user_name;type:varchar(100);not null"`
+	Name          string         `gorm:"type:varchar(100);not null"`
+	TunnelID      int64          `gorm:"column:tunnel_id;not null"`
+	RemoteAddr    string         `gorm:"column:remote_addr;type:text;not null"`
+	Strategy      string         `gorm:"type:varchar(100);not null;default:'fifo'"`
+	InFlow        int64          `gorm:"column:in_flow;not null;default:0"`
+	OutFlow       int64          `gorm:"column:out_flow;not null;default:0"`
+	CreatedTime   int64          `gorm:"column:created_time;not null"`
+	UpdatedTime   int64          `gorm:"column:updated_time;not null"`
+	Status        int            `gorm:"not null"`
+	Inx           int            `gorm:"not null;default:0"`
+	HealthCheck   sql.NullString `gorm:"column:health_check;type:text"`
+	TargetOptions sql.NullString `gorm:"column:target_options;type:text"`
+	MaxConns      int            `gorm:"column:max_conns;not null;default:0"`
+	ConnRate      int            `gorm:"column:conn_rate;not null;default:0"`
+	AccessRules   sql.NullString `gorm:"column:access_rules;type:text"`
+	ProxyAccept   int            `gorm:"column:proxy_accept;not null;default:0"`
+	ProxySend     int            `gorm:"column:proxy_send;not null;default:0"`
+	IPSpeed       int            `gorm:"column:ip_speed;not null;default:0"`
+	ConnSpeed     int            `gorm:"column:conn_speed;not null;default:0"`
+	Schedule      sql.NullString `gorm:"column:schedule;type:text"`
+	AccessLog     int            `gorm:"column:access_log;not null;default:0"`
+	MuxHost       sql.NullString `gorm:"column:mux_host;type:varchar(255)"`
+	PortCount     int            `gorm:"column:port_count;not null;default:1"`
+	DNSPolicy     sql.NullString `gorm:"column:dns_policy;type:text"`
 }
 
 func (Forward) TableName() string { return "forward" }
@@ -78,19 +97,22 @@ type Node struct {
 	RemoteURL     sql.NullString `gorm:"column:remote_url;type:text"`
 	RemoteToken   sql.NullString `gorm:"column:remote_token;type:text"`
 	RemoteConfig  sql.NullString `gorm:"column:remote_config;type:text"`
+	Capabilities  sql.NullString `gorm:"column:capabilities;type:text"`
+	Maintenance   int            `gorm:"column:maintenance;not null;default:0"`
 }
 
 func (Node) TableName() string { return "node" }
 
 type SpeedLimit struct {
-	ID          int64         `gorm:"primaryKey;autoIncrement"`
-	Name        string        `gorm:"type:varchar(100);not null"`
-	Speed       int           `gorm:"not null"`
-	TunnelID    int64         `gorm:"column:tunnel_id;not null"`
-	TunnelName  string        `gorm:"column:tunnel_name;type:varchar(100);not null"`
-	CreatedTime int64         `gorm:"column:created_time;not null"`
-	UpdatedTime sql.NullInt64 `gorm:"column:updated_time"`
-	Status      int           `gorm:"not null"`
+	ID          int64          `gorm:"primaryKey;autoIncrement"`
+	Name        string         `gorm:"type:varchar(100);not null"`
+	Speed       int            `gorm:"not null"`
+	TunnelID    int64          `gorm:"column:tunnel_id;not null"`
+	TunnelName  string         `gorm:"column:tunnel_name;type:varchar(100);not null"`
+	CreatedTime int64          `gorm:"column:created_time;not null"`
+	UpdatedTime sql.NullInt64  `gorm:"column:updated_time"`
+	Status      int            `gorm:"not null"`
+	Profiles    sql.NullString `gorm:"column:profiles;type:text"`
 }
 
 func (SpeedLimit) TableName() string { return "speed_limit" }
@@ -119,6 +141,12 @@ type Tunnel struct {
 	InIP         sql.NullString `gorm:"column:in_ip;type:text"`
 	Inx          int            `gorm:"not null;default:0"`
 	IPPreference string         `gorm:"column:ip_preference;type:varchar(10);not null;default:''"`
+	HealthCheck  sql.NullString `gorm:"column:health_check;type:text"`
+	ChainMode    string         `gorm:"column:chain_mode;type:varchar(16);not null;default:''"`
+	RelaySecret  string         `gorm:"column:relay_secret;type:varchar(64);not null;default:''"`
+	Transport    sql.NullString `gorm:"column:transport_options;type:text"`
+	AccessRules  sql.NullString `gorm:"column:access_rules;type:text"`
+	DNSPolicy    sql.NullString `gorm:"column:dns_policy;type:text"`
 }
 
 func (Tunnel) TableName() string { return "tunnel" }
@@ -148,6 +176,10 @@ type UserTunnel struct {
 	FlowResetTime int64         `gorm:"column:flow_reset_time;not null"`
 	ExpTime       int64         `gorm:"column:exp_time;not null"`
 	Status        int           `gorm:"not null"`
+	MaxConns      int           `gorm:"column:max_conns;not null;default:0"`
+	ConnRate      int           `gorm:"column:conn_rate;not null;default:0"`
+	IPSpeed       int           `gorm:"column:ip_speed;not null;default:0"`
+	ConnSpeed     int           `gorm:"column:conn_speed;not null;default:0"`
 }
 
 func (UserTunnel) TableName() string { return "user_tunnel" }
@@ -293,6 +325,81 @@ type FederationTunnelBinding struct {
 
 func (FederationTunnelBinding) TableName() string { return "federation_tunnel_binding" }
 
+// NodeMetric is one downsampled (per-minute) telemetry point of a node.
+type NodeMetric struct {
+	ID          int64          `gorm:"primaryKey;autoIncrement" json:"-"`
+	NodeID      int64          `gorm:"column:node_id;not null;index:idx_node_metric_node_time" json:"nodeId"`
+	Time        int64          `gorm:"column:time;not null;index:idx_node_metric_node_time" json:"time"`
+	Samples     int            `gorm:"not null;default:0" json:"samples"`
+	CPUUsage    float64        `gorm:"column:cpu_usage;not null;default:0" json:"cpuUsage"`
+	MemoryUsage float64        `gorm:"column:memory_usage;not null;default:0" json:"memoryUsage"`
+	DiskUsage   float64        `gorm:"column:disk_usage;not null;default:0" json:"diskUsage"`
+	Load1       float64        `gorm:"column:load1;not null;default:0" json:"load1"`
+	Load5       float64        `gorm:"column:load5;not null;default:0" json:"load5"`
+	Load15      float64        `gorm:"column:load15;not null;default:0" json:"load15"`
+	RxBps       int64          `gorm:"column:rx_bps;not null;default:0" json:"rxBps"`
+	TxBps       int64          `gorm:"column:tx_bps;not null;default:0" json:"txBps"`
+	TCPSockets  int            `gorm:"column:tcp_sockets;not null;default:0" json:"tcpSockets"`
+	UDPSockets  int            `gorm:"column:udp_sockets;not null;default:0" json:"udpSockets"`
+	Connections int64          `gorm:"not null;default:0" json:"connections"`
+	Detail      sql.NullString `gorm:"type:text" json:"-"`
+}
+
+func (NodeMetric) TableName() string { return "node_metric" }
+
+// AccessLog is one client connection of a forward, reported by the entry
+// node's access recorder when the connection closes.
+type AccessLog struct {
+	ID         int64  `gorm:"primaryKey;autoIncrement" json:"id"`
+	ForwardID  int64  `gorm:"column:forward_id;not null;index:idx_access_log_forward_time" json:"forwardId"`
+	UserID     int64  `gorm:"column:user_id;not null;index:idx_access_log_user_time" json:"userId"`
+	NodeID     int64  `gorm:"column:node_id;not null" json:"nodeId"`
+	Network    string `gorm:"type:varchar(8);not null;default:''" json:"network"`
+	ClientIP   string `gorm:"column:client_ip;type:varchar(64);not null;default:''" json:"clientIp"`
+	Target     string `gorm:"type:varchar(255);not null;default:''" json:"target"`
+	InBytes    int64  `gorm:"column:in_bytes;not null;default:0" json:"inBytes"`
+	OutBytes   int64  `gorm:"column:out_bytes;not null;default:0" json:"outBytes"`
+	DurationMs int64  `gorm:"column:duration_ms;not null;default:0" json:"durationMs"`
+	Error      string `gorm:"type:varchar(255);not null;default:''" json:"error"`
+	Time       int64  `gorm:"column:time;not null;index:idx_access_log_forward_time;index:idx_access_log_user_time;index:idx_access_log_time" json:"time"`
+}
+
+func (AccessLog) TableName() string { return "access_log" }
+
+// UpgradeCampaign is a staged agent upgrade rolled out in waves.
+type UpgradeCampaign struct {
+	ID            int64  `gorm:"primaryKey;autoIncrement" json:"id"`
+	Version       string `gorm:"type:varchar(100);not null" json:"version"`
+	Channel       string `gorm:"type:varchar(20);not null;default:'stable'" json:"channel"`
+	Status        string `gorm:"type:varchar(20);not null;index" json:"status"`
+	CanaryPercent int    `gorm:"column:canary_percent;not null;default:10" json:"canaryPercent"`
+	WaveSize      int    `gorm:"column:wave_size;not null;default:5" json:"waveSize"`
+	HealthTimeout int64  `gorm:"column:health_timeout;not null;default:300" json:"healthTimeout"`
+	CurrentWave   int    `gorm:"column:current_wave;not null;default:0" json:"currentWave"`
+	TotalWaves    int    `gorm:"column:total_waves;not null;default:0" json:"totalWaves"`
+	Message       string `gorm:"type:text" json:"message"`
+	CreatedTime   int64  `gorm:"column:created_time;not null" json:"createdTime"`
+	UpdatedTime   int64  `gorm:"column:updated_time;not null" json:"updatedTime"`
+}
+
+func (UpgradeCampaign) TableName() string { return "upgrade_campaign" }
+
+// UpgradeCampaignNode tracks one node of an upgrade campaign.
+type UpgradeCampaignNode struct {
+	ID              int64  `gorm:"primaryKey;autoIncrement" json:"id"`
+	CampaignID      int64  `gorm:"column:campaign_id;not null;index" json:"campaignId"`
+	NodeID          int64  `gorm:"column:node_id;not null" json:"nodeId"`
+	Wave            int    `gorm:"not null;default:0" json:"wave"`
+	Status          string `gorm:"type:varchar(20);not null" json:"status"`
+	FromVersion     string `gorm:"column:from_version;type:varchar(100)" json:"fromVersion"`
+	Message         string `gorm:"type:text" json:"message"`
+	StartedTime     int64  `gorm:"column:started_time;not null;default:0" json:"startedTime"`
+	ReconnectedTime int64  `gorm:"column:reconnected_time;not null;default:0" json:"reconnectedTime"`
+	FinishedTime    int64  `gorm:"column:finished_time;not null;default:0" json:"finishedTime"`
+}
+
+func (UpgradeCampaignNode) TableName() string { return "upgrade_campaign_node" }
+
 // ─── Backup / Import-Export Structs ──────────────────────────────────
 // These are not GORM models; they define the JSON wire format for the
 // backup/restore API and MUST keep their existing json tags unchanged.
@@ -492,6 +599,40 @@ type ForwardRecord struct {
 	RemoteAddr string
 	Strategy   string
 	Status     int
+	// HealthCheck is the JSON active health check applied to every target.
+	HealthCheck string
+	// TargetOptions is the JSON list of per-target weight and backup flags.
+	TargetOptions string
+	// MaxConns caps concurrent connections per entry node; 0 means unlimited.
+	MaxConns int
+	// ConnRate caps new connections per second per entry node; 0 means unlimited.
+	ConnRate int
+	// AccessRules is the JSON source IP/country allow and deny lists.
+	AccessRules string
+	// ProxyAccept is the PROXY protocol version expected from upstream load
+	// balancers on the entry listener; 0 disables it.
+	ProxyAccept int
+	// ProxySend is the PROXY protocol version sent to the final target; 0
+	// disables it.
+	ProxySend int
+	// IPSpeed caps each client IP in Mbps per entry node; 0 means unlimited.
+	IPSpeed int
+	// ConnSpeed caps each connection in Mbps; 0 means unlimited.
+	ConnSpeed int
+	// Schedule is the JSON weekly windows in which the forward runs; empty
+	// means always.
+	Schedule string
+	// AccessLog is 1 when entry nodes report every client connection.
+	AccessLog int
+	// MuxHost is the TLS SNI or HTTP Host the forward is routed by on an
+	// entry port shared with other forwards; empty means a dedicated port.
+	MuxHost string
+	// PortCount is the number of consecutive entry ports starting at the
+	// forward's port; each maps to the target port at the same offset.
+	PortCount int
+	// DNSPolicy is the JSON resolver settings for hostname targets; the
+	// tunnel's policy fills in whatever the forward leaves unset.
+	DNSPolicy string
 }
 
 // TunnelRecord is a minimal tunnel view used by control plane.
@@ -525,6 +666,8 @@ type NodeRecord struct {
 	RemoteURL     string
 	RemoteToken   string
 	RemoteConfig  string
+	Capabilities  string
+	Maintenance   int
 }
 
 type ChainNodeRecord struct {
@@ -573,6 +716,10 @@ type UserTunnelDetail struct {
 	SpeedID       sql.NullInt64
 	SpeedLimit    sql.NullString
 	Speed         sql.NullInt64
+	MaxConns      int
+	ConnRate      int
+	IPSpeed       int
+	ConnSpeed     int
 }
 
 // UserForwardDetail is a joined view of forward + tunnel.
@@ -179,6 +179,10 @@ func autoMigrateAll(db *gorm.DB) error {
 		&model.PeerShare{},
 		&model.PeerShareRuntime{},
 		&model.FederationTunnelBinding{},
+		&model.NodeMetric{},
+		&model.AccessLog{},
+		&model.UpgradeCampaign{},
+		&model.UpgradeCampaignNode{},
 		&model.Announcement{},
 		&model.SchemaVersion{},
 	}
@@ -260,7 +264,7 @@ func prepareSQLiteLegacyColumns(db *gorm.DB) error {
 	m := db.Migrator()
 
 	if m.HasTable(&model.Node{}) {
-		for _, field := range []string{"ServerIPV4", "ServerIPV6", "Inx", "IsRemote", "RemoteURL", "RemoteToken", "RemoteConfig"} {
+		for _, field := range []string{"ServerIPV4", "ServerIPV6", "Inx", "IsRemote", "RemoteURL", "RemoteToken", "RemoteConfig", "Capabilities", "Maintenance"} {
 			if m.HasColumn(&model.Node{}, field) {
 				continue
 			}
@@ -270,8 +274,47 @@ func prepareSQLiteLegacyColumns(db *gorm.DB) error {
 		}
 	}
 
+	if m.HasTable(&model.User{}) {
+		for _, field := range []string{"BandwidthUp", "BandwidthDown", "BandwidthBurst"} {
+			if m.HasColumn(&model.User{}, field) {
+				continue
+			}
+			if err := m.AddColumn(&model.User{}, field); err != nil {
+				return fmt.Errorf("add user.%s: %w", field, err)
+			}
+		}
+	}
+
+	if m.HasTable(&model.Forward{}) {
+		for _, field := range []string{"HealthCheck", "TargetOptions", "MaxConns", "ConnRate", "AccessRules", "ProxyAccept", "ProxySend", "IPSpeed", "ConnSpeed", "Schedule", "AccessLog", "MuxHost", "PortCount", "DNSPolicy"} {
+			if m.HasColumn(&model.Forward{}, field) {
+				continue
+			}
+			if err := m.AddColumn(&model.Forward{}, field); err != nil {
+				return fmt.Errorf("add forward.%s: %w", field, err)
+			}
+		}
+	}
+
+	if m.HasTable(&model.SpeedLimit{}) && !m.HasColumn(&model.SpeedLimit{}, "Profiles") {
+		if err := m.AddColumn(&model.SpeedLimit{}, "Profiles"); err != nil {
+			return fmt.Errorf("add speed_limit.Profiles: %w", err)
+		}
+	}
+
+	if m.HasTable(&model.UserTunnel{}) {
+		for _, field := range []string{"MaxConns", "ConnRate", "IPSpeed", "ConnSpeed"} {
+			if m.HasColumn(&model.UserTunnel{}, field) {
+				continue
+			}
+			if err := m.AddColumn(&model.UserTunnel{}, field); err != nil {
+				return fmt.Errorf("add user_tunnel.%s: %w", field, err)
+			}
+		}
+	}
+
 	if m.HasTable(&model.Tunnel{}) {
-		for _, field := range []string{"Inx", "IPPreference"} {
+		for _, field := range []string{"Inx", "IPPreference", "HealthCheck", "ChainMode", "RelaySecret", "Transport", "AccessRules", "DNSPolicy"} {
 			if m.HasColumn(&model.Tunnel{}, field) {
 				continue
 			}
@@ -447,7 +490,7 @@ func (r *Repository) GetUserPackageTunnels(userID int64) ([]model.UserTunnelDeta
 	}
 	var items []model.UserTunnelDetail
 	err := r.db.Model(&model.UserTunnel{}).
-		Select("user_tunnel.id, user_tunnel.user_id, user_tunnel.tunnel_id, tunnel.name AS tunnel_name, tunnel.flow AS tunnel_flow, user_tunnel.flow, user_tunnel.in_flow, user_tunnel.out_flow, user_tunnel.num, user_tunnel.flow_reset_time, user_tunnel.exp_time, user_tunnel.speed_id, speed_limit.name AS speed_limit, speed_limit.speed").
+		Select("user_tunnel.id, user_tunnel.user_id, user_tunnel.tunnel_id, tunnel.name AS tunnel_name, tunnel.flow AS tunnel_flow, user_tunnel.flow, user_tunnel.in_flow, user_tunnel.out_flow, user_tunnel.num, user_tunnel.flow_reset_time, user_tunnel.exp_time, user_tunnel.speed_id, speed_limit.name AS speed_limit, speed_limit.speed, user_tunnel.max_conns, user_tunnel.conn_rate, user_tunnel.ip_speed, user_tunnel.conn_speed").
 		Joins("LEFT JOIN tunnel ON tunnel.id = user_tunnel.tunnel_id").
 		Joins("LEFT JOIN speed_limit ON speed_limit.id = user_tunnel.speed_id").
 		Where("user_tunnel.user_id = ?", userID).
@@ -577,6 +620,22 @@ func (r *Repository) UpdateNodeOnline(nodeID int64, status int, version string,
 	}).Error
 }
 
+func (r *Repository) UpdateNodeCapabilities(nodeID int64, manifest string) error {
+	if r == nil || r.db == nil {
+		return errors.New("repository not initialized")
+	}
+	return r.db.Model(&model.Node{}).Where("id = ?", nodeID).Update("capabilities", nullStringFromInterface(strings.TrimSpace(manifest))).Error
+}
+
+func (r *Repository) UpdateNodeMaintenance(nodeID int64, maintenance int) error {
+	if r == nil || r.db == nil {
+		return errors.New("repository not initialized")
+	}
+	return r.db.Model(&model.Node{}).Where("id = ?", nodeID).Updates(map[string]interface{}{
+		"maintenance": maintenance, "updated_time": unixMilliNow(),
+	}).Error
+}
+
 func (r *Repository) UpdateNodeStatus(nodeID int64, status int) error {
 	if r == nil || r.db == nil {
 		return errors.New("repository not initialized")
@@ -646,6 +705,8 @@ func (r *Repository) ListNodes() ([]map[string]interface{}, error) {
 			"remoteUrl":    nullableString(n.RemoteURL),
 			"remoteToken":  nullableString(n.RemoteToken),
 			"remoteConfig": nullableString(n.RemoteConfig),
+			"capabilities": nullableString(n.Capabilities),
+			"maintenance":  n.Maintenance,
 		})
 	}
 	return items, nil
@@ -668,6 +729,7 @@ func (r *Repository) ListUsers() ([]map[string]interface{}, error) {
 			"flowResetTime": u.FlowResetTime, "createdTime": u.CreatedTime,
 			"updatedTime": nullableInt64(u.UpdatedTime),
 			"inFlow":      u.InFlow, "outFlow": u.OutFlow,
+			"bandwidthUp": u.BandwidthUp, "bandwidthDown": u.BandwidthDown, "bandwidthBurst": u.BandwidthBurst,
 		})
 	}
 	return items, nil
@@ -687,7 +749,7 @@ func (r *Repository) ListSpeedLimits() ([]map[string]interface{}, error) {
 			"id": sl.ID, "name": sl.Name, "speed": sl.Speed,
 			"tunnelId": sl.TunnelID, "tunnelName": sl.TunnelName,
 			"status": sl.Status, "createdTime": sl.CreatedTime,
-			"updatedTime": nullableInt64(sl.UpdatedTime),
+			"updatedTime": nullableInt64(sl.UpdatedTime), "profiles": nullableString(sl.Profiles),
 		})
 	}
 	return items, nil
@@ -699,24 +761,38 @@ func (r *Repository) ListForwards() ([]map[string]interface{}, error) {
 	}
 
 	type fwdRow struct {
-		ID          int64
-		UserID      int64
-		UserName    string
-		Name        string
-		TunnelID    int64
-		TunnelName  string
-		RemoteAddr  string
-		Strategy    string
-		InFlow      int64
-		OutFlow     int64
-		CreatedTime int64
-		Status      int
-		Inx         int
+		ID            int64
+		UserID        int64
+		UserName      string
+		Name          string
+		TunnelID      int64
+		TunnelName    string
+		RemoteAddr    string
+		Strategy      string
+		InFlow        int64
+		OutFlow       int64
+		CreatedTime   int64
+		Status        int
+		Inx           int
+		HealthCheck   sql.NullString
+		TargetOptions sql.NullString
+		MaxConns      int
+		ConnRate      int
+		AccessRules   sql.NullString
+		ProxyAccept   int
+		ProxySend     int
+		IPSpeed       int
+		ConnSpeed     int
+		Schedule      sql.NullString
+		AccessLog     int
+		MuxHost       sql.NullString
+		PortCount     int
+		DNSPolicy     sql.NullString
 	}
 
 	var rows []fwdRow
 	err := r.db.Model(&model.Forward{}).
-		Select("forward.id, forward.user_id, forward.user_name, forward.name, forward.tunnel_id, COALESCE(tunnel.name, '') AS tunnel_name, forward.remote_addr, COALESCE(forward.strategy, 'fifo') AS strategy, forward.in_flow, forward.out_flow, forward.created_time, forward.status, forward.inx").
+		Select("forward.id, forward.user_id, forward.user_name, forward.name, forward.tunnel_id, COALESCE(tunnel.name, '') AS tunnel_name, forward.remote_addr, COALESCE(forward.strategy, 'fifo') AS strategy, forward.in_flow, forward.out_flow, forward.created_time, forward.status, forward.inx, forward.health_check, forward.target_options, forward.max_conns, forward.conn_rate, forward.access_rules, forward.proxy_accept, forward.proxy_send, forward.ip_speed, forward.conn_speed, forward.schedule, forward.access_log, forward.mux_host, forward.port_count, forward.dns_policy").
 		Joins("LEFT JOIN tunnel ON tunnel.id = forward.tunnel_id").
 		Order("forward.inx ASC, forward.id ASC").
 		Find(&rows).Error
@@ -737,6 +813,12 @@ func (r *Repository) ListForwards() ([]map[string]interface{}, error) {
 			"remoteAddr": row.RemoteAddr, "strategy": row.Strategy,
 			"inFlow": row.InFlow, "outFlow": row.OutFlow,
 			"createdTime": row.CreatedTime, "status": row.Status, "inx": int64(row.Inx),
+			"healthCheck": nullableString(row.HealthCheck), "targetOptions": nullableString(row.TargetOptions),
+			"maxConns": row.MaxConns, "connRate": row.ConnRate, "accessRules": nullableString(row.AccessRules),
+			"proxyAccept": row.ProxyAccept, "proxySend": row.ProxySend,
+			"ipSpeed": row.IPSpeed, "connSpeed": row.ConnSpeed, "schedule": nullableString(row.Schedule),
+			"accessLog": row.AccessLog, "muxHost": nullableString(row.MuxHost),
+			"portCount": row.PortCount, "dnsPolicy": nullableString(row.DNSPolicy),
 		})
 	}
 	return items, nil
@@ -807,11 +889,16 @@ func (r *Repository) ListTunnels() ([]map[string]interface{}, error) {
 			"id": t.ID, "inx": t.Inx, "name": t.Name,
 			"type": t.Type, "flow": t.Flow, "trafficRatio": t.TrafficRatio,
 			"status": t.Status, "createdTime": t.CreatedTime,
-			"inIp":         nullableString(t.InIP),
-			"ipPreference": t.IPPreference,
-			"inNodeId":     make([]map[string]interface{}, 0),
-			"outNodeId":    make([]map[string]interface{}, 0),
-			"chainNodes":   make([][]map[string]interface{}, 0),
+			"inIp":             nullableString(t.InIP),
+			"ipPreference":     t.IPPreference,
+			"healthCheck":      nullableString(t.HealthCheck),
+			"chainMode":        t.ChainMode,
+			"transportOptions": nullableString(t.Transport),
+			"accessRules":      nullableString(t.AccessRules),
+			"dnsPolicy":        nullableString(t.DNSPolicy),
+			"inNodeId":         make([]map[string]interface{}, 0),
+			"outNodeId":        make([]map[string]interface{}, 0),
+			"chainNodes":       make([][]map[string]interface{}, 0),
 		}
 		orderedIDs = append(orderedIDs, t.ID)
 	}
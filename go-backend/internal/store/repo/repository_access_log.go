@@ -0,0 +1,70 @@
+package repo
+
+import (
+	"errors"
+
+	"go-backend/internal/store/model"
+)
+
+// AccessLogQuery filters access logs; zero fields match everything.
+type AccessLogQuery struct {
+	ForwardID int64
+	UserID    int64
+	ClientIP  string
+	StartMs   int64
+	EndMs     int64
+	Offset    int
+	Limit     int
+}
+
+func (r *Repository) InsertAccessLogs(items []model.AccessLog) error {
+	if r == nil || r.db == nil {
+		return errors.New("repository not initialized")
+	}
+	if len(items) == 0 {
+		return nil
+	}
+	return r.db.CreateInBatches(items, 200).Error
+}
+
+// ListAccessLogs returns the matching logs, newest first, and their total
+// count.
+func (r *Repository) ListAccessLogs(q AccessLogQuery) ([]model.AccessLog, int64, error) {
+	if r == nil || r.db == nil {
+		return nil, 0, errors.New("repository not initialized")
+	}
+	db := r.db.Model(&model.AccessLog{})
+	if q.ForwardID > 0 {
+		db = db.Where("forward_id = ?", q.ForwardID)
+	}
+	if q.UserID > 0 {
+		db = db.Where("user_id = ?", q.UserID)
+	}
+	if q.ClientIP != "" {
+		db = db.Where("client_ip = ?", q.ClientIP)
+	}
+	if q.StartMs > 0 {
+		db = db.Where("time >= ?", q.StartMs)
+	}
+	if q.EndMs > 0 {
+		db = db.Where("time <= ?", q.EndMs)
+	}
+
+	var total int64
+	if err := db.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	items := make([]model.AccessLog, 0)
+	err := db.Order("time DESC, id DESC").Offset(q.Offset).Limit(q.Limit).Find(&items).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	return items, total, nil
+}
+
+func (r *Repository) PurgeOldAccessLogs(cutoffMs int64) error {
+	if r == nil || r.db == nil {
+		return errors.New("repository not initialized")
+	}
+	return r.db.Where("time < ?", cutoffMs).Delete(&model.AccessLog{}).Error
+}
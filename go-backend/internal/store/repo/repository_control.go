@@ -38,14 +38,28 @@ func (r *Repository) ListForwardsByTunnel(tunnelID int64) ([]model.ForwardRecord
 	rows := make([]model.ForwardRecord, 0, len(forwards))
 	for _, f := range forwards {
 		rows = append(rows, model.ForwardRecord{
-			ID:         f.ID,
-			UserID:     f.UserID,
-			UserName:   f.UserName,
-			Name:       f.Name,
-			TunnelID:   f.TunnelID,
-			RemoteAddr: f.RemoteAddr,
-			Strategy:   f.Strategy,
-			Status:     f.Status,
+			ID:            f.ID,
+			UserID:        f.UserID,
+			UserName:      f.UserName,
+			Name:          f.Name,
+			TunnelID:      f.TunnelID,
+			RemoteAddr:    f.RemoteAddr,
+			Strategy:      f.Strategy,
+			HealthCheck:   f.HealthCheck.String,
+			TargetOptions: f.TargetOptions.String,
+			MaxConns:      f.MaxConns,
+			ConnRate:      f.ConnRate,
+			AccessRules:   f.AccessRules.String,
+			ProxyAccept:   f.ProxyAccept,
+			ProxySend:     f.ProxySend,
+			IPSpeed:       f.IPSpeed,
+			ConnSpeed:     f.ConnSpeed,
+			Schedule:      f.Schedule.String,
+			AccessLog:     f.AccessLog,
+			MuxHost:       f.MuxHost.String,
+			DNSPolicy:     f.DNSPolicy.String,
+			PortCount:     f.PortCount,
+			Status:        f.Status,
 		})
 	}
 	for i := range rows {
@@ -168,7 +182,7 @@ func nodeRecordFromModel(n *model.Node) *model.NodeRecord {
 		Status:        n.Status,
 		PortRange:     n.Port,
 		TCPListenAddr: n.TCPListenAddr, UDPListenAddr: n.UDPListenAddr,
-		IsRemote: n.IsRemote,
+		IsRemote: n.IsRemote, Maintenance: n.Maintenance,
 	}
 	if n.ServerIPV4.Valid {
 		rec.ServerIPv4 = strings.TrimSpace(n.ServerIPV4.String)
@@ -188,6 +202,9 @@ func nodeRecordFromModel(n *model.Node) *model.NodeRecord {
 	if n.RemoteConfig.Valid {
 		rec.RemoteConfig = strings.TrimSpace(n.RemoteConfig.String)
 	}
+	if n.Capabilities.Valid {
+		rec.Capabilities = strings.TrimSpace(n.Capabilities.String)
+	}
 	if rec.TCPListenAddr == "" {
 		rec.TCPListenAddr = "[::]"
 	}
@@ -140,46 +140,6 @@ func (r *Repository) CreateFederationTunnel(name string, tunnelType int, protoco
 	return tunnel.ID, nil
 }
 
-// ListUsedPortsOnNode returns all ports in use on a given node from chain_tunnel and forward_port tables.
-func (r *Repository) ListUsedPortsOnNode(nodeID int64) ([]int, error) {
-	if r == nil || r.db == nil {
-		return nil, errors.New("repository not initialized")
-	}
-	used := make(map[int]struct{})
-
-	var chainPorts []int
-	err := r.db.Model(&model.ChainTunnel{}).
-		Where("node_id = ? AND port > 0", nodeID).
-		Pluck("port", &chainPorts).Error
-	if err != nil {
-		return nil, err
-	}
-	for _, p := range chainPorts {
-		if p > 0 {
-			used[p] = struct{}{}
-		}
-	}
-
-	var forwardPorts []int
-	err = r.db.Model(&model.ForwardPort{}).
-		Where("node_id = ? AND port > 0", nodeID).
-		Pluck("port", &forwardPorts).Error
-	if err != nil {
-		return nil, err
-	}
-	for _, p := range forwardPorts {
-		if p > 0 {
-			used[p] = struct{}{}
-		}
-	}
-
-	result := make([]int, 0, len(used))
-	for p := range used {
-		result = append(result, p)
-	}
-	return result, nil
-}
-
 // ListTunnelIDsByNamePrefix returns all tunnel IDs whose name starts with the given prefix.
 func (r *Repository) ListTunnelIDsByNamePrefix(prefix string) ([]int64, error) {
 	if r == nil || r.db == nil {
@@ -30,14 +30,28 @@ func (r *Repository) ListActiveForwardsByUser(userID int64) ([]model.ForwardReco
 	rows := make([]model.ForwardRecord, 0, len(forwards))
 	for _, f := range forwards {
 		rows = append(rows, model.ForwardRecord{
-			ID:         f.ID,
-			UserID:     f.UserID,
-			UserName:   f.UserName,
-			Name:       f.Name,
-			TunnelID:   f.TunnelID,
-			RemoteAddr: f.RemoteAddr,
-			Strategy:   f.Strategy,
-			Status:     f.Status,
+			ID:            f.ID,
+			UserID:        f.UserID,
+			UserName:      f.UserName,
+			Name:          f.Name,
+			TunnelID:      f.TunnelID,
+			RemoteAddr:    f.RemoteAddr,
+			Strategy:      f.Strategy,
+			HealthCheck:   f.HealthCheck.String,
+			TargetOptions: f.TargetOptions.String,
+			MaxConns:      f.MaxConns,
+			ConnRate:      f.ConnRate,
+			AccessRules:   f.AccessRules.String,
+			ProxyAccept:   f.ProxyAccept,
+			ProxySend:     f.ProxySend,
+			IPSpeed:       f.IPSpeed,
+			ConnSpeed:     f.ConnSpeed,
+			Schedule:      f.Schedule.String,
+			AccessLog:     f.AccessLog,
+			MuxHost:       f.MuxHost.String,
+			DNSPolicy:     f.DNSPolicy.String,
+			PortCount:     f.PortCount,
+			Status:        f.Status,
 		})
 	}
 	for i := range rows {
@@ -60,14 +74,28 @@ func (r *Repository) ListActiveForwardsByUserTunnel(userID, tunnelID int64) ([]m
 	rows := make([]model.ForwardRecord, 0, len(forwards))
 	for _, f := range forwards {
 		rows = append(rows, model.ForwardRecord{
-			ID:         f.ID,
-			UserID:     f.UserID,
-			UserName:   f.UserName,
-			Name:       f.Name,
-			TunnelID:   f.TunnelID,
-			RemoteAddr: f.RemoteAddr,
-			Strategy:   f.Strategy,
-			Status:     f.Status,
+			ID:            f.ID,
+			UserID:        f.UserID,
+			UserName:      f.UserName,
+			Name:          f.Name,
+			TunnelID:      f.TunnelID,
+			RemoteAddr:    f.RemoteAddr,
+			Strategy:      f.Strategy,
+			HealthCheck:   f.HealthCheck.String,
+			TargetOptions: f.TargetOptions.String,
+			MaxConns:      f.MaxConns,
+			ConnRate:      f.ConnRate,
+			AccessRules:   f.AccessRules.String,
+			ProxyAccept:   f.ProxyAccept,
+			ProxySend:     f.ProxySend,
+			IPSpeed:       f.IPSpeed,
+			ConnSpeed:     f.ConnSpeed,
+			Schedule:      f.Schedule.String,
+			AccessLog:     f.AccessLog,
+			MuxHost:       f.MuxHost.String,
+			DNSPolicy:     f.DNSPolicy.String,
+			PortCount:     f.PortCount,
+			Status:        f.Status,
 		})
 	}
 	for i := range rows {
@@ -91,14 +119,28 @@ func (r *Repository) GetForwardRecord(forwardID int64) (*model.ForwardRecord, er
 		return nil, err
 	}
 	fr := model.ForwardRecord{
-		ID:         f.ID,
-		UserID:     f.UserID,
-		UserName:   f.UserName,
-		Name:       f.Name,
-		TunnelID:   f.TunnelID,
-		RemoteAddr: f.RemoteAddr,
-		Strategy:   f.Strategy,
-		Status:     f.Status,
+		ID:            f.ID,
+		UserID:        f.UserID,
+		UserName:      f.UserName,
+		Name:          f.Name,
+		TunnelID:      f.TunnelID,
+		RemoteAddr:    f.RemoteAddr,
+		Strategy:      f.Strategy,
+		HealthCheck:   f.HealthCheck.String,
+		TargetOptions: f.TargetOptions.String,
+		MaxConns:      f.MaxConns,
+		ConnRate:      f.ConnRate,
+		AccessRules:   f.AccessRules.String,
+		ProxyAccept:   f.ProxyAccept,
+		ProxySend:     f.ProxySend,
+		IPSpeed:       f.IPSpeed,
+		ConnSpeed:     f.ConnSpeed,
+		Schedule:      f.Schedule.String,
+		AccessLog:     f.AccessLog,
+		MuxHost:       f.MuxHost.String,
+		DNSPolicy:     f.DNSPolicy.String,
+		PortCount:     f.PortCount,
+		Status:        f.Status,
 	}
 	if strings.TrimSpace(fr.Strategy) == "" {
 		fr.Strategy = "fifo"
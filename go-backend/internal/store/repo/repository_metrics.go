@@ -0,0 +1,38 @@
+package repo
+
+import (
+	"errors"
+
+	"go-backend/internal/store/model"
+)
+
+func (r *Repository) InsertNodeMetric(metric *model.NodeMetric) error {
+	if r == nil || r.db == nil {
+		return errors.New("repository not initialized")
+	}
+	if metric == nil {
+		return nil
+	}
+	return r.db.Create(metric).Error
+}
+
+func (r *Repository) ListNodeMetrics(nodeID int64, startMs, endMs int64) ([]model.NodeMetric, error) {
+	if r == nil || r.db == nil {
+		return nil, errors.New("repository not initialized")
+	}
+	items := make([]model.NodeMetric, 0)
+	err := r.db.Where("node_id = ? AND time >= ? AND time <= ?", nodeID, startMs, endMs).
+		Order("time ASC").
+		Find(&items).Error
+	if err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+func (r *Repository) PurgeOldNodeMetrics(cutoffMs int64) error {
+	if r == nil || r.db == nil {
+		return errors.New("repository not initialized")
+	}
+	return r.db.Where("time < ?", cutoffMs).Delete(&model.NodeMetric{}).Error
+}
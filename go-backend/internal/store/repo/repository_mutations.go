@@ -105,6 +105,24 @@ func (r *Repository) UpdateUserWithoutPassword(id int64, username string, flow i
 		}).Error
 }
 
+func (r *Repository) GetUserBandwidth(userID int64) (up, down, burst int) {
+	if r == nil || r.db == nil {
+		return 0, 0, 0
+	}
+	var u model.User
+	if err := r.db.Select("bandwidth_up", "bandwidth_down", "bandwidth_burst").Where("id = ?", userID).First(&u).Error; err != nil {
+		return 0, 0, 0
+	}
+	return u.BandwidthUp, u.BandwidthDown, u.BandwidthBurst
+}
+
+func (r *Repository) UpdateUserBandwidth(userID int64, up, down, burst int) error {
+	if r == nil || r.db == nil {
+		return errors.New("repository not initialized")
+	}
+	return r.db.Model(&model.User{}).Where("id = ?", userID).Updates(map[string]interface{}{"bandwidth_up": up, "bandwidth_down": down, "bandwidth_burst": burst}).Error
+}
+
 func (r *Repository) PropagateUserFlowToTunnels(userID int64, flow int64, num int, expTime, flowResetTime int64) {
 	if r == nil || r.db == nil {
 		return
@@ -310,6 +328,9 @@ func (r *Repository) DeleteNodeCascade(nodeID int64) error {
 		if err := tx.Where("node_id = ?", nodeID).Delete(&model.FederationTunnelBinding{}).Error; err != nil {
 			return err
 		}
+		if err := tx.Where("node_id = ?", nodeID).Delete(&model.NodeMetric{}).Error; err != nil {
+			return err
+		}
 		return tx.Where("id = ?", nodeID).Delete(&model.Node{}).Error
 	})
 }
@@ -507,6 +528,203 @@ func (r *Repository) GetTunnelIPPreference(tunnelID int64) string {
 	return tunnel.IPPreference
 }
 
+func (r *Repository) GetTunnelHealthCheck(tunnelID int64) string {
+	if r == nil || r.db == nil {
+		return ""
+	}
+	var tunnel model.Tunnel
+	if err := r.db.Select("health_check").Where("id = ?", tunnelID).First(&tunnel).Error; err != nil {
+		return ""
+	}
+	return tunnel.HealthCheck.String
+}
+
+func (r *Repository) UpdateTunnelHealthCheck(tunnelID int64, healthCheck string) error {
+	if r == nil || r.db == nil {
+		return errors.New("repository not initialized")
+	}
+	return r.db.Model(&model.Tunnel{}).Where("id = ?", tunnelID).Update("health_check", sql.NullString{String: healthCheck, Valid: healthCheck != ""}).Error
+}
+
+func (r *Repository) GetTunnelTransportOptions(tunnelID int64) string {
+	if r == nil || r.db == nil {
+		return ""
+	}
+	var tunnel model.Tunnel
+	if err := r.db.Select("transport_options").Where("id = ?", tunnelID).First(&tunnel).Error; err != nil {
+		return ""
+	}
+	return tunnel.Transport.String
+}
+
+func (r *Repository) UpdateTunnelTransportOptions(tunnelID int64, options string) error {
+	if r == nil || r.db == nil {
+		return errors.New("repository not initialized")
+	}
+	return r.db.Model(&model.Tunnel{}).Where("id = ?", tunnelID).Update("transport_options", sql.NullString{String: options, Valid: options != ""}).Error
+}
+
+func (r *Repository) GetTunnelAccessRules(tunnelID int64) string {
+	if r == nil || r.db == nil {
+		return ""
+	}
+	var tunnel model.Tunnel
+	if err := r.db.Select("access_rules").Where("id = ?", tunnelID).First(&tunnel).Error; err != nil {
+		return ""
+	}
+	return tunnel.AccessRules.String
+}
+
+func (r *Repository) UpdateTunnelAccessRules(tunnelID int64, rules string) error {
+	if r == nil || r.db == nil {
+		return errors.New("repository not initialized")
+	}
+	return r.db.Model(&model.Tunnel{}).Where("id = ?", tunnelID).Update("access_rules", sql.NullString{String: rules, Valid: rules != ""}).Error
+}
+
+func (r *Repository) GetTunnelDNSPolicy(tunnelID int64) string {
+	if r == nil || r.db == nil {
+		return ""
+	}
+	var tunnel model.Tunnel
+	if err := r.db.Select("dns_policy").Where("id = ?", tunnelID).First(&tunnel).Error; err != nil {
+		return ""
+	}
+	return tunnel.DNSPolicy.String
+}
+
+func (r *Repository) UpdateTunnelDNSPolicy(tunnelID int64, policy string) error {
+	if r == nil || r.db == nil {
+		return errors.New("repository not initialized")
+	}
+	return r.db.Model(&model.Tunnel{}).Where("id = ?", tunnelID).Update("dns_policy", sql.NullString{String: policy, Valid: policy != ""}).Error
+}
+
+func (r *Repository) GetTunnelChainMode(tunnelID int64) string {
+	if r == nil || r.db == nil {
+		return ""
+	}
+	var tunnel model.Tunnel
+	if err := r.db.Select("chain_mode").Where("id = ?", tunnelID).First(&tunnel).Error; err != nil {
+		return ""
+	}
+	return tunnel.ChainMode
+}
+
+func (r *Repository) UpdateTunnelChainMode(tunnelID int64, chainMode string) error {
+	if r == nil || r.db == nil {
+		return errors.New("repository not initialized")
+	}
+	return r.db.Model(&model.Tunnel{}).Where("id = ?", tunnelID).Update("chain_mode", chainMode).Error
+}
+
+func (r *Repository) GetTunnelRelaySecret(tunnelID int64) string {
+	if r == nil || r.db == nil {
+		return ""
+	}
+	var tunnel model.Tunnel
+	if err := r.db.Select("relay_secret").Where("id = ?", tunnelID).First(&tunnel).Error; err != nil {
+		return ""
+	}
+	return tunnel.RelaySecret
+}
+
+// ListTunnelIDsWithoutRelaySecret lists the enabled multi-hop tunnels that
+// were deployed before relay credentials existed.
+func (r *Repository) ListTunnelIDsWithoutRelaySecret() ([]int64, error) {
+	if r == nil || r.db == nil {
+		return nil, errors.New("repository not initialized")
+	}
+	var ids []int64
+	err := r.db.Model(&model.Tunnel{}).Where("type = 2 AND status = 1 AND relay_secret = ''").Order("id ASC").Pluck("id", &ids).Error
+	return ids, err
+}
+
+func (r *Repository) UpdateTunnelRelaySecret(tunnelID int64, secret string) error {
+	if r == nil || r.db == nil {
+		return errors.New("repository not initialized")
+	}
+	return r.db.Model(&model.Tunnel{}).Where("id = ?", tunnelID).Update("relay_secret", secret).Error
+}
+
+func (r *Repository) UpdateForwardHealthCheck(forwardID int64, healthCheck string) error {
+	if r == nil || r.db == nil {
+		return errors.New("repository not initialized")
+	}
+	return r.db.Model(&model.Forward{}).Where("id = ?", forwardID).Update("health_check", sql.NullString{String: healthCheck, Valid: healthCheck != ""}).Error
+}
+
+func (r *Repository) UpdateForwardTargetOptions(forwardID int64, targetOptions string) error {
+	if r == nil || r.db == nil {
+		return errors.New("repository not initialized")
+	}
+	return r.db.Model(&model.Forward{}).Where("id = ?", forwardID).Update("target_options", sql.NullString{String: targetOptions, Valid: targetOptions != ""}).Error
+}
+
+func (r *Repository) UpdateForwardAccessRules(forwardID int64, rules string) error {
+	if r == nil || r.db == nil {
+		return errors.New("repository not initialized")
+	}
+	return r.db.Model(&model.Forward{}).Where("id = ?", forwardID).Update("access_rules", sql.NullString{String: rules, Valid: rules != ""}).Error
+}
+
+func (r *Repository) UpdateForwardConnLimits(forwardID int64, maxConns, connRate int) error {
+	if r == nil || r.db == nil {
+		return errors.New("repository not initialized")
+	}
+	return r.db.Model(&model.Forward{}).Where("id = ?", forwardID).Updates(map[string]interface{}{"max_conns": maxConns, "conn_rate": connRate}).Error
+}
+
+func (r *Repository) UpdateForwardProxyProtocol(forwardID int64, accept, send int) error {
+	if r == nil || r.db == nil {
+		return errors.New("repository not initialized")
+	}
+	return r.db.Model(&model.Forward{}).Where("id = ?", forwardID).Updates(map[string]interface{}{"proxy_accept": accept, "proxy_send": send}).Error
+}
+
+func (r *Repository) UpdateForwardSpeedCaps(forwardID int64, ipSpeed, connSpeed int) error {
+	if r == nil || r.db == nil {
+		return errors.New("repository not initialized")
+	}
+	return r.db.Model(&model.Forward{}).Where("id = ?", forwardID).Updates(map[string]interface{}{"ip_speed": ipSpeed, "conn_speed": connSpeed}).Error
+}
+
+func (r *Repository) GetUserTunnelConnLimits(userTunnelID int64) (maxConns, connRate int) {
+	if r == nil || r.db == nil {
+		return 0, 0
+	}
+	var ut model.UserTunnel
+	if err := r.db.Select("max_conns", "conn_rate").Where("id = ?", userTunnelID).First(&ut).Error; err != nil {
+		return 0, 0
+	}
+	return ut.MaxConns, ut.ConnRate
+}
+
+func (r *Repository) UpdateUserTunnelConnLimits(userTunnelID int64, maxConns, connRate int) error {
+	if r == nil || r.db == nil {
+		return errors.New("repository not initialized")
+	}
+	return r.db.Model(&model.UserTunnel{}).Where("id = ?", userTunnelID).Updates(map[string]interface{}{"max_conns": maxConns, "conn_rate": connRate}).Error
+}
+
+func (r *Repository) GetUserTunnelSpeedCaps(userTunnelID int64) (ipSpeed, connSpeed int) {
+	if r == nil || r.db == nil {
+		return 0, 0
+	}
+	var ut model.UserTunnel
+	if err := r.db.Select("ip_speed", "conn_speed").Where("id = ?", userTunnelID).First(&ut).Error; err != nil {
+		return 0, 0
+	}
+	return ut.IPSpeed, ut.ConnSpeed
+}
+
+func (r *Repository) UpdateUserTunnelSpeedCaps(userTunnelID int64, ipSpeed, connSpeed int) error {
+	if r == nil || r.db == nil {
+		return errors.New("repository not initialized")
+	}
+	return r.db.Model(&model.UserTunnel{}).Where("id = ?", userTunnelID).Updates(map[string]interface{}{"ip_speed": ipSpeed, "conn_speed": connSpeed}).Error
+}
+
 func (r *Repository) DeleteTunnelCascade(tunnelID int64) error {
 	if r == nil || r.db == nil {
 		return errors.New("repository not initialized")
@@ -698,6 +916,9 @@ func (r *Repository) DeleteForwardCascade(forwardID int64) error {
 		if err := tx.Where("forward_id = ?", forwardID).Delete(&model.ForwardPort{}).Error; err != nil {
 			return err
 		}
+		if err := tx.Where("forward_id = ?", forwardID).Delete(&model.AccessLog{}).Error; err != nil {
+			return err
+		}
 		return tx.Where("id = ?", forwardID).Delete(&model.Forward{}).Error
 	})
 }
@@ -746,22 +967,55 @@ func (r *Repository) GetUsedPortsOnNodeAsMap(nodeID int64) (map[int]bool, error)
 	if r == nil || r.db == nil {
 		return nil, errors.New("repository not initialized")
 	}
-	used := make(map[int]bool)
-	var forwardPorts []int
-	if err := r.db.Model(&model.ForwardPort{}).Where("node_id = ?", nodeID).Pluck("port", &forwardPorts).Error; err != nil {
+	spans, err := r.ListNodePortSpans(nodeID)
+	if err != nil {
 		return nil, err
 	}
-	for _, p := range forwardPorts {
-		used[p] = true
+	used := make(map[int]bool)
+	for _, span := range spans {
+		for p := span.Port; p < span.Port+span.Count; p++ {
+			used[p] = true
+		}
+	}
+	return used, nil
+}
+
+// PortSpan is a run of consecutive ports taken on a node. ForwardID is 0 for
+// tunnel chain ports.
+type PortSpan struct {
+	ForwardID int64
+	Port      int
+	Count     int `gorm:"column:port_count"`
+}
+
+// ListNodePortSpans returns the forward port ranges and tunnel chain ports in
+// use on a node.
+func (r *Repository) ListNodePortSpans(nodeID int64) ([]PortSpan, error) {
+	if r == nil || r.db == nil {
+		return nil, errors.New("repository not initialized")
+	}
+	var spans []PortSpan
+	err := r.db.Model(&model.ForwardPort{}).
+		Select("forward_port.forward_id AS forward_id, forward_port.port AS port, COALESCE(forward.port_count, 1) AS port_count").
+		Joins("LEFT JOIN forward ON forward.id = forward_port.forward_id").
+		Where("forward_port.node_id = ?", nodeID).
+		Scan(&spans).Error
+	if err != nil {
+		return nil, err
 	}
 	var chainPorts []int
 	if err := r.db.Model(&model.ChainTunnel{}).Where("node_id = ? AND port > 0", nodeID).Pluck("port", &chainPorts).Error; err != nil {
 		return nil, err
 	}
 	for _, p := range chainPorts {
-		used[p] = true
+		spans = append(spans, PortSpan{Port: p, Count: 1})
 	}
-	return used, nil
+	for i := range spans {
+		if spans[i].Count < 1 {
+			spans[i].Count = 1
+		}
+	}
+	return spans, nil
 }
 
 func (r *Repository) CreateSpeedLimit(name string, speed int, tunnelID int64, tunnelName string, now int64, status int) (int64, error) {
@@ -813,6 +1067,144 @@ func (r *Repository) GetSpeedLimitTunnelID(speedLimitID int64) int64 {
 	return sl.TunnelID
 }
 
+func (r *Repository) UpdateForwardAccessLog(forwardID int64, enabled int) error {
+	if r == nil || r.db == nil {
+		return errors.New("repository not initialized")
+	}
+	return r.db.Model(&model.Forward{}).Where("id = ?", forwardID).Update("access_log", enabled).Error
+}
+
+func (r *Repository) UpdateForwardPortCount(forwardID int64, count int) error {
+	if r == nil || r.db == nil {
+		return errors.New("repository not initialized")
+	}
+	if count < 1 {
+		count = 1
+	}
+	return r.db.Model(&model.Forward{}).Where("id = ?", forwardID).Update("port_count", count).Error
+}
+
+func (r *Repository) UpdateForwardMuxHost(forwardID int64, host string) error {
+	if r == nil || r.db == nil {
+		return errors.New("repository not initialized")
+	}
+	return r.db.Model(&model.Forward{}).Where("id = ?", forwardID).Update("mux_host", sql.NullString{String: host, Valid: host != ""}).Error
+}
+
+func (r *Repository) UpdateForwardDNSPolicy(forwardID int64, policy string) error {
+	if r == nil || r.db == nil {
+		return errors.New("repository not initialized")
+	}
+	return r.db.Model(&model.Forward{}).Where("id = ?", forwardID).Update("dns_policy", sql.NullString{String: policy, Valid: policy != ""}).Error
+}
+
+// ListForwardsOnNodePort returns every forward listening on a node port, in id
+// order.
+func (r *Repository) ListForwardsOnNodePort(nodeID int64, port int) ([]model.ForwardRecord, error) {
+	if r == nil || r.db == nil {
+		return nil, errors.New("repository not initialized")
+	}
+	var ids []int64
+	if err := r.db.Model(&model.ForwardPort{}).Where("node_id = ? AND port = ?", nodeID, port).Distinct().Order("forward_id ASC").Pluck("forward_id", &ids).Error; err != nil {
+		return nil, err
+	}
+	out := make([]model.ForwardRecord, 0, len(ids))
+	for _, id := range ids {
+		fr, err := r.GetForwardRecord(id)
+		if err != nil {
+			return nil, err
+		}
+		if fr != nil {
+			out = append(out, *fr)
+		}
+	}
+	return out, nil
+}
+
+// ListMuxPortsByUserTunnel returns the entry ports already shared by the
+// host-routed forwards of a user on a tunnel.
+func (r *Repository) ListMuxPortsByUserTunnel(userID, tunnelID int64) ([]int, error) {
+	if r == nil || r.db == nil {
+		return nil, errors.New("repository not initialized")
+	}
+	var ports []int
+	err := r.db.Model(&model.ForwardPort{}).
+		Joins("JOIN forward ON forward.id = forward_port.forward_id").
+		Where("forward.user_id = ? AND forward.tunnel_id = ? AND forward.mux_host IS NOT NULL AND forward.mux_host <> ''", userID, tunnelID).
+		Distinct().Order("forward_port.port ASC").Pluck("forward_port.port", &ports).Error
+	return ports, err
+}
+
+func (r *Repository) UpdateForwardSchedule(forwardID int64, schedule string) error {
+	if r == nil || r.db == nil {
+		return errors.New("repository not initialized")
+	}
+	return r.db.Model(&model.Forward{}).Where("id = ?", forwardID).Update("schedule", sql.NullString{String: schedule, Valid: schedule != ""}).Error
+}
+
+// ListScheduledForwards returns the running forwards that have a schedule.
+func (r *Repository) ListScheduledForwards() ([]model.ForwardRecord, error) {
+	if r == nil || r.db == nil {
+		return nil, errors.New("repository not initialized")
+	}
+	var ids []int64
+	if err := r.db.Model(&model.Forward{}).Where("status = ? AND schedule IS NOT NULL AND schedule <> ''", 1).Order("id ASC").Pluck("id", &ids).Error; err != nil {
+		return nil, err
+	}
+	out := make([]model.ForwardRecord, 0, len(ids))
+	for _, id := range ids {
+		fr, err := r.GetForwardRecord(id)
+		if err != nil {
+			return nil, err
+		}
+		if fr != nil {
+			out = append(out, *fr)
+		}
+	}
+	return out, nil
+}
+
+func (r *Repository) GetSpeedLimitProfiles(speedLimitID int64) string {
+	if r == nil || r.db == nil {
+		return ""
+	}
+	var sl model.SpeedLimit
+	if err := r.db.Select("profiles").Where("id = ?", speedLimitID).First(&sl).Error; err != nil {
+		return ""
+	}
+	return sl.Profiles.String
+}
+
+func (r *Repository) UpdateSpeedLimitProfiles(speedLimitID int64, profiles string) error {
+	if r == nil || r.db == nil {
+		return errors.New("repository not initialized")
+	}
+	return r.db.Model(&model.SpeedLimit{}).Where("id = ?", speedLimitID).Update("profiles", sql.NullString{String: profiles, Valid: profiles != ""}).Error
+}
+
+// ListProfiledSpeedLimits returns the speed limits that have time-of-day
+// profiles.
+func (r *Repository) ListProfiledSpeedLimits() ([]model.SpeedLimit, error) {
+	if r == nil || r.db == nil {
+		return nil, errors.New("repository not initialized")
+	}
+	var limits []model.SpeedLimit
+	err := r.db.Where("profiles IS NOT NULL AND profiles <> ''").Order("id ASC").Find(&limits).Error
+	return limits, err
+}
+
+// GetSpeedLimitBudget returns the rate (Mbps) and tunnel of a speed limit.
+func (r *Repository) GetSpeedLimitBudget(speedLimitID int64) (speed int, tunnelID int64, ok bool) {
+	if r == nil || r.db == nil {
+		return 0, 0, false
+	}
+	var sl model.SpeedLimit
+	if err := r.db.Select("speed", "tunnel_id").Where("id = ?", speedLimitID).First(&sl).Error; err != nil {
+		return 0, 0, false
+	}
+	return sl.Speed, sl.TunnelID, true
+}
+
 func (r *Repository) DeleteSpeedLimit(id int64) error {
 	if r == nil || r.db == nil {
 		return errors.New("repository not initialized")
@@ -0,0 +1,96 @@
+package repo
+
+import (
+	"errors"
+
+	"go-backend/internal/store/model"
+)
+
+func (r *Repository) CreateUpgradeCampaign(campaign *model.UpgradeCampaign, nodes []model.UpgradeCampaignNode) error {
+	if r == nil || r.db == nil {
+		return errors.New("repository not initialized")
+	}
+	if campaign == nil {
+		return errors.New("campaign is nil")
+	}
+	tx := r.db.Begin()
+	if tx.Error != nil {
+		return tx.Error
+	}
+	if err := tx.Create(campaign).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	for i := range nodes {
+		nodes[i].CampaignID = campaign.ID
+	}
+	if len(nodes) > 0 {
+		if err := tx.Create(&nodes).Error; err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit().Error
+}
+
+func (r *Repository) GetUpgradeCampaign(id int64) (*model.UpgradeCampaign, error) {
+	if r == nil || r.db == nil {
+		return nil, errors.New("repository not initialized")
+	}
+	var campaign model.UpgradeCampaign
+	if err := r.db.Where("id = ?", id).First(&campaign).Error; err != nil {
+		return nil, err
+	}
+	return &campaign, nil
+}
+
+func (r *Repository) ListUpgradeCampaigns(limit int) ([]model.UpgradeCampaign, error) {
+	if r == nil || r.db == nil {
+		return nil, errors.New("repository not initialized")
+	}
+	if limit <= 0 {
+		limit = 20
+	}
+	items := make([]model.UpgradeCampaign, 0)
+	if err := r.db.Order("id DESC").Limit(limit).Find(&items).Error; err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+func (r *Repository) ListUpgradeCampaignIDsByStatus(status string) ([]int64, error) {
+	if r == nil || r.db == nil {
+		return nil, errors.New("repository not initialized")
+	}
+	var ids []int64
+	if err := r.db.Model(&model.UpgradeCampaign{}).Where("status = ?", status).Order("id ASC").Pluck("id", &ids).Error; err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+func (r *Repository) UpdateUpgradeCampaign(id int64, fields map[string]interface{}) error {
+	if r == nil || r.db == nil {
+		return errors.New("repository not initialized")
+	}
+	fields["updated_time"] = unixMilliNow()
+	return r.db.Model(&model.UpgradeCampaign{}).Where("id = ?", id).Updates(fields).Error
+}
+
+func (r *Repository) ListUpgradeCampaignNodes(campaignID int64) ([]model.UpgradeCampaignNode, error) {
+	if r == nil || r.db == nil {
+		return nil, errors.New("repository not initialized")
+	}
+	items := make([]model.UpgradeCampaignNode, 0)
+	if err := r.db.Where("campaign_id = ?", campaignID).Order("wave ASC, id ASC").Find(&items).Error; err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+func (r *Repository) UpdateUpgradeCampaignNode(id int64, fields map[string]interface{}) error {
+	if r == nil || r.db == nil {
+		return errors.New("repository not initialized")
+	}
+	return r.db.Model(&model.UpgradeCampaignNode{}).Where("id = ?", id).Updates(fields).Error
+}
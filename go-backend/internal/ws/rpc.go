@@ -0,0 +1,271 @@
+package ws
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"sort"
+	"strings"
+	"time"
+)
+
+// RPCSchemaVersion is the node command envelope version spoken by the panel.
+// Agents reject commands whose version is newer than the one they understand.
+const RPCSchemaVersion = 1
+
+// helloMessageType is sent by agents right after connecting to advertise the
+// schema version and the commands they can execute.
+const helloMessageType = "Hello"
+
+// Structured error codes carried in the "code" field of command responses.
+// The first four are produced by the agent (go-gost/x/socket/rpc.go); the
+// last two are produced by the panel itself.
+const (
+	ErrCodeUnknownCommand     = "UNKNOWN_COMMAND"
+	ErrCodeUnsupportedVersion = "UNSUPPORTED_VERSION"
+	ErrCodeInvalidPayload     = "INVALID_PAYLOAD"
+	ErrCodeExecFailed         = "EXEC_FAILED"
+	ErrCodeNodeOffline        = "NODE_OFFLINE"
+	ErrCodeTimeout            = "TIMEOUT"
+)
+
+// Node command names understood by the agent. The list must match the
+// commands registered in go-gost/x/socket/rpc.go, which
+// TestRPCContractMatchesAgent checks.
+const (
+	CmdAddService          = "AddService"
+	CmdUpdateService       = "UpdateService"
+	CmdDeleteService       = "DeleteService"
+	CmdPauseService        = "PauseService"
+	CmdResumeService       = "ResumeService"
+	CmdAddChains           = "AddChains"
+	CmdUpdateChains        = "UpdateChains"
+	CmdDeleteChains        = "DeleteChains"
+	CmdAddLimiters         = "AddLimiters"
+	CmdUpdateLimiters      = "UpdateLimiters"
+	CmdDeleteLimiters      = "DeleteLimiters"
+	CmdAddCLimiters        = "AddCLimiters"
+	CmdUpdateCLimiters     = "UpdateCLimiters"
+	CmdDeleteCLimiters     = "DeleteCLimiters"
+	CmdAddRLimiters        = "AddRLimiters"
+	CmdUpdateRLimiters     = "UpdateRLimiters"
+	CmdDeleteRLimiters     = "DeleteRLimiters"
+	CmdAddAdmissions       = "AddAdmissions"
+	CmdUpdateAdmissions    = "UpdateAdmissions"
+	CmdDeleteAdmissions    = "DeleteAdmissions"
+	CmdAddResolvers        = "AddResolvers"
+	CmdUpdateResolvers     = "UpdateResolvers"
+	CmdDeleteResolvers     = "DeleteResolvers"
+	CmdAddHosts            = "AddHosts"
+	CmdUpdateHosts         = "UpdateHosts"
+	CmdDeleteHosts         = "DeleteHosts"
+	CmdTcpPing             = "TcpPing"
+	CmdUdpProbe            = "UdpProbe"
+	CmdStartThroughputSink = "StartThroughputSink"
+	CmdThroughputTest      = "ThroughputTest"
+	CmdSetProtocol         = "SetProtocol"
+	CmdUpgradeAgent        = "UpgradeAgent"
+	CmdRollbackAgent       = "RollbackAgent"
+)
+
+// CommandError is returned by SendCommand when the node rejects or fails a
+// command. Error() keeps the plain node message so existing string matching
+// on "已存在"/"不存在" keeps working.
+type CommandError struct {
+	Code    string
+	Message string
+}
+
+func (e *CommandError) Error() string {
+	if e == nil {
+		return ""
+	}
+	return e.Message
+}
+
+// CommandErrorCode extracts the structured code from an error returned by
+// SendCommand, or "" when the error carries none.
+func CommandErrorCode(err error) string {
+	var cmdErr *CommandError
+	if errors.As(err, &cmdErr) && cmdErr != nil {
+		return cmdErr.Code
+	}
+	return ""
+}
+
+// IsUnknownCommand reports whether the node refused the command because it
+// does not implement it.
+func IsUnknownCommand(err error) bool {
+	return CommandErrorCode(err) == ErrCodeUnknownCommand
+}
+
+// NodeCapabilities is the negotiated RPC state of a connected node.
+type NodeCapabilities struct {
+	SchemaVersion int             `json:"schemaVersion"`
+	Commands      []string        `json:"commands"`
+	Version       string          `json:"version,omitempty"`
+	Manifest      json.RawMessage `json:"capabilities,omitempty"`
+}
+
+type helloPayload struct {
+	SchemaVersion int             `json:"schemaVersion"`
+	Commands      []string        `json:"commands"`
+	Version       string          `json:"version,omitempty"`
+	Capabilities  json.RawMessage `json:"capabilities,omitempty"`
+}
+
+func (c *NodeCapabilities) supports(cmdType string) bool {
+	if c == nil {
+		return true
+	}
+	for _, name := range c.Commands {
+		if name == cmdType {
+			return true
+		}
+	}
+	return false
+}
+
+// Call sends a typed command to a node and decodes the response data into
+// Resp. Req is marshalled as the command payload.
+func Call[Req any, Resp any](s *Server, nodeID int64, cmdType string, req Req, timeout time.Duration) (Resp, error) {
+	var out Resp
+	result, err := s.SendCommand(nodeID, cmdType, req, timeout)
+	if err != nil {
+		return out, err
+	}
+	if len(result.Data) == 0 {
+		return out, nil
+	}
+	raw, err := json.Marshal(result.Data)
+	if err != nil {
+		return out, &CommandError{Code: ErrCodeInvalidPayload, Message: "解析节点响应失败: " + err.Error()}
+	}
+	if err := json.Unmarshal(raw, &out); err != nil {
+		return out, &CommandError{Code: ErrCodeInvalidPayload, Message: "解析节点响应失败: " + err.Error()}
+	}
+	return out, nil
+}
+
+// NodeCapabilities returns the negotiated capabilities of a connected node.
+// The second return value is false when the node is offline or is a legacy
+// agent that did not send a Hello message.
+func (s *Server) NodeCapabilities(nodeID int64) (NodeCapabilities, bool) {
+	if s == nil {
+		return NodeCapabilities{}, false
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	ns, ok := s.nodes[nodeID]
+	if !ok || ns == nil || ns.caps == nil {
+		return NodeCapabilities{}, false
+	}
+	caps := *ns.caps
+	caps.Commands = append([]string(nil), ns.caps.Commands...)
+	return caps, true
+}
+
+// NodeSupportsCommand reports whether a connected node advertised cmdType.
+// Legacy agents without negotiation are assumed to support everything and
+// will answer unknown commands with UnknownCommandResponse.
+func (s *Server) NodeSupportsCommand(nodeID int64, cmdType string) bool {
+	if s == nil {
+		return false
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	ns, ok := s.nodes[nodeID]
+	if !ok || ns == nil {
+		return false
+	}
+	return ns.caps.supports(cmdType)
+}
+
+// NodeHelloTime returns when the current session of a node sent its Hello.
+// A later time than before means the agent reconnected in between.
+func (s *Server) NodeHelloTime(nodeID int64) (time.Time, bool) {
+	if s == nil {
+		return time.Time{}, false
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	ns, ok := s.nodes[nodeID]
+	if !ok || ns == nil || ns.caps == nil {
+		return time.Time{}, false
+	}
+	return ns.helloAt, true
+}
+
+func (s *Server) handleHello(nodeID int64, conn *connWrap, message string) {
+	var msg struct {
+		Data helloPayload `json:"data"`
+	}
+	if err := json.Unmarshal([]byte(message), &msg); err != nil {
+		return
+	}
+	commands := make([]string, 0, len(msg.Data.Commands))
+	for _, name := range msg.Data.Commands {
+		name = strings.TrimSpace(name)
+		if name != "" {
+			commands = append(commands, name)
+		}
+	}
+	sort.Strings(commands)
+	caps := &NodeCapabilities{
+		SchemaVersion: msg.Data.SchemaVersion,
+		Commands:      commands,
+		Version:       strings.TrimSpace(msg.Data.Version),
+		Manifest:      msg.Data.Capabilities,
+	}
+
+	s.mu.Lock()
+	current := false
+	if ns, ok := s.nodes[nodeID]; ok && ns != nil && ns.conn == conn {
+		ns.caps = caps
+		ns.helloAt = time.Now()
+		ns.helloOnce.Do(func() { close(ns.hello) })
+		current = true
+	}
+	s.mu.Unlock()
+
+	// Persist the manifest so tunnel/forward creation can validate against it.
+	// An agent that reports none, such as one rolled back to a build without
+	// manifests, clears the stored copy instead of leaving a stale one behind.
+	manifest := ""
+	if len(caps.Manifest) > 0 && string(caps.Manifest) != "null" {
+		manifest = string(caps.Manifest)
+	}
+	if current {
+		if err := s.repo.UpdateNodeCapabilities(nodeID, manifest); err != nil {
+			log.Printf("persist node %d capabilities failed: %v", nodeID, err)
+		}
+	}
+}
+
+// negotiatedSchemaVersion picks the envelope version for a node: the lower of
+// the panel and agent versions, or 1 for legacy agents.
+func negotiatedSchemaVersion(caps *NodeCapabilities) int {
+	if caps == nil || caps.SchemaVersion <= 0 {
+		return 1
+	}
+	if caps.SchemaVersion < RPCSchemaVersion {
+		return caps.SchemaVersion
+	}
+	return RPCSchemaVersion
+}
+
+func commandErrorFromResult(result CommandResult) *CommandError {
+	code := strings.TrimSpace(result.Code)
+	if code == "" {
+		if result.Type == "UnknownCommandResponse" {
+			code = ErrCodeUnknownCommand
+		} else {
+			code = ErrCodeExecFailed
+		}
+	}
+	msg := strings.TrimSpace(result.Message)
+	if msg == "" {
+		msg = "命令执行失败"
+	}
+	return &CommandError{Code: code, Message: msg}
+}
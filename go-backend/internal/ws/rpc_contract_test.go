@@ -0,0 +1,132 @@
+package ws
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// agentRPCSource is the agent side of the command protocol.
+var agentRPCSource = filepath.Join("..", "..", "..", "go-gost", "x", "socket", "rpc.go")
+
+// panelOnlyErrorCodes are produced by the panel and never sent by agents.
+var panelOnlyErrorCodes = map[string]bool{
+	ErrCodeNodeOffline: true,
+	ErrCodeTimeout:     true,
+}
+
+func TestRPCContractMatchesAgent(t *testing.T) {
+	if _, err := os.Stat(agentRPCSource); err != nil {
+		t.Skipf("agent source not available: %v", err)
+	}
+	panel := parseGoFile(t, "rpc.go")
+	agent := parseGoFile(t, agentRPCSource)
+
+	var panelCommands, panelCodes []string
+	for name, value := range stringConstants(panel) {
+		switch {
+		case strings.HasPrefix(name, "Cmd"):
+			panelCommands = append(panelCommands, value)
+		case strings.HasPrefix(name, "ErrCode") && !panelOnlyErrorCodes[value]:
+			panelCodes = append(panelCodes, value)
+		}
+	}
+	var agentCodes []string
+	for name, value := range stringConstants(agent) {
+		if strings.HasPrefix(name, "rpcErr") {
+			agentCodes = append(agentCodes, value)
+		}
+	}
+
+	if got, want := sortedCopy(panelCommands), sortedCopy(registeredAgentCommands(agent)); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("panel commands %v do not match agent commands %v", got, want)
+	}
+	if got, want := sortedCopy(panelCodes), sortedCopy(agentCodes); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("panel error codes %v do not match agent error codes %v", got, want)
+	}
+}
+
+func parseGoFile(t *testing.T, path string) *ast.File {
+	t.Helper()
+	f, err := parser.ParseFile(token.NewFileSet(), path, nil, 0)
+	if err != nil {
+		t.Fatalf("parse %s: %v", path, err)
+	}
+	return f
+}
+
+// stringConstants returns the top-level string constants of f by name.
+func stringConstants(f *ast.File) map[string]string {
+	out := make(map[string]string)
+	for _, decl := range f.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.CONST {
+			continue
+		}
+		for _, spec := range gen.Specs {
+			vs := spec.(*ast.ValueSpec)
+			for i, name := range vs.Names {
+				if i >= len(vs.Values) {
+					continue
+				}
+				if value, ok := stringLiteral(vs.Values[i]); ok {
+					out[name.Name] = value
+				}
+			}
+		}
+	}
+	return out
+}
+
+// registeredAgentCommands returns the Name of every
+// registerCommand(commandSpec{...}) call in f.
+func registeredAgentCommands(f *ast.File) []string {
+	var out []string
+	ast.Inspect(f, func(n ast.Node) bool {
+		call, ok := n.(*ast.CallExpr)
+		if !ok || len(call.Args) != 1 {
+			return true
+		}
+		if fn, ok := call.Fun.(*ast.Ident); !ok || fn.Name != "registerCommand" {
+			return true
+		}
+		lit, ok := call.Args[0].(*ast.CompositeLit)
+		if !ok {
+			return true
+		}
+		for _, elt := range lit.Elts {
+			kv, ok := elt.(*ast.KeyValueExpr)
+			if !ok {
+				continue
+			}
+			if key, ok := kv.Key.(*ast.Ident); ok && key.Name == "Name" {
+				if value, ok := stringLiteral(kv.Value); ok {
+					out = append(out, value)
+				}
+			}
+		}
+		return true
+	})
+	return out
+}
+
+func stringLiteral(expr ast.Expr) (string, bool) {
+	lit, ok := expr.(*ast.BasicLit)
+	if !ok || lit.Kind != token.STRING {
+		return "", false
+	}
+	value, err := strconv.Unquote(lit.Value)
+	return value, err == nil
+}
+
+func sortedCopy(values []string) []string {
+	out := append([]string(nil), values...)
+	sort.Strings(out)
+	return out
+}
@@ -0,0 +1,52 @@
+package ws
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestCommandErrorFromResultMapsLegacyUnknownCommand(t *testing.T) {
+	err := commandErrorFromResult(CommandResult{Type: "UnknownCommandResponse", Message: "未知命令类型: Foo"})
+	if err.Code != ErrCodeUnknownCommand {
+		t.Fatalf("expected %s, got %s", ErrCodeUnknownCommand, err.Code)
+	}
+
+	wrapped := fmt.Errorf("wrap: %w", err)
+	if !IsUnknownCommand(wrapped) {
+		t.Fatalf("expected wrapped error to be recognised as unknown command")
+	}
+	if CommandErrorCode(errors.New("plain")) != "" {
+		t.Fatalf("expected empty code for plain errors")
+	}
+}
+
+func TestCommandErrorFromResultKeepsAgentCode(t *testing.T) {
+	err := commandErrorFromResult(CommandResult{Type: "AddServiceResponse", Code: ErrCodeInvalidPayload, Message: "bad"})
+	if err.Code != ErrCodeInvalidPayload || err.Error() != "bad" {
+		t.Fatalf("unexpected error %+v", err)
+	}
+
+	err = commandErrorFromResult(CommandResult{Type: "AddServiceResponse"})
+	if err.Code != ErrCodeExecFailed || err.Message != "命令执行失败" {
+		t.Fatalf("unexpected default error %+v", err)
+	}
+}
+
+func TestNodeCapabilitiesNegotiation(t *testing.T) {
+	var legacy *NodeCapabilities
+	if !legacy.supports(CmdAddService) {
+		t.Fatalf("legacy agents must be assumed to support every command")
+	}
+	if got := negotiatedSchemaVersion(legacy); got != 1 {
+		t.Fatalf("legacy schema version = %d, want 1", got)
+	}
+
+	caps := &NodeCapabilities{SchemaVersion: RPCSchemaVersion + 1, Commands: []string{CmdAddService, CmdTcpPing}}
+	if !caps.supports(CmdTcpPing) || caps.supports(CmdUpgradeAgent) {
+		t.Fatalf("unexpected command support for %+v", caps.Commands)
+	}
+	if got := negotiatedSchemaVersion(caps); got != RPCSchemaVersion {
+		t.Fatalf("negotiated schema version = %d, want %d", got, RPCSchemaVersion)
+	}
+}
@@ -39,12 +39,19 @@ type nodeSession struct {
 	nodeID int64
 	secret string
 	conn   *connWrap
+	caps   *NodeCapabilities
+	// helloAt is when the Hello of this session was processed.
+	helloAt time.Time
+	// hello is closed once the Hello of this session was processed.
+	hello     chan struct{}
+	helloOnce sync.Once
 }
 
 type commandResponse struct {
 	Type      string          `json:"type"`
 	Success   bool            `json:"success"`
 	Message   string          `json:"message"`
+	Code      string          `json:"code,omitempty"`
 	Data      json.RawMessage `json:"data,omitempty"`
 	RequestID string          `json:"requestId,omitempty"`
 }
@@ -58,20 +65,25 @@ const (
 	wsPingPeriod = 15 * time.Second
 	wsPongWait   = 45 * time.Second
 	wsWriteWait  = 5 * time.Second
+
+	nodeHelloWait = 5 * time.Second
 )
 
 type CommandResult struct {
 	Type    string                 `json:"type"`
 	Success bool                   `json:"success"`
 	Message string                 `json:"message"`
+	Code    string                 `json:"code,omitempty"`
 	Data    map[string]interface{} `json:"data,omitempty"`
 }
 
 type Server struct {
-	repo         *repo.Repository
-	jwtSecret    string
-	upgrader     websocket.Upgrader
-	onNodeOnline func(nodeID int64)
+	repo          *repo.Repository
+	jwtSecret     string
+	upgrader      websocket.Upgrader
+	onNodeOnline  func(nodeID int64)
+	onNodeOffline func(nodeID int64)
+	onNodeInfo    func(nodeID int64, payload []byte)
 
 	mu      sync.RWMutex
 	admins  map[*connWrap]struct{}
@@ -89,6 +101,28 @@ func (s *Server) SetNodeOnlineHook(fn func(nodeID int64)) {
 	s.mu.Unlock()
 }
 
+// SetNodeOfflineHook registers a callback run after a node's current session
+// closes and the node is marked offline.
+func (s *Server) SetNodeOfflineHook(fn func(nodeID int64)) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.onNodeOffline = fn
+	s.mu.Unlock()
+}
+
+// SetNodeInfoHook registers a callback for the periodic system info reports
+// agents push over the node socket.
+func (s *Server) SetNodeInfoHook(fn func(nodeID int64, payload []byte)) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.onNodeInfo = fn
+	s.mu.Unlock()
+}
+
 func NewServer(repo *repo.Repository, jwtSecret string) *Server {
 	return &Server{
 		repo:      repo,
@@ -185,7 +219,7 @@ func (s *Server) handleNode(w http.ResponseWriter, r *http.Request, nodeID int64
 		_ = old.conn.conn.Close()
 		delete(s.byConn, old.conn.conn)
 	}
-	ns := &nodeSession{nodeID: nodeID, secret: secret, conn: cw}
+	ns := &nodeSession{nodeID: nodeID, secret: secret, conn: cw, hello: make(chan struct{})}
 	s.nodes[nodeID] = ns
 	s.byConn[conn] = ns
 	s.mu.Unlock()
@@ -197,7 +231,18 @@ func (s *Server) handleNode(w http.ResponseWriter, r *http.Request, nodeID int64
 	onlineHook := s.onNodeOnline
 	s.mu.RUnlock()
 	if onlineHook != nil {
-		go onlineHook(nodeID)
+		// The hook pushes configuration, which is checked against the
+		// commands of the Hello, so it waits for it. An agent that sends none
+		// within nodeHelloWait is a legacy build that supports everything.
+		go func() {
+			select {
+			case <-ns.hello:
+			case <-time.After(nodeHelloWait):
+			case <-done:
+				return
+			}
+			onlineHook(nodeID)
+		}()
 	}
 
 	defer func() {
@@ -210,11 +255,15 @@ func (s *Server) handleNode(w http.ResponseWriter, r *http.Request, nodeID int64
 			needOfflineBroadcast = true
 		}
 		delete(s.byConn, conn)
+		offlineHook := s.onNodeOffline
 		s.mu.Unlock()
 		if needOfflineBroadcast {
 			s.failPendingForNode(nodeID, "节点连接已断开")
 			_ = s.repo.UpdateNodeStatus(nodeID, 0)
 			s.broadcastStatus(nodeID, 0)
+			if offlineHook != nil {
+				offlineHook(nodeID)
+			}
 		}
 		_ = conn.Close()
 	}()
@@ -229,11 +278,29 @@ func (s *Server) handleNode(w http.ResponseWriter, r *http.Request, nodeID int64
 		s.tryResolvePending(nodeID, msg)
 
 		var parsed struct {
-			Type string `json:"type"`
+			Type    string `json:"type"`
+			Success bool   `json:"success"`
+			Message string `json:"message"`
 		}
-		if json.Unmarshal([]byte(msg), &parsed) == nil && parsed.Type == "UpgradeProgress" {
+		_ = json.Unmarshal([]byte(msg), &parsed)
+		if parsed.Type == helloMessageType {
+			s.handleHello(nodeID, cw, msg)
+		} else if parsed.Type == "UpgradeProgress" {
+			if !parsed.Success {
+				log.Printf("node %d upgrade failed: %s", nodeID, parsed.Message)
+			}
 			s.broadcastTyped(nodeID, "upgrade_progress", msg)
+		} else if parsed.Type == "ThroughputProgress" {
+			s.broadcastTyped(nodeID, "throughput_progress", msg)
 		} else {
+			if parsed.Type == "" {
+				s.mu.RLock()
+				infoHook := s.onNodeInfo
+				s.mu.RUnlock()
+				if infoHook != nil {
+					infoHook(nodeID, []byte(msg))
+				}
+			}
 			s.broadcastInfo(nodeID, msg)
 		}
 	}
@@ -254,7 +321,13 @@ func (s *Server) SendCommand(nodeID int64, cmdType string, data interface{}, tim
 	ns, ok := s.nodes[nodeID]
 	s.mu.RUnlock()
 	if !ok || ns == nil || ns.conn == nil || ns.conn.conn == nil {
-		return CommandResult{}, errors.New("节点不在线")
+		return CommandResult{}, &CommandError{Code: ErrCodeNodeOffline, Message: "节点不在线"}
+	}
+	s.mu.RLock()
+	caps := ns.caps
+	s.mu.RUnlock()
+	if !caps.supports(cmdType) {
+		return CommandResult{Type: "UnknownCommandResponse"}, &CommandError{Code: ErrCodeUnknownCommand, Message: "节点不支持该命令: " + cmdType}
 	}
 
 	requestID := fmt.Sprintf("%d_%d", nodeID, time.Now().UnixNano())
@@ -277,6 +350,7 @@ func (s *Server) SendCommand(nodeID int64, cmdType string, data interface{}, tim
 		"type":      cmdType,
 		"data":      data,
 		"requestId": requestID,
+		"version":   negotiatedSchemaVersion(caps),
 	}
 	rawCmd, err := json.Marshal(cmdPayload)
 	if err != nil {
@@ -324,15 +398,15 @@ func (s *Server) SendCommand(nodeID int64, cmdType string, data interface{}, tim
 			return CommandResult{}, errors.New("命令通道已关闭")
 		}
 		if !result.Success {
-			if strings.TrimSpace(result.Message) == "" {
-				result.Message = "命令执行失败"
-			}
-			return result, errors.New(result.Message)
+			cmdErr := commandErrorFromResult(result)
+			result.Code = cmdErr.Code
+			result.Message = cmdErr.Message
+			return result, cmdErr
 		}
 		return result, nil
 	case <-time.After(timeout):
 		cleanup()
-		return CommandResult{}, errors.New("等待节点响应超时")
+		return CommandResult{}, &CommandError{Code: ErrCodeTimeout, Message: "等待节点响应超时"}
 	}
 }
 
@@ -371,6 +445,7 @@ func (s *Server) tryResolvePending(nodeID int64, message string) {
 		Type:    resp.Type,
 		Success: resp.Success,
 		Message: resp.Message,
+		Code:    resp.Code,
 	}
 	if len(resp.Data) > 0 {
 		var data map[string]interface{}
@@ -409,7 +484,7 @@ func (s *Server) failPendingForNode(nodeID int64, message string) {
 
 	for _, item := range items {
 		select {
-		case item.pr.ch <- CommandResult{Success: false, Message: message}:
+		case item.pr.ch <- CommandResult{Success: false, Message: message, Code: ErrCodeNodeOffline}:
 		default:
 		}
 		close(item.pr.ch)
@@ -0,0 +1,96 @@
+package contract_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go-backend/internal/auth"
+	"go-backend/internal/http/response"
+)
+
+func TestNodeMaintenanceBlocksForwardPlacementContract(t *testing.T) {
+	secret := "contract-jwt-secret"
+	router, repo := setupContractRouter(t, secret)
+	now := time.Now().UnixMilli()
+
+	if err := repo.DB().Exec(`
+		INSERT INTO tunnel(name, traffic_ratio, type, protocol, flow, created_time, updated_time, status, in_ip, inx)
+		VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, "maintenance-tunnel", 1.0, 1, "tls", 99999, now, now, 1, nil, 0).Error; err != nil {
+		t.Fatalf("insert tunnel: %v", err)
+	}
+	tunnelID := mustLastInsertID(t, repo, "maintenance-tunnel")
+
+	if err := repo.DB().Exec(`
+		INSERT INTO node(name, secret, server_ip, server_ip_v4, server_ip_v6, port, interface_name, version, http, tls, socks, created_time, updated_time, status, tcp_listen_addr, udp_listen_addr, inx)
+		VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, "maint-node", "maint-secret", "10.0.0.20", "10.0.0.20", "", "20000-20010", "", "v1", 1, 1, 1, now, now, 1, "[::]", "[::]", 0).Error; err != nil {
+		t.Fatalf("insert node: %v", err)
+	}
+	nodeID := mustLastInsertID(t, repo, "maint-node")
+
+	if err := repo.DB().Exec(`
+		INSERT INTO chain_tunnel(tunnel_id, chain_type, node_id, port, strategy, inx, protocol)
+		VALUES(?, 1, ?, 20001, 'round', 1, 'tls')
+	`, tunnelID, nodeID).Error; err != nil {
+		t.Fatalf("insert chain_tunnel: %v", err)
+	}
+
+	adminToken, err := auth.GenerateToken(1, "admin_user", 0, secret)
+	if err != nil {
+		t.Fatalf("generate admin token: %v", err)
+	}
+
+	post := func(path, body string) response.R {
+		req := httptest.NewRequest(http.MethodPost, path, bytes.NewBufferString(body))
+		req.Header.Set("Authorization", adminToken)
+		res := httptest.NewRecorder()
+		router.ServeHTTP(res, req)
+		var out response.R
+		if err := json.NewDecoder(res.Body).Decode(&out); err != nil {
+			t.Fatalf("decode response: %v", err)
+		}
+		return out
+	}
+
+	out := post("/api/v1/node/maintenance", `{"id":`+jsonNumber(nodeID)+`,"enabled":true}`)
+	if out.Code != 0 {
+		t.Fatalf("expected maintenance enable to succeed, got %d (%s)", out.Code, out.Msg)
+	}
+	if got := mustQueryInt(t, repo, `SELECT maintenance FROM node WHERE id = ?`, nodeID); got != 1 {
+		t.Fatalf("expected node maintenance flag 1, got %d", got)
+	}
+
+	out = post("/api/v1/node/maintenance", `{"id":`+jsonNumber(nodeID)+`,"enabled":true,"drain":true}`)
+	if data, _ := out.Data.(map[string]interface{}); out.Code != 0 || data["drain"] == nil {
+		t.Fatalf("expected maintenance with drain to start a drain, got %d (%s)", out.Code, out.Msg)
+	}
+	out = post("/api/v1/node/maintenance", `{"id":`+jsonNumber(nodeID)+`,"enabled":true}`)
+	if out.Code != 0 {
+		t.Fatalf("expected maintenance re-enable to succeed, got %d (%s)", out.Code, out.Msg)
+	}
+	out = post("/api/v1/node/maintenance/status", `{"id":`+jsonNumber(nodeID)+`}`)
+	if data, _ := out.Data.(map[string]interface{}); out.Code != 0 || data["drain"] != nil {
+		t.Fatalf("expected re-enabling maintenance without drain to clear the previous drain, got %d %v", out.Code, out.Data)
+	}
+
+	out = post("/api/v1/forward/create", `{"name":"blocked","tunnelId":`+jsonNumber(tunnelID)+`,"remoteAddr":"1.1.1.1:443","inPort":20005}`)
+	if out.Code == 0 || out.Msg != "节点 maint-node 处于维护模式，暂不接受新的转发" {
+		t.Fatalf("expected maintenance rejection, got %d (%s)", out.Code, out.Msg)
+	}
+	if got := mustQueryInt(t, repo, `SELECT COUNT(1) FROM forward`); got != 0 {
+		t.Fatalf("expected no forward to be created, got %d", got)
+	}
+
+	out = post("/api/v1/node/maintenance", `{"id":`+jsonNumber(nodeID)+`,"enabled":false}`)
+	if out.Code != 0 {
+		t.Fatalf("expected maintenance disable to succeed, got %d (%s)", out.Code, out.Msg)
+	}
+	if got := mustQueryInt(t, repo, `SELECT maintenance FROM node WHERE id = ?`, nodeID); got != 0 {
+		t.Fatalf("expected node maintenance flag 0, got %d", got)
+	}
+}
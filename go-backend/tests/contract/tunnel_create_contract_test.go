@@ -131,3 +131,112 @@ func TestTunnelUpdateAssignsChainPortsContract(t *testing.T) {
 func jsonInt(v int64) string {
 	return strconv.FormatInt(v, 10)
 }
+
+func TestTunnelCreateRejectsUnsupportedNodeCapabilityContract(t *testing.T) {
+	secret := "contract-jwt-secret"
+	router, repo := setupContractRouter(t, secret)
+	now := time.Now().UnixMilli()
+
+	adminToken, err := auth.GenerateToken(1, "admin_user", 0, secret)
+	if err != nil {
+		t.Fatalf("generate admin token: %v", err)
+	}
+
+	manifest := `{"os":"linux","arch":"amd64","listeners":["tcp","udp","tls"],"dialers":["tcp","udp","tls"],"handlers":["tcp","udp","relay"],"connectors":["relay"],"features":{"tun":false}}`
+	insertNode := func(name, ip, portRange string) int64 {
+		if err := repo.DB().Exec(`
+			INSERT INTO node(name, secret, server_ip, server_ip_v4, server_ip_v6, port, interface_name, version, http, tls, socks, created_time, updated_time, status, tcp_listen_addr, udp_listen_addr, inx, capabilities)
+			VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		`, name, name+"-secret", ip, ip, "", portRange, "", "v1", 1, 1, 1, now, now, 1, "[::]", "[::]", 0, manifest).Error; err != nil {
+			t.Fatalf("insert node %s: %v", name, err)
+		}
+		return mustLastInsertID(t, repo, name)
+	}
+
+	entryID := insertNode("caps-entry", "10.21.0.1", "30000-30010")
+	exitID := insertNode("caps-exit", "10.21.0.3", "32000-32010")
+
+	payload := `{"name":"caps-tunnel","type":2,"flow":99999,"status":1,"inNodeId":[{"nodeId":` + jsonInt(entryID) + `,"protocol":"tls"}],"outNodeId":[{"nodeId":` + jsonInt(exitID) + `,"protocol":"mtls"}]}`
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/tunnel/create", bytes.NewBufferString(payload))
+	req.Header.Set("Authorization", adminToken)
+	req.Header.Set("Content-Type", "application/json")
+	res := httptest.NewRecorder()
+
+	router.ServeHTTP(res, req)
+
+	var out response.R
+	if err := json.NewDecoder(res.Body).Decode(&out); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if out.Code == 0 {
+		t.Fatalf("expected create failure for unsupported transport")
+	}
+	if !strings.Contains(out.Msg, "dialer:mtls") || !strings.Contains(out.Msg, "caps-entry") {
+		t.Fatalf("expected capability error naming entry dialer, got %q", out.Msg)
+	}
+
+	if count := mustQueryInt(t, repo, `SELECT COUNT(1) FROM tunnel WHERE name = ?`, "caps-tunnel"); count != 0 {
+		t.Fatalf("expected no tunnel to be created, found %d", count)
+	}
+}
+
+func TestTunnelCreateValidatesTransportContract(t *testing.T) {
+	secret := "contract-jwt-secret"
+	router, repo := setupContractRouter(t, secret)
+	now := time.Now().UnixMilli()
+
+	adminToken, err := auth.GenerateToken(1, "admin_user", 0, secret)
+	if err != nil {
+		t.Fatalf("generate admin token: %v", err)
+	}
+
+	insertNode := func(name, ip, portRange string) int64 {
+		if err := repo.DB().Exec(`
+			INSERT INTO node(name, secret, server_ip, server_ip_v4, server_ip_v6, port, interface_name, version, http, tls, socks, created_time, updated_time, status, tcp_listen_addr, udp_listen_addr, inx)
+			VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		`, name, name+"-secret", ip, ip, "", portRange, "", "v1", 1, 1, 1, now, now, 1, "[::]", "[::]", 0).Error; err != nil {
+			t.Fatalf("insert node %s: %v", name, err)
+		}
+		return mustLastInsertID(t, repo, name)
+	}
+
+	entryID := insertNode("transport-entry", "10.22.0.1", "30000-30010")
+	exitID := insertNode("transport-exit", "10.22.0.3", "32000-32010")
+
+	cases := []struct {
+		name    string
+		payload string
+		msg     string
+	}{
+		{
+			name:    "unknown protocol",
+			payload: `{"name":"transport-tunnel","type":2,"flow":99999,"status":1,"inNodeId":[{"nodeId":` + jsonInt(entryID) + `}],"outNodeId":[{"nodeId":` + jsonInt(exitID) + `,"protocol":"socks5"}]}`,
+			msg:     "不支持的隧道协议",
+		},
+		{
+			name:    "invalid path",
+			payload: `{"name":"transport-tunnel","type":2,"flow":99999,"status":1,"transportOptions":{"path":"ws"},"inNodeId":[{"nodeId":` + jsonInt(entryID) + `}],"outNodeId":[{"nodeId":` + jsonInt(exitID) + `,"protocol":"wss"}]}`,
+			msg:     "传输路径",
+		},
+	}
+	for _, tc := range cases {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/tunnel/create", bytes.NewBufferString(tc.payload))
+		req.Header.Set("Authorization", adminToken)
+		req.Header.Set("Content-Type", "application/json")
+		res := httptest.NewRecorder()
+
+		router.ServeHTTP(res, req)
+
+		var out response.R
+		if err := json.NewDecoder(res.Body).Decode(&out); err != nil {
+			t.Fatalf("%s: decode response: %v", tc.name, err)
+		}
+		if out.Code == 0 || !strings.Contains(out.Msg, tc.msg) {
+			t.Fatalf("%s: expected error containing %q, got %d %q", tc.name, tc.msg, out.Code, out.Msg)
+		}
+	}
+
+	if count := mustQueryInt(t, repo, `SELECT COUNT(1) FROM tunnel WHERE name = ?`, "transport-tunnel"); count != 0 {
+		t.Fatalf("expected no tunnel to be created, found %d", count)
+	}
+}
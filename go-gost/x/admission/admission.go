@@ -13,6 +13,7 @@ import (
 	"github.com/go-gost/core/logger"
 	"github.com/go-gost/x/internal/loader"
 	"github.com/go-gost/x/internal/matcher"
+	"github.com/go-gost/x/internal/util/mmdb"
 )
 
 type options struct {
@@ -21,6 +22,8 @@ type options struct {
 	fileLoader  loader.Loader
 	redisLoader loader.Loader
 	httpLoader  loader.Loader
+	geoIPFile   string
+	countries   []string
 	period      time.Duration
 	logger      logger.Logger
 }
@@ -39,6 +42,15 @@ func MatchersOption(matchers []string) Option {
 	}
 }
 
+// GeoIPOption matches clients whose country, looked up in the MaxMind DB
+// file, is one of the ISO codes in countries.
+func GeoIPOption(file string, countries []string) Option {
+	return func(opts *options) {
+		opts.geoIPFile = file
+		opts.countries = countries
+	}
+}
+
 func ReloadPeriodOption(period time.Duration) Option {
 	return func(opts *options) {
 		opts.period = period
@@ -72,6 +84,8 @@ func LoggerOption(logger logger.Logger) Option {
 type localAdmission struct {
 	ipMatcher   matcher.Matcher
 	cidrMatcher matcher.Matcher
+	geoIP       *mmdb.Reader
+	countries   map[string]struct{}
 	mu          sync.RWMutex
 	cancelFunc  context.CancelFunc
 	options     options
@@ -167,11 +181,28 @@ func (p *localAdmission) reload(ctx context.Context) error {
 		}
 	}
 
+	var geoIP *mmdb.Reader
+	var countries map[string]struct{}
+	if p.options.geoIPFile != "" && len(p.options.countries) > 0 {
+		countries = make(map[string]struct{}, len(p.options.countries))
+		for _, c := range p.options.countries {
+			countries[strings.ToUpper(strings.TrimSpace(c))] = struct{}{}
+		}
+		if geoIP, err = mmdb.Open(p.options.geoIPFile); err != nil {
+			p.options.logger.Warnf("geoip %s: %v", p.options.geoIPFile, err)
+		}
+	}
+
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
 	p.ipMatcher = matcher.IPMatcher(ips)
 	p.cidrMatcher = matcher.CIDRMatcher(inets)
+	// 数据库读取失败时沿用上次加载的数据
+	if geoIP != nil || countries == nil {
+		p.geoIP = geoIP
+	}
+	p.countries = countries
 
 	return nil
 }
@@ -258,7 +289,20 @@ func (p *localAdmission) matched(addr string) bool {
 	defer p.mu.RUnlock()
 
 	return p.ipMatcher.Match(addr) ||
-		p.cidrMatcher.Match(addr)
+		p.cidrMatcher.Match(addr) ||
+		p.matchCountry(addr)
+}
+
+func (p *localAdmission) matchCountry(addr string) bool {
+	if p.geoIP == nil || len(p.countries) == 0 {
+		return false
+	}
+	country := p.geoIP.Country(net.ParseIP(addr))
+	if country == "" {
+		return false
+	}
+	_, ok := p.countries[country]
+	return ok
 }
 
 func (p *localAdmission) Close() error {
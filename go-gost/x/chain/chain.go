@@ -2,6 +2,7 @@ package chain
 
 import (
 	"context"
+	"io"
 
 	"github.com/go-gost/core/chain"
 	"github.com/go-gost/core/hop"
@@ -43,6 +44,7 @@ type Chain struct {
 	marker   selector.Marker
 	metadata metadata.Metadata
 	logger   logger.Logger
+	owned    []io.Closer
 }
 
 func NewChain(name string, opts ...ChainOption) *Chain {
@@ -65,6 +67,22 @@ func (c *Chain) AddHop(hop hop.Hop) {
 	c.hops = append(c.hops, hop)
 }
 
+// AddOwnedHop adds a hop built inline for this chain; it is closed with the chain.
+func (c *Chain) AddOwnedHop(hop hop.Hop) {
+	c.AddHop(hop)
+	if closer, ok := hop.(io.Closer); ok {
+		c.owned = append(c.owned, closer)
+	}
+}
+
+// Close implements io.Closer interface.
+func (c *Chain) Close() error {
+	for _, closer := range c.owned {
+		closer.Close()
+	}
+	return nil
+}
+
 // Metadata implements metadata.Metadatable interface.
 func (c *Chain) Metadata() metadata.Metadata {
 	return c.metadata
@@ -163,9 +163,17 @@ type AdmissionConfig struct {
 	File      *FileLoader   `yaml:",omitempty" json:"file,omitempty"`
 	Redis     *RedisLoader  `yaml:",omitempty" json:"redis,omitempty"`
 	HTTP      *HTTPLoader   `yaml:"http,omitempty" json:"http,omitempty"`
+	GeoIP     *GeoIPConfig  `yaml:"geoip,omitempty" json:"geoip,omitempty"`
 	Plugin    *PluginConfig `yaml:",omitempty" json:"plugin,omitempty"`
 }
 
+// GeoIPConfig matches client addresses by country using a local MaxMind DB
+// (e.g. GeoLite2-Country.mmdb).
+type GeoIPConfig struct {
+	File      string   `yaml:",omitempty" json:"file,omitempty"`
+	Countries []string `yaml:",omitempty" json:"countries,omitempty"`
+}
+
 type BypassConfig struct {
 	Name string `json:"name"`
 	// Deprecated: use whitelist instead
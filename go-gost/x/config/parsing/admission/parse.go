@@ -14,6 +14,10 @@ import (
 	"github.com/go-gost/x/registry"
 )
 
+// DefaultGeoIPFile is looked up in the working directory when a GeoIP rule
+// names no database.
+const DefaultGeoIPFile = "GeoLite2-Country.mmdb"
+
 func ParseAdmission(cfg *config.AdmissionConfig) admission.Admission {
 	if cfg == nil {
 		return nil
@@ -64,6 +68,13 @@ func ParseAdmission(cfg *config.AdmissionConfig) admission.Admission {
 			loader.KeyRedisLoaderOption(cfg.Redis.Key),
 		)))
 	}
+	if cfg.GeoIP != nil && len(cfg.GeoIP.Countries) > 0 {
+		file := cfg.GeoIP.File
+		if file == "" {
+			file = DefaultGeoIPFile
+		}
+		opts = append(opts, xadmission.GeoIPOption(file, cfg.GeoIP.Countries))
+	}
 	if cfg.HTTP != nil && cfg.HTTP.URL != "" {
 		opts = append(opts, xadmission.HTTPLoaderOption(loader.HTTPLoader(
 			cfg.HTTP.URL,
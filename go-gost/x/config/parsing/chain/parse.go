@@ -38,12 +38,15 @@ func ParseChain(cfg *config.ChainConfig, log logger.Logger) (chain.Chainer, erro
 
 		if ch.Nodes != nil || ch.Plugin != nil {
 			if hop, err = hop_parser.ParseHop(ch, log); err != nil {
+				c.Close()
 				return nil, err
 			}
-		} else {
-			hop = registry.HopRegistry().Get(ch.Name)
+			if hop != nil {
+				c.AddOwnedHop(hop)
+			}
+			continue
 		}
-		if hop != nil {
+		if hop = registry.HopRegistry().Get(ch.Name); hop != nil {
 			c.AddHop(hop)
 		}
 	}
@@ -13,6 +13,7 @@ import (
 	bypass_parser "github.com/go-gost/x/config/parsing/bypass"
 	node_parser "github.com/go-gost/x/config/parsing/node"
 	selector_parser "github.com/go-gost/x/config/parsing/selector"
+	"github.com/go-gost/x/health"
 	xhop "github.com/go-gost/x/hop"
 	hop_plugin "github.com/go-gost/x/hop/plugin"
 	"github.com/go-gost/x/internal/loader"
@@ -61,6 +62,12 @@ func ParseHop(cfg *config.HopConfig, log logger.Logger) (hop.Hop, error) {
 	}
 
 	var nodes []*chain.Node
+	var probes []*health.Handle
+	releaseProbes := func() {
+		for _, probe := range probes {
+			probe.Release()
+		}
+	}
 	for _, v := range cfg.Nodes {
 		if v == nil {
 			continue
@@ -99,9 +106,17 @@ func ParseHop(cfg *config.HopConfig, log logger.Logger) (hop.Hop, error) {
 
 		node, err := node_parser.ParseNode(cfg.Name, v, log)
 		if err != nil {
+			releaseProbes()
 			return nil, err
 		}
 		if node != nil {
+			if md := node.Options().Metadata; md != nil {
+				if spec, ok := health.SpecFromMetadata(md, node.Addr); ok {
+					probe := health.DefaultChecker().Acquire(cfg.Name, node.Name, spec)
+					md.Set(health.MDKeyProbe, probe.ID())
+					probes = append(probes, probe)
+				}
+			}
 			nodes = append(nodes, node)
 		}
 	}
@@ -117,6 +132,7 @@ func ParseHop(cfg *config.HopConfig, log logger.Logger) (hop.Hop, error) {
 		xhop.SelectorOption(sel),
 		xhop.BypassOption(xbypass.BypassGroup(bypass_parser.List(cfg.Bypass, cfg.Bypasses...)...)),
 		xhop.ReloadPeriodOption(cfg.Reload),
+		xhop.HealthProbesOption(probes...),
 		xhop.LoggerOption(log.WithFields(map[string]any{
 			"kind": "hop",
 			"hop":  cfg.Name,
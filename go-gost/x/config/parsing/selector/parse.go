@@ -22,11 +22,14 @@ func ParseChainSelector(cfg *config.SelectorConfig) selector.Selector[chain.Chai
 		strategy = xs.FIFOStrategy[chain.Chainer]()
 	case "hash":
 		strategy = xs.HashStrategy[chain.Chainer]()
+	case "latency", "least-latency":
+		strategy = xs.LeastLatencyStrategy[chain.Chainer]()
 	default:
 		strategy = xs.RoundRobinStrategy[chain.Chainer]()
 	}
 	return xs.NewSelector(
 		strategy,
+		xs.HealthFilter[chain.Chainer](),
 		xs.FailFilter[chain.Chainer](cfg.MaxFails, cfg.FailTimeout),
 		xs.BackupFilter[chain.Chainer](),
 	)
@@ -47,12 +50,15 @@ func ParseNodeSelector(cfg *config.SelectorConfig) selector.Selector[*chain.Node
 		strategy = xs.FIFOStrategy[*chain.Node]()
 	case "hash":
 		strategy = xs.HashStrategy[*chain.Node]()
+	case "latency", "least-latency":
+		strategy = xs.LeastLatencyStrategy[*chain.Node]()
 	default:
 		strategy = xs.RoundRobinStrategy[*chain.Node]()
 	}
 
 	return xs.NewSelector(
 		strategy,
+		xs.HealthFilter[*chain.Node](),
 		xs.FailFilter[*chain.Node](cfg.MaxFails, cfg.FailTimeout),
 		xs.BackupFilter[*chain.Node](),
 	)
@@ -61,6 +67,7 @@ func ParseNodeSelector(cfg *config.SelectorConfig) selector.Selector[*chain.Node
 func DefaultNodeSelector() selector.Selector[*chain.Node] {
 	return xs.NewSelector(
 		xs.RoundRobinStrategy[*chain.Node](),
+		xs.HealthFilter[*chain.Node](),
 		xs.FailFilter[*chain.Node](xs.DefaultMaxFails, xs.DefaultFailTimeout),
 		xs.BackupFilter[*chain.Node](),
 	)
@@ -69,6 +76,7 @@ func DefaultNodeSelector() selector.Selector[*chain.Node] {
 func DefaultChainSelector() selector.Selector[chain.Chainer] {
 	return xs.NewSelector(
 		xs.RoundRobinStrategy[chain.Chainer](),
+		xs.HealthFilter[chain.Chainer](),
 		xs.FailFilter[chain.Chainer](xs.DefaultMaxFails, xs.DefaultFailTimeout),
 		xs.BackupFilter[chain.Chainer](),
 	)
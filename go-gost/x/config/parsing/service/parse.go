@@ -2,6 +2,7 @@ package service
 
 import (
 	"fmt"
+	"io"
 	"runtime"
 	"strconv"
 	"strings"
@@ -353,12 +354,16 @@ func ParseService(cfg *config.ServiceConfig) (service.Service, error) {
 		return nil, fmt.Errorf("unknown handler: %s", cfg.Handler.Type)
 	}
 
+	var closers []io.Closer
 	if forwarder, ok := h.(handler.Forwarder); ok {
-		hop, err := parseForwarder(cfg.Forwarder, log)
+		hop, owned, err := parseForwarder(cfg.Name, cfg.Forwarder, log)
 		if err != nil {
 			return nil, err
 		}
 		forwarder.Forward(hop)
+		if closer, ok := hop.(io.Closer); ok && owned {
+			closers = append(closers, closer)
+		}
 	}
 
 	if cfg.Handler.Metadata == nil {
@@ -391,15 +396,18 @@ func ParseService(cfg *config.ServiceConfig) (service.Service, error) {
 		xservice.ObserverOption(observer),
 		xservice.ObserverPeriodOption(observerPeriod),
 		xservice.LoggerOption(serviceLogger),
+		xservice.ClosersOption(closers...),
 	)
 
 	serviceLogger.Infof("listening on %s/%s", s.Addr().String(), s.Addr().Network())
 	return s, nil
 }
 
-func parseForwarder(cfg *config.ForwarderConfig, log logger.Logger) (hop.Hop, error) {
+// parseForwarder resolves the forwarder hop. owned reports whether the hop
+// was built inline for this service rather than taken from the registry.
+func parseForwarder(service string, cfg *config.ForwarderConfig, log logger.Logger) (h hop.Hop, owned bool, err error) {
 	if cfg == nil {
-		return nil, nil
+		return nil, false, nil
 	}
 
 	hopName := cfg.Hop
@@ -407,11 +415,11 @@ func parseForwarder(cfg *config.ForwarderConfig, log logger.Logger) (hop.Hop, er
 		hopName = cfg.Name
 	}
 	if hopName != "" {
-		return registry.HopRegistry().Get(hopName), nil
+		return registry.HopRegistry().Get(hopName), false, nil
 	}
 
 	hc := config.HopConfig{
-		Name:     cfg.Name,
+		Name:     service,
 		Selector: cfg.Selector,
 	}
 	for _, node := range cfg.Nodes {
@@ -452,7 +460,8 @@ func parseForwarder(cfg *config.ForwarderConfig, log logger.Logger) (hop.Hop, er
 			Metadata: node.Metadata,
 		})
 	}
-	return hop_parser.ParseHop(&hc, log)
+	h, err = hop_parser.ParseHop(&hc, log)
+	return h, true, err
 }
 
 func chainGroup(name string, group *config.ChainGroupConfig) chain.Chainer {
@@ -16,6 +16,7 @@ import (
 	"github.com/go-gost/core/recorder"
 	ctxvalue "github.com/go-gost/x/ctx"
 	xnet "github.com/go-gost/x/internal/net"
+	"github.com/go-gost/x/internal/net/proxyproto"
 	"github.com/go-gost/x/internal/util/forwarder"
 	"github.com/go-gost/x/internal/util/sniffing"
 	tls_util "github.com/go-gost/x/internal/util/tls"
@@ -24,6 +25,8 @@ import (
 	stats_wrapper "github.com/go-gost/x/observer/stats/wrapper"
 	xrecorder "github.com/go-gost/x/recorder"
 	"github.com/go-gost/x/registry"
+	xselector "github.com/go-gost/x/selector"
+	xservice "github.com/go-gost/x/service"
 )
 
 func init() {
@@ -117,6 +120,14 @@ func (h *forwardHandler) Handle(ctx context.Context, conn net.Conn, opts ...hand
 		ro.OutputBytes = pStats.Get(stats.KindOutputBytes)
 		ro.Duration = time.Since(start)
 
+		// 连接结束时整体计入命中的路由，上下行方向与服务级统计一致
+		if h.md.routeTraffic && ro.Node != "" {
+			xservice.GetGlobalTrafficManager().AddTraffic(ro.Node, int64(ro.OutputBytes), int64(ro.InputBytes))
+		}
+
+		if err := ro.Record(ctx, h.recorder.Recorder); err != nil {
+			h.options.Logger.Errorf("record: %v", err)
+		}
 	}()
 
 	if !h.checkRateLimit(conn.RemoteAddr()) {
@@ -232,8 +243,12 @@ func (h *forwardHandler) Handle(ctx context.Context, conn net.Conn, opts ...hand
 		ro.Host = addr
 
 		var buf bytes.Buffer
+		dialStart := time.Now()
 		cc, err = h.options.Router.Dial(ctxvalue.ContextWithBuffer(ctx, &buf), network, addr)
 		ro.Route = buf.String()
+		if err == nil && network == "tcp" {
+			xselector.DefaultLatencyTracker().Observe(target.Addr, time.Since(dialStart))
+		}
 		if err != nil {
 			// Mark node as failed for future selections
 			if marker := target.Marker(); marker != nil {
@@ -252,6 +267,12 @@ func (h *forwardHandler) Handle(ctx context.Context, conn net.Conn, opts ...hand
 		}
 		defer cc.Close()
 
+		// The header travels through any chain as payload, so the final
+		// target sees the original client address.
+		if network == "tcp" {
+			cc = proxyproto.WrapClientConn(h.md.proxyProtocol, conn.RemoteAddr(), conn.LocalAddr(), cc)
+		}
+
 		if err := xnet.Transport(conn, cc); err != nil {
 			if marker := target.Marker(); marker != nil {
 				marker.Mark()
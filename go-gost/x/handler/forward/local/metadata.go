@@ -14,6 +14,7 @@ import (
 
 type metadata struct {
 	readTimeout   time.Duration
+	proxyProtocol int
 	httpKeepalive bool
 
 	sniffing                    bool
@@ -31,6 +32,9 @@ type metadata struct {
 	// 0 means use the total number of available nodes (try all nodes once).
 	// Default: 0 (try all available nodes)
 	maxRetries int
+
+	// routeTraffic 按命中的转发节点名称上报流量，用于多个转发共享同一端口时的分路由统计
+	routeTraffic bool
 }
 
 func (h *forwardHandler) parseMetadata(md mdata.Metadata) (err error) {
@@ -38,6 +42,7 @@ func (h *forwardHandler) parseMetadata(md mdata.Metadata) (err error) {
 	if h.md.readTimeout <= 0 {
 		h.md.readTimeout = 15 * time.Second
 	}
+	h.md.proxyProtocol = mdutil.GetInt(md, "proxyProtocol")
 
 	h.md.httpKeepalive = mdutil.GetBool(md, "http.keepalive")
 
@@ -65,5 +70,7 @@ func (h *forwardHandler) parseMetadata(md mdata.Metadata) (err error) {
 	// maxRetries: 0 means try all available nodes (default behavior)
 	h.md.maxRetries = mdutil.GetInt(md, "maxRetries", "retry.max")
 
+	h.md.routeTraffic = mdutil.GetBool(md, "routeTraffic")
+
 	return
 }
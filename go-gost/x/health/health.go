@@ -0,0 +1,462 @@
+// Package health runs active probes against hop nodes and forward targets.
+//
+// Probes are configured through node metadata:
+//
+//	healthCheck:    tcp | udp | http
+//	healthInterval: probe interval (default 10s)
+//	healthTimeout:  probe timeout (default 3s)
+//	healthFails:    consecutive failures before a node is marked down (default 2)
+//	healthPasses:   consecutive successes before a node is marked up again (default 1)
+//	healthAddr:     probe address, defaults to the node address
+//	healthPath:     HTTP request path (default /)
+//	healthStatus:   expected HTTP status, any 2xx/3xx when unset
+//	healthSend:     UDP payload (default "ping")
+//	healthExpect:   substring the UDP reply must contain
+package health
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-gost/core/metadata"
+	mdutil "github.com/go-gost/x/metadata/util"
+)
+
+const (
+	MDKeyCheck    = "healthCheck"
+	MDKeyInterval = "healthInterval"
+	MDKeyTimeout  = "healthTimeout"
+	MDKeyFails    = "healthFails"
+	MDKeyPasses   = "healthPasses"
+	MDKeyAddr     = "healthAddr"
+	MDKeyPath     = "healthPath"
+	MDKeyStatus   = "healthStatus"
+	MDKeySend     = "healthSend"
+	MDKeyExpect   = "healthExpect"
+
+	// MDKeyProbe is set on parsed nodes to link them to their running probe.
+	MDKeyProbe = "healthProbe"
+)
+
+const (
+	defaultInterval = 10 * time.Second
+	defaultTimeout  = 3 * time.Second
+	minInterval     = time.Second
+	defaultFails    = 2
+	defaultPasses   = 1
+
+	// releaseGrace keeps a probe and its state alive across service and
+	// chain reloads, which release the old hop before parsing the new one.
+	releaseGrace = 30 * time.Second
+)
+
+// Spec describes a single active probe.
+type Spec struct {
+	Type     string
+	Addr     string
+	Interval time.Duration
+	Timeout  time.Duration
+	Fails    int
+	Passes   int
+	Path     string
+	Status   int
+	Send     string
+	Expect   string
+}
+
+// SpecFromMetadata builds a probe spec from node metadata. ok is false when
+// the node has no (valid) active health check configured.
+func SpecFromMetadata(md metadata.Metadata, addr string) (spec Spec, ok bool) {
+	if md == nil {
+		return
+	}
+	spec.Type = strings.ToLower(strings.TrimSpace(mdutil.GetString(md, MDKeyCheck)))
+	switch spec.Type {
+	case "tcp", "udp", "http", "https":
+	default:
+		return Spec{}, false
+	}
+	spec.Addr = strings.TrimSpace(mdutil.GetString(md, MDKeyAddr))
+	if spec.Addr == "" {
+		spec.Addr = addr
+	}
+	if spec.Addr == "" {
+		return Spec{}, false
+	}
+	spec.Interval = mdutil.GetDuration(md, MDKeyInterval)
+	spec.Timeout = mdutil.GetDuration(md, MDKeyTimeout)
+	spec.Fails = mdutil.GetInt(md, MDKeyFails)
+	spec.Passes = mdutil.GetInt(md, MDKeyPasses)
+	spec.Path = mdutil.GetString(md, MDKeyPath)
+	spec.Status = mdutil.GetInt(md, MDKeyStatus)
+	spec.Send = mdutil.GetString(md, MDKeySend)
+	spec.Expect = mdutil.GetString(md, MDKeyExpect)
+	spec.normalize()
+	return spec, true
+}
+
+func (s *Spec) normalize() {
+	if s.Interval <= 0 {
+		s.Interval = defaultInterval
+	}
+	if s.Interval < minInterval {
+		s.Interval = minInterval
+	}
+	if s.Timeout <= 0 {
+		s.Timeout = defaultTimeout
+	}
+	if s.Timeout > s.Interval {
+		s.Timeout = s.Interval
+	}
+	if s.Fails <= 0 {
+		s.Fails = defaultFails
+	}
+	if s.Passes <= 0 {
+		s.Passes = defaultPasses
+	}
+	if s.Path == "" {
+		s.Path = "/"
+	}
+	if s.Send == "" {
+		s.Send = "ping"
+	}
+}
+
+func (s Spec) key() string {
+	return fmt.Sprintf("%s|%s|%s|%s|%d|%d|%s|%d|%s|%s",
+		s.Type, s.Addr, s.Interval, s.Timeout, s.Fails, s.Passes, s.Path, s.Status, s.Send, s.Expect)
+}
+
+// Status is the reported state of one probe.
+type Status struct {
+	Owner     string `json:"owner"`
+	Node      string `json:"node"`
+	Addr      string `json:"addr"`
+	Type      string `json:"type"`
+	Up        bool   `json:"up"`
+	Checked   bool   `json:"checked"`
+	Latency   int64  `json:"latency"` // milliseconds
+	Error     string `json:"error,omitempty"`
+	CheckedAt int64  `json:"checked_at"` // unix milliseconds
+	Since     int64  `json:"since"`      // unix milliseconds of the last up/down transition
+}
+
+type probe struct {
+	id    string
+	owner string
+	node  string
+	spec  Spec
+
+	refs    int
+	release *time.Timer
+	cancel  context.CancelFunc
+
+	mu        sync.RWMutex
+	up        bool
+	checked   bool
+	fails     int
+	passes    int
+	latency   time.Duration
+	lastErr   string
+	checkedAt time.Time
+	since     time.Time
+}
+
+// Checker owns all running probes.
+type Checker struct {
+	mu     sync.RWMutex
+	probes map[string]*probe
+	// probeFunc runs one check and grace delays stopping an unreferenced
+	// probe; both are replaced in tests.
+	probeFunc func(ctx context.Context, spec Spec) error
+	grace     time.Duration
+}
+
+// NewChecker creates an empty checker.
+func NewChecker() *Checker {
+	return &Checker{
+		probes:    make(map[string]*probe),
+		probeFunc: runProbe,
+		grace:     releaseGrace,
+	}
+}
+
+var defaultChecker = NewChecker()
+
+// DefaultChecker returns the process-wide checker used by parsed hops.
+func DefaultChecker() *Checker {
+	return defaultChecker
+}
+
+// Handle is a reference to a running probe, returned by Acquire.
+type Handle struct {
+	c    *Checker
+	id   string
+	once sync.Once
+}
+
+// ID identifies the probe; it is stored in node metadata under MDKeyProbe.
+func (h *Handle) ID() string {
+	if h == nil {
+		return ""
+	}
+	return h.id
+}
+
+// Release drops the reference; the probe stops once no hop uses it.
+func (h *Handle) Release() {
+	if h == nil || h.c == nil {
+		return
+	}
+	h.once.Do(func() { h.c.release(h.id) })
+}
+
+// Acquire starts (or reuses) the probe for node of owner and returns a handle
+// that must be released when the owning hop is closed.
+func (c *Checker) Acquire(owner, node string, spec Spec) *Handle {
+	spec.normalize()
+	id := owner + "/" + node + "/" + spec.key()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	p := c.probes[id]
+	if p == nil {
+		ctx, cancel := context.WithCancel(context.Background())
+		p = &probe{
+			id:     id,
+			owner:  owner,
+			node:   node,
+			spec:   spec,
+			cancel: cancel,
+			// Nodes are considered up until proven otherwise.
+			up:    true,
+			since: time.Now(),
+		}
+		c.probes[id] = p
+		go c.run(ctx, p)
+	}
+	if p.release != nil {
+		p.release.Stop()
+		p.release = nil
+	}
+	p.refs++
+	return &Handle{c: c, id: id}
+}
+
+func (c *Checker) release(id string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	p := c.probes[id]
+	if p == nil {
+		return
+	}
+	p.refs--
+	if p.refs > 0 {
+		return
+	}
+	p.release = time.AfterFunc(c.grace, func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if cur := c.probes[id]; cur == p && p.refs <= 0 {
+			p.cancel()
+			delete(c.probes, id)
+		}
+	})
+}
+
+// IsUp reports whether the probe identified by id considers its target
+// healthy. Unknown probes are treated as healthy.
+func (c *Checker) IsUp(id string) bool {
+	if id == "" {
+		return true
+	}
+	c.mu.RLock()
+	p := c.probes[id]
+	c.mu.RUnlock()
+	if p == nil {
+		return true
+	}
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.up
+}
+
+// Snapshot returns the state of every probe still referenced by a hop.
+func (c *Checker) Snapshot() []Status {
+	c.mu.RLock()
+	probes := make([]*probe, 0, len(c.probes))
+	for _, p := range c.probes {
+		if p.refs > 0 {
+			probes = append(probes, p)
+		}
+	}
+	c.mu.RUnlock()
+
+	items := make([]Status, 0, len(probes))
+	for _, p := range probes {
+		p.mu.RLock()
+		st := Status{
+			Owner:   p.owner,
+			Node:    p.node,
+			Addr:    p.spec.Addr,
+			Type:    p.spec.Type,
+			Up:      p.up,
+			Checked: p.checked,
+			Latency: p.latency.Milliseconds(),
+			Error:   p.lastErr,
+			Since:   p.since.UnixMilli(),
+		}
+		if !p.checkedAt.IsZero() {
+			st.CheckedAt = p.checkedAt.UnixMilli()
+		}
+		p.mu.RUnlock()
+		items = append(items, st)
+	}
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].Owner != items[j].Owner {
+			return items[i].Owner < items[j].Owner
+		}
+		return items[i].Node < items[j].Node
+	})
+	return items
+}
+
+func (c *Checker) run(ctx context.Context, p *probe) {
+	c.check(ctx, p)
+
+	ticker := time.NewTicker(p.spec.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.check(ctx, p)
+		}
+	}
+}
+
+func (c *Checker) check(ctx context.Context, p *probe) {
+	ctx, cancel := context.WithTimeout(ctx, p.spec.Timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := c.probeFunc(ctx, p.spec)
+	p.record(err, time.Since(start), time.Now())
+}
+
+func (p *probe) record(err error, latency time.Duration, now time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.checked = true
+	p.checkedAt = now
+	if err != nil {
+		p.lastErr = err.Error()
+		p.passes = 0
+		p.fails++
+		if p.up && p.fails >= p.spec.Fails {
+			p.up = false
+			p.since = now
+		}
+		return
+	}
+	p.lastErr = ""
+	p.latency = latency
+	p.fails = 0
+	p.passes++
+	if !p.up && p.passes >= p.spec.Passes {
+		p.up = true
+		p.since = now
+	}
+}
+
+func runProbe(ctx context.Context, spec Spec) error {
+	switch spec.Type {
+	case "tcp":
+		var d net.Dialer
+		conn, err := d.DialContext(ctx, "tcp", spec.Addr)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	case "udp":
+		return probeUDP(ctx, spec)
+	case "http", "https":
+		return probeHTTP(ctx, spec)
+	}
+	return fmt.Errorf("unknown health check type %q", spec.Type)
+}
+
+func probeUDP(ctx context.Context, spec Spec) error {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "udp", spec.Addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	if _, err := conn.Write([]byte(spec.Send)); err != nil {
+		return err
+	}
+	buf := make([]byte, 1500)
+	n, err := conn.Read(buf)
+	if err != nil {
+		return err
+	}
+	if spec.Expect != "" && !strings.Contains(string(buf[:n]), spec.Expect) {
+		return fmt.Errorf("unexpected udp reply")
+	}
+	return nil
+}
+
+var probeHTTPClient = &http.Client{
+	Transport: &http.Transport{
+		Proxy:             nil,
+		DisableKeepAlives: true,
+		TLSClientConfig:   &tls.Config{InsecureSkipVerify: true},
+	},
+	CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+func probeHTTP(ctx context.Context, spec Spec) error {
+	path := spec.Path
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, spec.Type+"://"+spec.Addr+path, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := probeHTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+
+	if spec.Status > 0 {
+		if resp.StatusCode != spec.Status {
+			return fmt.Errorf("unexpected status %d", resp.StatusCode)
+		}
+		return nil
+	}
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return nil
+}
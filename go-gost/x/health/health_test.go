@@ -0,0 +1,128 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newTestChecker 创建一个探测结果由 fail 控制的检查器
+func newTestChecker(grace time.Duration, fail *atomic.Bool, calls *atomic.Int32) *Checker {
+	c := NewChecker()
+	c.grace = grace
+	c.probeFunc = func(ctx context.Context, spec Spec) error {
+		calls.Add(1)
+		if fail.Load() {
+			return errors.New("refused")
+		}
+		return nil
+	}
+	return c
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("condition not met in time")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestCheckerSharesProbeAcrossAcquires(t *testing.T) {
+	var fail atomic.Bool
+	var calls atomic.Int32
+	c := newTestChecker(time.Hour, &fail, &calls)
+	spec := Spec{Type: "tcp", Addr: "192.0.2.1:80", Interval: time.Hour}
+
+	a := c.Acquire("svc", "node-1", spec)
+	b := c.Acquire("svc", "node-1", spec)
+	if a.ID() != b.ID() {
+		t.Fatalf("expected the same probe, got %q and %q", a.ID(), b.ID())
+	}
+	if other := c.Acquire("svc", "node-2", spec); other.ID() == a.ID() {
+		t.Fatalf("expected another node to get its own probe")
+	}
+	waitFor(t, func() bool { return calls.Load() == 2 })
+	if n := len(c.Snapshot()); n != 2 {
+		t.Fatalf("expected 2 probes, got %d", n)
+	}
+}
+
+func TestCheckerKeepsProbeDuringGrace(t *testing.T) {
+	var fail atomic.Bool
+	var calls atomic.Int32
+	c := newTestChecker(50*time.Millisecond, &fail, &calls)
+	spec := Spec{Type: "tcp", Addr: "192.0.2.1:80", Interval: time.Hour}
+
+	h := c.Acquire("svc", "node-1", spec)
+	waitFor(t, func() bool { return calls.Load() == 1 })
+	h.Release()
+	h.Release()
+	if len(c.Snapshot()) != 0 {
+		t.Fatalf("expected a released probe to leave the snapshot")
+	}
+
+	// 重载时在宽限期内重新获取，沿用原有探测而不重新启动
+	h = c.Acquire("svc", "node-1", spec)
+	time.Sleep(100 * time.Millisecond)
+	if calls.Load() != 1 {
+		t.Fatalf("expected the probe to survive a reload, got %d checks", calls.Load())
+	}
+
+	h.Release()
+	waitFor(t, func() bool {
+		c.mu.RLock()
+		defer c.mu.RUnlock()
+		return len(c.probes) == 0
+	})
+	if !c.IsUp(h.ID()) {
+		t.Fatalf("expected an unknown probe to count as up")
+	}
+}
+
+func TestProbeRecordThresholds(t *testing.T) {
+	spec := Spec{Fails: 2, Passes: 2}
+	spec.normalize()
+	p := &probe{spec: spec, up: true}
+	now := time.Now()
+	failure := errors.New("refused")
+
+	p.record(failure, 0, now)
+	if !p.up {
+		t.Fatalf("expected a single failure to be tolerated")
+	}
+	p.record(failure, 0, now)
+	if p.up || p.lastErr != "refused" {
+		t.Fatalf("expected 2 failures to mark the node down, got up=%v err=%q", p.up, p.lastErr)
+	}
+	p.record(nil, time.Millisecond, now)
+	if p.up {
+		t.Fatalf("expected a single pass not to bring the node back")
+	}
+	p.record(failure, 0, now)
+	p.record(nil, time.Millisecond, now)
+	if p.up {
+		t.Fatalf("expected a failure to reset the passes")
+	}
+	p.record(nil, time.Millisecond, now)
+	if !p.up || p.lastErr != "" {
+		t.Fatalf("expected 2 passes to mark the node up, got up=%v err=%q", p.up, p.lastErr)
+	}
+}
+
+func TestCheckerIsUp(t *testing.T) {
+	var fail atomic.Bool
+	var calls atomic.Int32
+	fail.Store(true)
+	c := newTestChecker(time.Hour, &fail, &calls)
+	h := c.Acquire("svc", "node-1", Spec{Type: "tcp", Addr: "192.0.2.1:80", Interval: time.Second, Fails: 1})
+	waitFor(t, func() bool { return !c.IsUp(h.ID()) })
+	if st := c.Snapshot(); len(st) != 1 || st[0].Up || st[0].Error != "refused" {
+		t.Fatalf("unexpected snapshot %+v", st)
+	}
+}
@@ -19,6 +19,7 @@ import (
 	"github.com/go-gost/x/config"
 	node_parser "github.com/go-gost/x/config/parsing/node"
 	ctxvalue "github.com/go-gost/x/ctx"
+	"github.com/go-gost/x/health"
 	"github.com/go-gost/x/internal/loader"
 )
 
@@ -32,6 +33,7 @@ type options struct {
 	httpLoader  loader.Loader
 	period      time.Duration
 	logger      logger.Logger
+	probes      []*health.Handle
 }
 
 type Option func(*options)
@@ -82,6 +84,15 @@ func HTTPLoaderOption(httpLoader loader.Loader) Option {
 		opts.httpLoader = httpLoader
 	}
 }
+
+// HealthProbesOption hands the hop the active health probes of its nodes,
+// released when the hop is closed.
+func HealthProbesOption(probes ...*health.Handle) Option {
+	return func(opts *options) {
+		opts.probes = probes
+	}
+}
+
 func LoggerOption(logger logger.Logger) Option {
 	return func(opts *options) {
 		opts.logger = logger
@@ -257,7 +268,11 @@ func (p *chainHop) checkHost(host string, node *chain.Node) bool {
 		host = v
 	}
 
-	if vhost == host || vhost[0] == '.' && strings.HasSuffix(host, vhost[1:]) {
+	if vhost == host {
+		return true
+	}
+	// .example.com 匹配 example.com 本身及其子域名，不匹配 badexample.com
+	if vhost[0] == '.' && (host == vhost[1:] || strings.HasSuffix(host, vhost)) {
 		return true
 	}
 
@@ -391,5 +406,8 @@ func (p *chainHop) Close() error {
 	if p.options.redisLoader != nil {
 		p.options.redisLoader.Close()
 	}
+	for _, probe := range p.options.probes {
+		probe.Release()
+	}
 	return nil
 }
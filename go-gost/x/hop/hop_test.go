@@ -0,0 +1,24 @@
+package hop
+
+import (
+	"testing"
+
+	"github.com/go-gost/core/chain"
+)
+
+func TestCheckHostWildcardNeedsDotBoundary(t *testing.T) {
+	p := &chainHop{}
+	node := chain.NewNode("n", "127.0.0.1:80", chain.NodeFilterOption(&chain.NodeFilterSettings{Host: ".example.com"}))
+	for host, want := range map[string]bool{
+		"example.com":         true,
+		"a.example.com:443":   true,
+		"a.b.example.com":     true,
+		"badexample.com":      false,
+		"example.com.evil.io": false,
+		"":                    false,
+	} {
+		if got := p.checkHost(host, node); got != want {
+			t.Fatalf("checkHost(%q) = %v, want %v", host, got, want)
+		}
+	}
+}
@@ -315,6 +315,8 @@ func (h *Sniffer) dial(ctx context.Context, conn net.Conn, req *http.Request, ho
 		if marker := node.Marker(); marker != nil {
 			marker.Reset()
 		}
+		// 记录命中的节点，供按路由统计流量
+		ro.Node = node.Name
 
 		if tlsSettings := node.Options().TLS; tlsSettings != nil {
 			cfg := &tls.Config{
@@ -957,6 +959,8 @@ func (h *Sniffer) dialTLS(ctx context.Context, host string, ho *HandleOptions) (
 		if marker := node.Marker(); marker != nil {
 			marker.Reset()
 		}
+		// 记录命中的节点，供按路由统计流量
+		ro.Node = node.Name
 
 		if tlsSettings := node.Options().TLS; tlsSettings != nil {
 			cfg := &tls.Config{
@@ -0,0 +1,329 @@
+// Package mmdb is a minimal reader for MaxMind DB files (GeoLite2/GeoIP2
+// country databases and compatible ones), enough to resolve the country of
+// an IP address without an external dependency.
+package mmdb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
+	"net"
+	"os"
+)
+
+var metadataMarker = []byte("\xab\xcd\xefMaxMind.com")
+
+var errInvalid = errors.New("mmdb: invalid database")
+
+// maxDecodeDepth bounds pointer and container nesting, so a corrupt or
+// self-referencing database cannot exhaust the stack.
+const maxDecodeDepth = 32
+
+// Reader looks up records in an in-memory MaxMind DB.
+type Reader struct {
+	buf        []byte
+	data       []byte
+	nodeCount  uint
+	recordSize uint
+	ipVersion  uint
+	ipv4Start  uint
+}
+
+// Open reads the database at path into memory.
+func Open(path string) (*Reader, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return FromBytes(b)
+}
+
+// FromBytes parses a database held in buf.
+func FromBytes(buf []byte) (*Reader, error) {
+	i := bytes.LastIndex(buf, metadataMarker)
+	if i < 0 {
+		return nil, errors.New("mmdb: metadata not found")
+	}
+	d := decoder{buf: buf[i+len(metadataMarker):]}
+	v, _, err := d.decode(0)
+	if err != nil {
+		return nil, err
+	}
+	md, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, errInvalid
+	}
+
+	r := &Reader{
+		buf:        buf,
+		nodeCount:  toUint(md["node_count"]),
+		recordSize: toUint(md["record_size"]),
+		ipVersion:  toUint(md["ip_version"]),
+	}
+	if r.recordSize != 24 && r.recordSize != 28 && r.recordSize != 32 {
+		return nil, errors.New("mmdb: unsupported record size")
+	}
+	treeSize := r.nodeCount * r.recordSize / 4
+	if treeSize+16 > uint(i) {
+		return nil, errInvalid
+	}
+	r.data = buf[treeSize+16 : i]
+
+	// IPv4 addresses live under ::/96 in IPv6 trees.
+	if r.ipVersion == 6 {
+		node := uint(0)
+		for j := 0; j < 96 && node < r.nodeCount; j++ {
+			node = r.readNode(node, 0)
+		}
+		r.ipv4Start = node
+	}
+	return r, nil
+}
+
+func (r *Reader) readNode(node, bit uint) uint {
+	b := r.buf
+	switch r.recordSize {
+	case 24:
+		off := node*6 + bit*3
+		return uint(b[off])<<16 | uint(b[off+1])<<8 | uint(b[off+2])
+	case 28:
+		off := node * 7
+		if bit == 0 {
+			return (uint(b[off+3])&0xF0)<<20 | uint(b[off])<<16 | uint(b[off+1])<<8 | uint(b[off+2])
+		}
+		return (uint(b[off+3])&0x0F)<<24 | uint(b[off+4])<<16 | uint(b[off+5])<<8 | uint(b[off+6])
+	default:
+		off := node*8 + bit*4
+		return uint(binary.BigEndian.Uint32(b[off : off+4]))
+	}
+}
+
+// Lookup returns the decoded record for ip, or nil when the database has no
+// entry for it.
+func (r *Reader) Lookup(ip net.IP) (interface{}, error) {
+	if r == nil || ip == nil {
+		return nil, nil
+	}
+	node := uint(0)
+	bits := ip.To4()
+	if bits != nil {
+		if r.ipVersion == 6 {
+			node = r.ipv4Start
+		}
+	} else {
+		if r.ipVersion == 4 {
+			return nil, nil
+		}
+		bits = ip.To16()
+	}
+
+	for i := 0; i < len(bits)*8 && node < r.nodeCount; i++ {
+		bit := uint(bits[i>>3]>>(7-uint(i&7))) & 1
+		node = r.readNode(node, bit)
+	}
+	if node == r.nodeCount {
+		return nil, nil
+	}
+	if node < r.nodeCount {
+		return nil, errInvalid
+	}
+	d := decoder{buf: r.data}
+	v, _, err := d.decode(node - r.nodeCount - 16)
+	return v, err
+}
+
+// Country returns the upper-case ISO 3166 code of the country of ip, falling
+// back to the registered country. It is "" when unknown.
+func (r *Reader) Country(ip net.IP) string {
+	v, err := r.Lookup(ip)
+	if err != nil || v == nil {
+		return ""
+	}
+	record, _ := v.(map[string]interface{})
+	for _, key := range []string{"country", "registered_country"} {
+		if c, ok := record[key].(map[string]interface{}); ok {
+			if code, ok := c["iso_code"].(string); ok && code != "" {
+				return code
+			}
+		}
+	}
+	return ""
+}
+
+type decoder struct {
+	buf []byte
+}
+
+const (
+	typeExtended = iota
+	typePointer
+	typeString
+	typeDouble
+	typeBytes
+	typeUint16
+	typeUint32
+	typeMap
+	typeInt32
+	typeUint64
+	typeUint128
+	typeArray
+	typeContainer
+	typeEndMarker
+	typeBool
+	typeFloat
+)
+
+func (d *decoder) take(off, n uint) ([]byte, error) {
+	if off+n > uint(len(d.buf)) || off+n < off {
+		return nil, errInvalid
+	}
+	return d.buf[off : off+n], nil
+}
+
+// decode returns the value at off and the offset following it.
+func (d *decoder) decode(off uint) (interface{}, uint, error) {
+	return d.decodeAt(off, 0)
+}
+
+func (d *decoder) decodeAt(off, depth uint) (interface{}, uint, error) {
+	if depth > maxDecodeDepth {
+		return nil, 0, errInvalid
+	}
+	b, err := d.take(off, 1)
+	if err != nil {
+		return nil, 0, err
+	}
+	ctrl := b[0]
+	off++
+	typ := uint(ctrl >> 5)
+
+	if typ == typePointer {
+		size := uint(ctrl>>3) & 3
+		pb, err := d.take(off, size+1)
+		if err != nil {
+			return nil, 0, err
+		}
+		var p uint
+		switch size {
+		case 0:
+			p = uint(ctrl&7)<<8 | uint(pb[0])
+		case 1:
+			p = (uint(ctrl&7)<<16 | uint(pb[0])<<8 | uint(pb[1])) + 2048
+		case 2:
+			p = (uint(ctrl&7)<<24 | uint(pb[0])<<16 | uint(pb[1])<<8 | uint(pb[2])) + 526336
+		default:
+			p = uint(binary.BigEndian.Uint32(pb))
+		}
+		// The format does not allow a pointer to point at another pointer.
+		if t, err := d.take(p, 1); err != nil || t[0]>>5 == typePointer {
+			return nil, 0, errInvalid
+		}
+		v, _, err := d.decodeAt(p, depth+1)
+		return v, off + size + 1, err
+	}
+
+	if typ == typeExtended {
+		eb, err := d.take(off, 1)
+		if err != nil {
+			return nil, 0, err
+		}
+		typ = 7 + uint(eb[0])
+		off++
+	}
+
+	size := uint(ctrl & 0x1f)
+	if size >= 29 {
+		n := size - 28
+		sb, err := d.take(off, n)
+		if err != nil {
+			return nil, 0, err
+		}
+		off += n
+		switch n {
+		case 1:
+			size = 29 + uint(sb[0])
+		case 2:
+			size = 285 + (uint(sb[0])<<8 | uint(sb[1]))
+		default:
+			size = 65821 + (uint(sb[0])<<16 | uint(sb[1])<<8 | uint(sb[2]))
+		}
+	}
+
+	switch typ {
+	case typeMap:
+		m := make(map[string]interface{}, size)
+		for i := uint(0); i < size; i++ {
+			k, next, err := d.decodeAt(off, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			key, ok := k.(string)
+			if !ok {
+				return nil, 0, errInvalid
+			}
+			v, next, err := d.decodeAt(next, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			m[key] = v
+			off = next
+		}
+		return m, off, nil
+	case typeArray:
+		a := make([]interface{}, 0, size)
+		for i := uint(0); i < size; i++ {
+			v, next, err := d.decodeAt(off, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			a = append(a, v)
+			off = next
+		}
+		return a, off, nil
+	case typeBool:
+		return size != 0, off, nil
+	}
+
+	vb, err := d.take(off, size)
+	if err != nil {
+		return nil, 0, err
+	}
+	off += size
+	switch typ {
+	case typeString:
+		return string(vb), off, nil
+	case typeBytes, typeUint128:
+		return vb, off, nil
+	case typeDouble:
+		if size != 8 {
+			return nil, 0, errInvalid
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(vb)), off, nil
+	case typeFloat:
+		if size != 4 {
+			return nil, 0, errInvalid
+		}
+		return math.Float32frombits(binary.BigEndian.Uint32(vb)), off, nil
+	case typeUint16, typeUint32, typeUint64:
+		var v uint64
+		for _, c := range vb {
+			v = v<<8 | uint64(c)
+		}
+		return v, off, nil
+	case typeInt32:
+		var v uint32
+		for _, c := range vb {
+			v = v<<8 | uint32(c)
+		}
+		return int32(v), off, nil
+	}
+	return nil, 0, errInvalid
+}
+
+func toUint(v interface{}) uint {
+	if n, ok := v.(uint64); ok {
+		return uint(n)
+	}
+	return 0
+}
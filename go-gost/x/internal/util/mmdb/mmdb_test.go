@@ -0,0 +1,269 @@
+package mmdb
+
+import (
+	"encoding/binary"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// fixture 按 MaxMind DB 格式构造一个小型数据库：搜索树、16 字节分隔区、
+// 数据区和元数据。
+type fixture struct {
+	recordSize uint
+	ipVersion  uint
+	nodes      [][2]ref
+	data       []byte
+}
+
+type ref struct {
+	kind int // 0 空, 1 节点, 2 数据
+	v    int
+}
+
+func newFixture(recordSize, ipVersion uint) *fixture {
+	return &fixture{recordSize: recordSize, ipVersion: ipVersion, nodes: make([][2]ref, 1)}
+}
+
+// addData 追加一条记录并返回其在数据区中的偏移
+func (f *fixture) addData(record []byte) int {
+	off := len(f.data)
+	f.data = append(f.data, record...)
+	return off
+}
+
+// insert 将 cidr 指向数据区偏移 off；IPv6 树中的 IPv4 网段位于 ::/96 之下
+func (f *fixture) insert(cidr string, off int) {
+	_, inet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		panic(err)
+	}
+	ones, _ := inet.Mask.Size()
+	ip := inet.IP
+	if v4 := ip.To4(); v4 != nil && f.ipVersion == 6 {
+		ip = append(make(net.IP, 12), v4...)
+		ones += 96
+	}
+	n := 0
+	for i := 0; i < ones; i++ {
+		bit := int(ip[i>>3]>>(7-uint(i&7))) & 1
+		if i == ones-1 {
+			f.nodes[n][bit] = ref{kind: 2, v: off}
+			break
+		}
+		if f.nodes[n][bit].kind != 1 {
+			f.nodes = append(f.nodes, [2]ref{})
+			f.nodes[n][bit] = ref{kind: 1, v: len(f.nodes) - 1}
+		}
+		n = f.nodes[n][bit].v
+	}
+}
+
+func (f *fixture) bytes() []byte {
+	count := uint(len(f.nodes))
+	value := func(r ref) uint {
+		switch r.kind {
+		case 1:
+			return uint(r.v)
+		case 2:
+			return count + 16 + uint(r.v)
+		}
+		return count
+	}
+
+	var tree []byte
+	for _, node := range f.nodes {
+		left, right := value(node[0]), value(node[1])
+		switch f.recordSize {
+		case 24:
+			tree = append(tree, byte(left>>16), byte(left>>8), byte(left), byte(right>>16), byte(right>>8), byte(right))
+		case 28:
+			tree = append(tree, byte(left>>16), byte(left>>8), byte(left),
+				byte(left>>24&0x0F)<<4|byte(right>>24&0x0F),
+				byte(right>>16), byte(right>>8), byte(right))
+		default:
+			tree = binary.BigEndian.AppendUint32(tree, uint32(left))
+			tree = binary.BigEndian.AppendUint32(tree, uint32(right))
+		}
+	}
+
+	buf := append(tree, make([]byte, 16)...)
+	buf = append(buf, f.data...)
+	buf = append(buf, metadataMarker...)
+	return append(buf, encodeMap(
+		"node_count", encodeUint(6, uint64(count)),
+		"record_size", encodeUint(5, uint64(f.recordSize)),
+		"ip_version", encodeUint(5, uint64(f.ipVersion)),
+		"build_epoch", encodeUint64(1700000000),
+	)...)
+}
+
+func encodeString(s string) []byte {
+	return append([]byte{byte(typeString<<5 | len(s))}, s...)
+}
+
+func encodeUint(typ int, v uint64) []byte {
+	var b []byte
+	for ; v > 0; v >>= 8 {
+		b = append([]byte{byte(v)}, b...)
+	}
+	return append([]byte{byte(typ<<5 | len(b))}, b...)
+}
+
+// encodeUint64 使用扩展类型编码
+func encodeUint64(v uint64) []byte {
+	b := binary.BigEndian.AppendUint64(nil, v)
+	return append([]byte{8, typeUint64 - 7}, b...)
+}
+
+func encodeMap(kv ...interface{}) []byte {
+	b := []byte{byte(typeMap<<5 | len(kv)/2)}
+	for i := 0; i < len(kv); i += 2 {
+		b = append(b, encodeString(kv[i].(string))...)
+		b = append(b, kv[i+1].([]byte)...)
+	}
+	return b
+}
+
+func encodePointer(off int) []byte {
+	return []byte{byte(typePointer<<5 | (off>>8)&7), byte(off)}
+}
+
+func countryFixture(recordSize, ipVersion uint) []byte {
+	f := newFixture(recordSize, ipVersion)
+	de := f.addData(encodeMap("country", encodeMap("iso_code", encodeString("DE"))))
+	f.insert("198.51.100.0/24", de)
+	// 仅有注册国家的记录，通过指针复用另一条记录中的国家信息
+	us := f.addData(encodeMap("iso_code", encodeString("US")))
+	registered := f.addData(encodeMap("registered_country", encodePointer(us)))
+	f.insert("203.0.113.128/25", registered)
+	if ipVersion == 6 {
+		f.insert("2001:db8::/32", de)
+	}
+	return f.bytes()
+}
+
+func TestCountry(t *testing.T) {
+	for _, size := range []uint{24, 28, 32} {
+		r, err := FromBytes(countryFixture(size, 6))
+		if err != nil {
+			t.Fatalf("record size %d: %v", size, err)
+		}
+		cases := map[string]string{
+			"198.51.100.7":  "DE",
+			"198.51.101.7":  "",
+			"203.0.113.200": "US",
+			"203.0.113.100": "",
+			"2001:db8::1":   "DE",
+			"2001:db9::1":   "",
+		}
+		for addr, want := range cases {
+			if got := r.Country(net.ParseIP(addr)); got != want {
+				t.Fatalf("record size %d: country of %s = %q, want %q", size, addr, got, want)
+			}
+		}
+	}
+}
+
+func TestCountryIPv4Database(t *testing.T) {
+	r, err := FromBytes(countryFixture(24, 4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := r.Country(net.ParseIP("198.51.100.7")); got != "DE" {
+		t.Fatalf("country = %q, want DE", got)
+	}
+	if got := r.Country(net.ParseIP("2001:db8::1")); got != "" {
+		t.Fatalf("expected no IPv6 lookups in an IPv4 database, got %q", got)
+	}
+}
+
+func TestLookupWithoutDatabase(t *testing.T) {
+	var r *Reader
+	if v, err := r.Lookup(net.ParseIP("198.51.100.7")); v != nil || err != nil {
+		t.Fatalf("expected a nil reader to find nothing, got %v %v", v, err)
+	}
+	if r.Country(net.ParseIP("198.51.100.7")) != "" {
+		t.Fatalf("expected a nil reader to report no country")
+	}
+}
+
+func TestOpen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "country.mmdb")
+	if err := os.WriteFile(path, countryFixture(24, 6), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	r, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := r.Country(net.ParseIP("198.51.100.7")); got != "DE" {
+		t.Fatalf("country = %q, want DE", got)
+	}
+	if _, err := Open(filepath.Join(t.TempDir(), "missing.mmdb")); err == nil {
+		t.Fatalf("expected a missing file to fail")
+	}
+}
+
+func metadataOnly(nodeCount, recordSize uint) []byte {
+	buf := append(make([]byte, 64), metadataMarker...)
+	return append(buf, encodeMap(
+		"node_count", encodeUint(6, uint64(nodeCount)),
+		"record_size", encodeUint(5, uint64(recordSize)),
+		"ip_version", encodeUint(5, 6),
+	)...)
+}
+
+func TestFromBytesRejectsInvalidDatabases(t *testing.T) {
+	cases := map[string][]byte{
+		"no metadata":       []byte("not a database"),
+		"bad metadata":      append(append([]byte(nil), metadataMarker...), encodeString("x")...),
+		"record size":       metadataOnly(1, 16),
+		"short search tree": metadataOnly(1000, 24),
+	}
+	for name, buf := range cases {
+		if _, err := FromBytes(buf); err == nil {
+			t.Fatalf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestLookupReportsCorruptRecords(t *testing.T) {
+	f := newFixture(24, 6)
+	f.addData(encodeMap("country", encodeMap("iso_code", encodeString("DE"))))
+	f.insert("192.0.2.0/24", 5000)
+	r, err := FromBytes(f.bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Lookup(net.ParseIP("192.0.2.1")); err == nil {
+		t.Fatalf("expected a record outside the data section to fail")
+	}
+	if got := r.Country(net.ParseIP("192.0.2.1")); got != "" {
+		t.Fatalf("expected no country for a corrupt record, got %q", got)
+	}
+}
+
+func TestLookupRejectsMalformedPointers(t *testing.T) {
+	// 指针指向另一个指针
+	f := newFixture(24, 6)
+	target := f.addData(encodePointer(0))
+	f.insert("192.0.2.0/24", f.addData(encodePointer(target)))
+	// 映射中的指针指回映射自身，形成环
+	self := len(f.data)
+	f.insert("198.51.100.0/24", f.addData(encodeMap("country", encodePointer(self))))
+
+	r, err := FromBytes(f.bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, addr := range []string{"192.0.2.1", "198.51.100.1"} {
+		if _, err := r.Lookup(net.ParseIP(addr)); err == nil {
+			t.Fatalf("%s: expected a malformed pointer to fail", addr)
+		}
+		if got := r.Country(net.ParseIP(addr)); got != "" {
+			t.Fatalf("%s: expected no country, got %q", addr, got)
+		}
+	}
+}
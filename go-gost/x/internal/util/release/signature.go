@@ -0,0 +1,95 @@
+// Package release 校验在线升级下载的 Agent 二进制的发布签名。
+package release
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// publicKey 发布签名公钥（base64 编码的 ed25519 公钥），构建时注入:
+//
+//	-ldflags "-X github.com/go-gost/x/internal/util/release.publicKey=<base64>"
+//
+// 未注入公钥的构建拒绝任何在线升级；发布流水线在公钥为空时直接失败。
+var publicKey = ""
+
+// maxSignatureSize 签名文件大小上限，防止异常响应占用内存
+const maxSignatureSize = 4096
+
+// PublicKey 解析内置的发布公钥
+func PublicKey() (ed25519.PublicKey, error) {
+	raw := strings.TrimSpace(publicKey)
+	if raw == "" {
+		return nil, fmt.Errorf("当前 Agent 未内置发布公钥，拒绝未签名的升级")
+	}
+	key, err := base64.StdEncoding.DecodeString(raw)
+	if err != nil {
+		return nil, fmt.Errorf("内置发布公钥格式错误: %v", err)
+	}
+	if len(key) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("内置发布公钥长度错误: %d", len(key))
+	}
+	return ed25519.PublicKey(key), nil
+}
+
+// parseSignature 解析签名文件：原始 64 字节 ed25519 签名，或其 base64 文本
+// （发布流程以 openssl pkeyutl 生成并 base64 编码）
+func parseSignature(body []byte) ([]byte, error) {
+	if len(body) == ed25519.SignatureSize {
+		return body, nil
+	}
+	sig, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(string(body)), ""))
+	if err != nil {
+		return nil, fmt.Errorf("签名格式错误: %v", err)
+	}
+	if len(sig) != ed25519.SignatureSize {
+		return nil, fmt.Errorf("签名长度错误: %d", len(sig))
+	}
+	return sig, nil
+}
+
+// fetchSignature 下载签名文件
+func fetchSignature(signatureURL string) ([]byte, error) {
+	if strings.TrimSpace(signatureURL) == "" {
+		return nil, fmt.Errorf("缺少签名地址，拒绝未签名的升级")
+	}
+	resp, err := http.Get(signatureURL)
+	if err != nil {
+		return nil, fmt.Errorf("下载签名失败: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("下载签名失败, HTTP状态码: %d", resp.StatusCode)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxSignatureSize))
+	if err != nil {
+		return nil, fmt.Errorf("读取签名失败: %v", err)
+	}
+	return parseSignature(bytes.TrimSpace(body))
+}
+
+// VerifyFile 使用内置公钥校验已下载的二进制文件
+func VerifyFile(path string, signatureURL string) error {
+	key, err := PublicKey()
+	if err != nil {
+		return err
+	}
+	sig, err := fetchSignature(signatureURL)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("读取升级包失败: %v", err)
+	}
+	if !ed25519.Verify(key, data, sig) {
+		return fmt.Errorf("签名校验失败: 升级包与发布签名不匹配")
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package release
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseSignature(t *testing.T) {
+	raw := bytes.Repeat([]byte{7}, ed25519.SignatureSize)
+	encoded := base64.StdEncoding.EncodeToString(raw)
+
+	for name, body := range map[string][]byte{
+		"raw":     raw,
+		"base64":  []byte(encoded),
+		"wrapped": []byte(encoded[:40] + "\r\n" + encoded[40:] + "\n"),
+	} {
+		sig, err := parseSignature(body)
+		if err != nil || !bytes.Equal(sig, raw) {
+			t.Fatalf("%s: got %x %v", name, sig, err)
+		}
+	}
+
+	// minisign 签名（算法 + 密钥 ID + 签名共 74 字节）不是受支持的格式
+	minisign := "untrusted comment: signature\n" + base64.StdEncoding.EncodeToString(append([]byte("Ed12345678"), raw...))
+	for name, body := range map[string][]byte{
+		"garbage":  []byte("not a signature"),
+		"short":    []byte(base64.StdEncoding.EncodeToString(raw[:32])),
+		"minisign": []byte(minisign),
+	} {
+		if _, err := parseSignature(body); err == nil {
+			t.Fatalf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestVerifyFile(t *testing.T) {
+	key, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "gost")
+	binary := []byte("release build")
+	if err := os.WriteFile(path, binary, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	signatures := map[string]string{
+		"/good.sig":  base64.StdEncoding.EncodeToString(ed25519.Sign(privateKey, binary)),
+		"/other.sig": base64.StdEncoding.EncodeToString(ed25519.Sign(privateKey, []byte("another build"))),
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sig, ok := signatures[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte(sig + "\n"))
+	}))
+	defer server.Close()
+
+	saved := publicKey
+	defer func() { publicKey = saved }()
+
+	publicKey = ""
+	if err := VerifyFile(path, server.URL+"/good.sig"); err == nil || !strings.Contains(err.Error(), "未内置发布公钥") {
+		t.Fatalf("expected a build without a public key to refuse upgrades, got %v", err)
+	}
+
+	publicKey = base64.StdEncoding.EncodeToString(key)
+	if err := VerifyFile(path, server.URL+"/good.sig"); err != nil {
+		t.Fatalf("expected a valid signature to pass, got %v", err)
+	}
+	for _, url := range []string{server.URL + "/other.sig", server.URL + "/missing.sig", ""} {
+		if err := VerifyFile(path, url); err == nil {
+			t.Fatalf("expected %q to be rejected", url)
+		}
+	}
+
+	otherKey, _, _ := ed25519.GenerateKey(rand.Reader)
+	publicKey = base64.StdEncoding.EncodeToString(otherKey)
+	if err := VerifyFile(path, server.URL+"/good.sig"); err == nil {
+		t.Fatalf("expected a signature from another key to be rejected")
+	}
+}
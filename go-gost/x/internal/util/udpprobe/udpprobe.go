@@ -0,0 +1,36 @@
+// Package udpprobe 为 UDP 探测包编号，使超时后迟到的响应不会被计入下一个探测。
+package udpprobe
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// emptyMarker 是空探测包被替换成的带序号数据报的前缀，回显服务会原样返回
+var emptyMarker = []byte("FLVX")
+
+// Tag 返回第 seq 个探测实际发送的数据报及其响应匹配函数。
+//
+// DNS 查询把序号写入事务 ID，空探测包发送带序号的标记；其余自定义内容无法
+// 在不破坏目标协议的前提下编号，match 为 nil，调用方需在发送前丢弃残留响应。
+func Tag(payload []byte, port int, seq uint16) (packet []byte, match func(reply []byte) bool) {
+	switch {
+	case isDNSQuery(payload, port):
+		packet = append([]byte(nil), payload...)
+		binary.BigEndian.PutUint16(packet, seq)
+		return packet, func(reply []byte) bool {
+			return len(reply) >= 12 && binary.BigEndian.Uint16(reply) == seq && reply[2]&0x80 != 0
+		}
+	case len(payload) == 0:
+		packet = binary.BigEndian.AppendUint16(append([]byte(nil), emptyMarker...), seq)
+		return packet, func(reply []byte) bool {
+			return bytes.Equal(reply, packet)
+		}
+	}
+	return payload, nil
+}
+
+// isDNSQuery 判断发往 53 端口的内容是否为 DNS 查询报文
+func isDNSQuery(payload []byte, port int) bool {
+	return port == 53 && len(payload) >= 12 && payload[2]&0x80 == 0
+}
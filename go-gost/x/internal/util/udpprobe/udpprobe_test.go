@@ -0,0 +1,55 @@
+package udpprobe
+
+import (
+	"bytes"
+	"testing"
+)
+
+func dnsQuery() []byte {
+	return []byte{0x46, 0x4c, 0x01, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01, 0x00, 0x01}
+}
+
+func TestTagDNSQuery(t *testing.T) {
+	query := dnsQuery()
+	first, matchFirst := Tag(query, 53, 1)
+	second, matchSecond := Tag(query, 53, 2)
+	if first[0] != 0 || first[1] != 1 || second[1] != 2 || !bytes.Equal(first[2:], query[2:]) {
+		t.Fatalf("expected the sequence in the transaction ID, got %x %x", first, second)
+	}
+	if query[0] != 0x46 {
+		t.Fatalf("expected the caller's payload to stay untouched")
+	}
+
+	reply := append([]byte(nil), first...)
+	reply[2] |= 0x80
+	// 第 1 个探测的迟到响应不能算作第 2 个探测的响应
+	if !matchFirst(reply) || matchSecond(reply) {
+		t.Fatalf("expected the reply to match only its own probe")
+	}
+	if matchFirst(first) {
+		t.Fatalf("expected a query echoed back not to count as a reply")
+	}
+}
+
+func TestTagEmptyPayload(t *testing.T) {
+	first, matchFirst := Tag(nil, 7, 1)
+	second, matchSecond := Tag(nil, 7, 2)
+	if bytes.Equal(first, second) {
+		t.Fatalf("expected distinct datagrams per probe")
+	}
+	if !matchFirst(first) || matchFirst(second) || !matchSecond(second) {
+		t.Fatalf("expected echoes to match only their own probe")
+	}
+}
+
+func TestTagCustomPayload(t *testing.T) {
+	payload := []byte{0xff, 0xff, 0xff, 0xff, 0x54}
+	packet, match := Tag(payload, 27015, 3)
+	if !bytes.Equal(packet, payload) || match != nil {
+		t.Fatalf("expected a custom payload to be sent as is")
+	}
+	// 发往 53 端口的非查询内容同样原样发送
+	if _, match := Tag(payload, 53, 3); match != nil {
+		t.Fatalf("expected a non-DNS payload on port 53 to stay untagged")
+	}
+}
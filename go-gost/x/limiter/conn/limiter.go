@@ -42,6 +42,14 @@ func newLimiterGroup(limiters ...limiter.Limiter) *limiterGroup {
 }
 
 func (l *limiterGroup) Allow(n int) (b bool) {
+	if n <= 0 {
+		// 释放名额时必须通知每个限流器，不能因某个限流器返回 false 而提前结束
+		for _, lim := range l.limiters {
+			lim.Allow(n)
+		}
+		return true
+	}
+
 	var i int
 
 	for i = range l.limiters {
@@ -49,7 +57,7 @@ func (l *limiterGroup) Allow(n int) (b bool) {
 			break
 		}
 	}
-	if !b && i > 0 && n > 0 {
+	if !b && i > 0 {
 		for i := range l.limiters[:i] {
 			l.limiters[i].Allow(-n)
 		}
@@ -0,0 +1,20 @@
+package conn
+
+import "testing"
+
+func TestLimiterGroupReleaseReachesEveryLimiter(t *testing.T) {
+	small, large := NewLimiter(5).(*llimiter), NewLimiter(10).(*llimiter)
+	group := newLimiterGroup(small, large)
+	for i := 0; i < 3; i++ {
+		if !group.Allow(1) {
+			t.Fatalf("expected connection %d to be admitted", i+1)
+		}
+	}
+
+	// 限额下调后较小的限流器释放时仍超限返回 false，较大的限流器也要归还名额
+	small.limit = 1
+	group.Allow(-1)
+	if small.current != 2 || large.current != 2 {
+		t.Fatalf("expected the release to reach every limiter, got %d %d", small.current, large.current)
+	}
+}
@@ -0,0 +1,123 @@
+package conn
+
+import (
+	"sync"
+
+	limiter "github.com/go-gost/core/limiter/conn"
+)
+
+// SwappableConnLimiter 是可在运行中替换规则的连接数限流器。
+//
+// 连接建立时从 Limiter(key) 取得的对象会一直保留到连接关闭，直接替换底层限流器时，
+// 旧连接关闭会归还到已废弃的实例，新实例的计数从零开始，限额因此被突破。
+// 这里按 key 记录存活连接数：释放总是归还到当前生效的限流器，替换时把仍存活的连接
+// 计入新限流器；新限额低于存活连接数时，超出部分记为未计入，连接关闭时先行抵扣。
+type SwappableConnLimiter struct {
+	mu        sync.Mutex
+	current   limiter.ConnLimiter
+	live      map[string]int
+	uncharged map[string]int
+}
+
+func NewSwappableConnLimiter(lim limiter.ConnLimiter) *SwappableConnLimiter {
+	return &SwappableConnLimiter{
+		current:   lim,
+		live:      make(map[string]int),
+		uncharged: make(map[string]int),
+	}
+}
+
+// Swap 替换生效的限流器，并把存活连接计入新限流器
+func (s *SwappableConnLimiter) Swap(lim limiter.ConnLimiter) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.current = lim
+	for key, n := range s.live {
+		charged := 0
+		if l := s.limiterLocked(key); l != nil {
+			if l.Allow(n) {
+				charged = n
+			} else {
+				for charged < n && l.Allow(1) {
+					charged++
+				}
+			}
+		}
+		s.setUncharged(key, n-charged)
+	}
+}
+
+func (s *SwappableConnLimiter) Limiter(key string) limiter.Limiter {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.limiterLocked(key) == nil {
+		return nil
+	}
+	return &swappableLimit{s: s, key: key}
+}
+
+func (s *SwappableConnLimiter) limiterLocked(key string) limiter.Limiter {
+	if s.current == nil {
+		return nil
+	}
+	return s.current.Limiter(key)
+}
+
+func (s *SwappableConnLimiter) setUncharged(key string, n int) {
+	if n > 0 {
+		s.uncharged[key] = n
+	} else {
+		delete(s.uncharged, key)
+	}
+}
+
+func (s *SwappableConnLimiter) allow(key string, n int) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	l := s.limiterLocked(key)
+	if n > 0 {
+		if l != nil && !l.Allow(n) {
+			return false
+		}
+		if l == nil {
+			// 替换后该 key 不再受限，连接不计入任何限流器
+			s.setUncharged(key, s.uncharged[key]+n)
+		}
+		s.live[key] += n
+		return true
+	}
+
+	release := -n
+	if u := s.uncharged[key]; u > 0 {
+		m := min(u, release)
+		s.setUncharged(key, u-m)
+		release -= m
+	}
+	if release > 0 && l != nil {
+		l.Allow(-release)
+	}
+	if s.live[key] += n; s.live[key] <= 0 {
+		delete(s.live, key)
+	}
+	return true
+}
+
+type swappableLimit struct {
+	s   *SwappableConnLimiter
+	key string
+}
+
+func (l *swappableLimit) Allow(n int) bool {
+	return l.s.allow(l.key, n)
+}
+
+func (l *swappableLimit) Limit() int {
+	l.s.mu.Lock()
+	defer l.s.mu.Unlock()
+	if lim := l.s.limiterLocked(l.key); lim != nil {
+		return lim.Limit()
+	}
+	return 0
+}
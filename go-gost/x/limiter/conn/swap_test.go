@@ -0,0 +1,87 @@
+package conn
+
+import (
+	"testing"
+
+	limiter "github.com/go-gost/core/limiter/conn"
+	xlogger "github.com/go-gost/x/logger"
+)
+
+func newTestLimiter(limits ...string) limiter.ConnLimiter {
+	return NewConnLimiter(LimitsOption(limits...), LoggerOption(xlogger.Nop()))
+}
+
+func allowN(t *testing.T, lim *SwappableConnLimiter, key string, n int) {
+	t.Helper()
+	l := lim.Limiter(key)
+	if l == nil {
+		t.Fatalf("expected %s to be limited", key)
+	}
+	for i := 0; i < n; i++ {
+		if !l.Allow(1) {
+			t.Fatalf("connection %d of %s rejected", i+1, key)
+		}
+	}
+}
+
+func TestSwappableConnLimiterKeepsLiveConnections(t *testing.T) {
+	lim := NewSwappableConnLimiter(newTestLimiter("$ 3"))
+	old := lim.Limiter("10.0.0.1")
+	allowN(t, lim, "10.0.0.1", 2)
+
+	// 规则更新后，已有的 2 个连接仍占用新限额
+	lim.Swap(newTestLimiter("$ 3"))
+	if !lim.Limiter("10.0.0.2").Allow(1) {
+		t.Fatalf("expected a third connection to fit")
+	}
+	if lim.Limiter("10.0.0.2").Allow(1) {
+		t.Fatalf("expected live connections to count against the new limiter")
+	}
+
+	// 旧连接关闭后归还到新限流器
+	old.Allow(-1)
+	if !lim.Limiter("10.0.0.3").Allow(1) {
+		t.Fatalf("expected a released connection to free a slot in the new limiter")
+	}
+	if got := lim.Limiter("10.0.0.3").Limit(); got != 3 {
+		t.Fatalf("limit = %d, want 3", got)
+	}
+}
+
+func TestSwappableConnLimiterLowersLimitBelowLiveCount(t *testing.T) {
+	lim := NewSwappableConnLimiter(newTestLimiter("$ 5"))
+	l := lim.Limiter("10.0.0.1")
+	allowN(t, lim, "10.0.0.1", 4)
+
+	lim.Swap(newTestLimiter("$ 2"))
+	if lim.Limiter("10.0.0.1").Allow(1) {
+		t.Fatalf("expected the lowered limit to be full")
+	}
+	// 4 个存活连接中 2 个未计入新限额，先关闭的连接抵扣未计入部分
+	l.Allow(-1)
+	l.Allow(-1)
+	if lim.Limiter("10.0.0.1").Allow(1) {
+		t.Fatalf("expected the limit to stay full while 2 connections remain")
+	}
+	l.Allow(-1)
+	if !lim.Limiter("10.0.0.1").Allow(1) {
+		t.Fatalf("expected a slot once fewer connections than the limit remain")
+	}
+}
+
+func TestSwappableConnLimiterRemovedLimit(t *testing.T) {
+	lim := NewSwappableConnLimiter(newTestLimiter("$ 1"))
+	l := lim.Limiter("10.0.0.1")
+	allowN(t, lim, "10.0.0.1", 1)
+
+	lim.Swap(newTestLimiter())
+	if lim.Limiter("10.0.0.1") != nil {
+		t.Fatalf("expected no limiter without limits")
+	}
+	l.Allow(-1)
+
+	lim.Swap(newTestLimiter("$ 1"))
+	if !lim.Limiter("10.0.0.1").Allow(1) {
+		t.Fatalf("expected a closed connection not to be charged again")
+	}
+}
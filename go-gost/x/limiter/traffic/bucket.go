@@ -0,0 +1,129 @@
+package traffic
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	limiter "github.com/go-gost/core/limiter/traffic"
+	"golang.org/x/time/rate"
+)
+
+// SharedBucketPrefix marks a limit key naming a token bucket shared by every
+// service whose traffic limiter declares it, e.g. "@user_5 10MB 20MB 4MB"
+// (input rate, output rate, optional burst). Shared buckets apply at service
+// scope on top of the "$" limit.
+const SharedBucketPrefix = "@"
+
+// sharedBucketIdleTTL is how long a bucket no limiter declares any more is
+// kept before it is evicted.
+var sharedBucketIdleTTL = time.Minute
+
+// sharedBucket is a named pair of token buckets. Buckets live in a
+// process-wide table and outlive the limiters declaring them, so replacing a
+// limiter only adjusts the rates and keeps the tokens already spent. A bucket
+// is evicted once no limiter has declared it for sharedBucketIdleTTL.
+type sharedBucket struct {
+	in  *rate.Limiter
+	out *rate.Limiter
+	// owners are the limiters declaring the bucket.
+	owners map[interface{}]struct{}
+	evict  *time.Timer
+}
+
+var sharedBuckets = struct {
+	sync.Mutex
+	m map[string]*sharedBucket
+}{m: make(map[string]*sharedBucket)}
+
+func isSharedBucketKey(key string) bool {
+	return strings.HasPrefix(key, SharedBucketPrefix) && len(key) > len(SharedBucketPrefix)
+}
+
+// declareSharedBucket creates the bucket or applies new rates to it, and
+// records owner as declaring it.
+func declareSharedBucket(name string, value limitValue, owner interface{}) {
+	sharedBuckets.Lock()
+	defer sharedBuckets.Unlock()
+
+	b := sharedBuckets.m[name]
+	if b == nil {
+		b = &sharedBucket{owners: make(map[interface{}]struct{})}
+		sharedBuckets.m[name] = b
+	}
+	b.owners[owner] = struct{}{}
+	if b.evict != nil {
+		b.evict.Stop()
+		b.evict = nil
+	}
+	b.in = setBucketRate(b.in, value.in, value.burst)
+	b.out = setBucketRate(b.out, value.out, value.burst)
+}
+
+// releaseSharedBuckets drops owner from the named buckets. Buckets left
+// without owners are evicted after sharedBucketIdleTTL unless declared again,
+// so a limiter that is replaced keeps its buckets.
+func releaseSharedBuckets(names []string, owner interface{}) {
+	sharedBuckets.Lock()
+	defer sharedBuckets.Unlock()
+
+	for _, name := range names {
+		b := sharedBuckets.m[name]
+		if b == nil {
+			continue
+		}
+		delete(b.owners, owner)
+		if len(b.owners) > 0 || b.evict != nil {
+			continue
+		}
+		name := name
+		b.evict = time.AfterFunc(sharedBucketIdleTTL, func() {
+			sharedBuckets.Lock()
+			defer sharedBuckets.Unlock()
+			if sharedBuckets.m[name] == b && len(b.owners) == 0 {
+				delete(sharedBuckets.m, name)
+			}
+		})
+	}
+}
+
+func setBucketRate(lim *rate.Limiter, r, burst int) *rate.Limiter {
+	if r <= 0 {
+		return nil
+	}
+	if burst <= 0 {
+		burst = r
+	}
+	if lim == nil {
+		return rate.NewLimiter(rate.Limit(r), burst)
+	}
+	lim.SetLimit(rate.Limit(r))
+	lim.SetBurst(burst)
+	return lim
+}
+
+// sharedBucketLimiters returns the input or output side of the named buckets.
+func sharedBucketLimiters(names []string, in bool) []limiter.Limiter {
+	if len(names) == 0 {
+		return nil
+	}
+
+	sharedBuckets.Lock()
+	defer sharedBuckets.Unlock()
+
+	var lims []limiter.Limiter
+	for _, name := range names {
+		b := sharedBuckets.m[name]
+		if b == nil {
+			continue
+		}
+		lim := b.out
+		if in {
+			lim = b.in
+		}
+		if lim != nil {
+			lims = append(lims, &llimiter{limiter: lim})
+		}
+	}
+	return lims
+}
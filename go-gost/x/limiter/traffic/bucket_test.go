@@ -0,0 +1,110 @@
+package traffic
+
+import (
+	"testing"
+	"time"
+
+	xlogger "github.com/go-gost/x/logger"
+)
+
+// testBucketName 返回一个测试结束后从全局表中移除的共享桶名称
+func testBucketName(t *testing.T, name string) string {
+	t.Cleanup(func() {
+		sharedBuckets.Lock()
+		delete(sharedBuckets.m, name)
+		sharedBuckets.Unlock()
+	})
+	return name
+}
+
+func TestSharedBucketKeepsTokensOnRateUpdate(t *testing.T) {
+	name := testBucketName(t, "@test_rate_update")
+	declareSharedBucket(name, limitValue{in: 1000, out: 2000}, t)
+
+	in := sharedBucketLimiters([]string{name}, true)
+	out := sharedBucketLimiters([]string{name}, false)
+	if len(in) != 1 || len(out) != 1 || in[0].Limit() != 1000 || out[0].Limit() != 2000 {
+		t.Fatalf("unexpected buckets %v %v", in, out)
+	}
+	bucket := in[0].(*llimiter).limiter
+	if !bucket.AllowN(time.Now(), 1000) {
+		t.Fatalf("expected a full bucket to grant its burst")
+	}
+
+	// 替换限流器时只调整速率，已消耗的令牌不会被重新填满
+	declareSharedBucket(name, limitValue{in: 3000, out: 4000}, t)
+	in = sharedBucketLimiters([]string{name}, true)
+	if len(in) != 1 || in[0].(*llimiter).limiter != bucket {
+		t.Fatalf("expected the bucket to be reused")
+	}
+	if bucket.Limit() != 3000 || bucket.Burst() != 3000 {
+		t.Fatalf("expected the new rate, got %v/%d", bucket.Limit(), bucket.Burst())
+	}
+	if bucket.AllowN(time.Now(), 1000) {
+		t.Fatalf("expected spent tokens to stay spent after a rate update")
+	}
+	if got := sharedBucketLimiters([]string{name}, false)[0].Limit(); got != 4000 {
+		t.Fatalf("output rate = %d, want 4000", got)
+	}
+}
+
+func TestSharedBucketRemovesDisabledSide(t *testing.T) {
+	name := testBucketName(t, "@test_disabled_side")
+	declareSharedBucket(name, limitValue{in: 1000, out: 1000, burst: 500}, t)
+	if got := sharedBucketLimiters([]string{name}, true)[0].(*llimiter).limiter.Burst(); got != 500 {
+		t.Fatalf("burst = %d, want 500", got)
+	}
+
+	declareSharedBucket(name, limitValue{in: 1000}, t)
+	if got := sharedBucketLimiters([]string{name}, false); len(got) != 0 {
+		t.Fatalf("expected no output bucket without an output rate, got %v", got)
+	}
+	if got := sharedBucketLimiters([]string{name, "@test_undeclared"}, true); len(got) != 1 {
+		t.Fatalf("expected undeclared buckets to be skipped, got %v", got)
+	}
+}
+
+func TestSharedBucketEvictedWhenNoLimiterDeclaresIt(t *testing.T) {
+	ttl := sharedBucketIdleTTL
+	sharedBucketIdleTTL = 50 * time.Millisecond
+	t.Cleanup(func() { sharedBucketIdleTTL = ttl })
+	name := testBucketName(t, "user_evict")
+	declared := func() bool {
+		sharedBuckets.Lock()
+		defer sharedBuckets.Unlock()
+		return sharedBuckets.m[name] != nil
+	}
+
+	old := NewTrafficLimiter(LimitsOption("@user_evict 1KB 1KB"), LoggerOption(xlogger.Nop()))
+	bucket := sharedBucketLimiters([]string{name}, true)[0].(*llimiter).limiter
+
+	// 替换限流器时先关闭旧的，新限流器在淘汰前重新声明并沿用同一个桶
+	old.(*trafficLimiter).Close()
+	replaced := NewTrafficLimiter(LimitsOption("@user_evict 2KB 2KB"), LoggerOption(xlogger.Nop()))
+	time.Sleep(3 * sharedBucketIdleTTL)
+	if !declared() || sharedBucketLimiters([]string{name}, true)[0].(*llimiter).limiter != bucket {
+		t.Fatalf("expected a replaced limiter to keep its bucket")
+	}
+
+	replaced.(*trafficLimiter).Close()
+	time.Sleep(3 * sharedBucketIdleTTL)
+	if declared() {
+		t.Fatalf("expected the bucket to be evicted once its limiter was removed")
+	}
+}
+
+func TestSharedBucketReleasedWhenDroppedOnReload(t *testing.T) {
+	ttl := sharedBucketIdleTTL
+	sharedBucketIdleTTL = 50 * time.Millisecond
+	t.Cleanup(func() { sharedBucketIdleTTL = ttl })
+	kept := testBucketName(t, "user_kept")
+	dropped := testBucketName(t, "user_dropped")
+
+	declareSharedBucket(kept, limitValue{in: 1000}, t)
+	declareSharedBucket(dropped, limitValue{in: 1000}, t)
+	releaseSharedBuckets([]string{dropped}, t)
+	time.Sleep(3 * sharedBucketIdleTTL)
+	if got := sharedBucketLimiters([]string{kept, dropped}, true); len(got) != 1 {
+		t.Fatalf("expected only the released bucket to be evicted, got %v", got)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"context"
 	"io"
 	"net"
+	"slices"
 	"strings"
 	"sync"
 	"time"
@@ -26,6 +27,10 @@ const (
 const (
 	defaultExpiration = 15 * time.Second
 	cleanupInterval   = 30 * time.Second
+	// cidrExpiration is how long a per-IP limiter generated from a CIDR entry
+	// stays cached after its last new connection. Catch-all entries such as
+	// 0.0.0.0/0 would otherwise keep one limiter per client IP forever.
+	cidrExpiration = 10 * time.Minute
 )
 
 type options struct {
@@ -76,8 +81,9 @@ func LoggerOption(logger logger.Logger) Option {
 }
 
 type limitValue struct {
-	in  int
-	out int
+	in    int
+	out   int
+	burst int
 }
 
 type trafficLimiter struct {
@@ -87,8 +93,11 @@ type trafficLimiter struct {
 	connInLimits  *cache.Cache
 	connOutLimits *cache.Cache
 	// service level in/out limits
-	inLimits   *cache.Cache
-	outLimits  *cache.Cache
+	inLimits  *cache.Cache
+	outLimits *cache.Cache
+	// names of the shared buckets declared by this limiter
+	buckets    []string
+	closed     bool
 	mu         sync.RWMutex
 	cancelFunc context.CancelFunc
 	options    options
@@ -130,10 +139,7 @@ func (l *trafficLimiter) In(ctx context.Context, key string, opts ...limiter.Opt
 
 	switch options.Scope {
 	case limiter.ScopeService:
-		if lim, ok := l.inLimits.Get(ServiceLimitKey); ok && lim != nil {
-			return lim.(traffic.Limiter)
-		}
-		return nil
+		return l.serviceLimiter(l.inLimits, true)
 
 	case limiter.ScopeClient:
 		if lim, ok := l.inLimits.Get(key); ok && lim != nil {
@@ -169,10 +175,14 @@ func (l *trafficLimiter) In(ctx context.Context, key string, opts ...limiter.Opt
 
 	host, _, _ := net.SplitHostPort(key)
 	// IP level limiter
-	if lim, ok := l.inLimits.Get(host); ok {
+	if lim, exp, ok := l.inLimits.GetWithExpiration(host); ok {
 		// cached IP limiter
 		if lim != nil {
 			lims = append(lims, lim.(traffic.Limiter))
+			// limiters generated from a CIDR entry expire once the IP goes idle
+			if !exp.IsZero() {
+				l.inLimits.Set(host, lim, cidrExpiration)
+			}
 		}
 	} else {
 		l.mu.RLock()
@@ -184,7 +194,7 @@ func (l *trafficLimiter) In(ctx context.Context, key string, opts ...limiter.Opt
 			if v, _ := p[0].(*cidrLimitEntry); v != nil {
 				if lim := v.generator.In(); lim != nil {
 					lims = append(lims, lim)
-					l.inLimits.Set(host, lim, cache.NoExpiration)
+					l.inLimits.Set(host, lim, cidrExpiration)
 				}
 			}
 		}
@@ -212,10 +222,7 @@ func (l *trafficLimiter) Out(ctx context.Context, key string, opts ...limiter.Op
 
 	switch options.Scope {
 	case limiter.ScopeService:
-		if lim, ok := l.outLimits.Get(ServiceLimitKey); ok && lim != nil {
-			return lim.(traffic.Limiter)
-		}
-		return nil
+		return l.serviceLimiter(l.outLimits, false)
 
 	case limiter.ScopeClient:
 		if lim, ok := l.outLimits.Get(key); ok && lim != nil {
@@ -251,10 +258,13 @@ func (l *trafficLimiter) Out(ctx context.Context, key string, opts ...limiter.Op
 
 	host, _, _ := net.SplitHostPort(key)
 	// IP level limiter
-	if lim, ok := l.outLimits.Get(host); ok {
+	if lim, exp, ok := l.outLimits.GetWithExpiration(host); ok {
 		if lim != nil {
 			// cached IP level limiter
 			lims = append(lims, lim.(traffic.Limiter))
+			if !exp.IsZero() {
+				l.outLimits.Set(host, lim, cidrExpiration)
+			}
 		}
 	} else {
 		l.mu.RLock()
@@ -266,7 +276,7 @@ func (l *trafficLimiter) Out(ctx context.Context, key string, opts ...limiter.Op
 			if v, _ := p[0].(*cidrLimitEntry); v != nil {
 				if lim := v.generator.Out(); lim != nil {
 					lims = append(lims, lim)
-					l.outLimits.Set(host, lim, cache.NoExpiration)
+					l.outLimits.Set(host, lim, cidrExpiration)
 				}
 			}
 		}
@@ -284,6 +294,28 @@ func (l *trafficLimiter) Out(ctx context.Context, key string, opts ...limiter.Op
 	return lim
 }
 
+// serviceLimiter combines the "$" limit with the shared buckets declared by
+// this limiter.
+func (l *trafficLimiter) serviceLimiter(limits *cache.Cache, in bool) traffic.Limiter {
+	l.mu.RLock()
+	buckets := l.buckets
+	l.mu.RUnlock()
+
+	var lims []traffic.Limiter
+	if lim, ok := limits.Get(ServiceLimitKey); ok && lim != nil {
+		lims = append(lims, lim.(traffic.Limiter))
+	}
+	lims = append(lims, sharedBucketLimiters(buckets, in)...)
+
+	switch len(lims) {
+	case 0:
+		return nil
+	case 1:
+		return lims[0]
+	}
+	return newLimiterGroup(lims...)
+}
+
 func (l *trafficLimiter) periodReload(ctx context.Context) error {
 	period := l.options.period
 	if period < time.Second {
@@ -378,6 +410,18 @@ func (l *trafficLimiter) reload(ctx context.Context) error {
 		delete(values, ConnLimitKey)
 	}
 
+	// shared buckets
+	var buckets []string
+	for key, value := range values {
+		if !isSharedBucketKey(key) {
+			continue
+		}
+		name := strings.TrimPrefix(key, SharedBucketPrefix)
+		declareSharedBucket(name, value, l)
+		buckets = append(buckets, name)
+		delete(values, key)
+	}
+
 	cidrGenerators := cidranger.NewPCTrieRanger()
 	// IP/CIDR level limiters
 	{
@@ -403,6 +447,8 @@ func (l *trafficLimiter) reload(ctx context.Context) error {
 					l.inLimits.Delete(key)
 				} else {
 					lim.Set(value.in)
+					// an explicit IP entry never expires, even if it was cached from a CIDR
+					l.inLimits.Set(key, lim, cache.NoExpiration)
 				}
 				delete(inLimits, key)
 			} else {
@@ -417,6 +463,8 @@ func (l *trafficLimiter) reload(ctx context.Context) error {
 					l.outLimits.Delete(key)
 				} else {
 					lim.Set(value.out)
+					// an explicit IP entry never expires, even if it was cached from a CIDR
+					l.outLimits.Set(key, lim, cache.NoExpiration)
 				}
 				delete(outLimits, key)
 			} else {
@@ -465,10 +513,23 @@ func (l *trafficLimiter) reload(ctx context.Context) error {
 	}
 
 	l.mu.Lock()
-	defer l.mu.Unlock()
-
+	if l.closed {
+		// a reload racing with Close must not keep the buckets declared
+		l.mu.Unlock()
+		releaseSharedBuckets(buckets, l)
+		return nil
+	}
+	var dropped []string
+	for _, name := range l.buckets {
+		if !slices.Contains(buckets, name) {
+			dropped = append(dropped, name)
+		}
+	}
 	l.cidrGenerators = cidrGenerators
+	l.buckets = buckets
+	l.mu.Unlock()
 
+	releaseSharedBuckets(dropped, l)
 	return nil
 }
 
@@ -476,11 +537,11 @@ func (l *trafficLimiter) load(ctx context.Context) (values map[string]limitValue
 	values = make(map[string]limitValue)
 
 	for _, v := range l.options.limits {
-		key, in, out := l.parseLimit(v)
+		key, value := l.parseLimit(v)
 		if key == "" {
 			continue
 		}
-		values[key] = limitValue{in: in, out: out}
+		values[key] = value
 	}
 
 	if l.options.fileLoader != nil {
@@ -490,11 +551,11 @@ func (l *trafficLimiter) load(ctx context.Context) (values map[string]limitValue
 				l.options.logger.Warnf("file loader: %v", er)
 			}
 			for _, s := range list {
-				key, in, out := l.parseLimit(l.parseLine(s))
+				key, value := l.parseLimit(l.parseLine(s))
 				if key == "" {
 					continue
 				}
-				values[key] = limitValue{in: in, out: out}
+				values[key] = value
 			}
 		} else {
 			r, er := l.options.fileLoader.Load(ctx)
@@ -503,11 +564,11 @@ func (l *trafficLimiter) load(ctx context.Context) (values map[string]limitValue
 			}
 			patterns, _ := l.parsePatterns(r)
 			for _, s := range patterns {
-				key, in, out := l.parseLimit(l.parseLine(s))
+				key, value := l.parseLimit(l.parseLine(s))
 				if key == "" {
 					continue
 				}
-				values[key] = limitValue{in: in, out: out}
+				values[key] = value
 			}
 		}
 	}
@@ -518,11 +579,11 @@ func (l *trafficLimiter) load(ctx context.Context) (values map[string]limitValue
 				l.options.logger.Warnf("redis loader: %v", er)
 			}
 			for _, s := range list {
-				key, in, out := l.parseLimit(l.parseLine(s))
+				key, value := l.parseLimit(l.parseLine(s))
 				if key == "" {
 					continue
 				}
-				values[key] = limitValue{in: in, out: out}
+				values[key] = value
 			}
 		} else {
 			r, er := l.options.redisLoader.Load(ctx)
@@ -531,11 +592,11 @@ func (l *trafficLimiter) load(ctx context.Context) (values map[string]limitValue
 			}
 			patterns, _ := l.parsePatterns(r)
 			for _, s := range patterns {
-				key, in, out := l.parseLimit(l.parseLine(s))
+				key, value := l.parseLimit(l.parseLine(s))
 				if key == "" {
 					continue
 				}
-				values[key] = limitValue{in: in, out: out}
+				values[key] = value
 			}
 		}
 	}
@@ -546,11 +607,11 @@ func (l *trafficLimiter) load(ctx context.Context) (values map[string]limitValue
 		}
 		patterns, _ := l.parsePatterns(r)
 		for _, s := range patterns {
-			key, in, out := l.parseLimit(l.parseLine(s))
+			key, value := l.parseLimit(l.parseLine(s))
 			if key == "" {
 				continue
 			}
-			values[key] = limitValue{in: in, out: out}
+			values[key] = value
 		}
 	}
 
@@ -581,7 +642,9 @@ func (l *trafficLimiter) parseLine(s string) string {
 	return strings.TrimSpace(s)
 }
 
-func (l *trafficLimiter) parseLimit(s string) (key string, in, out int) {
+// parseLimit parses "<key> <in> [<out> [<burst>]]". The burst is only used by
+// shared buckets; other limits burst up to one second of traffic.
+func (l *trafficLimiter) parseLimit(s string) (key string, value limitValue) {
 	s = strings.Replace(s, "\t", " ", -1)
 	s = strings.TrimSpace(s)
 	if s == "" {
@@ -600,11 +663,16 @@ func (l *trafficLimiter) parseLimit(s string) (key string, in, out int) {
 
 	key = ss[0]
 	if v, _ := units.ParseBase2Bytes(ss[1]); v > 0 {
-		in = int(v)
+		value.in = int(v)
 	}
 	if len(ss) > 2 {
 		if v, _ := units.ParseBase2Bytes(ss[2]); v > 0 {
-			out = int(v)
+			value.out = int(v)
+		}
+	}
+	if len(ss) > 3 {
+		if v, _ := units.ParseBase2Bytes(ss[3]); v > 0 {
+			value.burst = int(v)
 		}
 	}
 
@@ -613,6 +681,14 @@ func (l *trafficLimiter) parseLimit(s string) (key string, in, out int) {
 
 func (l *trafficLimiter) Close() error {
 	l.cancelFunc()
+
+	l.mu.Lock()
+	l.closed = true
+	buckets := l.buckets
+	l.buckets = nil
+	l.mu.Unlock()
+	releaseSharedBuckets(buckets, l)
+
 	if l.options.fileLoader != nil {
 		l.options.fileLoader.Close()
 	}
@@ -2,6 +2,7 @@ package registry
 
 import (
 	"context"
+	"strings"
 
 	"github.com/go-gost/core/limiter"
 	"github.com/go-gost/core/limiter/conn"
@@ -17,11 +18,21 @@ func (r *trafficLimiterRegistry) Register(name string, v traffic.TrafficLimiter)
 	return r.registry.Register(name, v)
 }
 
+// Get resolves name lazily; see connLimiterRegistry.Get for name lists. A
+// service may stack e.g. a per-tunnel speed limit and a per-user pool.
 func (r *trafficLimiterRegistry) Get(name string) traffic.TrafficLimiter {
-	if name != "" {
-		return &trafficLimiterWrapper{name: name, r: r}
+	names := splitLimiterNames(name)
+	switch len(names) {
+	case 0:
+		return nil
+	case 1:
+		return &trafficLimiterWrapper{name: names[0], r: r}
+	}
+	group := make(trafficLimiterGroup, 0, len(names))
+	for _, n := range names {
+		group = append(group, &trafficLimiterWrapper{name: n, r: r})
 	}
-	return nil
+	return group
 }
 
 func (r *trafficLimiterRegistry) get(name string) traffic.TrafficLimiter {
@@ -57,11 +68,22 @@ func (r *connLimiterRegistry) Register(name string, v conn.ConnLimiter) error {
 	return r.registry.Register(name, v)
 }
 
+// Get resolves name lazily. A comma separated list stacks several limiters on
+// one service, e.g. a per-forward and a per-user cap; a connection must fit
+// under all of them.
 func (r *connLimiterRegistry) Get(name string) conn.ConnLimiter {
-	if name != "" {
-		return &connLimiterWrapper{name: name, r: r}
+	names := splitLimiterNames(name)
+	switch len(names) {
+	case 0:
+		return nil
+	case 1:
+		return &connLimiterWrapper{name: names[0], r: r}
+	}
+	group := make(connLimiterGroup, 0, len(names))
+	for _, n := range names {
+		group = append(group, &connLimiterWrapper{name: n, r: r})
 	}
-	return nil
+	return group
 }
 
 func (r *connLimiterRegistry) get(name string) conn.ConnLimiter {
@@ -89,11 +111,20 @@ func (r *rateLimiterRegistry) Register(name string, v rate.RateLimiter) error {
 	return r.registry.Register(name, v)
 }
 
+// Get resolves name lazily; see connLimiterRegistry.Get for name lists.
 func (r *rateLimiterRegistry) Get(name string) rate.RateLimiter {
-	if name != "" {
-		return &rateLimiterWrapper{name: name, r: r}
+	names := splitLimiterNames(name)
+	switch len(names) {
+	case 0:
+		return nil
+	case 1:
+		return &rateLimiterWrapper{name: names[0], r: r}
+	}
+	group := make(rateLimiterGroup, 0, len(names))
+	for _, n := range names {
+		group = append(group, &rateLimiterWrapper{name: n, r: r})
 	}
-	return nil
+	return group
 }
 
 func (r *rateLimiterRegistry) get(name string) rate.RateLimiter {
@@ -112,3 +143,164 @@ func (w *rateLimiterWrapper) Limiter(key string) rate.Limiter {
 	}
 	return v.Limiter(key)
 }
+
+func splitLimiterNames(name string) []string {
+	var names []string
+	for _, n := range strings.Split(name, ",") {
+		if n = strings.TrimSpace(n); n != "" {
+			names = append(names, n)
+		}
+	}
+	return names
+}
+
+type connLimiterGroup []conn.ConnLimiter
+
+func (g connLimiterGroup) Limiter(key string) conn.Limiter {
+	lims := make(connLimits, 0, len(g))
+	for _, cl := range g {
+		if lim := cl.Limiter(key); lim != nil {
+			lims = append(lims, lim)
+		}
+	}
+	switch len(lims) {
+	case 0:
+		return nil
+	case 1:
+		return lims[0]
+	}
+	return lims
+}
+
+// connLimits admits a connection only if every limiter does, releasing the
+// slots already taken when a later one refuses. A release (n <= 0) always
+// reaches every limiter: a limiter still over a lowered limit reports false
+// on release, which must not keep the others from returning their slots.
+type connLimits []conn.Limiter
+
+func (l connLimits) Allow(n int) bool {
+	if n <= 0 {
+		for _, lim := range l {
+			lim.Allow(n)
+		}
+		return true
+	}
+	for i, lim := range l {
+		if !lim.Allow(n) {
+			for _, prev := range l[:i] {
+				prev.Allow(-n)
+			}
+			return false
+		}
+	}
+	return true
+}
+
+func (l connLimits) Limit() int {
+	limit := 0
+	for i, lim := range l {
+		if v := lim.Limit(); i == 0 || v < limit {
+			limit = v
+		}
+	}
+	return limit
+}
+
+type rateLimiterGroup []rate.RateLimiter
+
+func (g rateLimiterGroup) Limiter(key string) rate.Limiter {
+	lims := make(rateLimits, 0, len(g))
+	for _, rl := range g {
+		if lim := rl.Limiter(key); lim != nil {
+			lims = append(lims, lim)
+		}
+	}
+	switch len(lims) {
+	case 0:
+		return nil
+	case 1:
+		return lims[0]
+	}
+	return lims
+}
+
+// rateLimits admits a connection only if every limiter does. Tokens taken
+// from earlier limiters are not returned on refusal, so stacked rates err on
+// the strict side.
+type rateLimits []rate.Limiter
+
+func (l rateLimits) Allow(n int) bool {
+	for _, lim := range l {
+		if !lim.Allow(n) {
+			return false
+		}
+	}
+	return true
+}
+
+func (l rateLimits) Limit() float64 {
+	var limit float64
+	for i, lim := range l {
+		if v := lim.Limit(); i == 0 || v < limit {
+			limit = v
+		}
+	}
+	return limit
+}
+
+type trafficLimiterGroup []traffic.TrafficLimiter
+
+func (g trafficLimiterGroup) In(ctx context.Context, key string, opts ...limiter.Option) traffic.Limiter {
+	lims := make(trafficLimits, 0, len(g))
+	for _, tl := range g {
+		if lim := tl.In(ctx, key, opts...); lim != nil {
+			lims = append(lims, lim)
+		}
+	}
+	return lims.limiter()
+}
+
+func (g trafficLimiterGroup) Out(ctx context.Context, key string, opts ...limiter.Option) traffic.Limiter {
+	lims := make(trafficLimits, 0, len(g))
+	for _, tl := range g {
+		if lim := tl.Out(ctx, key, opts...); lim != nil {
+			lims = append(lims, lim)
+		}
+	}
+	return lims.limiter()
+}
+
+// trafficLimits lets n bytes through once every limiter has granted them,
+// shrinking n to the smallest grant.
+type trafficLimits []traffic.Limiter
+
+func (l trafficLimits) limiter() traffic.Limiter {
+	switch len(l) {
+	case 0:
+		return nil
+	case 1:
+		return l[0]
+	}
+	return l
+}
+
+func (l trafficLimits) Wait(ctx context.Context, n int) int {
+	for _, lim := range l {
+		if v := lim.Wait(ctx, n); v < n {
+			n = v
+		}
+	}
+	return n
+}
+
+func (l trafficLimits) Limit() int {
+	limit := 0
+	for i, lim := range l {
+		if v := lim.Limit(); i == 0 || v < limit {
+			limit = v
+		}
+	}
+	return limit
+}
+
+func (l trafficLimits) Set(n int) {}
@@ -0,0 +1,97 @@
+package registry
+
+import (
+	"context"
+	"testing"
+)
+
+type testConnLimit struct {
+	limit, used int
+}
+
+// Allow mirrors the agent's conn limiter: a release still over the limit
+// reports false.
+func (l *testConnLimit) Allow(n int) bool {
+	if n > 0 && l.used+n > l.limit {
+		return false
+	}
+	l.used += n
+	return l.used <= l.limit
+}
+
+func (l *testConnLimit) Limit() int { return l.limit }
+
+func TestConnLimitsRollBackOnRefusal(t *testing.T) {
+	first, second, third := &testConnLimit{limit: 5}, &testConnLimit{limit: 5}, &testConnLimit{limit: 1}
+	lims := connLimits{first, second, third}
+
+	if !lims.Allow(1) {
+		t.Fatalf("expected the first connection to fit every limiter")
+	}
+	if lims.Allow(1) {
+		t.Fatalf("expected the full limiter to refuse")
+	}
+	// 被拒绝的连接不能占用前面限流器的名额
+	if first.used != 1 || second.used != 1 || third.used != 1 {
+		t.Fatalf("expected refused slots to be returned, got %d %d %d", first.used, second.used, third.used)
+	}
+	if !lims.Allow(-1) || first.used != 0 || second.used != 0 || third.used != 0 {
+		t.Fatalf("expected a release to reach every limiter, got %d %d %d", first.used, second.used, third.used)
+	}
+	if got := lims.Limit(); got != 1 {
+		t.Fatalf("limit = %d, want the smallest 1", got)
+	}
+}
+
+func TestConnLimitsReleaseReachesEveryLimiterAfterLimitShrinks(t *testing.T) {
+	first, second := &testConnLimit{limit: 5}, &testConnLimit{limit: 5}
+	lims := connLimits{first, second}
+	for i := 0; i < 3; i++ {
+		if !lims.Allow(1) {
+			t.Fatalf("expected connection %d to be admitted", i+1)
+		}
+	}
+
+	// 限额下调后第一个限流器仍超限，释放时返回 false，但后面的限流器也要归还名额
+	first.limit = 1
+	lims.Allow(-1)
+	if first.used != 2 || second.used != 2 {
+		t.Fatalf("expected the release to reach every limiter, got %d %d", first.used, second.used)
+	}
+}
+
+type testTrafficLimit struct {
+	burst  int
+	waited []int
+}
+
+func (l *testTrafficLimit) Wait(ctx context.Context, n int) int {
+	l.waited = append(l.waited, n)
+	if n > l.burst {
+		return l.burst
+	}
+	return n
+}
+
+func (l *testTrafficLimit) Limit() int { return l.burst }
+
+func (l *testTrafficLimit) Set(n int) {}
+
+func TestTrafficLimitsWaitShrinksToSmallestGrant(t *testing.T) {
+	pool, capped := &testTrafficLimit{burst: 4096}, &testTrafficLimit{burst: 1024}
+	lims := trafficLimits{pool, capped}
+
+	if got := lims.Wait(context.Background(), 8192); got != 1024 {
+		t.Fatalf("Wait = %d, want 1024", got)
+	}
+	// 后面的限流器只按前面已放行的字节数等待
+	if pool.waited[0] != 8192 || capped.waited[0] != 4096 {
+		t.Fatalf("unexpected waits %v %v", pool.waited, capped.waited)
+	}
+	if got := lims.Limit(); got != 1024 {
+		t.Fatalf("limit = %d, want 1024", got)
+	}
+	if trafficLimits(nil).limiter() != nil || (trafficLimits{pool}).limiter() != pool {
+		t.Fatalf("expected a group of one to collapse to its limiter")
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"github.com/go-gost/core/chain"
 	"github.com/go-gost/core/metadata"
 	"github.com/go-gost/core/selector"
+	"github.com/go-gost/x/health"
 	mdutil "github.com/go-gost/x/metadata/util"
 )
 
@@ -110,3 +111,38 @@ func (f *backupFilter[T]) Filter(ctx context.Context, vs ...T) []T {
 	}
 	return l
 }
+
+type healthFilter[T any] struct {
+	checker *health.Checker
+}
+
+// HealthFilter filters the objects whose active health check reports them down.
+// If every object is down the list is returned unchanged so traffic still
+// has somewhere to go.
+func HealthFilter[T any]() selector.Filter[T] {
+	return &healthFilter[T]{
+		checker: health.DefaultChecker(),
+	}
+}
+
+// Filter filters unhealthy objects.
+func (f *healthFilter[T]) Filter(ctx context.Context, vs ...T) []T {
+	if len(vs) <= 1 {
+		return vs
+	}
+
+	var l []T
+	for _, v := range vs {
+		if mi, _ := any(v).(metadata.Metadatable); mi != nil {
+			if md := mi.Metadata(); md != nil && !f.checker.IsUp(mdutil.GetString(md, health.MDKeyProbe)) {
+				continue
+			}
+		}
+		l = append(l, v)
+	}
+
+	if len(l) == 0 {
+		return vs
+	}
+	return l
+}
@@ -0,0 +1,132 @@
+package selector
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/go-gost/core/chain"
+	"github.com/go-gost/core/selector"
+)
+
+const (
+	// latencySampleTTL is how long a measurement is trusted. Older samples
+	// are treated as missing so the target is re-measured.
+	latencySampleTTL = 5 * time.Minute
+	// latencyAlpha is the EWMA smoothing factor for new samples.
+	latencyAlpha = 0.3
+)
+
+type latencySample struct {
+	avg     time.Duration
+	updated time.Time
+}
+
+// LatencyTracker keeps a moving average of the connect RTT per target address.
+type LatencyTracker struct {
+	mu      sync.RWMutex
+	samples map[string]*latencySample
+}
+
+var defaultLatencyTracker = NewLatencyTracker()
+
+// DefaultLatencyTracker returns the process-wide tracker fed by the
+// forward handlers and read by LeastLatencyStrategy.
+func DefaultLatencyTracker() *LatencyTracker {
+	return defaultLatencyTracker
+}
+
+func NewLatencyTracker() *LatencyTracker {
+	return &LatencyTracker{
+		samples: make(map[string]*latencySample),
+	}
+}
+
+// Observe records a connect RTT for the target address.
+func (t *LatencyTracker) Observe(addr string, rtt time.Duration) {
+	if t == nil || addr == "" || rtt < 0 {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	s := t.samples[addr]
+	if s == nil || now.Sub(s.updated) > latencySampleTTL {
+		t.samples[addr] = &latencySample{avg: rtt, updated: now}
+		return
+	}
+	s.avg = time.Duration(latencyAlpha*float64(rtt) + (1-latencyAlpha)*float64(s.avg))
+	s.updated = now
+}
+
+// Latency returns the averaged RTT for the address, or false if there is no
+// recent sample.
+func (t *LatencyTracker) Latency(addr string) (time.Duration, bool) {
+	if t == nil {
+		return 0, false
+	}
+
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	s := t.samples[addr]
+	if s == nil || time.Since(s.updated) > latencySampleTTL {
+		return 0, false
+	}
+	return s.avg, true
+}
+
+type leastLatencyStrategy[T any] struct {
+	tracker *LatencyTracker
+	rr      selector.Strategy[T]
+}
+
+// LeastLatencyStrategy is a strategy for node selector.
+// The node with the lowest measured connect RTT will be selected.
+// Nodes without a recent measurement are tried first (round-robin)
+// so that every node gets measured.
+func LeastLatencyStrategy[T any]() selector.Strategy[T] {
+	return &leastLatencyStrategy[T]{
+		tracker: DefaultLatencyTracker(),
+		rr:      RoundRobinStrategy[T](),
+	}
+}
+
+func (s *leastLatencyStrategy[T]) Apply(ctx context.Context, vs ...T) (v T) {
+	if len(vs) == 0 {
+		return
+	}
+
+	var unmeasured []T
+	best := -1
+	var bestRTT time.Duration
+	for i := range vs {
+		rtt, ok := s.tracker.Latency(latencyKey(vs[i]))
+		if !ok {
+			unmeasured = append(unmeasured, vs[i])
+			continue
+		}
+		if best < 0 || rtt < bestRTT {
+			best, bestRTT = i, rtt
+		}
+	}
+
+	if len(unmeasured) > 0 {
+		return s.rr.Apply(ctx, unmeasured...)
+	}
+	return vs[best]
+}
+
+func latencyKey(v any) string {
+	switch t := v.(type) {
+	case *chain.Node:
+		if t != nil {
+			return t.Addr
+		}
+	case interface{ Name() string }:
+		return t.Name()
+	}
+	return ""
+}
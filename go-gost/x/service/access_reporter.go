@@ -0,0 +1,166 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-gost/core/recorder"
+	"github.com/go-gost/x/registry"
+)
+
+// AccessRecorderName 面板下发的服务通过该名称引用连接日志记录器：
+// recorders: [{"name": "panel_access", "record": "recorder.service.handler"}]
+const AccessRecorderName = "panel_access"
+
+const (
+	accessReportInterval    = 5 * time.Second
+	accessReportBatchSize   = 200
+	accessReportMaxBuffered = 10000
+)
+
+var accessReportURL string
+
+// accessReporter 缓存每条连接的记录并批量上报到面板。
+// 面板不可达时保留最新的 accessReportMaxBuffered 条，较旧的记录被丢弃。
+type accessReporter struct {
+	mu     sync.Mutex
+	buf    []json.RawMessage
+	notify chan struct{}
+}
+
+var (
+	accessReporterOnce sync.Once
+	defaultAccess      = &accessReporter{notify: make(chan struct{}, 1)}
+)
+
+// startAccessReporter 注册连接日志记录器并启动上报协程
+func startAccessReporter(addr string, secret string) {
+	accessReportURL = "http://" + addr + "/flow/access?secret=" + secret
+	accessReporterOnce.Do(func() {
+		_ = registry.RecorderRegistry().Register(AccessRecorderName, defaultAccess)
+		go defaultAccess.run(context.Background())
+	})
+}
+
+// Record 实现 recorder.Recorder，只做入队，不阻塞连接处理
+func (r *accessReporter) Record(ctx context.Context, b []byte, opts ...recorder.RecordOption) error {
+	if len(b) == 0 {
+		return nil
+	}
+	item := append(json.RawMessage(nil), b...)
+
+	r.mu.Lock()
+	if len(r.buf) >= accessReportMaxBuffered {
+		r.buf = r.buf[len(r.buf)-accessReportMaxBuffered+1:]
+	}
+	r.buf = append(r.buf, item)
+	full := len(r.buf) >= accessReportBatchSize
+	r.mu.Unlock()
+
+	if full {
+		select {
+		case r.notify <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+func (r *accessReporter) run(ctx context.Context) {
+	ticker := time.NewTicker(accessReportInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-r.notify:
+		}
+		for r.flush(ctx) {
+		}
+	}
+}
+
+// flush 上报一批记录，返回是否还有待上报的完整批次
+func (r *accessReporter) flush(ctx context.Context) bool {
+	r.mu.Lock()
+	n := len(r.buf)
+	if n > accessReportBatchSize {
+		n = accessReportBatchSize
+	}
+	batch := r.buf[:n:n]
+	r.buf = r.buf[n:]
+	r.mu.Unlock()
+
+	if len(batch) == 0 {
+		return false
+	}
+	if err := sendAccessReport(ctx, batch); err != nil {
+		fmt.Printf("⚠️ 上报连接日志失败: %v\n", err)
+		// 失败的批次放回队首，等待下次上报
+		r.mu.Lock()
+		r.buf = append(batch, r.buf...)
+		if len(r.buf) > accessReportMaxBuffered {
+			r.buf = r.buf[len(r.buf)-accessReportMaxBuffered:]
+		}
+		r.mu.Unlock()
+		return false
+	}
+
+	r.mu.Lock()
+	more := len(r.buf) >= accessReportBatchSize
+	r.mu.Unlock()
+	return more
+}
+
+// sendAccessReport 以与流量上报相同的加密格式发送一批连接日志
+func sendAccessReport(ctx context.Context, batch []json.RawMessage) error {
+	if accessReportURL == "" {
+		return fmt.Errorf("连接日志上报URL未设置")
+	}
+	jsonData, err := json.Marshal(batch)
+	if err != nil {
+		return fmt.Errorf("序列化连接日志失败: %v", err)
+	}
+
+	requestBody := jsonData
+	if httpAESCrypto != nil {
+		if encryptedData, err := httpAESCrypto.Encrypt(jsonData); err == nil {
+			if body, err := json.Marshal(map[string]interface{}{
+				"encrypted": true,
+				"data":      encryptedData,
+				"timestamp": time.Now().Unix(),
+			}); err == nil {
+				requestBody = body
+			}
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", accessReportURL, bytes.NewBuffer(requestBody))
+	if err != nil {
+		return fmt.Errorf("创建HTTP请求失败: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "GOST-Access-Reporter/1.0")
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("发送HTTP请求失败: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var responseBytes bytes.Buffer
+	_, _ = responseBytes.ReadFrom(resp.Body)
+	if resp.StatusCode != http.StatusOK || strings.TrimSpace(responseBytes.String()) != "ok" {
+		return fmt.Errorf("HTTP响应错误: %d %s", resp.StatusCode, strings.TrimSpace(responseBytes.String()))
+	}
+	return nil
+}
@@ -42,6 +42,7 @@ type options struct {
 	observer       observer.Observer
 	observerPeriod time.Duration
 	logger         logger.Logger
+	closers        []io.Closer
 }
 
 var isTls = 0
@@ -131,6 +132,14 @@ func LoggerOption(logger logger.Logger) Option {
 	}
 }
 
+// ClosersOption registers resources owned by the service, such as inline
+// forwarder hops, that are closed together with it.
+func ClosersOption(closers ...io.Closer) Option {
+	return func(opts *options) {
+		opts.closers = append(opts.closers, closers...)
+	}
+}
+
 type defaultService struct {
 	name     string
 	listener listener.Listener
@@ -318,6 +327,9 @@ func (s *defaultService) Close() error {
 	if closer, ok := s.handler.(io.Closer); ok {
 		closer.Close()
 	}
+	for _, closer := range s.options.closers {
+		closer.Close()
+	}
 	return s.listener.Close()
 }
 
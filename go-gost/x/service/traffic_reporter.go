@@ -39,6 +39,8 @@ func SetHTTPReportURL(addr string, secret string) {
 	} else {
 		fmt.Printf("🔐 HTTP AES 加密器创建成功\n")
 	}
+
+	startAccessReporter(addr, secret)
 }
 
 // sendBatchTrafficReport 批量发送多个服务的流量报告到HTTP接口
@@ -0,0 +1,133 @@
+package socket
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/go-gost/x/config"
+	parser "github.com/go-gost/x/config/parsing/admission"
+	"github.com/go-gost/x/internal/util/mmdb"
+	"github.com/go-gost/x/registry"
+)
+
+type deleteAdmissionRequest struct {
+	Admission string `json:"admission"`
+}
+
+func sameAdmissionConfig(data config.AdmissionConfig) bool {
+	for _, existing := range config.Global().Admissions {
+		if existing != nil && existing.Name == data.Name {
+			return reflect.DeepEqual(*existing, data)
+		}
+	}
+	return false
+}
+
+// upsertAdmission 创建或替换准入控制（IP/CIDR 黑白名单与 GeoIP 国家规则）。
+// 配置未变化时保留现有实例，避免重复加载 GeoIP 数据库。
+func upsertAdmission(data config.AdmissionConfig) error {
+	name := strings.TrimSpace(data.Name)
+	if name == "" {
+		return errors.New("admission name is required")
+	}
+	data.Name = name
+
+	if registry.AdmissionRegistry().IsRegistered(name) {
+		if sameAdmissionConfig(data) {
+			return nil
+		}
+	}
+	if err := checkGeoIPFile(data); err != nil {
+		return err
+	}
+	if registry.AdmissionRegistry().IsRegistered(name) {
+		registry.AdmissionRegistry().Unregister(name)
+	}
+
+	if err := registry.AdmissionRegistry().Register(name, parser.ParseAdmission(&data)); err != nil {
+		return errors.New("admission " + name + " already exists")
+	}
+
+	config.OnUpdate(func(c *config.Config) error {
+		for i := range c.Admissions {
+			if c.Admissions[i].Name == name {
+				c.Admissions[i] = &data
+				return nil
+			}
+		}
+		c.Admissions = append(c.Admissions, &data)
+		return nil
+	})
+	return nil
+}
+
+// checkGeoIPFile 确认国家规则使用的数据库能够打开。数据库缺失时白名单会拒绝
+// 所有客户端、黑名单则形同虚设，因此直接拒绝该配置并把错误返回给面板。
+func checkGeoIPFile(data config.AdmissionConfig) error {
+	if data.GeoIP == nil || len(data.GeoIP.Countries) == 0 {
+		return nil
+	}
+	file := data.GeoIP.File
+	if file == "" {
+		file = parser.DefaultGeoIPFile
+	}
+	if _, err := mmdb.Open(file); err != nil {
+		return fmt.Errorf("加载 GeoIP 数据库 %s 失败: %v", file, err)
+	}
+	return nil
+}
+
+func deleteAdmission(name string) error {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return errors.New("admission name is required")
+	}
+	if registry.AdmissionRegistry().IsRegistered(name) {
+		registry.AdmissionRegistry().Unregister(name)
+	}
+
+	config.OnUpdate(func(c *config.Config) error {
+		var kept []*config.AdmissionConfig
+		for _, item := range c.Admissions {
+			if item.Name != name {
+				kept = append(kept, item)
+			}
+		}
+		c.Admissions = kept
+		return nil
+	})
+	return nil
+}
+
+// 准入控制命令处理函数
+func (w *WebSocketReporter) handleUpsertAdmission(data interface{}) error {
+	jsonData, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("序列化数据失败: %v", err)
+	}
+	var admissionConfig config.AdmissionConfig
+	if err := json.Unmarshal(jsonData, &admissionConfig); err != nil {
+		return fmt.Errorf("解析准入配置失败: %v", err)
+	}
+	return upsertAdmission(admissionConfig)
+}
+
+func (w *WebSocketReporter) handleDeleteAdmission(data interface{}) error {
+	jsonData, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("序列化数据失败: %v", err)
+	}
+	// 删除操作可能是: {"admission": "name"} 或者直接是名称字符串
+	var deleteReq deleteAdmissionRequest
+	if err := json.Unmarshal(jsonData, &deleteReq); err != nil {
+		var name string
+		if err := json.Unmarshal(jsonData, &name); err != nil {
+			return fmt.Errorf("解析准入删除请求失败: %v", err)
+		}
+		deleteReq.Admission = name
+	}
+	return deleteAdmission(deleteReq.Admission)
+}
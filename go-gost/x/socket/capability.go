@@ -0,0 +1,99 @@
+package socket
+
+import (
+	"os"
+	"os/exec"
+	"runtime"
+	"sort"
+
+	admission_parser "github.com/go-gost/x/config/parsing/admission"
+	"github.com/go-gost/x/internal/util/mmdb"
+	"github.com/go-gost/x/registry"
+)
+
+// capabilityManifest Agent 能力清单，连接时随 Hello 上报，面板据此校验配置
+type capabilityManifest struct {
+	OS         string          `json:"os"`
+	Arch       string          `json:"arch"`
+	Listeners  []string        `json:"listeners"`
+	Dialers    []string        `json:"dialers"`
+	Handlers   []string        `json:"handlers"`
+	Connectors []string        `json:"connectors"`
+	Features   map[string]bool `json:"features"`
+}
+
+// collectCapabilities 收集已注册的组件类型以及内核特性
+func collectCapabilities() capabilityManifest {
+	features := detectKernelFeatures()
+	// 支持面板下发的连接数/新建速率限流器（AddCLimiters 等命令）
+	features["connLimiter"] = true
+	// 支持准入控制命令（AddAdmissions 等）及 GeoIP 国家规则
+	features["admission"] = true
+	// 工作目录下的默认 GeoIP 数据库可以打开，未指定数据库的国家规则才能生效
+	if _, err := mmdb.Open(admission_parser.DefaultGeoIPFile); err == nil {
+		features["geoip"] = true
+	}
+	// 转发处理器支持向目标发送 PROXY 协议头（handler metadata proxyProtocol）
+	features["proxyProtocol"] = true
+	// 流量限流器支持以 "@" 声明的具名共享令牌桶及逗号分隔的多个限流器
+	features["sharedBucket"] = true
+	// 服务可引用内置的 panel_access 记录器，将每条连接的日志批量上报到面板
+	features["accessLog"] = true
+	// 转发处理器可按 TLS SNI / HTTP Host 在共享端口上选择路由，并按路由上报流量
+	features["sniRouting"] = true
+	// 支持面板下发的域名解析器与静态主机映射（UpdateResolvers / UpdateHosts），诊断时按同一策略解析
+	features["dnsPolicy"] = true
+	// 支持 UdpProbe 诊断命令，可直连或经由隧道转发链探测 UDP 目标的响应、丢包与抖动
+	features["udpProbe"] = true
+	// 支持隧道吞吐测试（StartThroughputSink / ThroughputTest），出口凭一次性令牌接收入口经隧道发来的测试流
+	features["throughputTest"] = true
+	return capabilityManifest{
+		OS:         runtime.GOOS,
+		Arch:       runtime.GOARCH,
+		Listeners:  sortedKeys(registry.ListenerRegistry().GetAll()),
+		Dialers:    sortedKeys(registry.DialerRegistry().GetAll()),
+		Handlers:   sortedKeys(registry.HandlerRegistry().GetAll()),
+		Connectors: sortedKeys(registry.ConnectorRegistry().GetAll()),
+		Features:   features,
+	}
+}
+
+// detectKernelFeatures 探测 TUN / 透明代理等依赖内核与权限的特性
+func detectKernelFeatures() map[string]bool {
+	features := map[string]bool{
+		"tun":      false,
+		"redirect": false,
+		"tproxy":   false,
+	}
+	if runtime.GOOS != "linux" {
+		return features
+	}
+
+	isRoot := os.Geteuid() == 0
+	if _, err := os.Stat("/dev/net/tun"); err == nil && isRoot {
+		features["tun"] = true
+	}
+
+	// 透明代理依赖 iptables/nftables 下发规则
+	hasNetfilter := false
+	for _, bin := range []string{"iptables", "nft"} {
+		if _, err := exec.LookPath(bin); err == nil {
+			hasNetfilter = true
+			break
+		}
+	}
+	features["redirect"] = hasNetfilter && isRoot
+	if _, err := os.Stat("/proc/sys/net/ipv4/ip_nonlocal_bind"); err == nil {
+		features["tproxy"] = hasNetfilter && isRoot
+	}
+	return features
+}
+
+func sortedKeys[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
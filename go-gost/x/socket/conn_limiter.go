@@ -0,0 +1,265 @@
+package socket
+
+import (
+	"errors"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	connlimiter "github.com/go-gost/core/limiter/conn"
+	ratelimiter "github.com/go-gost/core/limiter/rate"
+	"github.com/go-gost/x/config"
+	parser "github.com/go-gost/x/config/parsing/limiter"
+	xconnlimiter "github.com/go-gost/x/limiter/conn"
+	"github.com/go-gost/x/registry"
+)
+
+const (
+	limiterKindConn = "conn"
+	limiterKindRate = "rate"
+)
+
+// LimiterHitStats 连接数/新建速率限制的累计拒绝次数
+type LimiterHitStats struct {
+	Name     string `json:"name"`
+	Kind     string `json:"kind"`
+	Rejected uint64 `json:"rejected"`
+}
+
+type limiterHits struct {
+	rejected atomic.Uint64
+}
+
+var (
+	limiterHitsMu sync.Mutex
+	limiterHitMap = map[string]*limiterHits{}
+
+	// connLimiterSlots 同名连接数限流器跨更新共享的存活连接账本
+	connLimiterSlotsMu sync.Mutex
+	connLimiterSlots   = map[string]*xconnlimiter.SwappableConnLimiter{}
+)
+
+// hitsFor 返回限流器的计数器；同名限流器更新后沿用原计数
+func hitsFor(kind, name string) *limiterHits {
+	limiterHitsMu.Lock()
+	defer limiterHitsMu.Unlock()
+	key := kind + ":" + name
+	h := limiterHitMap[key]
+	if h == nil {
+		h = &limiterHits{}
+		limiterHitMap[key] = h
+	}
+	return h
+}
+
+func hasHits(kind, name string) bool {
+	limiterHitsMu.Lock()
+	defer limiterHitsMu.Unlock()
+	_, ok := limiterHitMap[kind+":"+name]
+	return ok
+}
+
+func dropHits(kind, name string) {
+	limiterHitsMu.Lock()
+	defer limiterHitsMu.Unlock()
+	delete(limiterHitMap, kind+":"+name)
+}
+
+// getLimiterHitStats 读取各限流器的拒绝计数，随系统信息上报
+func getLimiterHitStats() []LimiterHitStats {
+	limiterHitsMu.Lock()
+	defer limiterHitsMu.Unlock()
+	items := make([]LimiterHitStats, 0, len(limiterHitMap))
+	for key, h := range limiterHitMap {
+		kind, name, _ := strings.Cut(key, ":")
+		items = append(items, LimiterHitStats{Name: name, Kind: kind, Rejected: h.rejected.Load()})
+	}
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].Kind != items[j].Kind {
+			return items[i].Kind < items[j].Kind
+		}
+		return items[i].Name < items[j].Name
+	})
+	return items
+}
+
+type countingConnLimiter struct {
+	connlimiter.ConnLimiter
+	hits *limiterHits
+}
+
+func (l *countingConnLimiter) Limiter(key string) connlimiter.Limiter {
+	lim := l.ConnLimiter.Limiter(key)
+	if lim == nil {
+		return nil
+	}
+	return &countingConnLimit{Limiter: lim, hits: l.hits}
+}
+
+type countingConnLimit struct {
+	connlimiter.Limiter
+	hits *limiterHits
+}
+
+func (l *countingConnLimit) Allow(n int) bool {
+	ok := l.Limiter.Allow(n)
+	if !ok && n > 0 {
+		l.hits.rejected.Add(uint64(n))
+	}
+	return ok
+}
+
+type countingRateLimiter struct {
+	ratelimiter.RateLimiter
+	hits *limiterHits
+}
+
+func (l *countingRateLimiter) Limiter(key string) ratelimiter.Limiter {
+	lim := l.RateLimiter.Limiter(key)
+	if lim == nil {
+		return nil
+	}
+	return &countingRateLimit{Limiter: lim, hits: l.hits}
+}
+
+type countingRateLimit struct {
+	ratelimiter.Limiter
+	hits *limiterHits
+}
+
+func (l *countingRateLimit) Allow(n int) bool {
+	ok := l.Limiter.Allow(n)
+	if !ok && n > 0 {
+		l.hits.rejected.Add(uint64(n))
+	}
+	return ok
+}
+
+// limiterConfigs 返回全局配置中对应类型的限流器列表
+func limiterConfigs(c *config.Config, kind string) *[]*config.LimiterConfig {
+	if kind == limiterKindRate {
+		return &c.RLimiters
+	}
+	return &c.CLimiters
+}
+
+func limiterRegistered(kind, name string) bool {
+	if kind == limiterKindRate {
+		return registry.RateLimiterRegistry().IsRegistered(name)
+	}
+	return registry.ConnLimiterRegistry().IsRegistered(name)
+}
+
+func unregisterLimiter(kind, name string) {
+	if kind == limiterKindRate {
+		registry.RateLimiterRegistry().Unregister(name)
+		return
+	}
+	registry.ConnLimiterRegistry().Unregister(name)
+}
+
+func registerLimiter(kind string, cfg *config.LimiterConfig) error {
+	hits := hitsFor(kind, cfg.Name)
+	if kind == limiterKindRate {
+		v := parser.ParseRateLimiter(cfg)
+		return registry.RateLimiterRegistry().Register(cfg.Name, &countingRateLimiter{RateLimiter: v, hits: hits})
+	}
+	v := swapConnLimiter(cfg.Name, parser.ParseConnLimiter(cfg))
+	return registry.ConnLimiterRegistry().Register(cfg.Name, &countingConnLimiter{ConnLimiter: v, hits: hits})
+}
+
+// swapConnLimiter 让同名限流器更新后沿用存活连接的计数：旧连接关闭时归还到新规则，
+// 且仍计入新规则的限额
+func swapConnLimiter(name string, lim connlimiter.ConnLimiter) connlimiter.ConnLimiter {
+	connLimiterSlotsMu.Lock()
+	defer connLimiterSlotsMu.Unlock()
+	if slot := connLimiterSlots[name]; slot != nil {
+		slot.Swap(lim)
+		return slot
+	}
+	slot := xconnlimiter.NewSwappableConnLimiter(lim)
+	connLimiterSlots[name] = slot
+	return slot
+}
+
+func dropConnLimiterSlot(name string) {
+	connLimiterSlotsMu.Lock()
+	defer connLimiterSlotsMu.Unlock()
+	delete(connLimiterSlots, name)
+}
+
+func sameLimiterConfig(kind string, data config.LimiterConfig) bool {
+	for _, existing := range *limiterConfigs(config.Global(), kind) {
+		if existing != nil && existing.Name == data.Name {
+			return reflect.DeepEqual(*existing, data)
+		}
+	}
+	return false
+}
+
+// upsertConnLimiter 创建或替换连接数/速率限流器。配置未变化时保留现有实例；
+// 连接数限流器替换后沿用存活连接的计数（见 swapConnLimiter）。
+func upsertConnLimiter(kind string, data config.LimiterConfig) error {
+	name := strings.TrimSpace(data.Name)
+	if name == "" {
+		return errors.New("limiter name is required")
+	}
+	if strings.Contains(name, ",") {
+		return errors.New("limiter name must not contain ','")
+	}
+	data.Name = name
+
+	if limiterRegistered(kind, name) {
+		// 从配置文件加载的限流器没有计数包装（无计数器），需要重新注册一次
+		if hasHits(kind, name) && sameLimiterConfig(kind, data) {
+			return nil
+		}
+		unregisterLimiter(kind, name)
+	}
+
+	if err := registerLimiter(kind, &data); err != nil {
+		return errors.New("limiter " + name + " already exists")
+	}
+
+	config.OnUpdate(func(c *config.Config) error {
+		items := limiterConfigs(c, kind)
+		for i := range *items {
+			if (*items)[i].Name == name {
+				(*items)[i] = &data
+				return nil
+			}
+		}
+		*items = append(*items, &data)
+		return nil
+	})
+	return nil
+}
+
+func deleteConnLimiter(kind, name string) error {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return errors.New("limiter name is required")
+	}
+	if limiterRegistered(kind, name) {
+		unregisterLimiter(kind, name)
+	}
+	dropHits(kind, name)
+	if kind == limiterKindConn {
+		dropConnLimiterSlot(name)
+	}
+
+	config.OnUpdate(func(c *config.Config) error {
+		items := limiterConfigs(c, kind)
+		var kept []*config.LimiterConfig
+		for _, item := range *items {
+			if item.Name != name {
+				kept = append(kept, item)
+			}
+		}
+		*items = kept
+		return nil
+	})
+	return nil
+}
@@ -0,0 +1,252 @@
+package socket
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-gost/core/resolver"
+	"github.com/go-gost/x/config"
+	hosts_parser "github.com/go-gost/x/config/parsing/hosts"
+	resolver_parser "github.com/go-gost/x/config/parsing/resolver"
+	xnet "github.com/go-gost/x/internal/net"
+	"github.com/go-gost/x/registry"
+)
+
+type deleteResolverRequest struct {
+	Resolver string `json:"resolver"`
+}
+
+type deleteHostsRequest struct {
+	Hosts string `json:"hosts"`
+}
+
+// normalizeNameserverDurations 将面板下发的字符串格式 ttl / timeout（如 "60s"）转换为纳秒数
+func normalizeNameserverDurations(data interface{}) interface{} {
+	obj, ok := data.(map[string]interface{})
+	if !ok {
+		return data
+	}
+	servers, ok := obj["nameservers"].([]interface{})
+	if !ok {
+		return data
+	}
+	for _, item := range servers {
+		server, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		for _, key := range []string{"ttl", "timeout"} {
+			if s, ok := server[key].(string); ok {
+				if d, err := time.ParseDuration(s); err == nil {
+					server[key] = int64(d)
+				}
+			}
+		}
+	}
+	return obj
+}
+
+// upsertResolver 创建或替换域名解析器。服务按名称引用解析器，替换后立即对新连接生效。
+func upsertResolver(data config.ResolverConfig) error {
+	name := strings.TrimSpace(data.Name)
+	if name == "" {
+		return errors.New("resolver name is required")
+	}
+	data.Name = name
+
+	r, err := resolver_parser.ParseResolver(&data)
+	if err != nil {
+		return fmt.Errorf("create resolver %s failed: %v", name, err)
+	}
+	if registry.ResolverRegistry().IsRegistered(name) {
+		registry.ResolverRegistry().Unregister(name)
+	}
+	if err := registry.ResolverRegistry().Register(name, r); err != nil {
+		return errors.New("resolver " + name + " already exists")
+	}
+
+	config.OnUpdate(func(c *config.Config) error {
+		for i := range c.Resolvers {
+			if c.Resolvers[i].Name == name {
+				c.Resolvers[i] = &data
+				return nil
+			}
+		}
+		c.Resolvers = append(c.Resolvers, &data)
+		return nil
+	})
+	return nil
+}
+
+func deleteResolver(name string) error {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return errors.New("resolver name is required")
+	}
+	if registry.ResolverRegistry().IsRegistered(name) {
+		registry.ResolverRegistry().Unregister(name)
+	}
+
+	config.OnUpdate(func(c *config.Config) error {
+		var kept []*config.ResolverConfig
+		for _, item := range c.Resolvers {
+			if item.Name != name {
+				kept = append(kept, item)
+			}
+		}
+		c.Resolvers = kept
+		return nil
+	})
+	return nil
+}
+
+// upsertHosts 创建或替换静态主机映射
+func upsertHosts(data config.HostsConfig) error {
+	name := strings.TrimSpace(data.Name)
+	if name == "" {
+		return errors.New("hosts name is required")
+	}
+	data.Name = name
+
+	if registry.HostsRegistry().IsRegistered(name) {
+		registry.HostsRegistry().Unregister(name)
+	}
+	if err := registry.HostsRegistry().Register(name, hosts_parser.ParseHostMapper(&data)); err != nil {
+		return errors.New("hosts " + name + " already exists")
+	}
+
+	config.OnUpdate(func(c *config.Config) error {
+		for i := range c.Hosts {
+			if c.Hosts[i].Name == name {
+				c.Hosts[i] = &data
+				return nil
+			}
+		}
+		c.Hosts = append(c.Hosts, &data)
+		return nil
+	})
+	return nil
+}
+
+func deleteHosts(name string) error {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return errors.New("hosts name is required")
+	}
+	if registry.HostsRegistry().IsRegistered(name) {
+		registry.HostsRegistry().Unregister(name)
+	}
+
+	config.OnUpdate(func(c *config.Config) error {
+		var kept []*config.HostsConfig
+		for _, item := range c.Hosts {
+			if item.Name != name {
+				kept = append(kept, item)
+			}
+		}
+		c.Hosts = kept
+		return nil
+	})
+	return nil
+}
+
+// 解析器命令处理函数
+func (w *WebSocketReporter) handleUpsertResolver(data interface{}) error {
+	jsonData, err := json.Marshal(normalizeNameserverDurations(data))
+	if err != nil {
+		return fmt.Errorf("序列化数据失败: %v", err)
+	}
+	var resolverConfig config.ResolverConfig
+	if err := json.Unmarshal(jsonData, &resolverConfig); err != nil {
+		return fmt.Errorf("解析解析器配置失败: %v", err)
+	}
+	return upsertResolver(resolverConfig)
+}
+
+func (w *WebSocketReporter) handleDeleteResolver(data interface{}) error {
+	jsonData, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("序列化数据失败: %v", err)
+	}
+	// 删除操作可能是: {"resolver": "name"} 或者直接是名称字符串
+	var deleteReq deleteResolverRequest
+	if err := json.Unmarshal(jsonData, &deleteReq); err != nil {
+		var name string
+		if err := json.Unmarshal(jsonData, &name); err != nil {
+			return fmt.Errorf("解析解析器删除请求失败: %v", err)
+		}
+		deleteReq.Resolver = name
+	}
+	return deleteResolver(deleteReq.Resolver)
+}
+
+// 主机映射命令处理函数
+func (w *WebSocketReporter) handleUpsertHosts(data interface{}) error {
+	jsonData, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("序列化数据失败: %v", err)
+	}
+	var hostsConfig config.HostsConfig
+	if err := json.Unmarshal(jsonData, &hostsConfig); err != nil {
+		return fmt.Errorf("解析主机映射配置失败: %v", err)
+	}
+	return upsertHosts(hostsConfig)
+}
+
+func (w *WebSocketReporter) handleDeleteHosts(data interface{}) error {
+	jsonData, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("序列化数据失败: %v", err)
+	}
+	var deleteReq deleteHostsRequest
+	if err := json.Unmarshal(jsonData, &deleteReq); err != nil {
+		var name string
+		if err := json.Unmarshal(jsonData, &name); err != nil {
+			return fmt.Errorf("解析主机映射删除请求失败: %v", err)
+		}
+		deleteReq.Hosts = name
+	}
+	return deleteHosts(deleteReq.Hosts)
+}
+
+// probeDNSOptions 面板随诊断命令下发的转发解析策略，用于与运行时一致地解析目标域名
+type probeDNSOptions struct {
+	Nameservers []string                    `json:"nameservers,omitempty"`
+	Prefer      string                      `json:"prefer,omitempty"`
+	Hosts       []*config.HostMappingConfig `json:"hosts,omitempty"`
+}
+
+// resolvePingTarget 按诊断请求附带的解析策略解析域名，与运行时服务使用同一套解析器与主机映射。
+// 未附带策略时返回空字符串，由调用方使用系统 DNS。
+func resolvePingTarget(host string, port int, timeoutMs int, req probeDNSOptions) (string, error) {
+	if len(req.Nameservers) == 0 && len(req.Hosts) == 0 {
+		return "", nil
+	}
+	timeout := time.Duration(timeoutMs) * time.Millisecond
+	var r resolver.Resolver
+	if len(req.Nameservers) > 0 {
+		resolverConfig := &config.ResolverConfig{Name: "diagnosis"}
+		for _, addr := range req.Nameservers {
+			resolverConfig.Nameservers = append(resolverConfig.Nameservers, &config.NameserverConfig{
+				Addr:    addr,
+				Prefer:  req.Prefer,
+				Timeout: timeout,
+			})
+		}
+		var err error
+		if r, err = resolver_parser.ParseResolver(resolverConfig); err != nil {
+			return "", fmt.Errorf("创建解析器失败: %v", err)
+		}
+	}
+	hostMapper := hosts_parser.ParseHostMapper(&config.HostsConfig{Name: "diagnosis", Mappings: req.Hosts})
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return xnet.Resolve(ctx, "ip", net.JoinHostPort(host, strconv.Itoa(port)), r, hostMapper, nil)
+}
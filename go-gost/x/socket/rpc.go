@@ -0,0 +1,191 @@
+package socket
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// rpcSchemaVersion 当前 Agent 支持的命令信封版本，面板发送更高版本的命令将被拒绝
+const rpcSchemaVersion = 1
+
+// 结构化错误码，与面板 go-backend/internal/ws/rpc.go 保持一致
+const (
+	rpcErrUnknownCommand     = "UNKNOWN_COMMAND"
+	rpcErrUnsupportedVersion = "UNSUPPORTED_VERSION"
+	rpcErrInvalidPayload     = "INVALID_PAYLOAD"
+	rpcErrExecFailed         = "EXEC_FAILED"
+)
+
+// rpcError 带错误码的命令执行错误
+type rpcError struct {
+	Code    string
+	Message string
+}
+
+func (e *rpcError) Error() string {
+	return e.Message
+}
+
+func newRPCError(code string, format string, args ...interface{}) *rpcError {
+	return &rpcError{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// rpcErrorCode 提取错误码，普通错误统一视为执行失败
+func rpcErrorCode(err error) string {
+	var re *rpcError
+	if errors.As(err, &re) {
+		return re.Code
+	}
+	return rpcErrExecFailed
+}
+
+// commandHandler 命令处理函数，返回值作为响应的 data 字段
+type commandHandler func(w *WebSocketReporter, data interface{}) (interface{}, error)
+
+// commandSpec 命令注册信息
+type commandSpec struct {
+	Name       string
+	Handler    commandHandler
+	SaveConfig bool // 状态变更命令执行后需要保存 gost.json
+	Async      bool // 耗时命令在独立 goroutine 中执行，避免阻塞后续命令
+}
+
+var (
+	commandRegistryMu sync.RWMutex
+	commandRegistry   = map[string]commandSpec{}
+)
+
+// registerCommand 注册命令处理函数，新增命令无需修改 routeCommand
+func registerCommand(spec commandSpec) {
+	if spec.Name == "" || spec.Handler == nil {
+		panic("socket: invalid command spec")
+	}
+	commandRegistryMu.Lock()
+	defer commandRegistryMu.Unlock()
+	if _, exists := commandRegistry[spec.Name]; exists {
+		panic("socket: duplicate command " + spec.Name)
+	}
+	commandRegistry[spec.Name] = spec
+}
+
+func lookupCommand(name string) (commandSpec, bool) {
+	commandRegistryMu.RLock()
+	defer commandRegistryMu.RUnlock()
+	spec, ok := commandRegistry[name]
+	return spec, ok
+}
+
+// registeredCommands 返回已注册命令名称（排序后），用于连接时的能力协商
+func registeredCommands() []string {
+	commandRegistryMu.RLock()
+	defer commandRegistryMu.RUnlock()
+	names := make([]string, 0, len(commandRegistry))
+	for name := range commandRegistry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// typedCommand 将强类型处理函数包装为 commandHandler，负责请求解码
+func typedCommand[Req any, Resp any](fn func(w *WebSocketReporter, req Req) (Resp, error)) commandHandler {
+	return func(w *WebSocketReporter, data interface{}) (interface{}, error) {
+		var req Req
+		jsonData, err := json.Marshal(data)
+		if err != nil {
+			return nil, newRPCError(rpcErrInvalidPayload, "序列化数据失败: %v", err)
+		}
+		if err := json.Unmarshal(jsonData, &req); err != nil {
+			return nil, newRPCError(rpcErrInvalidPayload, "解析请求失败: %v", err)
+		}
+		return fn(w, req)
+	}
+}
+
+// legacyCommand 包装只返回 error 的旧处理函数
+func legacyCommand(fn func(w *WebSocketReporter, data interface{}) error) commandHandler {
+	return func(w *WebSocketReporter, data interface{}) (interface{}, error) {
+		return nil, fn(w, data)
+	}
+}
+
+// helloPayload 连接建立后上报给面板的能力信息
+type helloPayload struct {
+	SchemaVersion int                `json:"schemaVersion"`
+	Commands      []string           `json:"commands"`
+	Version       string             `json:"version,omitempty"`
+	Capabilities  capabilityManifest `json:"capabilities"`
+}
+
+// sendHello 上报协议版本、支持的命令列表以及能力清单
+func (w *WebSocketReporter) sendHello() {
+	w.sendResponse(CommandResponse{
+		Type:    "Hello",
+		Success: true,
+		Message: "OK",
+		Data: helloPayload{
+			SchemaVersion: rpcSchemaVersion,
+			Commands:      registeredCommands(),
+			Version:       w.version,
+			Capabilities:  collectCapabilities(),
+		},
+	})
+}
+
+func init() {
+	// Service 相关命令
+	registerCommand(commandSpec{Name: "AddService", Handler: legacyCommand((*WebSocketReporter).handleAddService), SaveConfig: true})
+	registerCommand(commandSpec{Name: "UpdateService", Handler: legacyCommand((*WebSocketReporter).handleUpdateService), SaveConfig: true})
+	registerCommand(commandSpec{Name: "DeleteService", Handler: legacyCommand((*WebSocketReporter).handleDeleteService), SaveConfig: true})
+	registerCommand(commandSpec{Name: "PauseService", Handler: legacyCommand((*WebSocketReporter).handlePauseService), SaveConfig: true})
+	registerCommand(commandSpec{Name: "ResumeService", Handler: legacyCommand((*WebSocketReporter).handleResumeService), SaveConfig: true})
+
+	// Chain 相关命令
+	registerCommand(commandSpec{Name: "AddChains", Handler: legacyCommand((*WebSocketReporter).handleAddChain), SaveConfig: true})
+	registerCommand(commandSpec{Name: "UpdateChains", Handler: legacyCommand((*WebSocketReporter).handleUpdateChain), SaveConfig: true})
+	registerCommand(commandSpec{Name: "DeleteChains", Handler: legacyCommand((*WebSocketReporter).handleDeleteChain), SaveConfig: true})
+
+	// Limiter 相关命令
+	registerCommand(commandSpec{Name: "AddLimiters", Handler: legacyCommand((*WebSocketReporter).handleAddLimiter), SaveConfig: true})
+	registerCommand(commandSpec{Name: "UpdateLimiters", Handler: legacyCommand((*WebSocketReporter).handleUpdateLimiter), SaveConfig: true})
+	registerCommand(commandSpec{Name: "DeleteLimiters", Handler: legacyCommand((*WebSocketReporter).handleDeleteLimiter), SaveConfig: true})
+
+	// 连接数 / 新建连接速率限流器（Add 与 Update 均为创建或替换）
+	registerCommand(commandSpec{Name: "AddCLimiters", Handler: legacyCommand((*WebSocketReporter).handleUpsertCLimiter), SaveConfig: true})
+	registerCommand(commandSpec{Name: "UpdateCLimiters", Handler: legacyCommand((*WebSocketReporter).handleUpsertCLimiter), SaveConfig: true})
+	registerCommand(commandSpec{Name: "DeleteCLimiters", Handler: legacyCommand((*WebSocketReporter).handleDeleteCLimiter), SaveConfig: true})
+	registerCommand(commandSpec{Name: "AddRLimiters", Handler: legacyCommand((*WebSocketReporter).handleUpsertRLimiter), SaveConfig: true})
+	registerCommand(commandSpec{Name: "UpdateRLimiters", Handler: legacyCommand((*WebSocketReporter).handleUpsertRLimiter), SaveConfig: true})
+	registerCommand(commandSpec{Name: "DeleteRLimiters", Handler: legacyCommand((*WebSocketReporter).handleDeleteRLimiter), SaveConfig: true})
+
+	// 准入控制（Add 与 Update 均为创建或替换）
+	registerCommand(commandSpec{Name: "AddAdmissions", Handler: legacyCommand((*WebSocketReporter).handleUpsertAdmission), SaveConfig: true})
+	registerCommand(commandSpec{Name: "UpdateAdmissions", Handler: legacyCommand((*WebSocketReporter).handleUpsertAdmission), SaveConfig: true})
+	registerCommand(commandSpec{Name: "DeleteAdmissions", Handler: legacyCommand((*WebSocketReporter).handleDeleteAdmission), SaveConfig: true})
+
+	// 域名解析器与静态主机映射（Add 与 Update 均为创建或替换）
+	registerCommand(commandSpec{Name: "AddResolvers", Handler: legacyCommand((*WebSocketReporter).handleUpsertResolver), SaveConfig: true})
+	registerCommand(commandSpec{Name: "UpdateResolvers", Handler: legacyCommand((*WebSocketReporter).handleUpsertResolver), SaveConfig: true})
+	registerCommand(commandSpec{Name: "DeleteResolvers", Handler: legacyCommand((*WebSocketReporter).handleDeleteResolver), SaveConfig: true})
+	registerCommand(commandSpec{Name: "AddHosts", Handler: legacyCommand((*WebSocketReporter).handleUpsertHosts), SaveConfig: true})
+	registerCommand(commandSpec{Name: "UpdateHosts", Handler: legacyCommand((*WebSocketReporter).handleUpsertHosts), SaveConfig: true})
+	registerCommand(commandSpec{Name: "DeleteHosts", Handler: legacyCommand((*WebSocketReporter).handleDeleteHosts), SaveConfig: true})
+
+	// TCP Ping 诊断命令（只读，不需要保存配置）
+	registerCommand(commandSpec{Name: "TcpPing", Handler: typedCommand((*WebSocketReporter).handleTcpPing), Async: true})
+	// UDP 探测诊断命令（只读，不需要保存配置）
+	registerCommand(commandSpec{Name: "UdpProbe", Handler: typedCommand((*WebSocketReporter).handleUdpProbe), Async: true})
+	// 隧道吞吐测试：出口登记一次性令牌并启动接收端，入口经隧道发起测试
+	registerCommand(commandSpec{Name: "StartThroughputSink", Handler: typedCommand((*WebSocketReporter).handleStartThroughputSink)})
+	registerCommand(commandSpec{Name: "ThroughputTest", Handler: typedCommand((*WebSocketReporter).handleThroughputTest), Async: true})
+
+	// Protocol blocking switches
+	registerCommand(commandSpec{Name: "SetProtocol", Handler: legacyCommand((*WebSocketReporter).handleSetProtocol), SaveConfig: true})
+
+	// 升级 / 回退 Agent（异步执行，不需要保存配置）
+	registerCommand(commandSpec{Name: "UpgradeAgent", Handler: legacyCommand((*WebSocketReporter).handleUpgradeAgent), Async: true})
+	registerCommand(commandSpec{Name: "RollbackAgent", Handler: legacyCommand((*WebSocketReporter).handleRollbackAgent), Async: true})
+}
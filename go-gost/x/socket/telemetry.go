@@ -0,0 +1,154 @@
+package socket
+
+import (
+	"bufio"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/go-gost/core/observer/stats"
+	"github.com/go-gost/x/registry"
+	"github.com/go-gost/x/service"
+	"github.com/shirou/gopsutil/v3/disk"
+	"github.com/shirou/gopsutil/v3/load"
+	psnet "github.com/shirou/gopsutil/v3/net"
+)
+
+// InterfaceStats 单个网卡的累计流量
+type InterfaceStats struct {
+	Name             string `json:"name"`
+	BytesReceived    uint64 `json:"bytes_received"`
+	BytesTransmitted uint64 `json:"bytes_transmitted"`
+}
+
+// LoadInfo 系统负载
+type LoadInfo struct {
+	Load1  float64 `json:"load1"`
+	Load5  float64 `json:"load5"`
+	Load15 float64 `json:"load15"`
+}
+
+// DiskInfo 根分区磁盘使用情况
+type DiskInfo struct {
+	Path  string  `json:"path"`
+	Total uint64  `json:"total"`
+	Used  uint64  `json:"used"`
+	Usage float64 `json:"usage"` // 使用率（百分比）
+}
+
+// SocketStats TCP/UDP 套接字数量
+type SocketStats struct {
+	TCP int `json:"tcp"`
+	UDP int `json:"udp"`
+}
+
+// ServiceConnStats 单个服务的连接统计
+type ServiceConnStats struct {
+	Name         string `json:"name"`
+	CurrentConns uint64 `json:"current_conns"`
+	TotalConns   uint64 `json:"total_conns"`
+	TotalErrs    uint64 `json:"total_errs"`
+}
+
+// getInterfaceStats 获取各非回环网卡的流量，同时返回汇总
+func getInterfaceStats() ([]InterfaceStats, NetworkStats) {
+	var total NetworkStats
+	ioCounters, err := psnet.IOCounters(true)
+	if err != nil {
+		return nil, total
+	}
+
+	items := make([]InterfaceStats, 0, len(ioCounters))
+	for _, io := range ioCounters {
+		// 跳过回环接口
+		if io.Name == "lo" || strings.HasPrefix(io.Name, "lo") {
+			continue
+		}
+		items = append(items, InterfaceStats{
+			Name:             io.Name,
+			BytesReceived:    io.BytesRecv,
+			BytesTransmitted: io.BytesSent,
+		})
+		total.BytesReceived += io.BytesRecv
+		total.BytesTransmitted += io.BytesSent
+	}
+	return items, total
+}
+
+// getLoadInfo 获取系统负载
+func getLoadInfo() LoadInfo {
+	avg, err := load.Avg()
+	if err != nil || avg == nil {
+		return LoadInfo{}
+	}
+	return LoadInfo{Load1: avg.Load1, Load5: avg.Load5, Load15: avg.Load15}
+}
+
+// getDiskInfo 获取根分区磁盘使用情况
+func getDiskInfo() DiskInfo {
+	usage, err := disk.Usage("/")
+	if err != nil || usage == nil {
+		return DiskInfo{Path: "/"}
+	}
+	return DiskInfo{
+		Path:  usage.Path,
+		Total: usage.Total,
+		Used:  usage.Used,
+		Usage: usage.UsedPercent,
+	}
+}
+
+// getSocketStats 从 /proc/net/sockstat(6) 读取套接字数量，开销远小于枚举连接
+func getSocketStats() SocketStats {
+	var result SocketStats
+	for _, path := range []string{"/proc/net/sockstat", "/proc/net/sockstat6"} {
+		f, err := os.Open(path)
+		if err != nil {
+			continue
+		}
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			fields := strings.Fields(scanner.Text())
+			if len(fields) < 3 || fields[1] != "inuse" {
+				continue
+			}
+			n, _ := strconv.Atoi(fields[2])
+			switch fields[0] {
+			case "TCP:", "TCP6:":
+				result.TCP += n
+			case "UDP:", "UDP6:":
+				result.UDP += n
+			}
+		}
+		f.Close()
+	}
+	return result
+}
+
+// getServiceConnStats 读取各服务 Status().Stats() 中的连接计数
+func getServiceConnStats() []ServiceConnStats {
+	type statusProvider interface {
+		Status() *service.Status
+	}
+
+	items := make([]ServiceConnStats, 0)
+	for name, svc := range registry.ServiceRegistry().GetAll() {
+		sp, ok := svc.(statusProvider)
+		if !ok || sp == nil {
+			continue
+		}
+		st := sp.Status().Stats()
+		if st == nil {
+			continue
+		}
+		items = append(items, ServiceConnStats{
+			Name:         name,
+			CurrentConns: st.Get(stats.KindCurrentConns),
+			TotalConns:   st.Get(stats.KindTotalConns),
+			TotalErrs:    st.Get(stats.KindTotalErrs),
+		})
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].Name < items[j].Name })
+	return items
+}
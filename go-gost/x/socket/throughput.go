@@ -0,0 +1,455 @@
+package socket
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-gost/core/chain"
+	xchain "github.com/go-gost/x/chain"
+	"github.com/go-gost/x/registry"
+)
+
+// 吞吐测试协议：入口经由转发链连接出口本地接收端，先发送一行握手
+// "FLVX-TP/1 <令牌> <upload|download> <时长毫秒> <字节上限>"，接收端回复 "OK" 或 "ERR <原因>"；
+// 随后进行若干次 8 字节回显测量往返时间，再以 4 字节长度前缀分帧传输测试数据，长度为 0 的帧表示结束。
+const (
+	throughputProtocol      = "FLVX-TP/1"
+	throughputMaxDuration   = 30 * time.Second
+	throughputMaxBytes      = int64(1) << 30
+	throughputDefaultTTL    = 60 * time.Second
+	throughputMaxTTL        = 5 * time.Minute
+	throughputMaxSessions   = 2
+	throughputChunkSize     = 32 * 1024
+	throughputPingCount     = 5
+	throughputHandshakeWait = 10 * time.Second
+	throughputReportPeriod  = time.Second
+)
+
+// StartThroughputSinkRequest 面板登记一次性测速令牌，并在出口节点启动本地接收端
+type StartThroughputSinkRequest struct {
+	Token string `json:"token"`
+	Port  int    `json:"port"` // 期望监听的本地端口，0 表示复用已有端口或由系统分配
+	TTL   int    `json:"ttl"`  // 令牌有效期(秒)
+}
+
+// StartThroughputSinkResponse 返回接收端监听的本地端口
+type StartThroughputSinkResponse struct {
+	Port int `json:"port"`
+}
+
+// ThroughputTestRequest 吞吐测试请求结构体，由入口节点执行
+type ThroughputTestRequest struct {
+	TestId    string `json:"testId"`
+	Chain     string `json:"chain"`  // 转发链名称，如 chains_<隧道ID>
+	Target    string `json:"target"` // 出口节点上接收端的地址
+	Token     string `json:"token"`
+	Direction string `json:"direction"` // upload: 入口->出口，download: 出口->入口
+	Duration  int    `json:"duration"`  // 测试时长(秒)
+	MaxBytes  int64  `json:"maxBytes"`  // 传输字节上限
+	RequestId string `json:"requestId,omitempty"`
+}
+
+// ThroughputTestResponse 吞吐测试结果
+type ThroughputTestResponse struct {
+	TestId       string  `json:"testId"`
+	Direction    string  `json:"direction"`
+	Success      bool    `json:"success"`
+	Bytes        int64   `json:"bytes"`
+	ElapsedTime  float64 `json:"elapsedTime"` // 传输耗时(ms)
+	Mbps         float64 `json:"mbps"`
+	AverageRTT   float64 `json:"averageRtt"` // 经隧道的往返时间(ms)
+	MinRTT       float64 `json:"minRtt"`
+	MaxRTT       float64 `json:"maxRtt"`
+	ErrorMessage string  `json:"errorMessage,omitempty"`
+	RequestId    string  `json:"requestId,omitempty"`
+}
+
+// throughputSink 出口节点的测速接收端，只监听本机回环地址，仅能经由本节点的隧道服务访问，
+// 并且每个连接必须携带面板下发的一次性令牌
+type throughputSink struct {
+	mu        sync.Mutex
+	listeners map[int]net.Listener
+	tokens    map[string]time.Time
+	sessions  int
+}
+
+var defaultThroughputSink = &throughputSink{
+	listeners: make(map[int]net.Listener),
+	tokens:    make(map[string]time.Time),
+}
+
+// handleStartThroughputSink 登记令牌并确保接收端已在监听
+func (w *WebSocketReporter) handleStartThroughputSink(req StartThroughputSinkRequest) (StartThroughputSinkResponse, error) {
+	if len(strings.TrimSpace(req.Token)) < 16 {
+		return StartThroughputSinkResponse{}, errors.New("测速令牌无效")
+	}
+	if req.Port < 0 || req.Port > 65535 {
+		return StartThroughputSinkResponse{}, errors.New("无效的端口号，范围应为1-65535")
+	}
+	ttl := time.Duration(req.TTL) * time.Second
+	if ttl <= 0 {
+		ttl = throughputDefaultTTL
+	}
+	if ttl > throughputMaxTTL {
+		ttl = throughputMaxTTL
+	}
+	port, err := defaultThroughputSink.register(strings.TrimSpace(req.Token), req.Port, ttl)
+	if err != nil {
+		return StartThroughputSinkResponse{}, err
+	}
+	return StartThroughputSinkResponse{Port: port}, nil
+}
+
+func (s *throughputSink) register(token string, port int, ttl time.Duration) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if port == 0 {
+		for p := range s.listeners {
+			port = p
+			break
+		}
+	}
+	if _, ok := s.listeners[port]; !ok {
+		ln, err := net.Listen("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(port)))
+		if err != nil {
+			return 0, fmt.Errorf("启动测速接收端失败: %v", err)
+		}
+		port = ln.Addr().(*net.TCPAddr).Port
+		s.listeners[port] = ln
+		go s.serve(ln)
+		fmt.Printf("📶 测速接收端已启动: %s\n", ln.Addr())
+	}
+	s.tokens[token] = time.Now().Add(ttl)
+	time.AfterFunc(ttl, s.reap)
+	return port, nil
+}
+
+// reap 清理过期令牌，没有待用令牌与进行中的测试时关闭接收端
+func (s *throughputSink) reap() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for token, expiry := range s.tokens {
+		if !now.Before(expiry) {
+			delete(s.tokens, token)
+		}
+	}
+	if len(s.tokens) > 0 || s.sessions > 0 {
+		return
+	}
+	for port, ln := range s.listeners {
+		_ = ln.Close()
+		delete(s.listeners, port)
+	}
+}
+
+// acquire 消耗一次性令牌并占用一个测试会话
+func (s *throughputSink) acquire(token string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	expiry, ok := s.tokens[token]
+	if !ok || !time.Now().Before(expiry) {
+		return errors.New("令牌无效或已过期")
+	}
+	if s.sessions >= throughputMaxSessions {
+		return errors.New("测速会话过多")
+	}
+	delete(s.tokens, token)
+	s.sessions++
+	return nil
+}
+
+func (s *throughputSink) release() {
+	s.mu.Lock()
+	s.sessions--
+	s.mu.Unlock()
+	s.reap()
+}
+
+func (s *throughputSink) serve(ln net.Listener) {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		go s.handleConn(conn)
+	}
+}
+
+func (s *throughputSink) handleConn(conn net.Conn) {
+	defer conn.Close()
+
+	_ = conn.SetDeadline(time.Now().Add(throughputHandshakeWait))
+	reader := bufio.NewReaderSize(conn, throughputChunkSize)
+	token, direction, duration, maxBytes, err := readThroughputHandshake(reader)
+	if err != nil {
+		_, _ = fmt.Fprintf(conn, "ERR %v\n", err)
+		return
+	}
+	if err := s.acquire(token); err != nil {
+		_, _ = fmt.Fprintf(conn, "ERR %v\n", err)
+		return
+	}
+	defer s.release()
+	if _, err := io.WriteString(conn, "OK\n"); err != nil {
+		return
+	}
+
+	// 回显往返时间探测包
+	ping := make([]byte, 8)
+	for i := 0; i < throughputPingCount; i++ {
+		if _, err := io.ReadFull(reader, ping); err != nil {
+			return
+		}
+		if _, err := conn.Write(ping); err != nil {
+			return
+		}
+	}
+
+	// 会话总时长受限，防止异常客户端长期占用
+	_ = conn.SetDeadline(time.Now().Add(duration + throughputHandshakeWait))
+	switch direction {
+	case "upload":
+		start := time.Now()
+		received, err := readThroughputFrames(reader, maxBytes, nil)
+		if err != nil {
+			return
+		}
+		result := make([]byte, 16)
+		binary.BigEndian.PutUint64(result[:8], uint64(received))
+		binary.BigEndian.PutUint64(result[8:], uint64(time.Since(start)))
+		_, _ = conn.Write(result)
+	case "download":
+		_, _ = writeThroughputFrames(conn, duration, maxBytes, nil)
+	}
+}
+
+func readThroughputHandshake(reader *bufio.Reader) (token, direction string, duration time.Duration, maxBytes int64, err error) {
+	line, err := reader.ReadSlice('\n')
+	if err != nil {
+		return "", "", 0, 0, errors.New("握手失败")
+	}
+	fields := strings.Fields(string(line))
+	if len(fields) != 5 || fields[0] != throughputProtocol {
+		return "", "", 0, 0, errors.New("不支持的测速协议")
+	}
+	direction = fields[2]
+	if direction != "upload" && direction != "download" {
+		return "", "", 0, 0, errors.New("测试方向无效")
+	}
+	ms, err1 := strconv.ParseInt(fields[3], 10, 64)
+	maxBytes, err2 := strconv.ParseInt(fields[4], 10, 64)
+	if err1 != nil || err2 != nil || ms <= 0 || maxBytes <= 0 {
+		return "", "", 0, 0, errors.New("测试参数无效")
+	}
+	duration = time.Duration(ms) * time.Millisecond
+	if duration > throughputMaxDuration {
+		duration = throughputMaxDuration
+	}
+	if maxBytes > throughputMaxBytes {
+		maxBytes = throughputMaxBytes
+	}
+	return fields[1], direction, duration, maxBytes, nil
+}
+
+// writeThroughputFrames 在时长或字节上限内持续写入数据帧，最后写入结束帧
+func writeThroughputFrames(conn io.Writer, duration time.Duration, maxBytes int64, progress func(int64)) (int64, error) {
+	chunk := make([]byte, 4+throughputChunkSize)
+	// 使用随机内容，避免链路压缩影响测量结果
+	_, _ = rand.Read(chunk[4:])
+
+	var sent int64
+	deadline := time.Now().Add(duration)
+	for sent < maxBytes && time.Now().Before(deadline) {
+		n := int64(throughputChunkSize)
+		if maxBytes-sent < n {
+			n = maxBytes - sent
+		}
+		binary.BigEndian.PutUint32(chunk[:4], uint32(n))
+		if _, err := conn.Write(chunk[:4+n]); err != nil {
+			return sent, err
+		}
+		sent += n
+		if progress != nil {
+			progress(sent)
+		}
+	}
+	_, err := conn.Write([]byte{0, 0, 0, 0})
+	return sent, err
+}
+
+// readThroughputFrames 读取数据帧直至结束帧，返回收到的数据字节数
+func readThroughputFrames(reader io.Reader, maxBytes int64, progress func(int64)) (int64, error) {
+	header := make([]byte, 4)
+	buf := make([]byte, throughputChunkSize)
+	var received int64
+	for {
+		if _, err := io.ReadFull(reader, header); err != nil {
+			return received, err
+		}
+		n := int(binary.BigEndian.Uint32(header))
+		if n == 0 {
+			return received, nil
+		}
+		if n > throughputChunkSize || received+int64(n) > maxBytes {
+			return received, errors.New("数据帧超出限制")
+		}
+		if _, err := io.ReadFull(reader, buf[:n]); err != nil {
+			return received, err
+		}
+		received += int64(n)
+		if progress != nil {
+			progress(received)
+		}
+	}
+}
+
+// handleThroughputTest 入口节点经由隧道连接出口接收端执行吞吐测试，过程中推送进度
+func (w *WebSocketReporter) handleThroughputTest(req ThroughputTestRequest) (ThroughputTestResponse, error) {
+	response := ThroughputTestResponse{
+		TestId:    req.TestId,
+		Direction: req.Direction,
+		RequestId: req.RequestId,
+	}
+	if req.Direction == "" {
+		req.Direction = "upload"
+		response.Direction = "upload"
+	}
+	if req.Direction != "upload" && req.Direction != "download" {
+		response.ErrorMessage = "测试方向无效"
+		return response, nil
+	}
+	if req.Chain == "" || !registry.ChainRegistry().IsRegistered(req.Chain) {
+		response.ErrorMessage = fmt.Sprintf("转发链 %s 不存在", req.Chain)
+		return response, nil
+	}
+	duration := time.Duration(req.Duration) * time.Second
+	if duration <= 0 {
+		duration = 10 * time.Second
+	}
+	if duration > throughputMaxDuration {
+		duration = throughputMaxDuration
+	}
+	if req.MaxBytes <= 0 || req.MaxBytes > throughputMaxBytes {
+		req.MaxBytes = throughputMaxBytes
+	}
+
+	router := xchain.NewRouter(
+		chain.ChainRouterOption(registry.ChainRegistry().Get(req.Chain)),
+		chain.TimeoutRouterOption(throughputHandshakeWait),
+	)
+	ctx, cancel := context.WithTimeout(context.Background(), throughputHandshakeWait)
+	conn, err := router.Dial(ctx, "tcp", req.Target)
+	cancel()
+	if err != nil {
+		response.ErrorMessage = fmt.Sprintf("经隧道连接出口失败: %v", err)
+		return response, nil
+	}
+	defer conn.Close()
+
+	fmt.Printf("📶 开始吞吐测试: %s，链路: %s，方向: %s，时长: %s\n", req.Target, req.Chain, req.Direction, duration)
+
+	_ = conn.SetDeadline(time.Now().Add(throughputHandshakeWait))
+	reader := bufio.NewReaderSize(conn, throughputChunkSize)
+	if _, err := fmt.Fprintf(conn, "%s %s %s %d %d\n", throughputProtocol, req.Token, req.Direction, duration.Milliseconds(), req.MaxBytes); err != nil {
+		response.ErrorMessage = fmt.Sprintf("握手失败: %v", err)
+		return response, nil
+	}
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		response.ErrorMessage = fmt.Sprintf("握手失败: %v", err)
+		return response, nil
+	}
+	if line = strings.TrimSpace(line); line != "OK" {
+		response.ErrorMessage = "出口拒绝测试: " + strings.TrimSpace(strings.TrimPrefix(line, "ERR"))
+		return response, nil
+	}
+
+	rtts := make([]float64, 0, throughputPingCount)
+	ping := make([]byte, 8)
+	for i := 0; i < throughputPingCount; i++ {
+		start := time.Now()
+		binary.BigEndian.PutUint64(ping, uint64(start.UnixNano()))
+		if _, err := conn.Write(ping); err != nil {
+			response.ErrorMessage = fmt.Sprintf("往返时间测量失败: %v", err)
+			return response, nil
+		}
+		if _, err := io.ReadFull(reader, ping); err != nil {
+			response.ErrorMessage = fmt.Sprintf("往返时间测量失败: %v", err)
+			return response, nil
+		}
+		rtts = append(rtts, time.Since(start).Seconds()*1000)
+	}
+	response.AverageRTT, response.MinRTT, response.MaxRTT, _ = summarizeRTTs(rtts)
+
+	_ = conn.SetDeadline(time.Now().Add(duration + throughputHandshakeWait))
+	start := time.Now()
+	lastReport := start
+	progress := func(bytes int64) {
+		if time.Since(lastReport) < throughputReportPeriod {
+			return
+		}
+		lastReport = time.Now()
+		w.sendThroughputProgress(req.TestId, req.Direction, bytes, time.Since(start), false)
+	}
+
+	switch req.Direction {
+	case "upload":
+		if _, err = writeThroughputFrames(conn, duration, req.MaxBytes, progress); err == nil {
+			result := make([]byte, 16)
+			if _, err = io.ReadFull(reader, result); err == nil {
+				// 以出口实际收到的数据量与耗时为准
+				response.Bytes = int64(binary.BigEndian.Uint64(result[:8]))
+				response.ElapsedTime = float64(binary.BigEndian.Uint64(result[8:])) / float64(time.Millisecond)
+			}
+		}
+	case "download":
+		response.Bytes, err = readThroughputFrames(reader, req.MaxBytes, progress)
+		response.ElapsedTime = float64(time.Since(start)) / float64(time.Millisecond)
+	}
+	if err != nil {
+		response.ErrorMessage = fmt.Sprintf("数据传输中断: %v", err)
+		w.sendThroughputProgress(req.TestId, req.Direction, response.Bytes, time.Since(start), true)
+		return response, nil
+	}
+	if response.ElapsedTime > 0 {
+		response.Mbps = float64(response.Bytes) * 8 / (response.ElapsedTime / 1000) / 1e6
+	}
+	response.Success = true
+	w.sendThroughputProgress(req.TestId, req.Direction, response.Bytes, time.Duration(response.ElapsedTime*float64(time.Millisecond)), true)
+	fmt.Printf("📶 吞吐测试完成: %d bytes，%.2f Mbps，RTT %.2fms\n", response.Bytes, response.Mbps, response.AverageRTT)
+	return response, nil
+}
+
+// sendThroughputProgress 通过 WS 推送吞吐测试进度，面板转发给管理端
+func (w *WebSocketReporter) sendThroughputProgress(testID, direction string, bytes int64, elapsed time.Duration, done bool) {
+	mbps := 0.0
+	if elapsed > 0 {
+		mbps = float64(bytes) * 8 / elapsed.Seconds() / 1e6
+	}
+	w.sendResponse(CommandResponse{
+		Type:    "ThroughputProgress",
+		Success: true,
+		Data: map[string]interface{}{
+			"testId":      testID,
+			"direction":   direction,
+			"bytes":       bytes,
+			"elapsedTime": elapsed.Milliseconds(),
+			"mbps":        mbps,
+			"done":        done,
+		},
+	})
+}
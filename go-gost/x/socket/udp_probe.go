@@ -0,0 +1,229 @@
+package socket
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/go-gost/core/chain"
+	xchain "github.com/go-gost/x/chain"
+	"github.com/go-gost/x/internal/util/udpprobe"
+	"github.com/go-gost/x/registry"
+)
+
+const (
+	udpProbeMaxCount   = 20
+	udpProbeMaxPayload = 1400
+)
+
+// UdpProbeRequest UDP 探测请求结构体
+type UdpProbeRequest struct {
+	IP       string `json:"ip"`
+	Port     int    `json:"port"`
+	Count    int    `json:"count"`
+	Timeout  int    `json:"timeout"`  // 单次等待响应的超时时间(毫秒)
+	Interval int    `json:"interval"` // 两次发送之间的间隔(毫秒)
+	Payload  string `json:"payload"`  // 十六进制编码的探测包内容，为空时发送带序号的标记数据报
+	// Chain 非空时经由该转发链（如 chains_<隧道ID>）发送，用于隧道端到端探测
+	Chain     string `json:"chain,omitempty"`
+	RequestId string `json:"requestId,omitempty"`
+	probeDNSOptions
+}
+
+// UdpProbeResponse UDP 探测响应结构体
+type UdpProbeResponse struct {
+	IP           string  `json:"ip"`
+	Port         int     `json:"port"`
+	Success      bool    `json:"success"`
+	Sent         int     `json:"sent"`
+	Received     int     `json:"received"`
+	AverageTime  float64 `json:"averageTime"` // 平均往返时间(ms)
+	MinTime      float64 `json:"minTime"`
+	MaxTime      float64 `json:"maxTime"`
+	Jitter       float64 `json:"jitter"`     // 相邻两次往返时间差的平均值(ms)
+	PacketLoss   float64 `json:"packetLoss"` // 丢包率(%)
+	ErrorMessage string  `json:"errorMessage,omitempty"`
+	RequestId    string  `json:"requestId,omitempty"`
+}
+
+// handleUdpProbe 处理 UDP 探测诊断命令
+func (w *WebSocketReporter) handleUdpProbe(req UdpProbeRequest) (UdpProbeResponse, error) {
+	response := UdpProbeResponse{
+		IP:        req.IP,
+		Port:      req.Port,
+		RequestId: req.RequestId,
+	}
+	if net.ParseIP(req.IP) == nil && !isValidHostname(req.IP) {
+		response.ErrorMessage = "无效的IP地址或主机名"
+		return response, nil
+	}
+	if req.Port <= 0 || req.Port > 65535 {
+		response.ErrorMessage = "无效的端口号，范围应为1-65535"
+		return response, nil
+	}
+	payload, err := hex.DecodeString(strings.TrimSpace(req.Payload))
+	if err != nil || len(payload) > udpProbeMaxPayload {
+		response.ErrorMessage = fmt.Sprintf("探测包必须是不超过 %d 字节的十六进制内容", udpProbeMaxPayload)
+		return response, nil
+	}
+
+	// 设置默认值
+	if req.Count <= 0 {
+		req.Count = 4
+	}
+	if req.Count > udpProbeMaxCount {
+		req.Count = udpProbeMaxCount
+	}
+	if req.Timeout <= 0 {
+		req.Timeout = 2000
+	}
+	if req.Interval <= 0 {
+		req.Interval = 200
+	}
+
+	host := req.IP
+	resolved, err := resolvePingTarget(req.IP, req.Port, req.Timeout, req.probeDNSOptions)
+	if err != nil {
+		response.ErrorMessage = fmt.Sprintf("DNS解析失败: %v", err)
+		return response, nil
+	}
+	if resolved != "" {
+		host, _, _ = net.SplitHostPort(resolved)
+	}
+
+	rtts, sent, err := udpProbeHost(host, req.Port, req.Chain, payload, req.Count, req.Timeout, req.Interval)
+	response.Sent = sent
+	response.Received = len(rtts)
+	if sent > 0 {
+		response.PacketLoss = float64(sent-len(rtts)) / float64(sent) * 100
+	} else {
+		response.PacketLoss = 100
+	}
+	if len(rtts) > 0 {
+		response.Success = true
+		response.AverageTime, response.MinTime, response.MaxTime, response.Jitter = summarizeRTTs(rtts)
+	}
+	if err != nil {
+		response.ErrorMessage = err.Error()
+	} else if len(rtts) == 0 {
+		response.ErrorMessage = "未收到UDP响应，目标可能不回应该探测包"
+	}
+	return response, nil
+}
+
+// udpProbeHost 逐个发送探测包并等待响应，返回每个收到响应的往返时间(ms)与已发送数量
+func udpProbeHost(host string, port int, chainName string, payload []byte, count, timeoutMs, intervalMs int) ([]float64, int, error) {
+	timeout := time.Duration(timeoutMs) * time.Millisecond
+	target := net.JoinHostPort(host, strconv.Itoa(port))
+
+	var conn net.Conn
+	var err error
+	if chainName != "" {
+		if !registry.ChainRegistry().IsRegistered(chainName) {
+			return nil, 0, fmt.Errorf("转发链 %s 不存在", chainName)
+		}
+		router := xchain.NewRouter(
+			chain.ChainRouterOption(registry.ChainRegistry().Get(chainName)),
+			chain.TimeoutRouterOption(timeout),
+		)
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		conn, err = router.Dial(ctx, "udp", target)
+		cancel()
+	} else {
+		conn, err = net.DialTimeout("udp", target, timeout)
+	}
+	if err != nil {
+		return nil, 0, fmt.Errorf("建立UDP连接失败: %v", err)
+	}
+	defer conn.Close()
+
+	fmt.Printf("🔍 开始UDP探测: %s，链路: %s，次数: %d，超时: %dms\n", target, defaultIfEmpty(chainName, "直连"), count, timeoutMs)
+
+	buf := make([]byte, 65535)
+	var rtts []float64
+	sent := 0
+	for i := 0; i < count; i++ {
+		if i > 0 {
+			time.Sleep(time.Duration(intervalMs) * time.Millisecond)
+		}
+		packet, match := udpprobe.Tag(payload, port, uint16(i+1))
+		if match == nil {
+			// 无法编号的探测包，发送前丢弃之前超时探测的迟到响应
+			drainUDPReplies(conn, buf)
+		}
+		start := time.Now()
+		if _, err := conn.Write(packet); err != nil {
+			return rtts, sent, fmt.Errorf("发送探测包失败: %v", err)
+		}
+		sent++
+
+		_ = conn.SetReadDeadline(start.Add(timeout))
+		for {
+			n, err := conn.Read(buf)
+			if err != nil {
+				if errors.Is(err, syscall.ECONNREFUSED) {
+					// 收到 ICMP 端口不可达，后续探测没有意义
+					return rtts, sent, errors.New("目标端口不可达(ICMP)")
+				}
+				var netErr net.Error
+				if errors.As(err, &netErr) && netErr.Timeout() {
+					fmt.Printf("  第%d个探测包超时\n", i+1)
+					break
+				}
+				return rtts, sent, fmt.Errorf("读取响应失败: %v", err)
+			}
+			if match != nil && !match(buf[:n]) {
+				// 序号不符的是之前探测的迟到响应，继续等待本次响应
+				continue
+			}
+			elapsed := time.Since(start).Seconds() * 1000
+			fmt.Printf("  第%d个探测包响应: %.2fms\n", i+1, elapsed)
+			rtts = append(rtts, elapsed)
+			break
+		}
+	}
+	return rtts, sent, nil
+}
+
+// drainUDPReplies 读取并丢弃连接中已到达的数据报
+func drainUDPReplies(conn net.Conn, buf []byte) {
+	_ = conn.SetReadDeadline(time.Now())
+	for {
+		if _, err := conn.Read(buf); err != nil {
+			return
+		}
+	}
+}
+
+// summarizeRTTs 计算平均、最小、最大往返时间与抖动
+func summarizeRTTs(rtts []float64) (avg, min, max, jitter float64) {
+	min = math.MaxFloat64
+	var total, deltas float64
+	for i, rtt := range rtts {
+		total += rtt
+		min = math.Min(min, rtt)
+		max = math.Max(max, rtt)
+		if i > 0 {
+			deltas += math.Abs(rtt - rtts[i-1])
+		}
+	}
+	avg = total / float64(len(rtts))
+	if len(rtts) > 1 {
+		jitter = deltas / float64(len(rtts)-1)
+	}
+	return avg, min, max, jitter
+}
+
+func defaultIfEmpty(s, fallback string) string {
+	if s == "" {
+		return fallback
+	}
+	return s
+}
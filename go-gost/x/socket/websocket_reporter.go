@@ -21,13 +21,14 @@ import (
 	"time"
 
 	"github.com/go-gost/x/config"
+	"github.com/go-gost/x/health"
 	"github.com/go-gost/x/internal/util/crypto"
+	"github.com/go-gost/x/internal/util/release"
 	"github.com/go-gost/x/service"
 	"github.com/gorilla/websocket"
 	"github.com/shirou/gopsutil/v3/cpu"
 	"github.com/shirou/gopsutil/v3/host"
 	"github.com/shirou/gopsutil/v3/mem"
-	psnet "github.com/shirou/gopsutil/v3/net"
 )
 
 // SystemInfo 系统信息结构体
@@ -37,6 +38,15 @@ type SystemInfo struct {
 	BytesTransmitted uint64  `json:"bytes_transmitted"` // 发送字节数
 	CPUUsage         float64 `json:"cpu_usage"`         // CPU使用率（百分比）
 	MemoryUsage      float64 `json:"memory_usage"`      // 内存使用率（百分比）
+
+	CPUCores   []float64          `json:"cpu_cores,omitempty"`  // 各核心使用率（百分比）
+	Interfaces []InterfaceStats   `json:"interfaces,omitempty"` // 各网卡累计流量
+	Load       LoadInfo           `json:"load"`                 // 系统负载
+	Disk       DiskInfo           `json:"disk"`                 // 根分区磁盘
+	Sockets    SocketStats        `json:"sockets"`              // TCP/UDP 套接字数量
+	Services   []ServiceConnStats `json:"services,omitempty"`   // 各服务连接数
+	Health     []health.Status    `json:"health,omitempty"`     // 主动健康检查状态
+	Limiters   []LimiterHitStats  `json:"limiters,omitempty"`   // 连接数/速率限流拒绝计数
 }
 
 // NetworkStats 网络统计信息
@@ -47,7 +57,8 @@ type NetworkStats struct {
 
 // CPUInfo CPU信息
 type CPUInfo struct {
-	Usage float64 `json:"usage"` // CPU使用率（百分比）
+	Usage float64   `json:"usage"` // CPU使用率（百分比）
+	Cores []float64 `json:"cores"` // 各核心使用率（百分比）
 }
 
 // MemoryInfo 内存信息
@@ -60,6 +71,7 @@ type CommandMessage struct {
 	Type      string      `json:"type"`
 	Data      interface{} `json:"data"`
 	RequestId string      `json:"requestId,omitempty"`
+	Version   int         `json:"version,omitempty"` // 命令信封版本，旧面板不携带
 }
 
 // CommandResponse 命令响应结构体
@@ -67,6 +79,7 @@ type CommandResponse struct {
 	Type      string      `json:"type"`
 	Success   bool        `json:"success"`
 	Message   string      `json:"message"`
+	Code      string      `json:"code,omitempty"` // 失败时的结构化错误码
 	Data      interface{} `json:"data,omitempty"`
 	RequestId string      `json:"requestId,omitempty"`
 }
@@ -78,6 +91,7 @@ type TcpPingRequest struct {
 	Count     int    `json:"count"`
 	Timeout   int    `json:"timeout"` // 超时时间(毫秒)
 	RequestId string `json:"requestId,omitempty"`
+	probeDNSOptions
 }
 
 // TcpPingResponse TCP ping响应结构体
@@ -285,6 +299,9 @@ func (w *WebSocketReporter) handleConnection() {
 	// 启动消息接收goroutine
 	go w.receiveMessages()
 
+	// 上报协议版本与支持的命令，完成能力协商
+	w.sendHello()
+
 	// 主发送循环
 	ticker := time.NewTicker(w.pingInterval)
 	defer ticker.Stop()
@@ -315,7 +332,7 @@ func (w *WebSocketReporter) handleConnection() {
 
 // collectSystemInfo 收集系统信息
 func (w *WebSocketReporter) collectSystemInfo() SystemInfo {
-	networkStats := getNetworkStats()
+	interfaces, networkStats := getInterfaceStats()
 	cpuInfo := getCPUInfo()
 	memoryInfo := getMemoryInfo()
 
@@ -325,6 +342,14 @@ func (w *WebSocketReporter) collectSystemInfo() SystemInfo {
 		BytesTransmitted: networkStats.BytesTransmitted,
 		CPUUsage:         cpuInfo.Usage,
 		MemoryUsage:      memoryInfo.Usage,
+		CPUCores:         cpuInfo.Cores,
+		Interfaces:       interfaces,
+		Load:             getLoadInfo(),
+		Disk:             getDiskInfo(),
+		Sockets:          getSocketStats(),
+		Services:         getServiceConnStats(),
+		Health:           health.DefaultChecker().Snapshot(),
+		Limiters:         getLimiterHitStats(),
 	}
 }
 
@@ -484,14 +509,7 @@ func (w *WebSocketReporter) handleReceivedMessage(messageType int, message []byt
 				return
 			}
 
-			if cmdMsg.Type != "call" {
-				// 其他状态变更命令保持同步，确保顺序执行
-				if cmdMsg.Type == "TcpPing" || cmdMsg.Type == "UpgradeAgent" || cmdMsg.Type == "RollbackAgent" {
-					go w.routeCommand(cmdMsg)
-				} else {
-					w.routeCommand(cmdMsg)
-				}
-			}
+			w.dispatchCommand(cmdMsg)
 		} else {
 			// 处理普通消息
 			var cmdMsg CommandMessage
@@ -500,14 +518,7 @@ func (w *WebSocketReporter) handleReceivedMessage(messageType int, message []byt
 				w.sendErrorResponse("ParseError", fmt.Sprintf("解析命令失败: %v", err))
 				return
 			}
-			if cmdMsg.Type != "call" {
-				// 其他状态变更命令保持同步，确保顺序执行
-				if cmdMsg.Type == "TcpPing" || cmdMsg.Type == "UpgradeAgent" || cmdMsg.Type == "RollbackAgent" {
-					go w.routeCommand(cmdMsg)
-				} else {
-					w.routeCommand(cmdMsg)
-				}
-			}
+			w.dispatchCommand(cmdMsg)
 		}
 
 	default:
@@ -515,6 +526,16 @@ func (w *WebSocketReporter) handleReceivedMessage(messageType int, message []byt
 	}
 }
 
+// dispatchCommand 按注册信息决定命令同步或异步执行
+func (w *WebSocketReporter) dispatchCommand(cmd CommandMessage) {
+	// 耗时命令异步执行，其他状态变更命令保持同步，确保顺序执行
+	if spec, ok := lookupCommand(cmd.Type); ok && spec.Async {
+		go w.routeCommand(cmd)
+		return
+	}
+	w.routeCommand(cmd)
+}
+
 // routeCommand 路由命令到对应的处理函数
 func (w *WebSocketReporter) routeCommand(cmd CommandMessage) {
 	jsonBytes, errs := json.Marshal(cmd)
@@ -525,105 +546,32 @@ func (w *WebSocketReporter) routeCommand(cmd CommandMessage) {
 
 	fmt.Println("🔔 收到命令: ", string(jsonBytes))
 	var err error
-	var response CommandResponse
-	var needSaveConfig bool // 标记是否需要保存配置（只有状态变更命令才需要）
-
-	// 传递 requestId
-	response.RequestId = cmd.RequestId
-
-	switch cmd.Type {
-	// Service 相关命令
-	case "AddService":
-		err = w.handleAddService(cmd.Data)
-		response.Type = "AddServiceResponse"
-		needSaveConfig = true
-	case "UpdateService":
-		err = w.handleUpdateService(cmd.Data)
-		response.Type = "UpdateServiceResponse"
-		needSaveConfig = true
-	case "DeleteService":
-		err = w.handleDeleteService(cmd.Data)
-		response.Type = "DeleteServiceResponse"
-		needSaveConfig = true
-	case "PauseService":
-		err = w.handlePauseService(cmd.Data)
-		response.Type = "PauseServiceResponse"
-		needSaveConfig = true
-	case "ResumeService":
-		err = w.handleResumeService(cmd.Data)
-		response.Type = "ResumeServiceResponse"
-		needSaveConfig = true
-
-	// Chain 相关命令
-	case "AddChains":
-		err = w.handleAddChain(cmd.Data)
-		response.Type = "AddChainsResponse"
-		needSaveConfig = true
-	case "UpdateChains":
-		err = w.handleUpdateChain(cmd.Data)
-		response.Type = "UpdateChainsResponse"
-		needSaveConfig = true
-	case "DeleteChains":
-		err = w.handleDeleteChain(cmd.Data)
-		response.Type = "DeleteChainsResponse"
-		needSaveConfig = true
-
-	// Limiter 相关命令
-	case "AddLimiters":
-		err = w.handleAddLimiter(cmd.Data)
-		response.Type = "AddLimitersResponse"
-		needSaveConfig = true
-	case "UpdateLimiters":
-		err = w.handleUpdateLimiter(cmd.Data)
-		response.Type = "UpdateLimitersResponse"
-		needSaveConfig = true
-	case "DeleteLimiters":
-		err = w.handleDeleteLimiter(cmd.Data)
-		response.Type = "DeleteLimitersResponse"
-		needSaveConfig = true
-
-	// TCP Ping 诊断命令（只读，不需要保存配置）
-	case "TcpPing":
-		var tcpPingResult TcpPingResponse
-		tcpPingResult, err = w.handleTcpPing(cmd.Data)
-		response.Type = "TcpPingResponse"
-		response.Data = tcpPingResult
-		// needSaveConfig = false (默认值)
-
-	// Protocol blocking switches
-	case "SetProtocol":
-		err = w.handleSetProtocol(cmd.Data)
-		response.Type = "SetProtocolResponse"
-		needSaveConfig = true
-
-	// 升级 Agent 命令（异步执行，不需要保存配置）
-	case "UpgradeAgent":
-		err = w.handleUpgradeAgent(cmd.Data)
-		response.Type = "UpgradeAgentResponse"
-		// needSaveConfig = false (默认值)
-
-	// 回退 Agent 到旧版本
-	case "RollbackAgent":
-		err = w.handleRollbackAgent(cmd.Data)
-		response.Type = "RollbackAgentResponse"
-		// needSaveConfig = false (默认值)
-
-	default:
-		err = fmt.Errorf("未知命令类型: %s", cmd.Type)
-		response.Type = "UnknownCommandResponse"
+	response := CommandResponse{
+		Type:      cmd.Type + "Response",
+		RequestId: cmd.RequestId, // 传递 requestId
 	}
 
-	// 只有状态变更命令才保存配置
-	if needSaveConfig {
-		if saveErr := saveConfig(); saveErr != nil {
-			fmt.Printf("❌ 保存配置失败: %v\n", saveErr)
-			if err == nil {
-				err = fmt.Errorf("保存配置失败: %v", saveErr)
+	spec, ok := lookupCommand(cmd.Type)
+	switch {
+	case !ok:
+		err = newRPCError(rpcErrUnknownCommand, "未知命令类型: %s", cmd.Type)
+		response.Type = "UnknownCommandResponse"
+	case cmd.Version > rpcSchemaVersion:
+		err = newRPCError(rpcErrUnsupportedVersion, "不支持的命令版本: %d (当前支持 %d)", cmd.Version, rpcSchemaVersion)
+	default:
+		response.Data, err = spec.Handler(w, cmd.Data)
+		// 只有状态变更命令才保存配置
+		if spec.SaveConfig {
+			if saveErr := saveConfig(); saveErr != nil {
+				fmt.Printf("❌ 保存配置失败: %v\n", saveErr)
+				if err == nil {
+					err = fmt.Errorf("保存配置失败: %v", saveErr)
+				} else {
+					err = fmt.Errorf("%v; 保存配置失败: %v", err, saveErr)
+				}
 			} else {
-				err = fmt.Errorf("%v; 保存配置失败: %v", err, saveErr)
+				fmt.Println("✅ 配置已保存到 gost.json")
 			}
-		} else {
-			fmt.Println("✅ 配置已保存到 gost.json")
 		}
 	}
 
@@ -631,6 +579,7 @@ func (w *WebSocketReporter) routeCommand(cmd CommandMessage) {
 	if err != nil {
 		response.Success = false
 		response.Message = err.Error()
+		response.Code = rpcErrorCode(err)
 	} else {
 		response.Success = true
 		response.Message = "OK"
@@ -861,6 +810,67 @@ func (w *WebSocketReporter) handleDeleteLimiter(data interface{}) error {
 	return deleteLimiter(deleteReq)
 }
 
+// 连接数 / 新建连接速率限流器命令处理函数
+func decodeConnLimiterConfig(data interface{}) (config.LimiterConfig, error) {
+	var limiterConfig config.LimiterConfig
+	jsonData, err := json.Marshal(data)
+	if err != nil {
+		return limiterConfig, fmt.Errorf("序列化数据失败: %v", err)
+	}
+	if err := json.Unmarshal(jsonData, &limiterConfig); err != nil {
+		return limiterConfig, fmt.Errorf("解析限流器配置失败: %v", err)
+	}
+	return limiterConfig, nil
+}
+
+func decodeConnLimiterName(data interface{}) (string, error) {
+	jsonData, err := json.Marshal(data)
+	if err != nil {
+		return "", fmt.Errorf("序列化数据失败: %v", err)
+	}
+	var deleteReq deleteLimiterRequest
+	if err := json.Unmarshal(jsonData, &deleteReq); err != nil {
+		var limiterName string
+		if err := json.Unmarshal(jsonData, &limiterName); err != nil {
+			return "", fmt.Errorf("解析限流器删除请求失败: %v", err)
+		}
+		return limiterName, nil
+	}
+	return deleteReq.Limiter, nil
+}
+
+func (w *WebSocketReporter) handleUpsertCLimiter(data interface{}) error {
+	limiterConfig, err := decodeConnLimiterConfig(data)
+	if err != nil {
+		return err
+	}
+	return upsertConnLimiter(limiterKindConn, limiterConfig)
+}
+
+func (w *WebSocketReporter) handleDeleteCLimiter(data interface{}) error {
+	name, err := decodeConnLimiterName(data)
+	if err != nil {
+		return err
+	}
+	return deleteConnLimiter(limiterKindConn, name)
+}
+
+func (w *WebSocketReporter) handleUpsertRLimiter(data interface{}) error {
+	limiterConfig, err := decodeConnLimiterConfig(data)
+	if err != nil {
+		return err
+	}
+	return upsertConnLimiter(limiterKindRate, limiterConfig)
+}
+
+func (w *WebSocketReporter) handleDeleteRLimiter(data interface{}) error {
+	name, err := decodeConnLimiterName(data)
+	if err != nil {
+		return err
+	}
+	return deleteConnLimiter(limiterKindRate, name)
+}
+
 // handleSetProtocol 处理设置屏蔽协议的命令
 func (w *WebSocketReporter) handleSetProtocol(data interface{}) error {
 	jsonData, err := json.Marshal(data)
@@ -924,6 +934,22 @@ func (w *WebSocketReporter) sendUpgradeProgress(stage string, percent int, messa
 	w.sendResponse(response)
 }
 
+// sendUpgradeFailure 通过 WS 发送升级失败消息，面板据此展示校验失败原因
+func (w *WebSocketReporter) sendUpgradeFailure(stage string, err error) error {
+	response := CommandResponse{
+		Type:    "UpgradeProgress",
+		Success: false,
+		Message: err.Error(),
+		Data: map[string]interface{}{
+			"stage":   stage,
+			"percent": 100,
+			"failed":  true,
+		},
+	}
+	w.sendResponse(response)
+	return err
+}
+
 func (w *WebSocketReporter) handleUpgradeAgent(data interface{}) error {
 	jsonData, err := json.Marshal(data)
 	if err != nil {
@@ -931,8 +957,9 @@ func (w *WebSocketReporter) handleUpgradeAgent(data interface{}) error {
 	}
 
 	var req struct {
-		DownloadURL string `json:"downloadUrl"`
-		ChecksumURL string `json:"checksumUrl"`
+		DownloadURL  string `json:"downloadUrl"`
+		ChecksumURL  string `json:"checksumUrl"`
+		SignatureURL string `json:"signatureUrl"`
 	}
 	if err := json.Unmarshal(jsonData, &req); err != nil {
 		return fmt.Errorf("解析升级参数失败: %v", err)
@@ -944,6 +971,15 @@ func (w *WebSocketReporter) handleUpgradeAgent(data interface{}) error {
 	// 替换架构占位符
 	downloadURL := strings.ReplaceAll(req.DownloadURL, "{ARCH}", runtime.GOARCH)
 	checksumURL := strings.ReplaceAll(req.ChecksumURL, "{ARCH}", runtime.GOARCH)
+	signatureURL := strings.ReplaceAll(req.SignatureURL, "{ARCH}", runtime.GOARCH)
+
+	// 未内置公钥或未提供签名时直接拒绝，避免无意义的下载
+	if _, err := release.PublicKey(); err != nil {
+		return w.sendUpgradeFailure("verify_failed", err)
+	}
+	if strings.TrimSpace(signatureURL) == "" {
+		return w.sendUpgradeFailure("verify_failed", fmt.Errorf("缺少签名地址，拒绝未签名的升级"))
+	}
 
 	w.sendUpgradeProgress("downloading", 0, "开始下载升级包...")
 	fmt.Printf("📦 开始下载升级包: %s\n", downloadURL)
@@ -1011,9 +1047,9 @@ func (w *WebSocketReporter) handleUpgradeAgent(data interface{}) error {
 
 	w.sendUpgradeProgress("downloading", 100, fmt.Sprintf("下载完成 (%d bytes)", downloaded))
 
-	// Checksum 校验
+	// Checksum 校验（可选，仅用于尽早发现传输损坏）
+	w.sendUpgradeProgress("verifying", 0, "校验文件完整性...")
 	if checksumURL != "" {
-		w.sendUpgradeProgress("verifying", 0, "校验文件完整性...")
 		checksumResp, err := http.Get(checksumURL)
 		if err == nil {
 			defer checksumResp.Body.Close()
@@ -1025,15 +1061,23 @@ func (w *WebSocketReporter) handleUpgradeAgent(data interface{}) error {
 					actualHash := hex.EncodeToString(hasher.Sum(nil))
 					if !strings.EqualFold(expectedHash, actualHash) {
 						os.Remove(tmpPath)
-						return fmt.Errorf("校验失败: 期望 %s, 实际 %s", expectedHash, actualHash)
+						return w.sendUpgradeFailure("verify_failed", fmt.Errorf("校验失败: 期望 %s, 实际 %s", expectedHash, actualHash))
 					}
 					fmt.Printf("✅ Checksum 校验通过: %s\n", actualHash)
 				}
 			}
 		}
-		w.sendUpgradeProgress("verifying", 100, "校验通过")
 	}
 
+	// 签名校验（必须），checksum 与二进制可能被同一镜像同时篡改
+	w.sendUpgradeProgress("verifying", 50, "校验发布签名...")
+	if err := release.VerifyFile(tmpPath, signatureURL); err != nil {
+		os.Remove(tmpPath)
+		return w.sendUpgradeFailure("verify_failed", err)
+	}
+	fmt.Println("✅ 发布签名校验通过")
+	w.sendUpgradeProgress("verifying", 100, "签名校验通过")
+
 	if err := os.Chmod(tmpPath, 0755); err != nil {
 		os.Remove(tmpPath)
 		return fmt.Errorf("设置执行权限失败: %v", err)
@@ -1120,43 +1164,6 @@ func updateLocalConfigJSON(httpVal int, tlsVal int, socksVal int) error {
 	return os.WriteFile(path, data, 0644)
 }
 
-// handleCall 处理服务端的call回调消息
-func (w *WebSocketReporter) handleCall(data interface{}) error {
-	// 解析call数据
-	jsonData, err := json.Marshal(data)
-	if err != nil {
-		return fmt.Errorf("序列化call数据失败: %v", err)
-	}
-
-	// 可以根据call的具体内容进行不同的处理
-	var callData map[string]interface{}
-	if err := json.Unmarshal(jsonData, &callData); err != nil {
-		return fmt.Errorf("解析call数据失败: %v", err)
-	}
-
-	fmt.Printf("🔔 收到服务端call回调: %v\n", callData)
-
-	// 根据call的类型执行不同的操作
-	if callType, exists := callData["type"]; exists {
-		switch callType {
-		case "ping":
-			fmt.Printf("📡 收到ping，发送pong回应\n")
-			// 可以在这里发送pong响应
-		case "info_request":
-			fmt.Printf("📊 服务端请求额外信息\n")
-			// 可以在这里发送额外的系统信息
-		case "command":
-			fmt.Printf("⚡ 服务端发送执行命令\n")
-			// 可以在这里执行特定命令
-		default:
-			fmt.Printf("❓ 未知的call类型: %v\n", callType)
-		}
-	}
-
-	// 简单返回成功，表示call已被处理
-	return nil
-}
-
 // sendResponse 发送响应消息到服务端
 func (w *WebSocketReporter) sendResponse(response CommandResponse) {
 	w.connMutex.Lock()
@@ -1235,38 +1242,19 @@ func getUptime() uint64 {
 	return uptime
 }
 
-// getNetworkStats 获取网络统计信息
-func getNetworkStats() NetworkStats {
-	var stats NetworkStats
-
-	ioCounters, err := psnet.IOCounters(true)
-	if err != nil {
-		fmt.Printf("获取网络统计失败: %v\n", err)
-		return stats
-	}
-
-	// 汇总所有非回环接口的流量
-	for _, io := range ioCounters {
-		// 跳过回环接口
-		if io.Name == "lo" || strings.HasPrefix(io.Name, "lo") {
-			continue
-		}
-
-		stats.BytesReceived += io.BytesRecv
-		stats.BytesTransmitted += io.BytesSent
-	}
-
-	return stats
-}
-
 // getCPUInfo 获取CPU信息
 func getCPUInfo() CPUInfo {
 	var cpuInfo CPUInfo
 
-	// 获取CPU使用率
-	percentages, err := cpu.Percent(time.Second, false)
+	// 按核心采样，整体使用率取各核心平均值
+	percentages, err := cpu.Percent(time.Second, true)
 	if err == nil && len(percentages) > 0 {
-		cpuInfo.Usage = percentages[0]
+		var total float64
+		for _, p := range percentages {
+			total += p
+		}
+		cpuInfo.Usage = total / float64(len(percentages))
+		cpuInfo.Cores = percentages
 	}
 
 	return cpuInfo
@@ -1304,17 +1292,7 @@ func StartWebSocketReporterWithConfig(addr string, secret string, http int, tls
 }
 
 // handleTcpPing 处理TCP ping诊断命令
-func (w *WebSocketReporter) handleTcpPing(data interface{}) (TcpPingResponse, error) {
-	jsonData, err := json.Marshal(data)
-	if err != nil {
-		return TcpPingResponse{}, fmt.Errorf("序列化TCP ping数据失败: %v", err)
-	}
-
-	var req TcpPingRequest
-	if err := json.Unmarshal(jsonData, &req); err != nil {
-		return TcpPingResponse{}, fmt.Errorf("解析TCP ping请求失败: %v", err)
-	}
-
+func (w *WebSocketReporter) handleTcpPing(req TcpPingRequest) (TcpPingResponse, error) {
 	// 验证IP地址格式
 	if net.ParseIP(req.IP) == nil && !isValidHostname(req.IP) {
 		return TcpPingResponse{
@@ -1345,8 +1323,24 @@ func (w *WebSocketReporter) handleTcpPing(data interface{}) (TcpPingResponse, er
 		req.Timeout = 5000 // 默认5秒超时
 	}
 
+	// 按面板解析策略预先解析目标域名
+	host := req.IP
+	resolved, err := resolvePingTarget(req.IP, req.Port, req.Timeout, req.probeDNSOptions)
+	if err != nil {
+		return TcpPingResponse{
+			IP:           req.IP,
+			Port:         req.Port,
+			Success:      false,
+			ErrorMessage: fmt.Sprintf("DNS解析失败: %v", err),
+			RequestId:    req.RequestId,
+		}, nil
+	}
+	if resolved != "" {
+		host, _, _ = net.SplitHostPort(resolved)
+	}
+
 	// 执行TCP ping操作
-	avgTime, packetLoss, err := tcpPingHost(req.IP, req.Port, req.Count, req.Timeout)
+	avgTime, packetLoss, err := tcpPingHost(host, req.Port, req.Count, req.Timeout)
 
 	response := TcpPingResponse{
 		IP:        req.IP,
@@ -81,9 +81,31 @@ build_download_url() {
     echo "https://github.com/${REPO}/releases/download/${RESOLVED_VERSION}/gost-${ARCH}"
 }
 
-# 解析版本并构建下载地址
+# 解析版本并构建下载地址；设置 DOWNLOAD_BASE 时直接从面板制品缓存下载
 RESOLVED_VERSION=$(resolve_version) || exit 1
-DOWNLOAD_URL=$(maybe_proxy_url "$(build_download_url)")
+if [[ -n "${DOWNLOAD_BASE:-}" ]]; then
+  DOWNLOAD_URL="${DOWNLOAD_BASE%/}/gost-$(get_architecture)"
+else
+  DOWNLOAD_URL=$(maybe_proxy_url "$(build_download_url)")
+fi
+
+# 校验从面板制品缓存下载的文件与其 .sha256 一致
+verify_download() {
+  local file="$1"
+  [[ -n "${DOWNLOAD_BASE:-}" ]] || return 0
+  local expected actual
+  expected=$(curl -fsSL "${DOWNLOAD_URL}.sha256" 2>/dev/null | awk '{print $1}')
+  if [[ -z "$expected" ]]; then
+    echo "❌ 获取校验文件失败: ${DOWNLOAD_URL}.sha256"
+    return 1
+  fi
+  actual=$(sha256sum "$file" | awk '{print $1}')
+  if [[ "$expected" != "$actual" ]]; then
+    echo "❌ 文件校验失败，期望 $expected，实际 $actual"
+    return 1
+  fi
+  echo "✅ 文件校验通过"
+}
 
 
 
@@ -235,6 +257,10 @@ install_flux_agent() {
     echo "❌ 下载失败，请检查网络或下载链接。"
     exit 1
   fi
+  if ! verify_download "$INSTALL_DIR/flux_agent"; then
+    rm -f "$INSTALL_DIR/flux_agent"
+    exit 1
+  fi
   chmod +x "$INSTALL_DIR/flux_agent"
   echo "✅ 下载完成"
 
@@ -321,6 +347,10 @@ update_flux_agent() {
     echo "❌ 下载失败。"
     return 1
   fi
+  if ! verify_download "$INSTALL_DIR/flux_agent.new"; then
+    rm -f "$INSTALL_DIR/flux_agent.new"
+    return 1
+  fi
 
   # 停止服务
   if systemctl list-units --full -all | grep -Fq "flux_agent.service"; then
@@ -1,13 +1,23 @@
 import type {
+  AccessLogApiData,
+  AccessLogQuery,
   BatchOperationResult,
   ForwardDiagnosisApiData,
   ForwardApiItem,
+  ForwardHealthApiData,
+  ForwardLimitsApiData,
   GroupPermissionApiItem,
   NodeReleaseApiItem,
+  NodeArtifactApiItem,
+  NodeMetricsHistoryApiData,
   NodeApiItem,
   SpeedLimitApiItem,
   TunnelDiagnosisApiData,
   TunnelGroupApiItem,
+  TunnelHealthApiData,
+  TunnelThroughputApiData,
+  TunnelThroughputTestPayload,
+  UdpProbeOptions,
   UserApiItem,
   UserGroupApiItem,
   UserListQuery,
@@ -105,6 +115,61 @@ export const getNodeReleases = (channel: ReleaseChannel = "stable") =>
   Network.post<NodeReleaseApiItem[]>("/node/releases", { channel });
 export const rollbackNode = (id: number) =>
   Network.post("/node/rollback", { id });
+export const createUpgradeCampaign = (data: {
+  ids: number[];
+  version?: string;
+  channel?: ReleaseChannel;
+  canaryPercent?: number;
+  waveSize?: number;
+  healthTimeout?: number;
+}) => Network.post("/node/upgrade-campaign/create", data);
+export const getUpgradeCampaignList = () =>
+  Network.post("/node/upgrade-campaign/list");
+export const getUpgradeCampaign = (id: number) =>
+  Network.post("/node/upgrade-campaign/get", { id });
+export const cancelUpgradeCampaign = (id: number) =>
+  Network.post("/node/upgrade-campaign/cancel", { id });
+export const uploadNodeArtifact = (payload: {
+  version: string;
+  kind: "binary" | "install";
+  arch?: string;
+  file: File;
+  signature?: File;
+}) => {
+  const form = new FormData();
+
+  form.append("version", payload.version);
+  form.append("kind", payload.kind);
+  if (payload.arch) form.append("arch", payload.arch);
+  form.append("file", payload.file);
+  if (payload.signature) form.append("signature", payload.signature);
+
+  return Network.post("/node/artifact/upload", form, { timeout: 600000 });
+};
+export const getNodeArtifacts = () =>
+  Network.post<NodeArtifactApiItem[]>("/node/artifact/list");
+export const deleteNodeArtifact = (version: string, name?: string) =>
+  Network.post("/node/artifact/delete", { version, name });
+export const setNodeMaintenance = (
+  id: number,
+  enabled: boolean,
+  drain?: boolean,
+  drainTimeout?: number,
+) => Network.post("/node/maintenance", { id, enabled, drain, drainTimeout });
+export const getNodeMaintenanceStatus = (id: number) =>
+  Network.post("/node/maintenance/status", { id });
+export const getNodeMetricsHistory = (
+  nodeId: number,
+  start?: number,
+  end?: number,
+  interval?: number,
+) =>
+  Network.post<NodeMetricsHistoryApiData>("/node/metrics", {
+    nodeId,
+    start,
+    end,
+    interval,
+  });
 
 // 隧道CRUD操作 - 全部使用POST请求
 export const createTunnel = (data: TunnelMutationPayload) =>
@@ -117,8 +182,15 @@ export const updateTunnel = (data: TunnelMutationPayload) =>
   Network.post("/tunnel/update", data);
 export const deleteTunnel = (id: number) =>
   Network.post("/tunnel/delete", { id });
-export const diagnoseTunnel = (tunnelId: number) =>
-  Network.post<TunnelDiagnosisApiData>("/tunnel/diagnose", { tunnelId });
+export const diagnoseTunnel = (
+  tunnelId: number,
+  udp?: boolean | UdpProbeOptions,
+) =>
+  Network.post<TunnelDiagnosisApiData>("/tunnel/diagnose", { tunnelId, udp });
+export const testTunnelThroughput = (payload: TunnelThroughputTestPayload) =>
+  Network.post<TunnelThroughputApiData>("/tunnel/throughput-test", payload);
+export const getTunnelHealth = (tunnelId: number) =>
+  Network.post<TunnelHealthApiData>("/tunnel/health", { tunnelId });
 export const updateTunnelOrder = (data: {
   tunnels: Array<{ id: number; inx: number }>;
 }) => Network.post("/tunnel/update-order", data);
@@ -158,8 +230,20 @@ export const resumeForwardService = (forwardId: number) =>
   Network.post("/forward/resume", { id: forwardId });
 
 // 转发诊断操作
-export const diagnoseForward = (forwardId: number) =>
-  Network.post<ForwardDiagnosisApiData>("/forward/diagnose", { forwardId });
+export const diagnoseForward = (
+  forwardId: number,
+  udp?: boolean | UdpProbeOptions,
+) =>
+  Network.post<ForwardDiagnosisApiData>("/forward/diagnose", {
+    forwardId,
+    udp,
+  });
+export const getForwardHealth = (forwardId: number) =>
+  Network.post<ForwardHealthApiData>("/forward/health", { forwardId });
+export const getForwardLimits = (forwardId: number) =>
+  Network.post<ForwardLimitsApiData>("/forward/limits", { forwardId });
+export const getForwardAccessLogs = (query: AccessLogQuery) =>
+  Network.post<AccessLogApiData>("/forward/access-log", query);
 
 // 转发排序操作
 export const updateForwardOrder = (data: {
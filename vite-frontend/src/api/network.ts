@@ -146,7 +146,10 @@ const Network = {
           timeout: options.timeout ?? 30000,
           headers: {
             Authorization: getToken(),
-            "Content-Type": "application/json",
+            // FormData 由浏览器自动设置 multipart 边界
+            ...(data instanceof FormData
+              ? {}
+              : { "Content-Type": "application/json" }),
           },
         })
         .then(function (response: AxiosResponse<ApiResponse<T>>) {
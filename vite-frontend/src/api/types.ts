@@ -3,6 +3,7 @@ export interface NodeApiItem {
   name: string;
   status: number;
   inx?: number;
+  maintenance?: number;
   syncError?: string;
   [key: string]: unknown;
 }
@@ -18,6 +19,9 @@ export interface UserApiItem {
   flowResetTime?: number;
   inFlow?: number;
   outFlow?: number;
+  bandwidthUp?: number;
+  bandwidthDown?: number;
+  bandwidthBurst?: number;
   [key: string]: unknown;
 }
 
@@ -36,6 +40,11 @@ export interface TunnelApiItem {
   entryNodeId: number;
   exitNodeId: number;
   inx?: number;
+  healthCheck?: string;
+  chainMode?: string;
+  transportOptions?: string;
+  accessRules?: string;
+  dnsPolicy?: string;
   [key: string]: unknown;
 }
 
@@ -52,6 +61,20 @@ export interface ForwardApiItem {
   userId?: number;
   tunnelId?: number;
   inx?: number;
+  healthCheck?: string;
+  targetOptions?: string;
+  maxConns?: number;
+  connRate?: number;
+  accessRules?: string;
+  proxyAccept?: number;
+  proxySend?: number;
+  ipSpeed?: number;
+  connSpeed?: number;
+  schedule?: string;
+  accessLog?: number;
+  muxHost?: string | null; // TLS SNI / HTTP Host on a shared entry port
+  portCount?: number; // consecutive entry ports starting at inPort
+  dnsPolicy?: string;
   [key: string]: unknown;
 }
 
@@ -78,6 +101,10 @@ export interface UserTunnelPermissionApiItem {
   flowResetTime: number;
   speedId?: number | null;
   speedLimitName?: string;
+  maxConns?: number;
+  connRate?: number;
+  ipSpeed?: number;
+  connSpeed?: number;
   inFlow: number;
   outFlow: number;
   tunnelFlow?: number;
@@ -104,6 +131,7 @@ export interface SpeedLimitApiItem {
   updatedTime: string;
   uploadSpeed?: number;
   downloadSpeed?: number;
+  profiles?: string;
   [key: string]: unknown;
 }
 
@@ -147,6 +175,12 @@ export interface TunnelDiagnosisApiItem {
   message?: string;
   averageTime?: number;
   packetLoss?: number;
+  protocol?: "udp";
+  jitter?: number;
+  minTime?: number;
+  maxTime?: number;
+  sent?: number;
+  received?: number;
   fromChainType?: number;
   fromInx?: number;
   toChainType?: number;
@@ -154,11 +188,68 @@ export interface TunnelDiagnosisApiItem {
   [key: string]: unknown;
 }
 
+export interface UdpProbeOptions {
+  payload?: string;
+  count?: number;
+  timeout?: number;
+}
+
+export interface TunnelHopLatencyApiItem {
+  description: string;
+  fromChainType: number;
+  fromInx: number;
+  toChainType: number;
+  toInx: number;
+  total: number;
+  success: number;
+  bestTime: number;
+  averageTime: number;
+}
+
 export interface TunnelDiagnosisApiData {
   tunnelName: string;
   tunnelType: string;
   timestamp: number;
   results: TunnelDiagnosisApiItem[];
+  chainMode?: TunnelChainMode;
+  hops?: TunnelHopLatencyApiItem[];
+  estimatedLatency?: number;
+}
+
+export type ThroughputDirection = "upload" | "download";
+
+export interface TunnelThroughputTestPayload {
+  tunnelId: number;
+  inNodeId?: number;
+  direction?: ThroughputDirection;
+  duration?: number;
+  maxMb?: number;
+}
+
+export interface TunnelThroughputApiData {
+  testId: string;
+  tunnelId: number;
+  nodeId: number;
+  nodeName: string;
+  direction: ThroughputDirection;
+  success: boolean;
+  message: string;
+  bytes: number;
+  elapsedTime: number;
+  mbps: number;
+  averageRtt: number;
+  minRtt: number;
+  maxRtt: number;
+  timestamp: number;
+}
+
+export interface ThroughputProgressData {
+  testId: string;
+  direction: ThroughputDirection;
+  bytes: number;
+  elapsedTime: number;
+  mbps: number;
+  done: boolean;
 }
 
 export interface ForwardDiagnosisApiData {
@@ -167,12 +258,183 @@ export interface ForwardDiagnosisApiData {
   results: TunnelDiagnosisApiItem[];
 }
 
+export interface HealthCheckConfig {
+  type: "tcp" | "udp" | "http";
+  interval?: number;
+  timeout?: number;
+  fails?: number;
+  passes?: number;
+  path?: string;
+  status?: number;
+  send?: string;
+  expect?: string;
+}
+
+export interface HealthStatusApiItem {
+  nodeId: number;
+  nodeName: string;
+  owner: string;
+  target: string;
+  type: string;
+  up: boolean;
+  checked: boolean;
+  latency: number;
+  error?: string;
+  checkedAt: number;
+  since: number;
+  protocol?: string;
+}
+
+export interface ForwardHealthApiData {
+  forwardId: number;
+  healthCheck: HealthCheckConfig | null;
+  targets: HealthStatusApiItem[];
+  offlineNodes: number[];
+}
+
+export interface AccessRules {
+  allow?: string[];
+  deny?: string[];
+  allowCountries?: string[];
+  denyCountries?: string[];
+  geoipFile?: string;
+}
+
+export interface DnsHostEntry {
+  host: string;
+  ip: string;
+}
+
+export interface DnsPolicy {
+  servers?: string[]; // udp://, tcp://, tls:// (DoT) or https:// (DoH); bare address = UDP
+  prefer?: "ipv4" | "ipv6" | "";
+  ttl?: number; // seconds; 0 = record TTL
+  hosts?: DnsHostEntry[];
+}
+
+export interface ScheduleWindow {
+  days?: number[]; // 0 = Sunday; empty = every day
+  start: string; // HH:MM
+  end: string; // HH:MM, earlier than start wraps past midnight
+}
+
+export interface ForwardSchedule {
+  timezone?: string;
+  windows: ScheduleWindow[];
+}
+
+export interface SpeedProfiles {
+  timezone?: string;
+  profiles: Array<ScheduleWindow & { speed: number }>;
+}
+
+export interface ConnLimiterApiItem {
+  name: string;
+  kind: "conn" | "rate";
+  scope: "forward" | "userTunnel";
+  limit: number;
+}
+
+export interface ConnLimiterHitApiItem {
+  nodeId: number;
+  nodeName: string;
+  name: string;
+  kind: "conn" | "rate";
+  rejected: number;
+}
+
+export interface ForwardLimitsApiData {
+  forwardId: number;
+  maxConns: number;
+  connRate: number;
+  limiters: ConnLimiterApiItem[];
+  hits: ConnLimiterHitApiItem[];
+  offlineNodes: number[];
+}
+
+export interface AccessLogQuery {
+  forwardId?: number;
+  userId?: number;
+  clientIp?: string;
+  start?: number;
+  end?: number;
+  page?: number;
+  size?: number;
+}
+
+export interface AccessLogApiItem {
+  id: number;
+  forwardId: number;
+  userId: number;
+  nodeId: number;
+  network: string;
+  clientIp: string;
+  target: string;
+  inBytes: number;
+  outBytes: number;
+  durationMs: number;
+  error: string;
+  time: number;
+}
+
+export interface AccessLogApiData {
+  total: number;
+  list: AccessLogApiItem[];
+}
+
+export interface TunnelHealthApiData {
+  tunnelId: number;
+  healthCheck: HealthCheckConfig | null;
+  hops: HealthStatusApiItem[];
+  offlineNodes: number[];
+}
+
 export interface NodeReleaseApiItem {
   version: string;
   name: string;
   publishedAt: string;
   prerelease: boolean;
   channel: "stable" | "dev";
+  local?: boolean;
+}
+
+export interface NodeArtifactFileApiItem {
+  name: string;
+  size: number;
+  sha256: string;
+  signed: boolean;
+}
+
+export interface NodeArtifactApiItem {
+  version: string;
+  channel: "stable" | "dev";
+  uploadedAt: number;
+  install: boolean;
+  files: NodeArtifactFileApiItem[];
+}
+
+export interface NodeMetricPointApiItem {
+  time: number;
+  cpuUsage: number;
+  memoryUsage: number;
+  diskUsage: number;
+  load1: number;
+  load5: number;
+  load15: number;
+  rxBps: number;
+  txBps: number;
+  tcpSockets: number;
+  udpSockets: number;
+  connections: number;
+}
+
+export interface NodeMetricsHistoryApiData {
+  nodeId: number;
+  start: number;
+  end: number;
+  interval: number;
+  points: NodeMetricPointApiItem[];
+  latest?: Record<string, unknown>;
 }
 
 export interface UserPackageInfoApiData {
@@ -208,6 +470,9 @@ export interface UserMutationPayload {
   expTime?: number | string;
   flowResetTime?: number;
   tunnelFlow?: number;
+  bandwidthUp?: number;
+  bandwidthDown?: number;
+  bandwidthBurst?: number;
 }
 
 export interface NodeMutationPayload {
@@ -235,6 +500,49 @@ export interface TunnelChainNodePayload {
   inx?: number;
 }
 
+export type TunnelChainMode = "relay" | "multihop";
+
+export type TunnelProtocol =
+  | "tcp"
+  | "mtcp"
+  | "tls"
+  | "mtls"
+  | "ws"
+  | "wss"
+  | "mws"
+  | "mwss"
+  | "grpc"
+  | "h2"
+  | "h3"
+  | "quic"
+  | "kcp"
+  | "otls"
+  | "ohttp";
+
+export interface TunnelMuxOptions {
+  version?: 1 | 2;
+  keepaliveInterval?: number;
+  keepaliveDisabled?: boolean;
+  maxStreamBuffer?: number;
+}
+
+export interface TunnelTransportOptions {
+  path?: string;
+  host?: string;
+  sni?: string;
+  secure?: boolean;
+  certFile?: string;
+  keyFile?: string;
+  caFile?: string;
+  mux?: TunnelMuxOptions;
+}
+
+export interface TunnelHopGroupPayload {
+  strategy?: string;
+  protocol?: string;
+  nodes: TunnelChainNodePayload[];
+}
+
 export interface TunnelMutationPayload {
   id?: number;
   name?: string;
@@ -246,7 +554,12 @@ export interface TunnelMutationPayload {
   ipPreference?: string;
   inNodeId?: TunnelChainNodePayload[];
   outNodeId?: TunnelChainNodePayload[];
-  chainNodes?: TunnelChainNodePayload[][];
+  chainNodes?: Array<TunnelChainNodePayload[] | TunnelHopGroupPayload>;
+  chainMode?: TunnelChainMode;
+  healthCheck?: HealthCheckConfig | null;
+  transportOptions?: TunnelTransportOptions | null;
+  accessRules?: AccessRules | null;
+  dnsPolicy?: DnsPolicy | null;
 }
 
 export interface UserTunnelAssignPayload {
@@ -259,7 +572,18 @@ export interface UserTunnelAssignPayload {
   flowResetTime?: number;
   status?: number;
   speedId?: number | null;
-  tunnels?: Array<{ tunnelId: number; speedId?: number | null }>;
+  maxConns?: number;
+  connRate?: number;
+  ipSpeed?: number;
+  connSpeed?: number;
+  tunnels?: Array<{
+    tunnelId: number;
+    speedId?: number | null;
+    maxConns?: number;
+    connRate?: number;
+    ipSpeed?: number;
+    connSpeed?: number;
+  }>;
 }
 
 export interface UserTunnelListQuery {
@@ -275,6 +599,12 @@ export interface UserTunnelRemovePayload {
   tunnelId?: number;
 }
 
+export interface ForwardTargetPayload {
+  addr: string;
+  weight?: number;
+  backup?: boolean;
+}
+
 export interface ForwardMutationPayload {
   id?: number;
   name?: string;
@@ -284,6 +614,20 @@ export interface ForwardMutationPayload {
   inPort?: number | null;
   remoteAddr?: string;
   strategy?: string;
+  targets?: ForwardTargetPayload[];
+  healthCheck?: HealthCheckConfig | null;
+  maxConns?: number;
+  connRate?: number;
+  accessRules?: AccessRules | null;
+  proxyAccept?: number;
+  proxySend?: number;
+  ipSpeed?: number;
+  connSpeed?: number;
+  schedule?: ForwardSchedule | null;
+  accessLog?: number | boolean;
+  muxHost?: string; // "*.example.com" matches every subdomain; "" = dedicated port
+  portCount?: number; // 1 = single port; N maps inPort.. to the target port..
+  dnsPolicy?: DnsPolicy | null; // merged over the tunnel's policy
 }
 
 export interface SpeedLimitMutationPayload {
@@ -293,6 +637,7 @@ export interface SpeedLimitMutationPayload {
   status?: number;
   tunnelId?: number | null;
   tunnelName?: string;
+  profiles?: SpeedProfiles | null;
 }
 
 export interface UpdatePasswordPayload {
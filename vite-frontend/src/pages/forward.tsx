@@ -101,6 +101,12 @@ interface Forward {
   userName?: string;
   userId?: number;
   inx?: number;
+  maxConns?: number;
+  connRate?: number;
+  proxyAccept?: number;
+  proxySend?: number;
+  ipSpeed?: number;
+  connSpeed?: number;
 }
 
 interface Tunnel {
@@ -119,6 +125,12 @@ interface ForwardForm {
   remoteAddr: string;
   interfaceName?: string;
   strategy: string;
+  maxConns: number | null;
+  connRate: number | null;
+  proxyAccept: number;
+  proxySend: number;
+  ipSpeed: number | null;
+  connSpeed: number | null;
 }
 
 export default function ForwardPage() {
@@ -197,6 +209,12 @@ export default function ForwardPage() {
     remoteAddr: "",
     interfaceName: "",
     strategy: "fifo",
+    maxConns: null,
+    connRate: null,
+    proxyAccept: 0,
+    proxySend: 0,
+    ipSpeed: null,
+    connSpeed: null,
   });
 
   // 表单验证错误
@@ -339,6 +357,12 @@ export default function ForwardPage() {
       remoteAddr: "",
       interfaceName: "",
       strategy: "fifo",
+      maxConns: null,
+      connRate: null,
+      proxyAccept: 0,
+      proxySend: 0,
+      ipSpeed: null,
+      connSpeed: null,
     });
     setErrors({});
     setModalOpen(true);
@@ -356,6 +380,12 @@ export default function ForwardPage() {
       remoteAddr: forward.remoteAddr.split(",").join("\n"),
       interfaceName: forward.interfaceName || "",
       strategy: forward.strategy || "fifo",
+      maxConns: forward.maxConns || null,
+      connRate: forward.connRate || null,
+      proxyAccept: forward.proxyAccept || 0,
+      proxySend: forward.proxySend || 0,
+      ipSpeed: forward.ipSpeed || null,
+      connSpeed: forward.connSpeed || null,
     });
     setErrors({});
     setModalOpen(true);
@@ -435,6 +465,12 @@ export default function ForwardPage() {
           inPort: form.inPort,
           remoteAddr: processedRemoteAddr,
           strategy: addressCount > 1 ? form.strategy : "fifo",
+          maxConns: form.maxConns ?? 0,
+          connRate: form.connRate ?? 0,
+          proxyAccept: form.proxyAccept,
+          proxySend: form.proxySend,
+          ipSpeed: form.ipSpeed ?? 0,
+          connSpeed: form.connSpeed ?? 0,
         };
 
         res = await updateForward(updateData);
@@ -446,6 +482,12 @@ export default function ForwardPage() {
           inPort: form.inPort,
           remoteAddr: processedRemoteAddr,
           strategy: addressCount > 1 ? form.strategy : "fifo",
+          maxConns: form.maxConns ?? 0,
+          connRate: form.connRate ?? 0,
+          proxyAccept: form.proxyAccept,
+          proxySend: form.proxySend,
+          ipSpeed: form.ipSpeed ?? 0,
+          connSpeed: form.connSpeed ?? 0,
         };
 
         res = await createForward(createData);
@@ -856,6 +898,10 @@ export default function ForwardPage() {
         return { color: "success", text: "轮询" };
       case "rand":
         return { color: "warning", text: "随机" };
+      case "hash":
+        return { color: "secondary", text: "哈希" };
+      case "latency":
+        return { color: "danger", text: "最低延迟" };
       default:
         return { color: "default", text: "未知" };
     }
@@ -2121,8 +2167,128 @@ export default function ForwardPage() {
                       <SelectItem key="round">轮询模式 - 依次轮换</SelectItem>
                       <SelectItem key="rand">随机模式 - 随机选择</SelectItem>
                       <SelectItem key="hash">哈希模式 - IP哈希</SelectItem>
+                      <SelectItem key="latency">
+                        延迟模式 - 最低连接延迟
+                      </SelectItem>
                     </Select>
                   )}
+
+                  <div className="grid grid-cols-2 gap-3">
+                    <Input
+                      description="每个入口节点的并发连接上限，留空不限制"
+                      label="最大连接数"
+                      placeholder="不限制"
+                      type="number"
+                      value={
+                        form.maxConns !== null ? form.maxConns.toString() : ""
+                      }
+                      variant="bordered"
+                      onChange={(e) => {
+                        const value = e.target.value;
+
+                        setForm((prev) => ({
+                          ...prev,
+                          maxConns: value ? parseInt(value) : null,
+                        }));
+                      }}
+                    />
+                    <Input
+                      description="每秒允许新建的连接数，留空不限制"
+                      label="新建连接速率"
+                      placeholder="不限制"
+                      type="number"
+                      value={
+                        form.connRate !== null ? form.connRate.toString() : ""
+                      }
+                      variant="bordered"
+                      onChange={(e) => {
+                        const value = e.target.value;
+
+                        setForm((prev) => ({
+                          ...prev,
+                          connRate: value ? parseInt(value) : null,
+                        }));
+                      }}
+                    />
+                  </div>
+
+                  <div className="grid grid-cols-2 gap-3">
+                    <Input
+                      description="每个客户端 IP 的带宽上限（仅 TCP），留空不限制"
+                      label="单 IP 限速(Mbps)"
+                      placeholder="不限制"
+                      type="number"
+                      value={
+                        form.ipSpeed !== null ? form.ipSpeed.toString() : ""
+                      }
+                      variant="bordered"
+                      onChange={(e) => {
+                        const value = e.target.value;
+
+                        setForm((prev) => ({
+                          ...prev,
+                          ipSpeed: value ? parseInt(value) : null,
+                        }));
+                      }}
+                    />
+                    <Input
+                      description="每条连接的带宽上限（仅 TCP），留空不限制"
+                      label="单连接限速(Mbps)"
+                      placeholder="不限制"
+                      type="number"
+                      value={
+                        form.connSpeed !== null ? form.connSpeed.toString() : ""
+                      }
+                      variant="bordered"
+                      onChange={(e) => {
+                        const value = e.target.value;
+
+                        setForm((prev) => ({
+                          ...prev,
+                          connSpeed: value ? parseInt(value) : null,
+                        }));
+                      }}
+                    />
+                  </div>
+
+                  <div className="grid grid-cols-2 gap-3">
+                    <Select
+                      description="接收上游负载均衡发来的 PROXY 头（仅 TCP）"
+                      label="接收 PROXY 协议"
+                      selectedKeys={[form.proxyAccept.toString()]}
+                      variant="bordered"
+                      onSelectionChange={(keys) => {
+                        const selectedKey = Array.from(keys)[0] as string;
+
+                        setForm((prev) => ({
+                          ...prev,
+                          proxyAccept: parseInt(selectedKey || "0"),
+                        }));
+                      }}
+                    >
+                      <SelectItem key="0">关闭</SelectItem>
+                      <SelectItem key="1">v1</SelectItem>
+                      <SelectItem key="2">v2</SelectItem>
+                    </Select>
+                    <Select
+                      description="向目标发送真实客户端 IP（仅 TCP，经隧道透传）"
+                      label="发送 PROXY 协议"
+                      selectedKeys={[form.proxySend.toString()]}
+                      variant="bordered"
+                      onSelectionChange={(keys) => {
+                        const selectedKey = Array.from(keys)[0] as string;
+
+                        setForm((prev) => ({
+                          ...prev,
+                          proxySend: parseInt(selectedKey || "0"),
+                        }));
+                      }}
+                    >
+                      <SelectItem key="0">关闭</SelectItem>
+                      <SelectItem key="1">v1</SelectItem>
+                      <SelectItem key="2">v2</SelectItem>
+                    </Select>
+                  </div>
                 </div>
               </ModalBody>
               <ModalFooter>
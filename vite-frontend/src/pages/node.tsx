@@ -222,7 +222,10 @@ export default function NodePage() {
   const [selectedVersion, setSelectedVersion] = useState("");
   const [batchUpgradeLoading, setBatchUpgradeLoading] = useState(false);
   const [upgradeProgress, setUpgradeProgress] = useState<
-    Record<number, { stage: string; percent: number; message: string }>
+    Record<
+      number,
+      { stage: string; percent: number; message: string; failed?: boolean }
+    >
   >({});
 
   const handleNodeOffline = useCallback((nodeId: number) => {
@@ -354,6 +357,9 @@ export default function NodePage() {
               stage: progressData.data.stage || "",
               percent: progressData.data.percent || 0,
               message: progressData.message || "",
+              failed:
+                progressData.success === false ||
+                progressData.data.failed === true,
             },
           }));
         }
@@ -1278,12 +1284,17 @@ export default function NodePage() {
                                   </span>
                                 </div>
                                 {upgradeProgress[node.id] &&
-                                  upgradeProgress[node.id].percent < 100 && (
+                                  (upgradeProgress[node.id].percent < 100 ||
+                                    upgradeProgress[node.id].failed) && (
                                     <div className="mt-1">
                                       <Progress
                                         showValueLabel
                                         aria-label="升级进度"
-                                        color="warning"
+                                        color={
+                                          upgradeProgress[node.id].failed
+                                            ? "danger"
+                                            : "warning"
+                                        }
                                         label={upgradeProgress[node.id].message}
                                         size="sm"
                                         value={upgradeProgress[node.id].percent}
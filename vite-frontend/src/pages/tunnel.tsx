@@ -63,7 +63,7 @@ import { extractApiErrorMessage } from "@/api/error-message";
 
 interface ChainTunnel {
   nodeId: number;
-  protocol?: string; // 'tls' | 'wss' | 'tcp' | 'mtls' | 'mwss' | 'mtcp' - 转发链协议
+  protocol?: string; // TunnelProtocol - 转发链协议
   strategy?: string; // 'fifo' | 'round' | 'rand' - 仅转发链需要
   chainType?: number; // 1: 入口, 2: 转发链, 3: 出口
   inx?: number; // 转发链序号
@@ -1530,6 +1530,15 @@ export default function TunnelPage() {
                                     <SelectItem key="mtls">MTLS</SelectItem>
                                     <SelectItem key="mwss">MWSS</SelectItem>
                                     <SelectItem key="mtcp">MTCP</SelectItem>
+                                    <SelectItem key="ws">WS</SelectItem>
+                                    <SelectItem key="mws">MWS</SelectItem>
+                                    <SelectItem key="grpc">gRPC</SelectItem>
+                                    <SelectItem key="h2">HTTP/2</SelectItem>
+                                    <SelectItem key="h3">HTTP/3</SelectItem>
+                                    <SelectItem key="quic">QUIC</SelectItem>
+                                    <SelectItem key="kcp">KCP</SelectItem>
+                                    <SelectItem key="otls">OBFS-TLS</SelectItem>
+                                    <SelectItem key="ohttp">OBFS-HTTP</SelectItem>
                                   </Select>
 
                                   {/* 负载策略 - 25% */}
@@ -1770,6 +1779,15 @@ export default function TunnelPage() {
                           <SelectItem key="mtls">MTLS</SelectItem>
                           <SelectItem key="mwss">MWSS</SelectItem>
                           <SelectItem key="mtcp">MTCP</SelectItem>
+                          <SelectItem key="ws">WS</SelectItem>
+                          <SelectItem key="mws">MWS</SelectItem>
+                          <SelectItem key="grpc">gRPC</SelectItem>
+                          <SelectItem key="h2">HTTP/2</SelectItem>
+                          <SelectItem key="h3">HTTP/3</SelectItem>
+                          <SelectItem key="quic">QUIC</SelectItem>
+                          <SelectItem key="kcp">KCP</SelectItem>
+                          <SelectItem key="otls">OBFS-TLS</SelectItem>
+                          <SelectItem key="ohttp">OBFS-HTTP</SelectItem>
                         </Select>
 
                         {/* 负载策略 - 25% */}
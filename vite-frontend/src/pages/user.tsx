@@ -148,6 +148,9 @@ export default function UserPage() {
     num: 10,
     expTime: null,
     flowResetTime: 0,
+    bandwidthUp: 0,
+    bandwidthDown: 0,
+    bandwidthBurst: 0,
   });
   const [userFormLoading, setUserFormLoading] = useState(false);
 
@@ -317,6 +320,9 @@ export default function UserPage() {
       expTime: null,
       flowResetTime: 0,
       groupIds: [],
+      bandwidthUp: 0,
+      bandwidthDown: 0,
+      bandwidthBurst: 0,
     });
     onUserModalOpen();
   };
@@ -344,6 +350,9 @@ export default function UserPage() {
       expTime: user.expTime ? new Date(user.expTime) : null,
       flowResetTime: user.flowResetTime ?? 0,
       groupIds: currentGroupIds,
+      bandwidthUp: user.bandwidthUp ?? 0,
+      bandwidthDown: user.bandwidthDown ?? 0,
+      bandwidthBurst: user.bandwidthBurst ?? 0,
     });
     onUserModalOpen();
   };
@@ -968,6 +977,47 @@ export default function UserPage() {
                   ))}
                 </>
               </Select>
+              <div className="grid grid-cols-3 gap-3">
+                <Input
+                  description="所有转发共享，0 不限制"
+                  label="上行带宽(Mbps)"
+                  min="0"
+                  type="number"
+                  value={userForm.bandwidthUp.toString()}
+                  onChange={(e) =>
+                    setUserForm((prev) => ({
+                      ...prev,
+                      bandwidthUp: Math.max(Number(e.target.value) || 0, 0),
+                    }))
+                  }
+                />
+                <Input
+                  description="所有转发共享，0 不限制"
+                  label="下行带宽(Mbps)"
+                  min="0"
+                  type="number"
+                  value={userForm.bandwidthDown.toString()}
+                  onChange={(e) =>
+                    setUserForm((prev) => ({
+                      ...prev,
+                      bandwidthDown: Math.max(Number(e.target.value) || 0, 0),
+                    }))
+                  }
+                />
+                <Input
+                  description="0 为一秒流量"
+                  label="突发流量(MB)"
+                  min="0"
+                  type="number"
+                  value={userForm.bandwidthBurst.toString()}
+                  onChange={(e) =>
+                    setUserForm((prev) => ({
+                      ...prev,
+                      bandwidthBurst: Math.max(Number(e.target.value) || 0, 0),
+                    }))
+                  }
+                />
+              </div>
               <DatePicker
                 isRequired
                 showMonthAndYearPickers
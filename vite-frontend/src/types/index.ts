@@ -18,6 +18,9 @@ export interface User {
   createdTime?: number; // 创建时间戳
   inFlow?: number; // 下载流量(字节)
   outFlow?: number; // 上传流量(字节)
+  bandwidthUp?: number; // 共享上行带宽(Mbps)，0 不限制
+  bandwidthDown?: number; // 共享下行带宽(Mbps)，0 不限制
+  bandwidthBurst?: number; // 突发流量(MB)
 }
 
 export interface UserGroup {
@@ -37,6 +40,9 @@ export interface UserForm {
   expTime: Date | null;
   flowResetTime: number;
   groupIds?: number[];
+  bandwidthUp: number;
+  bandwidthDown: number;
+  bandwidthBurst: number;
 }
 
 export interface UserTunnel {